@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Admin console ----
+//
+// Plain server-rendered pages over the operational state, so running the
+// dashboard doesn't mean editing JSON files over SSH. Each page reads the
+// same stores as the API and acts through it:
+//
+//	GET /admin                  index of the admin pages
+//	GET /admin/jobs             mail jobs and mails given up on (retry)
+//	GET /admin/audit-log        the email log and recent employee changes
+//	GET /admin/data-quality     the data-quality report (dataquality.go)
+//	GET /admin/suppression      blackouts and opt-outs (add, lift, restore)
+//
+// The older pages (/admin/queues, /admin/stage, /admin/circulars,
+// /admin/sessions) are linked from the index.
+
+const adminLogRows = 200 // newest entries shown of each log
+
+// adminPage writes an admin console page around body.
+func adminPage(w http.ResponseWriter, r *http.Request, title, body string) {
+	t := tenantFor(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>%s – %s</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}table{border-collapse:collapse;width:100%%;margin-bottom:24px}
+td,th{border:1px solid #334155;padding:6px;text-align:left;font-size:13px}th{background:#1b263b}a{color:#93c5fd}
+.bad{color:#fca5a5}.ok{color:#86efac}input,select{background:#1b263b;color:#f1f5f9;border:1px solid #334155;padding:4px}</style></head>
+<body><p><a href="%s/admin">Admin</a> · <a href="%s/">Dashboard</a></p><h1>%s</h1>
+%s
+<script>
+function call(method,path,body){
+  var o={method:method};
+  if(body){o.headers={'Content-Type':'application/json'};o.body=JSON.stringify(body);}
+  fetch(%q+path,o).then(function(r){return r.json();})
+    .then(function(j){ if(j.errors){alert(j.errors[0].detail);return;} location.reload(); });
+}
+</script></body></html>`, html.EscapeString(title), html.EscapeString(t.PageTitle()), t.Prefix, t.Prefix,
+		html.EscapeString(title), body, t.Prefix)
+}
+
+// GET /admin
+func handleAdminIndex(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	pages := [][2]string{
+		{"/admin/jobs", "Mail jobs and the retry queue"},
+		{"/admin/audit-log", "Audit log: deliveries and employee changes"},
+		{"/admin/data-quality", "Data-quality report"},
+		{"/admin/suppression", "Suppression list: blackouts and opt-outs"},
+		{"/admin/queues", "Correction and grievance queues"},
+		{"/admin/stage", "Staged build"},
+		{"/archive/", "Monthly archive"},
+		{"/admin/circulars", "Circulars awaiting approval"},
+	}
+	if userFor(r).Role == roleSuperAdmin {
+		pages = append(pages, [2]string{"/admin/sessions", "Active sessions"})
+	}
+	var b strings.Builder
+	b.WriteString("<ul>")
+	for _, p := range pages {
+		fmt.Fprintf(&b, `<li><a href="%s%s">%s</a></li>`, tenantFor(r).Prefix, p[0], html.EscapeString(p[1]))
+	}
+	b.WriteString("</ul>")
+	adminPage(w, r, "Admin console", b.String())
+}
+
+// GET /admin/jobs
+func handleAdminJobs(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, e := tenantFor(r), html.EscapeString
+	var jobs []MailJob
+	var mails []QueuedMail
+	mailq.Lock()
+	for _, j := range mailq.jobs {
+		if j.Tenant == t.ID {
+			c := *j
+			c.Pending = c.Queued - c.Sent - c.Failed
+			jobs = append(jobs, c)
+		}
+	}
+	for _, m := range mailq.mails {
+		if m.Tenant == t.ID || m.Tenant == "" {
+			c := *m
+			c.Body, c.Files = "", nil
+			mails = append(mails, c)
+		}
+	}
+	mailq.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	sort.Slice(mails, func(i, j int) bool { return mails[i].Queued.Before(mails[j].Queued) })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h2>Jobs (%d)</h2><table><thead><tr><th>Job</th><th>Kind</th><th>Started</th><th>Queued</th><th>Sent</th><th>Failed</th><th>Pending</th><th>State</th></tr></thead><tbody>`, len(jobs))
+	for _, j := range jobs {
+		state := "queueing"
+		if j.Done {
+			state = "all queued"
+		}
+		fmt.Fprintf(&b, `<tr><td><a href="%s/api/mail/jobs/%s">%s</a></td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td%s>%d</td><td>%d</td><td>%s</td></tr>`,
+			t.Prefix, e(j.ID), e(j.ID), e(j.Kind), j.Started.Format("02 Jan 15:04"), j.Queued, j.Sent,
+			adminClass(j.Failed > 0), j.Failed, j.Pending, state)
+	}
+	if len(jobs) == 0 {
+		b.WriteString(`<tr><td colspan="8">No jobs since the server started (jobs are kept a week)</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+
+	fmt.Fprintf(&b, `<h2>Mail queue (%d)</h2><table><thead><tr><th>To</th><th>Subject</th><th>Job</th><th>Queued</th><th>Attempts</th><th>Next try</th><th>Last error</th><th></th></tr></thead><tbody>`, len(mails))
+	for _, m := range mails {
+		next, action := m.NextAt.Format("02 Jan 15:04"), ""
+		if m.Failed {
+			next = `<span class="bad">given up</span>`
+			action = fmt.Sprintf(`<button onclick="call('POST','/api/mail/queue/retry?id=%s')">Retry</button>`, e(m.ID))
+		}
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			e(m.To), e(shorten(m.Subject, 60)), e(m.Job), m.Queued.Format("02 Jan 15:04"), m.Attempts, next, e(shorten(m.LastError, 80)), action)
+	}
+	if len(mails) == 0 {
+		b.WriteString(`<tr><td colspan="8">Nothing waiting</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+	adminPage(w, r, "Mail jobs", b.String())
+}
+
+// GET /admin/audit-log[?status=][&emp=]
+func handleAdminAuditLog(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, q, e := tenantFor(r), r.URL.Query(), html.EscapeString
+	status, emp := q.Get("status"), strings.TrimSpace(q.Get("emp"))
+	var recs []EmailLogRecord
+	if t.EmailLog != "" {
+		readJSONL(t.EmailLog, func(rec EmailLogRecord) {
+			if (status == "" || rec.Status == status) && (emp == "" || rec.EmpID == emp) {
+				recs = append(recs, rec)
+			}
+		})
+	}
+	total := len(recs)
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].At.After(recs[j].At) })
+	recs = recs[:min(len(recs), adminLogRows)]
+
+	var b strings.Builder
+	b.WriteString(`<form method="get"><select name="status"><option value="">any status</option>`)
+	for _, s := range []string{mailSent, mailFailed, mailRetrying, mailDryRun} {
+		sel := ""
+		if s == status {
+			sel = " selected"
+		}
+		fmt.Fprintf(&b, `<option%s>%s</option>`, sel, s)
+	}
+	fmt.Fprintf(&b, `</select> <input name="emp" placeholder="employee ID" value="%s"> <button>Filter</button>
+ <a href="%s/api/email-log">JSON</a></form>`, e(emp), t.Prefix)
+	fmt.Fprintf(&b, `<h2>Deliveries (%d of %d)</h2><table><thead><tr><th>When</th><th>Employee</th><th>To</th><th>Subject</th><th>Status</th><th>Attempt</th><th>Job</th><th>Error</th></tr></thead><tbody>`, len(recs), total)
+	for _, rec := range recs {
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td%s>%s</td><td>%d</td><td>%s</td><td>%s</td></tr>`,
+			rec.At.Format("02 Jan 15:04"), e(rec.EmpID), e(rec.To), e(shorten(rec.Subject, 60)),
+			adminClass(rec.Status == mailFailed), e(rec.Status), rec.Attempt, e(rec.Job), e(shorten(rec.Error, 80)))
+	}
+	if len(recs) == 0 {
+		b.WriteString(`<tr><td colspan="8">No deliveries logged</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+
+	var changes []HistoryEntry
+	if t.history != nil {
+		for _, h := range t.history.Since(time.Now().AddDate(0, 0, -30)) {
+			if emp == "" || h.EmpID == emp {
+				changes = append(changes, h)
+			}
+		}
+	}
+	slices.Reverse(changes)
+	shown := changes[:min(len(changes), adminLogRows)]
+	fmt.Fprintf(&b, `<h2>Employee changes, last 30 days (%d of %d)</h2><table><thead><tr><th>When</th><th>Employee</th><th>Field</th><th>From</th><th>To</th></tr></thead><tbody>`, len(shown), len(changes))
+	for _, h := range shown {
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			h.At.Format("02 Jan 15:04"), e(h.EmpID), e(h.Field), e(h.From), e(h.To))
+	}
+	if len(shown) == 0 {
+		b.WriteString(`<tr><td colspan="5">No changes recorded</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+	adminPage(w, r, "Audit log", b.String())
+}
+
+// GET /admin/data-quality
+func handleAdminDataQuality(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	limits, err := parseDQLimits(*dqLimits)
+	if err != nil {
+		http.Error(w, "-dq-limits: "+err.Error(), 500)
+		return
+	}
+	ds, e := dataFor(r), html.EscapeString
+	blank, rows := blankIDRows(ds.Inputs)
+	rep := dataQuality(ds.EMP, ds.SCH, blank, ds.DUPLICATES, rows, dqSamplesDef, limits)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<p>%d employees, %d schools, %d rows read; %d limit(s) breached. <a href="%s/api/data-quality">JSON</a></p>`,
+		rep.Employees, rep.Schools, rep.Rows, rep.Breached, tenantFor(r).Prefix)
+	b.WriteString(`<table><thead><tr><th>Check</th><th>What</th><th>Count</th><th>Of</th><th>%</th><th>Limit</th></tr></thead><tbody>`)
+	for _, c := range rep.Checks {
+		limit := ""
+		if c.Limit != nil {
+			limit = fmt.Sprintf("%g%%", *c.Limit)
+		}
+		fmt.Fprintf(&b, `<tr><td><a href="#%s">%s</a></td><td>%s</td><td%s>%d</td><td>%d</td><td>%.1f</td><td>%s</td></tr>`,
+			c.Check, c.Check, e(c.Label), adminClass(c.Breached), c.Count, c.Of, c.Pct, limit)
+	}
+	b.WriteString("</tbody></table>")
+	for _, c := range rep.Checks {
+		if len(c.Samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<h2 id="%s">%s (first %d of %d)</h2><table><thead><tr><th>ID</th><th>Name</th><th>File</th><th>Row</th><th>Value</th></tr></thead><tbody>`,
+			c.Check, c.Check, len(c.Samples), c.Count)
+		for _, s := range c.Samples {
+			row := ""
+			if s.Row > 0 {
+				row = fmt.Sprint(s.Row)
+			}
+			fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`, e(s.ID), e(s.Name), e(s.File), row, e(s.Value))
+		}
+		b.WriteString("</tbody></table>")
+	}
+	adminPage(w, r, "Data quality", b.String())
+}
+
+// GET /admin/suppression
+func handleAdminSuppression(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, e := tenantFor(r), html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<h2>Blackouts</h2>
+<p><select id="bk"><option>zone</option><option>school</option></select> <input id="bid" placeholder="zone or school id">
+<input id="breason" placeholder="reason"> until <input id="buntil" type="date">
+<button onclick="call('POST','/api/blackout',{kind:bk.value,id:bid.value,reason:breason.value,until:buntil.value})">Add</button></p>
+<table><thead><tr><th>Kind</th><th>ID</th><th>Reason</th><th>Until</th><th>Added</th><th>State</th><th></th></tr></thead><tbody>`)
+	list := t.blackout().List()
+	sort.SliceStable(list, func(i, j int) bool { return (list[i].Deleted == nil) && (list[j].Deleted != nil) })
+	for _, x := range list {
+		q := "kind=" + e(x.Kind) + "&amp;id=" + e(x.ID)
+		state, action := `<span class="ok">in force</span>`, fmt.Sprintf(`<button onclick="call('DELETE','/api/blackout?%s')">Lift</button>`, q)
+		switch {
+		case x.Deleted != nil:
+			state = fmt.Sprintf("lifted %s by %s", x.Deleted.At.Format("02 Jan 15:04"), e(x.Deleted.By))
+			action = fmt.Sprintf(`<button onclick="call('POST','/api/blackout/restore?%s')">Restore</button>`, q)
+		case !x.Active:
+			state = "expired"
+		}
+		until := x.Until
+		if until == "" {
+			until = "until lifted"
+		}
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s by %s</td><td>%s</td><td>%s</td></tr>`,
+			e(x.Kind), e(x.ID), e(x.Reason), e(until), x.Added.Format("02 Jan 2006"), e(x.By), state, action)
+	}
+	if len(list) == 0 {
+		b.WriteString(`<tr><td colspan="7">No blackouts</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+
+	prefs, emp := t.prefs().All(), t.Data().EMP
+	b.WriteString(`<h2>Opt-outs</h2><p>Employees who turned a channel off, and deleted preference records (back on the defaults until restored).</p>
+<table><thead><tr><th>Employee</th><th>Name</th><th>Email</th><th>SMS</th><th>WhatsApp</th><th>Changed</th><th></th></tr></thead><tbody>`)
+	n := 0
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return `<span class="bad">off</span>`
+	}
+	for _, id := range sortedKeys(prefs) {
+		p := prefs[id]
+		if p.Deleted == nil && p.Email && p.SMS && p.WhatsApp {
+			continue
+		}
+		n++
+		changed, action := "", fmt.Sprintf(`<button onclick="call('DELETE','/api/prefs?id=%s')">Reset to defaults</button>`, e(id))
+		if p.Updated != nil {
+			changed = p.Updated.Format("02 Jan 2006") + " by " + e(p.By)
+		}
+		if p.Deleted != nil {
+			changed = fmt.Sprintf("deleted %s by %s", p.Deleted.At.Format("02 Jan 15:04"), e(p.Deleted.By))
+			action = fmt.Sprintf(`<button onclick="call('POST','/api/prefs/restore?id=%s')">Restore</button>`, e(id))
+		}
+		fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			e(id), e(emp[id].Name), onOff(p.Email), onOff(p.SMS), onOff(p.WhatsApp), changed, action)
+	}
+	if n == 0 {
+		b.WriteString(`<tr><td colspan="7">Nobody has opted out</td></tr>`)
+	}
+	b.WriteString("</tbody></table>")
+	adminPage(w, r, "Suppression list", b.String())
+}
+
+// adminClass marks a table cell as a problem when bad.
+func adminClass(bad bool) string {
+	if bad {
+		return ` class="bad"`
+	}
+	return ""
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- School alerts ----
+//
+// With -alert-checks the server checks every build's schools and raises an
+// alert for each school failing a check:
+//
+//	mdm_anomaly        more mid-day meals a day than children enrolled
+//	no_teacher         children enrolled but no teacher on the rolls
+//	teacher_shortage   fewer teachers than the 1:40 norm asks for
+//
+// An alert is mailed to the first link of the school's escalation chain
+// (escalation.go) that has an address. Still open -alert-escalate later,
+// it goes to the next link, and so on up to the DDE. It closes by itself
+// once a build no longer fails the check. Alerts are kept in -alerts.
+//
+// Each mail carries its recipient's own signed acknowledge link (signed
+// like the /prefs links; absolute with -public-url). Acknowledgements are
+// recorded per alert and recipient, and an alert acknowledged by someone
+// at the level it has reached stops escalating; it still only closes when
+// the data does.
+//
+//	GET      /api/alerts[?zone=][&status=open|unacknowledged|resolved|all]
+//	GET      /api/alerts/outstanding      per zone: open and unacknowledged alerts
+//	GET/POST /alert/ack?a=&r=&sig=        (public; the link in the mail)
+
+var (
+	alertsFile    = flag.String("alerts", "./out/alerts.json", "School alerts and who has been told")
+	alertChecks   = flag.String("alert-checks", "", "Comma-separated school checks to raise alerts for (empty = no alerts; see alerts.go)")
+	alertEscalate = flag.Duration("alert-escalate", 48*time.Hour, "Escalate an alert still open this long to the next level (0 = never)")
+)
+
+// alertCheckFuncs say what is wrong with a school, or "" when nothing is.
+var alertCheckFuncs = map[string]func(s School, roster []Emp) string{
+	"mdm_anomaly": func(s School, _ []Emp) string {
+		if !s.MDMAnomaly {
+			return ""
+		}
+		return fmt.Sprintf("serves %d mid-day meals a day against %d children enrolled", s.MDMDaily, s.TotalEnrolment)
+	},
+	"no_teacher": func(s School, roster []Emp) string {
+		if s.TotalEnrolment == 0 || schoolStaff(s, roster).ActualTeachers > 0 {
+			return ""
+		}
+		return fmt.Sprintf("has %d children enrolled and no teacher on the rolls", s.TotalEnrolment)
+	},
+	"teacher_shortage": func(s School, roster []Emp) string {
+		st := schoolStaff(s, roster)
+		if st.ActualTeachers == 0 || st.SurplusVacancy >= 0 {
+			return ""
+		}
+		return fmt.Sprintf("has %d teacher(s) where the 1:40 norm asks for %d", st.ActualTeachers, st.NeededTeachers)
+	},
+}
+
+const (
+	alertOpen     = "open"
+	alertResolved = "resolved"
+	alertUnacked  = "unacknowledged" // a filter: open and not acknowledged at its level
+)
+
+// alertKeep is how long resolved alerts are kept.
+const alertKeep = 90 * 24 * time.Hour
+
+type AlertNotice struct {
+	Level string    `json:"level"`
+	To    []string  `json:"to"`
+	At    time.Time `json:"at"`
+}
+
+type AlertAck struct {
+	By    string    `json:"by"` // the recipient's address
+	Level string    `json:"level"`
+	At    time.Time `json:"at"`
+	Note  string    `json:"note,omitempty"`
+}
+
+type Alert struct {
+	ID         string        `json:"id"`
+	Check      string        `json:"check"`
+	School     string        `json:"school"`
+	SchoolName string        `json:"school_name"`
+	Zone       string        `json:"zone"`
+	Detail     string        `json:"detail"`
+	Raised     time.Time     `json:"raised"`
+	Status     string        `json:"status"`
+	Level      int           `json:"level"` // last told: -1 nobody yet, else levelHoS, levelSI or levelDDE
+	Notices    []AlertNotice `json:"notices"`
+	Acks       []AlertAck    `json:"acks,omitempty"`
+	Resolved   *time.Time    `json:"resolved,omitempty"`
+}
+
+func (a *Alert) key() string { return a.Check + "/" + a.School }
+
+// acked reports whether someone at the level the alert has reached has
+// acknowledged it.
+func (a *Alert) acked() bool {
+	if a.Level < 0 || a.Level >= len(levelNames) {
+		return false
+	}
+	for _, k := range a.Acks {
+		if k.Level == levelNames[a.Level] {
+			return true
+		}
+	}
+	return false
+}
+
+// levelOf is the level at which to was last told about a, or "".
+func (a *Alert) levelOf(to string) string {
+	for i := len(a.Notices) - 1; i >= 0; i-- {
+		for _, r := range a.Notices[i].To {
+			if strings.EqualFold(r, to) {
+				return a.Notices[i].Level
+			}
+		}
+	}
+	return ""
+}
+
+type alertStore struct {
+	mu     sync.Mutex
+	path   string
+	alerts map[string]*Alert // by id
+	synced time.Time         // BuiltAt of the last build checked
+}
+
+var (
+	alertStoresMu sync.Mutex
+	alertStores   = map[string]*alertStore{} // by tenant id
+)
+
+// alerts returns the tenant's alerts, loading them on first use.
+func (t *Tenant) alerts() *alertStore {
+	alertStoresMu.Lock()
+	defer alertStoresMu.Unlock()
+	if s, ok := alertStores[t.ID]; ok {
+		return s
+	}
+	s := &alertStore{path: t.Alerts, alerts: map[string]*Alert{}}
+	if b, err := os.ReadFile(t.Alerts); err == nil {
+		if err := json.Unmarshal(b, &s.alerts); err != nil {
+			log.Printf("alerts %s: %v", t.Alerts, err)
+		}
+	}
+	alertStores[t.ID] = s
+	return s
+}
+
+// save writes the alerts, dropping long-resolved ones. Callers hold mu.
+func (s *alertStore) save() error {
+	if s.path == "" {
+		return fmt.Errorf("no alerts file configured")
+	}
+	for id, a := range s.alerts {
+		if a.Resolved != nil && time.Since(*a.Resolved) > alertKeep {
+			delete(s.alerts, id)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.alerts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// enabledAlertChecks are the known checks in -alert-checks.
+func enabledAlertChecks() []string {
+	var out []string
+	for _, c := range strings.Split(*alertChecks, ",") {
+		if c = strings.TrimSpace(c); alertCheckFuncs[c] != nil {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// check raises alerts for what ds's schools fail and resolves those they
+// no longer do. It returns the alerts raised.
+func (s *alertStore) check(ds *Dataset, now time.Time) []*Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !ds.BuiltAt.After(s.synced) {
+		return nil
+	}
+	s.synced = ds.BuiltAt
+	failing := map[string]*Alert{}
+	rosters := rosterBySchool(ds.EMP)
+	for _, name := range enabledAlertChecks() {
+		fn := alertCheckFuncs[name]
+		for id, sch := range ds.SCH {
+			if detail := fn(sch, rosters[id]); detail != "" {
+				a := &Alert{Check: name, School: id, SchoolName: sch.Name, Zone: sch.Zone, Detail: detail, Raised: now, Status: alertOpen, Level: -1}
+				failing[a.key()] = a
+			}
+		}
+	}
+	for _, a := range s.alerts {
+		if a.Status != alertOpen {
+			continue
+		}
+		if f, ok := failing[a.key()]; ok {
+			a.Detail = f.Detail
+			delete(failing, a.key())
+			continue
+		}
+		at := now
+		a.Status, a.Resolved = alertResolved, &at
+	}
+	var raised []*Alert
+	for _, a := range failing {
+		b := make([]byte, 6)
+		_, _ = rand.Read(b)
+		a.ID = hex.EncodeToString(b)
+		s.alerts[a.ID] = a
+		raised = append(raised, a)
+	}
+	if err := s.save(); err != nil {
+		log.Printf("alerts: %v", err)
+	}
+	return raised
+}
+
+// escalate tells the next level about each open alert that is new or has
+// sat at its level for -alert-escalate.
+func (s *alertStore) escalate(t *Tenant, ds *Dataset, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for _, a := range s.alerts {
+		if a.Status != alertOpen || a.Level >= levelDDE || a.acked() {
+			continue
+		}
+		if a.Level >= 0 && (*alertEscalate <= 0 || now.Sub(a.Notices[len(a.Notices)-1].At) < *alertEscalate) {
+			continue
+		}
+		chain := escalationChain(t, ds, a.School)
+		for a.Level < levelDDE {
+			a.Level++
+			if step := chain[a.Level]; len(step.To) > 0 {
+				a.Notices = append(a.Notices, AlertNotice{Level: step.Level, To: step.To, At: now})
+				sendAlert(t, a, step)
+				break
+			}
+		}
+		changed = true
+	}
+	if changed {
+		if err := s.save(); err != nil {
+			log.Printf("alerts: %v", err)
+		}
+	}
+}
+
+// sendAlert mails step about a.
+func sendAlert(t *Tenant, a *Alert, step EscalationStep) {
+	esc := html.EscapeString
+	subject := fmt.Sprintf("Alert: %s %s", a.SchoolName, a.Detail)
+	body := fmt.Sprintf(`<p>%s (%s, zone %s) %s.</p><p>Raised %s.</p>`,
+		esc(a.SchoolName), esc(a.School), esc(a.Zone), esc(a.Detail), a.Raised.Format("02 Jan 2006 15:04"))
+	if len(a.Notices) > 1 {
+		prev := a.Notices[len(a.Notices)-2]
+		body += fmt.Sprintf(`<p>This has been escalated to you (%s) because it is still open %s after the %s was told.</p>`,
+			esc(step.Level), esc(time.Since(prev.At).Round(time.Hour).String()), esc(prev.Level))
+	}
+	from := t.senderFor(a.Zone)
+	for _, to := range step.To {
+		mail := body
+		if link := t.alertAckLink(a.ID, to); link != "" {
+			mail += `<p>Let us know you have taken this up: <a href="` + esc(link) + `">acknowledge this alert</a>.</p>`
+		}
+		if err := queueMail(t, "", from, "", to, subject, mail); err != nil {
+			log.Printf("alert %s to %s: %v", a.ID, to, err)
+		}
+	}
+	log.Printf("🚨 Alert %s (%s at %s) sent to %s: %s", a.ID, a.Check, a.School, step.Level, strings.Join(step.To, ", "))
+}
+
+// startAlerts checks each new build and escalates alerts every minute.
+func startAlerts() {
+	for _, c := range strings.Split(*alertChecks, ",") {
+		if c = strings.TrimSpace(c); c != "" && alertCheckFuncs[c] == nil {
+			log.Printf("alerts: unknown check %q ignored", c)
+		}
+	}
+	checks := enabledAlertChecks()
+	if len(checks) == 0 {
+		return
+	}
+	log.Printf("🚨 School alerts on for %s, escalating after %s", strings.Join(checks, ", "), *alertEscalate)
+	go func() {
+		for ; ; time.Sleep(time.Minute) {
+			if !isLeader() {
+				continue
+			}
+			for _, t := range TENANTS {
+				ds := t.Data()
+				if ds == nil {
+					continue
+				}
+				s := t.alerts()
+				if raised := s.check(ds, time.Now()); len(raised) > 0 {
+					log.Printf("🚨 %d new alert(s) for %s", len(raised), t.ID)
+				}
+				s.escalate(t, ds, time.Now())
+			}
+		}
+	}()
+}
+
+// Visible lists the alerts in zone ("" for all) with the given status,
+// newest first.
+func (s *alertStore) Visible(zone, status string) []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Alert{}
+	for _, a := range s.alerts {
+		switch {
+		case zone != "" && !strings.EqualFold(a.Zone, zone):
+			continue
+		case status == alertUnacked:
+			if a.Status != alertOpen || a.acked() {
+				continue
+			}
+		case status != "all" && a.Status != status:
+			continue
+		}
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Raised.After(out[j].Raised) })
+	return out
+}
+
+// GET /api/alerts[?zone=][&status=]
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	zone, status := strings.ToUpper(strings.TrimSpace(q.Get("zone"))), q.Get("status")
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	switch status {
+	case "":
+		status = alertOpen
+	case alertOpen, alertUnacked, alertResolved, "all":
+	default:
+		writeError(w, 400, errBadRequest, "status must be open, unacknowledged, resolved or all")
+		return
+	}
+	list := tenantFor(r).alerts().Visible(zone, status)
+	writeData(w, list, &Meta{Count: len(list)})
+}
+
+func (s *alertStore) Get(id string) (Alert, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.alerts[id]; ok {
+		return *a, true
+	}
+	return Alert{}, false
+}
+
+// Ack records that to acknowledged alert id.
+func (s *alertStore) Ack(id, to, note string) (Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.alerts[id]
+	if !ok {
+		return Alert{}, fmt.Errorf("no alert %s", id)
+	}
+	level := a.levelOf(to)
+	if level == "" {
+		return *a, fmt.Errorf("%s was not sent alert %s", to, id)
+	}
+	for _, k := range a.Acks {
+		if strings.EqualFold(k.By, to) {
+			return *a, nil
+		}
+	}
+	a.Acks = append(a.Acks, AlertAck{By: strings.ToLower(to), Level: level, At: time.Now(), Note: note})
+	if err := s.save(); err != nil {
+		a.Acks = a.Acks[:len(a.Acks)-1]
+		return *a, err
+	}
+	return *a, nil
+}
+
+func alertAckID(id, to string) string { return id + "|" + strings.ToLower(to) }
+
+// alertAckLink is to's acknowledge link for alert id, or "" without a link
+// key.
+func (t *Tenant) alertAckLink(id, to string) string {
+	s := t.prefs()
+	if len(s.key) == 0 {
+		return ""
+	}
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/alert/ack?a=" + url.QueryEscape(id) + "&r=" + url.QueryEscape(to) +
+		"&sig=" + s.signFor("alert", alertAckID(id, to))
+}
+
+// AlertOutstanding is one zone's line of /api/alerts/outstanding.
+type AlertOutstanding struct {
+	Zone           string         `json:"zone"`
+	Open           int            `json:"open"`
+	Unacknowledged int            `json:"unacknowledged"`
+	ByLevel        map[string]int `json:"unacknowledged_by_level"` // at the level each has reached
+	Oldest         *time.Time     `json:"oldest_unacknowledged,omitempty"`
+}
+
+// GET /api/alerts/outstanding
+func handleAlertsOutstanding(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	zone := ""
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	zones := map[string]*AlertOutstanding{}
+	for _, a := range tenantFor(r).alerts().Visible(zone, alertOpen) {
+		z := zones[a.Zone]
+		if z == nil {
+			z = &AlertOutstanding{Zone: a.Zone, ByLevel: map[string]int{}}
+			zones[a.Zone] = z
+		}
+		z.Open++
+		if a.acked() {
+			continue
+		}
+		z.Unacknowledged++
+		if a.Level >= 0 {
+			z.ByLevel[levelNames[a.Level]]++
+		}
+		if z.Oldest == nil || a.Raised.Before(*z.Oldest) {
+			at := a.Raised
+			z.Oldest = &at
+		}
+	}
+	out := []AlertOutstanding{}
+	for _, z := range zones {
+		out = append(out, *z)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Unacknowledged != out[j].Unacknowledged {
+			return out[i].Unacknowledged > out[j].Unacknowledged
+		}
+		return out[i].Zone < out[j].Zone
+	})
+	writeData(w, out, &Meta{Count: len(out)})
+}
+
+// GET/POST /alert/ack?a=&r=&sig= (public; the link in an alert mail). GET
+// only shows the alert, so a mail scanner following links doesn't
+// acknowledge it.
+func handleAlertAckPage(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	id, to, sig := r.FormValue("a"), strings.TrimSpace(r.FormValue("r")), r.FormValue("sig")
+	if !t.prefs().verifyFor("alert", alertAckID(id, to), sig) {
+		http.Error(w, "This link is not valid.", http.StatusForbidden)
+		return
+	}
+	esc := html.EscapeString
+	msg := ""
+	if r.Method == http.MethodPost {
+		if _, err := t.alerts().Ack(id, to, strings.TrimSpace(r.FormValue("note"))); err != nil {
+			msg = `<p style="color:#f87171">` + esc(err.Error()) + `</p>`
+		} else {
+			log.Printf("🚨 Alert %s acknowledged by %s", id, to)
+		}
+	}
+	a, ok := t.alerts().Get(id)
+	if !ok {
+		http.Error(w, "This alert no longer exists.", http.StatusNotFound)
+		return
+	}
+	state := `<form method="post"><input type="hidden" name="a" value="` + esc(id) + `"><input type="hidden" name="r" value="` + esc(to) +
+		`"><input type="hidden" name="sig" value="` + esc(sig) + `"><textarea name="note" rows="3" maxlength="1000" placeholder="Note (optional)"></textarea>
+<button>Acknowledge</button></form>`
+	for _, k := range a.Acks {
+		if strings.EqualFold(k.By, to) {
+			state = `<p style="color:#4ade80">Acknowledged by you on ` + k.At.Format("02 Jan 2006 15:04") + `. Thank you.</p>`
+		}
+	}
+	if a.Status == alertResolved {
+		state = `<p>This alert has been resolved.</p>`
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Alert – %s</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>textarea,button{width:100%%;box-sizing:border-box;margin:6px 0;padding:8px;border-radius:6px;border:1px solid #334155}</style></head>
+<body style="font-family:system-ui;background:#0d1b2a;color:#f1f5f9;max-width:640px;margin:40px auto;padding:0 12px">
+<h1>Alert</h1><p><b>%s</b> (%s, zone %s) %s.</p><p>Raised %s.</p>%s%s</body></html>`, esc(t.PageTitle()),
+		esc(a.SchoolName), esc(a.School), esc(a.Zone), esc(a.Detail), a.Raised.Format("02 Jan 2006 15:04"), msg, state)
+}
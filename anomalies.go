@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---- Anomalies ----
+//
+// Records that fall between the exports and so out of every zone or school
+// figure, listed so they can be fixed at source:
+//
+//	unknown_zone    employees whose Zone ID is blank (ingest files them under UNKNOWN)
+//	orphan_school   school IDs employees are posted to that the DBT summary doesn't have
+//	empty_school    DBT schools no employee is posted to
+//
+// The build works them out with the rest, and the dashboard shows the
+// counts and the first few of each:
+//
+//	GET /api/anomalies[?kind=unknown_zone|orphan_school|empty_school][&zone=][&format=csv]
+//
+// A DDE sees their own zone's: for an employee without a zone, that of the
+// school they are posted to.
+
+const (
+	anomalyUnknownZone  = "unknown_zone"
+	anomalyOrphanSchool = "orphan_school"
+	anomalyEmptySchool  = "empty_school"
+
+	anomalyPageRows = 10 // of each list on the dashboard
+)
+
+// AnomalyEmp is an employee without a zone.
+type AnomalyEmp struct {
+	EmpID       string `json:"emp_id"`
+	Name        string `json:"name"`
+	Designation string `json:"designation"`
+	SchoolID    string `json:"school_id"`
+	SchoolName  string `json:"school_name"`
+	Zone        string `json:"zone,omitempty"` // the school's, when the DBT summary has it
+}
+
+// OrphanSchool is a school ID in Basic that the DBT summary lacks.
+type OrphanSchool struct {
+	SchoolID   string   `json:"school_id"`
+	SchoolName string   `json:"school_name"` // as Basic writes it
+	Zone       string   `json:"zone"`        // its employees' most common
+	Employees  int      `json:"employees"`
+	EmpIDs     []string `json:"emp_ids"`
+}
+
+// EmptySchool is a DBT school without staff.
+type EmptySchool struct {
+	SchoolID  string `json:"school_id"`
+	Name      string `json:"name"`
+	Zone      string `json:"zone"`
+	SIName    string `json:"si_name,omitempty"`
+	Enrolment int    `json:"enrolment"`
+}
+
+type Anomalies struct {
+	UnknownZone   []AnomalyEmp   `json:"unknown_zone"`
+	OrphanSchools []OrphanSchool `json:"orphan_schools"`
+	EmptySchools  []EmptySchool  `json:"empty_schools"`
+}
+
+// Total counts the anomalies of every kind.
+func (a Anomalies) Total() int {
+	return len(a.UnknownZone) + len(a.OrphanSchools) + len(a.EmptySchools)
+}
+
+// findAnomalies looks for the three kinds in emp and sch.
+func findAnomalies(emp map[string]Emp, sch map[string]School) Anomalies {
+	a := Anomalies{UnknownZone: []AnomalyEmp{}, OrphanSchools: []OrphanSchool{}, EmptySchools: []EmptySchool{}}
+	orphans := map[string]*OrphanSchool{}
+	orphanZones := map[string]map[string]int{}
+	for _, id := range sortedKeys(emp) {
+		e := emp[id]
+		if z := strings.TrimSpace(e.Zone); z == "" || z == "UNKNOWN" {
+			a.UnknownZone = append(a.UnknownZone, AnomalyEmp{EmpID: id, Name: e.Name, Designation: e.Designation,
+				SchoolID: e.SchoolID, SchoolName: e.SchoolName, Zone: sch[e.SchoolID].Zone})
+		}
+		if e.SchoolID == "" {
+			continue
+		}
+		if _, ok := sch[e.SchoolID]; ok {
+			continue
+		}
+		o := orphans[e.SchoolID]
+		if o == nil {
+			o = &OrphanSchool{SchoolID: e.SchoolID, SchoolName: e.SchoolName}
+			orphans[e.SchoolID], orphanZones[e.SchoolID] = o, map[string]int{}
+		}
+		o.Employees++
+		o.EmpIDs = append(o.EmpIDs, id)
+		orphanZones[e.SchoolID][e.Zone]++
+	}
+	for _, id := range sortedKeys(orphans) {
+		o := orphans[id]
+		for _, z := range sortedKeys(orphanZones[id]) {
+			if orphanZones[id][z] > orphanZones[id][o.Zone] {
+				o.Zone = z
+			}
+		}
+		a.OrphanSchools = append(a.OrphanSchools, *o)
+	}
+	sort.SliceStable(a.OrphanSchools, func(i, j int) bool { return a.OrphanSchools[i].Employees > a.OrphanSchools[j].Employees })
+	roster := rosterBySchool(emp)
+	for _, id := range sortedKeys(sch) {
+		if s := sch[id]; len(roster[id]) == 0 {
+			a.EmptySchools = append(a.EmptySchools, EmptySchool{SchoolID: id, Name: s.Name, Zone: s.Zone, SIName: s.SIName, Enrolment: s.TotalEnrolment})
+		}
+	}
+	sort.SliceStable(a.EmptySchools, func(i, j int) bool { return a.EmptySchools[i].Enrolment > a.EmptySchools[j].Enrolment })
+	if n := a.Total(); n > 0 {
+		log.Printf("🧩 %d employee(s) without a zone, %d school ID(s) not in the DBT summary, %d school(s) without staff (see /api/anomalies)",
+			len(a.UnknownZone), len(a.OrphanSchools), len(a.EmptySchools))
+	}
+	return a
+}
+
+// inZone keeps a's anomalies in zone.
+func (a Anomalies) inZone(zone string) Anomalies {
+	out := Anomalies{UnknownZone: []AnomalyEmp{}, OrphanSchools: []OrphanSchool{}, EmptySchools: []EmptySchool{}}
+	for _, e := range a.UnknownZone {
+		if e.Zone == zone {
+			out.UnknownZone = append(out.UnknownZone, e)
+		}
+	}
+	for _, o := range a.OrphanSchools {
+		if o.Zone == zone {
+			out.OrphanSchools = append(out.OrphanSchools, o)
+		}
+	}
+	for _, s := range a.EmptySchools {
+		if s.Zone == zone {
+			out.EmptySchools = append(out.EmptySchools, s)
+		}
+	}
+	return out
+}
+
+// pageRows is a with each list cut to what the dashboard shows.
+func (a Anomalies) pageRows() Anomalies {
+	a.UnknownZone = a.UnknownZone[:min(len(a.UnknownZone), anomalyPageRows)]
+	a.OrphanSchools = a.OrphanSchools[:min(len(a.OrphanSchools), anomalyPageRows)]
+	a.EmptySchools = a.EmptySchools[:min(len(a.EmptySchools), anomalyPageRows)]
+	return a
+}
+
+// GET /api/anomalies
+func handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	kind := q.Get("kind")
+	switch kind {
+	case "", anomalyUnknownZone, anomalyOrphanSchool, anomalyEmptySchool:
+	default:
+		writeError(w, 400, errBadRequest, "kind must be unknown_zone, orphan_school or empty_school")
+		return
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	a := dataFor(r).ANOMALIES
+	if zone != "" {
+		a = a.inZone(zone)
+	}
+	if kind != "" {
+		keep := a
+		a = Anomalies{}
+		switch kind {
+		case anomalyUnknownZone:
+			a.UnknownZone = keep.UnknownZone
+		case anomalyOrphanSchool:
+			a.OrphanSchools = keep.OrphanSchools
+		case anomalyEmptySchool:
+			a.EmptySchools = keep.EmptySchools
+		}
+	}
+	if q.Get("format") == "csv" {
+		var rows [][]string
+		for _, e := range a.UnknownZone {
+			rows = append(rows, []string{anomalyUnknownZone, e.Zone, e.SchoolID, e.SchoolName, e.EmpID, e.Name, e.Designation, "1", ""})
+		}
+		for _, o := range a.OrphanSchools {
+			rows = append(rows, []string{anomalyOrphanSchool, o.Zone, o.SchoolID, o.SchoolName, strings.Join(o.EmpIDs, " "), "", "", strconv.Itoa(o.Employees), ""})
+		}
+		for _, s := range a.EmptySchools {
+			rows = append(rows, []string{anomalyEmptySchool, s.Zone, s.SchoolID, s.Name, "", "", "", "0", strconv.Itoa(s.Enrolment)})
+		}
+		writeCSV(w, r, "anomalies.csv", []string{"Anomaly", "Zone", "School ID", "School", "Employee ID(s)", "Name", "Designation",
+			"Employees", "Enrolment"}, rows)
+		return
+	}
+	switch kind {
+	case anomalyUnknownZone:
+		writeData(w, a.UnknownZone, nil)
+	case anomalyOrphanSchool:
+		writeData(w, a.OrphanSchools, nil)
+	case anomalyEmptySchool:
+		writeData(w, a.EmptySchools, nil)
+	default:
+		writeData(w, a, &Meta{Count: a.Total()})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// ---- API envelope ----
+//
+// Every JSON endpoint answers with the same shape, loosely following JSON:API:
+//
+//	{"data": ..., "meta": {"count": n, ...}}            on success
+//	{"errors": [{"status": "404", "code": "not_found", "detail": "..."}]}  on failure
+
+type APIError struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type Meta struct {
+	Count   int `json:"count"`
+	Total   int `json:"total,omitempty"`
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"per_page,omitempty"`
+	Pages   int `json:"pages,omitempty"`
+}
+
+type Envelope struct {
+	Data   any        `json:"data,omitempty"`
+	Meta   *Meta      `json:"meta,omitempty"`
+	Errors []APIError `json:"errors,omitempty"`
+}
+
+// Error codes shared by all endpoints.
+const (
+	errBadRequest       = "bad_request"
+	errNotFound         = "not_found"
+	errUnauthorized     = "unauthorized"
+	errForbidden        = "forbidden"
+	errMethodNotAllowed = "method_not_allowed"
+	errConflict         = "conflict"
+	errInternal         = "internal"
+	errUnavailable      = "unavailable"
+	errRateLimited      = "rate_limited"
+)
+
+func countOf(v any) int {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len()
+	case reflect.Invalid:
+		return 0
+	}
+	return 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, env Envelope) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(env)
+}
+
+// writeData sends a success envelope; meta is derived from data when nil.
+func writeData(w http.ResponseWriter, data any, meta *Meta) {
+	if meta == nil {
+		meta = &Meta{Count: countOf(data)}
+	}
+	writeJSON(w, http.StatusOK, Envelope{Data: data, Meta: meta})
+}
+
+func writeError(w http.ResponseWriter, status int, code, detail string) {
+	writeJSON(w, status, Envelope{Errors: []APIError{{Status: strconv.Itoa(status), Code: code, Detail: detail}}})
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, method+" required")
+		return false
+	}
+	return true
+}
+
+// pageParams reads ?page= and ?per_page= with sane bounds.
+func pageParams(r *http.Request, defPer, maxPer int) (page, per int) {
+	page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	per, _ = strconv.Atoi(r.URL.Query().Get("per_page"))
+	if page < 1 {
+		page = 1
+	}
+	if per < 1 {
+		per = defPer
+	}
+	if per > maxPer {
+		per = maxPer
+	}
+	return page, per
+}
+
+func paginate[T any](items []T, page, per int) ([]T, *Meta) {
+	total := len(items)
+	// Compare before multiplying: a huge ?page= would overflow.
+	start := total
+	if page-1 <= total/per {
+		start = min((page-1)*per, total)
+	}
+	end := start + per
+	if end > total {
+		end = total
+	}
+	out := items[start:end]
+	return out, &Meta{Count: len(out), Total: total, Page: page, PerPage: per, Pages: (total + per - 1) / per}
+}
+
+func handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, errNotFound, "no such endpoint: "+r.URL.Path)
+}
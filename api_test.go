@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmployeesPageOverflow(t *testing.T) {
+	ten := &Tenant{ID: "default"}
+	ten.data.Store(&Dataset{EMP: map[string]Emp{
+		"1": {ID: "1", Name: "A", Zone: "SOUTH"},
+		"2": {ID: "2", Name: "B", Zone: "WEST"},
+	}})
+	r := httptest.NewRequest("GET", "/api/employees?page=9223372036854775807", nil)
+	r = r.WithContext(context.WithValue(r.Context(), ctxTenant, ten))
+	w := httptest.NewRecorder()
+	handleAPIEmployees(w, r)
+	if w.Code != 200 {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var env struct {
+		Data []Emp `json:"data"`
+		Meta Meta  `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Data) != 0 || env.Meta.Total != 2 {
+		t.Errorf("got %d rows of %d, want 0 of 2", len(env.Data), env.Meta.Total)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	for _, c := range []struct{ page, per, want int }{
+		{1, 2, 2}, {3, 2, 1}, {4, 2, 0}, {1 << 62, 2, 0}, {9223372036854775807, 100, 0},
+	} {
+		if got, _ := paginate(items, c.page, c.per); len(got) != c.want {
+			t.Errorf("page %d per %d: %d rows, want %d", c.page, c.per, len(got), c.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Monthly archive ----
+//
+// When an admin approves a staged build (stage.go) it is archived for the
+// month it was built in, under -archive (a tenant's "archive_dir"): the
+// dashboard page as rendered, its data files and the headline numbers, in
+// <dir>/YYYY-MM/. A later approval in the same month replaces that month's
+// archive, so its permalink stays the same. Without -stage an admin
+// archives the served build by hand. Archives are never purged (see
+// retention.go) and, like the rest of the dashboard, need a login:
+//
+//	GET  /archive/                      the index, newest month first
+//	GET  /archive/{month}/              the archived page
+//	GET  /archive/{month}/data/{file}   its data files
+//	GET  /api/archive                   the index as JSON
+//	POST /api/archive                   archive the served build now
+//
+// Each archive is mailed to -archive-to with its permalink (under
+// -public-url) and the headline numbers. The archived page draws its
+// tables and charts from the archived data; its lookups and exports ask
+// the live API.
+
+var (
+	archiveDir = flag.String("archive", "./out/archive", "Directory for the monthly archive of approved builds (empty = off)")
+	archiveTo  = flag.String("archive-to", "", "Comma-separated recipients of the permalink to each month's archive (empty = no mail)")
+
+	rxArchiveMonth = regexp.MustCompile(`^\d{4}-(0[1-9]|1[0-2])$`)
+	rxArchiveFile  = regexp.MustCompile(`^[a-z]+\.[0-9a-f]{12}\.json$`)
+)
+
+const archiveMeta = "archive.json"
+
+// ArchiveEntry describes one month's archive.
+type ArchiveEntry struct {
+	Month      string    `json:"month"` // YYYY-MM
+	BuiltAt    time.Time `json:"built_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+	By         string    `json:"archived_by"`
+	Profile    string    `json:"profile,omitempty"`
+	Permalink  string    `json:"permalink"`
+	Headline   ZoneKPI   `json:"headline"` // all zones
+}
+
+// archivePermalink is where month's archive of t is served, absolute when
+// -public-url is set.
+func archivePermalink(t *Tenant, month string) string {
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/archive/" + month + "/"
+}
+
+// archiveBuild writes ds as its month's archive of t, replacing any earlier
+// one, and mails the permalink to -archive-to.
+func archiveBuild(t *Tenant, ds *Dataset, by string) (ArchiveEntry, error) {
+	if t.ArchiveDir == "" {
+		return ArchiveEntry{}, fmt.Errorf("no archive directory: -archive is off")
+	}
+	month := ds.BuiltAt.Format("2006-01")
+	e := ArchiveEntry{Month: month, BuiltAt: ds.BuiltAt, ArchivedAt: time.Now(), By: by, Profile: ds.Profile,
+		Permalink: archivePermalink(t, month), Headline: ds.ZONE_KPI[allZones]}
+	files := map[string]string{}
+	for name, f := range ds.DATA_FILES {
+		files[name] = t.Prefix + "/archive/" + month + f.URL
+	}
+	page, err := renderPageWith(t, ds, files)
+	if err != nil {
+		return e, fmt.Errorf("page template: %v", err)
+	}
+	meta, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return e, err
+	}
+	// Write it all next to the month, then swap it in.
+	dir := filepath.Join(t.ArchiveDir, month)
+	tmp := dir + ".tmp"
+	_ = os.RemoveAll(tmp)
+	if err := os.MkdirAll(filepath.Join(tmp, "data"), 0755); err != nil {
+		return e, err
+	}
+	for _, f := range ds.DATA_FILES {
+		if err := os.WriteFile(filepath.Join(tmp, "data", f.Name+"."+f.Hash+".json.gz"), f.gz, 0644); err != nil {
+			return e, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "index.html"), page, 0644); err != nil {
+		return e, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, archiveMeta), meta, 0644); err != nil {
+		return e, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return e, err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return e, err
+	}
+	log.Printf("🗄️ Build of %s (%s) archived for %s by %s", t.ID, ds.BuiltAt.Format("02 Jan 2006 15:04"), month, by)
+	mailArchive(t, e)
+	return e, nil
+}
+
+func archiveRecipients() []string {
+	var out []string
+	for _, a := range strings.Split(*archiveTo, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// mailArchive sends e's permalink and headline numbers to -archive-to.
+func mailArchive(t *Tenant, e ArchiveEntry) {
+	to := archiveRecipients()
+	if len(to) == 0 {
+		return
+	}
+	m, _ := time.Parse("2006-01", e.Month)
+	k := e.Headline
+	subject := fmt.Sprintf("%s – archive for %s", t.PageTitle(), m.Format("January 2006"))
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div style="font-family:Arial,sans-serif;font-size:14px"><h2>%s</h2>`, html.EscapeString(subject))
+	fmt.Fprintf(&b, `<p>The dashboard as approved for %s is archived at <a href="%s">%s</a>. The link needs a dashboard login and stays valid.</p>`,
+		m.Format("January 2006"), html.EscapeString(e.Permalink), html.EscapeString(e.Permalink))
+	b.WriteString(`<table cellpadding="4" style="border-collapse:collapse">`)
+	for _, row := range [][2]string{
+		{"Schools", strconv.Itoa(k.Schools)},
+		{"Employees", strconv.Itoa(k.Employees)},
+		{"Teachers", fmt.Sprintf("%d of %d needed", k.Teachers, k.NeededTeachers)},
+		{"Schools without a principal", strconv.Itoa(k.WithoutPrincipal)},
+		{"Enrolment", strconv.Itoa(k.Enrolment)},
+		{"Pupil-teacher ratio", fmt.Sprintf("%.1f", k.PTR)},
+		{"Aadhaar seeded", fmt.Sprintf("%.1f%%", k.AadhaarPct)},
+		{"DBT received", fmt.Sprintf("%.1f%%", k.DBTPct)},
+	} {
+		fmt.Fprintf(&b, `<tr><td>%s</td><td align="right">%s</td></tr>`, row[0], row[1])
+	}
+	b.WriteString(`</table>`)
+	fmt.Fprintf(&b, `<p style="color:#64748b">Data as of %s, approved by %s.</p></div>`,
+		e.BuiltAt.Format("02 Jan 2006 15:04"), html.EscapeString(e.By))
+	sent := 0
+	for _, a := range to {
+		if err := queueMail(t, "", t.senderFor(""), "", a, subject, b.String()); err != nil {
+			log.Printf("archive %s/%s to %s: %v", t.ID, e.Month, a, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("🗄️ Archive %s/%s mailed to %d/%d recipients", t.ID, e.Month, sent, len(to))
+}
+
+// listArchives reads t's archives, newest month first.
+func listArchives(t *Tenant) []ArchiveEntry {
+	out := []ArchiveEntry{}
+	if t.ArchiveDir == "" {
+		return out
+	}
+	dirs, _ := os.ReadDir(t.ArchiveDir)
+	for _, d := range dirs {
+		if !d.IsDir() || !rxArchiveMonth.MatchString(d.Name()) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(t.ArchiveDir, d.Name(), archiveMeta))
+		if err != nil {
+			continue
+		}
+		var e ArchiveEntry
+		if err := json.Unmarshal(b, &e); err != nil {
+			log.Printf("archive %s/%s: %v", t.ID, d.Name(), err)
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Month > out[j].Month })
+	return out
+}
+
+// GET/POST /api/archive
+func handleAPIArchive(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	switch r.Method {
+	case http.MethodGet:
+		list := listArchives(t)
+		writeData(w, list, &Meta{Count: len(list)})
+	case http.MethodPost:
+		if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		if t.ArchiveDir == "" {
+			writeError(w, 400, errBadRequest, "the archive is off: set -archive")
+			return
+		}
+		e, err := archiveBuild(t, dataFor(r), userFor(r).Name)
+		if err != nil {
+			log.Printf("archive %s: %v", t.ID, err)
+			writeError(w, 500, errInternal, "archive: "+err.Error())
+			return
+		}
+		writeData(w, e, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+// GET /archive/
+func handleArchiveIndex(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, e := tenantFor(r), html.EscapeString
+	list := listArchives(t)
+	var b strings.Builder
+	if len(list) == 0 {
+		b.WriteString(`<p>Nothing archived yet: a month is archived when its build is approved.</p>`)
+	} else {
+		b.WriteString(`<table><tr><th>Month</th><th>Data as of</th><th>Approved by</th><th>Schools</th><th>Employees</th><th>Teachers</th><th>PTR</th><th>Aadhaar %</th><th>DBT %</th></tr>`)
+		for _, a := range list {
+			k := a.Headline
+			fmt.Fprintf(&b, `<tr><td><a href="%s/archive/%s/">%s</a></td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%.1f</td><td>%.1f</td><td>%.1f</td></tr>`,
+				t.Prefix, a.Month, a.Month, a.BuiltAt.Format("02 Jan 2006 15:04"), e(a.By), k.Schools, k.Employees, k.Teachers, k.PTR, k.AadhaarPct, k.DBTPct)
+		}
+		b.WriteString(`</table>`)
+	}
+	adminPage(w, r, "Monthly archive", b.String())
+}
+
+// archiveMonthDir is month's archive of the request's tenant, or "" after
+// answering 404.
+func archiveMonthDir(w http.ResponseWriter, r *http.Request) string {
+	t, month := tenantFor(r), r.PathValue("month")
+	dir := filepath.Join(t.ArchiveDir, month)
+	if _, err := os.Stat(filepath.Join(dir, archiveMeta)); t.ArchiveDir == "" || !rxArchiveMonth.MatchString(month) || err != nil {
+		writeError(w, 404, errNotFound, "no archive for "+month)
+		return ""
+	}
+	return dir
+}
+
+// GET /archive/{month}/
+func handleArchivePage(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	dir := archiveMonthDir(w, r)
+	if dir == "" {
+		return
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Write(page)
+}
+
+// GET /archive/{month}/data/{file}
+func handleArchiveData(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	dir := archiveMonthDir(w, r)
+	if dir == "" {
+		return
+	}
+	name := r.PathValue("file")
+	gz, err := os.ReadFile(filepath.Join(dir, "data", filepath.Base(name)+".gz"))
+	if !rxArchiveFile.MatchString(name) || err != nil {
+		writeError(w, 404, errNotFound, "no such data file: "+name)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Encoding")
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(gz)))
+		_, _ = w.Write(gz)
+		return
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	_, _ = io.Copy(w, zr)
+}
@@ -0,0 +1,669 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Audit sampling ----
+//
+// Each month the leader draws a round of schools for physical verification:
+// the -audit-outliers most flagged schools (failing any school alert check,
+// see alerts.go, or with a pupil-teacher ratio more than two standard
+// deviations above the mean), then a random sample of -audit-sample more,
+// spread over the zones in proportion to their schools. The draw is seeded
+// by tenant and month, so drawing the same month again picks the same
+// schools while the data stands still. Rounds and their progress are kept
+// in -audits.
+//
+// Every school in a round has a printable checklist: the dashboard's
+// figures with blanks for what the auditor finds, and the staff roll.
+//
+//	GET  /api/audits[?month=YYYY-MM][&zone=][&status=]
+//	GET  /api/audits/summary[?month=]                  per zone: drawn, done, pending
+//	GET  /api/audits/checklist?month=[&school=]        PDF; the whole round without school
+//	POST /api/audits/draw     {"month": "2026-10"}     (re)draws a round not yet started
+//	POST /api/audits/update   {"month": "2026-10", "school": "...", "status": "done", "auditor": "...", "note": "..."}
+//
+// DDEs see and update their own zone's schools only.
+
+var (
+	auditsFile    = flag.String("audits", "./out/audits.json", "Monthly audit rounds and their progress")
+	auditSample   = flag.Int("audit-sample", 20, "Schools drawn at random each month for physical verification (0 = none)")
+	auditOutliers = flag.Int("audit-outliers", 10, "Flagged schools added to each month's audit round (0 = none)")
+)
+
+const (
+	auditPending    = "pending"
+	auditInProgress = "in_progress"
+	auditDone       = "done"
+	auditSkipped    = "skipped" // closed, merged, or could not be visited
+)
+
+var auditStatuses = []string{auditPending, auditInProgress, auditDone, auditSkipped}
+
+// auditRandom is the reason recorded for schools drawn by lot.
+const auditRandom = "random"
+
+type AuditItem struct {
+	School  string     `json:"school"`
+	Name    string     `json:"name"`
+	Zone    string     `json:"zone"`
+	Reasons []string   `json:"reasons"` // alert checks, ptr_outlier, or random
+	Status  string     `json:"status"`
+	Auditor string     `json:"auditor,omitempty"`
+	Note    string     `json:"note,omitempty"`
+	Updated *time.Time `json:"updated,omitempty"`
+	By      string     `json:"by,omitempty"`
+}
+
+type AuditRound struct {
+	Month   string      `json:"month"`
+	Drawn   time.Time   `json:"drawn"`
+	DataAt  time.Time   `json:"data_at"` // BuiltAt of the build drawn from
+	Sample  int         `json:"sample"`
+	Flagged int         `json:"flagged"`
+	Items   []AuditItem `json:"items"`
+}
+
+// started reports whether any school of the round has moved on from pending.
+func (a *AuditRound) started() bool {
+	for _, it := range a.Items {
+		if it.Status != auditPending {
+			return true
+		}
+	}
+	return false
+}
+
+type auditStore struct {
+	mu     sync.Mutex
+	path   string
+	rounds map[string]*AuditRound // by month
+}
+
+var (
+	auditStoresMu sync.Mutex
+	auditStores   = map[string]*auditStore{} // by tenant id
+)
+
+// audits returns the tenant's audit rounds, loading them on first use.
+func (t *Tenant) audits() *auditStore {
+	auditStoresMu.Lock()
+	defer auditStoresMu.Unlock()
+	if s, ok := auditStores[t.ID]; ok {
+		return s
+	}
+	s := &auditStore{path: t.Audits, rounds: map[string]*AuditRound{}}
+	if b, err := os.ReadFile(t.Audits); err == nil {
+		if err := json.Unmarshal(b, &s.rounds); err != nil {
+			log.Printf("audits %s: %v", t.Audits, err)
+		}
+	}
+	auditStores[t.ID] = s
+	return s
+}
+
+// save writes the rounds. Callers hold mu.
+func (s *auditStore) save() error {
+	if s.path == "" {
+		return fmt.Errorf("no audits file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.rounds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *auditStore) Get(month string) (AuditRound, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.rounds[month]; ok {
+		cp := *a
+		cp.Items = append([]AuditItem(nil), a.Items...)
+		return cp, true
+	}
+	return AuditRound{}, false
+}
+
+var errAuditStarted = fmt.Errorf("audit round already under way")
+
+// Draw stores a fresh round for month unless one exists; with redraw it
+// replaces one no school of which has been started.
+func (s *auditStore) Draw(month string, ds *Dataset, seed string, redraw bool) (AuditRound, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.rounds[month]; ok {
+		if !redraw {
+			return *a, false, nil
+		}
+		if a.started() {
+			return *a, false, errAuditStarted
+		}
+	}
+	a := drawAudit(ds, month, seed, *auditSample, *auditOutliers)
+	prev := s.rounds[month]
+	s.rounds[month] = &a
+	if err := s.save(); err != nil {
+		if prev != nil {
+			s.rounds[month] = prev
+		} else {
+			delete(s.rounds, month)
+		}
+		return AuditRound{}, false, err
+	}
+	return a, true, nil
+}
+
+var errNoAuditItem = fmt.Errorf("school not in the audit round")
+
+// Update sets the status (and auditor and note, where given) of school in
+// month's round.
+func (s *auditStore) Update(month, school, status, auditor, note, by string) (AuditItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.rounds[month]
+	if !ok {
+		return AuditItem{}, errNoAuditItem
+	}
+	for i := range a.Items {
+		it := &a.Items[i]
+		if it.School != school {
+			continue
+		}
+		prev := *it
+		now := time.Now()
+		if status != "" {
+			it.Status = status
+		}
+		if auditor != "" {
+			it.Auditor = auditor
+		}
+		if note != "" {
+			it.Note = note
+		}
+		it.Updated, it.By = &now, by
+		if err := s.save(); err != nil {
+			*it = prev
+			return prev, err
+		}
+		return *it, nil
+	}
+	return AuditItem{}, errNoAuditItem
+}
+
+// auditFlags are the reasons each school of ds stands out, if any.
+func auditFlags(ds *Dataset) map[string][]string {
+	rosters := rosterBySchool(ds.EMP)
+	var ratios []float64
+	for id, s := range ds.SCH {
+		if st := schoolStaff(s, rosters[id]); st.ActualTeachers > 0 {
+			ratios = append(ratios, st.Ratio)
+		}
+	}
+	var mean, sd float64
+	for _, r := range ratios {
+		mean += r
+	}
+	if len(ratios) > 0 {
+		mean /= float64(len(ratios))
+	}
+	for _, r := range ratios {
+		sd += (r - mean) * (r - mean)
+	}
+	if len(ratios) > 1 {
+		sd = math.Sqrt(sd / float64(len(ratios)-1))
+	}
+	out := map[string][]string{}
+	for id, s := range ds.SCH {
+		for _, c := range sortedKeys(alertCheckFuncs) {
+			if alertCheckFuncs[c](s, rosters[id]) != "" {
+				out[id] = append(out[id], c)
+			}
+		}
+		if st := schoolStaff(s, rosters[id]); st.ActualTeachers > 0 && sd > 0 && st.Ratio > mean+2*sd {
+			out[id] = append(out[id], "ptr_outlier")
+		}
+	}
+	return out
+}
+
+// auditSeed turns the tenant and month into the seed of the draw.
+func auditSeed(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// drawAudit picks up to outliers flagged schools (most reasons first, then
+// the largest teacher shortage) and a sample of the rest stratified by
+// zone: each zone gets its share of sample in proportion to its schools
+// (largest remainders), at least one while there are as many places as
+// zones.
+func drawAudit(ds *Dataset, month, seed string, sample, outliers int) AuditRound {
+	a := AuditRound{Month: month, Drawn: time.Now(), DataAt: ds.BuiltAt, Items: []AuditItem{}}
+	rosters := rosterBySchool(ds.EMP)
+	flags := auditFlags(ds)
+	chosen := map[string]bool{}
+	add := func(id string, reasons []string) {
+		s := ds.SCH[id]
+		chosen[id] = true
+		a.Items = append(a.Items, AuditItem{School: id, Name: s.Name, Zone: s.Zone, Reasons: reasons, Status: auditPending})
+	}
+
+	flagged := sortedKeys(flags)
+	sort.SliceStable(flagged, func(i, j int) bool {
+		fi, fj := flags[flagged[i]], flags[flagged[j]]
+		if len(fi) != len(fj) {
+			return len(fi) > len(fj)
+		}
+		vi := schoolStaff(ds.SCH[flagged[i]], rosters[flagged[i]]).SurplusVacancy
+		vj := schoolStaff(ds.SCH[flagged[j]], rosters[flagged[j]]).SurplusVacancy
+		return vi < vj
+	})
+	for _, id := range flagged {
+		if a.Flagged >= outliers {
+			break
+		}
+		add(id, flags[id])
+		a.Flagged++
+	}
+
+	byZone := map[string][]string{}
+	total := 0
+	for _, id := range sortedKeys(ds.SCH) {
+		if !chosen[id] {
+			z := ds.SCH[id].Zone
+			byZone[z] = append(byZone[z], id)
+			total++
+		}
+	}
+	if sample > total {
+		sample = total
+	}
+	if sample <= 0 {
+		return a
+	}
+	zones := sortedKeys(byZone)
+	quota := map[string]int{}
+	type rem struct {
+		zone string
+		frac float64
+	}
+	var rems []rem
+	left := sample
+	for _, z := range zones {
+		exact := float64(sample) * float64(len(byZone[z])) / float64(total)
+		quota[z] = int(exact)
+		if quota[z] == 0 && sample >= len(zones) {
+			quota[z] = 1
+		}
+		left -= quota[z]
+		rems = append(rems, rem{z, exact - math.Floor(exact)})
+	}
+	sort.SliceStable(rems, func(i, j int) bool { return rems[i].frac > rems[j].frac })
+	for i := 0; left > 0 && len(rems) > 0; i = (i + 1) % len(rems) {
+		if z := rems[i].zone; quota[z] < len(byZone[z]) {
+			quota[z]++
+			left--
+		}
+	}
+	for i := len(rems) - 1; left < 0 && i >= 0; i-- {
+		if z := rems[i].zone; quota[z] > 1 {
+			quota[z]--
+			left++
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(auditSeed(seed), auditSeed(month)))
+	for _, z := range zones {
+		ids := byZone[z]
+		rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+		for _, id := range ids[:min(quota[z], len(ids))] {
+			add(id, []string{auditRandom})
+			a.Sample++
+		}
+	}
+	sort.SliceStable(a.Items, func(i, j int) bool {
+		if a.Items[i].Zone != a.Items[j].Zone {
+			return a.Items[i].Zone < a.Items[j].Zone
+		}
+		return a.Items[i].School < a.Items[j].School
+	})
+	return a
+}
+
+// auditMonth is the month query parameter, this month by default.
+func auditMonth(w http.ResponseWriter, s string) (string, bool) {
+	if s == "" {
+		return time.Now().Format("2006-01"), true
+	}
+	if _, err := time.Parse("2006-01", s); err != nil {
+		writeError(w, 400, errBadRequest, "month must be YYYY-MM")
+		return "", false
+	}
+	return s, true
+}
+
+// auditZone is the zone a user may see: a DDE's own, else the zone asked
+// for ("" = all).
+func auditZone(r *http.Request) string {
+	if u := userFor(r); u.Role == roleZoneHead {
+		return strings.ToUpper(u.Zone)
+	}
+	zone := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	if zone == allZones {
+		return ""
+	}
+	return zone
+}
+
+// auditRound writes a 404 when month has no round.
+func auditRound(w http.ResponseWriter, t *Tenant, month string) (AuditRound, bool) {
+	a, ok := t.audits().Get(month)
+	if !ok {
+		writeError(w, 404, errNotFound, "no audit round for "+month)
+	}
+	return a, ok
+}
+
+// GET /api/audits
+func handleAudits(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	month, ok := auditMonth(w, q.Get("month"))
+	if !ok {
+		return
+	}
+	a, ok := auditRound(w, tenantFor(r), month)
+	if !ok {
+		return
+	}
+	zone, status := auditZone(r), q.Get("status")
+	out := []AuditItem{}
+	for _, it := range a.Items {
+		if (zone == "" || it.Zone == zone) && (status == "" || it.Status == status) {
+			out = append(out, it)
+		}
+	}
+	writeData(w, out, &Meta{Count: len(out), Total: len(a.Items)})
+}
+
+type AuditZoneRow struct {
+	Zone       string         `json:"zone"`
+	Drawn      int            `json:"drawn"`
+	Flagged    int            `json:"flagged"`
+	Statuses   map[string]int `json:"statuses"`
+	DonePct    float64        `json:"done_pct"`
+	Incomplete []string       `json:"incomplete"` // school ids still pending or in progress
+}
+
+// GET /api/audits/summary
+func handleAuditSummary(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	month, ok := auditMonth(w, r.URL.Query().Get("month"))
+	if !ok {
+		return
+	}
+	a, ok := auditRound(w, tenantFor(r), month)
+	if !ok {
+		return
+	}
+	zone := auditZone(r)
+	rows := map[string]*AuditZoneRow{}
+	for _, it := range a.Items {
+		if zone != "" && it.Zone != zone {
+			continue
+		}
+		for _, z := range []string{it.Zone, allZones} {
+			row := rows[z]
+			if row == nil {
+				row = &AuditZoneRow{Zone: z, Statuses: map[string]int{}, Incomplete: []string{}}
+				for _, s := range auditStatuses {
+					row.Statuses[s] = 0
+				}
+				rows[z] = row
+			}
+			row.Drawn++
+			row.Statuses[it.Status]++
+			if it.Reasons[0] != auditRandom {
+				row.Flagged++
+			}
+			if it.Status == auditPending || it.Status == auditInProgress {
+				row.Incomplete = append(row.Incomplete, it.School)
+			}
+		}
+	}
+	out := []AuditZoneRow{}
+	for _, z := range sortedKeys(rows) {
+		row := rows[z]
+		row.DonePct = pct1(row.Statuses[auditDone]+row.Statuses[auditSkipped], row.Drawn)
+		out = append(out, *row)
+	}
+	writeData(w, out, &Meta{Count: len(out)})
+}
+
+// auditChecklist adds one school's checklist to d.
+func auditChecklist(d *pdfDoc, ds *Dataset, month string, it AuditItem) {
+	s := ds.SCH[it.School]
+	roster := rosterBySchool(ds.EMP)[it.School]
+	st := schoolStaff(s, roster)
+	head := "none on the rolls"
+	if h, ok := ds.HEADS[it.School]; ok {
+		head = h.Name + " (" + h.Designation + ")"
+	}
+	d.Title("Audit checklist – " + month)
+	d.KV([2]string{"School", it.School}, [2]string{"Zone", it.Zone},
+		[2]string{"Name", s.Name}, [2]string{"Inspector", s.SIName},
+		[2]string{"Head", head}, [2]string{"Selected for", strings.Join(it.Reasons, ", ")})
+	d.Heading("Figures to verify")
+	widths := []float64{0.4, 0.2, 0.2, 0.2}
+	d.Row(true, widths, "Item", "Dashboard", "Found", "Matches (Y/N)")
+	blank := "________"
+	d.Row(false, widths, "Children enrolled", strconv.Itoa(s.TotalEnrolment), blank, blank)
+	d.Row(false, widths, "Children present (best day)", strconv.Itoa(s.MaxPresent), blank, blank)
+	d.Row(false, widths, "Teachers on the rolls", strconv.Itoa(st.ActualTeachers), blank, blank)
+	d.Row(false, widths, "Teachers needed (1:40)", strconv.Itoa(st.NeededTeachers), "", "")
+	d.Row(false, widths, "All staff", strconv.Itoa(st.TotalStaff), blank, blank)
+	d.Row(false, widths, "Principal in post", yesNo(st.HasPrincipal), blank, blank)
+	d.Row(false, widths, "DBT beneficiaries", strconv.Itoa(s.DBTTotal), blank, blank)
+	d.Row(false, widths, "Children with Aadhaar", strconv.Itoa(s.WithAadhaar), blank, blank)
+	if s.HasInfra {
+		d.Row(false, widths, "Classrooms in use", strconv.Itoa(s.Classrooms), blank, blank)
+	}
+	if s.HasMDM {
+		d.Row(false, widths, "Mid-day meals a day", strconv.Itoa(s.MDMDaily), blank, blank)
+	}
+	d.Heading(fmt.Sprintf("Staff roll (%d)", len(roster)))
+	widths = []float64{0.16, 0.34, 0.3, 0.2}
+	d.Row(true, widths, "Employee ID", "Name", "Designation", "Present (Y/N)")
+	sort.Slice(roster, func(i, j int) bool { return roster[i].ID < roster[j].ID })
+	for _, e := range roster {
+		d.Row(false, widths, e.ID, e.Name, e.Designation, blank)
+	}
+	d.Heading("Findings")
+	for i := 0; i < 4; i++ {
+		d.Text("______________________________________________________________________________________________")
+	}
+	d.Text("")
+	d.Text("Auditor: ______________________   Date: ____________   Head of school: ______________________")
+}
+
+// GET /api/audits/checklist?month=[&school=]
+func handleAuditChecklist(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	month, ok := auditMonth(w, q.Get("month"))
+	if !ok {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	a, ok := auditRound(w, t, month)
+	if !ok {
+		return
+	}
+	zone, school := auditZone(r), strings.TrimSpace(q.Get("school"))
+	var items []AuditItem
+	for _, it := range a.Items {
+		if (zone == "" || it.Zone == zone) && (school == "" || it.School == school) {
+			if _, known := ds.SCH[it.School]; known {
+				items = append(items, it)
+			}
+		}
+	}
+	if len(items) == 0 {
+		writeError(w, 404, errNotFound, "no such school in the "+month+" audit round")
+		return
+	}
+	d := newPDF("Audit checklist from " + t.PageTitle() + " data as of " + ds.BuiltAt.Format("02 Jan 2006") + ".")
+	for i, it := range items {
+		if i > 0 {
+			d.newPage()
+		}
+		auditChecklist(d, ds, month, it)
+	}
+	name := "audit_" + month
+	if school != "" {
+		name += "_" + school
+	}
+	pdf := d.Bytes()
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.pdf"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	_, _ = w.Write(pdf)
+}
+
+// POST /api/audits/draw
+func handleAuditDraw(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	var req struct {
+		Month string `json:"month"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		writeError(w, 400, errBadRequest, "body must be {\"month\": \"YYYY-MM\"}: "+err.Error())
+		return
+	}
+	month, ok := auditMonth(w, req.Month)
+	if !ok {
+		return
+	}
+	t := tenantFor(r)
+	a, _, err := t.audits().Draw(month, t.Data(), t.ID, true)
+	switch {
+	case err == errAuditStarted:
+		writeError(w, 409, errConflict, "the "+month+" audit round is under way and can't be redrawn")
+		return
+	case err != nil:
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("🔍 Audit round %s for %s drawn by %s: %d flagged, %d random", month, t.ID, userFor(r).Name, a.Flagged, a.Sample)
+	writeData(w, a, nil)
+}
+
+// POST /api/audits/update
+func handleAuditUpdate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	var req struct {
+		Month   string `json:"month"`
+		School  string `json:"school"`
+		Status  string `json:"status"`
+		Auditor string `json:"auditor"`
+		Note    string `json:"note"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, 400, errBadRequest, "body must be an audit update: "+err.Error())
+		return
+	}
+	month, ok := auditMonth(w, req.Month)
+	if !ok {
+		return
+	}
+	if req.Status != "" {
+		known := false
+		for _, s := range auditStatuses {
+			known = known || s == req.Status
+		}
+		if !known {
+			writeError(w, 400, errBadRequest, "status must be one of "+strings.Join(auditStatuses, ", "))
+			return
+		}
+	}
+	t, u := tenantFor(r), userFor(r)
+	school := strings.TrimSpace(req.School)
+	if s, ok := dataFor(r).SCH[school]; ok && u.Role == roleZoneHead && !strings.EqualFold(s.Zone, u.Zone) {
+		writeError(w, 403, errForbidden, "school "+school+" is not in zone "+u.Zone)
+		return
+	}
+	it, err := t.audits().Update(month, school, req.Status, strings.TrimSpace(req.Auditor), strings.TrimSpace(req.Note), u.Name)
+	switch {
+	case err == errNoAuditItem:
+		writeError(w, 404, errNotFound, "school "+req.School+" is not in the "+month+" audit round")
+		return
+	case err != nil:
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("🔍 Audit %s/%s for %s: %s by %s", month, it.School, t.ID, it.Status, u.Name)
+	writeData(w, it, nil)
+}
+
+// startAuditSampling draws each month's round on the leader once that
+// month's data is in.
+func startAuditSampling() {
+	if *auditSample <= 0 && *auditOutliers <= 0 {
+		return
+	}
+	log.Printf("🔍 Audit sampling: %d random and up to %d flagged school(s) a month", *auditSample, *auditOutliers)
+	go func() {
+		for ; ; time.Sleep(time.Hour) {
+			if !isLeader() {
+				continue
+			}
+			month := time.Now().Format("2006-01")
+			for _, t := range TENANTS {
+				ds := t.Data()
+				if ds == nil {
+					continue
+				}
+				a, drawn, err := t.audits().Draw(month, ds, t.ID, false)
+				if err != nil {
+					log.Printf("audit round %s for %s: %v", month, t.ID, err)
+				} else if drawn {
+					log.Printf("🔍 Audit round %s for %s: %d flagged, %d random", month, t.ID, a.Flagged, a.Sample)
+				}
+			}
+		}
+	}()
+}
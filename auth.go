@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ---- Login, sessions and OTP ----
+//
+// Tenants with users can be reached with HTTP Basic auth (scripts) or by
+// logging in at /login, which sets a session cookie. A user's "otp" setting
+// adds a one-time code mailed to their address:
+//
+//	"otp": "2fa"           password, then code
+//	"otp": "passwordless"  code only
+//
+// Users with OTP enabled cannot use Basic auth. The code is in the mail body
+// only, never the subject the email log keeps; in dry-run mode it shows up in
+// the process log instead ("🔑 Login code for mcd/admin: 123456").
+
+var (
+	sessionTTL = flag.Duration("session-ttl", 12*time.Hour, "Login session lifetime")
+	otpTTL     = flag.Duration("otp-ttl", 10*time.Minute, "Login code lifetime")
+)
+
+const (
+	sessionCookie = "mcd_session"
+
+	otpSecondFactor = "2fa"
+	otpPasswordless = "passwordless"
+
+	otpMaxTries   = 5
+	otpResendWait = 30 * time.Second
+)
+
+type Session struct {
+	Token     string    `json:"-"`
+	ID        string    `json:"id"` // public handle for revoking; the token never leaves the cookie
+	Tenant    string    `json:"tenant"`
+	User      string    `json:"user"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	LastPath  string    `json:"last_path"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"last_seen"`
+	Expires   time.Time `json:"expires"`
+}
+
+type pendingOTP struct {
+	hash  string
+	sent  time.Time
+	tries int
+}
+
+var (
+	sessMu   sync.Mutex
+	sessions = map[string]*Session{}
+
+	otpMu sync.Mutex
+	otps  = map[string]*pendingOTP{} // "<tenant>/<user>"
+)
+
+func newToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashCode(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Tenant) user(name string) *TenantUser {
+	for i := range t.Users {
+		if t.Users[i].Name == name {
+			return &t.Users[i]
+		}
+	}
+	return nil
+}
+
+func cookiePath(t *Tenant) string { return t.Prefix + "/" }
+
+func startSession(w http.ResponseWriter, r *http.Request, t *Tenant, u *TenantUser) {
+	now := time.Now()
+	s := &Session{
+		Token: newToken(), ID: newToken()[:16], Tenant: t.ID, User: u.Name,
+		IP: clientIP(r), UserAgent: r.UserAgent(),
+		Created: now, LastSeen: now, Expires: now.Add(*sessionTTL),
+	}
+	sessMu.Lock()
+	sessions[s.Token] = s
+	sessMu.Unlock()
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: s.Token, Path: cookiePath(t), Expires: s.Expires,
+		HttpOnly: true, Secure: r.TLS != nil, SameSite: http.SameSiteLaxMode,
+	})
+	log.Printf("🔑 %s/%s logged in", t.ID, u.Name)
+}
+
+// sessionUser returns the logged-in user for r's session cookie, if any.
+func sessionUser(r *http.Request, t *Tenant) *TenantUser {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	sessMu.Lock()
+	defer sessMu.Unlock()
+	s, ok := sessions[c.Value]
+	if !ok || s.Tenant != t.ID {
+		return nil
+	}
+	if time.Now().After(s.Expires) {
+		delete(sessions, c.Value)
+		return nil
+	}
+	s.LastSeen, s.IP, s.LastPath = time.Now(), clientIP(r), r.URL.Path
+	return t.user(s.User)
+}
+
+// requestUser authenticates r by session cookie, then Basic auth.
+func (t *Tenant) requestUser(r *http.Request) *TenantUser {
+	if u := sessionUser(r, t); u != nil {
+		return u
+	}
+	if name, pass, ok := r.BasicAuth(); ok {
+		if u := t.authenticate(name, pass); u != nil && u.OTP == "" {
+			return u
+		}
+	}
+	return nil
+}
+
+// challenge sends browsers to the login page and everyone else a 401.
+func challenge(w http.ResponseWriter, r *http.Request, t *Tenant) {
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		next := t.Prefix + r.URL.RequestURI()
+		http.Redirect(w, r, t.Prefix+"/login?next="+url.QueryEscape(next), http.StatusFound)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+t.Title+`"`)
+	writeError(w, http.StatusUnauthorized, errUnauthorized, "login required")
+}
+
+func otpKey(t *Tenant, u *TenantUser) string { return t.ID + "/" + u.Name }
+
+func sendOTP(t *Tenant, u *TenantUser) error {
+	key := otpKey(t, u)
+	otpMu.Lock()
+	if p, ok := otps[key]; ok && time.Since(p.sent) < otpResendWait {
+		otpMu.Unlock()
+		return nil // a fresh code is already on its way
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		otpMu.Unlock()
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	otps[key] = &pendingOTP{hash: hashCode(key + ":" + code), sent: time.Now()}
+	otpMu.Unlock()
+
+	body := fmt.Sprintf(`<p>Your login code for %s is <b style="font-size:20px">%s</b>.</p>
+<p>It expires in %v. If you did not try to log in, tell the IT cell.</p>`, html.EscapeString(t.Title), code, *otpTTL)
+	// Sent straight away, not queued: a code retried after it expires is no use.
+	s, subject := hqSender(), "Dashboard login code"
+	if !LiveMode {
+		log.Printf("🔑 Login code for %s: %s", key, code)
+	}
+	err = sendEmailAs(s, "", u.Email, subject, body)
+	logSend(t.ID, LiveMode, s, u.Email, subject, err)
+	return err
+}
+
+func checkOTP(t *Tenant, u *TenantUser, code string) bool {
+	key := otpKey(t, u)
+	otpMu.Lock()
+	defer otpMu.Unlock()
+	p, ok := otps[key]
+	if !ok || time.Since(p.sent) > *otpTTL {
+		delete(otps, key)
+		return false
+	}
+	p.tries++
+	if subtle.ConstantTimeCompare([]byte(p.hash), []byte(hashCode(key+":"+strings.TrimSpace(code)))) == 1 {
+		delete(otps, key)
+		return true
+	}
+	if p.tries >= otpMaxTries {
+		delete(otps, key)
+	}
+	return false
+}
+
+// safeNext keeps post-login redirects inside the tenant.
+func safeNext(t *Tenant, next string) string {
+	if !strings.HasPrefix(next, t.Prefix+"/") || strings.HasPrefix(next, "//") {
+		return t.Prefix + "/"
+	}
+	return next
+}
+
+// GET/POST /login
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	next := safeNext(t, r.FormValue("next"))
+	if r.Method != http.MethodPost {
+		loginPage(w, t, next, "", "")
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("user"))
+	u := t.user(name)
+	if u == nil || (u.OTP != otpPasswordless && t.authenticate(name, r.FormValue("password")) == nil) {
+		loginPage(w, t, next, "", "Invalid user or password.")
+		return
+	}
+	if u.OTP == "" {
+		startSession(w, r, t, u)
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	if err := sendOTP(t, u); err != nil {
+		log.Printf("otp %s/%s: %v", t.ID, u.Name, err)
+		loginPage(w, t, next, "", "Could not send the login code; try again later.")
+		return
+	}
+	loginPage(w, t, next, u.Name, "")
+}
+
+// POST /login/verify
+func handleLoginVerify(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	t := tenantFor(r)
+	next := safeNext(t, r.FormValue("next"))
+	u := t.user(strings.TrimSpace(r.FormValue("user")))
+	if u == nil || u.OTP == "" || !checkOTP(t, u, r.FormValue("code")) {
+		name := ""
+		if u != nil {
+			name = u.Name
+		}
+		loginPage(w, t, next, name, "Wrong or expired code.")
+		return
+	}
+	startSession(w, r, t, u)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		sessMu.Lock()
+		delete(sessions, c.Value)
+		sessMu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: cookiePath(t), MaxAge: -1})
+	http.Redirect(w, r, t.Prefix+"/login", http.StatusSeeOther)
+}
+
+// loginPage renders the password form, or the code form when codeFor names
+// the user a code was sent to.
+func loginPage(w http.ResponseWriter, t *Tenant, next, codeFor, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	e := html.EscapeString
+	var form string
+	if codeFor != "" {
+		form = fmt.Sprintf(`<form method="post" action="%s/login/verify">
+<p>A login code was sent to the email on record for <b>%s</b>.</p>
+<input type="hidden" name="user" value="%s"><input type="hidden" name="next" value="%s">
+<input name="code" placeholder="6-digit code" inputmode="numeric" autocomplete="one-time-code" autofocus>
+<button>Verify</button></form>`, e(t.Prefix), e(codeFor), e(codeFor), e(next))
+	} else {
+		form = fmt.Sprintf(`<form method="post" action="%s/login">
+<input type="hidden" name="next" value="%s">
+<input name="user" placeholder="User" autofocus><br>
+<input name="password" type="password" placeholder="Password (blank for code login)"><br>
+<button>Log in</button></form>`, e(t.Prefix), e(next))
+	}
+	if msg != "" {
+		msg = `<p style="color:#f87171">` + e(msg) + `</p>`
+	}
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Login – %s</title>
+<style>input,button{margin:4px 0;padding:8px;border-radius:6px;border:1px solid #334155}</style></head>
+<body style="font-family:system-ui;background:#0d1b2a;color:#f1f5f9;max-width:360px;margin:60px auto">
+<h1>%s</h1>%s%s</body></html>`, e(t.Title), e(t.Title), msg, form)
+}
+
+// cmdHashPassword is the hash-password subcommand: it prints the bcrypt
+// password_hash, for a user in -tenants, of the first line on stdin.
+func cmdHashPassword([]string) error {
+	pass, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	pass = strings.TrimRight(pass, "\r\n")
+	if pass == "" {
+		if err != nil {
+			return fmt.Errorf("reading the password: %v", err)
+		}
+		return fmt.Errorf("empty password")
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(h))
+	return nil
+}
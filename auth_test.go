@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOTPLoggedWithoutCode(t *testing.T) {
+	ten := &Tenant{ID: "training", Title: "Training", EmailLog: filepath.Join(t.TempDir(), "email_log.jsonl")}
+	u := &TenantUser{Name: "alice", Email: "alice@mcd.example"}
+	defer func(live bool, tenants []*Tenant) { LiveMode, TENANTS = live, tenants }(LiveMode, TENANTS)
+	LiveMode, TENANTS = false, []*Tenant{ten}
+	defer func() {
+		otpMu.Lock()
+		delete(otps, otpKey(ten, u))
+		otpMu.Unlock()
+	}()
+
+	if err := sendOTP(ten, u); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(ten.EmailLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"subject":"Dashboard login code"`) || !strings.Contains(string(b), `"status":"`+mailDryRun+`"`) {
+		t.Errorf("email log doesn't record the login code mail:\n%s", b)
+	}
+}
+
+func TestAuthenticateBcrypt(t *testing.T) {
+	h, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ten := &Tenant{Users: []TenantUser{{Name: "alice", PasswordHash: string(h)}, {Name: "bob", OTP: otpPasswordless}}}
+	if u := ten.authenticate("alice", "s3cret"); u == nil || u.Name != "alice" {
+		t.Errorf("right password refused")
+	}
+	for _, tc := range [][2]string{{"alice", "S3cret"}, {"alice", ""}, {"bob", ""}, {"carol", "s3cret"}} {
+		if u := ten.authenticate(tc[0], tc[1]); u != nil {
+			t.Errorf("authenticate(%q, %q) let %s in", tc[0], tc[1], u.Name)
+		}
+	}
+}
+
+func TestRefuseSHA256Passwords(t *testing.T) {
+	old := `{"tenants": [{"id": "north", "users": [{"name": "admin", "password_sha256": "8c6976e5b5410415bde908bd4dee15dfb167a9c873fc4bb8a81f6f2ab448a918"}]}]}`
+	if err := refuseSHA256Passwords([]byte(old)); err == nil || !strings.Contains(err.Error(), "north user admin") {
+		t.Errorf("password_sha256 accepted: %v", err)
+	}
+	if err := refuseSHA256Passwords([]byte(`{"tenants": [{"id": "north", "users": [{"name": "admin", "password_hash": "$2a$10$x"}]}]}`)); err != nil {
+		t.Error(err)
+	}
+}
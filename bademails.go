@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Bad email addresses ----
+//
+// Employees_Email_ID is checked when the data loads (ingest.CheckEmail), and
+// every address the mail server refuses at RCPT (550/551/553/501) or that
+// bounces back through the inbound hook (inbound.go) is recorded in a JSON
+// file per tenant (-bad-emails), with how often and the last error. The
+// list joins both per employee, by zone and school, so schools can collect
+// corrected addresses:
+//
+//	GET    /api/bad-emails[?reason=missing|syntax|rejected|bounced][&zone=][&format=csv][&page=][&per_page=]
+//	GET    /api/bad-emails/zones                    counts per zone
+//	DELETE /api/bad-emails?address=a@b.in           forget an address's failures
+//
+// A corrected address (an override, the next export) drops off the list on
+// its own, as the failures are kept against the old one. A DDE sees their
+// own zone only.
+
+var badEmailsFile = flag.String("bad-emails", "./out/bad-emails.json", "Addresses the mail server rejected or that bounced (see /api/bad-emails)")
+
+// Reasons an employee's address is on the list.
+const (
+	badEmailMissing  = "missing"
+	badEmailSyntax   = "syntax"
+	badEmailRejected = "rejected" // refused by the SMTP server
+	badEmailBounced  = "bounced"  // reported by the inbound hook
+)
+
+// Undeliverable is the failure record of one address.
+type Undeliverable struct {
+	Address string    `json:"address"`
+	Reason  string    `json:"reason"` // rejected or bounced, the latest
+	Count   int       `json:"count"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Error   string    `json:"error,omitempty"`
+	EmpID   string    `json:"emp_id,omitempty"`
+}
+
+type badEmailStore struct {
+	mu    sync.Mutex
+	path  string
+	addrs map[string]*Undeliverable // by lower-cased address
+}
+
+var (
+	badEmailsMu     sync.Mutex
+	badEmailsStores = map[string]*badEmailStore{} // by tenant id
+)
+
+// badEmails returns the tenant's store, loading it on first use.
+func (t *Tenant) badEmails() *badEmailStore {
+	badEmailsMu.Lock()
+	defer badEmailsMu.Unlock()
+	if s, ok := badEmailsStores[t.ID]; ok {
+		return s
+	}
+	s := &badEmailStore{path: t.BadEmails, addrs: map[string]*Undeliverable{}}
+	if b, err := os.ReadFile(t.BadEmails); err == nil {
+		if err := json.Unmarshal(b, &s.addrs); err != nil {
+			log.Printf("bad emails %s: %v", t.BadEmails, err)
+		}
+	}
+	badEmailsStores[t.ID] = s
+	return s
+}
+
+// badEmailsFor is badEmails for the tenant with the given id, or nil.
+func badEmailsFor(id string) *badEmailStore {
+	for _, t := range TENANTS {
+		if t.ID == id {
+			return t.badEmails()
+		}
+	}
+	return nil
+}
+
+func (s *badEmailStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.addrs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// Record notes a failure to deliver to addr.
+func (s *badEmailStore) Record(addr, reason, detail, empID string) {
+	addr = addrOnly(addr)
+	if addr == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	u := s.addrs[addr]
+	if u == nil {
+		u = &Undeliverable{Address: addr, First: now}
+		s.addrs[addr] = u
+	}
+	u.Reason, u.Last, u.Error = reason, now, shorten(strings.TrimSpace(detail), 300)
+	u.Count++
+	if empID != "" {
+		u.EmpID = empID
+	}
+	if err := s.save(); err != nil {
+		log.Printf("bad emails: %v", err)
+	}
+	log.Printf("📭 %s %s (%d time(s)): %s", addr, reason, u.Count, u.Error)
+}
+
+// Forget drops addr's record; false if there was none.
+func (s *badEmailStore) Forget(addr string) (bool, error) {
+	addr = addrOnly(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.addrs[addr]; !ok {
+		return false, nil
+	}
+	delete(s.addrs, addr)
+	return true, s.save()
+}
+
+// All returns a copy of the records, by lower-cased address.
+func (s *badEmailStore) All() map[string]Undeliverable {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Undeliverable, len(s.addrs))
+	for k, u := range s.addrs {
+		out[k] = *u
+	}
+	return out
+}
+
+// addressRejected reports whether err is the mail server refusing the
+// recipient itself: no such mailbox (550), not local (551), a bad mailbox
+// name (553) or a syntax error in the address (501).
+func addressRejected(err error) bool {
+	var te *textproto.Error
+	if !errors.As(err, &te) {
+		return false
+	}
+	switch te.Code {
+	case 501, 550, 551, 553:
+		return true
+	}
+	return false
+}
+
+// BadEmail is an employee whose address can't be mailed.
+type BadEmail struct {
+	EmpID       string     `json:"emp_id"`
+	Name        string     `json:"name"`
+	Designation string     `json:"designation"`
+	Zone        string     `json:"zone"`
+	SchoolID    string     `json:"school_id"`
+	SchoolName  string     `json:"school_name"`
+	Email       string     `json:"email"`
+	Reason      string     `json:"reason"`
+	Failures    int        `json:"failures,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// badEmailList checks every employee's address against its syntax and the
+// recorded failures.
+func badEmailList(emp map[string]Emp, failed map[string]Undeliverable) []BadEmail {
+	var out []BadEmail
+	for _, id := range sortedKeys(emp) {
+		e := emp[id]
+		b := BadEmail{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Zone: e.Zone,
+			SchoolID: e.SchoolID, SchoolName: e.SchoolName, Email: e.Email}
+		addr, problem := ingest.CheckEmail(e.Email)
+		switch {
+		case problem == ingest.EmailBlank:
+			b.Reason = badEmailMissing
+		case problem != "":
+			b.Reason = badEmailSyntax
+		default:
+			u, ok := failed[strings.ToLower(addr)]
+			if !ok {
+				continue
+			}
+			last := u.Last
+			b.Reason, b.Failures, b.LastFailure, b.Error = u.Reason, u.Count, &last, u.Error
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// badEmailsScoped is the list for the request's zone (a DDE's own).
+func badEmailsScoped(r *http.Request) ([]BadEmail, string) {
+	zone := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	var list []BadEmail
+	for _, b := range badEmailList(dataFor(r).EMP, tenantFor(r).badEmails().All()) {
+		if zone == "" || b.Zone == zone {
+			list = append(list, b)
+		}
+	}
+	return list, zone
+}
+
+// GET/DELETE /api/bad-emails
+func handleBadEmails(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+			listBadEmails(w, r)
+		}
+	case http.MethodDelete:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		addr := strings.TrimSpace(r.URL.Query().Get("address"))
+		if addr == "" {
+			writeError(w, 400, errBadRequest, "address is required")
+			return
+		}
+		found, err := tenantFor(r).badEmails().Forget(addr)
+		switch {
+		case err != nil:
+			writeError(w, 500, errInternal, err.Error())
+		case !found:
+			writeError(w, 404, errNotFound, "no failures recorded for "+addr)
+		default:
+			writeData(w, map[string]string{"forgotten": addrOnly(addr)}, nil)
+		}
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or DELETE required")
+	}
+}
+
+func listBadEmails(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	reason := q.Get("reason")
+	switch reason {
+	case "", badEmailMissing, badEmailSyntax, badEmailRejected, badEmailBounced:
+	default:
+		writeError(w, 400, errBadRequest, "reason must be missing, syntax, rejected or bounced")
+		return
+	}
+	all, _ := badEmailsScoped(r)
+	list := []BadEmail{}
+	for _, b := range all {
+		if reason == "" || b.Reason == reason {
+			list = append(list, b)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Zone != list[j].Zone {
+			return list[i].Zone < list[j].Zone
+		}
+		return list[i].SchoolID < list[j].SchoolID
+	})
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, b := range list {
+			failures, last := "", ""
+			if b.LastFailure != nil {
+				failures, last = strconv.Itoa(b.Failures), b.LastFailure.Format("2006-01-02 15:04")
+			}
+			rows = append(rows, []string{b.EmpID, b.Name, b.Designation, b.Zone, b.SchoolID, b.SchoolName,
+				b.Email, b.Reason, failures, last, b.Error, ""})
+		}
+		writeCSV(w, r, "bad_emails.csv", []string{"Employee ID", "Name", "Designation", "Zone", "School ID", "School",
+			"Email", "Problem", "Failures", "Last Failure", "Error", "Corrected Email"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// BadEmailZone counts a zone's bad addresses by reason.
+type BadEmailZone struct {
+	Zone      string `json:"zone"`
+	Employees int    `json:"employees"`
+	Bad       int    `json:"bad"`
+	Missing   int    `json:"missing"`
+	Syntax    int    `json:"syntax"`
+	Rejected  int    `json:"rejected"`
+	Bounced   int    `json:"bounced"`
+}
+
+// GET /api/bad-emails/zones
+func handleBadEmailZones(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	list, zone := badEmailsScoped(r)
+	zones := map[string]*BadEmailZone{}
+	get := func(z string) *BadEmailZone {
+		if zones[z] == nil {
+			zones[z] = &BadEmailZone{Zone: z}
+		}
+		return zones[z]
+	}
+	for _, e := range dataFor(r).EMP {
+		if zone == "" || e.Zone == zone {
+			get(e.Zone).Employees++
+		}
+	}
+	for _, b := range list {
+		z := get(b.Zone)
+		z.Bad++
+		switch b.Reason {
+		case badEmailMissing:
+			z.Missing++
+		case badEmailSyntax:
+			z.Syntax++
+		case badEmailRejected:
+			z.Rejected++
+		case badEmailBounced:
+			z.Bounced++
+		}
+	}
+	out := make([]BadEmailZone, 0, len(zones))
+	for _, z := range sortedKeys(zones) {
+		out = append(out, *zones[z])
+	}
+	writeData(w, out, &Meta{Count: len(out)})
+}
+
+// countBadEmails counts the employees whose address doesn't read as one,
+// blank included.
+func countBadEmails(emp map[string]Emp) int {
+	n := 0
+	for _, e := range emp {
+		if !ingest.ValidEmail(e.Email) {
+			n++
+		}
+	}
+	return n
+}
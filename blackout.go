@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Campaign blackout ----
+//
+// Zones or schools can be kept out of every outgoing campaign for a while
+// (exams, disputes). The list is a JSON file per tenant managed through
+// /api/blackout; every send path checks it per recipient. Lifting one only
+// soft-deletes it (softdelete.go):
+//
+//	GET    /api/blackout[?deleted=1]
+//	POST   /api/blackout {"kind": "zone", "id": "NARELA", "reason": "exams", "until": "2026-11-30"}
+//	DELETE /api/blackout?kind=zone&id=NARELA
+//	POST   /api/blackout/restore?kind=zone&id=NARELA
+
+var blackoutFile = flag.String("blackout", "./out/blackout.json", "Zones/schools excluded from campaigns (managed via /api/blackout)")
+
+const (
+	blackoutZone   = "zone"
+	blackoutSchool = "school"
+)
+
+type BlackoutEntry struct {
+	Kind   string    `json:"kind"` // "zone" or "school"
+	ID     string    `json:"id"`   // zone name or school id
+	Reason string    `json:"reason,omitempty"`
+	Until  string    `json:"until,omitempty"` // YYYY-MM-DD inclusive; empty = until removed
+	By     string    `json:"by,omitempty"`
+	Added  time.Time `json:"added"`
+	Active bool      `json:"active"`
+
+	Deleted *Deletion `json:"deleted,omitempty"`
+}
+
+func (b BlackoutEntry) activeAt(now time.Time) bool {
+	if b.Deleted != nil {
+		return false
+	}
+	if b.Until == "" {
+		return true
+	}
+	until, err := time.ParseInLocation("2006-01-02", b.Until, now.Location())
+	return err == nil && now.Before(until.AddDate(0, 0, 1))
+}
+
+func blackoutKey(kind, id string) string {
+	if kind == blackoutSchool {
+		return kind + ":" + ingest.DigitsOnly(id)
+	}
+	return kind + ":" + strings.ToUpper(strings.TrimSpace(id))
+}
+
+type blackoutList struct {
+	mu      sync.Mutex
+	path    string
+	entries []BlackoutEntry
+}
+
+var (
+	blackoutMu    sync.Mutex
+	blackoutLists = map[string]*blackoutList{} // by tenant id
+)
+
+// blackout returns the tenant's list, loading it on first use.
+func (t *Tenant) blackout() *blackoutList {
+	blackoutMu.Lock()
+	defer blackoutMu.Unlock()
+	if l, ok := blackoutLists[t.ID]; ok {
+		return l
+	}
+	l := &blackoutList{path: t.Blackout}
+	if b, err := os.ReadFile(t.Blackout); err == nil {
+		if err := json.Unmarshal(b, &l.entries); err != nil {
+			log.Printf("blackout %s: %v", t.Blackout, err)
+		}
+	}
+	blackoutLists[t.ID] = l
+	return l
+}
+
+func (l *blackoutList) save() error {
+	if l.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(l.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(l.path+".tmp", l.path)
+}
+
+func (l *blackoutList) List() []BlackoutEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	out := make([]BlackoutEntry, len(l.entries))
+	for i, b := range l.entries {
+		b.Active = b.activeAt(now)
+		out[i] = b
+	}
+	return out
+}
+
+// Active returns the keys currently in force, for checking many recipients.
+func (l *blackoutList) Active() map[string]BlackoutEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	m := map[string]BlackoutEntry{}
+	for _, b := range l.entries {
+		if b.activeAt(now) {
+			m[blackoutKey(b.Kind, b.ID)] = b
+		}
+	}
+	return m
+}
+
+func (l *blackoutList) Put(b BlackoutEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := blackoutKey(b.Kind, b.ID)
+	for i := range l.entries {
+		if blackoutKey(l.entries[i].Kind, l.entries[i].ID) == key {
+			l.entries[i] = b
+			return l.save()
+		}
+	}
+	l.entries = append(l.entries, b)
+	return l.save()
+}
+
+// SetDeleted soft-deletes the entry for kind and id (del set) or restores it
+// (del nil); found is false when there is none in the other state.
+func (l *blackoutList) SetDeleted(kind, id string, del *Deletion) (b BlackoutEntry, found bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := blackoutKey(kind, id)
+	for i := range l.entries {
+		if e := &l.entries[i]; blackoutKey(e.Kind, e.ID) == key && (e.Deleted == nil) != (del == nil) {
+			prev := e.Deleted
+			e.Deleted = del
+			if err := l.save(); err != nil {
+				e.Deleted = prev
+				return *e, true, err
+			}
+			b = *e
+			b.Active = b.activeAt(time.Now())
+			return b, true, nil
+		}
+	}
+	return BlackoutEntry{}, false, nil
+}
+
+// campaignFilter is what send paths use: Skip reports whether e is blacked
+// out or has turned the channel off (prefs.go), and counts which.
+type campaignFilter struct {
+	active   map[string]BlackoutEntry
+	prefs    *prefStore
+	channel  string
+	Skipped  int
+	OptedOut int
+}
+
+func newCampaignFilter(t *Tenant, channel string) *campaignFilter {
+	return &campaignFilter{active: t.blackout().Active(), prefs: t.prefs(), channel: channel}
+}
+
+func (f *campaignFilter) Skip(e Emp) bool {
+	if len(f.active) > 0 {
+		_, z := f.active[blackoutKey(blackoutZone, e.Zone)]
+		_, s := f.active[blackoutKey(blackoutSchool, e.SchoolID)]
+		if z || s {
+			f.Skipped++
+			return true
+		}
+	}
+	if !f.prefs.Allows(e.ID, f.channel) {
+		f.OptedOut++
+		return true
+	}
+	return false
+}
+
+// GET/POST/DELETE /api/blackout
+func handleBlackout(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	l := t.blackout()
+	switch r.Method {
+	case http.MethodGet:
+		deleted := r.URL.Query().Get("deleted") == "1"
+		out := []BlackoutEntry{}
+		for _, b := range l.List() {
+			if (b.Deleted != nil) == deleted {
+				out = append(out, b)
+			}
+		}
+		writeData(w, out, nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		var b BlackoutEntry
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&b); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a blackout entry: "+err.Error())
+			return
+		}
+		b.Kind, b.ID = strings.ToLower(strings.TrimSpace(b.Kind)), strings.TrimSpace(b.ID)
+		if b.Kind != blackoutZone && b.Kind != blackoutSchool {
+			writeError(w, 400, errBadRequest, `kind must be "zone" or "school"`)
+			return
+		}
+		if b.ID == "" {
+			writeError(w, 400, errBadRequest, "missing id")
+			return
+		}
+		if b.Until != "" {
+			if _, err := time.Parse("2006-01-02", b.Until); err != nil {
+				writeError(w, 400, errBadRequest, "until must be YYYY-MM-DD")
+				return
+			}
+		}
+		if b.Kind == blackoutZone {
+			b.ID = strings.ToUpper(b.ID)
+		}
+		b.By, b.Added = userFor(r).Name, time.Now()
+		b.Active = b.activeAt(b.Added)
+		if err := l.Put(b); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("⛔ Blackout %s %s by %s until %q: %s", b.Kind, b.ID, b.By, b.Until, b.Reason)
+		writeData(w, b, nil)
+	case http.MethodDelete:
+		if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		kind, id := r.URL.Query().Get("kind"), r.URL.Query().Get("id")
+		b, ok, err := l.SetDeleted(kind, id, &Deletion{At: time.Now(), By: userFor(r).Name})
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		if !ok {
+			writeError(w, 404, errNotFound, "no blackout for "+kind+" "+id)
+			return
+		}
+		log.Printf("⛔ Blackout %s %s lifted by %s", kind, id, userFor(r).Name)
+		writeData(w, b, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// POST /api/blackout/restore?kind=&id=
+func handleBlackoutRestore(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	kind, id := r.URL.Query().Get("kind"), r.URL.Query().Get("id")
+	b, ok, err := tenantFor(r).blackout().SetDeleted(kind, id, nil)
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, 404, errNotFound, "no lifted blackout for "+kind+" "+id)
+		return
+	}
+	log.Printf("⛔ Blackout %s %s restored by %s", kind, id, userFor(r).Name)
+	writeData(w, b, nil)
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Charge arrangements ----
+//
+// Where a school has no principal in post, or its principal is away, an
+// order puts someone in charge ("looking after the charge of HoS"); an
+// inspector's circle can be looked after the same way. The orders are kept
+// per tenant in -charges and applied at every build, as of its day: the
+// holder becomes the school's head (escalation.go) in place of the one the
+// roster suggests, the school's staffing shows them in charge, and mail
+// for the inspector goes to whoever holds the circle. Adding, ending or
+// importing charges rebuilds the tenant, and so does midnight on a day a
+// charge comes into force or lapses:
+//
+//	GET    /api/charges[?zone=][&school=][&active=1]
+//	POST   /api/charges {"post": "hos", "school_id": "1958006", "emp_id": "95066613", "from": "2026-07-01", "until": "", "order": "DDE/C/114"}
+//	POST   /api/charges {"post": "si", "si_name": "MAHIPAL", "emp_id": "95030972", "from": "2026-08-01"}
+//	POST   /api/charges/import[?dry_run=1]   (CSV body or multipart "file")
+//	DELETE /api/charges?id=C0007
+//
+// The CSV has a header row and the columns Employee ID, Post (hos or si,
+// default hos), School ID (or the inspector's name for si), From, Until and
+// Order; dates are YYYY-MM-DD or as the exports write them (02/01/2006,
+// 02-Jan-2006). Until is inclusive and may be blank.
+
+var chargesFile = flag.String("charges", "./out/charges.json", "Charge arrangements (teachers in charge of a school, officers of an SI circle); see /api/charges")
+
+const (
+	chargeHoS = "hos"
+	chargeSI  = "si"
+)
+
+type Charge struct {
+	ID       string    `json:"id"`
+	Post     string    `json:"post"`                // hos or si
+	SchoolID string    `json:"school_id,omitempty"` // hos
+	SIName   string    `json:"si_name,omitempty"`   // si: the inspector whose circle it is
+	EmpID    string    `json:"emp_id"`
+	Name     string    `json:"name,omitempty"` // the holder's, when added
+	From     string    `json:"from"`           // YYYY-MM-DD
+	Until    string    `json:"until,omitempty"`
+	Order    string    `json:"order,omitempty"`
+	By       string    `json:"by,omitempty"`
+	Added    time.Time `json:"added"`
+	Active   bool      `json:"active"` // as listed, today
+}
+
+type chargeBook struct {
+	Next    int      `json:"next"`
+	Charges []Charge `json:"charges"`
+}
+
+// chargesMu serialises read-modify-write of charge files.
+var chargesMu sync.Mutex
+
+func loadCharges(path string) chargeBook {
+	var b chargeBook
+	if path == "" {
+		return b
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("charges %s: %v", path, err)
+		}
+		return b
+	}
+	if err := json.Unmarshal(raw, &b); err != nil {
+		log.Printf("charges %s: %v", path, err)
+	}
+	return b
+}
+
+func saveCharges(path string, b chargeBook) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// activeOn reports whether c is in force on day (YYYY-MM-DD).
+func (c Charge) activeOn(day string) bool {
+	return c.From <= day && (c.Until == "" || day <= c.Until)
+}
+
+// postKey is what a charge is of; two charges of one post mustn't overlap.
+func (c Charge) postKey() string {
+	if c.Post == chargeSI {
+		return chargeSI + ":" + strings.ToUpper(c.SIName)
+	}
+	return chargeHoS + ":" + c.SchoolID
+}
+
+// chargeDate reads YYYY-MM-DD or the exports' day-first dates.
+func chargeDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	if d, err := time.Parse("2006-01-02", s); err == nil {
+		return d.Format("2006-01-02"), nil
+	}
+	d, err := ingest.ParseDMYFlexible(s)
+	if err != nil {
+		return "", fmt.Errorf("date %q: want YYYY-MM-DD or DD/MM/YYYY", s)
+	}
+	return d.Format("2006-01-02"), nil
+}
+
+// checkCharge normalises c and checks it against ds and the charges
+// already in the book.
+func checkCharge(ds *Dataset, book []Charge, c *Charge) error {
+	c.Post = strings.ToLower(strings.TrimSpace(c.Post))
+	if c.Post == "" {
+		c.Post = chargeHoS
+	}
+	c.EmpID = ingest.NormalizeEmpID(c.EmpID)
+	e, ok := ds.EMP[c.EmpID]
+	if !ok {
+		return fmt.Errorf("no employee %q", c.EmpID)
+	}
+	c.Name = e.Name
+	switch c.Post {
+	case chargeHoS:
+		c.SchoolID, c.SIName = ingest.DigitsOnlyKey(c.SchoolID), ""
+		if _, ok := ds.SCH[c.SchoolID]; !ok {
+			return fmt.Errorf("no school %q", c.SchoolID)
+		}
+	case chargeSI:
+		c.SIName, c.SchoolID = strings.ToUpper(strings.TrimSpace(c.SIName)), ""
+		known := false
+		for _, s := range ds.SCH {
+			if strings.EqualFold(strings.TrimSpace(s.SIName), c.SIName) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("no inspector %q in the DBT summary", c.SIName)
+		}
+	default:
+		return fmt.Errorf("post must be hos or si")
+	}
+	var err error
+	if c.From, err = chargeDate(c.From); err != nil {
+		return err
+	}
+	if c.Until, err = chargeDate(c.Until); err != nil {
+		return err
+	}
+	if c.From == "" {
+		return fmt.Errorf("from is required")
+	}
+	if c.Until != "" && c.Until < c.From {
+		return fmt.Errorf("until is before from")
+	}
+	for _, o := range book {
+		if o.postKey() == c.postKey() && o.From <= orMax(c.Until) && c.From <= orMax(o.Until) {
+			return fmt.Errorf("overlaps charge %s (%s held by %s from %s)", o.ID, o.postKey(), o.EmpID, o.From)
+		}
+	}
+	return nil
+}
+
+// orMax is an open-ended until as the last day there is.
+func orMax(until string) string {
+	if until == "" {
+		return "9999-12-31"
+	}
+	return until
+}
+
+// addCharges checks cs and, unless dryRun, adds them to t's book. It
+// returns the charges as added and the rejected ones' errors by index.
+func addCharges(t *Tenant, ds *Dataset, cs []Charge, by string, dryRun bool) ([]Charge, map[int]string, error) {
+	if t.Charges == "" {
+		return nil, nil, errors.New("no charges file configured")
+	}
+	chargesMu.Lock()
+	defer chargesMu.Unlock()
+	book := loadCharges(t.Charges)
+	var added []Charge
+	rejected := map[int]string{}
+	for i, c := range cs {
+		if err := checkCharge(ds, book.Charges, &c); err != nil {
+			rejected[i] = err.Error()
+			continue
+		}
+		book.Next++
+		c.ID, c.By, c.Added = fmt.Sprintf("C%04d", book.Next), by, time.Now()
+		c.Active = c.activeOn(time.Now().Format("2006-01-02"))
+		book.Charges = append(book.Charges, c)
+		added = append(added, c)
+	}
+	if dryRun || len(added) == 0 {
+		return added, rejected, nil
+	}
+	return added, rejected, saveCharges(t.Charges, book)
+}
+
+// chargesChangeOn reports whether a charge in book comes into force or
+// lapses on day, so that a build of the day before is out of date.
+func chargesChangeOn(book chargeBook, day time.Time) bool {
+	today, yesterday := day.Format("2006-01-02"), day.AddDate(0, 0, -1).Format("2006-01-02")
+	for _, c := range book.Charges {
+		if c.From == today || c.Until == yesterday {
+			return true
+		}
+	}
+	return false
+}
+
+// startChargeSchedule rebuilds, just after each midnight, the tenants whose
+// charges in force change that day.
+func startChargeSchedule() {
+	go func() {
+		for {
+			now := time.Now()
+			next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 5, 0, now.Location())
+			time.Sleep(time.Until(next))
+			for _, t := range TENANTS {
+				if t.Charges == "" || !chargesChangeOn(loadCharges(t.Charges), next) {
+					continue
+				}
+				log.Printf("🪪 Charges of %s change today; rebuilding", t.ID)
+				t.Build()
+			}
+		}
+	}()
+}
+
+// applyCharges puts the charges in force on day into ds: a school's
+// holder becomes its head, and ds.SI_CHARGES says who holds each circle.
+func applyCharges(ds *Dataset, book chargeBook, day string) {
+	for id, s := range ds.SCH {
+		if s.HoSChargeID != "" {
+			s.HoSChargeID, s.HoSChargeName = "", ""
+			ds.SCH[id] = s
+		}
+	}
+	ds.SI_CHARGES = map[string]Charge{}
+	n := 0
+	for _, c := range book.Charges {
+		e, ok := ds.EMP[c.EmpID]
+		if !ok || !c.activeOn(day) {
+			continue
+		}
+		c.Active = true
+		switch c.Post {
+		case chargeHoS:
+			s, ok := ds.SCH[c.SchoolID]
+			if !ok {
+				continue
+			}
+			s.HoSChargeID, s.HoSChargeName = e.ID, e.Name
+			ds.SCH[c.SchoolID] = s
+			c := c
+			ds.HEADS[c.SchoolID] = SchoolHead{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Email: e.Email,
+				Mobile: e.Mobile, DOJ: e.DOJ, Acting: true, Charge: &c}
+		case chargeSI:
+			ds.SI_CHARGES[c.SIName] = c
+		}
+		n++
+	}
+	if n > 0 {
+		log.Printf("🪪 %d charge arrangement(s) in force", n)
+	}
+}
+
+// GET/POST/DELETE /api/charges
+func handleCharges(w http.ResponseWriter, r *http.Request) {
+	t, q := tenantFor(r), r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+			return
+		}
+		ds, today := dataFor(r), time.Now().Format("2006-01-02")
+		zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+		if u := userFor(r); u.Role == roleZoneHead {
+			zone = strings.ToUpper(u.Zone)
+		}
+		if zone == allZones {
+			zone = ""
+		}
+		school := ingest.DigitsOnlyKey(q.Get("school"))
+		chargesMu.Lock()
+		book := loadCharges(t.Charges)
+		chargesMu.Unlock()
+		out := []Charge{}
+		for _, c := range book.Charges {
+			c.Active = c.activeOn(today)
+			if (q.Get("active") == "1" && !c.Active) || (school != "" && c.SchoolID != school) {
+				continue
+			}
+			if zone != "" && chargeZone(ds, c) != zone {
+				continue
+			}
+			out = append(out, c)
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].From > out[j].From })
+		writeData(w, out, nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		var c Charge
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&c); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a charge: "+err.Error())
+			return
+		}
+		added, rejected, err := addCharges(t, dataFor(r), []Charge{c}, userFor(r).Name, false)
+		switch {
+		case err != nil:
+			writeError(w, 500, errInternal, err.Error())
+		case len(rejected) > 0:
+			writeError(w, 400, errBadRequest, rejected[0])
+		default:
+			log.Printf("🪪 Charge %s (%s) given to %s by %s", added[0].ID, added[0].postKey(), added[0].EmpID, userFor(r).Name)
+			t.Build()
+			writeData(w, added[0], nil)
+		}
+	case http.MethodDelete:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		id := strings.ToUpper(strings.TrimSpace(q.Get("id")))
+		chargesMu.Lock()
+		book := loadCharges(t.Charges)
+		found := -1
+		for i, c := range book.Charges {
+			if c.ID == id {
+				found = i
+			}
+		}
+		var err error
+		if found >= 0 {
+			book.Charges = append(book.Charges[:found], book.Charges[found+1:]...)
+			err = saveCharges(t.Charges, book)
+		}
+		chargesMu.Unlock()
+		switch {
+		case found < 0:
+			writeError(w, 404, errNotFound, "no charge "+id)
+		case err != nil:
+			writeError(w, 500, errInternal, err.Error())
+		default:
+			log.Printf("🪪 Charge %s removed by %s", id, userFor(r).Name)
+			t.Build()
+			writeData(w, map[string]string{"removed": id}, nil)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// chargeZone is the zone a charge is in: its school's, or its circle's.
+func chargeZone(ds *Dataset, c Charge) string {
+	if c.Post == chargeHoS {
+		return ds.SCH[c.SchoolID].Zone
+	}
+	for _, s := range ds.SCH {
+		if strings.EqualFold(strings.TrimSpace(s.SIName), c.SIName) {
+			return s.Zone
+		}
+	}
+	return ""
+}
+
+type ChargeImportIssue struct {
+	Line   int    `json:"line"`
+	EmpID  string `json:"emp_id"`
+	Reason string `json:"reason"`
+}
+
+type ChargeImportReport struct {
+	Rows     int                 `json:"rows"`
+	Added    []Charge            `json:"added"`
+	Rejected []ChargeImportIssue `json:"rejected"`
+	DryRun   bool                `json:"dry_run,omitempty"`
+}
+
+// parseChargeCSV reads charges from a CSV with a header row, returning
+// each with its line.
+func parseChargeCSV(r io.Reader) ([]Charge, []int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &ingest.Table{Header: header, Index: ingest.IdxMap(header)}
+	if !t.Has("Employee ID", "Emp ID") || !t.Has("From", "From Date") {
+		return nil, nil, errors.New("the header needs Employee ID and From columns")
+	}
+	var out []Charge
+	var lines []int
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		c := Charge{EmpID: t.Get(rec, "Employee ID", "Emp ID"), Post: t.Get(rec, "Post"),
+			From: t.Get(rec, "From", "From Date"), Until: t.Get(rec, "Until", "To", "Until Date"), Order: t.Get(rec, "Order", "Order No.")}
+		if strings.EqualFold(strings.TrimSpace(c.Post), chargeSI) {
+			c.SIName = t.Get(rec, "SI Name", "School ID", "School")
+		} else {
+			c.SchoolID = t.Get(rec, "School ID", "School Name & ID", "School")
+		}
+		out = append(out, c)
+		lines = append(lines, line)
+	}
+}
+
+// POST /api/charges/import
+func handleChargesImport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, 400, errBadRequest, "multipart upload needs a \"file\" part: "+err.Error())
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	cs, lines, err := parseChargeCSV(body)
+	if err != nil {
+		writeError(w, 400, errBadRequest, "csv: "+err.Error())
+		return
+	}
+	t, dryRun := tenantFor(r), r.URL.Query().Get("dry_run") == "1"
+	added, rejected, err := addCharges(t, dataFor(r), cs, userFor(r).Name+" (import)", dryRun)
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	rep := ChargeImportReport{Rows: len(cs), Added: added, Rejected: []ChargeImportIssue{}, DryRun: dryRun}
+	if rep.Added == nil {
+		rep.Added = []Charge{}
+	}
+	for i, c := range cs {
+		if reason, ok := rejected[i]; ok {
+			rep.Rejected = append(rep.Rejected, ChargeImportIssue{Line: lines[i], EmpID: c.EmpID, Reason: reason})
+		}
+	}
+	log.Printf("🪪 Charge import by %s: %d rows, %d added, %d rejected", userFor(r).Name, rep.Rows, len(added), len(rep.Rejected))
+	if len(added) > 0 && !dryRun {
+		t.Build()
+	}
+	writeData(w, rep, nil)
+}
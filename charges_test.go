@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChargesChangeOn(t *testing.T) {
+	book := chargeBook{Charges: []Charge{
+		{ID: "C0001", From: "2026-07-01", Until: "2026-07-31"},
+		{ID: "C0002", From: "2026-06-01"},
+	}}
+	for day, want := range map[string]bool{
+		"2026-07-01": true,  // C0001 comes into force
+		"2026-07-15": false, // nothing changes
+		"2026-07-31": false, // C0001 still in force
+		"2026-08-01": true,  // C0001 has lapsed
+	} {
+		d, _ := time.Parse("2006-01-02", day)
+		if got := chargesChangeOn(book, d); got != want {
+			t.Errorf("chargesChangeOn(%s) = %v, want %v", day, got, want)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ---- Circulars ----
+//
+// Ad-hoc circulars are one-off mails to the staff of chosen zones (and,
+// optionally, designations), written by an admin or a zone head: a user
+// with the "dde" role and a "zone". Staff of a zone other than the
+// author's own are only mailed once that zone's head has approved: each
+// such zone's DDE accounts are mailed the request (the zone office's
+// mailbox when none has an address) and decide on /admin/circulars. The
+// circular goes out as a mail job (mailqueue.go) when the last zone
+// approves; one rejection cancels it, and the author is told either way.
+//
+//	POST /api/circulars                    {"subject": "...", "body": "<p>{{SALUTATION}}, ...</p>", "zones": ["NARELA"], "designations": ["PRT"]}
+//	GET  /api/circulars
+//	POST /api/circulars/{id}/approve[?note=]
+//	POST /api/circulars/{id}/reject[?note=]
+//	GET  /admin/circulars
+//
+// The body takes the campaign placeholders {{SALUTATION}} {{NAME}}
+// {{SENDER}} and {{PREFS_LINK}}. Blackouts and opt-outs apply as they do
+// to greetings.
+
+var circularsFile = flag.String("circulars", "./out/circulars.json", "Ad-hoc circulars and their zone approvals")
+
+const roleZoneHead = "dde"
+
+const (
+	circularPending   = "pending"
+	circularSent      = "sent"
+	circularRejected  = "rejected"
+	approvalApproved  = "approved"
+	approvalRejected  = "rejected"
+	circularMaxBody   = 256 << 10
+	circularSendsKind = "circular"
+)
+
+type ZoneApproval struct {
+	Zone     string     `json:"zone"`
+	Decision string     `json:"decision,omitempty"` // "", approved or rejected
+	By       string     `json:"by,omitempty"`
+	At       *time.Time `json:"at,omitempty"`
+	Note     string     `json:"note,omitempty"`
+}
+
+type Circular struct {
+	ID           string         `json:"id"`
+	Subject      string         `json:"subject"`
+	Body         string         `json:"body"`
+	Zones        []string       `json:"zones"`
+	Designations []string       `json:"designations,omitempty"`
+	Author       string         `json:"author"`
+	AuthorZone   string         `json:"author_zone,omitempty"`
+	Created      time.Time      `json:"created"`
+	Approvals    []ZoneApproval `json:"approvals,omitempty"` // one per zone outside the author's
+	Status       string         `json:"status"`
+	Job          string         `json:"job,omitempty"` // mail job, once sent
+}
+
+// waitingOn lists the zones yet to decide.
+func (c *Circular) waitingOn() []string {
+	var out []string
+	for _, a := range c.Approvals {
+		if a.Decision == "" {
+			out = append(out, a.Zone)
+		}
+	}
+	return out
+}
+
+type circularStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*Circular
+}
+
+var (
+	circularStoresMu sync.Mutex
+	circularStores   = map[string]*circularStore{} // by tenant id
+)
+
+// circulars returns the tenant's circulars, loading them on first use.
+func (t *Tenant) circulars() *circularStore {
+	circularStoresMu.Lock()
+	defer circularStoresMu.Unlock()
+	if s, ok := circularStores[t.ID]; ok {
+		return s
+	}
+	s := &circularStore{path: t.Circulars, items: map[string]*Circular{}}
+	if b, err := os.ReadFile(t.Circulars); err == nil {
+		if err := json.Unmarshal(b, &s.items); err != nil {
+			log.Printf("circulars %s: %v", t.Circulars, err)
+		}
+	}
+	circularStores[t.ID] = s
+	return s
+}
+
+func (s *circularStore) save() error {
+	if s.path == "" {
+		return fmt.Errorf("no circulars file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.items, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *circularStore) Add(c Circular) (Circular, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := make([]byte, 5)
+	_, _ = rand.Read(b)
+	c.ID = hex.EncodeToString(b)
+	s.items[c.ID] = &c
+	if err := s.save(); err != nil {
+		delete(s.items, c.ID)
+		return c, err
+	}
+	return c, nil
+}
+
+// Decide records zone's decision on circular id and returns the circular
+// as it now stands.
+func (s *circularStore) Decide(id, zone, decision, by, note string) (Circular, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.items[id]
+	if !ok {
+		return Circular{}, errNoCircular
+	}
+	if c.Status != circularPending {
+		return *c, fmt.Errorf("circular %s is already %s", id, c.Status)
+	}
+	i := -1
+	for j, a := range c.Approvals {
+		if a.Zone == zone {
+			i = j
+		}
+	}
+	if i < 0 || c.Approvals[i].Decision != "" {
+		return *c, fmt.Errorf("circular %s isn't waiting on zone %s", id, zone)
+	}
+	prev := *c
+	prev.Approvals = append([]ZoneApproval(nil), c.Approvals...)
+	now := time.Now()
+	c.Approvals[i] = ZoneApproval{Zone: zone, Decision: decision, By: by, At: &now, Note: note}
+	switch {
+	case decision == approvalRejected:
+		c.Status = circularRejected
+	case len(c.waitingOn()) == 0:
+		c.Status = circularSent
+	}
+	if err := s.save(); err != nil {
+		*c = prev
+		return prev, err
+	}
+	return *c, nil
+}
+
+func (s *circularStore) setJob(id, job string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.items[id]; ok {
+		c.Job = job
+		if err := s.save(); err != nil {
+			log.Printf("circulars: %v", err)
+		}
+	}
+}
+
+// Visible lists what u may see, newest first: everything for admins, and
+// for a zone head the circulars they wrote or that reach their zone.
+func (s *circularStore) Visible(u *TenantUser) []Circular {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Circular{}
+	for _, c := range s.items {
+		if u.Role != roleZoneHead || c.Author == u.Name || containsFold(c.Zones, u.Zone) {
+			out = append(out, *c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+var errNoCircular = fmt.Errorf("no such circular")
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// zoneHeads are the tenant's DDE accounts for zone.
+func (t *Tenant) zoneHeads(zone string) []TenantUser {
+	var out []TenantUser
+	for _, u := range t.Users {
+		if u.Role == roleZoneHead && strings.EqualFold(u.Zone, zone) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// circularLink points at the approval page, or is "" without -public-url.
+func (t *Tenant) circularLink() string {
+	if *publicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/admin/circulars"
+}
+
+// requestApproval mails zone's heads that c is waiting on them.
+func requestApproval(t *Tenant, c Circular, zone string) {
+	esc := html.EscapeString
+	var to []string
+	for _, u := range t.zoneHeads(zone) {
+		if u.Email != "" {
+			to = append(to, u.Email)
+		}
+	}
+	if len(to) == 0 {
+		if box := t.zoneMailbox(zone); box != "" {
+			to = append(to, box)
+		}
+	}
+	body := fmt.Sprintf(`<p>%s has written a circular to staff of zone %s and needs your approval before it is sent.</p>
+<p><b>%s</b></p><div style="border-left:3px solid #ccc;padding-left:8px">%s</div>`,
+		esc(c.Author), esc(zone), esc(c.Subject), c.Body)
+	if link := t.circularLink(); link != "" {
+		body += `<p>Approve or reject it at <a href="` + esc(link) + `">` + esc(link) + `</a>.</p>`
+	}
+	for _, a := range to {
+		if err := queueMail(t, "", hqSender(), "", a, "Approval needed: circular \""+c.Subject+"\"", body); err != nil {
+			log.Printf("circular %s approval request to %s: %v", c.ID, a, err)
+		}
+	}
+}
+
+// tellAuthor mails the circular's author what became of it.
+func tellAuthor(t *Tenant, c Circular, what string) {
+	u := t.user(c.Author)
+	if u == nil || u.Email == "" {
+		return
+	}
+	body := fmt.Sprintf(`<p>Your circular <b>%s</b> %s.</p>`, html.EscapeString(c.Subject), what)
+	if err := queueMail(t, "", hqSender(), "", u.Email, "Circular \""+c.Subject+"\" "+c.Status, body); err != nil {
+		log.Printf("circular %s mail to author: %v", c.ID, err)
+	}
+}
+
+// sendCircular mails c to its audience under job.
+func sendCircular(t *Tenant, c Circular, job string) map[string]int {
+	skip := newCampaignFilter(t, channelEmail)
+	sent, failed := 0, 0
+	for _, e := range t.Data().EMP {
+		if e.Email == "" || !containsFold(c.Zones, e.Zone) {
+			continue
+		}
+		if len(c.Designations) > 0 && !containsFold(c.Designations, e.Designation) {
+			continue
+		}
+		if skip.Skip(e) {
+			continue
+		}
+		from := t.senderFor(e.Zone)
+		vars := map[string]string{"SALUTATION": salutation(e), "NAME": e.Name, "SENDER": from.Name, "PREFS_LINK": t.prefsLink(e.ID)}
+		if err := queueMailFor(t, job, e.ID, from, "", e.Email, c.Subject, renderTemplate(c.Body, vars)); err != nil {
+			failed++
+			continue
+		}
+		sent++
+	}
+	return map[string]int{"sent": sent, "failed": failed, "blacked_out": skip.Skipped, "opted_out": skip.OptedOut}
+}
+
+func startCircular(t *Tenant, c Circular) {
+	j := runMailJob(t, circularSendsKind, func(job string) map[string]int { return sendCircular(t, c, job) })
+	t.circulars().setJob(c.ID, j.ID)
+	log.Printf("📣 Circular %s %q sent to %s as mail job %s", c.ID, c.Subject, strings.Join(c.Zones, ", "), j.ID)
+}
+
+// GET/POST /api/circulars
+func handleCirculars(w http.ResponseWriter, r *http.Request) {
+	t, u := tenantFor(r), userFor(r)
+	switch r.Method {
+	case http.MethodGet:
+		if !requireRole(w, r, roleZoneHead, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		writeData(w, t.circulars().Visible(u), nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleZoneHead, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+			return
+		}
+		var c Circular
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, circularMaxBody)).Decode(&c); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a circular: "+err.Error())
+			return
+		}
+		c.Subject, c.Body = strings.TrimSpace(c.Subject), strings.TrimSpace(c.Body)
+		if c.Subject == "" || c.Body == "" || len(c.Zones) == 0 {
+			writeError(w, 400, errBadRequest, "subject, body and zones are required")
+			return
+		}
+		if strings.IndexFunc(c.Subject, unicode.IsControl) >= 0 {
+			writeError(w, 400, errBadRequest, "subject must be a single line without control characters")
+			return
+		}
+		known := map[string]bool{}
+		for _, z := range dataFor(r).SCORECARD {
+			known[strings.ToUpper(z.Zone)] = true
+		}
+		c.Author, c.AuthorZone, c.Approvals, c.Created = u.Name, strings.ToUpper(u.Zone), nil, time.Now()
+		for i, z := range c.Zones {
+			z = strings.ToUpper(strings.TrimSpace(z))
+			if !known[z] {
+				writeError(w, 400, errBadRequest, "unknown zone "+z)
+				return
+			}
+			c.Zones[i] = z
+			if z == c.AuthorZone {
+				continue
+			}
+			if len(t.zoneHeads(z)) == 0 {
+				writeError(w, 400, errBadRequest, "zone "+z+" has no zone head account to approve circulars")
+				return
+			}
+			c.Approvals = append(c.Approvals, ZoneApproval{Zone: z})
+		}
+		c.Status, c.Job = circularPending, ""
+		if len(c.Approvals) == 0 {
+			c.Status = circularSent
+		}
+		c, err := t.circulars().Add(c)
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("📣 Circular %s %q by %s for %s", c.ID, c.Subject, u.Name, strings.Join(c.Zones, ", "))
+		if c.Status == circularSent {
+			startCircular(t, c)
+		}
+		for _, z := range c.waitingOn() {
+			requestApproval(t, c, z)
+		}
+		writeData(w, c, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+// POST /api/circulars/{id}/{approve,reject}
+func handleCircularDecision(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleZoneHead) || !requireLeader(w) {
+		return
+	}
+	decision := map[string]string{"approve": approvalApproved, "reject": approvalRejected}[r.PathValue("decision")]
+	if decision == "" {
+		writeError(w, 404, errNotFound, "use approve or reject")
+		return
+	}
+	t, u := tenantFor(r), userFor(r)
+	c, err := t.circulars().Decide(r.PathValue("id"), strings.ToUpper(u.Zone), decision, u.Name, strings.TrimSpace(r.URL.Query().Get("note")))
+	switch {
+	case err == errNoCircular:
+		writeError(w, 404, errNotFound, err.Error())
+		return
+	case err != nil:
+		writeError(w, 409, errConflict, err.Error())
+		return
+	}
+	log.Printf("📣 Circular %s %s for zone %s by %s", c.ID, decision, u.Zone, u.Name)
+	switch c.Status {
+	case circularRejected:
+		tellAuthor(t, c, "was rejected by zone "+html.EscapeString(u.Zone)+" and will not be sent")
+	case circularSent:
+		startCircular(t, c)
+		tellAuthor(t, c, "was approved by every zone and is being sent")
+	}
+	writeData(w, c, nil)
+}
+
+// GET /admin/circulars
+func handleAdminCirculars(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleZoneHead, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, u := tenantFor(r), userFor(r)
+	e := html.EscapeString
+	var rows strings.Builder
+	list := t.circulars().Visible(u)
+	for _, c := range list {
+		decided := map[string]ZoneApproval{}
+		for _, a := range c.Approvals {
+			decided[a.Zone] = a
+		}
+		zones := make([]string, len(c.Zones))
+		for i, z := range c.Zones {
+			zones[i] = z
+			if a := decided[z]; a.Decision != "" {
+				zones[i] += " (" + a.Decision + " by " + a.By + ")"
+			}
+		}
+		action := ""
+		if u.Role == roleZoneHead && c.Status == circularPending && containsFold(c.waitingOn(), u.Zone) {
+			action = fmt.Sprintf(`<button onclick="decide('%s','approve')">Approve</button> <button onclick="decide('%s','reject')">Reject</button>`, e(c.ID), e(c.ID))
+		}
+		fmt.Fprintf(&rows, `<tr><td>%s</td><td><b>%s</b><details><summary>Text</summary>%s</details></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			c.Created.Format("02 Jan 15:04"), e(c.Subject), c.Body, e(c.Author), e(strings.Join(zones, ", ")),
+			e(strings.Join(c.Designations, ", ")), e(c.Status), action)
+	}
+	if len(list) == 0 {
+		rows.WriteString(`<tr><td colspan="7">No circulars</td></tr>`)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Circulars</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}table{border-collapse:collapse;width:100%%}
+td,th{border:1px solid #334155;padding:6px;text-align:left;font-size:13px;vertical-align:top}th{background:#1b263b}</style></head>
+<body><h1>Circulars</h1>
+<table><thead><tr><th>Written</th><th>Subject</th><th>By</th><th>Zones</th><th>Designations</th><th>Status</th><th></th></tr></thead>
+<tbody>%s</tbody></table>
+<script>
+function decide(id,d){
+  var note=d==='reject'?prompt('Reason (optional)'):'';
+  if(note===null)return;
+  fetch(%q+'/api/circulars/'+id+'/'+d+'?note='+encodeURIComponent(note),{method:'POST'}).then(function(r){return r.json();})
+    .then(function(j){ if(j.errors){alert(j.errors[0].detail);return;} location.reload(); });
+}
+</script></body></html>`, rows.String(), t.Prefix)
+}
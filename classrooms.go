@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Classrooms ----
+//
+// Classrooms needed = enrolment / -class-size (rounded up); the shortage is
+// what the infrastructure data says is missing. Room counts come from an
+// optional CSV (-infra, or "infra" in a tenant or profile) with a school
+// column ("School ID" or "School Name & ID") and "Classrooms"; "Usable
+// Classrooms" wins when present. Schools missing from it have no shortage
+// figure rather than a made-up one.
+//
+//	GET /api/classrooms[?zone=][&short=1][&format=csv]
+
+var (
+	infraCSV  = flag.String("infra", "", "Infrastructure CSV with classroom counts per school (optional)")
+	classSize = flag.Int("class-size", 40, "Students per classroom norm for the classroom requirement")
+)
+
+// readInfra returns classrooms by school id.
+func readInfra(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	rooms := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rooms, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sid := ingest.DigitsOnly(ingest.Get(rec, m, "School ID", "School Code"))
+		if sid == "" {
+			sid = ingest.DigitsOnlyKey(ingest.Get(rec, m, "School Name & ID", "School Name"))
+		}
+		n := ingest.Get(rec, m, "Usable Classrooms", "Usable Class Rooms")
+		if n == "" {
+			n = ingest.Get(rec, m, "Classrooms", "Class Rooms", "Total Classrooms", "No. of Classrooms")
+		}
+		if sid != "" && n != "" {
+			rooms[sid] = ingest.AtoiSafe(n)
+		}
+	}
+}
+
+// applyClassrooms sets the classroom fields of every school; rooms may be nil.
+func applyClassrooms(sch map[string]School, rooms map[string]int) (matched int) {
+	for id, s := range sch {
+		s.NeededClassrooms = 0
+		if *classSize > 0 && s.TotalEnrolment > 0 {
+			s.NeededClassrooms = int(math.Ceil(float64(s.TotalEnrolment) / float64(*classSize)))
+		}
+		if n, ok := rooms[id]; ok {
+			s.HasInfra, s.Classrooms = true, n
+			s.ClassroomShortage = max(0, s.NeededClassrooms-n)
+			matched++
+		}
+		sch[id] = s
+	}
+	return matched
+}
+
+// loadClassrooms reads the infra CSV (if any) and fills in the school fields.
+func loadClassrooms(sch map[string]School, path string) {
+	var rooms map[string]int
+	if path != "" {
+		var err error
+		if rooms, err = readInfra(path); err != nil {
+			log.Printf("infra %s: %v", path, err)
+		}
+	}
+	if n := applyClassrooms(sch, rooms); path != "" {
+		log.Printf("🏫 Classroom counts for %d of %d schools (%d rows in %s)", n, len(sch), len(rooms), path)
+	}
+}
+
+// shortSchools lists schools with a classroom shortage, worst first.
+func shortSchools(sch map[string]School, zone string) []School {
+	out := []School{}
+	for _, s := range sch {
+		if s.ClassroomShortage > 0 && (zone == "" || s.Zone == zone) {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ClassroomShortage != out[j].ClassroomShortage {
+			return out[i].ClassroomShortage > out[j].ClassroomShortage
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// GET /api/classrooms
+func handleAPIClassrooms(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	ds := dataFor(r)
+	var list []School
+	if q.Get("short") == "1" {
+		list = shortSchools(ds.SCH, zone)
+	} else {
+		list = []School{}
+		for _, s := range ds.SCH {
+			if s.HasInfra && (zone == "" || s.Zone == zone) {
+				list = append(list, s)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].ClassroomShortage != list[j].ClassroomShortage {
+				return list[i].ClassroomShortage > list[j].ClassroomShortage
+			}
+			return list[i].ID < list[j].ID
+		})
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, s := range list {
+			rows = append(rows, []string{s.ID, s.Name, s.Zone, strconv.Itoa(s.TotalEnrolment), strconv.Itoa(s.NeededClassrooms),
+				strconv.Itoa(s.Classrooms), strconv.Itoa(s.ClassroomShortage)})
+		}
+		writeCSV(w, r, "classrooms.csv", []string{"School ID", "School", "Zone", "Enrolment", "Classrooms Needed", "Classrooms", "Shortage"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// digestClassrooms is the weekly digest's classroom section: zone totals and
+// the worst schools.
+func digestClassrooms(t *Tenant, ds *Dataset, now time.Time) string {
+	k := ds.ZONE_KPI[allZones]
+	if k.SchoolsWithRooms == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<p>%d of %d schools with room data are short of classrooms: %d rooms missing against %d needed (class size %d).</p>`,
+		k.SchoolsShortRoom, k.SchoolsWithRooms, k.RoomShortage, k.NeededRooms, *classSize)
+	worst := shortSchools(ds.SCH, "")
+	if len(worst) > 10 {
+		worst = worst[:10]
+	}
+	if len(worst) > 0 {
+		b.WriteString("<ul>")
+		for _, s := range worst {
+			fmt.Fprintf(&b, "<li>%s (%s): %d of %d classrooms, %d students</li>", html.EscapeString(s.Name), html.EscapeString(s.Zone),
+				s.Classrooms, s.NeededClassrooms, s.TotalEnrolment)
+		}
+		b.WriteString("</ul>")
+	}
+	return b.String()
+}
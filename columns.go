@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"myproject/ingest"
+)
+
+// ---- Column aliases ----
+//
+// The loaders find columns by the headers the portal's exports have used so
+// far ("Employees_Email_ID", "School Name & ID", ...). When an export
+// renames one, -column-aliases names a YAML file mapping the header the
+// loaders ask for to its new names, so the next build reads it without a
+// new binary:
+//
+//	Employees_Email_ID: [Email Address, E-mail ID]
+//	School Name & ID: School Name/ID
+//	Date of Joining: DOJ (DD-MM-YYYY)
+//
+// The file adds to the "columns" of -config. It is read again before a
+// build when it has changed, and -watch rebuilds on a change as it does for
+// the inputs; a file that no longer reads keeps the aliases in use.
+
+var columnAliasFile = flag.String("column-aliases", "", "YAML file mapping header names to the names they appear under in the exports (see columns.go)")
+
+var (
+	configColumns map[string][]string // the "columns" of -config
+
+	columnAliasMu     sync.Mutex
+	columnAliasLoaded bool
+	columnAliasStamp  string // size and mtime of the file last read
+)
+
+// loadColumnAliases installs the aliases of -config and -column-aliases,
+// unless the file is unchanged since the last call.
+func loadColumnAliases() error {
+	columnAliasMu.Lock()
+	defer columnAliasMu.Unlock()
+	stamp := ""
+	if *columnAliasFile != "" {
+		st, err := os.Stat(*columnAliasFile)
+		if err != nil {
+			return err
+		}
+		stamp = fmt.Sprintf("%d:%d", st.Size(), st.ModTime().UnixNano())
+	}
+	if columnAliasLoaded && stamp == columnAliasStamp {
+		return nil
+	}
+	aliases := map[string][]string{}
+	for name, list := range configColumns {
+		aliases[name] = append(aliases[name], list...)
+	}
+	if *columnAliasFile != "" {
+		b, err := os.ReadFile(*columnAliasFile)
+		if err != nil {
+			return err
+		}
+		raw := map[string]any{}
+		if err := yaml.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("%s: %v", *columnAliasFile, err)
+		}
+		file, err := configAliases(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *columnAliasFile, err)
+		}
+		for name, list := range file {
+			aliases[name] = append(aliases[name], list...)
+		}
+		log.Printf("🔤 Column aliases: %d header(s) from %s", len(file), *columnAliasFile)
+	}
+	ingest.SetAliases(aliases)
+	columnAliasLoaded, columnAliasStamp = true, stamp
+	return nil
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Subcommands ----
+//
+// "mcd-dashboard <command> [flags] [args]" runs a one-off task instead of the
+// server. Commands see the same flags (MCD_* variables, -config) as the
+// server. Cron jobs use these rather than curling a running server:
+//
+//	mcd serve                            the server (also with no command)
+//	mcd build [tenant]                   build, store and tag without serving
+//	mcd send birthdays -dry-run [tenant] run a greeting campaign
+//	mcd validate [tenant]                check the inputs and exit 1 on errors
+//	mcd hash-password < pass.txt         print a password_hash for -tenants
+//
+// Mails are only really sent with -live (or live: true in -config). A
+// campaign skips employees it already reached today (sendledger.go) unless
+// -force is given.
+
+var dryRun = flag.Bool("dry-run", false, "With send: log the mails instead of sending them, even with -live")
+
+var subcommands = map[string]func(args []string) error{
+	"serve":             cmdServe,
+	"build":             cmdBuild,
+	"send":              cmdSend,
+	"validate":          cmdValidate,
+	"install-service":   cmdInstallService,
+	"uninstall-service": cmdUninstallService,
+	"import-emails":     cmdImportEmails,
+	"ogd-export":        cmdOGDExport,
+	"review-pack":       cmdReviewPack,
+	"insights":          cmdInsights,
+	"retirement-alerts": cmdRetirementAlerts,
+	"purge":             cmdPurge,
+	"import-transfers":  cmdImportTransfers,
+	"export-state":      cmdExportState,
+	"import-state":      cmdImportState,
+	"gen-sample":        cmdGenSample,
+	"hash-password":     cmdHashPassword,
+}
+
+// runSubcommand runs the command named by os.Args[1], if any, and reports
+// whether it did, in which case main returns.
+func runSubcommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	cmd, ok := subcommands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	args := os.Args[2:]
+	if err := flag.CommandLine.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if err := applyEnv(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := applyConfig(flag.CommandLine); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := loadColumnAliases(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	applySandbox()
+	if err := checkLive(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// subcommandTenant loads the tenants and picks the one named by args[0], or
+// the first when args is empty.
+func subcommandTenant(args []string) (*Tenant, error) {
+	tenants, err := loadTenants()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return tenants[0], nil
+	}
+	for _, t := range tenants {
+		if t.ID == args[0] {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no tenant %q", args[0])
+}
+
+// commandTenants loads the tenants, keeping only the one named by args[0]
+// when given.
+func commandTenants(args []string) ([]*Tenant, error) {
+	if len(args) > 0 {
+		t, err := subcommandTenant(args)
+		if err != nil {
+			return nil, err
+		}
+		return []*Tenant{t}, nil
+	}
+	return loadTenants()
+}
+
+func cmdBuild([]string) error {
+	applyChdir()
+	tenants, err := commandTenants(flag.Args())
+	if err != nil {
+		return err
+	}
+	if err := buildTenants(tenants); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		ds := t.Data()
+		fmt.Printf("%s: %d employees, %d schools, %d data files\n", t.ID, len(ds.EMP), len(ds.SCH), len(ds.DATA_FILES))
+	}
+	return nil
+}
+
+func cmdSend([]string) error {
+	args := flag.Args()
+	if len(args) < 1 || campaignSends[args[0]] == nil {
+		return fmt.Errorf("usage: send <%s> [-dry-run] [-force] [tenant-id]", strings.Join(campaignNames(), "|"))
+	}
+	send := campaignSends[args[0]]
+	// flags may follow the campaign name
+	if err := flag.CommandLine.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *dryRun {
+		LiveMode = false
+	}
+	applySandbox()
+	if err := checkLive(); err != nil {
+		return err
+	}
+	applyChdir()
+	tenants, err := commandTenants(flag.Args())
+	if err != nil {
+		return err
+	}
+	if err := buildTenants(tenants); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		mode := "dry run"
+		if t.live() {
+			mode = "live"
+		}
+		res := send(t, time.Now(), "")
+		keys := make([]string, 0, len(res))
+		for k := range res {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = fmt.Sprintf("%s=%d", k, res[k])
+		}
+		fmt.Printf("%s: %s (%s): %s\n", t.ID, args[0], mode, strings.Join(parts, " "))
+	}
+	return nil
+}
+
+func campaignNames() []string {
+	names := make([]string, 0, len(campaignSends))
+	for name := range campaignSends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cmdValidate reads every tenant's inputs the way a build would and reports
+// what a build would trip over or silently drop. Unreadable files and
+// missing key columns are errors; the rest are warnings. The data-quality
+// report (dataquality.go) follows, and a breached -dq-limits is an error.
+func cmdValidate([]string) error {
+	limits, err := parseDQLimits(*dqLimits)
+	if err != nil {
+		return fmt.Errorf("-dq-limits: %v", err)
+	}
+	applyChdir()
+	tenants, err := commandTenants(flag.Args())
+	if err != nil {
+		return err
+	}
+	failed, breached := 0, 0
+	for _, t := range tenants {
+		summary, errs, warns := validateInputs(t.inputs())
+		for _, e := range errs {
+			fmt.Printf("%s: ERROR %s\n", t.ID, e)
+		}
+		for _, w := range warns {
+			fmt.Printf("%s: warning: %s\n", t.ID, w)
+		}
+		failed += len(errs)
+		if len(errs) > 0 {
+			continue
+		}
+		fmt.Printf("%s: ok, %s, %d warning(s)\n", t.ID, summary, len(warns))
+		rep, err := inputsQuality(t.inputs(), dqSamplesDef, limits)
+		if err != nil {
+			fmt.Printf("%s: ERROR %s\n", t.ID, err)
+			failed++
+			continue
+		}
+		printDataQuality(t.ID, rep)
+		breached += rep.Breached
+	}
+	if failed > 0 || breached > 0 {
+		return fmt.Errorf("%d error(s), %d data-quality limit(s) breached", failed, breached)
+	}
+	return nil
+}
+
+func validateInputs(in Inputs) (summary string, errs, warns []string) {
+	basic, err := ingest.LoadBasic(in.Basic)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	services, err := ingest.LoadServices(in.Services)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	dbt, err := ingest.LoadDBT(in.DBT)
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		reps, err := schemaReports(in)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for _, rep := range reps {
+			bad, notes := schemaProblems(rep)
+			if *strictSchema {
+				errs = append(errs, bad...)
+			} else {
+				warns = append(warns, bad...)
+			}
+			warns = append(warns, notes...)
+		}
+	}
+	for _, p := range []string{in.Infra, in.MDM, in.Metrics} {
+		if _, err := os.Stat(p); p != "" && err != nil {
+			warns = append(warns, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return "", errs, warns
+	}
+
+	for _, t := range []*ingest.Table{basic, services, dbt} {
+		if t.Encoding != "" && t.Encoding != ingest.EncUTF8 {
+			warns = append(warns, fmt.Sprintf("%s: saved as %s, not UTF-8 (transcoded)", t.Path, t.Encoding))
+		}
+	}
+	seen := map[string]bool{}
+	blank := 0
+	for _, rec := range basic.Rows {
+		id := ingest.NormalizeEmpID(basic.Get(rec, "Employee ID", "Emp ID"))
+		if id == "" {
+			blank++
+		}
+		seen[id] = true
+	}
+	if blank > 0 {
+		warns = append(warns, fmt.Sprintf("%s: %d rows without an employee ID (skipped)", in.Basic, blank))
+	}
+	emp, dups, err := ingest.EmployeesWith(basic, services, *duplicatePolicy)
+	if err != nil {
+		return "", append(errs, err.Error()), warns
+	}
+	for _, f := range []string{in.Basic, in.Services} {
+		n := 0
+		for _, d := range dups {
+			if d.File == f {
+				n++
+			}
+		}
+		if n > 0 {
+			warns = append(warns, fmt.Sprintf("%s: %d repeated employee IDs (resolved by the %s policy)", f, n, *duplicatePolicy))
+		}
+	}
+	orphans := 0
+	for _, rec := range services.Rows {
+		if id := ingest.NormalizeEmpID(services.Get(rec, "Employee ID", "Emp ID")); id != "" && !seen[id] {
+			orphans++
+		}
+	}
+	if orphans > 0 {
+		warns = append(warns, fmt.Sprintf("%s: %d rows for employees not in %s", in.Services, orphans, in.Basic))
+	}
+
+	sch := ingest.Schools(dbt)
+	badDOB, noSchool := 0, 0
+	for _, e := range emp {
+		if _, err := ingest.ParseDMYFlexible(e.DOB); err != nil {
+			badDOB++
+		}
+		if _, ok := sch[e.SchoolID]; !ok {
+			noSchool++
+		}
+	}
+	if badDOB > 0 {
+		warns = append(warns, fmt.Sprintf("%d employees without a readable date of birth", badDOB))
+	}
+	if noSchool > 0 {
+		warns = append(warns, fmt.Sprintf("%d employees in schools missing from %s", noSchool, in.DBT))
+	}
+	if len(sch) == 0 {
+		errs = append(errs, in.DBT+": no schools")
+	}
+	return fmt.Sprintf("%d employees, %d schools", len(emp), len(sch)), errs, warns
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ---- Config file ----
+//
+// -config names a YAML (or, by extension, TOML) file holding flag values,
+// so a deployment is one file instead of a long command line. Keys are flag
+// names; a nested table joins its keys with "-", so smtp.host is -smtp-host.
+// Lists are joined with commas. "columns" maps a header the loaders look
+// for to the other names it may appear under in the portal's exports (see
+// also -column-aliases in columns.go):
+//
+//	basic: /data/Basic.xlsx
+//	services: /data/Services.xlsx
+//	dbt: /data/Dashboard_Summary_202509.csv
+//	data-dir: /srv/mcd/out
+//	listen: ":8443"
+//	live: true
+//	email:
+//	  from: hq.it.education@mcd.example
+//	  name: HQ Team IT Education
+//	smtp:
+//	  host: smtp.gmail.com
+//	  port: 465
+//	  tls: implicit
+//	  pass: app-password
+//	digest-to: [director@mcd.example, dd.it@mcd.example]
+//	columns:
+//	  Employee ID: [Emp Code, EMPLOYEE_ID]
+//
+// Precedence is command line, then MCD_* environment, then the config
+// file, then the built-in default.
+
+var configFile = flag.String("config", "", "YAML or TOML file of flag values (see config.go)")
+
+var (
+	smtpHost = flag.String("smtp-host", "smtp.gmail.com", "HQ SMTP server (see smtp.go for -smtp-tls and -smtp-auth)")
+	smtpPort = flag.Int("smtp-port", 465, "HQ SMTP port")
+	smtpUser = flag.String("smtp-user", "", "HQ SMTP login (default -email-from)")
+	smtpPass = flag.String("smtp-pass", "", "HQ SMTP password, needed to go live (prefer MCD_SMTP_PASS)")
+)
+
+func init() {
+	flag.StringVar(&EmailFrom, "email-from", EmailFrom, "HQ From address")
+	flag.StringVar(&EmailName, "email-name", EmailName, "HQ From display name")
+	flag.BoolVar(&LiveMode, "live", LiveMode, "Start with live mode on (mails are really sent)")
+}
+
+// applyConfig sets every flag not already set on the command line or from
+// the environment from -config, and keeps its column aliases for
+// loadColumnAliases.
+func applyConfig(fs *flag.FlagSet) error {
+	if *configFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(*configFile)
+	if err != nil {
+		return err
+	}
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(*configFile)) {
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	default:
+		return fmt.Errorf("%s: want a .yaml, .yml or .toml file", *configFile)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", *configFile, err)
+	}
+
+	if cols, ok := raw["columns"]; ok {
+		aliases, err := configAliases(cols)
+		if err != nil {
+			return fmt.Errorf("%s: columns: %v", *configFile, err)
+		}
+		configColumns = aliases
+		delete(raw, "columns")
+	}
+
+	values := map[string]string{}
+	flattenConfig("", raw, values)
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case fs.Lookup(name) == nil:
+			return fmt.Errorf("%s: unknown setting %q", *configFile, name)
+		case name == "config":
+			return fmt.Errorf("%s: config files don't nest", *configFile)
+		case set[name]:
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: %s=%q: %v", *configFile, name, values[name], err)
+		}
+	}
+	return nil
+}
+
+// flattenConfig turns nested tables into "a-b" flag names and scalars and
+// lists into flag values.
+func flattenConfig(prefix string, m map[string]any, out map[string]string) {
+	for k, v := range m {
+		name := k
+		if prefix != "" {
+			name = prefix + "-" + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flattenConfig(name, v, out)
+		case []any:
+			parts := make([]string, len(v))
+			for i, x := range v {
+				parts[i] = fmt.Sprint(x)
+			}
+			out[name] = strings.Join(parts, ",")
+		case nil:
+			out[name] = ""
+		default:
+			out[name] = fmt.Sprint(v)
+		}
+	}
+}
+
+func configAliases(v any) (map[string][]string, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("want a table of header: [aliases]")
+	}
+	out := map[string][]string{}
+	for header, list := range m {
+		switch l := list.(type) {
+		case string:
+			out[header] = []string{l}
+		case []any:
+			for _, a := range l {
+				out[header] = append(out[header], fmt.Sprint(a))
+			}
+		default:
+			return nil, fmt.Errorf("%s: want a list of header names", header)
+		}
+	}
+	return out, nil
+}
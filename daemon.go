@@ -0,0 +1,183 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Daemon mode ----
+//
+// For running unattended: -daemon detaches from the terminal, -pidfile
+// records the process, and -log-file sends the log to a file that rotates by
+// size and/or age. SIGUSR1 re-opens the log file so external logrotate
+// setups (copy/move + signal) work too.
+
+var (
+	daemonMode = flag.Bool("daemon", false, "Detach and run in the background (use with -log-file)")
+	pidFile    = flag.String("pidfile", "", "Write the process ID to this file (optional)")
+	logFile    = flag.String("log-file", "", "Log to this file instead of stderr (optional)")
+	logMaxMB   = flag.Int("log-max-mb", 50, "Rotate the log file once it reaches this size in MB (0 = never)")
+	logMaxAge  = flag.Duration("log-max-age", 24*time.Hour, "Rotate the log file after this long (0 = never)")
+	logKeep    = flag.Int("log-keep", 7, "Rotated log files to keep")
+)
+
+// rotatingLog is an io.Writer over a log file that rotates to
+// <path>.<timestamp> when it grows past maxBytes or gets older than maxAge.
+type rotatingLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	maxAge   time.Duration
+	keep     int
+
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+func openRotatingLog(path string, maxMB int, maxAge time.Duration, keep int) (*rotatingLog, error) {
+	l := &rotatingLog{path: path, maxBytes: int64(maxMB) << 20, maxAge: maxAge, keep: keep}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return l, l.open()
+}
+
+func (l *rotatingLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size, l.opened = f, st.Size(), time.Now()
+	if l.size > 0 {
+		l.opened = st.ModTime()
+	}
+	return nil
+}
+
+func (l *rotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && ((l.maxBytes > 0 && l.size+int64(len(p)) > l.maxBytes) ||
+		(l.maxAge > 0 && time.Since(l.opened) > l.maxAge)) {
+		if err := l.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotate: %v\n", err)
+		}
+	}
+	if l.f == nil {
+		return os.Stderr.Write(p)
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and re-opens the file at the same path, for use after an
+// external tool has moved it away.
+func (l *rotatingLog) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	return l.open()
+}
+
+func (l *rotatingLog) rotate() error {
+	if l.f != nil {
+		l.f.Close()
+		l.f = nil
+	}
+	rotated := l.path + "." + time.Now().Format("20060102-150405.000")
+	if err := os.Rename(l.path, rotated); err != nil {
+		return err
+	}
+	l.prune()
+	return l.open()
+}
+
+// prune removes rotated files beyond the newest l.keep.
+func (l *rotatingLog) prune() {
+	old, _ := filepath.Glob(l.path + ".*")
+	if len(old) <= l.keep {
+		return
+	}
+	sort.Strings(old) // timestamps sort chronologically
+	for _, p := range old[:len(old)-l.keep] {
+		_ = os.Remove(p)
+	}
+}
+
+// writePIDFile refuses to start over a PID file whose process is still alive.
+func writePIDFile(path string) error {
+	if b, err := os.ReadFile(path); err == nil {
+		if pid, _ := strconv.Atoi(strings.TrimSpace(string(b))); pid > 0 && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("already running as pid %d (%s)", pid, path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// setupDaemon applies -daemon, -log-file and -pidfile. In the parent of a
+// -daemon start it does not return.
+func setupDaemon() {
+	if *daemonMode {
+		if *logFile == "" {
+			log.Fatal("-daemon needs -log-file (stderr is detached)")
+		}
+		if err := daemonize(); err != nil {
+			log.Fatalf("daemonize: %v", err)
+		}
+	}
+	if *logFile != "" {
+		l, err := openRotatingLog(*logFile, *logMaxMB, *logMaxAge, *logKeep)
+		if err != nil {
+			log.Fatalf("log file: %v", err)
+		}
+		log.SetOutput(l)
+		watchLogReopen(l)
+	}
+	if *pidFile != "" {
+		if err := writePIDFile(*pidFile); err != nil {
+			log.Fatalf("pidfile: %v", err)
+		}
+	}
+}
+
+// removePIDFile is called once the server has stopped.
+func removePIDFile() {
+	if *pidFile != "" {
+		_ = os.Remove(*pidFile)
+	}
+}
+
+// childArgs is os.Args[1:] without -daemon, so the detached child runs in
+// the foreground of its own session.
+func childArgs() []string {
+	out := []string{}
+	for _, a := range os.Args[1:] {
+		switch strings.TrimLeft(a, "-") {
+		case "daemon", "daemon=true", "daemon=1":
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
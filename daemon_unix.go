@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// daemonize re-executes the binary in a new session with stdio detached and
+// exits the parent once the child has started.
+func daemonize() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	devnull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, childArgs()...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devnull, devnull, devnull
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	fmt.Printf("started in background, pid %d\n", cmd.Process.Pid)
+	os.Exit(0)
+	return nil
+}
+
+func watchLogReopen(l *rotatingLog) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	go func() {
+		for range sig {
+			if err := l.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "log reopen: %v\n", err)
+				continue
+			}
+			log.Println("📝 Log file re-opened")
+		}
+	}()
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Windows has no fork/setsid; run it as a service instead.
+func daemonize() error {
+	return errors.New("-daemon is not supported on Windows")
+}
+
+// There is no SIGUSR1 on Windows; size/age rotation still applies.
+func watchLogReopen(l *rotatingLog) {}
+
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid) // fails when no such process exists
+	return err == nil
+}
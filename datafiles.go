@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---- Data files ----
+//
+// Each build publishes its bulk data as gzip'd JSON under content-hashed
+// names (emp.<hash>.json). The HTML shell only carries the file names, so a
+// browser revisiting the dashboard re-downloads a file only when its data
+// actually changed; everything under /data/ is cached as immutable.
+
+var dataDir = flag.String("data-dir", "./out/data", "Directory for hashed gzip data files (empty = memory only)")
+
+type dataFile struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	URL  string `json:"url"`
+	Size int    `json:"size"`
+	Gzip int    `json:"gzip_size"`
+	gz   []byte
+}
+
+var dataFileSet = []string{"emp", "sch", "demo"}
+
+type demoBundle struct {
+	DemoZones    []ZoneDemo     `json:"demo_zones"`
+	CategoryWise map[string]int `json:"category_wise"`
+	GenderWise   map[string]int `json:"gender_wise"`
+	ZLBL         []string       `json:"zlbl"`
+	ZVAL         []string       `json:"zval"`
+	DLBL         []string       `json:"dlbl"`
+	DVAL         []string       `json:"dval"`
+}
+
+func newDataFile(name string, v any) (*dataFile, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])[:12]
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	_, _ = zw.Write(raw)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &dataFile{
+		Name: name, Hash: hash, URL: "/data/" + name + "." + hash + ".json",
+		Size: len(raw), Gzip: buf.Len(), gz: buf.Bytes(),
+	}, nil
+}
+
+// buildDataFiles fills ds.DATA_FILES (logical name -> file) and
+// ds.dataByPath ("emp.<hash>.json" -> file).
+func buildDataFiles(ds *Dataset) {
+	payload := map[string]any{
+		"emp": ds.EMP,
+		"sch": ds.SCH,
+		"demo": demoBundle{
+			DemoZones: ds.DEMO_ZONES, CategoryWise: ds.CATEGORY_WISE, GenderWise: ds.GENDER_WISE,
+			ZLBL: ds.ZLBL, ZVAL: ds.ZVAL, DLBL: ds.DLBL, DVAL: ds.DVAL,
+		},
+	}
+	files, byPath := map[string]*dataFile{}, map[string]*dataFile{}
+	for _, name := range dataFileSet {
+		f, err := newDataFile(name, payload[name])
+		if err != nil {
+			log.Printf("data file %s: %v", name, err)
+			continue
+		}
+		files[name] = f
+		byPath[strings.TrimPrefix(f.URL, "/data/")] = f
+	}
+	ds.DATA_FILES, ds.dataByPath = files, byPath
+}
+
+// writeDataFiles copies ds's data files to its data dir, if any, once it is
+// the served build.
+func writeDataFiles(ds *Dataset) {
+	if ds.Inputs.DataDir == "" {
+		return
+	}
+	for _, name := range dataFileSet {
+		if f := ds.DATA_FILES[name]; f != nil {
+			writeDataFile(ds.Inputs.DataDir, f)
+		}
+	}
+}
+
+// writeDataFile stores emp.<hash>.json.gz and drops older hashes of the same file.
+func writeDataFile(dir string, f *dataFile) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("mkdir data dir: %v", err)
+		return
+	}
+	name := f.Name + "." + f.Hash + ".json.gz"
+	old, _ := filepath.Glob(filepath.Join(dir, f.Name+".*.json.gz"))
+	for _, p := range old {
+		if filepath.Base(p) != name {
+			_ = os.Remove(p)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), f.gz, 0644); err != nil {
+		log.Printf("write %s: %v", name, err)
+	}
+}
+
+func dataFileURLs(ds *Dataset, base string) map[string]string {
+	out := map[string]string{}
+	for name, f := range ds.DATA_FILES {
+		out[name] = base + f.URL
+	}
+	return out
+}
+
+func handleDataFile(w http.ResponseWriter, r *http.Request) {
+	ds := dataFor(r)
+	name := strings.TrimPrefix(r.URL.Path, "/data/")
+	if name == "manifest.json" {
+		w.Header().Set("Cache-Control", "no-cache")
+		list := []*dataFile{}
+		for _, f := range ds.DATA_FILES {
+			list = append(list, f)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		writeData(w, list, nil)
+		return
+	}
+	f, ok := ds.dataByPath[name]
+	if !ok {
+		writeError(w, 404, errNotFound, "no such data file: "+name)
+		return
+	}
+	etag := `"` + f.Hash + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Vary", "Accept-Encoding")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(f.gz)))
+		_, _ = w.Write(f.gz)
+		return
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(f.gz))
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	_, _ = io.Copy(w, zr)
+}
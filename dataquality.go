@@ -0,0 +1,258 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Data-quality report ----
+//
+// What in the HR exports needs fixing at source, check by check, with the
+// first few offending records of each:
+//
+//	blank_emp_id     rows of -basic or -services without an employee ID (dropped by the build)
+//	duplicate_emp_id employee IDs on more than one row of either (see duplicates.go)
+//	bad_dob          employees whose date of birth is blank or unreadable
+//	bad_doj          the same for the date of joining
+//	missing_email    employees without a valid email address (see bademails.go)
+//	missing_mobile   employees without a valid mobile number (see mobiles.go)
+//	school_no_zone   schools in the DBT summary without a zone
+//
+// -dq-limits caps the share of records a check may fail, in percent, e.g.
+// "blank_emp_id=0,bad_dob=2". The validate subcommand prints the report and
+// exits non-zero when a limit is breached; the API marks breaches:
+//
+//	GET /api/data-quality[?samples=N]
+
+var dqLimits = flag.String("dq-limits", "", `Data-quality limits as check=max percent, e.g. "blank_emp_id=0,bad_dob=2" (validate fails beyond them)`)
+
+const dqSamplesDef = 20
+
+// dqChecks are the checks in report order, with what each counts.
+var dqChecks = [][2]string{
+	{"blank_emp_id", "rows without an employee ID"},
+	{"duplicate_emp_id", "employee IDs on more than one row"},
+	{"bad_dob", "employees with a blank or unreadable date of birth"},
+	{"bad_doj", "employees with a blank or unreadable date of joining"},
+	{"missing_email", "employees without a valid email address"},
+	{"missing_mobile", "employees without a valid mobile number"},
+	{"school_no_zone", "schools without a zone"},
+}
+
+// DQSample is one offending record: an employee or school id, or a row of
+// a file.
+type DQSample struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	File  string `json:"file,omitempty"`
+	Row   int    `json:"row,omitempty"` // 1-based, the header being row 1
+	Value string `json:"value,omitempty"`
+}
+
+type DQCheck struct {
+	Check    string     `json:"check"`
+	Label    string     `json:"label"`
+	Count    int        `json:"count"`
+	Of       int        `json:"of"`
+	Pct      float64    `json:"pct"`
+	Limit    *float64   `json:"limit_pct,omitempty"`
+	Breached bool       `json:"breached"`
+	Samples  []DQSample `json:"samples"`
+}
+
+type DataQualityReport struct {
+	Employees int       `json:"employees"`
+	Schools   int       `json:"schools"`
+	Rows      int       `json:"rows"` // of -basic and -services together
+	Breached  int       `json:"breached"`
+	Checks    []DQCheck `json:"checks"`
+}
+
+// parseDQLimits reads -dq-limits.
+func parseDQLimits(s string) (map[string]float64, error) {
+	known := map[string]bool{}
+	for _, c := range dqChecks {
+		known[c[0]] = true
+	}
+	out := map[string]float64{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !known[k] {
+			return nil, fmt.Errorf("%q: want check=percent with a check from %s", part, dqCheckNames())
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || f < 0 || f > 100 {
+			return nil, fmt.Errorf("%q: the limit must be a percentage", part)
+		}
+		out[k] = f
+	}
+	return out, nil
+}
+
+func dqCheckNames() string {
+	names := make([]string, len(dqChecks))
+	for i, c := range dqChecks {
+		names[i] = c[0]
+	}
+	return strings.Join(names, ", ")
+}
+
+// blankIDRows finds the rows of the basic and services files without an
+// employee ID; a file that can't be read has none.
+func blankIDRows(in Inputs) (rows []DQSample, total int) {
+	for _, p := range []string{in.Basic, in.Services} {
+		if p == "" {
+			continue
+		}
+		t, err := ingest.ReadTable(p)
+		if err != nil {
+			continue
+		}
+		total += len(t.Rows)
+		for i, rec := range t.Rows {
+			if ingest.NormalizeEmpID(t.Get(rec, "Employee ID", "Emp ID")) == "" {
+				rows = append(rows, DQSample{File: p, Row: i + 2, Name: strings.TrimSpace(t.Get(rec, "Name of the Employee", "Employee Name", "Name"))})
+			}
+		}
+	}
+	return rows, total
+}
+
+// dataQuality checks emp and sch (and the blank-ID rows and duplicates
+// found in the files), keeping up to samples offenders per check.
+func dataQuality(emp map[string]Emp, sch map[string]School, blank []DQSample, dups []ingest.Duplicate, rows, samples int, limits map[string]float64) DataQualityReport {
+	rep := DataQualityReport{Employees: len(emp), Schools: len(sch), Rows: rows}
+	found := map[string][]DQSample{"blank_emp_id": blank}
+	counted := map[string]bool{}
+	for _, d := range dups {
+		if !counted[d.ID] {
+			counted[d.ID] = true
+			found["duplicate_emp_id"] = append(found["duplicate_emp_id"], DQSample{ID: d.ID, Name: emp[d.ID].Name, File: d.File, Row: d.Rows[0]})
+		}
+	}
+	for _, id := range sortedKeys(emp) {
+		e := emp[id]
+		if _, err := ingest.ParseDMYFlexible(e.DOB); err != nil {
+			found["bad_dob"] = append(found["bad_dob"], DQSample{ID: id, Name: e.Name, Value: e.DOB})
+		}
+		if _, err := ingest.ParseDMYFlexible(e.DOJ); err != nil {
+			found["bad_doj"] = append(found["bad_doj"], DQSample{ID: id, Name: e.Name, Value: e.DOJ})
+		}
+		if !ingest.ValidEmail(e.Email) {
+			found["missing_email"] = append(found["missing_email"], DQSample{ID: id, Name: e.Name, Value: e.Email})
+		}
+		if !ingest.ValidMobile(e.Mobile) {
+			found["missing_mobile"] = append(found["missing_mobile"], DQSample{ID: id, Name: e.Name, Value: e.Mobile})
+		}
+	}
+	for _, id := range sortedKeys(sch) {
+		if s := sch[id]; s.Zone == "" || s.Zone == "UNKNOWN" {
+			found["school_no_zone"] = append(found["school_no_zone"], DQSample{ID: id, Name: s.Name})
+		}
+	}
+	for _, c := range dqChecks {
+		of := len(emp)
+		switch c[0] {
+		case "blank_emp_id":
+			of = rows
+		case "school_no_zone":
+			of = len(sch)
+		}
+		list := found[c[0]]
+		chk := DQCheck{Check: c[0], Label: c[1], Count: len(list), Of: of, Pct: pct1(len(list), of), Samples: list[:min(samples, len(list))]}
+		if chk.Samples == nil {
+			chk.Samples = []DQSample{}
+		}
+		if lim, ok := limits[c[0]]; ok {
+			chk.Limit = &lim
+			chk.Breached = of > 0 && float64(chk.Count)*100/float64(of) > lim
+		}
+		if chk.Breached {
+			rep.Breached++
+		}
+		rep.Checks = append(rep.Checks, chk)
+	}
+	return rep
+}
+
+// inputsQuality reports on a tenant's files as a build would read them,
+// overrides aside.
+func inputsQuality(in Inputs, samples int, limits map[string]float64) (DataQualityReport, error) {
+	basic, err := ingest.LoadBasic(in.Basic)
+	if err != nil {
+		return DataQualityReport{}, err
+	}
+	services, err := ingest.LoadServices(in.Services)
+	if err != nil {
+		return DataQualityReport{}, err
+	}
+	dbt, err := ingest.LoadDBT(in.DBT)
+	if err != nil {
+		return DataQualityReport{}, err
+	}
+	emp, dups, err := ingest.EmployeesWith(basic, services, *duplicatePolicy)
+	if err != nil {
+		return DataQualityReport{}, err
+	}
+	blank, rows := blankIDRows(in)
+	return dataQuality(emp, ingest.Schools(dbt), blank, dups, rows, samples, limits), nil
+}
+
+// printDataQuality writes rep for the validate subcommand.
+func printDataQuality(id string, rep DataQualityReport) {
+	for _, c := range rep.Checks {
+		line := fmt.Sprintf("%s: data quality: %-16s %d of %d (%.1f%%)", id, c.Check, c.Count, c.Of, c.Pct)
+		if c.Limit != nil {
+			line += fmt.Sprintf(", limit %g%%", *c.Limit)
+		}
+		if c.Breached {
+			line += " BREACHED"
+		}
+		fmt.Println(line)
+	}
+	for _, c := range rep.Checks {
+		if !c.Breached {
+			continue
+		}
+		for _, s := range c.Samples {
+			if s.File != "" {
+				fmt.Printf("%s:   %s %s row %d %s\n", id, c.Check, s.File, s.Row, s.Name)
+			} else {
+				fmt.Printf("%s:   %s %s %s %q\n", id, c.Check, s.ID, s.Name, s.Value)
+			}
+		}
+	}
+}
+
+// GET /api/data-quality[?samples=N]
+func handleDataQuality(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	samples := dqSamplesDef
+	if s := r.URL.Query().Get("samples"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 1000 {
+			writeError(w, 400, errBadRequest, "samples must be 0-1000")
+			return
+		}
+		samples = n
+	}
+	limits, err := parseDQLimits(*dqLimits)
+	if err != nil {
+		writeError(w, 500, errInternal, "-dq-limits: "+err.Error())
+		return
+	}
+	ds := dataFor(r)
+	blank, rows := blankIDRows(ds.Inputs)
+	writeData(w, dataQuality(ds.EMP, ds.SCH, blank, ds.DUPLICATES, rows, samples, limits), nil)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- DBT components ----
+//
+// The DBT summary lumps every scheme into "DBT Received (Student/Parent)",
+// but the uniform subsidy, textbooks and scholarship are paid on different
+// timelines. When the DBT CSV carries per-scheme columns — "<Scheme>
+// Received (Student)", "<Scheme> Received (Parent)" and optionally "<Scheme>
+// Received (Student + Parent)", e.g. "Uniform Received (Student)" — each
+// scheme is counted on its own, per school and per zone (the schemes are
+// ingest.DBTSchemes). The combined columns are read as before.
+//
+//	GET /api/dbt/components[?zone=][&by=school][&format=csv]
+
+// addDBTComponents adds s's components into acc (keyed by scheme).
+func addDBTComponents(acc map[string]DBTComponent, s School) {
+	for k, c := range s.DBTComponents {
+		a := acc[k]
+		a.Student += c.Student
+		a.Parent += c.Parent
+		a.Total += c.Total
+		acc[k] = a
+	}
+}
+
+type DBTComponentRow struct {
+	Zone      string  `json:"zone"`
+	SchoolID  string  `json:"school_id,omitempty"`
+	School    string  `json:"school,omitempty"`
+	Scheme    string  `json:"scheme"`
+	Label     string  `json:"label"`
+	Enrolment int     `json:"enrolment"`
+	Student   int     `json:"student"`
+	Parent    int     `json:"parent"`
+	Total     int     `json:"total"`
+	Pct       float64 `json:"pct"`
+}
+
+// GET /api/dbt/components
+func handleDBTComponents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	ds := dataFor(r)
+	rows := []DBTComponentRow{}
+	if q.Get("by") == "school" {
+		for _, s := range ds.SCH {
+			if zone != "" && zone != allZones && s.Zone != zone {
+				continue
+			}
+			for _, sc := range ingest.DBTSchemes {
+				if c, ok := s.DBTComponents[sc.Key]; ok {
+					rows = append(rows, DBTComponentRow{Zone: s.Zone, SchoolID: s.ID, School: s.Name, Scheme: sc.Key, Label: sc.Label,
+						Enrolment: s.TotalEnrolment, Student: c.Student, Parent: c.Parent, Total: c.Total, Pct: c.Pct})
+				}
+			}
+		}
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i].Zone != rows[j].Zone {
+				return rows[i].Zone < rows[j].Zone
+			}
+			return rows[i].SchoolID < rows[j].SchoolID
+		})
+	} else {
+		zones := []string{}
+		for z := range ds.ZONE_KPI {
+			if z != allZones && (zone == "" || z == zone) {
+				zones = append(zones, z)
+			}
+		}
+		sort.Strings(zones)
+		if zone == "" || zone == allZones {
+			zones = append(zones, allZones)
+		}
+		for _, z := range zones {
+			k := ds.ZONE_KPI[z]
+			for _, sc := range ingest.DBTSchemes {
+				if c, ok := k.DBTComponents[sc.Key]; ok {
+					rows = append(rows, DBTComponentRow{Zone: z, Scheme: sc.Key, Label: sc.Label,
+						Enrolment: k.Enrolment, Student: c.Student, Parent: c.Parent, Total: c.Total, Pct: c.Pct})
+				}
+			}
+		}
+	}
+	if q.Get("format") == "csv" {
+		out := make([][]string, 0, len(rows))
+		for _, c := range rows {
+			out = append(out, []string{c.Zone, c.SchoolID, c.School, c.Label, strconv.Itoa(c.Enrolment), strconv.Itoa(c.Student),
+				strconv.Itoa(c.Parent), strconv.Itoa(c.Total), strconv.FormatFloat(c.Pct, 'f', 1, 64)})
+		}
+		writeCSV(w, r, "dbt_components.csv", []string{"Zone", "School ID", "School", "Scheme", "Enrolment", "Received (Student)",
+			"Received (Parent)", "Received (Total)", "Coverage %"}, out)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(rows, page, per)
+	writeData(w, items, meta)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Weekly digest ----
+//
+// A short HTML mail to the people running the dashboard, to -digest-to on
+// -digest-schedule (a cron expression in -schedule-tz, see schedule.go;
+// Mondays at 09:00 IST by default), so a restart doesn't push it back.
+// Features add their part to digestSections; a section that renders empty
+// is left out.
+//
+// With -digest-delta the digest lists only the headline metrics (see
+// snapshotMetrics) that moved by at least that many percent since the last
+// digest went out, and is not sent at all when none did. The metrics as of
+// each sent digest are kept in .last-digest.json among the snapshots, out
+// of reach of the tags; the first digest is always the full one.
+//
+//	GET  /api/digest/preview   (the mail as HTML)
+//	POST /api/digest/send      (send now)
+
+var (
+	digestTo       = flag.String("digest-to", "", "Comma-separated recipients of the weekly digest (empty = off)")
+	digestSchedule = flag.String("digest-schedule", "0 9 * * 1", "Cron expression for the weekly digest (empty = only on POST /api/digest/send)")
+	digestDelta    = flag.Float64("digest-delta", 0, "Only mail metrics that moved by at least this many percent since the last digest, and skip the mail when none did (0 = always the full digest)")
+)
+
+// digestBaselinePath is where the metrics of t's last digest are kept. The
+// leading dot is no valid tag, so it can't be tagged over, listed or purged.
+func digestBaselinePath(t *Tenant) string { return filepath.Join(t.SnapshotDir, ".last-digest.json") }
+
+type digestSection struct {
+	Title  string
+	Render func(t *Tenant, ds *Dataset, now time.Time) string // HTML, "" = skip
+}
+
+var digestSections = []digestSection{
+	{"Data", digestHeadline},
+	{"Correction and grievance queues", digestQueues},
+	{"Classroom shortage", digestClassrooms},
+	{"Substitute teachers this week", digestSubstitutes},
+}
+
+func digestHeadline(t *Tenant, ds *Dataset, now time.Time) string {
+	k := ds.ZONE_KPI[allZones]
+	return fmt.Sprintf(`<p>Data as of %s: %d schools, %d employees, %d teachers, PTR %.1f, DBT %.1f%%.</p>`,
+		ds.BuiltAt.Format("02 Jan 2006 15:04"), k.Schools, k.Employees, k.Teachers, k.PTR, k.DBTPct)
+}
+
+func digestRecipients() []string {
+	var out []string
+	for _, a := range strings.Split(*digestTo, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// digestChanges are the headline metrics that moved by at least
+// -digest-delta percent between base and ds; a metric that appeared,
+// vanished or left zero always counts. ok is false when there is no
+// base to compare with.
+func digestChanges(t *Tenant, ds *Dataset) (changes []MetricDelta, since time.Time, ok bool) {
+	base, err := readSnapshot(digestBaselinePath(t))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	cur := Snapshot{Metrics: snapshotMetrics(ds.EMP, ds.SCH, ds.SCORECARD)}
+	for _, d := range compareSnapshots(base, cur) {
+		if d.Delta == 0 {
+			continue
+		}
+		if d.Pct == nil || math.Abs(*d.Pct) >= *digestDelta {
+			changes = append(changes, d)
+		}
+	}
+	return changes, base.CreatedAt, true
+}
+
+func digestChangesTable(changes []MetricDelta) string {
+	num := func(p *float64) string {
+		if p == nil {
+			return "–"
+		}
+		return strconv.FormatFloat(math.Round(*p*100)/100, 'f', -1, 64)
+	}
+	var b strings.Builder
+	b.WriteString(`<table cellpadding="4" style="border-collapse:collapse"><tr><th align="left">Metric</th><th>Was</th><th>Now</th><th>Change</th></tr>`)
+	for _, d := range changes {
+		pct := ""
+		if d.Pct != nil {
+			pct = fmt.Sprintf(" (%+.1f%%)", *d.Pct)
+		}
+		fmt.Fprintf(&b, `<tr><td>%s</td><td align="right">%s</td><td align="right">%s</td><td align="right">%+g%s</td></tr>`,
+			html.EscapeString(d.Metric), num(d.From), num(d.To), math.Round(d.Delta*100)/100, pct)
+	}
+	b.WriteString(`</table>`)
+	return b.String()
+}
+
+// renderDigest returns the subject and HTML body of t's digest; send is
+// false in delta mode when nothing moved enough to be worth a mail.
+func renderDigest(t *Tenant, ds *Dataset, now time.Time) (subject, body string, send bool) {
+	sections := digestSections
+	if *digestDelta > 0 {
+		if changes, since, ok := digestChanges(t, ds); ok {
+			if len(changes) == 0 {
+				return "", "", false
+			}
+			title := fmt.Sprintf("Changed by %g%% or more since %s", *digestDelta, since.Format("02 Jan 2006"))
+			sections = []digestSection{digestSections[0], {title, func(*Tenant, *Dataset, time.Time) string { return digestChangesTable(changes) }}}
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div style="font-family:Arial,sans-serif;font-size:14px"><h2>%s – weekly digest</h2>`, html.EscapeString(t.PageTitle()))
+	for _, s := range sections {
+		if part := s.Render(t, ds, now); part != "" {
+			fmt.Fprintf(&b, "<h3>%s</h3>%s", html.EscapeString(s.Title), part)
+		}
+	}
+	b.WriteString(`<p style="color:#64748b">Generated ` + now.Format("02 Jan 2006 15:04") + `.</p></div>`)
+	return t.PageTitle() + " – weekly digest " + now.Format("02 Jan 2006"), b.String(), true
+}
+
+func sendDigest(t *Tenant) (int, error) {
+	to := digestRecipients()
+	if len(to) == 0 {
+		return 0, fmt.Errorf("no -digest-to recipients configured")
+	}
+	subject, body, ok := renderDigest(t, t.Data(), time.Now())
+	if !ok {
+		log.Printf("📰 Digest %s not sent: nothing moved by %g%% since the last one", t.ID, *digestDelta)
+		return 0, nil
+	}
+	sent := 0
+	for _, a := range to {
+		if err := queueMail(t, "", hqSender(), "", a, subject, body); err != nil {
+			log.Printf("digest %s to %s: %v", t.ID, a, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("📰 Digest %s sent to %d/%d recipients", t.ID, sent, len(to))
+	if sent > 0 && *digestDelta > 0 {
+		if err := writeSnapshot(digestBaselinePath(t), currentSnapshotData(t)); err != nil {
+			log.Printf("digest %s: %v", t.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+// startDigestSchedule mails every tenant's digest on -digest-schedule; it
+// fails on a bad expression.
+func startDigestSchedule() error {
+	if strings.TrimSpace(*digestSchedule) == "" || len(digestRecipients()) == 0 {
+		return nil
+	}
+	spec, err := parseCron(*digestSchedule)
+	if err != nil {
+		return fmt.Errorf("-digest-schedule: %v", err)
+	}
+	loc, err := scheduleLocation()
+	if err != nil {
+		return fmt.Errorf("-schedule-tz: %v", err)
+	}
+	next := spec.Next(time.Now().In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("-digest-schedule %q never fires", *digestSchedule)
+	}
+	log.Printf("📰 Digest scheduled %q (%s) to %s; next %s", *digestSchedule, loc, *digestTo, next.Format("02 Jan 15:04 MST"))
+	runOnSchedule(spec, loc, func(time.Time) {
+		for _, t := range TENANTS {
+			if _, err := sendDigest(t); err != nil {
+				log.Printf("digest %s: %v", t.ID, err)
+			}
+		}
+	})
+	return nil
+}
+
+// GET /api/digest/preview
+func handleDigestPreview(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	subject, body, ok := renderDigest(tenantFor(r), dataFor(r), time.Now())
+	if !ok {
+		subject, body = "No digest", fmt.Sprintf("<p>Nothing moved by %g%% since the last digest; none would be sent.</p>", *digestDelta)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "<!doctype html><title>%s</title>%s", html.EscapeString(subject), body)
+}
+
+// POST /api/digest/send
+func handleDigestSend(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	n, err := sendDigest(tenantFor(r))
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	writeData(w, map[string]int{"sent": n}, nil)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSandboxDigestIsDryRun(t *testing.T) {
+	dir := t.TempDir()
+	ten := &Tenant{ID: "training", Sandbox: true, EmailLog: filepath.Join(dir, "email_log.jsonl")}
+	ten.data.Store(&Dataset{ZONE_KPI: map[string]ZoneKPI{}})
+	defer func(live bool, tenants []*Tenant, to, spool string) {
+		LiveMode, TENANTS, *digestTo, *mailSpool = live, tenants, to, spool
+	}(LiveMode, TENANTS, *digestTo, *mailSpool)
+	LiveMode, TENANTS, *digestTo, *mailSpool = true, []*Tenant{ten}, "director@mcd.example", filepath.Join(dir, "mailq")
+
+	if _, err := sendDigest(ten); err != nil {
+		t.Fatal(err)
+	}
+	if spooled, _ := filepath.Glob(filepath.Join(dir, "mailq", "*.json")); len(spooled) > 0 {
+		t.Fatalf("sandbox digest was queued for delivery: %v", spooled)
+	}
+	b, err := os.ReadFile(ten.EmailLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"to":"director@mcd.example"`) || !strings.Contains(string(b), `"status":"`+mailDryRun+`"`) {
+		t.Errorf("email log doesn't record a dry run to the recipient:\n%s", b)
+	}
+}
+
+func TestDigestBaselineOutsideTags(t *testing.T) {
+	ten := &Tenant{ID: "default", SnapshotDir: t.TempDir()}
+	ten.data.Store(&Dataset{ZONE_KPI: map[string]ZoneKPI{}, BuiltAt: time.Now().AddDate(-1, 0, 0)})
+	if err := writeSnapshot(digestBaselinePath(ten), currentSnapshotData(ten)); err != nil {
+		t.Fatal(err)
+	}
+	if list := listSnapshots(ten); len(list) != 0 {
+		t.Errorf("baseline listed as a snapshot: %+v", list)
+	}
+	if _, err := saveSnapshot(ten, ".last-digest"); err == nil {
+		t.Error("the baseline could be tagged over")
+	}
+	if removed, _, err := purgeSnapshotDir(ten.SnapshotDir, time.Now().AddDate(1, 0, 0), false); err != nil || removed != 0 {
+		t.Errorf("purge removed %d (%v)", removed, err)
+	}
+	if _, err := readSnapshot(digestBaselinePath(ten)); err != nil {
+		t.Error(err)
+	}
+}
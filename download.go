@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---- Resumable exports ----
+//
+// CSV and XLSX exports can run to hundreds of megabytes (the full roster),
+// too much to restart from zero every time a zone office's connection
+// drops. Each export is encoded twice: once into a hash, which gives its
+// length and an ETag, then again straight onto the connection, so nothing
+// is held in memory beyond the rows themselves. Responses carry
+// Accept-Ranges, and a single byte range is honoured:
+//
+//	curl -C - -o staff.csv '.../api/employees?format=csv'
+//
+// A client resuming with If-Range gets the whole file again if a rebuild
+// has changed the export since.
+
+// exportBody writes an export; it is called more than once per request
+// and must write the same bytes each time.
+type exportBody func(io.Writer) error
+
+// errRangeDone stops an exportBody once the requested range is written.
+var errRangeDone = errors.New("range written")
+
+// serveExport sends body as a download called name, honouring Range.
+func serveExport(w http.ResponseWriter, r *http.Request, name, contentType string, body exportBody) {
+	hw := &hashWriter{h: sha256.New()}
+	if err := body(hw); err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	size, etag := hw.n, `"`+hex.EncodeToString(hw.h.Sum(nil)[:16])+`"`
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "private, no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	start, end, status := int64(0), size-1, http.StatusOK
+	if spec := r.Header.Get("Range"); spec != "" && (r.Header.Get("If-Range") == "" || r.Header.Get("If-Range") == etag) {
+		s, e, ok, err := parseByteRange(spec, size)
+		if err != nil {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if ok {
+			start, end, status = s, e, http.StatusPartialContent
+			h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+	}
+	h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead || size == 0 {
+		return
+	}
+	_ = body(&rangeWriter{w: w, start: start, end: end})
+}
+
+// parseByteRange reads a Range header against a body of size bytes. ok is
+// false for a header to ignore (not bytes, or several ranges: the whole
+// body is sent); err is set when the range lies outside the body.
+func parseByteRange(spec string, size int64) (start, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(spec, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	a, b, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+	if a == "" { // the last b bytes
+		n, perr := strconv.ParseInt(b, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errors.New("range not satisfiable")
+		}
+		return max(size-n, 0), size - 1, true, nil
+	}
+	start, perr := strconv.ParseInt(a, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end = size - 1
+	if b != "" {
+		if end, perr = strconv.ParseInt(b, 10, 64); perr != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if start >= size {
+		return 0, 0, false, errors.New("range not satisfiable")
+	}
+	return start, end, true, nil
+}
+
+// hashWriter hashes and counts what is written to it.
+type hashWriter struct {
+	h hash.Hash
+	n int64
+}
+
+func (w *hashWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return w.h.Write(p)
+}
+
+// rangeWriter passes on bytes start to end (inclusive) of what is written
+// to it and fails with errRangeDone past end.
+type rangeWriter struct {
+	w          io.Writer
+	start, end int64
+	off        int64
+}
+
+func (rw *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	from, to := rw.off, rw.off+int64(n) // p covers [from, to)
+	rw.off = to
+	if to <= rw.start {
+		return n, nil
+	}
+	if from > rw.end {
+		return 0, errRangeDone
+	}
+	lo, hi := max(rw.start-from, 0), min(rw.end+1-from, int64(n))
+	if _, err := rw.w.Write(p[lo:hi]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// writeCSV sends header and rows as a resumable CSV download.
+func writeCSV(w http.ResponseWriter, r *http.Request, filename string, header []string, rows [][]string) {
+	serveExport(w, r, filename, "text/csv; charset=utf-8", func(out io.Writer) error {
+		cw := csv.NewWriter(out)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		return cw.WriteAll(rows)
+	})
+}
+
+// writeXLSX sends b as a resumable workbook download.
+func writeXLSX(w http.ResponseWriter, r *http.Request, filename string, b *xlsxBook) {
+	data, err := b.Bytes()
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	serveExport(w, r, filename, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", func(out io.Writer) error {
+		_, err := out.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Duplicate employee IDs ----
+//
+// An employee ID on more than one row of Basic.csv or Services.csv is
+// resolved by -duplicate-policy (see ingest.DupPolicies):
+//
+//	last         the later row, keeping the name, email, gender and marital
+//	             status of an earlier row where it has none (the default)
+//	first        the first row
+//	latest-doj   the Services.csv row with the latest date of joining, and
+//	             the Basic.csv row at that school (else the later one)
+//	merge        column by column, the last non-empty value
+//
+// Each build lists what it found, which row counted and the columns the
+// rows disagree on; a build restored from -db has no list until the next
+// rebuild:
+//
+//	GET /api/duplicates[?file=basic|services][&format=csv]
+
+var duplicatePolicy = flag.String("duplicate-policy", ingest.DupLast, "How to resolve an employee ID on several rows: last, first, latest-doj or merge")
+
+func checkDuplicatePolicy() error {
+	if !ingest.ValidDupPolicy(*duplicatePolicy) {
+		return fmt.Errorf("-duplicate-policy must be one of %s", strings.Join(ingest.DupPolicies, ", "))
+	}
+	return nil
+}
+
+// GET /api/duplicates
+func handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	ds, q := dataFor(r), r.URL.Query()
+	var file string
+	switch q.Get("file") {
+	case "":
+	case "basic":
+		file = ds.Inputs.Basic
+	case "services":
+		file = ds.Inputs.Services
+	default:
+		writeError(w, 400, errBadRequest, "file must be basic or services")
+		return
+	}
+	list := []ingest.Duplicate{}
+	for _, d := range ds.DUPLICATES {
+		if file == "" || d.File == file {
+			list = append(list, d)
+		}
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, d := range list {
+			nums := make([]string, len(d.Rows))
+			for i, n := range d.Rows {
+				nums[i] = strconv.Itoa(n)
+			}
+			kept := "merged"
+			if d.Kept > 0 {
+				kept = strconv.Itoa(d.Kept)
+			}
+			rows = append(rows, []string{d.ID, d.File, strings.Join(nums, " "), kept, strings.Join(d.Differs, "; ")})
+		}
+		writeCSV(w, r, "duplicates.csv", []string{"Employee ID", "File", "Rows", "Kept Row", "Differing Columns"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// duplicatesNote sums up a build's duplicates for the log.
+func duplicatesNote(dups []ingest.Duplicate) string {
+	files := map[string]int{}
+	for _, d := range dups {
+		files[d.File]++
+	}
+	var parts []string
+	for _, f := range sortedKeys(files) {
+		parts = append(parts, fmt.Sprintf("%d in %s", files[f], f))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Email import ----
+//
+// Addresses collected in drives arrive as a two-column CSV (Employee ID,
+// Email). They are validated against the current data and merged into the
+// overrides layer; anything doubtful is reported instead of applied:
+//
+//	POST /api/overrides/emails[?overwrite=1][&dry_run=1]   (CSV body or multipart "file")
+//	mcd-dashboard import-emails [-overwrite] drive.csv [tenant-id]
+
+var importOverwrite = flag.Bool("overwrite", false, "import-emails: replace existing addresses that differ")
+
+type emailRow struct {
+	Line         int
+	EmpID, Email string
+}
+
+type EmailImportIssue struct {
+	Line    int    `json:"line"`
+	EmpID   string `json:"emp_id"`
+	Email   string `json:"email"`
+	Current string `json:"current,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+type EmailImportReport struct {
+	Rows      int                `json:"rows"`
+	Applied   int                `json:"applied"`
+	Unchanged int                `json:"unchanged"`
+	DryRun    bool               `json:"dry_run,omitempty"`
+	Conflicts []EmailImportIssue `json:"conflicts"`
+	Invalid   []EmailImportIssue `json:"invalid"`
+}
+
+// parseEmailCSV reads (Employee ID, Email) rows; a first row without an "@"
+// in the second column is taken as a header.
+func parseEmailCSV(r io.Reader) ([]emailRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var out []emailRow
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) < 2 {
+			rec = append(rec, "", "")
+		}
+		if line == 1 && !strings.Contains(rec[1], "@") {
+			continue
+		}
+		out = append(out, emailRow{Line: line, EmpID: rec[0], Email: rec[1]})
+	}
+}
+
+// importEmails validates rows against ds and, unless dryRun, merges the
+// accepted ones into the tenant's overrides file.
+func importEmails(t *Tenant, ds *Dataset, rows []emailRow, source string, overwrite, dryRun bool) (EmailImportReport, error) {
+	rep := EmailImportReport{Rows: len(rows), DryRun: dryRun, Conflicts: []EmailImportIssue{}, Invalid: []EmailImportIssue{}}
+	if t.Overrides == "" {
+		return rep, fmt.Errorf("no overrides file configured")
+	}
+	owner := map[string]string{}
+	for id, e := range ds.EMP {
+		if e.Email != "" {
+			owner[strings.ToLower(e.Email)] = id
+		}
+	}
+	accepted := map[string]string{}
+	inFile := map[string]string{}
+	for _, r := range rows {
+		id, email := ingest.NormalizeEmpID(r.EmpID), strings.ToLower(strings.TrimSpace(r.Email))
+		issue := EmailImportIssue{Line: r.Line, EmpID: id, Email: email}
+		e, known := ds.EMP[id]
+		issue.Current = e.Email
+		switch {
+		case id == "":
+			issue.Reason = "missing employee id"
+		case !ingest.ValidEmail(email):
+			issue.Reason = "invalid email address"
+		case !known:
+			issue.Reason = "unknown employee"
+		case inFile[id] != "" && inFile[id] != email:
+			issue.Reason = "employee listed again with a different address"
+		}
+		if issue.Reason != "" {
+			rep.Invalid = append(rep.Invalid, issue)
+			continue
+		}
+		inFile[id] = email
+		cur := strings.ToLower(e.Email)
+		switch {
+		case owner[email] != "" && owner[email] != id:
+			issue.Reason = "address already belongs to employee " + owner[email]
+			rep.Conflicts = append(rep.Conflicts, issue)
+		case cur == email:
+			rep.Unchanged++
+		case cur != "" && !overwrite:
+			issue.Reason = "differs from current address"
+			rep.Conflicts = append(rep.Conflicts, issue)
+		default:
+			if _, dup := accepted[id]; !dup {
+				rep.Applied++
+			}
+			accepted[id] = email
+		}
+	}
+	if dryRun || len(accepted) == 0 {
+		return rep, nil
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	ov := loadOverrides(t.Overrides)
+	now := time.Now()
+	for id, email := range accepted {
+		if ov.Emp[id] == nil {
+			ov.Emp[id] = map[string]Override{}
+		}
+		ov.Emp[id]["email"] = Override{Value: email, Source: source, At: now}
+	}
+	return rep, saveOverrides(t.Overrides, ov)
+}
+
+// POST /api/overrides/emails
+func handleImportEmails(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	var body io.Reader = r.Body
+	source := "import via API"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, 400, errBadRequest, "multipart upload needs a \"file\" part: "+err.Error())
+			return
+		}
+		defer f.Close()
+		body, source = f, "import "+hdr.Filename
+	}
+	rows, err := parseEmailCSV(body)
+	if err != nil {
+		writeError(w, 400, errBadRequest, "csv: "+err.Error())
+		return
+	}
+	q := r.URL.Query()
+	t := tenantFor(r)
+	rep, err := importEmails(t, dataFor(r), rows, source+" by "+userFor(r).Name, q.Get("overwrite") == "1", q.Get("dry_run") == "1")
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("📧 Email import by %s: %d rows, %d applied, %d conflicts, %d invalid",
+		userFor(r).Name, rep.Rows, rep.Applied, len(rep.Conflicts), len(rep.Invalid))
+	if rep.Applied > 0 && !rep.DryRun {
+		t.Build()
+	}
+	writeData(w, rep, nil)
+}
+
+// cmdImportEmails is the import-emails subcommand: flag.Args() holds the CSV
+// path and an optional tenant id.
+func cmdImportEmails([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: import-emails [-overwrite] <file.csv> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rows, err := parseEmailCSV(f)
+	if err != nil {
+		return err
+	}
+	rep, err := importEmails(t, buildAll(t.inputs()), rows, "import "+args[0], *importOverwrite, false)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d rows: %d applied, %d unchanged, %d conflicts, %d invalid\n",
+		rep.Rows, rep.Applied, rep.Unchanged, len(rep.Conflicts), len(rep.Invalid))
+	for _, c := range rep.Conflicts {
+		fmt.Printf("  conflict line %d: %s %s (current %q): %s\n", c.Line, c.EmpID, c.Email, c.Current, c.Reason)
+	}
+	for _, c := range rep.Invalid {
+		fmt.Printf("  invalid  line %d: %s %s: %s\n", c.Line, c.EmpID, c.Email, c.Reason)
+	}
+	return nil
+}
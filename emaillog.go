@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Email log ----
+//
+// Every attempt to deliver a mail is written to the tenant's email log
+// (-email-log, one JSON line each): when, which employee, to whom, the
+// subject and how it went. A mail that is retried appears once per attempt;
+// dry-run sends are logged as dry_run. It is the record of who was greeted
+// and why a mail didn't arrive:
+//
+//	GET /api/email-log[?emp=][&to=][&status=sent|failed|retrying|dry_run][&job=][&since=YYYY-MM-DD][&until=YYYY-MM-DD][&page=][&per_page=]
+//
+// Newest first. Mail not sent for a tenant (the HQ test mail) goes to
+// -email-log itself.
+
+var emailLogFile = flag.String("email-log", "./out/email-log.jsonl", "Log of every mail delivery attempt and its outcome")
+
+const (
+	mailSent     = "sent"
+	mailFailed   = "failed"   // given up on
+	mailRetrying = "retrying" // failed, will be tried again
+	mailDryRun   = "dry_run"
+)
+
+type EmailLogRecord struct {
+	At      time.Time `json:"at"`
+	MailID  string    `json:"mail_id,omitempty"`
+	Job     string    `json:"job,omitempty"`
+	EmpID   string    `json:"emp_id,omitempty"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Status  string    `json:"status"`
+	Attempt int       `json:"attempt,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// emailLogPath is the log of the tenant with id, or -email-log.
+func emailLogPath(id string) string {
+	for _, t := range TENANTS {
+		if t.ID == id {
+			return t.EmailLog
+		}
+	}
+	return *emailLogFile
+}
+
+func logEmail(tenant string, rec EmailLogRecord) {
+	path := emailLogPath(tenant)
+	if path == "" {
+		return
+	}
+	rec.At = time.Now()
+	if err := appendJSONL(path, rec); err != nil {
+		log.Printf("email log %s: %v", path, err)
+	}
+}
+
+// logSend records a mail sent straight away rather than through the queue:
+// sent or failed with err, or dry_run unless live.
+func logSend(tenant string, live bool, s Sender, to, subject string, err error) {
+	rec := EmailLogRecord{From: s.From, To: to, Subject: subject, Status: mailSent}
+	switch {
+	case err != nil:
+		rec.Status, rec.Error = mailFailed, err.Error()
+	case !live:
+		rec.Status = mailDryRun
+	}
+	logEmail(tenant, rec)
+}
+
+// GET /api/email-log
+func handleEmailLog(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, q := tenantFor(r), r.URL.Query()
+	since, err := slaSince(q.Get("since"))
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	var until time.Time
+	if s := q.Get("until"); s != "" {
+		if until, err = time.Parse("2006-01-02", s); err != nil {
+			writeError(w, 400, errBadRequest, "until must be YYYY-MM-DD")
+			return
+		}
+		until = until.AddDate(0, 0, 1)
+	}
+	status := q.Get("status")
+	switch status {
+	case "", mailSent, mailFailed, mailRetrying, mailDryRun:
+	default:
+		writeError(w, 400, errBadRequest, "status must be sent, failed, retrying or dry_run")
+		return
+	}
+	emp, to, job := strings.TrimSpace(q.Get("emp")), strings.ToLower(strings.TrimSpace(q.Get("to"))), q.Get("job")
+	out := []EmailLogRecord{}
+	if t.EmailLog != "" {
+		readJSONL(t.EmailLog, func(rec EmailLogRecord) {
+			switch {
+			case emp != "" && rec.EmpID != emp,
+				to != "" && strings.ToLower(rec.To) != to,
+				status != "" && rec.Status != status,
+				job != "" && rec.Job != job,
+				rec.At.Before(since),
+				!until.IsZero() && !rec.At.Before(until):
+				return
+			}
+			out = append(out, rec)
+		})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].At.After(out[j].At) })
+	page, per := pageParams(r, 100, 1000)
+	items, meta := paginate(out, page, per)
+	writeData(w, items, meta)
+}
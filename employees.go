@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"myproject/ingest"
+)
+
+// ---- Employee API (v1) ----
+
+var bulkLookupMax = flag.Int("bulk-max", 1000, "Max employee IDs accepted per bulk lookup request")
+
+type bulkLookupReq struct {
+	IDs []json.Number `json:"ids"`
+}
+
+type bulkLookupResp struct {
+	Employees []Emp    `json:"employees"`
+	Missing   []string `json:"missing"`
+}
+
+// handleEmployeesLookup resolves many IDs in one call. IDs may be sent as
+// JSON strings or numbers; results keep request order and duplicates are
+// collapsed.
+func handleEmployeesLookup(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(*bulkLookupMax)*64+1024)
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	var req bulkLookupReq
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, 400, errBadRequest, "body must be {\"ids\": [...]}: "+err.Error())
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeError(w, 400, errBadRequest, "ids is empty")
+		return
+	}
+	if len(req.IDs) > *bulkLookupMax {
+		writeError(w, http.StatusRequestEntityTooLarge, errBadRequest, fmt.Sprintf("at most %d ids per request", *bulkLookupMax))
+		return
+	}
+
+	emp := dataFor(r).EMP
+	resp := bulkLookupResp{Employees: []Emp{}, Missing: []string{}}
+	seen := map[string]bool{}
+	for _, raw := range req.IDs {
+		id := ingest.NormalizeEmpID(raw.String())
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if e, ok := emp[id]; ok {
+			resp.Employees = append(resp.Employees, e)
+		} else {
+			resp.Missing = append(resp.Missing, id)
+		}
+	}
+	writeData(w, resp, &Meta{Count: len(resp.Employees), Total: len(seen)})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ---- Environment overrides ----
+//
+// Every flag can also come from an MCD_* variable: -data-dir is
+// MCD_DATA_DIR, -log-max-mb is MCD_LOG_MAX_MB. Precedence is command line,
+// then environment, then -config (config.go), then the built-in default.
+
+const envPrefix = "MCD_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag not given on the command line from its MCD_*
+// variable, if present.
+func applyEnv(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("%s=%q: %v", envName(f.Name), v, e)
+			}
+		}
+	})
+	return err
+}
+
+func init() {
+	usage := flag.Usage
+	flag.Usage = func() {
+		usage()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nEvery flag may also be set via the environment as %s<NAME>, e.g. -data-dir as %s.\n",
+			envPrefix, envName("data-dir"))
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- School heads and escalation ----
+//
+// Each school's head (HoS) is its principal or, where it has none, the
+// teacher who joined the service first; the build works them out along
+// with the rest. Something wrong at a school is taken up with the HoS,
+// then the school's inspector (SI, named in the DBT summary), then the
+// zone's DDE: its zone head accounts (circulars.go), else the zone
+// office's mailbox. The DBT summary only names inspectors, so their
+// addresses come from -si-contacts (a tenant's "si_contacts"):
+//
+//	{"MAHIPAL": "mahipal.si@mcd.example", "RAJ KUMAR": "rk.si@mcd.example"}
+//
+// A link without an address is skipped when escalating (alerts.go). Where
+// someone holds a school's or a circle's charge by order (charges.go), they
+// stand in for the HoS or SI.
+//
+//	GET /api/school/escalation?id=
+
+var siContactsFile = flag.String("si-contacts", "", "JSON file mapping school inspector names to email addresses")
+
+// SchoolHead is the HoS of a school; Acting when not its principal.
+type SchoolHead struct {
+	EmpID       string  `json:"emp_id"`
+	Name        string  `json:"name"`
+	Designation string  `json:"designation"`
+	Email       string  `json:"email,omitempty"`
+	Mobile      string  `json:"mobile,omitempty"`
+	DOJ         string  `json:"doj,omitempty"`
+	Acting      bool    `json:"acting,omitempty"`
+	Charge      *Charge `json:"charge,omitempty"` // the order the head holds charge by
+}
+
+// schoolHeads finds every school's HoS: its principal (the senior-most by
+// DOJ if there are several), else its senior-most teacher. Staff without
+// a readable DOJ rank last.
+func schoolHeads(emp map[string]Emp) map[string]SchoolHead {
+	out := map[string]SchoolHead{}
+	for sid, roster := range rosterBySchool(emp) {
+		var principals, teachers []Emp
+		for _, e := range roster {
+			d := strings.ToLower(e.Designation)
+			switch {
+			case strings.Contains(d, "principal"):
+				principals = append(principals, e)
+			case strings.Contains(d, "teacher"):
+				teachers = append(teachers, e)
+			}
+		}
+		pick, acting := principals, false
+		if len(pick) == 0 {
+			pick, acting = teachers, true
+		}
+		if len(pick) == 0 {
+			continue
+		}
+		e := seniorMost(pick)
+		out[sid] = SchoolHead{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Email: e.Email,
+			Mobile: e.Mobile, DOJ: e.DOJ, Acting: acting}
+	}
+	return out
+}
+
+func seniorMost(list []Emp) Emp {
+	joined := func(e Emp) time.Time {
+		d, err := ingest.ParseDMYFlexible(e.DOJ)
+		if err != nil {
+			return time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+		return d
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := joined(list[i]), joined(list[j])
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list[0]
+}
+
+const (
+	levelHoS = iota
+	levelSI
+	levelDDE
+)
+
+var levelNames = []string{"HoS", "SI", "DDE"}
+
+// EscalationStep is one link of a school's chain; To is empty when there
+// is nobody to mail at that level.
+type EscalationStep struct {
+	Level string   `json:"level"`
+	Name  string   `json:"name,omitempty"`
+	To    []string `json:"to"`
+}
+
+// siContacts reads the tenant's SI contacts afresh, so HQ can add
+// inspectors without a restart. Names are matched case-insensitively.
+func (t *Tenant) siContacts() map[string]string {
+	out := map[string]string{}
+	if t.SIContacts == "" {
+		return out
+	}
+	b, err := os.ReadFile(t.SIContacts)
+	if err != nil {
+		return out
+	}
+	var m map[string]string
+	if json.Unmarshal(b, &m) != nil {
+		return out
+	}
+	for k, v := range m {
+		out[strings.ToUpper(strings.TrimSpace(k))] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// escalationChain is who to tell about school id, HoS first.
+func escalationChain(t *Tenant, ds *Dataset, id string) []EscalationStep {
+	s := ds.SCH[id]
+	chain := make([]EscalationStep, 3)
+	for i := range chain {
+		chain[i] = EscalationStep{Level: levelNames[i], To: []string{}}
+	}
+	if h, ok := ds.HEADS[id]; ok {
+		chain[levelHoS].Name = h.Name
+		if h.Email != "" {
+			chain[levelHoS].To = append(chain[levelHoS].To, h.Email)
+		}
+	}
+	if c, ok := ds.SI_CHARGES[strings.ToUpper(strings.TrimSpace(s.SIName))]; ok && s.SIName != "" {
+		e := ds.EMP[c.EmpID]
+		chain[levelSI].Name = e.Name + " (in charge for " + s.SIName + ")"
+		if ingest.ValidEmail(e.Email) {
+			chain[levelSI].To = append(chain[levelSI].To, strings.TrimSpace(e.Email))
+		}
+	} else if s.SIName != "" {
+		chain[levelSI].Name = s.SIName
+		if a := t.siContacts()[strings.ToUpper(strings.TrimSpace(s.SIName))]; a != "" {
+			chain[levelSI].To = append(chain[levelSI].To, a)
+		}
+	}
+	chain[levelDDE].Name = s.Zone
+	for _, u := range t.zoneHeads(s.Zone) {
+		if u.Email != "" {
+			chain[levelDDE].To = append(chain[levelDDE].To, u.Email)
+		}
+	}
+	if len(chain[levelDDE].To) == 0 {
+		if box := t.zoneMailbox(s.Zone); box != "" {
+			chain[levelDDE].To = append(chain[levelDDE].To, box)
+		}
+	}
+	return chain
+}
+
+// GET /api/school/escalation?id=
+func handleSchoolEscalation(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	ds, id := dataFor(r), strings.TrimSpace(r.URL.Query().Get("id"))
+	s, ok := ds.SCH[id]
+	if !ok {
+		writeError(w, 404, errNotFound, "no school "+id)
+		return
+	}
+	var head *SchoolHead
+	if h, ok := ds.HEADS[id]; ok {
+		head = &h
+	}
+	writeData(w, map[string]any{"school": s.ID, "name": s.Name, "zone": s.Zone, "head": head,
+		"chain": escalationChain(tenantFor(r), ds, id)}, nil)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- SFTP fetch ----
+//
+// With -fetch-from (an sftp:// URL, see sftp.go) each tenant's monthly drop
+// is collected from the portal's server every -fetch-every instead of being
+// copied on by hand. The drop folder must hold a SHA256SUMS file
+// (sha256sum's format) listing the files; it is the uploader's "done"
+// marker, so it should be written last. A drop is taken when SHA256SUMS
+// differs from the last one taken: every listed file is downloaded into a
+// new folder under -fetch-dir and checked against its sum, and only when
+// all of them match are the ones named like the tenant's -basic, -services
+// and -dbt copied over those and the tenant rebuilt. The newest -fetch-keep
+// drops are kept as they arrived.
+
+var (
+	fetchFrom  = flag.String("fetch-from", "", "sftp:// folder to collect the monthly input files from (empty = off)")
+	fetchEvery = flag.Duration("fetch-every", time.Hour, "How often to check -fetch-from for a new drop")
+	fetchDir   = flag.String("fetch-dir", "./out/incoming", "Directory keeping the fetched drops as received")
+	fetchKeep  = flag.Int("fetch-keep", 12, "Number of fetched drops to keep per tenant")
+)
+
+const (
+	fetchSums    = "SHA256SUMS"
+	fetchMaxFile = 512 << 20
+)
+
+// parseSums reads sha256sum output: "<hex>  name" or "<hex> *name".
+func parseSums(b []byte) (map[string]string, error) {
+	sums := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if _, err := hex.DecodeString(sum); !ok || err != nil || len(sum) != 64 || name == "" {
+			return nil, fmt.Errorf("%s line %d: want \"<sha256>  <file>\"", fetchSums, n)
+		}
+		if name != path.Base(name) {
+			return nil, fmt.Errorf("%s line %d: %q is not in the drop folder", fetchSums, n, name)
+		}
+		sums[name] = strings.ToLower(sum)
+	}
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("%s lists no files", fetchSums)
+	}
+	return sums, nil
+}
+
+func tenantFetchDir(t *Tenant) string { return filepath.Join(*fetchDir, t.ID) }
+
+// fetchDrop collects t's drop if it is new, and reports whether the
+// tenant's inputs were replaced.
+func fetchDrop(t *Tenant) (bool, error) {
+	u, err := url.Parse(t.FetchFrom)
+	if err != nil || u.Scheme != "sftp" {
+		return false, fmt.Errorf("fetch_from must be an sftp:// URL")
+	}
+	c, err := dialSFTP(u)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	remote := func(name string) string {
+		if u.Path == "" {
+			return name
+		}
+		return path.Join(u.Path, name)
+	}
+
+	raw, err := c.Get(remote(fetchSums), 1<<20)
+	if err != nil {
+		if se := (*sftpError)(nil); errors.As(err, &se) && se.Code == sftpNoFile { // nothing dropped yet
+			return false, nil
+		}
+		return false, err
+	}
+	local := tenantFetchDir(t)
+	if last, err := os.ReadFile(filepath.Join(local, fetchSums)); err == nil && bytes.Equal(last, raw) {
+		return false, nil
+	}
+	sums, err := parseSums(raw)
+	if err != nil {
+		return false, err
+	}
+
+	drop := filepath.Join(local, time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(drop, 0755); err != nil {
+		return false, err
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b, err := c.Get(remote(name), fetchMaxFile)
+		if err != nil {
+			return false, err
+		}
+		got := sha256.Sum256(b)
+		if hex.EncodeToString(got[:]) != sums[name] {
+			os.RemoveAll(drop)
+			return false, fmt.Errorf("%s: checksum mismatch, drop rejected", name)
+		}
+		if err := os.WriteFile(filepath.Join(drop, name), b, 0644); err != nil {
+			return false, err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(drop, fetchSums), raw, 0644); err != nil {
+		return false, err
+	}
+
+	installed := 0
+	for _, dst := range []string{t.Basic, t.Services, t.DBT} {
+		if _, ok := sums[filepath.Base(dst)]; !ok || dst == "" {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(drop, filepath.Base(dst)))
+		if err == nil {
+			err = os.WriteFile(dst+".tmp", b, 0644)
+		}
+		if err == nil {
+			err = os.Rename(dst+".tmp", dst)
+		}
+		if err != nil {
+			return installed > 0, err
+		}
+		installed++
+	}
+	// Remembered only now, so a drop that failed part way is tried again.
+	if err := os.WriteFile(filepath.Join(local, fetchSums), raw, 0644); err != nil {
+		return installed > 0, err
+	}
+	log.Printf("📥 Fetched %d file(s) for %s into %s; %d input(s) replaced", len(names), t.ID, drop, installed)
+	pruneDrops(local)
+	return installed > 0, nil
+}
+
+// pruneDrops removes all but the newest -fetch-keep drops.
+func pruneDrops(dir string) {
+	drops, _ := filepath.Glob(filepath.Join(dir, "[0-9]*-[0-9]*"))
+	sort.Strings(drops)
+	for len(drops) > max(*fetchKeep, 1) {
+		os.RemoveAll(drops[0])
+		drops = drops[1:]
+	}
+}
+
+// startFetchSchedule checks every tenant with a fetch_from right away and
+// then each -fetch-every.
+func startFetchSchedule() {
+	if *fetchEvery <= 0 {
+		return
+	}
+	check := func() {
+		for _, t := range TENANTS {
+			if t.FetchFrom == "" {
+				continue
+			}
+			changed, err := fetchDrop(t)
+			if err != nil {
+				log.Printf("fetch %s from %s: %v", t.ID, redactURL(t.FetchFrom), err)
+			}
+			if changed {
+				t.Build()
+			}
+		}
+	}
+	go func() {
+		check()
+		for range time.Tick(*fetchEvery) {
+			check()
+		}
+	}()
+}
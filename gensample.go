@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Sample data ----
+//
+// gen-sample writes synthetic Basic, Services and DBT summary files in the
+// portal's layout, for training and demos without real personal data:
+//
+//	mcd gen-sample [-sample-employees 2000] [-sample-schools 100] [-sample-seed 1] <dir>
+//	mcd -sandbox -basic <dir>/Basic.csv -services <dir>/Services.csv -dbt <dir>/Dashboard_Summary.csv
+//
+// Zones and designations follow the real proportions; names, numbers and
+// addresses are made up and every address is at example.com. The same seed
+// gives the same files. About 1.5% of employees have no email, as in the
+// real exports, so the data-quality views have something to show.
+
+var (
+	sampleEmployees = flag.Int("sample-employees", 2000, "gen-sample: number of employees")
+	sampleSchools   = flag.Int("sample-schools", 100, "gen-sample: number of schools")
+	sampleSeed      = flag.Uint64("sample-seed", 1, "gen-sample: random seed")
+)
+
+var sampleZones = []string{"Shahdara North", "Narela", "Shahdara South", "Najafgarh", "West", "Central",
+	"Rohini", "South", "Civil Lines", "Keshavpuram", "Karol Bagh", "City-SP"}
+
+var sampleLocalities = []string{"ASHOK VIHAR", "BADARPUR", "BAWANA", "BHALSWA", "BURARI", "CHHATARPUR",
+	"DWARKA", "GHONDA", "HARI NAGAR", "JAHANGIRPURI", "JANAKPURI", "KAROL BAGH", "KHAJURI", "KIRARI",
+	"LAJPAT NAGAR", "MANGOLPURI", "MEHRAULI", "MUNDKA", "NANGLOI", "NARELA", "PALAM", "PATPARGANJ",
+	"PREM NAGAR", "RAJOURI GARDEN", "ROHINI", "SANGAM VIHAR", "SEELAMPUR", "SHAKURPUR", "SULTANPURI",
+	"TIMARPUR", "TRILOKPURI", "UTTAM NAGAR", "VIKASPURI", "WAZIRPUR", "YAMUNA VIHAR"}
+
+var (
+	sampleFemale  = []string{"ANITA", "ANJALI", "ARTI", "ASHA", "DEEPA", "GEETA", "KAVITA", "KIRAN", "MAMTA", "MEENA", "MONIKA", "NEHA", "NEETU", "NISHA", "POOJA", "PREETI", "PRIYA", "RAJNI", "REKHA", "RITU", "SARITA", "SEEMA", "SHALINI", "SONIA", "SUMAN", "SUNITA", "USHA", "VANDANA"}
+	sampleMale    = []string{"AJAY", "AMIT", "ANIL", "ASHOK", "DEEPAK", "DINESH", "GAURAV", "HARISH", "MANOJ", "MUKESH", "NARESH", "PANKAJ", "PRADEEP", "RAJESH", "RAKESH", "RAMESH", "RAVI", "SANJAY", "SATISH", "SUNIL", "SURESH", "VIJAY", "VINOD", "YOGESH"}
+	sampleSurname = []string{"AGARWAL", "BANSAL", "CHAUHAN", "GARG", "GUPTA", "JAIN", "KHAN", "KUMAR", "KUMARI", "MALIK", "MEENA", "MISHRA", "PANDEY", "RANA", "RAWAT", "SAINI", "SHARMA", "SINGH", "TOMAR", "TYAGI", "VERMA", "YADAV"}
+)
+
+type sampleDesig struct {
+	name   string
+	weight int
+	level  int
+}
+
+// sampleDesignations are the non-principal posts by weight (per mille of
+// the real staff), with their pay level.
+var sampleDesignations = []sampleDesig{
+	{"Teacher (Primary)", 640, 6}, {"Sweeper", 71, 1}, {"Special Educator", 65, 7}, {"Chowkidar", 50, 1},
+	{"School Attendant", 38, 1}, {"Teacher (Nursery)", 32, 6}, {"Nursery Aaya", 21, 1}, {"Teacher (STC)", 19, 0},
+	{"Teacher (Urdu)", 10, 6}, {"Counsellor", 4, 0}, {"Teacher (Music)", 2, 7}, {"Teacher (Physical)", 2, 7},
+	{"Teacher (Art/Drawing)", 1, 7},
+}
+
+// samplePick returns one of choices by weight.
+func samplePick[T any](r *rand.Rand, choices []T, weight func(T) int) T {
+	total := 0
+	for _, c := range choices {
+		total += weight(c)
+	}
+	n := r.IntN(total)
+	for _, c := range choices {
+		if n -= weight(c); n < 0 {
+			return c
+		}
+	}
+	return choices[len(choices)-1]
+}
+
+type weighted struct {
+	v string
+	w int
+}
+
+func samplePickW(r *rand.Rand, choices []weighted) string {
+	return samplePick(r, choices, func(c weighted) int { return c.w }).v
+}
+
+var (
+	sampleMarital   = []weighted{{"Married", 879}, {"Unmarried", 82}, {"Widow/Widower", 31}, {"Divorced", 6}, {"Separated", 2}}
+	sampleReligion  = []weighted{{"Hinduism", 939}, {"Islam", 41}, {"Sikhism", 7}, {"Jainism", 6}, {"Christianity", 5}, {"Buddhism", 2}}
+	sampleCategory  = []weighted{{"UR", 380}, {"OBC", 290}, {"SC", 250}, {"ST", 70}, {"EWS", 10}}
+	samplePension   = []weighted{{"NPS", 550}, {"GPF", 245}, {"N/A", 175}, {"EPF", 30}}
+	sampleTransfer  = []weighted{{"Not Applicable", 466}, {"By Choice", 398}, {"Administrative-Routine", 91}, {"Other", 32}, {"Administrative-Surplus", 13}}
+	sampleAgency    = []weighted{{"DSSSB", 590}, {"MCD-Edn", 270}, {"SSA", 70}, {"SSC", 35}, {"Direct", 35}}
+	sampleApptType  = []weighted{{"Regular", 800}, {"Contract (SSA)", 80}, {"Contract (MCD)", 50}, {"Daily Wager (26/30 days)", 40}, {"Contract (STC)", 30}}
+	samplePayByLvl  = map[int]int{0: 0, 1: 18000, 6: 35400, 7: 44900, 8: 47600}
+	sampleDateShape = "02/Jan/2006"
+)
+
+type sampleSchool struct {
+	id, zone, name, locality string
+	size                     int // relative staff size
+	staff                    int
+}
+
+// SampleFiles are the files gen-sample wrote.
+type SampleFiles struct {
+	Basic, Services, DBT string
+	Employees, Schools   int
+}
+
+// genSample writes employees and schools of synthetic data into dir.
+func genSample(dir string, employees, schools int, seed uint64, now time.Time) (SampleFiles, error) {
+	if employees < 1 || schools < 1 {
+		return SampleFiles{}, fmt.Errorf("want at least one employee and one school")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return SampleFiles{}, err
+	}
+	r := rand.New(rand.NewPCG(seed, seed^0x5eed))
+	out := SampleFiles{Basic: filepath.Join(dir, "Basic.csv"), Services: filepath.Join(dir, "Services.csv"),
+		DBT: filepath.Join(dir, "Dashboard_Summary.csv"), Employees: employees, Schools: schools}
+
+	// Schools spread over the zones, named after a locality and numbered
+	// per zone like the portal's ids.
+	sch := make([]*sampleSchool, schools)
+	perZone := map[string]int{}
+	for i := range sch {
+		zone := sampleZones[i%len(sampleZones)]
+		if i >= len(sampleZones) {
+			zone = sampleZones[r.IntN(len(sampleZones))]
+		}
+		perZone[zone]++
+		zi := 0
+		for j, z := range sampleZones {
+			if z == zone {
+				zi = j
+			}
+		}
+		loc := sampleLocalities[r.IntN(len(sampleLocalities))]
+		kind := []string{"BOYS", "GIRLS", "CO-ED", "CO-ED"}[r.IntN(4)]
+		id := fmt.Sprintf("1%02d%04d", 10+zi, perZone[zone])
+		name := loc
+		if n := r.IntN(4); n > 0 {
+			name += fmt.Sprintf(" PHASE %d", n)
+		}
+		name += " (" + kind + ")"
+		sch[i] = &sampleSchool{id: id, zone: zone, locality: loc, name: name, size: 5 + r.IntN(30)}
+	}
+
+	basicRows := make([][]string, 0, employees)
+	svcRows := make([][]string, 0, employees)
+	empIDs := r.Perm(employees * 3)
+	for i := 0; i < employees; i++ {
+		// Principals first, one for most schools; then staff by school size.
+		var s *sampleSchool
+		desig, level := "", 0
+		if i < schools && r.IntN(100) < 95 {
+			s, desig, level = sch[i], "Principal", 8
+		} else {
+			s = samplePick(r, sch, func(s *sampleSchool) int { return s.size })
+			d := samplePick(r, sampleDesignations, func(d sampleDesig) int { return d.weight })
+			desig, level = d.name, d.level
+			if level == 6 && r.IntN(3) == 0 {
+				level = 7
+			}
+		}
+		s.staff++
+
+		female := r.IntN(100) < 61
+		first := sampleMale[r.IntN(len(sampleMale))]
+		gender := "Male"
+		if female {
+			first, gender = sampleFemale[r.IntN(len(sampleFemale))], "Female"
+		}
+		surname := sampleSurname[r.IntN(len(sampleSurname))]
+		name := first + " " + surname
+		id := strconv.Itoa(70000000 + empIDs[i])
+		age := 24 + r.IntN(36)
+		if desig == "Principal" {
+			age = 45 + r.IntN(15)
+		}
+		dob := now.AddDate(-age, -r.IntN(12), -r.IntN(28))
+		doj := dob.AddDate(22+r.IntN(max(1, age-23)), r.IntN(12), r.IntN(28))
+		if doj.After(now) {
+			doj = now.AddDate(0, -1, 0)
+		}
+		appt := doj.AddDate(0, 0, -2-r.IntN(20))
+		marital := samplePickW(r, sampleMarital)
+		if age < 28 && r.IntN(2) == 0 {
+			marital = "Unmarried"
+		}
+		spouse := "N/A"
+		if marital == "Married" {
+			if female {
+				spouse = sampleMale[r.IntN(len(sampleMale))] + " " + surname
+			} else {
+				spouse = sampleFemale[r.IntN(len(sampleFemale))] + " " + surname
+			}
+		}
+		mobile := fmt.Sprintf("9%09d", r.IntN(1e9))
+		email := fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(first), strings.ToLower(surname), r.IntN(1000))
+		if r.IntN(1000) < 15 {
+			email = ""
+		}
+		addr := fmt.Sprintf("H NO %d %s DELHI 1100%02d", 1+r.IntN(900), s.locality, 10+r.IntN(90))
+		father := sampleMale[r.IntN(len(sampleMale))] + " " + surname
+		mother := sampleFemale[r.IntN(len(sampleFemale))] + " DEVI"
+		class := "Not Applicable - No Data!"
+		if strings.HasPrefix(desig, "Teacher") {
+			class = fmt.Sprintf("Class %s - %c", []string{"I", "II", "III", "IV", "V"}[r.IntN(5)], 'A'+r.IntN(3))
+		}
+		pension := samplePickW(r, samplePension)
+		if doj.Year() >= 2004 && pension == "GPF" {
+			pension = "NPS"
+		}
+		category := samplePickW(r, sampleCategory)
+		transfer := samplePickW(r, sampleTransfer)
+		transferDate, present, previous := "", doj.Format(sampleDateShape), "N/A"
+		if transfer != "Not Applicable" {
+			td := doj.AddDate(1+r.IntN(max(1, now.Year()-doj.Year())), 0, 0)
+			if td.After(now) {
+				td = now.AddDate(0, -2, 0)
+			}
+			transferDate, present = td.Format(sampleDateShape), td.AddDate(0, 0, 3+r.IntN(20)).Format(sampleDateShape)
+			p := sch[r.IntN(len(sch))]
+			previous = p.name + " (" + p.id + ")"
+		}
+
+		basicRows = append(basicRows, []string{
+			strconv.Itoa(i + 1), s.zone, s.name + "-" + s.id, id, strconv.Itoa(doj.Year()*1000000 + r.IntN(1000000)), name,
+			dob.Format(sampleDateShape), gender, father, mother, desig, marital, spouse, mobile,
+			email, fmt.Sprintf("XYZ%07d", r.IntN(1e7)), addr, addr, "DELHI", "Rental-Self",
+			father + " - FATHER", fmt.Sprintf("9%09d", r.IntN(1e9)), addr, "Not Applicable", samplePickW(r, sampleReligion), pension,
+			"N/A", fmt.Sprintf("XXXPX%04dX", r.IntN(1e4)), "WhatsApp", mobile, "Graduation", "N/A", class, "N/A,N/A",
+			strconv.Itoa(level), strconv.Itoa(samplePayByLvl[level]), "Not Applicable", "Not Applicable", "Not Applicable", "Active",
+		})
+		svcRows = append(svcRows, []string{
+			strconv.Itoa(i + 1), s.zone, s.name + "-" + s.id, id, name,
+			dob.Format(sampleDateShape), gender, desig, category, category, fmt.Sprintf("SAMPLE/APPT/%d/%d", appt.Year(), 1+r.IntN(999)),
+			appt.Format(sampleDateShape), samplePickW(r, sampleAgency), samplePickW(r, sampleApptType), "Regular", doj.Format(sampleDateShape),
+			"N/A", "Graduation", "N/A",
+			"N/A", "N/A", "N/A",
+			"N/A", "N/A", "Not Applicable", "N/A",
+			transferDate, transfer, present, previous,
+			"No", "N/A", "N/A", "N/A",
+			"N/A", "N/A", "N/A",
+			"N/A", "Active",
+		})
+	}
+
+	// Enrolment follows the staff, at 25-45 pupils a head.
+	dbtRows := make([][]string, 0, schools)
+	dataDate := now.AddDate(0, 0, -1).Format("2006-01-02")
+	for i, s := range sch {
+		enrol := max(30, s.staff*(25+r.IntN(20)))
+		maxEnrol := enrol + r.IntN(enrol/10+1)
+		present := enrol * (80 + r.IntN(15)) / 100
+		withAcc := enrol * (70 + r.IntN(25)) / 100
+		withAadhaar := enrol * (85 + r.IntN(14)) / 100
+		linked := min(withAcc, withAadhaar)
+		dbtRows = append(dbtRows, []string{
+			s.zone, strconv.Itoa(1 + r.IntN(250)), fmt.Sprintf("0701%07d", 1000000+i), s.name + "-" + s.id,
+			sampleMale[r.IntN(len(sampleMale))] + " " + sampleSurname[r.IntN(len(sampleSurname))],
+			dataDate, strconv.Itoa(enrol), strconv.Itoa(maxEnrol), dataDate, strconv.Itoa(present), dataDate,
+			strconv.Itoa(withAcc), strconv.Itoa(enrol - withAcc), strconv.Itoa(withAadhaar), strconv.Itoa(enrol - withAadhaar),
+			strconv.Itoa(linked), strconv.Itoa(r.IntN(15)), strconv.Itoa(r.IntN(enrol/5 + 1)),
+			strconv.Itoa(linked * r.IntN(60) / 100), strconv.Itoa(r.IntN(10)), strconv.Itoa(linked * r.IntN(60) / 100),
+		})
+	}
+
+	for _, f := range []struct {
+		path   string
+		header []string
+		rows   [][]string
+	}{{out.Basic, ingest.BasicSchema.Columns, basicRows}, {out.Services, ingest.ServicesSchema.Columns, svcRows}, {out.DBT, ingest.DBTSchema.Columns, dbtRows}} {
+		if err := writeSampleCSV(f.path, f.header, f.rows); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func writeSampleCSV(path string, header []string, rows [][]string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(header)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func cmdGenSample([]string) error {
+	args := flag.Args()
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gen-sample [-sample-employees N] [-sample-schools N] [-sample-seed N] <dir>")
+	}
+	out, err := genSample(args[0], *sampleEmployees, *sampleSchools, *sampleSeed, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d employees in %d schools written to %s, %s and %s\n", out.Employees, out.Schools, out.Basic, out.Services, out.DBT)
+	fmt.Printf("try: %s -sandbox -basic %s -services %s -dbt %s\n", filepath.Base(os.Args[0]), out.Basic, out.Services, out.DBT)
+	return nil
+}
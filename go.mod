@@ -1,3 +1,12 @@
 module myproject
 
 go 1.23.2
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.33.0
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
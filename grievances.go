@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Grievance tickets ----
+//
+// Data and service grievances are tickets assigned to a zone. Employees file
+// and follow their own through a signed self-service link (/grievance?e=&sig=,
+// signed with the same key as /prefs); establishment staff file on someone's
+// behalf, reassign and move tickets along via the API. The employee (if they
+// accept email) and the zone's mailbox (its sender address, see senders.go)
+// are mailed on filing and on every change.
+//
+//	POST /api/grievances          {"emp_id": "...", "category": "data", "subject": "...", "detail": "..."}
+//	POST /api/grievances/update   {"id": "G00012", "status": "in_progress", "zone": "SOUTH", "assignee": "...", "note": "..."}
+//	GET  /api/grievances[?zone=][&status=][&emp=][&category=]
+//	GET  /api/grievances/report   (per zone: status counts and ageing of open tickets)
+
+var grievancesFile = flag.String("grievances", "./out/grievances.json", "Grievance tickets (managed via /api/grievances and the self-service link)")
+
+const (
+	ticketOpen       = "open"
+	ticketInProgress = "in_progress"
+	ticketResolved   = "resolved"
+	ticketRejected   = "rejected"
+)
+
+var ticketStatuses = []string{ticketOpen, ticketInProgress, ticketResolved, ticketRejected}
+
+// grievanceCategories are offered on the self-service page.
+var grievanceCategories = [][2]string{
+	{"data", "My record on the dashboard is wrong"},
+	{"service", "Service matter (pay, posting, leave, promotion)"},
+	{"other", "Something else"},
+}
+
+// ageingBuckets are upper bounds in days for the ageing of open tickets.
+var ageingBuckets = []struct {
+	Label string
+	Max   int
+}{{"0-7", 7}, {"8-15", 15}, {"16-30", 30}, {">30", 1 << 30}}
+
+type TicketEvent struct {
+	At     time.Time `json:"at"`
+	By     string    `json:"by"`
+	Status string    `json:"status,omitempty"`
+	Zone   string    `json:"zone,omitempty"`
+	Note   string    `json:"note,omitempty"`
+}
+
+type Ticket struct {
+	ID       string        `json:"id"`
+	EmpID    string        `json:"emp_id"`
+	Name     string        `json:"name"`
+	Zone     string        `json:"zone"`
+	Category string        `json:"category"`
+	Subject  string        `json:"subject"`
+	Detail   string        `json:"detail,omitempty"`
+	Status   string        `json:"status"`
+	Assignee string        `json:"assignee,omitempty"`
+	Source   string        `json:"source"` // "self" or the staff user
+	Created  time.Time     `json:"created"`
+	Updated  time.Time     `json:"updated"`
+	Closed   *time.Time    `json:"closed,omitempty"`
+	Events   []TicketEvent `json:"events"`
+}
+
+func (tk Ticket) isOpen() bool { return tk.Status == ticketOpen || tk.Status == ticketInProgress }
+
+// ageDays is how long the ticket has been (or was) open.
+func (tk Ticket) ageDays(now time.Time) int {
+	end := now
+	if tk.Closed != nil {
+		end = *tk.Closed
+	}
+	return int(end.Sub(tk.Created).Hours() / 24)
+}
+
+type ticketDesk struct {
+	mu      sync.Mutex
+	path    string
+	Next    int      `json:"next"`
+	Tickets []Ticket `json:"tickets"`
+}
+
+var (
+	ticketDesksMu sync.Mutex
+	ticketDesks   = map[string]*ticketDesk{} // by tenant id
+)
+
+// grievances returns the tenant's tickets, loading them on first use.
+func (t *Tenant) grievances() *ticketDesk {
+	ticketDesksMu.Lock()
+	defer ticketDesksMu.Unlock()
+	if d, ok := ticketDesks[t.ID]; ok {
+		return d
+	}
+	d := &ticketDesk{path: t.Grievances, Next: 1}
+	if b, err := os.ReadFile(t.Grievances); err == nil {
+		if err := json.Unmarshal(b, d); err != nil {
+			log.Printf("grievances %s: %v", t.Grievances, err)
+		}
+	}
+	ticketDesks[t.ID] = d
+	return d
+}
+
+func (d *ticketDesk) save() error {
+	if d.path == "" {
+		return fmt.Errorf("no grievances file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(d.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(d.path+".tmp", d.path)
+}
+
+func (d *ticketDesk) Create(tk Ticket) (Ticket, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	tk.ID = fmt.Sprintf("G%05d", d.Next)
+	tk.Status, tk.Created, tk.Updated = ticketOpen, now, now
+	tk.Events = []TicketEvent{{At: now, By: tk.Source, Status: ticketOpen, Zone: tk.Zone, Note: "filed"}}
+	d.Next++
+	d.Tickets = append(d.Tickets, tk)
+	return tk, d.save()
+}
+
+// Update applies ev (a status change, reassignment and/or note) to ticket
+// id and returns the ticket before and after.
+func (d *ticketDesk) Update(id string, ev TicketEvent, assignee string) (before, after Ticket, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.Tickets {
+		tk := &d.Tickets[i]
+		if tk.ID != id {
+			continue
+		}
+		before = *tk
+		before.Events = append([]TicketEvent(nil), tk.Events...)
+		if ev.Status == tk.Status {
+			ev.Status = ""
+		}
+		if ev.Zone == tk.Zone {
+			ev.Zone = ""
+		}
+		if ev.Status == "" && ev.Zone == "" && ev.Note == "" && assignee == "" {
+			return before, before, errNothingToChange
+		}
+		if ev.Status != "" {
+			tk.Status = ev.Status
+			tk.Closed = nil
+			if !tk.isOpen() {
+				at := ev.At
+				tk.Closed = &at
+			}
+		}
+		if ev.Zone != "" {
+			tk.Zone = ev.Zone
+		}
+		if assignee != "" {
+			tk.Assignee = assignee
+		}
+		tk.Updated = ev.At
+		tk.Events = append(tk.Events, ev)
+		return before, *tk, d.save()
+	}
+	return before, after, errNoTicket
+}
+
+var (
+	errNoTicket        = fmt.Errorf("no such ticket")
+	errNothingToChange = fmt.Errorf("nothing to change")
+)
+
+func (d *ticketDesk) List() []Ticket {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := append([]Ticket(nil), d.Tickets...)
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out
+}
+
+// grievanceLink is the employee's self-service URL, absolute when
+// -public-url is set.
+func (t *Tenant) grievanceLink(id string) string {
+	s := t.prefs()
+	if len(s.key) == 0 {
+		return ""
+	}
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/grievance?e=" + url.QueryEscape(id) + "&sig=" + s.signFor("grievance", id)
+}
+
+// zoneMailbox is where a zone's grievance notices go: its own sender
+// address when configured, else HQ's.
+func (t *Tenant) zoneMailbox(zone string) string {
+	s := t.senderFor(zone)
+	if s.ReplyTo != "" {
+		return s.ReplyTo
+	}
+	return s.From
+}
+
+// notifyTicket mails the employee and the zone about what happened to tk;
+// prev is the ticket before the change (zero when newly filed). Sends run in
+// the background.
+func notifyTicket(t *Tenant, tk, prev Ticket) {
+	esc := html.EscapeString
+	what := "has been registered"
+	switch {
+	case prev.ID == "":
+	case tk.Status != prev.Status:
+		what = "is now " + strings.ReplaceAll(tk.Status, "_", " ")
+	case tk.Zone != prev.Zone:
+		what = "has been passed to zone " + tk.Zone
+	default:
+		what = "has been updated"
+	}
+	note := ""
+	if n := len(tk.Events); n > 0 && tk.Events[n-1].Note != "" && prev.ID != "" {
+		note = "<p><b>Note:</b> " + esc(tk.Events[n-1].Note) + "</p>"
+	}
+	subject := fmt.Sprintf("Grievance %s %s", tk.ID, what)
+	body := fmt.Sprintf(`<p>Grievance <b>%s</b> (%s) %s.</p><p><b>Subject:</b> %s</p>%s`,
+		esc(tk.ID), esc(tk.Category), esc(what), esc(tk.Subject), note)
+	e := t.Data().EMP[tk.EmpID]
+	type mail struct{ to, body string }
+	var mails []mail
+	if e.Email != "" && t.prefs().Allows(tk.EmpID, channelEmail) {
+		b := "<p>Dear " + esc(e.Name) + ",</p>" + body
+		if link := t.grievanceLink(tk.EmpID); link != "" {
+			b += `<p>Follow your grievances at <a href="` + esc(link) + `">` + esc(link) + `</a>.</p>`
+		}
+		mails = append(mails, mail{e.Email, b})
+	}
+	if box := t.zoneMailbox(tk.Zone); box != "" {
+		mails = append(mails, mail{box, fmt.Sprintf(`<p>Zone %s: grievance from %s (%s).</p>`, esc(tk.Zone), esc(tk.Name), esc(tk.EmpID)) + body +
+			"<p>" + esc(tk.Detail) + "</p>"})
+	}
+	from := t.senderFor(tk.Zone)
+	for _, m := range mails {
+		if err := queueMail(t, "", from, "", m.to, subject, m.body); err != nil {
+			log.Printf("grievance %s mail to %s: %v", tk.ID, m.to, err)
+		}
+	}
+}
+
+func validTicketCategory(c string) bool {
+	for _, gc := range grievanceCategories {
+		if gc[0] == c {
+			return true
+		}
+	}
+	return false
+}
+
+// fileGrievance checks and files a ticket for employee id.
+func fileGrievance(t *Tenant, id, category, subject, detail, zone, source string) (Ticket, error) {
+	e, ok := t.Data().EMP[id]
+	if !ok {
+		return Ticket{}, fmt.Errorf("employee %s not found", id)
+	}
+	category, subject, detail = strings.ToLower(strings.TrimSpace(category)), strings.TrimSpace(subject), strings.TrimSpace(detail)
+	switch {
+	case !validTicketCategory(category):
+		return Ticket{}, fmt.Errorf("unknown category %q", category)
+	case subject == "":
+		return Ticket{}, fmt.Errorf("subject is required")
+	case len(subject) > 200 || len(detail) > 4000:
+		return Ticket{}, fmt.Errorf("subject or detail too long")
+	}
+	if zone = strings.ToUpper(strings.TrimSpace(zone)); zone == "" {
+		zone = e.Zone
+	}
+	tk, err := t.grievances().Create(Ticket{EmpID: id, Name: e.Name, Zone: zone, Category: category,
+		Subject: subject, Detail: detail, Source: source})
+	if err != nil {
+		return tk, err
+	}
+	log.Printf("📮 Grievance %s filed for %s (%s) by %s", tk.ID, id, zone, source)
+	notifyTicket(t, tk, Ticket{})
+	return tk, nil
+}
+
+// GET/POST /grievance?e=&sig= (public; the self-service page)
+func handleGrievancePage(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	id, sig := ingest.NormalizeEmpID(r.FormValue("e")), r.FormValue("sig")
+	e, ok := t.Data().EMP[id]
+	if !t.prefs().verifyFor("grievance", id, sig) || !ok {
+		http.Error(w, "This link is not valid.", http.StatusForbidden)
+		return
+	}
+	esc := html.EscapeString
+	msg := ""
+	if r.Method == http.MethodPost {
+		tk, err := fileGrievance(t, id, r.FormValue("category"), r.FormValue("subject"), r.FormValue("detail"), "", "self")
+		if err != nil {
+			msg = `<p style="color:#f87171">` + esc(err.Error()) + `</p>`
+		} else {
+			msg = `<p style="color:#4ade80">Registered as ` + esc(tk.ID) + `. You will be mailed when it moves.</p>`
+		}
+	}
+	var rows strings.Builder
+	for _, tk := range t.grievances().List() {
+		if tk.EmpID != id {
+			continue
+		}
+		last := tk.Events[len(tk.Events)-1]
+		fmt.Fprintf(&rows, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`, esc(tk.ID), tk.Created.Format("02 Jan 2006"),
+			esc(tk.Subject), esc(strings.ReplaceAll(tk.Status, "_", " ")), esc(last.Note))
+	}
+	table := "<p>No grievances filed yet.</p>"
+	if rows.Len() > 0 {
+		table = `<table><tr><th>No.</th><th>Filed</th><th>Subject</th><th>Status</th><th>Last note</th></tr>` + rows.String() + `</table>`
+	}
+	var cats strings.Builder
+	for _, c := range grievanceCategories {
+		fmt.Fprintf(&cats, `<option value="%s">%s</option>`, c[0], esc(c[1]))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Grievances – %s</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>input,select,textarea,button{width:100%%;box-sizing:border-box;margin:6px 0;padding:8px;border-radius:6px;border:1px solid #334155}
+table{width:100%%;border-collapse:collapse;font-size:14px}td,th{border-bottom:1px solid #334155;padding:6px;text-align:left}</style></head>
+<body style="font-family:system-ui;background:#0d1b2a;color:#f1f5f9;max-width:640px;margin:40px auto;padding:0 12px">
+<h1>Grievances</h1><p>%s (%s), zone %s</p>%s
+<form method="post"><input type="hidden" name="e" value="%s"><input type="hidden" name="sig" value="%s">
+<select name="category">%s</select><input name="subject" maxlength="200" placeholder="Subject" required>
+<textarea name="detail" rows="5" maxlength="4000" placeholder="Details"></textarea><button>File grievance</button></form>
+<h2>Your grievances</h2>%s</body></html>`, esc(t.PageTitle()), esc(e.Name), esc(id), esc(e.Zone), msg, esc(id), esc(sig),
+		cats.String(), table)
+}
+
+// GET/POST /api/grievances
+func handleGrievances(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		zone, status, emp, cat := strings.ToUpper(q.Get("zone")), q.Get("status"), ingest.NormalizeEmpID(q.Get("emp")), q.Get("category")
+		out := []Ticket{}
+		for _, tk := range t.grievances().List() {
+			if (zone == "" || tk.Zone == zone) && (status == "" || tk.Status == status || (status == "active" && tk.isOpen())) &&
+				(emp == "" || tk.EmpID == emp) && (cat == "" || tk.Category == cat) {
+				out = append(out, tk)
+			}
+		}
+		page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+		items, meta := paginate(out, page, per)
+		writeData(w, items, meta)
+	case http.MethodPost:
+		var req struct {
+			EmpID    string `json:"emp_id"`
+			Category string `json:"category"`
+			Subject  string `json:"subject"`
+			Detail   string `json:"detail"`
+			Zone     string `json:"zone"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a grievance: "+err.Error())
+			return
+		}
+		if req.Zone != "" {
+			if _, ok := dataFor(r).ZONE_KPI[strings.ToUpper(req.Zone)]; !ok || strings.EqualFold(req.Zone, allZones) {
+				writeError(w, 400, errBadRequest, "unknown zone "+req.Zone)
+				return
+			}
+		}
+		tk, err := fileGrievance(t, ingest.NormalizeEmpID(req.EmpID), req.Category, req.Subject, req.Detail, req.Zone, userFor(r).Name)
+		if err != nil {
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		writeData(w, tk, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+// POST /api/grievances/update
+func handleGrievanceUpdate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	var req struct {
+		ID       string `json:"id"`
+		Status   string `json:"status"`
+		Zone     string `json:"zone"`
+		Assignee string `json:"assignee"`
+		Note     string `json:"note"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		writeError(w, 400, errBadRequest, "body must be a ticket update: "+err.Error())
+		return
+	}
+	t := tenantFor(r)
+	ev := TicketEvent{At: time.Now(), By: userFor(r).Name, Status: req.Status, Zone: strings.ToUpper(strings.TrimSpace(req.Zone)), Note: strings.TrimSpace(req.Note)}
+	if ev.Status != "" {
+		known := false
+		for _, s := range ticketStatuses {
+			known = known || s == ev.Status
+		}
+		if !known {
+			writeError(w, 400, errBadRequest, "status must be one of "+strings.Join(ticketStatuses, ", "))
+			return
+		}
+	}
+	if ev.Zone != "" {
+		if _, ok := dataFor(r).ZONE_KPI[ev.Zone]; !ok || ev.Zone == allZones {
+			writeError(w, 400, errBadRequest, "unknown zone "+req.Zone)
+			return
+		}
+	}
+	prev, tk, err := t.grievances().Update(strings.ToUpper(strings.TrimSpace(req.ID)), ev, strings.TrimSpace(req.Assignee))
+	switch {
+	case err == errNoTicket:
+		writeError(w, 404, errNotFound, "ticket "+req.ID+" not found")
+		return
+	case err == errNothingToChange:
+		writeError(w, 400, errBadRequest, "give a status, zone, assignee or note")
+		return
+	case err != nil:
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("📮 Grievance %s updated by %s: status=%s zone=%s", tk.ID, ev.By, tk.Status, tk.Zone)
+	if tk.Status != prev.Status || tk.Zone != prev.Zone || ev.Note != "" {
+		notifyTicket(t, tk, prev)
+	}
+	writeData(w, tk, nil)
+}
+
+type GrievanceZoneRow struct {
+	Zone     string         `json:"zone"`
+	Total    int            `json:"total"`
+	Statuses map[string]int `json:"statuses"`
+	Ageing   map[string]int `json:"ageing"` // open tickets by days since filing
+	Oldest   int            `json:"oldest_open_days"`
+}
+
+func grievanceReport(tickets []Ticket, now time.Time) []GrievanceZoneRow {
+	byZone := map[string]*GrievanceZoneRow{}
+	row := func(z string) *GrievanceZoneRow {
+		if byZone[z] == nil {
+			g := &GrievanceZoneRow{Zone: z, Statuses: map[string]int{}, Ageing: map[string]int{}}
+			for _, s := range ticketStatuses {
+				g.Statuses[s] = 0
+			}
+			for _, b := range ageingBuckets {
+				g.Ageing[b.Label] = 0
+			}
+			byZone[z] = g
+		}
+		return byZone[z]
+	}
+	row(allZones)
+	for _, tk := range tickets {
+		for _, g := range []*GrievanceZoneRow{row(tk.Zone), row(allZones)} {
+			g.Total++
+			g.Statuses[tk.Status]++
+			if !tk.isOpen() {
+				continue
+			}
+			age := tk.ageDays(now)
+			for _, b := range ageingBuckets {
+				if age <= b.Max {
+					g.Ageing[b.Label]++
+					break
+				}
+			}
+			if age > g.Oldest {
+				g.Oldest = age
+			}
+		}
+	}
+	out := make([]GrievanceZoneRow, 0, len(byZone))
+	for z, g := range byZone {
+		if z != allZones {
+			out = append(out, *g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Zone < out[j].Zone })
+	return append(out, *byZone[allZones])
+}
+
+// GET /api/grievances/report
+func handleGrievanceReport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	rows := grievanceReport(tenantFor(r).grievances().List(), time.Now())
+	writeData(w, rows, &Meta{Count: len(rows)})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ---- Health checks ----
+//
+// For running behind a load balancer. Both endpoints sit outside the
+// tenants' prefixes and need no login:
+//
+//	GET /healthz   whether each tenant's data is loaded, its row counts and
+//	               the last failed rebuild, if any; 503 if a tenant has none
+//	GET /readyz    200 only once every tenant's dashboard page renders, and
+//	               503 from the moment the server starts shutting down
+//
+// SIGINT or SIGTERM stop the server gracefully: it stops accepting
+// connections and gives requests in flight up to -shutdown-timeout to
+// finish.
+
+var shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "How long to let requests in flight finish when stopping")
+
+// draining is set once shutdown has begun.
+var draining atomic.Bool
+
+// buildFailure is a tenant's last failed rebuild, cleared by the next good
+// one.
+type buildFailure struct {
+	At    time.Time `json:"at"`
+	Error string    `json:"error"`
+}
+
+type TenantHealth struct {
+	Tenant      string        `json:"tenant"`
+	Loaded      bool          `json:"loaded"`
+	BuiltAt     time.Time     `json:"built_at,omitempty"`
+	Profile     string        `json:"profile,omitempty"`
+	Employees   int           `json:"employees"`
+	Schools     int           `json:"schools"`
+	LastFailure *buildFailure `json:"last_failure,omitempty"`
+}
+
+func mountHealth(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+}
+
+// GET /healthz
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	status, out := http.StatusOK, make([]TenantHealth, 0, len(TENANTS))
+	for _, t := range TENANTS {
+		h := TenantHealth{Tenant: t.ID, LastFailure: t.failed.Load()}
+		if ds := t.Data(); ds != nil {
+			h.Loaded, h.BuiltAt, h.Profile = true, ds.BuiltAt, ds.Profile
+			h.Employees, h.Schools = len(ds.EMP), len(ds.SCH)
+		} else {
+			status = http.StatusServiceUnavailable
+		}
+		out = append(out, h)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, Envelope{Data: out, Meta: &Meta{Count: len(out)}})
+}
+
+// GET /readyz
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if draining.Load() {
+		writeError(w, http.StatusServiceUnavailable, errUnavailable, "shutting down")
+		return
+	}
+	for _, t := range TENANTS {
+		ds := t.Data()
+		if ds == nil {
+			writeError(w, http.StatusServiceUnavailable, errUnavailable, "tenant "+t.ID+": data not loaded")
+			return
+		}
+		if _, err := renderPage(t, ds); err != nil {
+			writeError(w, http.StatusServiceUnavailable, errUnavailable, "tenant "+t.ID+": page template: "+err.Error())
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ready\n")
+}
+
+// shutdownOnSignal shuts srv down on SIGINT or SIGTERM. The returned
+// channel closes once it has, so the caller can wait for requests in
+// flight after ListenAndServe returns.
+func shutdownOnSignal(srv *http.Server) <-chan struct{} {
+	done := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		signal.Stop(sig) // a second signal kills the process outright
+		draining.Store(true)
+		log.Printf("🛑 %v: shutting down (waiting up to %s for requests in flight)", s, *shutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Employee change history ----
+//
+// After every build the tracked fields of each employee are compared with
+// the previous build and each difference is appended to history.jsonl (one
+// JSON entry per line, never rewritten). state.json holds the last seen
+// values. The very first build only records the baseline.
+
+var historyDir = flag.String("history", "./out/history", "Directory for the append-only employee change history (empty = off)")
+
+// historyFields are the derived-record fields worth a service-book line.
+var historyFields = []struct {
+	name string
+	get  func(Emp) string
+}{
+	{"zone", func(e Emp) string { return e.Zone }},
+	{"designation", func(e Emp) string { return e.Designation }},
+	{"school_id", func(e Emp) string { return e.SchoolID }},
+	{"status", func(e Emp) string { return e.Status }},
+	{"promotion_date", func(e Emp) string { return e.PromotionDate }},
+	{"transfer_date", func(e Emp) string { return e.TransferDate }},
+}
+
+// historyRecord is the pseudo-field for an employee appearing or vanishing.
+const historyRecord = "record"
+
+type HistoryEntry struct {
+	EmpID   string    `json:"emp_id"`
+	At      time.Time `json:"at"`
+	Field   string    `json:"field"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Profile string    `json:"profile,omitempty"`
+}
+
+type empHistory struct {
+	mu    sync.RWMutex
+	dir   string
+	last  map[string]map[string]string // emp id -> field -> value
+	byEmp map[string][]HistoryEntry
+}
+
+func openHistory(dir string) *empHistory {
+	h := &empHistory{dir: dir, byEmp: map[string][]HistoryEntry{}}
+	if b, err := os.ReadFile(filepath.Join(dir, "state.json")); err == nil {
+		if err := json.Unmarshal(b, &h.last); err != nil {
+			log.Printf("history state: %v", err)
+		}
+	}
+	f, err := os.Open(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e HistoryEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			h.byEmp[e.EmpID] = append(h.byEmp[e.EmpID], e)
+		}
+	}
+	return h
+}
+
+func trackedValues(e Emp) map[string]string {
+	m := make(map[string]string, len(historyFields))
+	for _, f := range historyFields {
+		m[f.name] = f.get(e)
+	}
+	return m
+}
+
+// record diffs ds against the previous build, appends the changes and
+// returns them; nothing is returned for the baseline or when the append
+// failed (the same changes come round again next build).
+func (h *empHistory) record(ds *Dataset) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := ds.BuiltAt
+	cur := make(map[string]map[string]string, len(ds.EMP))
+	for id, e := range ds.EMP {
+		cur[id] = trackedValues(e)
+	}
+	baseline := h.last == nil
+	var entries []HistoryEntry
+	add := func(id, field, from, to string) {
+		entries = append(entries, HistoryEntry{EmpID: id, At: now, Field: field, From: from, To: to, Profile: ds.Profile})
+	}
+	if !baseline {
+		for id, vals := range cur {
+			prev, ok := h.last[id]
+			if !ok {
+				add(id, historyRecord, "", "added")
+				continue
+			}
+			for _, f := range historyFields {
+				if prev[f.name] != vals[f.name] {
+					add(id, f.name, prev[f.name], vals[f.name])
+				}
+			}
+		}
+		for id := range h.last {
+			if _, ok := cur[id]; !ok {
+				add(id, historyRecord, "present", "removed")
+			}
+		}
+	}
+	if err := os.MkdirAll(h.dir, 0755); err != nil {
+		log.Printf("history dir: %v", err)
+		return nil
+	}
+	if len(entries) > 0 {
+		if err := h.append(entries); err != nil {
+			log.Printf("history append: %v", err)
+			return nil // keep the old state so the changes are retried next build
+		}
+	}
+	for _, e := range entries {
+		h.byEmp[e.EmpID] = append(h.byEmp[e.EmpID], e)
+	}
+	h.last = cur
+	if err := h.saveState(); err != nil {
+		log.Printf("history state: %v", err)
+	}
+	if baseline {
+		log.Printf("🕑 History baseline recorded for %d employees", len(cur))
+	} else {
+		log.Printf("🕑 History: %d change(s) recorded", len(entries))
+	}
+	return entries
+}
+
+func (h *empHistory) append(entries []HistoryEntry) error {
+	f, err := os.OpenFile(filepath.Join(h.dir, "history.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (h *empHistory) saveState() error {
+	b, err := json.Marshal(h.last)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(h.dir, "state.json")
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (h *empHistory) For(id string) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]HistoryEntry{}, h.byEmp[id]...)
+}
+
+// Since returns every entry recorded at or after t, oldest first.
+func (h *empHistory) Since(t time.Time) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var out []HistoryEntry
+	for _, es := range h.byEmp {
+		for _, e := range es {
+			if !e.At.Before(t) {
+				out = append(out, e)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+// GET /api/emp/history?id=
+func handleAPIEmpHistory(w http.ResponseWriter, r *http.Request) {
+	id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+	if id == "" {
+		writeError(w, 400, errBadRequest, "missing id")
+		return
+	}
+	t := tenantFor(r)
+	if t.history == nil {
+		writeData(w, []HistoryEntry{}, nil)
+		return
+	}
+	writeData(w, t.history.For(id), nil)
+}
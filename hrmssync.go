@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- HRMS sync ----
+//
+// The department's HRMS pushes employee changes as they happen instead of
+// waiting for the monthly CSV dump. Each record carries an id and only the
+// fields that changed; they are written to the overrides layer (so they
+// outlive the next export) and the tenant is rebuilt. An id the CSVs don't
+// have is a new employee and needs at least a name.
+//
+//	POST /api/v1/sync/employees[?dry_run=1]
+//	{"source": "hrms", "employees": [{"id": "95054834", "designation": "PRT", "school_id": "1355122"}]}
+//
+// The HRMS signs in as a tenant user with the hrms role (HTTP Basic auth);
+// admins may post too. A school_id without school_name/zone takes both from
+// the school.
+
+const roleHRMS = "hrms"
+
+type SyncIssue struct {
+	Index  int    `json:"index"` // position in "employees"
+	EmpID  string `json:"id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type SyncReport struct {
+	Received  int         `json:"received"`
+	Created   int         `json:"created"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Invalid   []SyncIssue `json:"invalid"`
+	DryRun    bool        `json:"dry_run,omitempty"`
+}
+
+// syncValue turns a JSON value into an override value; HRMS systems send
+// ids and mobiles as numbers as often as strings.
+func syncValue(raw json.RawMessage) (string, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return ingest.Norm(v), nil
+	case json.Number:
+		return v.String(), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("want a string")
+}
+
+// checkSyncRecord normalises one record's fields against ds, or says why it
+// can't be taken.
+func checkSyncRecord(ds *Dataset, rec map[string]json.RawMessage) (string, map[string]string, error) {
+	fields := map[string]string{}
+	for k, raw := range rec {
+		v, err := syncValue(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %v", k, err)
+		}
+		fields[k] = v
+	}
+	id := ingest.NormalizeEmpID(fields["id"])
+	delete(fields, "id")
+	if id == "" {
+		return "", nil, fmt.Errorf("missing employee id")
+	}
+	for k, v := range fields {
+		if _, ok := overridableFields[k]; !ok {
+			return id, nil, fmt.Errorf("field %q can't be synced", k)
+		}
+		switch k {
+		case "email":
+			if v != "" && !ingest.ValidEmail(v) {
+				return id, nil, fmt.Errorf("invalid email address")
+			}
+			fields[k] = strings.ToLower(v)
+		case "dob", "doj":
+			if _, err := ingest.ParseDMYFlexible(v); v != "" && err != nil {
+				return id, nil, fmt.Errorf("%s %q is not a DD/MM/YYYY date", k, v)
+			}
+		case "mobile":
+			d, problem := ingest.CheckMobile(v)
+			if v != "" && problem != "" {
+				return id, nil, fmt.Errorf("mobile %q: %s", v, problem)
+			}
+			fields[k] = d
+		case "school_id":
+			sid := ingest.DigitsOnly(v)
+			s, ok := ds.SCH[sid]
+			if !ok {
+				return id, nil, fmt.Errorf("unknown school %q", v)
+			}
+			fields[k] = sid
+			if _, ok := rec["school_name"]; !ok {
+				fields["school_name"] = s.Name
+			}
+			if _, ok := rec["zone"]; !ok {
+				fields["zone"] = s.Zone
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return id, nil, fmt.Errorf("no fields to sync")
+	}
+	if _, known := ds.EMP[id]; !known && fields["name"] == "" {
+		return id, nil, fmt.Errorf("new employee needs a name")
+	}
+	return id, fields, nil
+}
+
+// syncEmployees merges recs into the tenant's overrides; ds is the current
+// build, used to tell new employees and unchanged values apart.
+func syncEmployees(t *Tenant, ds *Dataset, recs []map[string]json.RawMessage, source string, dryRun bool) (SyncReport, error) {
+	rep := SyncReport{Received: len(recs), Invalid: []SyncIssue{}, DryRun: dryRun}
+	if t.Overrides == "" {
+		return rep, fmt.Errorf("no overrides file configured")
+	}
+	accepted := map[string]map[string]string{}
+	for i, rec := range recs {
+		id, fields, err := checkSyncRecord(ds, rec)
+		if err != nil {
+			rep.Invalid = append(rep.Invalid, SyncIssue{Index: i, EmpID: id, Reason: err.Error()})
+			continue
+		}
+		if accepted[id] == nil {
+			accepted[id] = map[string]string{}
+		}
+		for k, v := range fields {
+			accepted[id][k] = v
+		}
+	}
+	for id, fields := range accepted {
+		e, known := ds.EMP[id]
+		if !known {
+			rep.Created++
+			continue
+		}
+		after := e
+		for k, v := range fields {
+			overridableFields[k](&after, v)
+		}
+		if !empEqual(after, e) {
+			rep.Updated++
+		} else {
+			rep.Unchanged++
+			delete(accepted, id)
+		}
+	}
+	if dryRun || len(accepted) == 0 {
+		return rep, nil
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	ov := loadOverrides(t.Overrides)
+	now := time.Now()
+	ids := make([]string, 0, len(accepted))
+	for id := range accepted {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if ov.Emp[id] == nil {
+			ov.Emp[id] = map[string]Override{}
+		}
+		for k, v := range accepted[id] {
+			ov.Emp[id][k] = Override{Value: v, Source: source, At: now}
+		}
+	}
+	return rep, saveOverrides(t.Overrides, ov)
+}
+
+// empEqual compares two employees, ignoring computed metrics.
+func empEqual(a, b Emp) bool {
+	a.Metrics, b.Metrics = nil, nil
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// POST /api/v1/sync/employees
+func handleSyncEmployees(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleHRMS, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	var req struct {
+		Source    string                       `json:"source"`
+		Employees []map[string]json.RawMessage `json:"employees"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&req); err != nil {
+		writeError(w, 400, errBadRequest, "body must be {\"employees\": [...]}: "+err.Error())
+		return
+	}
+	if len(req.Employees) == 0 {
+		writeError(w, 400, errBadRequest, "no employees")
+		return
+	}
+	u, t := userFor(r), tenantFor(r)
+	source := "sync by " + u.Name
+	if req.Source != "" {
+		source = "sync " + req.Source + " by " + u.Name
+	}
+	rep, err := syncEmployees(t, dataFor(r), req.Employees, source, r.URL.Query().Get("dry_run") == "1")
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("🔄 HRMS sync by %s: %d records, %d created, %d updated, %d unchanged, %d invalid",
+		u.Name, rep.Received, rep.Created, rep.Updated, rep.Unchanged, len(rep.Invalid))
+	if rep.Created+rep.Updated > 0 && !rep.DryRun {
+		t.Build()
+	}
+	writeData(w, rep, nil)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Inbound mail webhook ----
+//
+// Mail relays post replies and bounces to /hooks/inbound?token=<secret>.
+// Each event is matched to the campaign send it answers — by our Message-ID
+// in In-Reply-To/References or the bounce text, else by the most recent send
+// to that address — and filed in the tenant's tracking dir (inbound.jsonl).
+// Understood payloads:
+//
+//   - SendGrid Inbound Parse (multipart form: from, to, subject, headers, text)
+//   - SendGrid Event Webhook (JSON array; "bounce"/"dropped"/"blocked" events)
+//   - Amazon SES via SNS (Bounce and Received notifications; subscriptions are confirmed)
+//   - a plain JSON object {"type": "reply"|"bounce", "from", "to", "subject", "in_reply_to", "text"}
+
+var inboundSecret = flag.String("inbound-secret", "", "Shared secret for the /hooks/inbound mail webhook (empty = webhook off)")
+
+const (
+	inboundReply  = "reply"
+	inboundBounce = "bounce"
+)
+
+type InboundRecord struct {
+	At        time.Time `json:"at"`
+	Kind      string    `json:"kind"` // reply or bounce
+	Source    string    `json:"source"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Snippet   string    `json:"snippet,omitempty"`
+	MessageID string    `json:"message_id,omitempty"` // our send id, when matched
+	Campaign  string    `json:"campaign,omitempty"`
+	Variant   string    `json:"variant,omitempty"`
+	EmpID     string    `json:"emp_id,omitempty"`
+	MatchedBy string    `json:"matched_by,omitempty"` // "message-id", "address" or ""
+}
+
+// inboundEvent is a webhook payload reduced to what matching needs.
+type inboundEvent struct {
+	Kind, Source      string
+	From, To, Subject string
+	Text              string
+	Recipient         string // the address we originally mailed
+	References        string // header text and bounce bodies searched for our id
+}
+
+var rxOurMessageID = regexp.MustCompile(`<([0-9a-f]{24})@[^>\s]+>`)
+
+func isBounceSender(from, subject string) bool {
+	f, s := strings.ToLower(from), strings.ToLower(subject)
+	return strings.Contains(f, "mailer-daemon") || strings.Contains(f, "postmaster") ||
+		strings.HasPrefix(s, "undeliverable") || strings.HasPrefix(s, "undelivered mail") ||
+		strings.Contains(s, "delivery status notification") || strings.Contains(s, "mail delivery failed")
+}
+
+func addrOnly(s string) string {
+	if a, err := mail.ParseAddress(s); err == nil {
+		return strings.ToLower(a.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// parseInbound turns a request body into events; ack, when set, is a
+// subscription handshake to confirm instead.
+func parseInbound(r *http.Request) (events []inboundEvent, ack string, err error) {
+	ct := r.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, "multipart/") {
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			return nil, "", err
+		}
+		ev := inboundEvent{Source: "sendgrid-parse", From: r.FormValue("from"), To: r.FormValue("to"),
+			Subject: r.FormValue("subject"), Text: r.FormValue("text")}
+		ev.References = r.FormValue("headers") + "\n" + ev.Text
+		ev.Kind = inboundReply
+		if isBounceSender(ev.From, ev.Subject) {
+			ev.Kind = inboundBounce
+		}
+		return []inboundEvent{ev}, "", nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		var sg []struct {
+			Event  string `json:"event"`
+			Email  string `json:"email"`
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal(body, &sg); err != nil {
+			return nil, "", err
+		}
+		for _, e := range sg {
+			switch e.Event {
+			case "bounce", "dropped", "blocked":
+				events = append(events, inboundEvent{Kind: inboundBounce, Source: "sendgrid-event",
+					Recipient: e.Email, To: e.Email, Text: e.Event + ": " + e.Reason})
+			}
+		}
+		return events, "", nil
+	}
+	var obj struct {
+		Type         string `json:"type"`
+		SubscribeURL string `json:"SubscribeURL"`
+		Message      string `json:"Message"`
+		From         string `json:"from"`
+		To           string `json:"to"`
+		Subject      string `json:"subject"`
+		InReplyTo    string `json:"in_reply_to"`
+		Text         string `json:"text"`
+		SNSType      string `json:"Type"`
+	}
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, "", err
+	}
+	switch obj.SNSType {
+	case "SubscriptionConfirmation":
+		return nil, obj.SubscribeURL, nil
+	case "Notification":
+		return parseSES(obj.Message)
+	}
+	ev := inboundEvent{Kind: obj.Type, Source: "json", From: obj.From, To: obj.To, Subject: obj.Subject,
+		Text: obj.Text, References: obj.InReplyTo + "\n" + obj.Text}
+	if ev.Kind != inboundBounce {
+		ev.Kind = inboundReply
+	}
+	if ev.Kind == inboundBounce {
+		ev.Recipient = ev.To
+	}
+	return []inboundEvent{ev}, "", nil
+}
+
+func parseSES(msg string) ([]inboundEvent, string, error) {
+	var n struct {
+		NotificationType string `json:"notificationType"`
+		Bounce           struct {
+			BouncedRecipients []struct {
+				EmailAddress   string `json:"emailAddress"`
+				DiagnosticCode string `json:"diagnosticCode"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		Mail struct {
+			Headers []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"headers"`
+			CommonHeaders struct {
+				From    []string `json:"from"`
+				To      []string `json:"to"`
+				Subject string   `json:"subject"`
+			} `json:"commonHeaders"`
+		} `json:"mail"`
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(msg), &n); err != nil {
+		return nil, "", err
+	}
+	var hdrs strings.Builder
+	for _, h := range n.Mail.Headers {
+		hdrs.WriteString(h.Name + ": " + h.Value + "\n")
+	}
+	ch := n.Mail.CommonHeaders
+	switch n.NotificationType {
+	case "Bounce":
+		var out []inboundEvent
+		for _, b := range n.Bounce.BouncedRecipients {
+			out = append(out, inboundEvent{Kind: inboundBounce, Source: "ses", Recipient: b.EmailAddress,
+				To: b.EmailAddress, Subject: ch.Subject, Text: b.DiagnosticCode, References: hdrs.String()})
+		}
+		return out, "", nil
+	case "Received":
+		ev := inboundEvent{Kind: inboundReply, Source: "ses", Subject: ch.Subject, References: hdrs.String()}
+		if len(ch.From) > 0 {
+			ev.From = ch.From[0]
+		}
+		if len(ch.To) > 0 {
+			ev.To = ch.To[0]
+		}
+		if n.Content != "" {
+			if m, err := mail.ReadMessage(strings.NewReader(n.Content)); err == nil {
+				b, _ := io.ReadAll(io.LimitReader(m.Body, 64<<10))
+				ev.Text = string(b)
+			}
+		}
+		ev.References += ev.Text
+		if isBounceSender(ev.From, ev.Subject) {
+			ev.Kind = inboundBounce
+		}
+		return []inboundEvent{ev}, "", nil
+	}
+	return nil, "", nil
+}
+
+// fileInbound matches ev to a send and appends it to inbound.jsonl.
+func fileInbound(t *Tenant, ev inboundEvent) InboundRecord {
+	rec := InboundRecord{At: time.Now(), Kind: ev.Kind, Source: ev.Source, From: ev.From, To: ev.To,
+		Subject: ev.Subject, Snippet: shorten(strings.TrimSpace(ev.Text), 300)}
+	ids := map[string]bool{}
+	for _, m := range rxOurMessageID.FindAllStringSubmatch(ev.References, -1) {
+		ids[m[1]] = true
+	}
+	addr := addrOnly(ev.Recipient)
+	if addr == "" && ev.Kind == inboundReply {
+		addr = addrOnly(ev.From)
+	}
+	var byAddr *SendRecord
+	readJSONL(filepath.Join(t.TrackingDir, "sends.jsonl"), func(s SendRecord) {
+		switch {
+		case ids[s.ID]:
+			rec.MessageID, rec.Campaign, rec.Variant, rec.EmpID, rec.MatchedBy = s.ID, s.Campaign, s.Variant, s.EmpID, "message-id"
+		case rec.MatchedBy == "" && addr != "" && strings.EqualFold(s.To, addr):
+			s := s
+			byAddr = &s // keep the latest
+		}
+	})
+	if rec.MatchedBy == "" && byAddr != nil {
+		rec.MessageID, rec.Campaign, rec.Variant, rec.EmpID, rec.MatchedBy = byAddr.ID, byAddr.Campaign, byAddr.Variant, byAddr.EmpID, "address"
+	}
+	if err := appendJSONL(filepath.Join(t.TrackingDir, "inbound.jsonl"), rec); err != nil {
+		log.Printf("inbound: %v", err)
+	}
+	if ev.Kind == inboundBounce && addr != "" {
+		t.badEmails().Record(addr, badEmailBounced, rec.Snippet, rec.EmpID)
+	}
+	return rec
+}
+
+// POST /hooks/inbound?token= (public; authenticated by -inbound-secret)
+func handleInboundHook(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	t := tenantFor(r)
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("X-Webhook-Token")
+	}
+	if *inboundSecret == "" || t.TrackingDir == "" || subtle.ConstantTimeCompare([]byte(token), []byte(*inboundSecret)) != 1 {
+		writeError(w, http.StatusForbidden, errForbidden, "webhook disabled or bad token")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 20<<20)
+	events, ack, err := parseInbound(r)
+	if err != nil {
+		writeError(w, 400, errBadRequest, "unrecognised payload: "+err.Error())
+		return
+	}
+	if ack != "" {
+		if err := confirmSNS(ack); err != nil {
+			log.Printf("inbound: %v", err)
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		writeData(w, map[string]string{"status": "subscription confirmed"}, nil)
+		return
+	}
+	out := make([]InboundRecord, 0, len(events))
+	for _, ev := range events {
+		rec := fileInbound(t, ev)
+		log.Printf("📥 Inbound %s from %s (%s): campaign %q emp %s [%s]",
+			rec.Kind, firstNonEmpty(rec.From, rec.To), rec.Source, rec.Campaign, rec.EmpID, rec.MatchedBy)
+		out = append(out, rec)
+	}
+	writeData(w, out, nil)
+}
+
+// confirmSNS visits an SES/SNS SubscribeURL; only AWS hosts are followed.
+func confirmSNS(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || !strings.HasSuffix(u.Hostname(), ".amazonaws.com") {
+		return fmt.Errorf("refusing subscription URL %q", raw)
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("confirming subscription: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirming subscription: %s", resp.Status)
+	}
+	log.Printf("📥 SNS subscription confirmed")
+	return nil
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// GET /api/inbound[?campaign=][&kind=reply|bounce][&emp=]
+func handleAPIInbound(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	q := r.URL.Query()
+	campaign, kind, emp := q.Get("campaign"), q.Get("kind"), ingest.NormalizeEmpID(q.Get("emp"))
+	out := []InboundRecord{}
+	if t.TrackingDir != "" {
+		readJSONL(filepath.Join(t.TrackingDir, "inbound.jsonl"), func(rec InboundRecord) {
+			if (campaign == "" || rec.Campaign == campaign) && (kind == "" || rec.Kind == kind) && (emp == "" || rec.EmpID == emp) {
+				out = append(out, rec)
+			}
+		})
+	}
+	// newest first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(out, page, per)
+	writeData(w, items, meta)
+}
@@ -0,0 +1,190 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"myproject/model"
+)
+
+// Duplicate policies: which of the rows sharing an employee ID counts.
+const (
+	DupLast      = "last"       // the later row; name, email, gender and marital status from the last row that has them
+	DupFirst     = "first"      // the first row
+	DupLatestDOJ = "latest-doj" // the Services.csv row with the latest date of joining, and the Basic.csv row at its school
+	DupMerge     = "merge"      // column by column, the last non-empty value
+)
+
+var DupPolicies = []string{DupLast, DupFirst, DupLatestDOJ, DupMerge}
+
+// Duplicate is an employee ID on more than one row of a file.
+type Duplicate struct {
+	ID      string   `json:"id"`
+	File    string   `json:"file"`
+	Rows    []int    `json:"rows"`              // 1-based, the header being row 1
+	Differs []string `json:"differs,omitempty"` // columns whose values disagree
+	Kept    int      `json:"kept_row"`          // the row that counts; 0 when merged
+}
+
+// ValidDupPolicy reports whether p is one of DupPolicies.
+func ValidDupPolicy(p string) bool {
+	for _, q := range DupPolicies {
+		if p == q {
+			return true
+		}
+	}
+	return false
+}
+
+// EmployeesWith is Employees with duplicate IDs resolved by policy; it also
+// returns the duplicates found, Services.csv's first.
+func EmployeesWith(basic, services *Table, policy string) (map[string]model.Employee, []Duplicate, error) {
+	if !ValidDupPolicy(policy) {
+		return nil, nil, fmt.Errorf("unknown duplicate policy %q (want one of %s)", policy, strings.Join(DupPolicies, ", "))
+	}
+	svcIDs, svcRows := groupByEmpID(services)
+	basicIDs, basicRows := groupByEmpID(basic)
+	var dups []Duplicate
+
+	// With latest-doj the Services.csv row picked decides the school whose
+	// Basic.csv row counts.
+	school := map[string]string{}
+	resolvedSvc := make([][]string, 0, len(svcIDs))
+	for _, id := range svcIDs {
+		idx := svcRows[id]
+		pick := len(idx) - 1
+		switch policy {
+		case DupFirst:
+			pick = 0
+		case DupLatestDOJ:
+			pick = latestDOJ(services, idx)
+			school[id] = DigitsOnlyKey(services.Get(services.Rows[idx[pick]], "School Name & ID", "School Name and ID", "School Name"))
+		case DupMerge:
+			pick = -1
+		}
+		if len(idx) > 1 {
+			dups = append(dups, duplicateOf(services, id, idx, pick))
+		}
+		resolvedSvc = append(resolvedSvc, resolveRows(services, idx, pick, policy)...)
+	}
+	resolvedBasic := make([][]string, 0, len(basicIDs))
+	var basicDups []Duplicate
+	for _, id := range basicIDs {
+		idx := basicRows[id]
+		pick := len(idx) - 1
+		switch policy {
+		case DupFirst:
+			pick = 0
+		case DupLatestDOJ:
+			if s := school[id]; s != "" {
+				for i := len(idx) - 1; i >= 0; i-- {
+					if DigitsOnlyKey(basic.Get(basic.Rows[idx[i]], "School Name & ID", "School Name and ID", "School Name")) == s {
+						pick = i
+						break
+					}
+				}
+			}
+		case DupMerge:
+			pick = -1
+		}
+		if len(idx) > 1 {
+			basicDups = append(basicDups, duplicateOf(basic, id, idx, pick))
+		}
+		resolvedBasic = append(resolvedBasic, resolveRows(basic, idx, pick, policy)...)
+	}
+	dups = append(dups, basicDups...)
+	return Employees(withRows(basic, resolvedBasic), withRows(services, resolvedSvc)), dups, nil
+}
+
+// groupByEmpID lists the employee IDs of t in order of first appearance
+// with the indexes of their rows; rows without an ID are left out.
+func groupByEmpID(t *Table) (ids []string, rows map[string][]int) {
+	rows = map[string][]int{}
+	for i, r := range t.Rows {
+		id := NormalizeEmpID(t.Get(r, "Employee ID", "Emp ID"))
+		if id == "" {
+			continue
+		}
+		if rows[id] == nil {
+			ids = append(ids, id)
+		}
+		rows[id] = append(rows[id], i)
+	}
+	return ids, rows
+}
+
+// latestDOJ is the position in idx of the row with the latest readable
+// date of joining, the later row on a tie; the last row when none reads.
+func latestDOJ(t *Table, idx []int) int {
+	pick, best := len(idx)-1, time.Time{}
+	for i, n := range idx {
+		d, err := ParseDMYFlexible(t.Get(t.Rows[n], "Date of Joining", "DOJ"))
+		if err == nil && !d.Before(best) {
+			pick, best = i, d
+		}
+	}
+	return pick
+}
+
+// resolveRows is what the join sees of one ID's rows: all of them under
+// DupLast (it keeps the later values itself), the row at pick, or with
+// pick < 0 one row of each column's last non-empty value.
+func resolveRows(t *Table, idx []int, pick int, policy string) [][]string {
+	switch {
+	case len(idx) == 1 || policy == DupLast:
+		out := make([][]string, len(idx))
+		for i, n := range idx {
+			out[i] = t.Rows[n]
+		}
+		return out
+	case pick >= 0:
+		return [][]string{t.Rows[idx[pick]]}
+	}
+	merged := make([]string, len(t.Header))
+	for _, n := range idx {
+		for c, v := range t.Rows[n] {
+			if c < len(merged) && strings.TrimSpace(v) != "" {
+				merged[c] = v
+			}
+		}
+	}
+	return [][]string{merged}
+}
+
+// duplicateOf describes one ID's rows; pick is the position of the row
+// kept, or < 0 when merged.
+func duplicateOf(t *Table, id string, idx []int, pick int) Duplicate {
+	d := Duplicate{ID: id, File: t.Path}
+	for _, n := range idx {
+		d.Rows = append(d.Rows, n+2)
+	}
+	if pick >= 0 {
+		d.Kept = idx[pick] + 2
+	}
+	for c, col := range t.Header {
+		if Norm(col) == Norm("Sl. No.") {
+			continue
+		}
+		first := cell(t.Rows[idx[0]], c)
+		for _, n := range idx[1:] {
+			if cell(t.Rows[n], c) != first {
+				d.Differs = append(d.Differs, col)
+				break
+			}
+		}
+	}
+	return d
+}
+
+func cell(rec []string, c int) string {
+	if c < len(rec) {
+		return strings.TrimSpace(rec[c])
+	}
+	return ""
+}
+
+// withRows is t with rows in place of its own.
+func withRows(t *Table, rows [][]string) *Table {
+	return &Table{Path: t.Path, Header: t.Header, Rows: rows, Index: t.Index}
+}
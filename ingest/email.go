@@ -0,0 +1,37 @@
+package ingest
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Email address problems, as CheckEmail reports them.
+const (
+	EmailBlank  = "blank"
+	EmailSyntax = "bad syntax" // not a bare user@domain.tld address
+)
+
+// CheckEmail reads an address as Employees_Email_ID carries it and returns
+// it, or "" and what is wrong with it. Display names, angle brackets,
+// surrounding spaces and several addresses in one cell count as bad
+// syntax: the column should hold the address alone.
+func CheckEmail(s string) (address, problem string) {
+	if strings.TrimSpace(s) == "" {
+		return "", EmailBlank
+	}
+	a, err := mail.ParseAddress(s)
+	if err != nil || !strings.EqualFold(a.Address, s) {
+		return "", EmailSyntax
+	}
+	at := strings.LastIndex(s, "@")
+	if at <= 0 || !strings.Contains(s[at+1:], ".") || strings.HasSuffix(s, ".") {
+		return "", EmailSyntax
+	}
+	return s, ""
+}
+
+// ValidEmail reports whether s is a usable email address.
+func ValidEmail(s string) bool {
+	_, problem := CheckEmail(s)
+	return problem == ""
+}
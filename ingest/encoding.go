@@ -0,0 +1,119 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings DecodeText recognises.
+const (
+	EncUTF8    = "UTF-8"
+	EncUTF16LE = "UTF-16LE"
+	EncUTF16BE = "UTF-16BE"
+	EncCP1252  = "Windows-1252"
+)
+
+// DecodeText returns b as UTF-8 with any byte-order mark removed, and the
+// encoding it was read as. A BOM decides; without one, a file with a zero
+// byte in most even or odd positions is UTF-16, one that reads as UTF-8
+// (bar the odd stray byte, which becomes U+FFFD) is UTF-8, and anything
+// else is Windows-1252, what Excel on Windows saves "CSV" as.
+func DecodeText(b []byte) ([]byte, string) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return validUTF8(b[3:]), EncUTF8
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}):
+		return decodeUTF16(b[2:], binary.LittleEndian), EncUTF16LE
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		return decodeUTF16(b[2:], binary.BigEndian), EncUTF16BE
+	}
+	if enc := sniffUTF16(b); enc == EncUTF16LE {
+		return decodeUTF16(b, binary.LittleEndian), enc
+	} else if enc == EncUTF16BE {
+		return decodeUTF16(b, binary.BigEndian), enc
+	}
+	if utf8.Valid(b) {
+		return b, EncUTF8
+	}
+	multi, bad := 0, 0
+	for i := 0; i < len(b); {
+		r, n := utf8.DecodeRune(b[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			bad++
+		case n > 1:
+			multi++
+		}
+		i += n
+	}
+	if multi > 10*bad {
+		return validUTF8(b), EncUTF8
+	}
+	return decodeCP1252(b), EncCP1252
+}
+
+func validUTF8(b []byte) []byte {
+	if utf8.Valid(b) {
+		return b
+	}
+	return []byte(strings.ToValidUTF8(string(b), "�"))
+}
+
+// sniffUTF16 guesses the byte order of BOM-less UTF-16 from the zero bytes
+// in the first few KB: mostly-ASCII text has one in every other position.
+func sniffUTF16(b []byte) string {
+	b = b[:min(len(b), 4096)&^1]
+	if len(b) < 4 {
+		return ""
+	}
+	even, odd := 0, 0
+	for i := 0; i < len(b); i += 2 {
+		if b[i] == 0 {
+			even++
+		}
+		if b[i+1] == 0 {
+			odd++
+		}
+	}
+	pairs := len(b) / 2
+	switch {
+	case odd*10 > pairs*4 && even*10 < pairs:
+		return EncUTF16LE
+	case even*10 > pairs*4 && odd*10 < pairs:
+		return EncUTF16BE
+	}
+	return ""
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) []byte {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = order.Uint16(b[2*i:])
+	}
+	return []byte(string(utf16.Decode(u)))
+}
+
+// cp1252 maps Windows-1252's 0x80-0x9F; the five unassigned bytes stay as
+// the C1 controls, as Windows itself decodes them.
+var cp1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+func decodeCP1252(b []byte) []byte {
+	out := make([]byte, 0, len(b)+len(b)/8)
+	for _, c := range b {
+		switch {
+		case c < 0x80:
+			out = append(out, c)
+		case c < 0xA0:
+			out = utf8.AppendRune(out, cp1252[c-0x80])
+		default:
+			out = utf8.AppendRune(out, rune(c))
+		}
+	}
+	return out
+}
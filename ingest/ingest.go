@@ -0,0 +1,279 @@
+// Package ingest reads the department's CSV exports (Basic.csv,
+// Services.csv and the DBT summary) and joins them into model records. The
+// portal's .xlsx downloads are read directly as well; see ReadXLSX.
+//
+// The exports are hand-edited spreadsheets: headers drift in spacing and
+// case, IDs arrive as "95054834.0" or embedded in "SCHOOL NAME-1757149", and
+// dates mix DD/MM/YYYY with DD/Mon/YYYY, and a file may be saved as UTF-8,
+// UTF-16 or Windows-1252. The helpers here normalise all of that so callers
+// can look columns up by name.
+package ingest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+var (
+	rxBOM     = regexp.MustCompile("\uFEFF")
+	rxNBSP    = regexp.MustCompile("\u00A0")
+	rxDigits  = regexp.MustCompile(`(\d{5,})`)
+	rxLastNum = regexp.MustCompile(`(\d{5,})\D*$`)
+	rxNumeric = regexp.MustCompile(`^\d+$`)
+)
+
+// Norm strips BOMs and non-breaking spaces, trims and collapses runs of
+// spaces.
+func Norm(s string) string {
+	s = rxBOM.ReplaceAllString(s, "")
+	s = rxNBSP.ReplaceAllString(s, " ")
+	s = strings.TrimSpace(s)
+	for strings.Contains(s, "  ") {
+		s = strings.ReplaceAll(s, "  ", " ")
+	}
+	return s
+}
+
+// StripDot0 undoes spreadsheets turning 123 into "123.0".
+func StripDot0(s string) string {
+	s = Norm(s)
+	if strings.HasSuffix(s, ".0") {
+		return s[:len(s)-2]
+	}
+	return s
+}
+
+// DigitsOnly drops every non-digit.
+func DigitsOnly(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			out = append(out, r)
+		}
+	}
+	return string(out)
+}
+
+// NormalizeEmpID is the canonical form of an employee ID.
+func NormalizeEmpID(s string) string { return DigitsOnly(StripDot0(s)) }
+
+// DigitsOnlyKey extracts the school ID (the last run of five or more
+// digits) from a "Name-ID" cell; "" when there is none.
+func DigitsOnlyKey(s string) string {
+	s = Norm(s)
+	if m := rxLastNum.FindStringSubmatch(s); len(m) > 1 {
+		return m[1]
+	}
+	if m := rxDigits.FindStringSubmatch(s); len(m) > 1 {
+		return m[1]
+	}
+	return ""
+}
+
+// AtoiSafe parses a count, treating blanks and junk as 0.
+func AtoiSafe(s string) int {
+	s = StripDot0(s)
+	if s == "" {
+		return 0
+	}
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+// Table is a CSV file with normalised cells and a header index.
+type Table struct {
+	Path   string
+	Header []string
+	Rows   [][]string
+	Index  map[string]int // see IdxMap
+
+	Encoding string // of a CSV as read (see DecodeText); "" for XLSX
+}
+
+// Get returns rec's value of the first of name and aliases in the header.
+func (t *Table) Get(rec []string, name string, aliases ...string) string {
+	return Get(rec, t.Index, name, aliases...)
+}
+
+// Has reports whether any of names is a column.
+func (t *Table) Has(names ...string) bool {
+	for _, n := range withAliases(names) {
+		if _, ok := t.Index[strings.ToLower(strings.TrimSpace(n))]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCSV reads a whole CSV, transcoded to UTF-8 from whatever encoding
+// it was saved in (see DecodeText); rows may be ragged.
+func ReadCSV(path string) (*Table, error) {
+	r, enc, err := csvReader(path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header %s: %v", path, err)
+	}
+	for i := range header {
+		header[i] = Norm(header[i])
+	}
+	t := &Table{Path: path, Header: header, Index: IdxMap(header), Encoding: enc}
+	for {
+		rec, e := r.Read()
+		if e != nil {
+			break
+		}
+		for i := range rec {
+			rec[i] = Norm(rec[i])
+		}
+		t.Rows = append(t.Rows, rec)
+	}
+	return t, nil
+}
+
+// csvReader opens path for reading as CSV, decoded to UTF-8; enc is the
+// encoding it was in.
+func csvReader(path string) (r *csv.Reader, enc string, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	text, enc := DecodeText(b)
+	r = csv.NewReader(bytes.NewReader(text))
+	r.FieldsPerRecord = -1
+	return r, enc, nil
+}
+
+// IdxMap maps lower-cased, space-normalised header names to their column;
+// the first of duplicate names wins.
+func IdxMap(h []string) map[string]int {
+	m := map[string]int{}
+	for i, c := range h {
+		c = strings.ReplaceAll(c, "\u00A0", " ")
+		c = strings.ReplaceAll(c, "\uFEFF", "")
+		c = strings.Map(func(r rune) rune {
+			if r == 160 || unicode.IsSpace(r) {
+				return ' '
+			}
+			return r
+		}, c)
+		k := strings.ToLower(strings.TrimSpace(c))
+		if _, ok := m[k]; !ok {
+			m[k] = i
+		}
+	}
+	return m
+}
+
+// extraAliases are header variants from -config or an alias file, keyed
+// by the lower-cased name the code asks for; see SetAliases.
+var extraAliases atomic.Pointer[map[string][]string]
+
+// SetAliases replaces the configured header variants: a lookup of
+// "Employee ID" also tries every name in a["Employee ID"], after the
+// built-in ones. It is safe alongside lookups.
+func SetAliases(a map[string][]string) {
+	m := map[string][]string{}
+	for name, list := range a {
+		k := strings.ToLower(strings.TrimSpace(name))
+		m[k] = append(m[k], list...)
+	}
+	extraAliases.Store(&m)
+}
+
+// withAliases is names followed by the configured aliases of each.
+func withAliases(names []string) []string {
+	p := extraAliases.Load()
+	if p == nil || len(*p) == 0 {
+		return names
+	}
+	out := append([]string(nil), names...)
+	for _, n := range names {
+		out = append(out, (*p)[strings.ToLower(strings.TrimSpace(n))]...)
+	}
+	return out
+}
+
+// Get returns rec's value of the first of name and aliases found in m.
+func Get(rec []string, m map[string]int, name string, aliases ...string) string {
+	names := withAliases(append([]string{name}, aliases...))
+	for _, nm := range names {
+		i, ok := m[strings.ToLower(strings.TrimSpace(nm))]
+		if ok && i >= 0 && i < len(rec) {
+			return Norm(rec[i])
+		}
+	}
+	return ""
+}
+
+// ParseDMYFlexible parses the date forms found in the exports:
+// 02/01/2006, 02/Jan/2006, 02-Jan-2006 and 02/January/2006.
+func ParseDMYFlexible(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty")
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) == 3 && len(parts[1]) > 2 && !rxNumeric.MatchString(parts[1]) {
+		parts[1] = strings.ToUpper(strings.ToUpper(parts[1][:1]) + strings.ToLower(parts[1][1:]))
+		s = strings.Join(parts, "/")
+	}
+	formats := []string{
+		"02/Jan/2006", "2/Jan/2006", "02-Jan-2006", "2-Jan-2006",
+		"02/01/2006", "2/01/2006", "02/January/2006", "2/January/2006",
+	}
+	var d time.Time
+	var err error
+	for _, f := range formats {
+		d, err = time.Parse(f, s)
+		if err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unparsed: %s", s)
+}
+
+// AgeFromDOB is the age in whole years today; 0 when dob doesn't parse.
+func AgeFromDOB(dob string) int {
+	d, err := ParseDMYFlexible(dob)
+	if err != nil {
+		return 0
+	}
+	now := time.Now()
+	age := now.Year() - d.Year()
+	if now.Month() < d.Month() || (now.Month() == d.Month() && now.Day() < d.Day()) {
+		age--
+	}
+	if age < 0 {
+		return 0
+	}
+	return age
+}
+
+// CanonicalCategory upper-cases a selection category; blank is UNKNOWN.
+func CanonicalCategory(raw string) string {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return "UNKNOWN"
+	}
+	return s
+}
+
+// CanonicalReligion upper-cases a religion; blank is UNKNOWN.
+func CanonicalReligion(raw string) string {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return "UNKNOWN"
+	}
+	return s
+}
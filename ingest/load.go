@@ -0,0 +1,249 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"myproject/model"
+)
+
+// LoadBasic reads Basic.csv, one row per employee.
+func LoadBasic(path string) (*Table, error) {
+	return load(path, "Employee ID", "Emp ID")
+}
+
+// LoadServices reads Services.csv, the service-book columns keyed by
+// employee ID.
+func LoadServices(path string) (*Table, error) {
+	return load(path, "Employee ID", "Emp ID")
+}
+
+// LoadDBT reads the DBT summary, one row per school.
+func LoadDBT(path string) (*Table, error) {
+	return load(path, "School Name & ID", "School Name")
+}
+
+// load reads path (CSV or XLSX) and checks that one of key is a column.
+func load(path string, key ...string) (*Table, error) {
+	t, err := ReadTable(path)
+	if err != nil {
+		return nil, err
+	}
+	if !t.Has(key...) {
+		return nil, fmt.Errorf("%s: no %q column", path, key[0])
+	}
+	return t, nil
+}
+
+// Employees joins Basic.csv with Services.csv on employee ID. Basic.csv
+// decides who is on the roll; Services.csv adds the date of joining,
+// selection category, service dates and (when Basic.csv has none) marital
+// status. A later row for the same ID wins; EmployeesWith offers other
+// policies.
+func Employees(basic, services *Table) map[string]model.Employee {
+	type svc struct {
+		DOJ, Category, Marital                       string
+		AppointmentDate, PromotionDate, TransferDate string
+		PresentSchoolDate, PreviousSchool            string
+	}
+	byID := map[string]svc{}
+	for _, r := range services.Rows {
+		id := NormalizeEmpID(services.Get(r, "Employee ID", "Emp ID"))
+		if id == "" {
+			continue
+		}
+		s := byID[id]
+		if doj := services.Get(r, "Date of Joining", "DOJ"); doj != "" {
+			s.DOJ = doj
+		}
+		s.Category = CanonicalCategory(services.Get(r, "Selection Category", "SelectionCategory", "Applied Category", "Category"))
+		if mar := services.Get(r, "Marital Status", "Marital"); mar != "" && s.Marital == "" {
+			s.Marital = mar
+		}
+		s.AppointmentDate = services.Get(r, "Date of Appointment")
+		s.PromotionDate = services.Get(r, "Last Promotion Order Date")
+		s.TransferDate = services.Get(r, "Last Transfer Order Date")
+		s.PresentSchoolDate = services.Get(r, "Joining Date (Present School)")
+		s.PreviousSchool = services.Get(r, "Previous School Name & ID")
+		byID[id] = s
+	}
+
+	// Basic.csv's name, email, gender and marital status come from the last
+	// row that has them.
+	type basicKeep struct{ Email, Name, Gender, Marital string }
+	keep := map[string]basicKeep{}
+	for _, r := range basic.Rows {
+		id := NormalizeEmpID(basic.Get(r, "Employee ID", "Emp ID"))
+		if id == "" {
+			continue
+		}
+		k := keep[id]
+		if v := basic.Get(r, "Employees_Email_ID", "Email", "Email ID"); v != "" {
+			k.Email = v
+		}
+		if v := basic.Get(r, "Name of the Employee", "Employee Name", "Name"); v != "" {
+			k.Name = v
+		}
+		if v := basic.Get(r, "Gender"); v != "" {
+			k.Gender = strings.ToUpper(v)
+		}
+		if v := basic.Get(r, "Marital Status", "Marital"); v != "" {
+			k.Marital = v
+		}
+		keep[id] = k
+	}
+
+	out := map[string]model.Employee{}
+	for _, r := range basic.Rows {
+		id := NormalizeEmpID(basic.Get(r, "Employee ID", "Emp ID"))
+		if id == "" {
+			continue
+		}
+		sname := basic.Get(r, "School Name & ID", "School Name and ID", "School Name")
+		zone := strings.ToUpper(strings.TrimSpace(basic.Get(r, "Zone ID", "Zone Name", "Zone")))
+		if zone == "" {
+			zone = "UNKNOWN"
+		}
+		dob := basic.Get(r, "Date of Birth", "DOB")
+		k, s := keep[id], byID[id]
+		marital := k.Marital
+		if marital == "" {
+			marital = s.Marital
+		}
+		out[id] = model.Employee{
+			ID:                id,
+			Name:              k.Name,
+			Designation:       basic.Get(r, "Designation"),
+			DOB:               dob,
+			Gender:            k.Gender,
+			Zone:              zone,
+			SchoolID:          DigitsOnlyKey(sname),
+			SchoolName:        sname,
+			Status:            basic.Get(r, "Status"),
+			SelectionCategory: s.Category,
+			MaritalStatus:     marital,
+			Age:               AgeFromDOB(dob),
+			Mobile:            CanonicalMobile(basic.Get(r, "Mobile No.", "Mobile")),
+			Email:             k.Email,
+			DOJ:               s.DOJ,
+			FatherName:        basic.Get(r, "Father's Name"),
+			MotherName:        basic.Get(r, "Mother's Name"),
+			SpouseName:        basic.Get(r, "Spouse Name"),
+			Correspondence:    basic.Get(r, "Correspondance_Address", "Correspondence Address"),
+			Permanent:         basic.Get(r, "Permanent_Address", "Permanent Address"),
+			HomeTown:          basic.Get(r, "Home Town"),
+			Religion:          CanonicalReligion(basic.Get(r, "Religion")),
+			AppointmentDate:   s.AppointmentDate,
+			PromotionDate:     s.PromotionDate,
+			TransferDate:      s.TransferDate,
+			PresentSchoolDate: s.PresentSchoolDate,
+			PreviousSchool:    s.PreviousSchool,
+		}
+	}
+	return out
+}
+
+// Schools reads the DBT summary into school records keyed by school ID.
+// Rows without an ID in "School Name & ID" are skipped.
+func Schools(dbt *Table) map[string]model.School {
+	schemes := dbtSchemeCols(dbt.Index)
+	out := map[string]model.School{}
+	for _, r := range dbt.Rows {
+		sname := dbt.Get(r, "School Name & ID", "School Name")
+		sid := DigitsOnlyKey(sname)
+		if sid == "" {
+			continue
+		}
+		zone := strings.ToUpper(strings.TrimSpace(dbt.Get(r, "Zone ID", "Zone Name", "Zone")))
+		if zone == "" {
+			zone = "UNKNOWN"
+		}
+		s := model.School{
+			ID:                  sid,
+			Name:                sname,
+			Zone:                zone,
+			SIName:              dbt.Get(r, "School Inspector's Name", "SI Name"),
+			TotalEnrolment:      AtoiSafe(dbt.Get(r, "Total Enrolment (Last)", "Total Enrolment")),
+			MaxEnrolment:        AtoiSafe(dbt.Get(r, "Max Enrolment")),
+			MaxEnrolmentDate:    dbt.Get(r, "Max Enrolment Date"),
+			MaxPresent:          AtoiSafe(dbt.Get(r, "Max Present")),
+			MaxPresentDate:      dbt.Get(r, "Max Present Date"),
+			WithAccount:         AtoiSafe(dbt.Get(r, "With Account")),
+			WithoutAccount:      AtoiSafe(dbt.Get(r, "Without Account")),
+			WithAadhaar:         AtoiSafe(dbt.Get(r, "With Aadhaar")),
+			WithoutAadhaar:      AtoiSafe(dbt.Get(r, "Without Aadhaar")),
+			AadhaarLinkedAcc:    AtoiSafe(dbt.Get(r, "Aadhaar Linked Account")),
+			NewAdmissionMonth:   AtoiSafe(dbt.Get(r, "New Admission (This month)")),
+			NewAdmissionSession: AtoiSafe(dbt.Get(r, "New Admission (This session)")),
+			DBTStudent:          AtoiSafe(dbt.Get(r, "DBT Received (Student)")),
+			DBTParent:           AtoiSafe(dbt.Get(r, "DBT Received (Parent)")),
+			DBTTotal:            AtoiSafe(dbt.Get(r, "Received By (Student + Parent)")),
+		}
+		s.DBTComponents = readDBTComponents(r, dbt.Index, schemes, s.TotalEnrolment)
+		out[sid] = s
+	}
+	return out
+}
+
+// DBTScheme is one DBT payment scheme with its own columns in the DBT
+// summary: "<Prefix> Received (Student)", "<Prefix> Received (Parent)" and
+// optionally "<Prefix> Received (Student + Parent)".
+type DBTScheme struct {
+	Key, Label string
+	Prefixes   []string // column prefixes, tried in order
+}
+
+// DBTSchemes are the schemes counted separately from the combined DBT
+// columns, which lump them together although they pay out on different
+// timelines.
+var DBTSchemes = []DBTScheme{
+	{"uniform", "Uniform subsidy", []string{"Uniform", "Uniform Subsidy"}},
+	{"textbooks", "Textbooks", []string{"Textbook", "Textbooks"}},
+	{"scholarship", "Scholarship", []string{"Scholarship"}},
+}
+
+// dbtSchemeCols returns, per scheme present in the header, the lower-cased
+// student, parent and total column names.
+func dbtSchemeCols(dm map[string]int) map[string][3]string {
+	out := map[string][3]string{}
+	for _, sc := range DBTSchemes {
+		for _, p := range sc.Prefixes {
+			p = strings.ToLower(p)
+			cols := [3]string{p + " received (student)", p + " received (parent)", p + " received (student + parent)"}
+			found := false
+			for _, c := range cols {
+				if _, ok := dm[c]; ok {
+					found = true
+				}
+			}
+			if found {
+				out[sc.Key] = cols
+				break
+			}
+		}
+	}
+	return out
+}
+
+// readDBTComponents reads one DBT row's per-scheme counts; nil when the
+// file has none.
+func readDBTComponents(rec []string, dm map[string]int, cols map[string][3]string, enrolment int) map[string]model.DBTComponent {
+	if len(cols) == 0 {
+		return nil
+	}
+	out := map[string]model.DBTComponent{}
+	for key, c := range cols {
+		dc := model.DBTComponent{Student: AtoiSafe(Get(rec, dm, c[0])), Parent: AtoiSafe(Get(rec, dm, c[1]))}
+		if v := Get(rec, dm, c[2]); v != "" {
+			dc.Total = AtoiSafe(v)
+		} else {
+			dc.Total = dc.Student + dc.Parent
+		}
+		if enrolment > 0 {
+			dc.Pct = math.Round(float64(dc.Total)/float64(enrolment)*1000) / 10
+		}
+		out[key] = dc
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import "strings"
+
+// Mobile number problems, as CheckMobile reports them.
+const (
+	MobileBlank       = "blank"
+	MobileTooShort    = "too short"
+	MobileTooLong     = "too long"
+	MobileNotMobile   = "not a mobile number" // doesn't start with 6-9
+	MobilePlaceholder = "placeholder"         // one digit repeated, or 1234567890
+)
+
+// CheckMobile reads an Indian mobile number as the exports carry it
+// ("9876543210", "9876543210.0", "+91 98765-43210", "09876543210") and
+// returns its canonical ten digits, or "" and what is wrong with it.
+func CheckMobile(s string) (canonical, problem string) {
+	d := DigitsOnly(StripDot0(s))
+	switch {
+	case len(d) == 14 && strings.HasPrefix(d, "0091"):
+		d = d[4:]
+	case len(d) == 12 && strings.HasPrefix(d, "91"):
+		d = d[2:]
+	case len(d) == 11 && d[0] == '0':
+		d = d[1:]
+	}
+	switch {
+	case d == "":
+		return "", MobileBlank
+	case len(d) < 10:
+		return "", MobileTooShort
+	case len(d) > 10:
+		return "", MobileTooLong
+	case d[0] < '6':
+		return "", MobileNotMobile
+	case strings.Count(d, d[:1]) == 10 || d == "1234567890" || d == "9876543210":
+		return "", MobilePlaceholder
+	}
+	return d, ""
+}
+
+// CanonicalMobile is s as ten digits when it is a valid mobile number, else
+// s trimmed, so that a bad number stays visible for correction.
+func CanonicalMobile(s string) string {
+	if d, problem := CheckMobile(s); problem == "" {
+		return d
+	}
+	return StripDot0(s)
+}
+
+// ValidMobile reports whether s is a usable mobile number.
+func ValidMobile(s string) bool {
+	_, problem := CheckMobile(s)
+	return problem == ""
+}
+
+// MobileE164 is a canonical ten-digit number in international form.
+func MobileE164(d string) string { return "+91" + d }
@@ -0,0 +1,62 @@
+package ingest
+
+import "strings"
+
+// Unmatched is an employee ID found in one of Basic.csv and Services.csv
+// but not the other, as its first row there describes it.
+type Unmatched struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Designation string `json:"designation"`
+	Zone        string `json:"zone"`
+	SchoolID    string `json:"school_id"`
+	SchoolName  string `json:"school_name"`
+	Row         int    `json:"row"` // 1-based, the header being row 1
+}
+
+// Reconciliation is how the employee IDs of the two files line up.
+type Reconciliation struct {
+	Basic        int         `json:"basic_ids"`
+	Services     int         `json:"services_ids"`
+	Matched      int         `json:"matched"`
+	BasicOnly    []Unmatched `json:"basic_only"`    // no DOJ, category or service dates
+	ServicesOnly []Unmatched `json:"services_only"` // dropped by the build
+}
+
+// Reconcile joins basic and services on employee ID.
+func Reconcile(basic, services *Table) Reconciliation {
+	basicIDs, basicRows := groupByEmpID(basic)
+	svcIDs, svcRows := groupByEmpID(services)
+	rec := Reconciliation{Basic: len(basicIDs), Services: len(svcIDs), BasicOnly: []Unmatched{}, ServicesOnly: []Unmatched{}}
+	for _, id := range basicIDs {
+		if _, ok := svcRows[id]; ok {
+			rec.Matched++
+		} else {
+			rec.BasicOnly = append(rec.BasicOnly, unmatchedRow(basic, id, basicRows[id][0]))
+		}
+	}
+	for _, id := range svcIDs {
+		if _, ok := basicRows[id]; !ok {
+			rec.ServicesOnly = append(rec.ServicesOnly, unmatchedRow(services, id, svcRows[id][0]))
+		}
+	}
+	return rec
+}
+
+func unmatchedRow(t *Table, id string, n int) Unmatched {
+	r := t.Rows[n]
+	sname := t.Get(r, "School Name & ID", "School Name and ID", "School Name")
+	zone := strings.ToUpper(strings.TrimSpace(t.Get(r, "Zone ID", "Zone Name", "Zone")))
+	if zone == "" {
+		zone = "UNKNOWN"
+	}
+	return Unmatched{
+		ID:          id,
+		Name:        strings.TrimSpace(t.Get(r, "Name of the Employee", "Employee Name", "Name")),
+		Designation: t.Get(r, "Designation"),
+		Zone:        zone,
+		SchoolID:    DigitsOnlyKey(sname),
+		SchoolName:  sname,
+		Row:         n + 2,
+	}
+}
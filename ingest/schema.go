@@ -0,0 +1,187 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Schema is the column layout expected of one input file: the columns a
+// build can't do without, each with the other names it may go by, and the
+// full header of the portal's export.
+type Schema struct {
+	Kind     string
+	Required [][]string
+	Columns  []string
+}
+
+var BasicSchema = Schema{
+	Kind: "basic",
+	Required: [][]string{
+		{"Employee ID", "Emp ID"},
+		{"Name of the Employee", "Employee Name", "Name"},
+		{"Date of Birth", "DOB"},
+		{"Designation"},
+		{"Zone ID", "Zone Name", "Zone"},
+		{"School Name & ID", "School Name and ID", "School Name"},
+	},
+	Columns: []string{"Sl. No.", "Zone ID", "School Name & ID", "Employee ID", "Emp. DoE ID", "Name of the Employee",
+		"Date of Birth", "Gender", "Father's Name", "Mother's Name", "Designation", "Marital Status", "Spouse Name", "Mobile No.",
+		"Employees_Email_ID", "Voter Card No.", "Correspondance_Address", "Permanent_Address", "Home Town", "Accomodation Type",
+		"Emergency Name & Relation", "Emergency No.", "Emergency_Address", "Physical Category", "Religion", "Pension Type",
+		"PRAN / GPF No.", "PAN", "Messenger", "Messenger No.", "Edn. Qual. @ Present", "Prof. Qual. @ Present", "Class", "Charges",
+		"Pay Level", "Basic Pay", "Performing Extra Duty", "On Long Leave", "Medical Issue", "Status"},
+}
+
+var ServicesSchema = Schema{
+	Kind: "services",
+	Required: [][]string{
+		{"Employee ID", "Emp ID"},
+		{"Date of Joining", "DOJ"},
+	},
+	Columns: []string{"Sl. No.", "Zone Name", "School Name & ID", "Employee ID", "Name of the Employee",
+		"Date of Birth", "Gender", "Designation", "Applied Category", "Selection Category", "Appointment Order No.",
+		"Date of Appointment", "Appointment Agency", "Appointment Type", "Joining Type", "Date of Joining",
+		"Declared Joining Date by Court/ Department", "Edn. Qual. @ Joining", "Prof. Qual. @ Joining",
+		"Last IN-Service Training (INSET) attended", "Last Physical Training attended", "Last Promotion Order No.",
+		"Last Promotion Order Date", "Last Promotion Joining Date", "Last Promotion Type", "Last Transfer Order No.",
+		"Last Transfer Order Date", "Last Transfer Type", "Joining Date (Present School)", "Previous School Name & ID",
+		"Are you on Deputed /Diverted?", "Place where physically working", "Post Code of Recruitment", "Rank in Selection Board",
+		"Panel No. allotted by Selection Board", "Marks Achieved in selection Exam", "Maximum Marks of selection Exam",
+		"Official E-Mail", "Status"},
+}
+
+var DBTSchema = Schema{
+	Kind: "dbt",
+	Required: [][]string{
+		{"School Name & ID", "School Name"},
+		{"Zone ID", "Zone Name", "Zone"},
+		{"Total Enrolment (Last)", "Total Enrolment"},
+	},
+	Columns: []string{"Zone Name", "Ward No.", "School UDISE ID", "School Name & ID", "School Inspector's Name",
+		"Last Data Date", "Total Enrolment (Last)", "Max Enrolment", "Max Enrolment Date", "Max Present", "Max Present Date",
+		"With Account", "Without Account", "With Aadhaar", "Without Aadhaar", "Aadhaar Linked Account",
+		"New Admission (This month)", "New Admission (This session)", "DBT Received (Student)", "DBT Received (Parent)",
+		"Received By (Student + Parent)"},
+}
+
+// maxRowIssues caps the malformed rows a SchemaReport lists; the rest are
+// only counted.
+const maxRowIssues = 1000
+
+// RowIssue is a malformed row: its line in the file and what is wrong.
+type RowIssue struct {
+	Line    int    `json:"line"`
+	Problem string `json:"problem"`
+}
+
+// SchemaReport is how a file measures up to its Schema.
+type SchemaReport struct {
+	Path      string     `json:"path"`
+	Kind      string     `json:"kind"`
+	Rows      int        `json:"rows"`
+	Missing   []string   `json:"missing,omitempty"` // required columns, by their first name
+	Extra     []string   `json:"extra,omitempty"`   // columns the schema doesn't know
+	Malformed []RowIssue `json:"malformed,omitempty"`
+	More      int        `json:"more_malformed,omitempty"` // beyond those listed
+}
+
+// OK reports whether the file has every required column and no malformed
+// row; extra columns are allowed.
+func (r SchemaReport) OK() bool { return len(r.Missing) == 0 && len(r.Malformed) == 0 }
+
+func (r *SchemaReport) malformed(line int, problem string) {
+	if len(r.Malformed) < maxRowIssues {
+		r.Malformed = append(r.Malformed, RowIssue{Line: line, Problem: problem})
+	} else {
+		r.More++
+	}
+}
+
+// CheckSchema reads path against s. Unlike ReadCSV, which drops the rest of
+// a file at the first unreadable row and pads ragged ones, it reports every
+// row whose field count differs from the header's or that doesn't parse,
+// with its line number. An .xlsx workbook has its columns checked only.
+func CheckSchema(path string, s Schema) (SchemaReport, error) {
+	rep := SchemaReport{Path: path, Kind: s.Kind}
+	var header []string
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		t, err := ReadXLSX(path)
+		if err != nil {
+			return rep, err
+		}
+		header, rep.Rows = t.Header, len(t.Rows)
+	} else {
+		r, _, err := csvReader(path)
+		if err != nil {
+			return rep, err
+		}
+		if header, err = r.Read(); err != nil {
+			return rep, fmt.Errorf("header %s: %v", path, err)
+		}
+		for i := range header {
+			header[i] = Norm(header[i])
+		}
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			var pe *csv.ParseError
+			if errors.As(err, &pe) {
+				rep.malformed(pe.Line, pe.Err.Error())
+				continue
+			}
+			if err != nil {
+				return rep, fmt.Errorf("read %s: %v", path, err)
+			}
+			rep.Rows++
+			if len(rec) != len(header) {
+				line, _ := r.FieldPos(0)
+				rep.malformed(line, fmt.Sprintf("%d fields, the header has %d", len(rec), len(header)))
+			}
+		}
+	}
+
+	t := &Table{Path: path, Header: header, Index: IdxMap(header)}
+	for _, names := range s.Required {
+		if !t.Has(names...) {
+			rep.Missing = append(rep.Missing, names[0])
+		}
+	}
+	known := IdxMap(withAliases(s.Columns))
+	for _, names := range s.Required {
+		for k, v := range IdxMap(withAliases(names)) {
+			known[k] = v
+		}
+	}
+	for i, col := range header {
+		if col == "" {
+			rep.Extra = append(rep.Extra, fmt.Sprintf("(blank, column %d)", i+1))
+			continue
+		}
+		if _, ok := known[strings.ToLower(col)]; ok {
+			continue
+		}
+		if s.Kind == DBTSchema.Kind && dbtSchemeColumn(col) {
+			continue
+		}
+		rep.Extra = append(rep.Extra, col)
+	}
+	return rep, nil
+}
+
+// dbtSchemeColumn reports whether col is one of DBTSchemes' columns.
+func dbtSchemeColumn(col string) bool {
+	for _, cols := range dbtSchemeCols(IdxMap([]string{col})) {
+		for _, c := range cols {
+			if c == strings.ToLower(col) {
+				return true
+			}
+		}
+	}
+	return false
+}
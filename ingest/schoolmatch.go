@@ -0,0 +1,178 @@
+package ingest
+
+import (
+	"sort"
+	"strings"
+
+	"myproject/model"
+)
+
+// SchoolMatch is an employee whose "School Name & ID" carries no ID,
+// placed (or not) by comparing the name with the DBT summary's schools.
+type SchoolMatch struct {
+	EmpID      string  `json:"emp_id"`
+	Zone       string  `json:"zone"`
+	Given      string  `json:"given"`                 // the cell as written
+	SchoolID   string  `json:"school_id,omitempty"`   // "" when unmatched
+	SchoolName string  `json:"school_name,omitempty"` // the DBT summary's
+	Score      float64 `json:"score"`                 // of the best candidate, 0-1
+	Runner     float64 `json:"runner_up,omitempty"`   // of the next best
+}
+
+// schoolMargin is how far the best candidate must lead the next for a
+// match to count as unambiguous: "BAPU PARK" is as close to
+// "BAPU PARK (GIRLS)" as to "BAPU PARK (CO-ED)".
+const schoolMargin = 0.05
+
+type schoolCandidate struct {
+	id, name, zone, key string
+}
+
+// SchoolNameKey is a school name reduced for comparison: its ID dropped,
+// upper case, punctuation as spaces, words sorted.
+func SchoolNameKey(s string) string {
+	s = strings.ToUpper(Norm(s))
+	if id := DigitsOnlyKey(s); id != "" {
+		s = strings.ReplaceAll(s, id, " ")
+	}
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// MatchSchoolNames places the employees without a school ID by name,
+// among the schools of their own zone where it has any, setting SchoolID
+// and SchoolName on a match scoring at least threshold. It returns every
+// employee it tried, matched or not, in employee ID order.
+func MatchSchoolNames(emp map[string]model.Employee, sch map[string]model.School, threshold float64) []SchoolMatch {
+	var all []schoolCandidate
+	byZone := map[string][]schoolCandidate{}
+	for id, s := range sch {
+		c := schoolCandidate{id: id, name: s.Name, zone: s.Zone, key: SchoolNameKey(s.Name)}
+		all = append(all, c)
+		byZone[s.Zone] = append(byZone[s.Zone], c)
+	}
+	ids := make([]string, 0, len(emp))
+	for id, e := range emp {
+		if e.SchoolID == "" && strings.TrimSpace(e.SchoolName) != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	out := make([]SchoolMatch, 0, len(ids))
+	for _, id := range ids {
+		e := emp[id]
+		m := SchoolMatch{EmpID: id, Zone: e.Zone, Given: e.SchoolName}
+		pool := byZone[e.Zone]
+		if len(pool) == 0 {
+			pool = all
+		}
+		key := SchoolNameKey(e.SchoolName)
+		nums := numberWords(key)
+		var best schoolCandidate
+		for _, c := range pool {
+			if nums != "" && numberWords(c.key) != nums {
+				continue // "PHASE 2" is not "PHASE 3"
+			}
+			score := tokenSetSimilarity(key, c.key)
+			switch {
+			case score > m.Score || (score == m.Score && c.id < best.id):
+				m.Runner = max(m.Runner, m.Score)
+				m.Score, best = score, c
+			case score > m.Runner:
+				m.Runner = score
+			}
+		}
+		if best.id != "" && m.Score >= threshold && m.Score-m.Runner >= schoolMargin {
+			m.SchoolID, m.SchoolName = best.id, best.name
+			e.SchoolID, e.SchoolName = best.id, best.name
+			emp[id] = e
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// numberWords are the words of a name key that are numbers.
+func numberWords(key string) string {
+	var out []string
+	for _, w := range strings.Fields(key) {
+		if w[0] >= '0' && w[0] <= '9' {
+			out = append(out, w)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// tokenSetSimilarity compares two name keys as sets of words: the words
+// they share, then each with the rest of its own words, taking the best
+// similarity of the three. A name whose words are all in the other's
+// scores 1, so "MASIH GARH" matches "MASIH GARH (CO-ED)".
+func tokenSetSimilarity(a, b string) float64 {
+	wa, wb := map[string]bool{}, map[string]bool{}
+	for _, w := range strings.Fields(a) {
+		wa[w] = true
+	}
+	for _, w := range strings.Fields(b) {
+		wb[w] = true
+	}
+	var both, onlyA, onlyB []string
+	for w := range wa {
+		if wb[w] {
+			both = append(both, w)
+		} else {
+			onlyA = append(onlyA, w)
+		}
+	}
+	for w := range wb {
+		if !wa[w] {
+			onlyB = append(onlyB, w)
+		}
+	}
+	if len(both) == 0 {
+		return similarity(a, b)
+	}
+	sort.Strings(both)
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	t0 := strings.Join(both, " ")
+	t1 := strings.TrimSpace(t0 + " " + strings.Join(onlyA, " "))
+	t2 := strings.TrimSpace(t0 + " " + strings.Join(onlyB, " "))
+	return max(similarity(t0, t1), similarity(t0, t2), similarity(t1, t2))
+}
+
+// similarity is 1 less the Levenshtein distance between a and b over the
+// longer's length.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	n := max(len(ra), len(rb))
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(n)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,256 @@
+package ingest
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadTable reads a CSV or, for a .xlsx path, the first worksheet of an
+// Excel workbook.
+func ReadTable(p string) (*Table, error) {
+	if strings.EqualFold(filepath.Ext(p), ".xlsx") {
+		return ReadXLSX(p)
+	}
+	return ReadCSV(p)
+}
+
+// ReadXLSX reads the first worksheet of an Excel workbook the way ReadCSV
+// reads a CSV: the first non-empty row is the header and cells are
+// normalised. Numbers are written out in full ("95054834", not
+// "9.5054834E7" or "95054834.0") and date-formatted cells as DD/Mon/YYYY,
+// the form the portal's CSV exports use.
+func ReadXLSX(p string) (*Table, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", p, err)
+	}
+	defer zr.Close()
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	decode := func(name string, v any) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s: no %s", p, name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		if err := xml.NewDecoder(rc).Decode(v); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %s: %v", p, name, err)
+		}
+		return nil
+	}
+
+	var wb xlsxWorkbook
+	var rels xlsxRels
+	if err := decode("xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, fmt.Errorf("%s: no worksheets", p)
+	}
+	sheetPath := ""
+	for _, r := range rels.Rels {
+		if r.ID == wb.Sheets[0].RID {
+			sheetPath = r.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var sst xlsxSST
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+	}
+	var styles xlsxStyles
+	if _, ok := files["xl/styles.xml"]; ok {
+		if err := decode("xl/styles.xml", &styles); err != nil {
+			return nil, err
+		}
+	}
+	isDate := styles.dateStyles()
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if wb.Pr.Date1904 == "1" || wb.Pr.Date1904 == "true" {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var ws xlsxWorksheet
+	if err := decode(sheetPath, &ws); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, row := range ws.Rows {
+		var rec []string
+		empty := true
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColIndex(c.Ref)
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			v := ""
+			switch c.T {
+			case "s":
+				if n, err := strconv.Atoi(c.V); err == nil && n >= 0 && n < len(sst.SI) {
+					v = sst.SI[n].text()
+				}
+			case "inlineStr":
+				v = c.IS.text()
+			case "str":
+				v = c.V
+			case "e":
+				// #N/A and friends read as blank
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.V]
+			case "d":
+				if d, err := time.Parse("2006-01-02", strings.SplitN(c.V, "T", 2)[0]); err == nil {
+					v = d.Format("02/Jan/2006")
+				}
+			default:
+				v = xlsxNumber(c.V, isDate[c.S], epoch)
+			}
+			if v = Norm(v); v != "" {
+				empty = false
+			}
+			rec[col] = v
+		}
+		if !empty {
+			rows = append(rows, rec)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("header %s: empty worksheet", p)
+	}
+	return &Table{Path: p, Header: rows[0], Rows: rows[1:], Index: IdxMap(rows[0])}, nil
+}
+
+// xlsxNumber formats a numeric cell.
+func xlsxNumber(raw string, date bool, epoch time.Time) string {
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil {
+		return raw
+	}
+	if date && f > 0 {
+		return epoch.AddDate(0, 0, int(math.Floor(f))).Format("02/Jan/2006")
+	}
+	// Excel keeps 15 significant digits; rounding there drops binary
+	// noise like 0.30000000000000004.
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// xlsxColIndex is the zero-based column of a cell reference such as "AB12".
+func xlsxColIndex(ref string) int {
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n - 1
+}
+
+type xlsxWorkbook struct {
+	Pr struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxSI is a shared or inline string: plain <t> or rich-text runs.
+type xlsxSI struct {
+	T *string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (si xlsxSI) text() string {
+	if si.T != nil {
+		return *si.T
+	}
+	var b strings.Builder
+	for _, r := range si.R {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSST struct {
+	SI []xlsxSI `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	Xfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+var rxFmtLiteral = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+// dateStyles reports, per cell style index, whether it formats numbers as
+// dates: the built-in date formats (14-17 and 22; 18-21 and 45-47 are times
+// of day and durations) or a custom format with a day or year in it.
+func (st xlsxStyles) dateStyles() map[int]bool {
+	custom := map[int]bool{}
+	for _, f := range st.NumFmts {
+		code := strings.ToLower(rxFmtLiteral.ReplaceAllString(f.Code, ""))
+		custom[f.ID] = strings.ContainsAny(code, "dy")
+	}
+	out := map[int]bool{}
+	for i, xf := range st.Xfs {
+		id := xf.NumFmtID
+		out[i] = (id >= 14 && id <= 17) || id == 22 || custom[id]
+	}
+	return out
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref string `xml:"r,attr"`
+			T   string `xml:"t,attr"`
+			S   int    `xml:"s,attr"`
+			V   string `xml:"v"`
+			IS  xlsxSI `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
@@ -0,0 +1,24 @@
+package ingest
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestDateStyles(t *testing.T) {
+	var st xlsxStyles
+	err := xml.Unmarshal([]byte(`<styleSheet>
+<numFmts><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/><numFmt numFmtId="165" formatCode="[h]:mm"/></numFmts>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="22"/><xf numFmtId="20"/>
+<xf numFmtId="45"/><xf numFmtId="46"/><xf numFmtId="47"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs>
+</styleSheet>`), &st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := st.dateStyles()
+	for i, want := range []bool{false, true, true, false, false, false, false, true, false} {
+		if got[i] != want {
+			t.Errorf("style %d (numFmtId %d): date = %v, want %v", i, st.Xfs[i].NumFmtID, got[i], want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ---- Input anomalies ----
+//
+// Each monthly export is compared with the served build before it is
+// published, to catch a truncated or garbled upstream file rather than
+// publish it:
+//
+//   - a zone's employee count falling by more than -anomaly-staff-drop percent
+//   - a school's enrolment growing by -anomaly-enrolment-jump percent or more
+//     (100 = doubling; schools under 50 children are left out)
+//   - a selection category's share of employees moving by
+//     -anomaly-category-shift percentage points or more
+//
+// A rebuild showing any of these is staged for an admin's approval
+// (stage.go) with the anomalies listed, even without -stage; with
+// -anomaly-hold=false it is published and they are only logged. A
+// threshold of 0 turns its check off. The build made at startup has
+// nothing to compare with.
+
+var (
+	anomalyHold          = flag.Bool("anomaly-hold", true, "Hold a rebuild whose inputs look anomalous for an admin's approval")
+	anomalyStaffDrop     = flag.Float64("anomaly-staff-drop", 5, "Flag a zone whose employee count falls by more than this percent (0 = off)")
+	anomalyEnrolmentJump = flag.Float64("anomaly-enrolment-jump", 100, "Flag a school whose enrolment grows by this percent or more (0 = off)")
+	anomalyCategoryShift = flag.Float64("anomaly-category-shift", 10, "Flag a selection category whose share of employees moves by this many points (0 = off)")
+)
+
+// anomalyMinEnrolment keeps small schools, where a few admissions double
+// the roll, out of the enrolment check.
+const anomalyMinEnrolment = 50
+
+const (
+	kindStaffDrop     = "staff_drop"
+	kindEnrolmentJump = "enrolment_jump"
+	kindCategoryShift = "category_shift"
+)
+
+// InputAnomaly is one suspicious change from the served build; From and
+// To are counts, or percent shares for a category shift.
+type InputAnomaly struct {
+	Kind   string  `json:"kind"`
+	Scope  string  `json:"scope"` // zone, school id or category
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+	Detail string  `json:"detail"`
+}
+
+// inputAnomalies compares a new build with the served one.
+func inputAnomalies(served, next *Dataset) []InputAnomaly {
+	out := []InputAnomaly{}
+	if *anomalyStaffDrop > 0 {
+		from, to := zoneHeadcounts(served), zoneHeadcounts(next)
+		for _, z := range sortedKeys(from) {
+			f, n := float64(from[z]), float64(to[z])
+			if drop := (f - n) / f * 100; drop > *anomalyStaffDrop {
+				out = append(out, InputAnomaly{Kind: kindStaffDrop, Scope: z, From: f, To: n,
+					Detail: fmt.Sprintf("%s: employees %d → %d (−%.1f%%)", z, from[z], to[z], drop)})
+			}
+		}
+	}
+	if *anomalyEnrolmentJump > 0 {
+		for _, id := range sortedKeys(served.SCH) {
+			s, ok := next.SCH[id]
+			f := served.SCH[id].TotalEnrolment
+			if !ok || f < anomalyMinEnrolment {
+				continue
+			}
+			if rise := float64(s.TotalEnrolment-f) / float64(f) * 100; rise >= *anomalyEnrolmentJump {
+				out = append(out, InputAnomaly{Kind: kindEnrolmentJump, Scope: id, From: float64(f), To: float64(s.TotalEnrolment),
+					Detail: fmt.Sprintf("%s %s: enrolment %d → %d (+%.0f%%)", id, s.Name, f, s.TotalEnrolment, rise)})
+			}
+		}
+	}
+	if *anomalyCategoryShift > 0 {
+		from, to := categoryShares(served), categoryShares(next)
+		cats := map[string]bool{}
+		for c := range from {
+			cats[c] = true
+		}
+		for c := range to {
+			cats[c] = true
+		}
+		for _, c := range sortedKeys(cats) {
+			if shift := to[c] - from[c]; math.Abs(shift) >= *anomalyCategoryShift {
+				out = append(out, InputAnomaly{Kind: kindCategoryShift, Scope: c, From: round1(from[c]), To: round1(to[c]),
+					Detail: fmt.Sprintf("category %s: %.1f%% → %.1f%% of employees (%+.1f points)", c, from[c], to[c], shift)})
+			}
+		}
+	}
+	return out
+}
+
+func zoneHeadcounts(ds *Dataset) map[string]int {
+	out := map[string]int{}
+	for _, e := range ds.EMP {
+		out[e.Zone]++
+	}
+	return out
+}
+
+// categoryShares is each selection category's percent of the employees
+// that have one.
+func categoryShares(ds *Dataset) map[string]float64 {
+	counts, n := map[string]int{}, 0
+	for _, e := range ds.EMP {
+		if c := strings.ToUpper(strings.TrimSpace(e.SelectionCategory)); c != "" {
+			counts[c]++
+			n++
+		}
+	}
+	out := map[string]float64{}
+	for c, k := range counts {
+		out[c] = float64(k) / float64(n) * 100
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func round1(v float64) float64 { return math.Round(v*10) / 10 }
+
+// logAnomalies reports what inputAnomalies found in t's rebuild.
+func logAnomalies(t *Tenant, list []InputAnomaly) {
+	log.Printf("⚠️ Rebuild of %s looks anomalous (%d finding(s)):", t.ID, len(list))
+	for i, a := range list {
+		if i == 20 {
+			log.Printf("   … and %d more", len(list)-i)
+			break
+		}
+		log.Printf("   %s", a.Detail)
+	}
+}
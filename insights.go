@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Insights ----
+//
+// How the school indicators go together: for each pair in insightPairs
+// (pupil-teacher ratio against exam results, DBT coverage against
+// attendance, ...) Pearson's r across the schools that have both, written
+// up as a sentence for the monthly review. A pair needs insightMinSchools
+// schools; exam results, mid-day meals and classrooms only count with
+// -results, -mdm and -infra. Strongest first:
+//
+//	GET /api/insights[?zone=][&format=pdf]
+//	mcd insights <out.json|out.pdf> [tenant]
+//
+// The review pack (reviewpack.go) has them as its Insights sheet.
+
+const insightMinSchools = 10
+
+// schoolIndicator is one figure of a school; ok is false where it has none.
+type schoolIndicator struct {
+	Label string
+	Get   func(s School, st SchoolStaff) (v float64, ok bool)
+}
+
+var schoolIndicators = map[string]schoolIndicator{
+	"ptr": {"pupil-teacher ratio", func(_ School, st SchoolStaff) (float64, bool) { return st.Ratio, st.ActualTeachers > 0 }},
+	"attendance": {"attendance", func(s School, _ SchoolStaff) (float64, bool) {
+		return attendancePct(s), s.TotalEnrolment > 0
+	}},
+	"dbt": {"DBT coverage", func(s School, _ SchoolStaff) (float64, bool) {
+		return pct1(s.DBTTotal, s.TotalEnrolment), s.TotalEnrolment > 0
+	}},
+	"aadhaar": {"Aadhaar coverage", func(s School, _ SchoolStaff) (float64, bool) {
+		return pct1(s.WithAadhaar, s.TotalEnrolment), s.TotalEnrolment > 0
+	}},
+	"account": {"bank account coverage", func(s School, _ SchoolStaff) (float64, bool) {
+		return pct1(s.WithAccount, s.TotalEnrolment), s.TotalEnrolment > 0
+	}},
+	"pass":  {"pass percentage", func(s School, _ SchoolStaff) (float64, bool) { return s.PassPct, s.HasResults }},
+	"score": {"mean exam score", func(s School, _ SchoolStaff) (float64, bool) { return s.AvgScore, s.AvgScore > 0 }},
+	"mdm":   {"mid-day meal coverage", func(s School, _ SchoolStaff) (float64, bool) { return s.MDMCoverage, s.HasMDM }},
+	"room_load": {"students per classroom", func(s School, _ SchoolStaff) (float64, bool) {
+		if s.Classrooms <= 0 {
+			return 0, false
+		}
+		return float64(s.TotalEnrolment) / float64(s.Classrooms), true
+	}},
+}
+
+var insightPairs = [][2]string{
+	{"ptr", "pass"}, {"ptr", "score"}, {"attendance", "pass"}, {"room_load", "pass"}, {"mdm", "attendance"},
+	{"dbt", "attendance"}, {"ptr", "attendance"}, {"aadhaar", "dbt"}, {"account", "dbt"},
+}
+
+type Insight struct {
+	X        string  `json:"x"`
+	Y        string  `json:"y"`
+	R        float64 `json:"r"`
+	Schools  int     `json:"schools"`
+	Strength string  `json:"strength"` // strong, moderate, weak or none
+	Text     string  `json:"text"`
+}
+
+func correlationStrength(r float64) string {
+	switch a := math.Abs(r); {
+	case a >= 0.5:
+		return "strong"
+	case a >= 0.3:
+		return "moderate"
+	case a >= 0.1:
+		return "weak"
+	}
+	return "none"
+}
+
+// buildInsights correlates insightPairs across the schools of zone ("" =
+// all).
+func buildInsights(ds *Dataset, zone string) []Insight {
+	rosters := rosterBySchool(ds.EMP)
+	type point struct {
+		s  School
+		st SchoolStaff
+	}
+	var schools []point
+	for id, s := range ds.SCH {
+		if zone == "" || s.Zone == zone {
+			schools = append(schools, point{s, schoolStaff(s, rosters[id])})
+		}
+	}
+	out := []Insight{}
+	for _, p := range insightPairs {
+		x, y := schoolIndicators[p[0]], schoolIndicators[p[1]]
+		var xs, ys []float64
+		for _, pt := range schools {
+			xv, okx := x.Get(pt.s, pt.st)
+			yv, oky := y.Get(pt.s, pt.st)
+			if okx && oky {
+				xs, ys = append(xs, xv), append(ys, yv)
+			}
+		}
+		if len(xs) < insightMinSchools {
+			continue
+		}
+		r, ok := pearson(xs, ys)
+		if !ok {
+			continue
+		}
+		in := Insight{X: p[0], Y: p[1], R: r, Schools: len(xs), Strength: correlationStrength(r)}
+		if in.Strength == "none" {
+			in.Text = fmt.Sprintf("No clear relation between %s and %s across %d schools (r = %.2f).", x.Label, y.Label, in.Schools, r)
+		} else {
+			dir := "higher"
+			if r < 0 {
+				dir = "lower"
+			}
+			in.Text = fmt.Sprintf("Schools with a higher %s tend to have a %s %s (r = %.2f, %s, %d schools).",
+				x.Label, dir, y.Label, r, in.Strength, in.Schools)
+		}
+		out = append(out, in)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return math.Abs(out[i].R) > math.Abs(out[j].R) })
+	return out
+}
+
+func insightsPDF(t *Tenant, ds *Dataset, zone string, list []Insight) []byte {
+	scope := "all zones"
+	if zone != "" {
+		scope = "zone " + zone
+	}
+	d := newPDF("System-generated from " + t.PageTitle() + " data as of " + ds.BuiltAt.Format("02 Jan 2006") +
+		". Correlation across schools, not cause and effect.")
+	d.Title("Insights")
+	d.Text(t.PageTitle() + " · " + scope + " · generated " + time.Now().Format("02 Jan 2006 15:04"))
+	d.Heading("What goes with what")
+	if len(list) == 0 {
+		d.Text(fmt.Sprintf("Too few schools (under %d) have the figures to compare.", insightMinSchools))
+	}
+	for _, in := range list {
+		d.Para(in.Text)
+	}
+	d.Heading("Figures")
+	widths := []float64{0.34, 0.34, 0.1, 0.1, 0.12}
+	d.Row(true, widths, "Indicator", "Against", "r", "Schools", "Strength")
+	for _, in := range list {
+		d.Row(false, widths, schoolIndicators[in.X].Label, schoolIndicators[in.Y].Label,
+			strconv.FormatFloat(in.R, 'f', 2, 64), strconv.Itoa(in.Schools), in.Strength)
+	}
+	return d.Bytes()
+}
+
+// GET /api/insights
+func handleInsights(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds, q := tenantFor(r), dataFor(r), r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	list := buildInsights(ds, zone)
+	if q.Get("format") == "pdf" {
+		pdf := insightsPDF(t, ds, zone, list)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="insights_`+ds.BuiltAt.Format("2006-01")+`.pdf"`)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+		_, _ = w.Write(pdf)
+		return
+	}
+	writeData(w, list, nil)
+}
+
+// cmdInsights is the insights subcommand: flag.Args() holds the output path
+// (.pdf for a PDF, JSON otherwise) and an optional tenant id.
+func cmdInsights([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: insights <out.json|out.pdf> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	ds := buildAll(t.inputs())
+	list := buildInsights(ds, "")
+	var data []byte
+	if strings.HasSuffix(strings.ToLower(args[0]), ".pdf") {
+		data = insightsPDF(t, ds, "", list)
+	} else if data, err = json.MarshalIndent(list, "", "  "); err != nil {
+		return err
+	}
+	if err := os.WriteFile(args[0], data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%d insight(s) for %s written to %s\n", len(list), t.ID, args[0])
+	return nil
+}
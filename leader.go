@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---- Leader election ----
+//
+// Several instances may run behind a load balancer against one shared -db
+// (a postgres:// URL). They elect a leader through a lease row in that
+// database, and only the leader runs the digest, subscription and OGD
+// schedules or sends campaigns, so nobody gets the same greeting twice. The
+// leader renews its lease every third of -lease; if it dies another
+// instance takes over once the lease runs out. Instances' clocks must agree
+// to within a few seconds.
+//
+//	GET /api/leader
+//
+// Without -db there is nothing to share and every instance leads. With -db
+// set but unreachable none does.
+
+var (
+	instanceName = flag.String("instance", "", "This instance's name in leader election (default host:pid)")
+	leaseTTL     = flag.Duration("lease", 30*time.Second, "Leader lease length for instances sharing -db")
+)
+
+const leaderLease = "scheduler"
+
+type LeaderStatus struct {
+	Instance string    `json:"instance"`
+	Leader   bool      `json:"leader"`
+	Holder   string    `json:"holder,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var leader struct {
+	mu sync.Mutex
+	st LeaderStatus
+}
+
+func instanceID() string {
+	if *instanceName != "" {
+		return *instanceName
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// acquireLease takes or renews the named lease for holder unless someone
+// else holds it unexpired, and returns whoever holds it now.
+func acquireLease(db *sql.DB, name, holder string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	_, err := db.Exec(bind(`INSERT INTO leases (name, holder, expires) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE leases.holder = excluded.holder OR leases.expires < ?`),
+		name, holder, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	var cur string
+	var until int64
+	if err := db.QueryRow(bind(`SELECT holder, expires FROM leases WHERE name = ?`), name).Scan(&cur, &until); err != nil {
+		return "", time.Time{}, err
+	}
+	return cur, time.UnixMilli(until), nil
+}
+
+// electLeader runs one election round and logs changes of leadership.
+func electLeader(db *sql.DB) {
+	st := LeaderStatus{Instance: instanceID()}
+	holder, until, err := acquireLease(db, leaderLease, st.Instance, *leaseTTL)
+	if err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Holder, st.Until, st.Leader = holder, until, holder == st.Instance
+	}
+	leader.mu.Lock()
+	prev := leader.st
+	leader.st = st
+	leader.mu.Unlock()
+	switch {
+	case st.Error != "" && prev.Error == "":
+		log.Printf("leader election: %v", err)
+	case st.Leader && !prev.Leader:
+		log.Printf("👑 %s is now the leader", st.Instance)
+	case !st.Leader && st.Holder != prev.Holder:
+		log.Printf("👑 %s follows %s", st.Instance, st.Holder)
+	}
+}
+
+// startLeaderElection holds one election right away (so schedules know
+// where they stand) and keeps renewing in the background.
+func startLeaderElection() {
+	if *dbPath == "" {
+		return
+	}
+	db := store()
+	if db == nil {
+		leader.st = LeaderStatus{Instance: instanceID(), Error: "no database"}
+		log.Printf("leader election: -db unavailable; this instance will not run schedules or campaigns")
+		return
+	}
+	electLeader(db)
+	go func() {
+		for range time.Tick(*leaseTTL / 3) {
+			electLeader(db)
+		}
+	}()
+}
+
+func leaderStatus() LeaderStatus {
+	if *dbPath == "" {
+		return LeaderStatus{Instance: instanceID(), Leader: true}
+	}
+	leader.mu.Lock()
+	defer leader.mu.Unlock()
+	st := leader.st
+	st.Leader = st.Leader && time.Now().Before(st.Until)
+	return st
+}
+
+// isLeader reports whether this instance may run schedules and campaigns.
+func isLeader() bool { return leaderStatus().Leader }
+
+// requireLeader answers 409 on a follower, naming the leader.
+func requireLeader(w http.ResponseWriter) bool {
+	st := leaderStatus()
+	if st.Leader {
+		return true
+	}
+	detail := "this instance is not the leader"
+	if st.Holder != "" {
+		detail += "; " + st.Holder + " sends campaigns"
+	}
+	writeError(w, http.StatusConflict, errConflict, detail)
+	return false
+}
+
+// GET /api/leader
+func handleAPILeader(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeData(w, leaderStatus(), nil)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Long-stay report ----
+//
+// Continuous tenure at the current school, for the rotation policy of the
+// annual transfer exercise. The posting date is the most recent evidence of
+// the employee arriving at the school they are at now:
+//
+//   - "Joining Date (Present School)" from the Services file,
+//   - a transfer order to that school that has been joined (transfers.go),
+//   - a school change recorded in the change history (history.go),
+//
+// falling back to the last transfer order date and finally the date of
+// joining service for those never transferred.
+//
+//	GET /api/longstay[?years=10][&zone=][&school=][&group=zone|school][&format=csv|xlsx]
+
+var rotationYears = flag.Int("rotation-years", 10, "Tenure at one school (years) after which an employee is due for rotation")
+
+type LongStay struct {
+	EmpID        string  `json:"emp_id"`
+	Name         string  `json:"name"`
+	Designation  string  `json:"designation"`
+	Zone         string  `json:"zone"`
+	SchoolID     string  `json:"school_id"`
+	School       string  `json:"school"`
+	Since        string  `json:"since"` // YYYY-MM-DD
+	Basis        string  `json:"basis"`
+	Years        float64 `json:"years"`
+	PendingOrder string  `json:"pending_order,omitempty"` // already ordered out, not yet joined
+}
+
+type LongStayGroup struct {
+	Key      string  `json:"key"`
+	Name     string  `json:"name,omitempty"`
+	Zone     string  `json:"zone"`
+	Count    int     `json:"count"`
+	MaxYears float64 `json:"max_years"`
+}
+
+// postingDate is when e arrived at their current school and what that is
+// based on; ok is false when no date can be established.
+func postingDate(e Emp, orders []TransferOrder, hist []HistoryEntry) (at time.Time, basis string, ok bool) {
+	later := func(d time.Time, b string) {
+		if d.After(at) {
+			at, basis, ok = d, b, true
+		}
+	}
+	if d, err := ingest.ParseDMYFlexible(e.PresentSchoolDate); err == nil {
+		later(d, "joining date (present school)")
+	}
+	for _, o := range orders {
+		if o.JoinedOn != nil && o.ToSchool == ingest.DigitsOnly(e.SchoolID) {
+			later(o.due(), "transfer order "+o.OrderNo)
+		}
+	}
+	for _, h := range hist {
+		if h.Field == "school_id" && h.To == e.SchoolID {
+			later(h.At, "school change recorded "+h.At.Format("02 Jan 2006"))
+		}
+	}
+	if ok {
+		return
+	}
+	if d, err := ingest.ParseDMYFlexible(e.TransferDate); err == nil {
+		return d, "last transfer order date", true
+	}
+	if d, err := ingest.ParseDMYFlexible(e.DOJ); err == nil {
+		return d, "date of joining (never transferred)", true
+	}
+	return at, "", false
+}
+
+// longStays lists employees at their school for at least years, longest
+// first.
+func longStays(t *Tenant, ds *Dataset, years int) []LongStay {
+	ordersByEmp := map[string][]TransferOrder{}
+	pending := map[string]string{}
+	if t.Transfers != "" {
+		for _, o := range t.transfers().List(ds) {
+			ordersByEmp[o.EmpID] = append(ordersByEmp[o.EmpID], o)
+			if o.Status == transferPending {
+				pending[o.EmpID] = o.OrderNo
+			}
+		}
+	}
+	now := time.Now()
+	cutoff := now.AddDate(-years, 0, 0)
+	out := []LongStay{}
+	for _, e := range ds.EMP {
+		if e.SchoolID == "" {
+			continue
+		}
+		var hist []HistoryEntry
+		if t.history != nil {
+			hist = t.history.For(e.ID)
+		}
+		at, basis, ok := postingDate(e, ordersByEmp[e.ID], hist)
+		if !ok || at.After(cutoff) {
+			continue
+		}
+		out = append(out, LongStay{
+			EmpID: e.ID, Name: e.Name, Designation: e.Designation, Zone: e.Zone,
+			SchoolID: e.SchoolID, School: ds.SCH[e.SchoolID].Name, Since: at.Format("2006-01-02"), Basis: basis,
+			Years: float64(int(now.Sub(at).Hours()/24/365.25*10)) / 10, PendingOrder: pending[e.ID],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Years != out[j].Years {
+			return out[i].Years > out[j].Years
+		}
+		return out[i].EmpID < out[j].EmpID
+	})
+	return out
+}
+
+func groupLongStays(list []LongStay, by string) []LongStayGroup {
+	m := map[string]*LongStayGroup{}
+	for _, l := range list {
+		key, name := l.Zone, ""
+		if by == "school" {
+			key, name = l.SchoolID, l.School
+		}
+		g := m[key]
+		if g == nil {
+			g = &LongStayGroup{Key: key, Name: name, Zone: l.Zone}
+			m[key] = g
+		}
+		g.Count++
+		if l.Years > g.MaxYears {
+			g.MaxYears = l.Years
+		}
+	}
+	out := make([]LongStayGroup, 0, len(m))
+	for _, g := range m {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+// GET /api/longstay
+func handleLongStay(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	q := r.URL.Query()
+	years := *rotationYears
+	if s := q.Get("years"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 40 {
+			writeError(w, 400, errBadRequest, "years must be 1-40")
+			return
+		}
+		years = n
+	}
+	group := q.Get("group")
+	if group != "" && group != "zone" && group != "school" {
+		writeError(w, 400, errBadRequest, "group must be zone or school")
+		return
+	}
+	zone, school := strings.ToUpper(q.Get("zone")), ingest.DigitsOnly(q.Get("school"))
+	list := []LongStay{}
+	for _, l := range longStays(tenantFor(r), dataFor(r), years) {
+		if (zone == "" || zone == allZones || l.Zone == zone) && (school == "" || l.SchoolID == school) {
+			list = append(list, l)
+		}
+	}
+	name := fmt.Sprintf("long_stay_%dy", years)
+	switch q.Get("format") {
+	case "csv":
+		rows := make([][]string, 0, len(list))
+		for _, l := range list {
+			rows = append(rows, []string{l.EmpID, l.Name, l.Designation, l.Zone, l.SchoolID, l.School, l.Since,
+				strconv.FormatFloat(l.Years, 'f', 1, 64), l.Basis, l.PendingOrder})
+		}
+		log.Printf("🏫 Long-stay list (%d) exported by %s", len(list), userFor(r).Name)
+		writeCSV(w, r, name+".csv", []string{"Employee ID", "Name", "Designation", "Zone", "School ID", "School",
+			"At School Since", "Years", "Basis", "Pending Transfer Order"}, rows)
+		return
+	case "xlsx":
+		b := &xlsxBook{}
+		ls := b.Sheet("Long Stay", "Employee ID", "Name", "Designation", "Zone", "School ID", "School",
+			"At School Since", "Years", "Basis", "Pending Transfer Order")
+		for _, l := range list {
+			ls.Row(l.EmpID, l.Name, l.Designation, l.Zone, l.SchoolID, l.School, l.Since, l.Years, l.Basis, l.PendingOrder)
+		}
+		bs := b.Sheet("By School", "School ID", "School", "Zone", "Employees", "Longest (years)")
+		for _, g := range groupLongStays(list, "school") {
+			bs.Row(g.Key, g.Name, g.Zone, g.Count, g.MaxYears)
+		}
+		bz := b.Sheet("By Zone", "Zone", "Employees", "Longest (years)")
+		for _, g := range groupLongStays(list, "zone") {
+			bz.Row(g.Key, g.Count, g.MaxYears)
+		}
+		log.Printf("🏫 Long-stay list (%d) exported by %s", len(list), userFor(r).Name)
+		writeXLSX(w, r, name+".xlsx", b)
+		return
+	}
+	if group != "" {
+		groups := groupLongStays(list, group)
+		writeData(w, groups, &Meta{Count: len(groups), Total: len(list)})
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
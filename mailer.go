@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// ---- Mail providers ----
+//
+// Mail leaves through a Mailer. SMTP (smtp.go) is the default; SendGrid
+// and Amazon SES take mail over their HTTP APIs instead, for volumes a
+// mailbox provider throttles. Campaigns, the queue and everything else
+// build the same mail whichever carries it. For HQ:
+//
+//	-mail-provider sendgrid -sendgrid-key SG.xxx        (or MCD_SENDGRID_KEY)
+//	-mail-provider ses -ses-region ap-south-1           (AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN)
+//
+// -mail-api-url points either at another endpoint (SendGrid's EU region,
+// an SES VPC endpoint). An account in the senders file picks one with
+// "provider"; a SendGrid account's "pass" (or "pass_env") is the API key,
+// an SES account has "region" and, unless the AWS_* variables should be
+// used, the access key in "user" and the secret in "pass":
+//
+//	"smtp": {"narela": {"provider": "sendgrid", "pass_env": "MCD_SENDGRID_NARELA"}}
+
+var (
+	mailProvider = flag.String("mail-provider", providerSMTP, "HQ mail provider: smtp, sendgrid or ses")
+	sendgridKey  = flag.String("sendgrid-key", "", "HQ SendGrid API key (prefer MCD_SENDGRID_KEY)")
+	sesRegion    = flag.String("ses-region", "", "HQ Amazon SES region, e.g. ap-south-1")
+	mailAPIURL   = flag.String("mail-api-url", "", "Base URL of the HQ provider's API (default the provider's own)")
+)
+
+const (
+	providerSMTP     = "smtp"
+	providerSendGrid = "sendgrid"
+	providerSES      = "ses"
+)
+
+// Mail is one message as handed to a provider.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string // HTML
+	MsgID   string // Message-ID local part, or ""
+	Files   []MailFile
+}
+
+// Mailer delivers mail from a sender's account. An error for which
+// permanentMailError is true won't be retried.
+type Mailer interface {
+	Send(from Sender, m Mail) error
+}
+
+// mailer is the Mailer for the account's provider.
+func (a *SMTPAccount) mailer() Mailer {
+	switch a.Provider {
+	case providerSendGrid:
+		return sendGridMailer{a}
+	case providerSES:
+		return sesMailer{a}
+	}
+	return smtpMailer{a}
+}
+
+// hqAccount is the -smtp-* account, or the -mail-provider one.
+func hqAccount() *SMTPAccount {
+	switch *mailProvider {
+	case providerSendGrid:
+		return &SMTPAccount{Provider: providerSendGrid, Host: *mailAPIURL, Pass: *sendgridKey}
+	case providerSES:
+		return &SMTPAccount{Provider: providerSES, Host: *mailAPIURL, Region: *sesRegion}
+	}
+	return &SMTPAccount{Provider: *mailProvider, Host: *smtpHost, Port: *smtpPort, TLS: *smtpTLS, Auth: *smtpAuth,
+		User: firstNonEmpty(*smtpUser, EmailFrom), Pass: *smtpPass}
+}
+
+// hqMailReady reports what the HQ account lacks to really send. Its SMTP
+// password is never built in: it comes from -smtp-pass or MCD_SMTP_PASS.
+func hqMailReady() error {
+	a := hqAccount()
+	if (a.Provider == "" || a.Provider == providerSMTP) && a.Pass == "" && a.needsPass() {
+		return errors.New("live mode needs -smtp-pass or MCD_SMTP_PASS")
+	}
+	return nil
+}
+
+// checkLive refuses to start in live mode when HQ mail can't go out.
+func checkLive() error {
+	if !LiveMode {
+		return nil
+	}
+	return hqMailReady()
+}
+
+// apiError is a provider API's refusal.
+type apiError struct {
+	Provider string
+	Status   int
+	Body     string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %d %s: %s", e.Provider, e.Status, http.StatusText(e.Status), strings.TrimSpace(e.Body))
+}
+
+// permanentMailError reports whether retrying err is pointless: a 5xx SMTP
+// reply, or an API rejecting the mail itself rather than throttling.
+func permanentMailError(err error) bool {
+	var te *textproto.Error
+	var ae *apiError
+	switch {
+	case errors.As(err, &te):
+		return te.Code >= 500
+	case errors.As(err, &ae):
+		return ae.Status >= 400 && ae.Status < 500 && ae.Status != http.StatusTooManyRequests && ae.Status != http.StatusRequestTimeout
+	}
+	return false
+}
+
+// mimeMessage is m as an RFC 5322 message from s.
+func mimeMessage(s Sender, m Mail) []byte {
+	msg := "From: " + headerValue(s.Name) + " <" + headerValue(s.From) + ">\r\n" +
+		"To: " + headerValue(m.To) + "\r\n"
+	if s.ReplyTo != "" {
+		msg += "Reply-To: " + headerValue(s.ReplyTo) + "\r\n"
+	}
+	if m.MsgID != "" {
+		msg += "Message-ID: " + headerValue(messageID(s, m.MsgID)) + "\r\n"
+	}
+	msg += "Subject: " + headerValue(m.Subject) + "\r\n" +
+		"MIME-version: 1.0;\r\n"
+	if len(m.Files) == 0 {
+		msg += "Content-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + m.Body
+	} else {
+		msg += multipartBody(m.Body, m.Files)
+	}
+	return []byte(msg)
+}
+
+// headerValue encodes v for a header line. Non-ASCII text and control
+// characters come out as an RFC 2047 encoded-word, so a CR or LF in a
+// subject or name can never start a header of its own.
+func headerValue(v string) string {
+	return mime.QEncoding.Encode("UTF-8", v)
+}
+
+func messageID(s Sender, local string) string {
+	return "<" + local + "@" + s.From[strings.LastIndex(s.From, "@")+1:] + ">"
+}
+
+var mailHTTP = &http.Client{Timeout: time.Minute}
+
+// postJSON posts body to url and turns a non-2xx answer into an apiError.
+func postJSON(provider, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := mailHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &apiError{Provider: provider, Status: resp.StatusCode, Body: string(b)}
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+type smtpMailer struct{ a *SMTPAccount }
+
+func (m smtpMailer) Send(s Sender, mail Mail) error {
+	if m.a.Pass == "" && m.a.needsPass() {
+		return fmt.Errorf("sender %q: no SMTP credentials", s.Name)
+	}
+	return smtpSend(s, mail.To, mimeMessage(s, mail))
+}
+
+// sendGridMailer uses SendGrid's v3 mail/send API.
+type sendGridMailer struct{ a *SMTPAccount }
+
+func (m sendGridMailer) Send(s Sender, mail Mail) error {
+	if m.a.Pass == "" {
+		return fmt.Errorf("sender %q: no SendGrid API key", s.Name)
+	}
+	type addr struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	type attachment struct {
+		Content     string `json:"content"`
+		Type        string `json:"type,omitempty"`
+		Filename    string `json:"filename"`
+		Disposition string `json:"disposition"`
+	}
+	req := struct {
+		Personalizations []map[string][]addr `json:"personalizations"`
+		From             addr                `json:"from"`
+		ReplyTo          *addr               `json:"reply_to,omitempty"`
+		Subject          string              `json:"subject"`
+		Content          []map[string]string `json:"content"`
+		Attachments      []attachment        `json:"attachments,omitempty"`
+		Headers          map[string]string   `json:"headers,omitempty"`
+	}{
+		Personalizations: []map[string][]addr{{"to": {{Email: mail.To}}}},
+		From:             addr{Email: s.From, Name: s.Name},
+		Subject:          mail.Subject,
+		Content:          []map[string]string{{"type": "text/html", "value": mail.Body}},
+	}
+	if s.ReplyTo != "" {
+		req.ReplyTo = &addr{Email: s.ReplyTo}
+	}
+	if mail.MsgID != "" {
+		req.Headers = map[string]string{"Message-ID": messageID(s, mail.MsgID)}
+	}
+	for _, f := range mail.Files {
+		req.Attachments = append(req.Attachments, attachment{Content: base64.StdEncoding.EncodeToString(f.Data),
+			Type: f.ContentType, Filename: f.Name, Disposition: "attachment"})
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	base := firstNonEmpty(m.a.Host, "https://api.sendgrid.com")
+	return postJSON(providerSendGrid, strings.TrimRight(base, "/")+"/v3/mail/send", b,
+		http.Header{"Authorization": {"Bearer " + m.a.Pass}})
+}
+
+// sesMailer uses the Amazon SES v2 SendEmail API with the raw message, so
+// attachments and headers come out as they would over SMTP.
+type sesMailer struct{ a *SMTPAccount }
+
+func (m sesMailer) Send(s Sender, mail Mail) error {
+	id, secret, token := m.a.User, m.a.Pass, ""
+	if id == "" {
+		id, secret, token = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if id == "" || secret == "" {
+		return fmt.Errorf("sender %q: no AWS credentials for SES", s.Name)
+	}
+	req := map[string]any{
+		"FromEmailAddress": s.From,
+		"Destination":      map[string][]string{"ToAddresses": {mail.To}},
+		"Content":          map[string]any{"Raw": map[string][]byte{"Data": mimeMessage(s, mail)}},
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	base := firstNonEmpty(m.a.Host, "https://email."+m.a.Region+".amazonaws.com")
+	url := strings.TrimRight(base, "/") + "/v2/email/outbound-emails"
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.TrimRight(base, "/"), "https://"), "http://")
+	return postJSON(providerSES, url, body, sigV4(host, "/v2/email/outbound-emails", m.a.Region, id, secret, token, body, time.Now()))
+}
+
+// sigV4 signs a JSON POST to host+path for the SES service (AWS Signature
+// Version 4) and returns the headers carrying the signature.
+func sigV4(host, path, region, id, secret, token string, body []byte, now time.Time) http.Header {
+	now = now.UTC()
+	amzDate, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	hash := func(b []byte) string { s := sha256.Sum256(b); return hex.EncodeToString(s[:]) }
+	mac := func(key []byte, s string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(s))
+		return h.Sum(nil)
+	}
+
+	names := []string{"content-type", "host", "x-amz-date"}
+	values := map[string]string{"content-type": "application/json", "host": host, "x-amz-date": amzDate}
+	if token != "" {
+		names = append(names, "x-amz-security-token")
+		values["x-amz-security-token"] = token
+	}
+	var canonical strings.Builder
+	for _, n := range names {
+		canonical.WriteString(n + ":" + values[n] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{http.MethodPost, path, "", canonical.String(), signed, hash(body)}, "\n")
+	scope := day + "/" + region + "/ses/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hash([]byte(request))}, "\n")
+	key := mac(mac(mac(mac([]byte("AWS4"+secret), day), region), "ses"), "aws4_request")
+
+	h := http.Header{}
+	h.Set("X-Amz-Date", amzDate)
+	if token != "" {
+		h.Set("X-Amz-Security-Token", token)
+	}
+	h.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		id, scope, signed, hex.EncodeToString(mac(key, toSign))))
+	return h
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMimeMessageHeaderInjection(t *testing.T) {
+	s := Sender{Name: "Zone Office", From: "zone@example.org"}
+	m := Mail{To: "teacher@example.org", Subject: "Holiday\r\nBcc: everyone@example.org", Body: "<p>hi</p>"}
+	msg := string(mimeMessage(s, m))
+	head := msg[:strings.Index(msg, "\r\n\r\n")]
+	for _, line := range strings.Split(head, "\r\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Fatalf("subject injected a header:\n%s", head)
+		}
+	}
+	if !strings.Contains(head, "Subject: =?UTF-8?q?") {
+		t.Errorf("subject not encoded:\n%s", head)
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Mail queue ----
+//
+// Outgoing mail (greetings, digests, grievance notices) is written to
+// -mail-spool before it is sent, so an SMTP server that is down or
+// throttling delays mail instead of losing it. A failed delivery is retried
+// after -mail-backoff, doubling each time up to -mail-backoff-max, until
+// -mail-retries attempts have been made; a mail the server refuses outright
+// (a 5xx SMTP reply, a 4xx from a provider API) isn't retried. Given-up
+// mails stay in the spool, listed and retryable from the API. While the
+// dashboard is in dry-run mode nothing queued is sent.
+//
+// The greeting endpoints queue their mails in the background and answer at
+// once with a job to follow:
+//
+//	GET  /preview-birthdays              what it would send (preview.go)
+//	POST /send-birthdays                 202 {"id": "<job>", ...}
+//	GET  /api/mail/jobs/{id}             queued, sent and failed so far
+//	GET  /api/mail/queue                 mails waiting or given up on
+//	POST /api/mail/queue/retry?id=       try a given-up mail again
+//
+// Subcommands (mcd send) try each mail once as they go and leave failures
+// in the spool for the server to retry. Each attempt is written to the
+// email log (emaillog.go).
+
+var (
+	mailSpool      = flag.String("mail-spool", "./out/mailq", "Directory holding outgoing mail until it is delivered")
+	mailRetries    = flag.Int("mail-retries", 8, "Delivery attempts before a mail is given up on")
+	mailBackoff    = flag.Duration("mail-backoff", time.Minute, "Wait before retrying a failed mail; doubles after each failure")
+	mailBackoffMax = flag.Duration("mail-backoff-max", 6*time.Hour, "Longest wait between retries of a mail")
+)
+
+type QueuedMail struct {
+	ID        string     `json:"id"`
+	Job       string     `json:"job,omitempty"`
+	Tenant    string     `json:"tenant,omitempty"`
+	FromName  string     `json:"from_name"`
+	From      string     `json:"from"`
+	ReplyTo   string     `json:"reply_to,omitempty"`
+	SMTP      string     `json:"smtp,omitempty"` // the sender's account in the senders file; "" = HQ
+	EmpID     string     `json:"emp_id,omitempty"`
+	MsgID     string     `json:"msg_id,omitempty"`
+	To        string     `json:"to"`
+	Subject   string     `json:"subject"`
+	Body      string     `json:"body,omitempty"`
+	Files     []MailFile `json:"files,omitempty"`
+	Queued    time.Time  `json:"queued"`
+	Attempts  int        `json:"attempts"`
+	NextAt    time.Time  `json:"next_at"`
+	LastError string     `json:"last_error,omitempty"`
+	Failed    bool       `json:"failed,omitempty"`
+
+	account *SMTPAccount // known while the process that queued it runs
+}
+
+// MailJob follows the mails one request queued.
+type MailJob struct {
+	ID       string         `json:"id"`
+	Tenant   string         `json:"tenant"`
+	Kind     string         `json:"kind"`
+	Started  time.Time      `json:"started"`
+	Done     bool           `json:"done"` // every mail is queued
+	Result   map[string]int `json:"result,omitempty"`
+	Queued   int            `json:"queued"`
+	Sent     int            `json:"sent"`
+	Failed   int            `json:"failed"`
+	Pending  int            `json:"pending"`
+	StatusAt string         `json:"status_url"`
+}
+
+var mailq = struct {
+	sync.Mutex
+	mails   map[string]*QueuedMail
+	jobs    map[string]*MailJob
+	wake    chan struct{}
+	running bool
+}{mails: map[string]*QueuedMail{}, jobs: map[string]*MailJob{}, wake: make(chan struct{}, 1)}
+
+func spoolPath(id string) string { return filepath.Join(*mailSpool, id+".json") }
+
+func (m *QueuedMail) save() error {
+	if err := os.MkdirAll(*mailSpool, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(spoolPath(m.ID)+".tmp", b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(spoolPath(m.ID)+".tmp", spoolPath(m.ID))
+}
+
+// sender rebuilds the identity the mail was queued under.
+func (m *QueuedMail) sender() (Sender, error) {
+	s := Sender{Name: m.FromName, From: m.From, SMTP: m.SMTP, ReplyTo: m.ReplyTo, account: m.account}
+	if s.account != nil {
+		return s, nil
+	}
+	if m.SMTP == "" {
+		s.account = hqSender().account
+		return s, nil
+	}
+	for _, t := range TENANTS {
+		if t.ID == m.Tenant && t.senders != nil && t.senders.SMTP[m.SMTP] != nil {
+			s.account = t.senders.SMTP[m.SMTP]
+			return s, nil
+		}
+	}
+	return s, errors.New("smtp account " + m.SMTP + " is no longer in the senders file")
+}
+
+// queueMail spools a mail from s and hands it to the queue; it fails only
+// if the mail can't be spooled. In dry-run mode it is logged, not queued.
+func queueMail(t *Tenant, job string, s Sender, msgID, to, subject, body string, files ...MailFile) error {
+	return queueMailFor(t, job, "", s, msgID, to, subject, body, files...)
+}
+
+// queueMailFor is queueMail for a mail to employee empID, who the email
+// log then names.
+func queueMailFor(t *Tenant, job, empID string, s Sender, msgID, to, subject, body string, files ...MailFile) error {
+	tenant := ""
+	if t != nil {
+		tenant = t.ID
+	}
+	if !t.live() {
+		logDrySend(s, to, subject, files...)
+		logEmail(tenant, EmailLogRecord{Job: job, EmpID: empID, From: s.From, To: to, Subject: subject, Status: mailDryRun})
+		mailq.Lock()
+		if j := mailq.jobs[job]; j != nil {
+			j.Queued++
+			j.Sent++
+		}
+		mailq.Unlock()
+		return nil
+	}
+	m := &QueuedMail{ID: newToken()[:16], Job: job, FromName: s.Name, From: s.From, ReplyTo: s.ReplyTo, SMTP: s.SMTP,
+		EmpID: empID, MsgID: msgID, To: to, Subject: subject, Body: body, Files: files, Queued: time.Now(), NextAt: time.Now(),
+		Tenant: tenant, account: s.account}
+	if err := m.save(); err != nil {
+		logEmail(tenant, EmailLogRecord{Job: job, EmpID: empID, From: s.From, To: to, Subject: subject,
+			Status: mailFailed, Error: "not queued: " + err.Error()})
+		return err
+	}
+	mailq.Lock()
+	mailq.mails[m.ID] = m
+	if j := mailq.jobs[job]; j != nil {
+		j.Queued++
+	}
+	running := mailq.running
+	mailq.Unlock()
+	if !running {
+		attemptMail(m)
+		return nil
+	}
+	select {
+	case mailq.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// attemptMail tries to deliver m once and records the outcome.
+func attemptMail(m *QueuedMail) {
+	s, err := m.sender()
+	if err == nil {
+		err = sendEmailFiles(s, m.MsgID, m.To, m.Subject, m.Body, m.Files...)
+	}
+	rec := EmailLogRecord{MailID: m.ID, Job: m.Job, EmpID: m.EmpID, From: m.From, To: m.To, Subject: m.Subject,
+		Status: mailSent, Attempt: m.Attempts + 1}
+	defer func() {
+		logEmail(m.Tenant, rec)
+		if rec.Status == mailFailed && addressRejected(err) {
+			if s := badEmailsFor(m.Tenant); s != nil {
+				s.Record(m.To, badEmailRejected, err.Error(), m.EmpID)
+			}
+		}
+	}()
+	mailq.Lock()
+	defer mailq.Unlock()
+	j := mailq.jobs[m.Job]
+	if err == nil {
+		delete(mailq.mails, m.ID)
+		os.Remove(spoolPath(m.ID))
+		if j != nil {
+			j.Sent++
+		}
+		return
+	}
+	m.Attempts++
+	m.LastError = err.Error()
+	rec.Status, rec.Error = mailRetrying, err.Error()
+	if permanentMailError(err) || m.Attempts >= *mailRetries {
+		m.Failed, rec.Status = true, mailFailed
+		if j != nil {
+			j.Failed++
+		}
+		log.Printf("✉️ Mail %s to %s given up after %d attempt(s): %v", m.ID, m.To, m.Attempts, err)
+	} else {
+		wait := min(*mailBackoff<<(m.Attempts-1), *mailBackoffMax)
+		if wait <= 0 { // shifted past int64
+			wait = *mailBackoffMax
+		}
+		m.NextAt = time.Now().Add(wait)
+		log.Printf("✉️ Mail %s to %s failed (attempt %d), retrying in %s: %v", m.ID, m.To, m.Attempts, wait, err)
+	}
+	if err := m.save(); err != nil {
+		log.Printf("mail spool: %v", err)
+	}
+}
+
+// startMailQueue loads the spool and delivers mail as it falls due.
+func startMailQueue() {
+	files, _ := filepath.Glob(filepath.Join(*mailSpool, "*.json"))
+	waiting := 0
+	mailq.Lock()
+	for _, p := range files {
+		b, err := os.ReadFile(p)
+		var m QueuedMail
+		if err == nil {
+			err = json.Unmarshal(b, &m)
+		}
+		if err != nil || m.ID == "" {
+			log.Printf("mail spool %s: unreadable, skipped: %v", p, err)
+			continue
+		}
+		mailq.mails[m.ID] = &m
+		if !m.Failed {
+			waiting++
+		}
+	}
+	mailq.running = true
+	mailq.Unlock()
+	if waiting > 0 {
+		log.Printf("✉️ %d mail(s) waiting in %s", waiting, *mailSpool)
+	}
+	go func() {
+		for {
+			next := time.Now().Add(time.Minute)
+			if due := dueMails(&next); len(due) > 0 {
+				for _, m := range due {
+					attemptMail(m)
+				}
+				continue // their retries may fall due before next
+			}
+			select {
+			case <-mailq.wake:
+			case <-time.After(time.Until(next)):
+			}
+		}
+	}()
+}
+
+// dueMails lists the mails to try now, oldest first, and moves next up to
+// the earliest one still to come. Nothing is due in dry-run mode.
+func dueMails(next *time.Time) []*QueuedMail {
+	mailq.Lock()
+	defer mailq.Unlock()
+	var due []*QueuedMail
+	now := time.Now()
+	for _, m := range mailq.mails {
+		switch {
+		case m.Failed:
+		case !LiveMode:
+		case !m.NextAt.After(now):
+			due = append(due, m)
+		case m.NextAt.Before(*next):
+			*next = m.NextAt
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Queued.Before(due[j].Queued) })
+	return due
+}
+
+// startMailJob runs a campaign in the background and answers with the job
+// following its mails.
+func startMailJob(w http.ResponseWriter, t *Tenant, kind string, run func(job string) map[string]int) {
+	writeJSON(w, http.StatusAccepted, Envelope{Data: runMailJob(t, kind, run)})
+}
+
+// runMailJob starts run in the background under a new mail job.
+func runMailJob(t *Tenant, kind string, run func(job string) map[string]int) *MailJob {
+	j := &MailJob{ID: newToken()[:12], Tenant: t.ID, Kind: kind, Started: time.Now()}
+	j.StatusAt = t.Prefix + "/api/mail/jobs/" + j.ID
+	mailq.Lock()
+	for id, old := range mailq.jobs {
+		if time.Since(old.Started) > 7*24*time.Hour {
+			delete(mailq.jobs, id)
+		}
+	}
+	mailq.jobs[j.ID] = j
+	mailq.Unlock()
+	go func() {
+		res := run(j.ID)
+		mailq.Lock()
+		j.Result, j.Done = res, true
+		queued := j.Queued
+		mailq.Unlock()
+		log.Printf("✉️ %s job %s for %s: %d mail(s) queued", kind, j.ID, t.ID, queued)
+	}()
+	return mailJob(j.ID)
+}
+
+// mailJob is a copy of job id with Pending filled in, or nil.
+func mailJob(id string) *MailJob {
+	mailq.Lock()
+	defer mailq.Unlock()
+	j := mailq.jobs[id]
+	if j == nil {
+		return nil
+	}
+	c := *j
+	c.Pending = c.Queued - c.Sent - c.Failed
+	return &c
+}
+
+// GET /api/mail/jobs/{id}
+func handleMailJob(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	j := mailJob(r.PathValue("id"))
+	if j == nil || j.Tenant != tenantFor(r).ID {
+		writeError(w, 404, errNotFound, "no such mail job (jobs are kept a week, and not across restarts)")
+		return
+	}
+	writeData(w, j, nil)
+}
+
+// GET /api/mail/queue
+func handleMailQueue(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	out := []QueuedMail{}
+	mailq.Lock()
+	for _, m := range mailq.mails {
+		if m.Tenant == t.ID || m.Tenant == "" {
+			c := *m
+			c.Body, c.Files = "", nil
+			out = append(out, c)
+		}
+	}
+	mailq.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Queued.Before(out[j].Queued) })
+	writeData(w, out, nil)
+}
+
+// POST /api/mail/queue/retry?id=
+func handleMailRetry(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	mailq.Lock()
+	m := mailq.mails[id]
+	if m == nil || (m.Tenant != tenantFor(r).ID && m.Tenant != "") {
+		mailq.Unlock()
+		writeError(w, 404, errNotFound, "no queued mail "+id)
+		return
+	}
+	if !m.Failed {
+		mailq.Unlock()
+		writeError(w, 409, errConflict, "mail "+id+" is still being retried")
+		return
+	}
+	if j := mailq.jobs[m.Job]; j != nil {
+		j.Failed--
+	}
+	m.Failed, m.Attempts, m.NextAt = false, 0, time.Now()
+	err := m.save()
+	c := *m
+	mailq.Unlock()
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	log.Printf("✉️ Mail %s to %s requeued by %s", id, c.To, userFor(r).Name)
+	select {
+	case mailq.wake <- struct{}{}:
+	default:
+	}
+	c.Body, c.Files = "", nil
+	writeData(w, c, nil)
+}
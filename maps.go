@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Zone map ----
+//
+// Zone boundaries come from a GeoJSON FeatureCollection (-zones-geojson,
+// or "zones_geojson" in a tenant), one Polygon or MultiPolygon feature per
+// zone, named by a "zone", "zone_name" or "name" property ("Karol Bagh
+// Zone" matches KAROL BAGH). School coordinates come from a CSV
+// (-school-locations, or "school_locations"): a school column ("School ID"
+// or "School Name & ID") with "Latitude" and "Longitude".
+//
+// The zones are served as GeoJSON with each zone's figures in its
+// properties, ready to shade: the chosen metric's value, its class (0-4,
+// by quintile across the zones, 4 the best) and the class's colour, with
+// the legend as a foreign member. The schools with coordinates are points.
+// /map draws both as SVG, with no map tiles to fetch:
+//
+//	GET /api/map/zones[?metric=dbt_pct|ptr|vacancies|aadhaar_pct]
+//	GET /api/map/schools[?zone=]
+//	GET /map[?metric=][&zone=]
+//
+// Zones without a feature are listed in the collection's "unmatched_zones".
+
+var (
+	zonesGeoJSON    = flag.String("zones-geojson", "", "GeoJSON FeatureCollection of zone boundaries for the map (optional)")
+	schoolLocations = flag.String("school-locations", "", "CSV of school latitude and longitude for the map (optional)")
+)
+
+// choroplethPalette runs from the worst class to the best.
+var choroplethPalette = []string{"#b91c1c", "#ea580c", "#facc15", "#84cc16", "#16a34a"}
+
+// choroplethMetric is a zone figure the map can shade by.
+type choroplethMetric struct {
+	Label       string
+	Value       func(ZoneKPI) float64
+	LowerBetter bool
+}
+
+var choroplethMetrics = map[string]choroplethMetric{
+	"dbt_pct":     {"DBT %", func(k ZoneKPI) float64 { return k.DBTPct }, false},
+	"aadhaar_pct": {"Aadhaar %", func(k ZoneKPI) float64 { return k.AadhaarPct }, false},
+	"ptr":         {"Pupils per teacher", func(k ZoneKPI) float64 { return k.PTR }, true},
+	"vacancies":   {"Teacher vacancies", func(k ZoneKPI) float64 { return float64(k.Vacancies) }, true},
+}
+
+// geoFeature is a GeoJSON feature; the geometry is passed through as read.
+type geoFeature struct {
+	Type       string          `json:"type"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+// ChoroplethClass is one entry of the legend.
+type ChoroplethClass struct {
+	Class int     `json:"class"`
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Fill  string  `json:"fill"`
+}
+
+type geoCollection struct {
+	Type      string            `json:"type"`
+	Features  []geoFeature      `json:"features"`
+	Metric    string            `json:"metric,omitempty"`
+	Legend    []ChoroplethClass `json:"legend,omitempty"`
+	Unmatched []string          `json:"unmatched_zones,omitempty"`
+}
+
+// zoneShapeKey reduces a zone name for matching: upper case, punctuation as
+// spaces and a trailing "ZONE" dropped.
+func zoneShapeKey(s string) string {
+	words := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	if n := len(words); n > 1 && words[n-1] == "ZONE" {
+		words = words[:n-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// loadZoneShapes reads the zone boundaries into ds.zoneShapes, by zone key.
+func loadZoneShapes(ds *Dataset, path string) {
+	ds.zoneShapes = nil
+	if path == "" {
+		return
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("zones-geojson %s: %v", path, err)
+		return
+	}
+	var fc struct {
+		Type     string       `json:"type"`
+		Features []geoFeature `json:"features"`
+	}
+	if err := json.Unmarshal(b, &fc); err != nil || fc.Type != "FeatureCollection" {
+		log.Printf("zones-geojson %s: not a GeoJSON FeatureCollection (%v)", path, err)
+		return
+	}
+	ds.zoneShapes = map[string]geoFeature{}
+	for i, f := range fc.Features {
+		name := ""
+		for _, k := range []string{"zone", "Zone", "ZONE", "zone_name", "Zone_Name", "ZONE_NAME", "name", "Name", "NAME"} {
+			if v, ok := f.Properties[k].(string); ok && strings.TrimSpace(v) != "" {
+				name = v
+				break
+			}
+		}
+		if name == "" {
+			log.Printf("zones-geojson %s: feature %d has no zone name", path, i)
+			continue
+		}
+		ds.zoneShapes[zoneShapeKey(name)] = f
+	}
+	log.Printf("🗺️  %d zone boundaries from %s", len(ds.zoneShapes), path)
+}
+
+// loadLocations sets the schools' coordinates from path.
+func loadLocations(sch map[string]School, path string) {
+	if path == "" {
+		return
+	}
+	t, err := ingest.ReadTable(path)
+	if err != nil {
+		log.Printf("school-locations %s: %v", path, err)
+		return
+	}
+	if !t.Has("Latitude", "Lat") || !t.Has("Longitude", "Lng", "Long") {
+		log.Printf("school-locations %s: needs Latitude and Longitude columns", path)
+		return
+	}
+	placed, bad := 0, 0
+	for _, rec := range t.Rows {
+		sid := ingest.DigitsOnly(t.Get(rec, "School ID", "School Code"))
+		if sid == "" {
+			sid = ingest.DigitsOnlyKey(t.Get(rec, "School Name & ID", "School Name"))
+		}
+		s, ok := sch[sid]
+		if !ok {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(t.Get(rec, "Latitude", "Lat")), 64)
+		lng, err2 := strconv.ParseFloat(strings.TrimSpace(t.Get(rec, "Longitude", "Lng", "Long")), 64)
+		if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 || (lat == 0 && lng == 0) {
+			bad++
+			continue
+		}
+		s.Lat, s.Lng = lat, lng
+		sch[sid] = s
+		placed++
+	}
+	log.Printf("📍 Coordinates for %d of %d schools (%d unreadable) from %s", placed, len(sch), bad, path)
+}
+
+// choropleth classes zone values by quintile, 4 the best, and returns the
+// legend.
+func choropleth(values map[string]float64, lowerBetter bool) (map[string]int, []ChoroplethClass) {
+	sorted := make([]float64, 0, len(values))
+	for _, v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Float64s(sorted)
+	k := len(choroplethPalette)
+	classes := map[string]int{}
+	legend := make([]ChoroplethClass, k)
+	for i := range legend {
+		legend[i] = ChoroplethClass{Class: i, From: math.NaN(), Fill: choroplethPalette[i]}
+	}
+	for zone, v := range values {
+		c := sort.SearchFloat64s(sorted, v) * k / len(sorted)
+		if lowerBetter {
+			c = k - 1 - c
+		}
+		classes[zone] = c
+		l := &legend[c]
+		if math.IsNaN(l.From) {
+			l.From, l.To = v, v
+		}
+		l.From, l.To = min(l.From, v), max(l.To, v)
+	}
+	out := legend[:0]
+	for _, l := range legend {
+		if !math.IsNaN(l.From) {
+			out = append(out, l)
+		}
+	}
+	return classes, out
+}
+
+// zoneCollection is the zone boundaries with their figures and metric's
+// classes.
+func zoneCollection(ds *Dataset, metric string) (geoCollection, error) {
+	m, ok := choroplethMetrics[metric]
+	if !ok {
+		return geoCollection{}, fmt.Errorf("metric must be one of %s", strings.Join(sortedKeys(choroplethMetrics), ", "))
+	}
+	if ds.zoneShapes == nil {
+		return geoCollection{}, errors.New("no zone boundaries: -zones-geojson is not set or unreadable")
+	}
+	values := map[string]float64{}
+	for z, k := range ds.ZONE_KPI {
+		if _, ok := ds.zoneShapes[zoneShapeKey(z)]; ok && z != allZones {
+			values[z] = m.Value(k)
+		}
+	}
+	classes, legend := choropleth(values, m.LowerBetter)
+	fc := geoCollection{Type: "FeatureCollection", Features: []geoFeature{}, Metric: metric, Legend: legend}
+	for _, z := range sortedKeys(ds.ZONE_KPI) {
+		f, ok := ds.zoneShapes[zoneShapeKey(z)]
+		if z == allZones {
+			continue
+		}
+		if !ok {
+			fc.Unmatched = append(fc.Unmatched, z)
+			continue
+		}
+		k := ds.ZONE_KPI[z]
+		props := map[string]any{}
+		for p, v := range f.Properties {
+			props[p] = v
+		}
+		for p, v := range map[string]any{"zone": z, "schools": k.Schools, "employees": k.Employees, "dbt_pct": k.DBTPct,
+			"aadhaar_pct": k.AadhaarPct, "ptr": math.Round(k.PTR*10) / 10, "vacancies": k.Vacancies,
+			"value": values[z], "class": classes[z], "fill": choroplethPalette[classes[z]]} {
+			props[p] = v
+		}
+		fc.Features = append(fc.Features, geoFeature{Type: "Feature", Geometry: f.Geometry, Properties: props})
+	}
+	return fc, nil
+}
+
+// schoolCollection is zone's schools with coordinates as points.
+func schoolCollection(ds *Dataset, zone string) geoCollection {
+	fc := geoCollection{Type: "FeatureCollection", Features: []geoFeature{}}
+	roster := rosterBySchool(ds.EMP)
+	for _, id := range sortedKeys(ds.SCH) {
+		s := ds.SCH[id]
+		if (s.Lat == 0 && s.Lng == 0) || (zone != "" && s.Zone != zone) {
+			continue
+		}
+		st := schoolStaff(s, roster[id])
+		geom, _ := json.Marshal(map[string]any{"type": "Point", "coordinates": []float64{s.Lng, s.Lat}})
+		fc.Features = append(fc.Features, geoFeature{Type: "Feature", Geometry: geom, Properties: map[string]any{
+			"id": id, "name": s.Name, "zone": s.Zone, "enrolment": s.TotalEnrolment, "teachers": st.ActualTeachers,
+			"ptr": math.Round(st.Ratio*10) / 10, "vacancies": max(0, -st.SurplusVacancy), "dbt_pct": pct1(s.DBTTotal, s.TotalEnrolment),
+		}})
+	}
+	return fc
+}
+
+func writeGeoJSON(w http.ResponseWriter, fc geoCollection) {
+	w.Header().Set("Content-Type", "application/geo+json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(fc)
+}
+
+// mapMetric is the request's ?metric=, dbt_pct by default.
+func mapMetric(r *http.Request) string {
+	if m := r.URL.Query().Get("metric"); m != "" {
+		return m
+	}
+	return "dbt_pct"
+}
+
+// GET /api/map/zones
+func handleMapZones(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	metric := mapMetric(r)
+	if _, ok := choroplethMetrics[metric]; !ok {
+		writeError(w, 400, errBadRequest, "metric must be one of "+strings.Join(sortedKeys(choroplethMetrics), ", "))
+		return
+	}
+	fc, err := zoneCollection(dataFor(r), metric)
+	if err != nil {
+		writeError(w, 404, errNotFound, err.Error())
+		return
+	}
+	writeGeoJSON(w, fc)
+}
+
+// GET /api/map/schools
+func handleMapSchools(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeGeoJSON(w, schoolCollection(dataFor(r), strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))))
+}
+
+// mapRings reads a Polygon's or MultiPolygon's rings.
+func mapRings(geom json.RawMessage) [][][2]float64 {
+	var g struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if json.Unmarshal(geom, &g) != nil {
+		return nil
+	}
+	switch g.Type {
+	case "Polygon":
+		var p [][][2]float64
+		json.Unmarshal(g.Coordinates, &p)
+		return p
+	case "MultiPolygon":
+		var mp [][][][2]float64
+		json.Unmarshal(g.Coordinates, &mp)
+		var out [][][2]float64
+		for _, p := range mp {
+			out = append(out, p...)
+		}
+		return out
+	}
+	return nil
+}
+
+// GET /map
+func handleMapPage(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds, metric := tenantFor(r), dataFor(r), mapMetric(r)
+	zone := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	e := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<form method="get"><select name="metric" onchange="this.form.submit()">`)
+	for _, k := range sortedKeys(choroplethMetrics) {
+		sel := ""
+		if k == metric {
+			sel = " selected"
+		}
+		fmt.Fprintf(&b, `<option value="%s"%s>%s</option>`, k, sel, e(choroplethMetrics[k].Label))
+	}
+	fmt.Fprintf(&b, `</select> <input type="hidden" name="zone" value="%s"></form>`, e(zone))
+	zones, err := zoneCollection(ds, metric)
+	if err != nil {
+		fmt.Fprintf(&b, `<p>%s</p>`, e(err.Error()))
+		zones = geoCollection{}
+	}
+	schools := schoolCollection(ds, zone)
+
+	// Equirectangular, scaled to the width and corrected for latitude.
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	grow := func(x, y float64) {
+		minX, maxX, minY, maxY = math.Min(minX, x), math.Max(maxX, x), math.Min(minY, y), math.Max(maxY, y)
+	}
+	rings := make([][][][2]float64, len(zones.Features))
+	for i, f := range zones.Features {
+		rings[i] = mapRings(f.Geometry)
+		for _, ring := range rings[i] {
+			for _, p := range ring {
+				grow(p[0], p[1])
+			}
+		}
+	}
+	points := make([][2]float64, len(schools.Features))
+	for i, f := range schools.Features {
+		points[i] = [2]float64{ds.SCH[f.Properties["id"].(string)].Lng, ds.SCH[f.Properties["id"].(string)].Lat}
+		grow(points[i][0], points[i][1])
+	}
+	if math.IsInf(minX, 0) {
+		b.WriteString(`<p>Nothing to draw: set -zones-geojson and -school-locations.</p>`)
+		mapPage(w, t, b.String())
+		return
+	}
+	const width = 900.0
+	kx := math.Cos((minY + maxY) / 2 * math.Pi / 180)
+	scale := width / math.Max((maxX-minX)*kx, 1e-9)
+	height := math.Max((maxY-minY)*scale, 100)
+	proj := func(p [2]float64) (float64, float64) { return (p[0]-minX)*kx*scale + 10, (maxY-p[1])*scale + 10 }
+	fmt.Fprintf(&b, `<svg viewBox="0 0 %.0f %.0f" width="100%%" style="max-width:%.0fpx;background:#0b1324;border-radius:8px">`, width+20, height+20, width+20)
+	for i, f := range zones.Features {
+		var d strings.Builder
+		for _, ring := range rings[i] {
+			for j, p := range ring {
+				x, y := proj(p)
+				cmd := "L"
+				if j == 0 {
+					cmd = "M"
+				}
+				fmt.Fprintf(&d, "%s%.1f %.1f", cmd, x, y)
+			}
+			d.WriteString("Z")
+		}
+		pr := f.Properties
+		fmt.Fprintf(&b, `<a href="%s/map?metric=%s&amp;zone=%s"><path d="%s" fill="%s" fill-opacity="0.65" stroke="#e2e8f0" stroke-width="1"><title>%s: %s %v (DBT %v%%, PTR %v, %v vacancies)</title></path></a>`,
+			t.Prefix, url.QueryEscape(metric), url.QueryEscape(pr["zone"].(string)), d.String(), pr["fill"], e(pr["zone"].(string)),
+			e(choroplethMetrics[metric].Label), pr["value"], pr["dbt_pct"], pr["ptr"], pr["vacancies"])
+	}
+	for i, f := range schools.Features {
+		x, y := proj(points[i])
+		pr := f.Properties
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="#38bdf8" stroke="#0b1324" stroke-width="0.5"><title>%s (%s): %v enrolled, PTR %v, %v vacancies</title></circle>`,
+			x, y, e(pr["name"].(string)), e(pr["zone"].(string)), pr["enrolment"], pr["ptr"], pr["vacancies"])
+	}
+	b.WriteString(`</svg><p>`)
+	for _, l := range zones.Legend {
+		fmt.Fprintf(&b, `<span style="display:inline-block;width:14px;height:14px;background:%s;vertical-align:middle"></span> %.1f–%.1f &nbsp; `, l.Fill, l.From, l.To)
+	}
+	fmt.Fprintf(&b, `<small>%d schools shown`, len(schools.Features))
+	if zone != "" {
+		fmt.Fprintf(&b, ` in %s (<a href="%s/map?metric=%s">all zones</a>)`, e(zone), t.Prefix, url.QueryEscape(metric))
+	}
+	if len(zones.Unmatched) > 0 {
+		fmt.Fprintf(&b, `; no boundary for %s`, e(strings.Join(zones.Unmatched, ", ")))
+	}
+	b.WriteString(`</small></p>`)
+	mapPage(w, t, b.String())
+}
+
+// mapPage writes the map page around body.
+func mapPage(w http.ResponseWriter, t *Tenant, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Zone map – %s</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}a{color:#93c5fd}small{color:#94a3b8}
+select{background:#1b263b;color:#f1f5f9;border:1px solid #334155;border-radius:6px;padding:4px}path:hover{fill-opacity:0.9}</style></head>
+<body><p><a href="%s/">Dashboard</a></p><h1>Zone map</h1>
+%s
+</body></html>`, html.EscapeString(t.PageTitle()), t.Prefix, body)
+}
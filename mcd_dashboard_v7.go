@@ -10,125 +10,69 @@
 //
 // Run (Windows PowerShell):
 //
-//	go run mcd_dashboard_v16_fixed.go ^
+//	go run . ^
 //	  -basic ./Basic.csv ^
 //	  -services ./Services.csv ^
 //	  -dbt ./Dashboard_Summary_202509.csv ^
 //	  -title "MCD Dashboard"
 //
 // Open: http://localhost:8080
+//
+// As a Windows service: run "install-service" followed by the same flags
+// (see service.go); "uninstall-service" removes it.
+//
+// Other tools can import the records (package model), the reading and
+// joining of the CSV and XLSX exports (ingest) and the demographics
+// (report). The HTTP server and the mailer stay in package main: they share
+// the flags, the tenant list and the mail queue with nearly every feature
+// file, so there is no server.New() or mailer package to import yet.
 package main
 
 import (
-	"bufio"
-	"crypto/tls"
-	"encoding/csv"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"html"
 	"log"
-	"math"
 	"net/http"
-	"net/smtp"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
-	"unicode"
+
+	"myproject/ingest"
+	"myproject/model"
+	"myproject/report"
 )
 
 // ---- Flags ----
 var (
-	basicCSV  = flag.String("basic", "Basic.csv", "Basic CSV path")
-	servCSV   = flag.String("services", "Services.csv", "Services CSV path")
-	dbtCSV    = flag.String("dbt", "Dashboard_Summary_202509.csv", "DBT CSV path")
+	basicCSV  = flag.String("basic", "Basic.csv", "Basic CSV or XLSX path")
+	servCSV   = flag.String("services", "Services.csv", "Services CSV or XLSX path")
+	dbtCSV    = flag.String("dbt", "Dashboard_Summary_202509.csv", "DBT CSV or XLSX path")
 	title     = flag.String("title", "MCD Dashboard", "Page title")
 	listen    = flag.String("listen", ":8080", "HTTP listen address")
 	cachePath = flag.String("cache", "./out/doj_cache.json", "DOJ cache path (optional)")
 
 	EmailFrom = "amitmokhrwal2@gmail.com" // optional for mailers
-	EmailPass = "uxlorpczyrdkzwfj"
 	EmailName = "HQ Team IT Education"
 	LiveMode  = false
 )
 
 // ---- Models ----
-type Emp struct {
-	ID                string `json:"id"`
-	Name              string `json:"name"`
-	Designation       string `json:"designation"`
-	DOB               string `json:"dob"`
-	Gender            string `json:"gender"`
-	Zone              string `json:"zone"`
-	SchoolID          string `json:"school_id"`
-	SchoolName        string `json:"school_name"`
-	Status            string `json:"status"`
-	SelectionCategory string `json:"selection_category"`
-	MaritalStatus     string `json:"marital_status"`
-	Age               int    `json:"age"`
-	Mobile            string `json:"mobile"`
-	Email             string `json:"email"`
-	DOJ               string `json:"doj"`
-	FatherName        string `json:"father_name"`
-	MotherName        string `json:"mother_name"`
-	SpouseName        string `json:"spouse_name"`
-	Correspondence    string `json:"correspondence"`
-	Permanent         string `json:"permanent"`
-	HomeTown          string `json:"home_town"`
-	Religion          string `json:"religion"`
-	AppointmentDate   string `json:"appointment_date"`
-	PromotionDate     string `json:"promotion_date"`
-	TransferDate      string `json:"transfer_date"`
-}
-
-type School struct {
-	ID                  string `json:"id"`
-	Name                string `json:"name"`
-	Zone                string `json:"zone"`
-	SIName              string `json:"si_name"`
-	TotalEnrolment      int    `json:"total_enrolment"`
-	MaxEnrolment        int    `json:"max_enrolment"`
-	MaxEnrolmentDate    string `json:"max_enrolment_date"`
-	MaxPresent          int    `json:"max_present"`
-	MaxPresentDate      string `json:"max_present_date"`
-	WithAccount         int    `json:"with_account"`
-	WithoutAccount      int    `json:"without_account"`
-	WithAadhaar         int    `json:"with_aadhaar"`
-	WithoutAadhaar      int    `json:"without_aadhaar"`
-	AadhaarLinkedAcc    int    `json:"aadhaar_linked_acc"`
-	NewAdmissionMonth   int    `json:"new_admission_month"`
-	NewAdmissionSession int    `json:"new_admission_session"`
-	DBTStudent          int    `json:"dbt_student"`
-	DBTParent           int    `json:"dbt_parent"`
-	DBTTotal            int    `json:"dbt_total"`
-}
-
-type Stat struct {
-	Male   int `json:"male"`
-	Female int `json:"female"`
-}
-
-type DemoStats struct {
-	TotalMale     int              `json:"total_male"`
-	TotalFemale   int              `json:"total_female"`
-	Total         int              `json:"total"`
-	CatStats      map[string]*Stat `json:"cat_stats,omitempty"`
-	ReligionStats map[string]*Stat `json:"religion_stats,omitempty"`
-}
-
-type DesignationDemo struct {
-	Designation string    `json:"designation"`
-	Stats       DemoStats `json:"stats"`
-}
-
-type ZoneDemo struct {
-	Zone         string            `json:"zone"`
-	Designations []DesignationDemo `json:"designations"`
-}
+// The records live in package model (and are read by package ingest); the
+// dashboard keeps its short names for them.
+type (
+	Emp             = model.Employee
+	School          = model.School
+	DBTComponent    = model.DBTComponent
+	ClassResult     = model.ClassResult
+	Stat            = model.Stat
+	DemoStats       = model.DemoStats
+	DesignationDemo = model.DesignationDemo
+	ZoneDemo        = model.ZoneDemo
+)
 
 type SchoolStaff struct {
 	ID             string  `json:"id"`
@@ -138,365 +82,155 @@ type SchoolStaff struct {
 	ActualTeachers int     `json:"actual_teachers"`
 	SurplusVacancy int     `json:"surplus_vacancy"`
 	HasPrincipal   bool    `json:"has_principal"`
+	InCharge       string  `json:"in_charge,omitempty"` // holding the HoS charge by order, see charges.go
 	HasSpecialEdu  bool    `json:"has_special_educator"`
 	TotalStaff     int     `json:"total_staff"`
 	Ratio          float64 `json:"ratio"`
 }
 
-// ---- Globals ----
-var (
-	EMP = map[string]Emp{}
-	SCH = map[string]School{}
-
-	bRows, sRows, dRows [][]string
-	bm, sm, dm          map[string]int
-
-	emailByEmpID   = map[string]string{}
-	nameByEmpID    = map[string]string{}
-	genderByEmpID  = map[string]string{}
-	catByEmpID     = map[string]string{}
-	maritalByEmpID = map[string]string{}
+// ---- Dataset ----
+// Everything one build produces. Handlers read the dataset of the tenant
+// serving the request; a rebuild swaps in a fresh one.
+type Dataset struct {
+	EMP map[string]Emp
+	SCH map[string]School
 
 	ZLBL, ZVAL, DLBL, DVAL []string
 
 	DEMO_ZONES []ZoneDemo
 
-	CATEGORY_WISE = map[string]int{}
-	GENDER_WISE   = map[string]int{}
-)
-
-// ---- Utils ----
-var (
-	rxBOM     = regexp.MustCompile("\uFEFF")
-	rxNBSP    = regexp.MustCompile("\u00A0")
-	rxDigits  = regexp.MustCompile(`(\d{5,})`)
-	rxLastNum = regexp.MustCompile(`(\d{5,})\D*$`)
-)
-
-func norm(s string) string {
-	s = rxBOM.ReplaceAllString(s, "")
-	s = rxNBSP.ReplaceAllString(s, " ")
-	s = strings.TrimSpace(s)
-	for strings.Contains(s, "  ") {
-		s = strings.ReplaceAll(s, "  ", " ")
-	}
-	return s
-}
-func stripDot0(s string) string {
-	s = norm(s)
-	if strings.HasSuffix(s, ".0") {
-		return s[:len(s)-2]
-	}
-	return s
-}
-func digitsOnly(s string) string {
-	out := make([]rune, 0, len(s))
-	for _, r := range s {
-		if r >= '0' && r <= '9' {
-			out = append(out, r)
-		}
-	}
-	return string(out)
-}
-func normalizeEmpID(s string) string { return digitsOnly(stripDot0(s)) }
-func digitsOnlyKey(s string) string {
-	s = norm(s)
-	if m := rxLastNum.FindStringSubmatch(s); len(m) > 1 {
-		return m[1]
-	}
-	if m := rxDigits.FindStringSubmatch(s); len(m) > 1 {
-		return m[1]
-	}
-	return ""
-}
-func atoiSafe(s string) int {
-	s = stripDot0(s)
-	if s == "" {
-		return 0
-	}
-	v, _ := strconv.Atoi(s)
-	return v
-}
-func readCSV(path string) (rows [][]string, header []string) {
-	f, err := os.Open(path)
-	if err != nil {
-		log.Fatalf("open %s: %v", path, err)
-	}
-	defer f.Close()
-	r := csv.NewReader(bufio.NewReader(f))
-	r.FieldsPerRecord = -1
-	header, err = r.Read()
-	if err != nil {
-		log.Fatalf("header %s: %v", path, err)
-	}
-	for i := range header {
-		header[i] = norm(header[i])
-	}
-	for {
-		rec, e := r.Read()
-		if e != nil {
-			break
-		}
-		for i := range rec {
-			rec[i] = norm(rec[i])
-		}
-		rows = append(rows, rec)
-	}
-	return rows, header
-}
-func idxMap(h []string) map[string]int {
-	m := map[string]int{}
-	for i, c := range h {
-		c = strings.ReplaceAll(c, "\u00A0", " ")
-		c = strings.ReplaceAll(c, "\uFEFF", "")
-		c = strings.Map(func(r rune) rune {
-			if r == 160 || unicode.IsSpace(r) {
-				return ' '
-			}
-			return r
-		}, c)
-		k := strings.ToLower(strings.TrimSpace(c))
-		if _, ok := m[k]; !ok {
-			m[k] = i
-		}
-	}
-	return m
-}
-func get(rec []string, m map[string]int, name string, aliases ...string) string {
-	names := append([]string{name}, aliases...)
-	for _, nm := range names {
-		i, ok := m[strings.ToLower(strings.TrimSpace(nm))]
-		if ok && i >= 0 && i < len(rec) {
-			return norm(rec[i])
-		}
-	}
-	return ""
-}
-func parseDMYFlexible(s string) (time.Time, error) {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return time.Time{}, fmt.Errorf("empty")
-	}
-	parts := strings.Split(s, "/")
-	if len(parts) == 3 && len(parts[1]) > 2 && !regexp.MustCompile(`^\d+$`).MatchString(parts[1]) {
-		parts[1] = strings.ToUpper(strings.ToUpper(parts[1][:1]) + strings.ToLower(parts[1][1:]))
-		s = strings.Join(parts, "/")
-	}
-	formats := []string{
-		"02/Jan/2006", "2/Jan/2006", "02-Jan-2006", "2-Jan-2006",
-		"02/01/2006", "2/01/2006", "02/January/2006", "2/January/2006",
-	}
-	var d time.Time
-	var err error
-	for _, f := range formats {
-		d, err = time.Parse(f, s)
-		if err == nil {
-			return d, nil
-		}
-	}
-	return time.Time{}, fmt.Errorf("unparsed: %s", s)
-}
-func ageFromDOB(dob string) int {
-	d, err := parseDMYFlexible(dob)
-	if err != nil {
-		return 0
-	}
-	now := time.Now()
-	age := now.Year() - d.Year()
-	if now.Month() < d.Month() || (now.Month() == d.Month() && now.Day() < d.Day()) {
-		age--
-	}
-	if age < 0 {
-		return 0
-	}
-	return age
+	CATEGORY_WISE map[string]int
+	GENDER_WISE   map[string]int
+
+	SCORECARD      []ZoneScore
+	ZONE_KPI       map[string]ZoneKPI
+	HEADS          map[string]SchoolHead  // by school id, see escalation.go
+	DUPLICATES     []ingest.Duplicate     // employee IDs on several rows, see duplicates.go
+	RECONCILIATION *ingest.Reconciliation // nil when restored from -db, see reconciliation.go
+	SCHOOL_MATCHES []ingest.SchoolMatch   // employees placed by school name, see schoolmatch.go
+	SI_CHARGES     map[string]Charge      // by upper-cased SI name, see charges.go
+	ANOMALIES      Anomalies              // see anomalies.go
+	TREND          *Trend                 // nil without -dbt-dir, see trend.go
+	WORKLOAD       *Workload              // nil without a periods file, see workload.go
+	DATA_FILES     map[string]*dataFile
+	METRICS        []MetricDef
+	dataByPath     map[string]*dataFile
+	periods        []PeriodRow           // the timetable WORKLOAD comes from
+	leave          []LeaveSpell          // see substitutes.go
+	zoneShapes     map[string]geoFeature // by zoneShapeKey, nil without -zones-geojson, see maps.go
+
+	Inputs     Inputs
+	Provenance []InputFile // see provenance.go
+	Profile    string      // active profile name, "" when built from flags
+	BuiltAt    time.Time
+	inputsSig  string // see inputsSig
 }
 
-// ---- Category Canonicalization ----
-func canonicalCategory(raw string) string {
-	s := strings.ToUpper(strings.TrimSpace(raw))
-	if s == "" {
-		return "UNKNOWN"
-	}
-	log.Printf("Category: Raw=%q, Normalized=%q", raw, s)
-	return s
+type Inputs struct {
+	Basic, Services, DBT string
+	DataDir              string
+	Overrides            string
+	DBTDir               string
+	ZonesGeoJSON         string
+	Locations            string
+	Charges              string
+	Infra                string
+	MDM                  string
+	Results              string
+	Periods              string
+	Leave                string
+	Metrics              string
 }
 
-// ---- Religion Canonicalization ----
-func canonicalReligion(raw string) string {
-	s := strings.ToUpper(strings.TrimSpace(raw))
-	if s == "" {
-		return "UNKNOWN"
+// ---- Build data ----
+
+// buildAll is loadDataset for one-off commands: unreadable inputs are
+// fatal.
+func buildAll(in Inputs) *Dataset {
+	ds, err := loadDataset(in)
+	if err != nil {
+		log.Fatal(err)
 	}
-	log.Printf("Religion: Raw=%q, Normalized=%q", raw, s)
-	return s
+	return ds
 }
 
-// ---- Email helpers (unchanged) ----
-func sendEmail(to, subject, body string) error {
-	if !LiveMode {
-		log.Printf("DRY SEND → %s | %s", to, subject)
-		return nil
+func loadDataset(in Inputs) (*Dataset, error) {
+	ds := &Dataset{Inputs: in, inputsSig: inputsSig(in)}
+	if err := loadColumnAliases(); err != nil {
+		log.Printf("⚠️  Column aliases: %v (keeping the ones in use)", err)
 	}
-	from := EmailFrom
-	pass := EmailPass
-	if from == "" || pass == "" {
-		return fmt.Errorf("EMAIL_FROM / EMAIL_PASS not set")
+	if err := checkStrict(in); err != nil {
+		return nil, err
 	}
-	msg := "From: " + EmailName + " <" + from + ">\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n" +
-		"MIME-version: 1.0;\r\n" +
-		"Content-Type: text/html; charset=\"UTF-8\";\r\n\r\n" + body
-
-	auth := smtp.PlainAuth("", from, pass, "smtp.gmail.com")
-	tlsconfig := &tls.Config{InsecureSkipVerify: true, ServerName: "smtp.gmail.com"}
 
-	conn, err := tls.Dial("tcp", "smtp.gmail.com:465", tlsconfig)
+	// Read CSVs
+	basic, err := ingest.LoadBasic(in.Basic)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	c, err := smtp.NewClient(conn, "smtp.gmail.com")
+	services, err := ingest.LoadServices(in.Services)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if err = c.Auth(auth); err != nil {
-		return err
+	dbt, err := ingest.LoadDBT(in.DBT)
+	if err != nil {
+		return nil, err
 	}
-	if err = c.Mail(from); err != nil {
-		return err
+	for _, t := range []*ingest.Table{basic, services, dbt} {
+		if t.Encoding != "" && t.Encoding != ingest.EncUTF8 {
+			log.Printf("🔡 %s read as %s", t.Path, t.Encoding)
+		}
 	}
-	if err = c.Rcpt(to); err != nil {
-		return err
+
+	log.Println("👥 Building employee records...")
+	if ds.EMP, ds.DUPLICATES, err = ingest.EmployeesWith(basic, services, *duplicatePolicy); err != nil {
+		return nil, err
 	}
-	w, err := c.Data()
-	if err != nil {
-		return err
+	if len(ds.DUPLICATES) > 0 {
+		log.Printf("⚠️  Duplicate employee IDs (%s) resolved by the %s policy", duplicatesNote(ds.DUPLICATES), *duplicatePolicy)
 	}
-	if _, err = w.Write([]byte(msg)); err != nil {
-		return err
+	rec := ingest.Reconcile(basic, services)
+	ds.RECONCILIATION = &rec
+	log.Printf("🔗 Basic↔Services: %d matched, %d in Basic only, %d in Services only", rec.Matched, len(rec.BasicOnly), len(rec.ServicesOnly))
+	if n := applyOverrides(ds.EMP, loadOverrides(in.Overrides)); n > 0 {
+		log.Printf("✏️  Applied %d override(s) from %s", n, in.Overrides)
 	}
-	_ = w.Close()
-	_ = c.Quit()
-	return nil
-}
-
-// ---- Build data ----
-func buildAll() {
-	// Read CSVs
-	var bh, sh, dh []string
-	bRows, bh = readCSV(*basicCSV)
-	sRows, sh = readCSV(*servCSV)
-	dRows, dh = readCSV(*dbtCSV)
-	bm, sm, dm = idxMap(bh), idxMap(sh), idxMap(dh)
-
-	// Lookup maps
-	log.Println("📋 Building lookup maps from Basic.csv...")
-	for _, r := range bRows {
-		id := normalizeEmpID(get(r, bm, "Employee ID", "Emp ID"))
-		if id == "" {
-			continue
-		}
-		if v := get(r, bm, "Employees_Email_ID", "Email", "Email ID"); v != "" {
-			emailByEmpID[id] = v
-		}
-		if v := get(r, bm, "Name of the Employee", "Employee Name", "Name"); v != "" {
-			nameByEmpID[id] = v
-		}
-		if v := get(r, bm, "Gender"); v != "" {
-			genderByEmpID[id] = strings.ToUpper(v)
-		}
-		if v := get(r, bm, "Marital Status", "Marital"); v != "" {
-			maritalByEmpID[id] = v
-		}
+	if n := countBadEmails(ds.EMP); n > 0 {
+		log.Printf("📧 %d employee(s) without a valid email address (see /api/bad-emails)", n)
 	}
 
-	// Services: DOJ + Category + dates
-	log.Println("📁 Preparing DOJ/Category maps...")
-	dojByEmpID := map[string]string{}
-	for _, r := range sRows {
-		empID := normalizeEmpID(get(r, sm, "Employee ID", "Emp ID"))
-		if empID == "" {
-			continue
-		}
-		if dojRaw := get(r, sm, "Date of Joining", "DOJ"); dojRaw != "" {
-			dojByEmpID[empID] = dojRaw
-		}
-		rawCat := get(r, sm, "Selection Category", "SelectionCategory", "Applied Category", "Category")
-		cat := canonicalCategory(rawCat)
-		catByEmpID[empID] = cat
-		if mar := get(r, sm, "Marital Status", "Marital"); mar != "" {
-			if _, ok := maritalByEmpID[empID]; !ok {
-				maritalByEmpID[empID] = mar
+	log.Println("🏫 Building school records...")
+	ds.SCH = ingest.Schools(dbt)
+	if *schoolMatchMin > 0 {
+		ds.SCHOOL_MATCHES = ingest.MatchSchoolNames(ds.EMP, ds.SCH, *schoolMatchMin)
+		if n := len(ds.SCHOOL_MATCHES); n > 0 {
+			placed := 0
+			for _, m := range ds.SCHOOL_MATCHES {
+				if m.SchoolID != "" {
+					placed++
+				}
 			}
+			log.Printf("🔎 %d employee(s) without a school ID: %d placed by school name, %d not (see /api/school-matches)", n, placed, n-placed)
 		}
 	}
+	loadClassrooms(ds.SCH, in.Infra)
+	loadLocations(ds.SCH, in.Locations)
+	loadMDM(ds.SCH, in.MDM)
+	loadResults(ds.SCH, in.Results)
+	loadPeriods(ds, in.Periods)
+	loadLeave(ds, in.Leave)
+	loadTrend(ds, in.DBTDir)
+	loadZoneShapes(ds, in.ZonesGeoJSON)
+	finishBuild(ds)
+	return ds, nil
+}
 
-	type ServicesData struct{ AppointmentDate, PromotionDate, TransferDate string }
-	servicesData := map[string]ServicesData{}
-	for _, r := range sRows {
-		empID := normalizeEmpID(get(r, sm, "Employee ID", "Emp ID"))
-		if empID == "" {
-			continue
-		}
-		servicesData[empID] = ServicesData{
-			AppointmentDate: get(r, sm, "Date of Appointment"),
-			PromotionDate:   get(r, sm, "Last Promotion Order Date"),
-			TransferDate:    get(r, sm, "Last Transfer Order Date"),
-		}
-	}
-
-	// Build EMP
-	log.Println("👥 Building employee records...")
-	EMP = map[string]Emp{}
+// finishBuild derives the charts, demographics, metrics, scorecard and KPIs
+// from ds.EMP and ds.SCH, whether just parsed or restored from -db.
+func finishBuild(ds *Dataset) {
 	zoneCounts := map[string]int{}
 	desigCounts := map[string]int{}
-
-	for _, r := range bRows {
-		id := normalizeEmpID(get(r, bm, "Employee ID", "Emp ID"))
-		if id == "" {
-			continue
-		}
-
-		sname := get(r, bm, "School Name & ID", "School Name and ID", "School Name")
-		sid := digitsOnlyKey(sname)
-		zoneName := strings.ToUpper(strings.TrimSpace(get(r, bm, "Zone ID", "Zone Name", "Zone")))
-		if zoneName == "" {
-			zoneName = "UNKNOWN"
-		}
-		dob := get(r, bm, "Date of Birth", "DOB")
-		rawRel := get(r, bm, "Religion")
-		rel := canonicalReligion(rawRel)
-
-		e := Emp{
-			ID:                id,
-			Name:              nameByEmpID[id],
-			Designation:       get(r, bm, "Designation"),
-			DOB:               dob,
-			Gender:            genderByEmpID[id],
-			Zone:              zoneName,
-			SchoolID:          sid,
-			SchoolName:        sname,
-			Status:            get(r, bm, "Status"),
-			SelectionCategory: catByEmpID[id],
-			MaritalStatus:     maritalByEmpID[id],
-			Age:               ageFromDOB(dob),
-			Mobile:            stripDot0(get(r, bm, "Mobile No.", "Mobile")),
-			Email:             emailByEmpID[id],
-			DOJ:               dojByEmpID[id],
-			FatherName:        get(r, bm, "Father's Name"),
-			MotherName:        get(r, bm, "Mother's Name"),
-			SpouseName:        get(r, bm, "Spouse Name"),
-			Correspondence:    get(r, bm, "Correspondance_Address", "Correspondence Address"),
-			Permanent:         get(r, bm, "Permanent_Address", "Permanent Address"),
-			HomeTown:          get(r, bm, "Home Town"),
-			Religion:          rel,
-			AppointmentDate:   servicesData[id].AppointmentDate,
-			PromotionDate:     servicesData[id].PromotionDate,
-			TransferDate:      servicesData[id].TransferDate,
-		}
-		EMP[id] = e
-
+	for _, e := range ds.EMP {
 		zoneCounts[e.Zone]++
 		d := e.Designation
 		if d == "" {
@@ -505,58 +239,6 @@ func buildAll() {
 		desigCounts[d]++
 	}
 
-	// Build SCH from DBT
-	log.Println("🏫 Building school records...")
-	SCH = map[string]School{}
-	schoolByID := map[string]bool{}
-	zoneSet := map[string]bool{}
-	desigSet := map[string]bool{}
-	for _, r := range dRows {
-		sname := get(r, dm, "School Name & ID", "School Name")
-		sid := digitsOnlyKey(sname)
-		if sid == "" {
-			continue
-		}
-		zoneName := strings.ToUpper(strings.TrimSpace(get(r, dm, "Zone ID", "Zone Name", "Zone")))
-		if zoneName == "" {
-			zoneName = "UNKNOWN"
-		}
-		SCH[sid] = School{
-			ID:                  sid,
-			Name:                sname,
-			Zone:                zoneName,
-			SIName:              get(r, dm, "School Inspector's Name", "SI Name"),
-			TotalEnrolment:      atoiSafe(get(r, dm, "Total Enrolment (Last)", "Total Enrolment")),
-			MaxEnrolment:        atoiSafe(get(r, dm, "Max Enrolment")),
-			MaxEnrolmentDate:    get(r, dm, "Max Enrolment Date"),
-			MaxPresent:          atoiSafe(get(r, dm, "Max Present")),
-			MaxPresentDate:      get(r, dm, "Max Present Date"),
-			WithAccount:         atoiSafe(get(r, dm, "With Account")),
-			WithoutAccount:      atoiSafe(get(r, dm, "Without Account")),
-			WithAadhaar:         atoiSafe(get(r, dm, "With Aadhaar")),
-			WithoutAadhaar:      atoiSafe(get(r, dm, "Without Aadhaar")),
-			AadhaarLinkedAcc:    atoiSafe(get(r, dm, "Aadhaar Linked Account")),
-			NewAdmissionMonth:   atoiSafe(get(r, dm, "New Admission (This month)")),
-			NewAdmissionSession: atoiSafe(get(r, dm, "New Admission (This session)")),
-			DBTStudent:          atoiSafe(get(r, dm, "DBT Received (Student)")),
-			DBTParent:           atoiSafe(get(r, dm, "DBT Received (Parent)")),
-			DBTTotal:            atoiSafe(get(r, dm, "Received By (Student + Parent)")),
-		}
-		schoolByID[sid] = true
-		zoneSet[zoneName] = true
-	}
-	for _, e := range EMP {
-		if e.SchoolID != "" {
-			schoolByID[e.SchoolID] = true
-		}
-		if e.Zone != "" {
-			zoneSet[e.Zone] = true
-		}
-		if e.Designation != "" {
-			desigSet[e.Designation] = true
-		}
-	}
-
 	// Totals + charts data
 	log.Println("📊 Building chart data...")
 	type kv struct {
@@ -585,181 +267,358 @@ func buildAll() {
 
 	zTop := take(toSorted(zoneCounts), 10)
 	dTop := take(toSorted(desigCounts), 10)
-	ZLBL, ZVAL, DLBL, DVAL = []string{}, []string{}, []string{}, []string{}
+	ds.ZLBL, ds.ZVAL, ds.DLBL, ds.DVAL = []string{}, []string{}, []string{}, []string{}
 	for _, p := range zTop {
-		ZLBL = append(ZLBL, p.K)
-		ZVAL = append(ZVAL, strconv.Itoa(p.V))
+		ds.ZLBL = append(ds.ZLBL, p.K)
+		ds.ZVAL = append(ds.ZVAL, strconv.Itoa(p.V))
 	}
 	for _, p := range dTop {
-		DLBL = append(DLBL, p.K)
-		DVAL = append(DVAL, strconv.Itoa(p.V))
+		ds.DLBL = append(ds.DLBL, p.K)
+		ds.DVAL = append(ds.DVAL, strconv.Itoa(p.V))
 	}
 
-	// Demographics (dynamic categories + religion)
 	log.Println("📊 Building demographics...")
-	zmap := map[string]map[string]*DemoStats{} // zone -> designation -> stats
-	totalMale, totalFemale := 0, 0
-	CATEGORY_WISE = map[string]int{}
-	for _, e := range EMP {
-		if e.Zone == "" || e.Designation == "" {
-			continue
-		}
-		zone := strings.ToUpper(strings.TrimSpace(e.Zone))
-		desig := strings.TrimSpace(e.Designation)
-		cat := e.SelectionCategory // Already normalized in EMP
-		if cat == "" {
-			cat = "UNKNOWN"
-		}
-		rel := e.Religion // Already normalized in EMP
-		if rel == "" {
-			rel = "UNKNOWN"
-		}
-		g := strings.ToUpper(strings.TrimSpace(e.Gender))
-		isMale, isFemale := g == "MALE" || g == "M", g == "FEMALE" || g == "F"
-
-		if zmap[zone] == nil {
-			zmap[zone] = map[string]*DemoStats{}
-		}
-		if zmap[zone][desig] == nil {
-			zmap[zone][desig] = &DemoStats{CatStats: make(map[string]*Stat), ReligionStats: make(map[string]*Stat)}
-		}
-		stats := zmap[zone][desig]
-		if _, ok := stats.CatStats[cat]; !ok {
-			stats.CatStats[cat] = &Stat{}
-		}
-		if isMale {
-			stats.CatStats[cat].Male++
-			stats.TotalMale++
-			totalMale++
-		}
-		if isFemale {
-			stats.CatStats[cat].Female++
-			stats.TotalFemale++
-			totalFemale++
-		}
-		stats.Total++
-		CATEGORY_WISE[cat]++
+	demo := report.BuildDemographics(ds.EMP)
+	ds.DEMO_ZONES, ds.CATEGORY_WISE, ds.GENDER_WISE = demo.Zones, demo.CategoryWise, demo.GenderWise
+
+	log.Println("🏆 Building zone scorecard...")
+	ds.METRICS = loadMetrics(ds.Inputs.Metrics)
+	applyMetrics(ds, ds.METRICS)
+	ds.SCORECARD = buildScorecard(ds.EMP, ds.SCH)
+	ds.ZONE_KPI = buildZoneKPIs(ds.EMP, ds.SCH, ds.SCORECARD)
+	ds.HEADS = schoolHeads(ds.EMP)
+	applyCharges(ds, loadCharges(ds.Inputs.Charges), time.Now().Format("2006-01-02"))
+	ds.ANOMALIES = findAnomalies(ds.EMP, ds.SCH)
+	ds.WORKLOAD = teacherWorkload(ds.EMP, ds.SCH, ds.periods)
+	buildDataFiles(ds)
+	ds.BuiltAt = time.Now()
+}
 
-		if _, ok := stats.ReligionStats[rel]; !ok {
-			stats.ReligionStats[rel] = &Stat{}
-		}
-		if isMale {
-			stats.ReligionStats[rel].Male++
-		}
-		if isFemale {
-			stats.ReligionStats[rel].Female++
-		}
-		log.Printf("Employee %s: Zone=%s, Desig=%s, Cat=%s, Rel=%s, Male=%v, Female=%v", e.ID, zone, desig, cat, rel, isMale, isFemale)
+// ---- HTTP ----
+func main() {
+	if runSubcommand() {
+		return
 	}
-	GENDER_WISE = map[string]int{"Male": totalMale, "Female": totalFemale}
-
-	// Log demographics for debugging
-	for zone, dm := range zmap {
-		log.Printf("Zone: %s", zone)
-		for dname, st := range dm {
-			log.Printf("  Designation: %s, CatStats: %v, ReligionStats: %v, TotalMale: %d, TotalFemale: %d, Total: %d", dname, st.CatStats, st.ReligionStats, st.TotalMale, st.TotalFemale, st.Total)
-		}
+	flag.Parse()
+	if err := applyEnv(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyConfig(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadColumnAliases(); err != nil {
+		log.Fatal(err)
+	}
+	applySandbox()
+	if err := checkLive(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdServe(flag.Args()); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	DEMO_ZONES = []ZoneDemo{}
-	for zone, dm := range zmap {
-		var designations []DesignationDemo
-		for dname, st := range dm {
-			designations = append(designations, DesignationDemo{Designation: dname, Stats: *st})
+// buildTenants builds every tenant (under -profile, if set) and tags the
+// builds with -tag.
+func buildTenants(tenants []*Tenant) error {
+	for _, t := range tenants {
+		if *profileName != "" {
+			if err := t.UseProfile(*profileName); err != nil {
+				return fmt.Errorf("tenant %s: profile: %v", t.ID, err)
+			}
+		} else {
+			t.Build()
+		}
+		if *snapshotTag != "" {
+			if _, err := saveSnapshot(t, *snapshotTag); err != nil {
+				log.Printf("snapshot %s/%s: %v", t.ID, *snapshotTag, err)
+			} else {
+				log.Printf("📸 Tagged %s build as %s", t.ID, *snapshotTag)
+			}
 		}
-		sort.Slice(designations, func(i, j int) bool { return designations[i].Designation < designations[j].Designation })
-		DEMO_ZONES = append(DEMO_ZONES, ZoneDemo{Zone: zone, Designations: designations})
 	}
-	sort.Slice(DEMO_ZONES, func(i, j int) bool { return DEMO_ZONES[i].Zone < DEMO_ZONES[j].Zone })
+	return nil
 }
 
-// ---- HTTP ----
-func main() {
-	flag.Parse()
+// cmdServe builds every tenant and runs the dashboard server; it is what
+// runs without a subcommand.
+func cmdServe([]string) error {
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	applyChdir()
+	setupDaemon()
+	setupServiceLog()
 
 	if err := os.MkdirAll(filepath.Dir(*cachePath), 0755); err != nil {
 		log.Printf("mkdir cache: %v", err)
 	}
 
-	buildAll()
+	var err error
+	if TENANTS, err = loadTenants(); err != nil {
+		return fmt.Errorf("tenants: %v", err)
+	}
+	if err := buildTenants(TENANTS); err != nil {
+		return err
+	}
+
+	startMailQueue()
+	startLeaderElection()
+	startInputWatch()
+	startChargeSchedule()
+	startFetchSchedule()
+	startOGDSchedule()
+	startAlerts()
+	startAuditSampling()
+	if err := startCampaignSchedule(); err != nil {
+		return err
+	}
+	if err := startRetirementAlerts(); err != nil {
+		return err
+	}
+	if err := startSubscriptionSchedule(); err != nil {
+		return err
+	}
+	if err := startDigestSchedule(); err != nil {
+		return err
+	}
+	if err := startZoneDigestSchedule(); err != nil {
+		return err
+	}
+	if err := startPurgeSchedule(); err != nil {
+		return err
+	}
+	if _, err := parseDQLimits(*dqLimits); err != nil {
+		return fmt.Errorf("-dq-limits: %v", err)
+	}
+	if err := checkDuplicatePolicy(); err != nil {
+		return err
+	}
+	if err := setupRateLimits(); err != nil {
+		return err
+	}
+	if err := loadHierarchy(); err != nil {
+		return fmt.Errorf("-hierarchy: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mountHealth(mux)
+	mountTenants(mux, tenantRoutes)
+	srv := &http.Server{Addr: *listen, Handler: withSecurityHeaders(mux)}
+	if err := setupTLS(srv); err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+	scheme := "http"
+	if srv.TLSConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("✅ Server running on %s://localhost%v", scheme, *listen)
+	stopped := shutdownOnSignal(srv)
+	err = serve(srv)
+	if err == http.ErrServerClosed {
+		<-stopped
+		err = nil
+	}
+	removePIDFile()
+	return err
+}
 
+// tenantRoutes is the route table served under every tenant prefix.
+func tenantRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", handleIndex)
+	mux.HandleFunc("/api/", handleAPINotFound)
 	mux.HandleFunc("/api/emp", handleAPIEmployee)
+	mux.HandleFunc("/api/emp/history", handleAPIEmpHistory)
+	mux.HandleFunc("/api/emp/servicebook", handleServiceBook)
+	mux.HandleFunc("/api/emp/reporting-line", handleReportingLine)
+	mux.HandleFunc("/api/org-chart", handleOrgChart)
+	mux.HandleFunc("/org-chart", handleOrgChartPage)
+	mux.HandleFunc("/api/reconciliation", handleReconciliation)
+	mux.HandleFunc("/api/school-matches", handleSchoolMatches)
+	mux.HandleFunc("/api/invalid-mobiles", handleInvalidMobiles)
+	mux.HandleFunc("/api/bad-emails", handleBadEmails)
+	mux.HandleFunc("/api/bad-emails/zones", handleBadEmailZones)
+	mux.HandleFunc("/api/overrides", handleOverrides)
+	mux.HandleFunc("/api/charges", handleCharges)
+	mux.HandleFunc("/api/charges/import", handleChargesImport)
+	mux.HandleFunc("/api/anomalies", handleAnomalies)
+	mux.HandleFunc("/api/trend", handleTrend)
+	mux.HandleFunc("/api/schools/nearby", handleNearbySchools)
+	mux.HandleFunc("/api/map/zones", handleMapZones)
+	mux.HandleFunc("/api/map/schools", handleMapSchools)
+	mux.HandleFunc("/map", handleMapPage)
+	mux.HandleFunc("/school/{id}", handleSchoolPage)
+	mux.HandleFunc("/api/overrides/restore", handleOverrideRestore)
+	mux.HandleFunc("/api/overrides/emails", handleImportEmails)
+	mux.HandleFunc("/api/v1/sync/employees", handleSyncEmployees)
+	mux.HandleFunc("/api/blackout", handleBlackout)
+	mux.HandleFunc("/api/blackout/restore", handleBlackoutRestore)
+	mux.HandleFunc("/api/templates", handleTemplates)
+	mux.HandleFunc("/api/templates/report", handleTemplateReport)
+	mux.HandleFunc("/api/campaigns", handleCampaigns)
+	mux.HandleFunc("/t/open/{id}", handleOpenPixel)
+	mux.HandleFunc("/hooks/inbound", handleInboundHook)
+	mux.HandleFunc("/api/inbound", handleAPIInbound)
+	mux.HandleFunc("/api/prefs", handleAPIPrefs)
+	mux.HandleFunc("/api/prefs/restore", handlePrefsRestore)
+	mux.HandleFunc("/api/ogd/export", handleOGDExport)
+	mux.HandleFunc("/api/reviewpack", handleReviewPack)
+	mux.HandleFunc("/api/transfers", handleTransfers)
+	mux.HandleFunc("/api/transfers/report", handleTransferReport)
+	mux.HandleFunc("/api/transfers/requests", handleTransferRequests)
+	mux.HandleFunc("/api/transfers/mutual", handleMutualTransfers)
+	mux.HandleFunc("/api/longstay", handleLongStay)
+	mux.HandleFunc("/api/classrooms", handleAPIClassrooms)
+	mux.HandleFunc("/api/mdm", handleAPIMDM)
+	mux.HandleFunc("/api/results", handleAPIResults)
+	mux.HandleFunc("/api/results/summary", handleAPIResultsSummary)
+	mux.HandleFunc("/api/insights", handleInsights)
+	mux.HandleFunc("/api/retirements", handleRetirements)
+	mux.HandleFunc("/api/workload", handleAPIWorkload)
+	mux.HandleFunc("/api/workload/teachers", handleAPIWorkloadTeachers)
+	mux.HandleFunc("/api/substitutes", handleAPISubstitutes)
+	mux.HandleFunc("/api/dbt/components", handleDBTComponents)
+	mux.HandleFunc("/api/metrics", handleAPIMetrics)
+	mux.HandleFunc("/api/rate-limits", handleRateLimits)
+	mux.HandleFunc("/prefs", handlePrefsPage)
+	mux.HandleFunc("/grievance", handleGrievancePage)
+	mux.HandleFunc("/api/grievances", handleGrievances)
+	mux.HandleFunc("/api/grievances/update", handleGrievanceUpdate)
+	mux.HandleFunc("/api/grievances/report", handleGrievanceReport)
+	mux.HandleFunc("/api/sla", handleAPISLA)
+	mux.HandleFunc("/api/digest/preview", handleDigestPreview)
+	mux.HandleFunc("/api/digest/send", handleDigestSend)
+	mux.HandleFunc("/admin/queues", handleAdminQueues)
+	mux.HandleFunc("/admin", handleAdminIndex)
+	mux.HandleFunc("/admin/jobs", handleAdminJobs)
+	mux.HandleFunc("/admin/audit-log", handleAdminAuditLog)
+	mux.HandleFunc("/admin/data-quality", handleAdminDataQuality)
+	mux.HandleFunc("/admin/suppression", handleAdminSuppression)
 	mux.HandleFunc("/api/school", handleAPISchool)
+	mux.HandleFunc("/api/scorecard", handleAPIScorecard)
+	mux.HandleFunc("/api/employees", handleAPIEmployees)
+	mux.HandleFunc("/api/v1/employees", handleAPIEmployees)
+	mux.HandleFunc("/api/v1/employees/facets", handleAPIEmployeeFacets)
+	mux.HandleFunc("/api/v1/employees/lookup", handleEmployeesLookup)
+	mux.HandleFunc("/api/schools", handleAPISchools)
+	mux.HandleFunc("/api/v1/schools", handleAPISchools)
+	mux.HandleFunc("/api/staff", handleAPIStaff)
+	mux.HandleFunc("/api/v1/staff", handleAPIStaff)
+	mux.HandleFunc("/api/v1/pivot", handleAPIPivot)
+	mux.HandleFunc("/api/v1/builds", handleAPIBuilds)
+	mux.HandleFunc("/api/v1/build/last", handleAPIBuildLast)
+	mux.HandleFunc("/api/v1/build/staged", handleAPIStaged)
+	mux.HandleFunc("/api/v1/build/staged/{decision}", handleStagedDecision)
+	mux.HandleFunc("/admin/stage", handleAdminStage)
+	mux.HandleFunc("/api/archive", handleAPIArchive)
+	mux.HandleFunc("/archive/{$}", handleArchiveIndex)
+	mux.HandleFunc("/archive/{month}/{$}", handleArchivePage)
+	mux.HandleFunc("/archive/{month}/data/{file}", handleArchiveData)
+	mux.HandleFunc("/api/v1/builds/history", handleAPIBuildHistory)
+	mux.HandleFunc("/api/leader", handleAPILeader)
+	mux.HandleFunc("/api/views", handleAPIViews)
+	mux.HandleFunc("/api/subscriptions", handleSubscriptions)
+	mux.HandleFunc("/api/subscriptions/send", handleSubscriptionSend)
+	mux.HandleFunc("/api/circulars", handleCirculars)
+	mux.HandleFunc("/api/circulars/{id}/{decision}", handleCircularDecision)
+	mux.HandleFunc("/admin/circulars", handleAdminCirculars)
+	mux.HandleFunc("/api/alerts", handleAlerts)
+	mux.HandleFunc("/api/alerts/outstanding", handleAlertsOutstanding)
+	mux.HandleFunc("/alert/ack", handleAlertAckPage)
+	mux.HandleFunc("/api/school/escalation", handleSchoolEscalation)
+	mux.HandleFunc("/v/{code}", handleViewLink)
+	mux.HandleFunc("/api/snapshots", handleAPISnapshots)
+	mux.HandleFunc("/api/profiles", handleAPIProfiles)
+	mux.HandleFunc("/api/profiles/switch", handleProfileSwitch)
+	mux.HandleFunc("/snapshot/tag", handleSnapshotTag)
+	mux.HandleFunc("/compare", handleCompare)
+	mux.HandleFunc("/data/", handleDataFile)
+	mux.HandleFunc("/widgets/", handleWidgetIndex)
+	mux.HandleFunc("/widgets/zone/{zone}", handleWidgetZone)
+	mux.HandleFunc("/widgets/dbt", handleWidgetDBT)
+	mux.HandleFunc("/widgets/aggregates.json", handlePublicAggregates)
+	mux.HandleFunc("/login", handleLogin)
+	mux.HandleFunc("/login/verify", handleLoginVerify)
+	mux.HandleFunc("/logout", handleLogout)
+	mux.HandleFunc("/admin/sessions", handleAdminSessions)
+	mux.HandleFunc("/api/sessions", handleAPISessions)
+	mux.HandleFunc("/api/sessions/revoke", handleSessionsRevoke)
 	mux.HandleFunc("/toggle-live", handleToggleLive)
 	mux.HandleFunc("/send-birthdays", handleSendBirthdays)
+	mux.HandleFunc("/preview-birthdays", handlePreviewBirthdays)
+	mux.HandleFunc("/send-zone-digest", handleSendZoneDigest)
+	mux.HandleFunc("/api/zone-digest/preview", handleZoneDigestPreview)
+	mux.HandleFunc("/api/audits", handleAudits)
+	mux.HandleFunc("/api/audits/summary", handleAuditSummary)
+	mux.HandleFunc("/api/audits/checklist", handleAuditChecklist)
+	mux.HandleFunc("/api/audits/draw", handleAuditDraw)
+	mux.HandleFunc("/api/audits/update", handleAuditUpdate)
+	mux.HandleFunc("/api/purge", handlePurge)
+	mux.HandleFunc("/api/purge/report", handlePurgeReport)
+	mux.HandleFunc("/api/data-quality", handleDataQuality)
+	mux.HandleFunc("/api/duplicates", handleDuplicates)
 	mux.HandleFunc("/send-anniversaries", handleSendAnniversaries)
 	mux.HandleFunc("/send-whatsapp-invite", handleSendWhatsAppInvite)
+	mux.HandleFunc("/api/mail/jobs/{id}", handleMailJob)
+	mux.HandleFunc("/api/mail/queue", handleMailQueue)
+	mux.HandleFunc("/api/email-log", handleEmailLog)
+	mux.HandleFunc("/api/mail/queue/retry", handleMailRetry)
 	mux.HandleFunc("/refresh", func(w http.ResponseWriter, r *http.Request) {
-		buildAll()
-		http.Redirect(w, r, "/", http.StatusFound)
+		t := tenantFor(r)
+		if err := t.Build(); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		http.Redirect(w, r, t.Prefix+"/", http.StatusFound)
 	})
-	log.Printf("✅ Server running on http://localhost%v", *listen)
-	if err := http.ListenAndServe(*listen, mux); err != nil {
-		log.Fatal(err)
-	}
+	return mux
 }
 
 func handleIndex(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	page := strings.ReplaceAll(indexHTML, "{{TITLE}}", html.EscapeString(*title))
-
-	jsonStr := func(v any) string { b, _ := json.Marshal(v); return string(b) }
-	page = strings.ReplaceAll(page, "{{EMP_JSON}}", jsonStr(EMP))
-	page = strings.ReplaceAll(page, "{{SCH_JSON}}", jsonStr(SCH))
-	page = strings.ReplaceAll(page, "{{DEMO_ZONES_JSON}}", jsonStr(DEMO_ZONES))
-	page = strings.ReplaceAll(page, "{{CATEGORY_WISE_JSON}}", jsonStr(CATEGORY_WISE))
-	page = strings.ReplaceAll(page, "{{GENDER_WISE_JSON}}", jsonStr(GENDER_WISE))
-	page = strings.ReplaceAll(page, "{{ZLBL}}", jsonStr(ZLBL))
-	page = strings.ReplaceAll(page, "{{ZVAL}}", jsonStr(ZVAL))
-	page = strings.ReplaceAll(page, "{{DLBL}}", jsonStr(DLBL))
-	page = strings.ReplaceAll(page, "{{DVAL}}", jsonStr(DVAL))
-
-	page = strings.ReplaceAll(page, "{{TOTAL_EMP}}", strconv.Itoa(len(EMP)))
-	page = strings.ReplaceAll(page, "{{TOTAL_SCHOOLS}}", strconv.Itoa(len(SCH)))
-	zoneSet := map[string]bool{}
-	desigSet := map[string]bool{}
-	for _, e := range EMP {
-		if e.Zone != "" {
-			zoneSet[e.Zone] = true
-		}
-		if e.Designation != "" {
-			desigSet[e.Designation] = true
-		}
+	t := tenantFor(r)
+	page, err := renderPage(t, dataFor(r))
+	if err != nil {
+		log.Printf("page %s: %v", t.ID, err)
+		writeError(w, 500, errInternal, "page template: "+err.Error())
+		return
 	}
-	page = strings.ReplaceAll(page, "{{TOTAL_ZONES}}", strconv.Itoa(len(zoneSet)))
-	page = strings.ReplaceAll(page, "{{TOTAL_DESIGS}}", strconv.Itoa(len(desigSet)))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	_, _ = w.Write([]byte(page))
+	// the shell is tiny but still worth a 304 on repeat visits
+	sum := sha256.Sum256(page)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	_, _ = w.Write(page)
 }
 
 func handleAPIEmployee(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	id := normalizeEmpID(r.URL.Query().Get("id"))
+	id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
 	if id == "" {
-		http.Error(w, `{"error":"missing id"}`, 400)
+		writeError(w, 400, errBadRequest, "missing id")
 		return
 	}
-	e, ok := EMP[id]
+	e, ok := dataFor(r).EMP[id]
 	if !ok {
-		http.Error(w, `{"error":"not found"}`, 404)
+		writeError(w, 404, errNotFound, "employee "+id+" not found")
 		return
 	}
-	_ = json.NewEncoder(w).Encode(e)
+	writeData(w, e, nil)
 }
 
 func handleAPISchool(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	id := digitsOnly(r.URL.Query().Get("id"))
+	id := ingest.DigitsOnly(r.URL.Query().Get("id"))
 	if id == "" {
-		http.Error(w, `{"error":"missing id"}`, 400)
+		writeError(w, 400, errBadRequest, "missing id")
 		return
 	}
-	s, ok := SCH[id]
+	ds := dataFor(r)
+	s, ok := ds.SCH[id]
 	if !ok {
-		http.Error(w, `{"error":"not found"}`, 404)
+		writeError(w, 404, errNotFound, "school "+id+" not found")
 		return
 	}
 
@@ -770,247 +629,147 @@ func handleAPISchool(w http.ResponseWriter, r *http.Request) {
 		Staff  SchoolStaff `json:"staff"`
 	}
 	roster := []Emp{}
-	actualT := 0
-	hasP := false
-	hasSE := false
-	totalSt := 0
-	for _, e := range EMP {
+	for _, e := range ds.EMP {
 		if e.SchoolID == id {
 			roster = append(roster, e)
-			totalSt++
-			d := strings.ToLower(e.Designation)
-			if strings.Contains(d, "teacher") {
-				actualT++
-			}
-			if strings.Contains(d, "principal") {
-				hasP = true
-			}
-			if strings.Contains(d, "special educator") {
-				hasSE = true
-			}
 		}
 	}
-	neededT := int(math.Ceil(float64(s.MaxPresent) / 40.0))
-	if neededT < 0 {
-		neededT = 0
-	}
-	sv := actualT - neededT
-	ratio := 0.0
-	if actualT > 0 {
-		ratio = float64(s.MaxPresent) / float64(actualT)
-	}
 	resp := Resp{
 		School: s,
 		Roster: roster,
-		Staff: SchoolStaff{
-			ID: s.ID, Name: s.Name, Zone: s.Zone,
-			NeededTeachers: neededT, ActualTeachers: actualT, SurplusVacancy: sv,
-			HasPrincipal: hasP, HasSpecialEdu: hasSE, TotalStaff: totalSt, Ratio: ratio,
-		},
+		Staff:  schoolStaff(s, roster),
 	}
-	_ = json.NewEncoder(w).Encode(resp)
+	writeData(w, resp, nil)
 }
 
 func handleToggleLive(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
 	on := r.URL.Query().Get("on")
+	if on == "1" && *sandboxMode {
+		writeError(w, http.StatusConflict, errConflict, "sandbox mode: mails are never sent")
+		return
+	}
 	if on == "1" {
+		if err := hqMailReady(); err != nil {
+			writeError(w, http.StatusConflict, errConflict, err.Error())
+			return
+		}
 		LiveMode = true
 	} else {
 		LiveMode = false
 	}
-	fmt.Fprintf(w, "Mode: %v", LiveMode)
+	writeData(w, map[string]bool{"live": LiveMode}, nil)
+}
+
+// campaignSends are the greeting campaigns, by the name "mcd send" takes.
+// job is the mail job their mails are counted under ("" = none).
+var campaignSends = map[string]func(t *Tenant, today time.Time, job string) map[string]int{
+	"birthdays":     sendBirthdays,
+	"anniversaries": sendAnniversaries,
+	"whatsapp":      func(t *Tenant, _ time.Time, job string) map[string]int { return sendWhatsAppInvites(t, job) },
 }
 
 func handleSendBirthdays(w http.ResponseWriter, r *http.Request) {
-	today := time.Now()
-	count := 0
-	validDOB := 0
-	for _, e := range EMP {
-		if e.Email == "" || e.DOB == "" {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	t := tenantFor(r)
+	startMailJob(w, t, "birthdays", func(job string) map[string]int { return sendBirthdays(t, time.Now(), job) })
+}
+
+func handleSendAnniversaries(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	t := tenantFor(r)
+	startMailJob(w, t, "anniversaries", func(job string) map[string]int { return sendAnniversaries(t, time.Now(), job) })
+}
+
+func handleSendWhatsAppInvite(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	t := tenantFor(r)
+	startMailJob(w, t, "whatsapp", func(job string) map[string]int { return sendWhatsAppInvites(t, job) })
+}
+
+// birthdaysOn is who a birthday greeting goes to on today's day and month,
+// and how many employees have a readable date of birth.
+func birthdaysOn(t *Tenant, today time.Time, skip *campaignFilter) (matched []Emp, validDOB int) {
+	for _, e := range t.Data().EMP {
+		if e.Email == "" || e.DOB == "" || skip.Skip(e) {
 			continue
 		}
-		d, err := parseDMYFlexible(e.DOB)
+		d, err := ingest.ParseDMYFlexible(e.DOB)
 		if err != nil {
 			continue
 		}
 		validDOB++
 		if d.Day() == today.Day() && d.Month() == today.Month() {
-			sal := "Dear Sir/Madam"
-			if strings.HasPrefix(strings.ToUpper(e.Gender), "M") {
-				sal = "Dear Sir " + e.Name
-			}
-			if strings.HasPrefix(strings.ToUpper(e.Gender), "F") {
-				sal = "Dear Madam " + e.Name
-			}
-			sub := "🎉 Warm Birthday Wishes from HQ Team IT Education"
-			body := fmt.Sprintf(`
-<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);">
-    <div style="background: white; padding: 30px; border-radius: 15px; box-shadow: 0 10px 30px rgba(0,0,0,0.2);">
-        <h1 style="color: #667eea; text-align: center; margin-bottom: 20px;">🎉 Happy Birthday! 🎂</h1>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">%s,</p>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">
-            Wishing you a very <strong>Happy Birthday</strong> filled with joy, laughter, and wonderful moments!
-        </p>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">
-            May this special day bring you happiness and may the year ahead be filled with success and good health!
-        </p>
-        
-        <div style="background: linear-gradient(135deg, #25D366 0%%, #128C7E 100%%); padding: 20px; border-radius: 10px; margin: 25px 0; text-align: center;">
-            <h3 style="color: white; margin: 0 0 15px 0;">📢 Join Our WhatsApp Channel!</h3>
-            <p style="color: white; margin-bottom: 15px; font-size: 14px;">Stay connected with HQ Team IT Education</p>
-            <a href="https://whatsapp.com/channel/0029Vb6hLZd1CYoIFek51P0V" 
-               style="display: inline-block; background: white; color: #25D366; padding: 12px 30px; 
-                      text-decoration: none; border-radius: 25px; font-weight: bold; font-size: 16px;">
-                Join Channel Now →
-            </a>
-        </div>
-        
-        <hr style="border: none; border-top: 2px solid #eee; margin: 25px 0;">
-        <p style="font-size: 14px; color: #666;">
-            With warm regards,<br>
-            <strong style="color: #667eea;">%s</strong>
-        </p>
-    </div>
-</div>
-`, sal, EmailName)
-			if err := sendEmail(e.Email, sub, body); err == nil {
-				count++
-			}
+			matched = append(matched, e)
 		}
 	}
-	fmt.Fprintf(w, "🎂 Birthday emails sent to %d employees. (valid DOB parsed: %d)", count, validDOB)
+	return matched, validDOB
 }
 
-func handleSendAnniversaries(w http.ResponseWriter, r *http.Request) {
-	today := time.Now()
+// sendBirthdays greets everyone born on today's day and month.
+func sendBirthdays(t *Tenant, today time.Time, job string) map[string]int {
+	count := 0
+	skip := newCampaignFilter(t, channelEmail)
+	mailer := newCampaignMailer(t, campaignBirthday, job)
+	matched, validDOB := birthdaysOn(t, today, skip)
+	for _, e := range matched {
+		if err := mailer.Send(e, nil); err == nil {
+			count++
+		}
+	}
+	return map[string]int{"sent": count, "valid_dob": validDOB, "blacked_out": skip.Skipped, "opted_out": skip.OptedOut,
+		"variant_a": mailer.Sent["A"], "variant_b": mailer.Sent["B"], "already_sent": mailer.Already}
+}
+
+// sendAnniversaries greets everyone who joined on today's day and month.
+func sendAnniversaries(t *Tenant, today time.Time, job string) map[string]int {
 	count := 0
 	validDOJ := 0
-	for _, e := range EMP {
-		if e.Email == "" || e.DOJ == "" {
+	skip := newCampaignFilter(t, channelEmail)
+	mailer := newCampaignMailer(t, campaignAnniversary, job)
+	for _, e := range t.Data().EMP {
+		if e.Email == "" || e.DOJ == "" || skip.Skip(e) {
 			continue
 		}
-		d, err := parseDMYFlexible(e.DOJ)
+		d, err := ingest.ParseDMYFlexible(e.DOJ)
 		if err != nil {
 			continue
 		}
 		validDOJ++
 		if d.Day() == today.Day() && d.Month() == today.Month() {
 			yrs := today.Year() - d.Year()
-			sal := "Dear Sir/Madam"
-			if strings.HasPrefix(strings.ToUpper(e.Gender), "M") {
-				sal = "Dear Sir " + e.Name
-			}
-			if strings.HasPrefix(strings.ToUpper(e.Gender), "F") {
-				sal = "Dear Madam " + e.Name
-			}
-			sub := "🏅 Congratulations on your Work Anniversary!"
-			body := fmt.Sprintf(`
-<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; background: linear-gradient(135deg, #f093fb 0%%, #f5576c 100%%);">
-    <div style="background: white; padding: 30px; border-radius: 15px; box-shadow: 0 10px 30px rgba(0,0,0,0.2);">
-        <h1 style="color: #f5576c; text-align: center; margin-bottom: 20px;">🏅 Work Anniversary Celebration! 🎊</h1>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">%s,</p>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">
-            Congratulations on completing <strong style="color: #f5576c; font-size: 20px;">%d years</strong> of dedicated service with us!
-        </p>
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">
-            Your commitment, hard work, and contributions have been invaluable to our organization. Thank you for your continued excellence!
-        </p>
-        
-        <div style="background: linear-gradient(135deg, #25D366 0%%, #128C7E 100%%); padding: 20px; border-radius: 10px; margin: 25px 0; text-align: center;">
-            <h3 style="color: white; margin: 0 0 15px 0;">📢 Join Our WhatsApp Channel!</h3>
-            <p style="color: white; margin-bottom: 15px; font-size: 14px;">Stay connected with HQ Team IT Education</p>
-            <a href="https://whatsapp.com/channel/0029Vb6hLZd1CYoIFek51P0V" 
-               style="display: inline-block; background: white; color: #25D366; padding: 12px 30px; 
-                      text-decoration: none; border-radius: 25px; font-weight: bold; font-size: 16px;">
-                Join Channel Now →
-            </a>
-        </div>
-        
-        <hr style="border: none; border-top: 2px solid #eee; margin: 25px 0;">
-        <p style="font-size: 14px; color: #666;">
-            With appreciation and best wishes,<br>
-            <strong style="color: #f5576c;">%s</strong>
-        </p>
-    </div>
-</div>
-`, sal, yrs, EmailName)
-			if err := sendEmail(e.Email, sub, body); err == nil {
+			if err := mailer.Send(e, map[string]string{"YEARS": strconv.Itoa(yrs)}); err == nil {
 				count++
 			}
 		}
 	}
-	fmt.Fprintf(w, "🏅 Anniversary emails sent to %d employees. (valid DOJ parsed: %d)", count, validDOJ)
+	return map[string]int{"sent": count, "valid_doj": validDOJ, "blacked_out": skip.Skipped, "opted_out": skip.OptedOut,
+		"variant_a": mailer.Sent["A"], "variant_b": mailer.Sent["B"], "already_sent": mailer.Already}
 }
 
-func handleSendWhatsAppInvite(w http.ResponseWriter, r *http.Request) {
+// sendWhatsAppInvites mails the WhatsApp group invite to everyone.
+func sendWhatsAppInvites(t *Tenant, job string) map[string]int {
 	count := 0
-	channelLink := "https://whatsapp.com/channel/0029Vb6hLZd1CYoIFek51P0V"
-
-	for _, e := range EMP {
-		if e.Email == "" {
+	skip := newCampaignFilter(t, channelEmail)
+	mailer := newCampaignMailer(t, campaignWhatsApp, job)
+	for _, e := range t.Data().EMP {
+		if e.Email == "" || skip.Skip(e) {
 			continue
 		}
-
-		sal := "Dear Sir/Madam"
-		if strings.HasPrefix(strings.ToUpper(e.Gender), "M") {
-			sal = "Dear Sir " + e.Name
-		}
-		if strings.HasPrefix(strings.ToUpper(e.Gender), "F") {
-			sal = "Dear Madam " + e.Name
-		}
-
-		sub := "📢 Join HQ Team IT Education WhatsApp Channel"
-		body := fmt.Sprintf(`
-<div style="font-family: Arial, sans-serif; max-width: 600px; margin: 0 auto; padding: 20px; background: linear-gradient(135deg, #25D366 0%%, #128C7E 100%%);">
-    <div style="background: white; padding: 30px; border-radius: 15px; box-shadow: 0 10px 30px rgba(0,0,0,0.2);">
-        <div style="text-align: center; margin-bottom: 20px;">
-            <h1 style="color: #25D366; margin: 0;">HQ TEAM IT EDUCATION</h1>
-            <p style="color: #666; margin-top: 10px;">WhatsApp Channel</p>
-        </div>
-        
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">%s,</p>
-        
-        <p style="font-size: 16px; line-height: 1.6; color: #333;">
-            We're excited to invite you to join our <strong>official WhatsApp channel</strong>!
-        </p>
-        
-        <div style="background: #f0f9ff; padding: 20px; border-radius: 10px; margin: 20px 0; border-left: 4px solid #25D366;">
-            <p style="margin: 0; color: #333; font-size: 15px;">
-                📌 Get instant updates<br>
-                📌 Important announcements<br>
-                📌 News and events<br>
-                📌 Direct communication
-            </p>
-        </div>
-        
-        <div style="text-align: center; margin: 30px 0;">
-            <a href="%s" 
-               style="display: inline-block; background: linear-gradient(135deg, #25D366 0%%, #128C7E 100%%); 
-                      color: white; padding: 15px 40px; text-decoration: none; border-radius: 30px; 
-                      font-weight: bold; font-size: 18px; box-shadow: 0 5px 15px rgba(37, 211, 102, 0.3);">
-                📱 Join Channel Now
-            </a>
-        </div>
-        
-        <p style="font-size: 14px; color: #666; text-align: center; margin-top: 25px;">
-            Click the button above or scan the QR code using your WhatsApp camera
-        </p>
-        
-        <hr style="border: none; border-top: 2px solid #eee; margin: 25px 0;">
-        <p style="font-size: 14px; color: #666;">
-            Best regards,<br>
-            <strong style="color: #25D366;">%s</strong>
-        </p>
-    </div>
-</div>
-`, sal, channelLink, EmailName)
-
-		if err := sendEmail(e.Email, sub, body); err == nil {
+		if err := mailer.Send(e, nil); err == nil {
 			count++
 		}
 	}
-
-	fmt.Fprintf(w, "📢 WhatsApp channel invites sent to %d employees.", count)
+	return map[string]int{"sent": count, "blacked_out": skip.Skipped, "opted_out": skip.OptedOut,
+		"variant_a": mailer.Sent["A"], "variant_b": mailer.Sent["B"], "already_sent": mailer.Already}
 }
 
 // ---- Embedded HTML ----
@@ -1018,7 +777,7 @@ var indexHTML = `<!doctype html>
 <html lang="en">
 <head>
   <meta charset="utf-8">
-  <title>{{TITLE}}</title>
+  <title>{{.Title}}</title>
   <meta name="viewport" content="width=device-width, initial-scale=1" />
   <link rel="preconnect" href="https://fonts.googleapis.com">
   <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
@@ -1049,6 +808,7 @@ var indexHTML = `<!doctype html>
     .data-table{width:100%;border-collapse:collapse;font-size:.92rem;min-width:1400px}
     .data-table th,.data-table td{border:1px solid #27304a;padding:8px 10px;text-align:center;white-space:normal;word-break:break-word;font-size:14px;min-width:95px;max-width:120px;letter-spacing:0.2px;color:#e6edf6}
     .data-table th{background:#101828;position:sticky;top:0;z-index:1;color:#cbd5e1;font-weight:600}
+    .data-table th[onclick]{cursor:pointer}
     .grid-2{display:grid;grid-template-columns:repeat(2,minmax(0,1fr));gap:10px}
     .flex{display:flex;gap:8px;flex-wrap:wrap;align-items:center}
     .header-nums{display:grid;grid-template-columns:repeat(4,1fr);gap:10px;margin:10px 0}
@@ -1074,23 +834,21 @@ var indexHTML = `<!doctype html>
     .table-wrap::-webkit-scrollbar-thumb{background:#334155;border-radius:8px}
   </style>
   <script>
-    window.EMP = {{EMP_JSON}};
-    window.SCH = {{SCH_JSON}};
-    window.DEMO_ZONES = {{DEMO_ZONES_JSON}};
-    window.CATEGORY_WISE = {{CATEGORY_WISE_JSON}};
-    window.GENDER_WISE = {{GENDER_WISE_JSON}};
-    window.ZLBL = {{ZLBL}}; window.ZVAL = {{ZVAL}}; window.DLBL = {{DLBL}}; window.DVAL = {{DVAL}};
+    window.SCORECARD = {{.Scorecard}};
+    window.DATA_FILES = {{.DataFiles}};
+    window.BASE = {{.Base}};
+    window.TREND = {{.Trend}};
   </script>
 </head>
 <body>
   <div class="container">
-    <h1>🧭 {{TITLE}}</h1>
+    {{block "header" .}}<h1>🧭 {{.Title}}</h1>{{end}}
 
     <div class="header-nums">
-      <div class="headbox"><div class="small">TOTAL EMPLOYEES</div><div style="font-size:26px" id="num-emps">{{TOTAL_EMP}}</div></div>
-      <div class="headbox"><div class="small">SCHOOLS</div><div style="font-size:26px" id="num-schools">{{TOTAL_SCHOOLS}}</div></div>
-      <div class="headbox"><div class="small">ZONES</div><div style="font-size:26px" id="num-zones">{{TOTAL_ZONES}}</div></div>
-      <div class="headbox"><div class="small">DESIGNATIONS</div><div style="font-size:26px" id="num-desigs">{{TOTAL_DESIGS}}</div></div>
+      <div class="headbox"><div class="small">TOTAL EMPLOYEES</div><div style="font-size:26px" id="num-emps">{{.TotalEmp}}</div></div>
+      <div class="headbox"><div class="small">SCHOOLS</div><div style="font-size:26px" id="num-schools">{{.TotalSchools}}</div></div>
+      <div class="headbox"><div class="small">ZONES</div><div style="font-size:26px" id="num-zones">{{.TotalZones}}</div></div>
+      <div class="headbox"><div class="small">DESIGNATIONS</div><div style="font-size:26px" id="num-desigs">{{.TotalDesigs}}</div></div>
     </div>
 
     <!-- Row 0: Charts Top (2x2) -->
@@ -1101,6 +859,20 @@ var indexHTML = `<!doctype html>
       <div class="chart-card"><h3>Gender Split</h3><canvas id="genderChart" class="chart"></canvas></div>
     </div>
 
+    {{if .Trend}}<div class="card" id="trend" style="margin-top:12px">
+      <div class="flex" style="justify-content:space-between; align-items:flex-end">
+        <h2>📈 Month over Month</h2>
+        <div class="toolbar">
+          <select id="trend-zone" onchange="drawTrend()"><option value="">ALL</option></select>
+          <a class="btn" id="trend-csv" href="{{.Base}}/api/trend?format=csv">Export CSV</a>
+        </div>
+      </div>
+      <div class="charts">
+        <div class="chart-card"><h3>Enrolment and DBT</h3><canvas id="trendCountChart" class="chart"></canvas></div>
+        <div class="chart-card"><h3>Aadhaar Seeding %</h3><canvas id="trendAadhaarChart" class="chart"></canvas></div>
+      </div>
+    </div>{{end}}
+
     <!-- Row 1: Lookups -->
     <div class="row" style="margin-top:12px">
       <div class="card">
@@ -1144,12 +916,15 @@ var indexHTML = `<!doctype html>
         <div class="flex" style="margin-top:8px">
           <button class="btn primary" onclick="runEmpFilter()">Apply</button>
           <button class="btn" onclick="resetEmpFilter()">Reset</button>
-          <button class="btn" onclick="exportTableCSV('empFilterTable','employees_filtered.csv')">Export CSV</button>
+          <button class="btn" onclick="exportEmpCSV()">Export CSV</button>
+          <button class="btn" onclick="saveEmpView()">🔖 Save view</button>
+          <select id="f-views" onchange="openEmpView(this.value)"><option value="">Saved views…</option></select>
         </div>
+        <div class="toolbar" id="empPager"></div>
         <div class="table-wrap table-scroll" style="margin-top:8px">
           <table class="data-table" id="empFilterTable">
             <thead>
-              <tr><th>Employee</th><th>Designation</th><th>Zone</th><th>Gender</th><th>Category</th><th>Religion</th><th>Marital</th><th>Age</th><th>School</th></tr>
+              <tr><th onclick="sortEmpTable('name')">Employee</th><th onclick="sortEmpTable('designation')">Designation</th><th onclick="sortEmpTable('zone')">Zone</th><th onclick="sortEmpTable('gender')">Gender</th><th onclick="sortEmpTable('category')">Category</th><th onclick="sortEmpTable('religion')">Religion</th><th onclick="sortEmpTable('marital')">Marital</th><th onclick="sortEmpTable('age')">Age</th><th onclick="sortEmpTable('school')">School</th></tr>
             </thead>
             <tbody></tbody>
           </table>
@@ -1159,6 +934,27 @@ var indexHTML = `<!doctype html>
       <div class="card">
         <h2>Info</h2>
         <div class="small">Use Advanced Filter to slice the employee list instantly. Charts above reflect overall data (not filtered).</div>
+        <div class="small">Click a column header to sort (click again to reverse). Export CSV downloads every matching row, not just the current page.</div>
+      </div>
+    </div>
+
+    <div class="card">
+      <div class="flex" style="justify-content:space-between; align-items:flex-end">
+        <div>
+          <h2>🏫 School Directory</h2>
+          <div class="toolbar">
+            <select id="sch-zone" onchange="runSchoolTable(1)"></select>
+            <input id="sch-q" class="input" style="width:240px" placeholder="Name or ID" oninput="runSchoolTable(1)">
+          </div>
+        </div>
+        <button class="btn" onclick="exportSchoolCSV()">Export CSV</button>
+      </div>
+      <div class="toolbar" id="schPager"></div>
+      <div class="table-wrap table-scroll">
+        <table class="data-table" id="schoolTable">
+          <thead><tr><th onclick="sortSchoolTable('id')">ID</th><th onclick="sortSchoolTable('name')">School</th><th onclick="sortSchoolTable('zone')">Zone</th><th onclick="sortSchoolTable('si_name')">Inspector</th><th onclick="sortSchoolTable('enrolment')">Enrolment</th><th onclick="sortSchoolTable('max_present')">Max Present</th><th onclick="sortSchoolTable('with_aadhaar')">With Aadhaar</th><th onclick="sortSchoolTable('with_account')">With Account</th><th onclick="sortSchoolTable('dbt_total')">DBT Total</th></tr></thead>
+          <tbody></tbody>
+        </table>
       </div>
     </div>
 
@@ -1209,18 +1005,61 @@ var indexHTML = `<!doctype html>
       </div>
     </div>
 
+    <div class="card">
+      <div class="flex" style="justify-content:space-between; align-items:flex-end">
+        <h2>🏆 Inter-zone Scorecard</h2>
+        <button class="btn" onclick="exportTableCSV('scoreTable','zone_scorecard.csv')">Export CSV</button>
+      </div>
+      <div class="small">Scores are normalized 0–100 across zones (best zone = 100 on each dimension). Overall is the mean of the four.</div>
+      <div class="table-wrap table-scroll">
+        <table class="data-table" id="scoreTable">
+          <thead><tr><th>Rank</th><th>Zone</th><th>Schools</th><th>Employees</th><th>Staffing</th><th>DBT</th><th>Aadhaar</th><th>Data Quality</th><th>Overall</th><th>MDM %</th><th>Pass %</th></tr></thead>
+          <tbody></tbody>
+        </table>
+      </div>
+    </div>
+
+    {{with .Anomalies}}{{if .Total}}<div class="card" id="anomalies">
+      <div class="flex" style="justify-content:space-between; align-items:flex-end">
+        <h2>🧩 Data Anomalies</h2>
+        <a class="btn" href="{{$.Base}}/api/anomalies?format=csv">Export CSV</a>
+      </div>
+      <div class="small">Records outside every zone or school figure; fix them in the HR export or the DBT summary. The first {{len .UnknownZone}}, {{len .OrphanSchools}} and {{len .EmptySchools}} are shown.</div>
+      <h3>Employees without a zone ({{index $.AnomalyCount 0}})</h3>
+      <div class="table-wrap"><table class="data-table">
+        <thead><tr><th>Employee ID</th><th>Name</th><th>Designation</th><th>School</th><th>School's Zone</th></tr></thead>
+        <tbody>{{range .UnknownZone}}<tr><td>{{.EmpID}}</td><td>{{.Name}}</td><td>{{.Designation}}</td><td>{{.SchoolName}}</td><td>{{.Zone}}</td></tr>{{end}}</tbody>
+      </table></div>
+      <h3>School IDs not in the DBT summary ({{index $.AnomalyCount 1}})</h3>
+      <div class="table-wrap"><table class="data-table">
+        <thead><tr><th>School ID</th><th>School (as in Basic)</th><th>Zone</th><th>Employees</th></tr></thead>
+        <tbody>{{range .OrphanSchools}}<tr><td>{{.SchoolID}}</td><td>{{.SchoolName}}</td><td>{{.Zone}}</td><td>{{.Employees}}</td></tr>{{end}}</tbody>
+      </table></div>
+      <h3>Schools without staff ({{index $.AnomalyCount 2}})</h3>
+      <div class="table-wrap"><table class="data-table">
+        <thead><tr><th>School ID</th><th>School</th><th>Zone</th><th>SI</th><th>Enrolment</th></tr></thead>
+        <tbody>{{range .EmptySchools}}<tr><td>{{.SchoolID}}</td><td>{{.Name}}</td><td>{{.Zone}}</td><td>{{.SIName}}</td><td>{{.Enrolment}}</td></tr>{{end}}</tbody>
+      </table></div>
+    </div>{{end}}{{end}}
+
     <div class="flex" style="margin-top:10px">
-      <a class="btn" href="/refresh">🔄 Refresh</a>
-      <a class="btn" href="/toggle-live?on=1">✉️ Enable Live Email</a>
-      <a class="btn" href="/toggle-live?on=0">✉️ Disable Live Email</a>
-      <a class="btn" href="/send-birthdays">🎂 Send Birthdays</a>
-      <a class="btn" href="/send-anniversaries">🏅 Send Anniversaries</a>
-	  <a class="btn" href="/send-whatsapp-invite">📢 Send WhatsApp Invite to All</a>
+      {{block "actions" .}}<a class="btn" href="{{.Base}}/refresh">🔄 Refresh</a>
+      <select id="profileSel" style="display:none" onchange="switchProfile(this.value)"></select>
+      <a class="btn" href="{{.Base}}/toggle-live?on=1">✉️ Enable Live Email</a>
+      <a class="btn" href="{{.Base}}/toggle-live?on=0">✉️ Disable Live Email</a>
+      <a class="btn" href="{{.Base}}/preview-birthdays">👀 Preview Birthdays</a>
+      <a class="btn" href="{{.Base}}/send-birthdays">🎂 Send Birthdays</a>
+      <a class="btn" href="{{.Base}}/send-anniversaries">🏅 Send Anniversaries</a>
+	  <a class="btn" href="{{.Base}}/send-whatsapp-invite">📢 Send WhatsApp Invite to All</a>{{end}}
     </div>
 
     <button onclick="window.scrollTo({top:0,behavior:'smooth'})" style="position:fixed;right:14px;bottom:16px" class="btn">⬆ Top</button>
 
     <div class="small" style="margin-top:6px">Tip: Table CSV export respects current filters.</div>
+    {{block "footer" .}}<div class="small" id="provenance" style="margin-top:6px">Built {{date .BuiltAt "02 Jan 2006 15:04"}} from
+      {{range $i, $f := .Inputs}}{{if $i}} · {{end}}<span title="{{$f.Path}}&#10;sha256 {{$f.SHA256}}&#10;source: {{$f.Source}}">{{$f.Name}}
+      {{if $f.Missing}}(missing){{else}}({{short $f.SHA256}}, {{bytes $f.Size}}, modified {{date $f.ModTime "02 Jan 15:04"}}{{if ne $f.Source "disk"}}, fetched{{end}}){{end}}</span>{{end}}
+    </div>{{end}}
   </div>
 <div class="card" style="margin-top:12px">
   <h2>📢 WhatsApp Channel</h2>
@@ -1249,18 +1088,43 @@ var indexHTML = `<!doctype html>
   </div>
 </div>
   <script>
-    var EMP = (typeof window.EMP==='string')?JSON.parse(window.EMP):(window.EMP||{});
-    var SCH = (typeof window.SCH==='string')?JSON.parse(window.SCH):(window.SCH||{});
-    var DEMO_ZONES = (typeof window.DEMO_ZONES==='string')?JSON.parse(window.DEMO_ZONES):(window.DEMO_ZONES||[]);
-    var CATEGORY_WISE = (typeof window.CATEGORY_WISE==='string')?JSON.parse(window.CATEGORY_WISE):(window.CATEGORY_WISE||{});
-    var GENDER_WISE = (typeof window.GENDER_WISE==='string')?JSON.parse(window.GENDER_WISE):(window.GENDER_WISE||{});
-    window.ZLBL = {{ZLBL}}; window.ZVAL = {{ZVAL}}; window.DLBL = {{DLBL}}; window.DVAL = {{DVAL}};
+    var SCORECARD = (typeof window.SCORECARD==='string')?JSON.parse(window.SCORECARD):(window.SCORECARD||[]);
+    // Bulk data lives in content-hashed files (see /data/manifest.json); the browser cache keeps them until they change.
+    var DEMO_ZONES = [], CATEGORY_WISE = {}, GENDER_WISE = {};
+    function loadDemoData(){
+      var url = (window.DATA_FILES||{}).demo;
+      if(!url) return Promise.resolve();
+      return fetch(url).then(function(r){ return r.json(); }).then(function(d){
+        DEMO_ZONES = d.demo_zones || [];
+        CATEGORY_WISE = d.category_wise || {};
+        GENDER_WISE = d.gender_wise || {};
+        window.ZLBL = d.zlbl || []; window.ZVAL = d.zval || []; window.DLBL = d.dlbl || []; window.DVAL = d.dval || [];
+      });
+    }
 
     function fmt(n){ return (n==null?0:n).toLocaleString(); }
-    function digitsOnlyKey(s){ return (s||'').replace(/\\D+/g,''); }
+    // esc makes API values safe to put in innerHTML, text or attribute.
+    function esc(s){ return String(s==null?'':s).replace(/[&<>"']/g, function(c){ return {'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]; }); }
+    function digitsOnlyKey(s){ return (s||'').replace(/\D+/g,''); }
+    function qs(params){
+      return Object.keys(params||{}).filter(function(k){ return params[k]!=='' && params[k]!=null; })
+        .map(function(k){ return encodeURIComponent(k)+'='+encodeURIComponent(params[k]); }).join('&');
+    }
+    function api(path, params){
+      var q = qs(params);
+      return fetch((window.BASE||'') + path + (q ? '?'+q : '')).then(function(r){ return r.json(); });
+    }
+    function renderPager(id, meta, fnName){
+      var el=document.getElementById(id); if(!el) return;
+      var m=meta||{}; var page=m.page||1, pages=m.pages||1;
+      el.innerHTML =
+        '<button class="btn" '+(page<=1?'disabled':'onclick="'+fnName+'('+(page-1)+')"')+'>‹ Prev</button>' +
+        '<span class="small">Page '+page+' of '+Math.max(pages,1)+' • '+fmt(m.total||0)+' rows</span>' +
+        '<button class="btn" '+(page>=pages?'disabled':'onclick="'+fnName+'('+(page+1)+')"')+'>Next ›</button>';
+    }
 
     // Charts
-    (function(){
+    function initCharts(){
       try{
         var zctx=document.getElementById('zoneChart').getContext('2d');
         new Chart(zctx,{
@@ -1319,153 +1183,253 @@ var indexHTML = `<!doctype html>
           }
         });
       }catch(e){ console.warn('chart init failed', e); }
-    })();
+    }
+
+    // Month-over-month charts from the monthly DBT summaries (trend.go)
+    var TREND_CHARTS = [];
+    function initTrend(){
+      if(!window.TREND) return;
+      var sel=document.getElementById('trend-zone');
+      Object.keys(TREND.zones||{}).sort().forEach(function(z){
+        var o=document.createElement('option'); o.value=z; o.textContent=z; sel.appendChild(o);
+      });
+      drawTrend();
+    }
+    function drawTrend(){
+      try{
+        var z=document.getElementById('trend-zone').value;
+        var pts=z ? TREND.zones[z] : TREND.overall;
+        document.getElementById('trend-csv').href=BASE+'/api/trend?format=csv'+(z?'&zone='+encodeURIComponent(z):'');
+        TREND_CHARTS.forEach(function(c){ c.destroy(); });
+        function line(label,key,color){
+          return {label:label, data:pts.map(function(p){return p[key];}), borderColor:color, backgroundColor:color, tension:0.2};
+        }
+        TREND_CHARTS=[
+          new Chart(document.getElementById('trendCountChart').getContext('2d'),{
+            type:'line',
+            data:{labels:TREND.months, datasets:[line('Enrolment','enrolment','#00c4b4'), line('DBT Total','dbt_total','#3b82f6'), line('With Aadhaar','with_aadhaar','#facc15')]},
+            options:{scales:{y:{beginAtZero:true}}}
+          }),
+          new Chart(document.getElementById('trendAadhaarChart').getContext('2d'),{
+            type:'line',
+            data:{labels:TREND.months, datasets:[line('Aadhaar %','aadhaar_pct','#22c55e')]},
+            options:{scales:{y:{beginAtZero:true,max:100}}}
+          })
+        ];
+      }catch(e){ console.warn('trend charts failed', e); }
+    }
 
     // Advanced Filter options
+    var FACETS = {zones:[], designations:[], categories:[], religions:[]};
     function initEmpFilterOptions(){
-      var zones=new Set(["ALL"]); var desigs=new Set(["ALL"]); var cats=new Set(["ALL"]); var rels=new Set(["ALL"]);
-      Object.values(EMP).forEach(function(e){
-        if(e.zone) zones.add(e.zone);
-        if(e.designation) desigs.add(e.designation);
-        if(e.selection_category) cats.add(e.selection_category);
-        if(e.religion) rels.add(e.religion);
-      });
-      function fill(id,set){
+      function fill(id,list){
         var sel=document.getElementById(id); if(!sel) return;
-        sel.innerHTML='';
-        Array.from(set).sort().forEach(function(v){
-          sel.insertAdjacentHTML('beforeend','<option value="'+v+'">'+v+'</option>');
+        sel.innerHTML='<option value="ALL">ALL</option>';
+        (list||[]).forEach(function(v){
+          sel.insertAdjacentHTML('beforeend','<option value="'+esc(v)+'">'+esc(v)+'</option>');
         });
+        sel.value='ALL';
       }
-      fill('f-zone', zones); fill('f-desig', desigs); fill('f-cat', cats); fill('f-rel', rels);
-      document.getElementById('f-zone').value='ALL';
-      document.getElementById('f-desig').value='ALL';
-      document.getElementById('f-cat').value='ALL';
-      document.getElementById('f-rel').value='ALL';
+      fill('f-zone', FACETS.zones); fill('f-desig', FACETS.designations); fill('f-cat', FACETS.categories); fill('f-rel', FACETS.religions);
+      fill('sch-zone', FACETS.zones);
     }
-    document.addEventListener('DOMContentLoaded', initEmpFilterOptions);
-
-    function runEmpFilter(){
-      var z=(document.getElementById('f-zone').value||'ALL').toUpperCase();
-      var d=(document.getElementById('f-desig').value||'ALL').toUpperCase();
-      var g=(document.getElementById('f-gender').value||'ALL').toUpperCase();
-      var c=(document.getElementById('f-cat').value||'ALL').toUpperCase();
-      var r=(document.getElementById('f-rel').value||'ALL').toUpperCase();
-      var m=(document.getElementById('f-marital').value||'ALL').toUpperCase();
-      var a=parseInt(document.getElementById('f-age').value||'0',10);
-      function mcanon(x){
-        x = String(x||'').toUpperCase();
-        if(x==='WIDOW' || x==='WIDOWER') return 'WIDOW/WIDOWER';
-        if(x==='LIVE IN' || x==='LIVE-IN') return 'LIVE-IN';
-        return x;
-      }
-      m = mcanon(m);
-
-      var tbody=document.querySelector('#empFilterTable tbody'); tbody.innerHTML='';
-      var list=[];
-      Object.values(EMP).forEach(function(e){
-        if(z!=='ALL' && String(e.zone||'').toUpperCase()!==z) return;
-        if(d!=='ALL' && String(e.designation||'').toUpperCase()!==d) return;
-        var eg=String(e.gender||'').toUpperCase();
-        if(g!=='ALL' && eg!==g) return;
-        if(c!=='ALL' && String(e.selection_category||'').toUpperCase()!==c) return;
-        if(r!=='ALL' && String(e.religion||'').toUpperCase()!==r) return;
-        if(m!=='ALL' && mcanon(String(e.marital_status||'').toUpperCase())!==m) return;
-        if(a>0 && (e.age||0)<a) return;
-        list.push(e);
+    document.addEventListener('DOMContentLoaded', function(){
+      api('/api/v1/employees/facets').then(function(res){
+        FACETS = res.data || FACETS;
+        initEmpFilterOptions();
+        applyEmpFilters(new URLSearchParams(window.location.search));
+        loadEmpViews();
+        runEmpFilter(1);
+        runSchoolTable(1);
       });
-      list.sort(function(a,b){ return (a.name||'').localeCompare(b.name||''); });
-      var out='';
-      list.slice(0,500).forEach(function(e){
-        out += '<tr>' +
-          '<td>' + (e.name||'') + ' <span class="small">(' + (e.id||'') + ')</span></td>' +
-          '<td>' + (e.designation||'') + '</td>' +
-          '<td>' + (e.zone||'') + '</td>' +
-          '<td>' + (e.gender||'') + '</td>' +
-          '<td>' + (e.selection_category||'') + '</td>' +
-          '<td>' + (e.religion||'') + '</td>' +
-          '<td>' + (e.marital_status||'') + '</td>' +
-          '<td>' + (e.age||'') + '</td>' +
-          '<td>' + (e.school_name||'') + '</td>' +
-        '</tr>';
+    });
+
+    var EMP_SORT = 'name', EMP_PAGE = 1;
+    function empFilterParams(){
+      return {
+        zone: document.getElementById('f-zone').value||'ALL',
+        designation: document.getElementById('f-desig').value||'ALL',
+        gender: document.getElementById('f-gender').value||'ALL',
+        category: document.getElementById('f-cat').value||'ALL',
+        religion: document.getElementById('f-rel').value||'ALL',
+        marital: document.getElementById('f-marital').value||'ALL',
+        min_age: document.getElementById('f-age').value||'0',
+        sort: EMP_SORT
+      };
+    }
+    function runEmpFilter(page){
+      EMP_PAGE = (typeof page==='number') ? page : 1;
+      var p = empFilterParams(); p.page = EMP_PAGE; p.per_page = 100;
+      api('/api/v1/employees', p).then(function(res){
+        var tbody=document.querySelector('#empFilterTable tbody');
+        var out='';
+        (res.data||[]).forEach(function(e){
+          out += '<tr>' +
+            '<td>' + esc(e.name) + ' <span class="small">(' + esc(e.id) + ')</span></td>' +
+            '<td>' + esc(e.designation) + '</td>' +
+            '<td>' + esc(e.zone) + '</td>' +
+            '<td>' + esc(e.gender) + '</td>' +
+            '<td>' + esc(e.selection_category) + '</td>' +
+            '<td>' + esc(e.religion) + '</td>' +
+            '<td>' + esc(e.marital_status) + '</td>' +
+            '<td>' + esc(e.age) + '</td>' +
+            '<td>' + esc(e.school_name) + '</td>' +
+          '</tr>';
+        });
+        tbody.innerHTML = out || '<tr><td colspan="9" class="small">No results</td></tr>';
+        renderPager('empPager', res.meta, 'runEmpFilter');
       });
-      tbody.innerHTML = out || '<tr><td colspan="9" class="small">No results</td></tr>';
     }
-    function resetEmpFilter(){
-      initEmpFilterOptions();
+    function sortEmpTable(field){ EMP_SORT = (EMP_SORT===field) ? '-'+field : field; runEmpFilter(1); }
+    function exportEmpCSV(){ var p=empFilterParams(); p.format='csv'; window.location.href=(window.BASE||'')+'/api/v1/employees?'+qs(p); }
+    // Saved views (/api/views); a shared /v/{code} link lands here with the
+    // filters in the query string.
+    var EMP_FILTER_IDS = {zone:'f-zone', designation:'f-desig', gender:'f-gender', category:'f-cat', religion:'f-rel', marital:'f-marital', min_age:'f-age'};
+    var EMP_VIEWS = [];
+    function applyEmpFilters(get){
+      Object.keys(EMP_FILTER_IDS).forEach(function(k){
+        var v=get.get(k); if(v==null) return;
+        var sel=document.getElementById(EMP_FILTER_IDS[k]);
+        var opt=Array.prototype.find.call(sel.options, function(o){ return o.value.toUpperCase()===v.toUpperCase(); });
+        if(opt) sel.value=opt.value;
+      });
+      if(get.get('sort')) EMP_SORT=get.get('sort');
+    }
+    function loadEmpViews(){
+      api('/api/views').then(function(res){
+        EMP_VIEWS = res.data || [];
+        var sel=document.getElementById('f-views'); if(!sel) return;
+        sel.innerHTML='<option value="">Saved views…</option>';
+        EMP_VIEWS.forEach(function(v){ sel.insertAdjacentHTML('beforeend','<option value="'+esc(v.code)+'">'+esc(v.name)+'</option>'); });
+      });
+    }
+    function openEmpView(code){
+      var v=EMP_VIEWS.find(function(x){ return x.code===code; }); if(!v) return;
+      initEmpFilterOptions(); resetEmpSelects();
+      applyEmpFilters({get:function(k){ return (v.filters||{})[k]; }});
+      runEmpFilter(1);
+      prompt('Share this view', v.link);
+    }
+    function saveEmpView(){
+      var name=prompt('Name this view'); if(!name) return;
+      fetch((window.BASE||'') + '/api/views', {method:'POST', headers:{'Content-Type':'application/json'},
+        body: JSON.stringify({name:name, filters:empFilterParams()})})
+        .then(function(r){ return r.json(); })
+        .then(function(j){
+          if(j.errors){ alert(j.errors[0].detail); return; }
+          loadEmpViews();
+          prompt('Share this link', j.data.link);
+        });
+    }
+    function resetEmpSelects(){
       document.getElementById('f-gender').value='ALL';
       document.getElementById('f-marital').value='ALL';
       document.getElementById('f-age').value='0';
-      runEmpFilter();
+      EMP_SORT = 'name';
+    }
+    function resetEmpFilter(){
+      initEmpFilterOptions(); resetEmpSelects();
+      runEmpFilter(1);
+    }
+
+    // School directory
+    var SCH_SORT = 'name';
+    function schoolTableParams(){
+      return { zone: (document.getElementById('sch-zone')||{}).value||'ALL', q: (document.getElementById('sch-q')||{}).value||'', sort: SCH_SORT };
+    }
+    function runSchoolTable(page){
+      var p = schoolTableParams(); p.page = (typeof page==='number') ? page : 1; p.per_page = 50;
+      api('/api/v1/schools', p).then(function(res){
+        var tbody=document.querySelector('#schoolTable tbody'); if(!tbody) return;
+        tbody.innerHTML = (res.data||[]).map(function(s){
+          return '<tr><td>'+esc(s.id)+'</td><td>'+esc(s.name)+'</td><td>'+esc(s.zone)+'</td><td>'+esc(s.si_name)+'</td>' +
+            '<td>'+fmt(s.total_enrolment)+'</td><td>'+fmt(s.max_present)+'</td><td>'+fmt(s.with_aadhaar)+'</td><td>'+fmt(s.with_account)+'</td><td>'+fmt(s.dbt_total)+'</td></tr>';
+        }).join('') || '<tr><td colspan="9" class="small">No results</td></tr>';
+        renderPager('schPager', res.meta, 'runSchoolTable');
+      });
     }
-    document.addEventListener('DOMContentLoaded', runEmpFilter);
+    function sortSchoolTable(field){ SCH_SORT = (SCH_SORT===field) ? '-'+field : field; runSchoolTable(1); }
+    function exportSchoolCSV(){ var p=schoolTableParams(); p.format='csv'; window.location.href=(window.BASE||'')+'/api/v1/schools?'+qs(p); }
 
     // Employee Lookup
     function robustEmpFind(raw){
-      if(!raw) return null;
-      if(EMP[raw]) return EMP[raw];
-      var only = raw.replace(/\\D+/g,'');
-      if(only){
-        var hitK = Object.keys(EMP).find(function(k){ return k.replace(/\\D+/g,'') === only; });
-        if(hitK) return EMP[hitK];
-      }
-      if(raw.length >= 3){
-        var hit = Object.values(EMP).find(function(x){ return (x.name||'').toLowerCase().includes(raw.toLowerCase()); });
-        if(hit) return hit;
-      }
-      return null;
+      if(!raw) return Promise.resolve(null);
+      var only = raw.replace(/\D+/g,'');
+      var byID = only ? api('/api/emp', {id: only}).then(function(res){ return res.data || null; }) : Promise.resolve(null);
+      return byID.then(function(e){
+        if(e || raw.length < 3) return e;
+        return api('/api/v1/employees', {q: raw, per_page: 1}).then(function(res){ return (res.data||[])[0] || null; });
+      });
     }
     function findEmp(){
       var val=(document.getElementById('empid').value||'').trim();
       var out=document.getElementById('emp-out');
       if(!val){ out.innerHTML='<div class="small">Please enter Employee ID or Name.</div>'; return; }
-      var e = robustEmpFind(val);
+      robustEmpFind(val).then(function(e){
       if(!e){ out.innerHTML='<div class="small">No employee found.</div>'; return; }
       out.innerHTML =
         '<details open>' +
-          '<summary>📋 Personal Info — ' + (e.name||'') + ' (' + (e.id||'') + ')</summary>' +
+          '<summary>📋 Personal Info — ' + esc(e.name) + ' (' + esc(e.id) + ')</summary>' +
           '<div class="grid-2">' +
-            '<div><b>Gender:</b> ' + (e.gender||'') + '</div>' +
-            '<div><b>DOB:</b> ' + (e.dob||'') + ' <span class="small">(Age ' + (e.age||'') + ')</span></div>' +
-            '<div><b>Category:</b> ' + (e.selection_category||'') + '</div>' +
-            '<div><b>Religion:</b> ' + (e.religion||'') + '</div>' +
-            '<div><b>Marital:</b> ' + (e.marital_status||'') + '</div>' +
-            '<div><b>Mobile:</b> ' + (e.mobile||'') + '</div>' +
-            '<div><b>Email:</b> ' + (e.email||'') + '</div>' +
+            '<div><b>Gender:</b> ' + esc(e.gender) + '</div>' +
+            '<div><b>DOB:</b> ' + esc(e.dob) + ' <span class="small">(Age ' + esc(e.age) + ')</span></div>' +
+            '<div><b>Category:</b> ' + esc(e.selection_category) + '</div>' +
+            '<div><b>Religion:</b> ' + esc(e.religion) + '</div>' +
+            '<div><b>Marital:</b> ' + esc(e.marital_status) + '</div>' +
+            '<div><b>Mobile:</b> ' + esc(e.mobile) + '</div>' +
+            '<div><b>Email:</b> ' + esc(e.email) + '</div>' +
           '</div>' +
         '</details>' +
         '<details>' +
           '<summary>🧾 Service Info</summary>' +
           '<div class="grid-2">' +
-            '<div><b>Designation:</b> ' + (e.designation||'') + '</div>' +
-            '<div><b>DOJ:</b> ' + (e.doj||'') + '</div>' +
-            '<div><b>Appointment Date:</b> ' + (e.appointment_date||'') + '</div>' +
-            '<div><b>Promotion Date:</b> ' + (e.promotion_date||'') + '</div>' +
-            '<div><b>Transfer Date:</b> ' + (e.transfer_date||'') + '</div>' +
-            '<div><b>Zone:</b> ' + (e.zone||'') + '</div>' +
-            '<div><b>School:</b> ' + (e.school_name||'') + '</div>' +
+            '<div><b>Designation:</b> ' + esc(e.designation) + '</div>' +
+            '<div><b>DOJ:</b> ' + esc(e.doj) + '</div>' +
+            '<div><b>Appointment Date:</b> ' + esc(e.appointment_date) + '</div>' +
+            '<div><b>Promotion Date:</b> ' + esc(e.promotion_date) + '</div>' +
+            '<div><b>Transfer Date:</b> ' + esc(e.transfer_date) + '</div>' +
+            '<div><b>Zone:</b> ' + esc(e.zone) + '</div>' +
+            '<div><b>School:</b> ' + esc(e.school_name) + '</div>' +
           '</div>' +
         '</details>' +
         '<details>' +
           '<summary>🏠 Address & Family</summary>' +
           '<div class="grid-2">' +
-            '<div><b>Father:</b> ' + (e.father_name||'') + '</div>' +
-            '<div><b>Mother:</b> ' + (e.mother_name||'') + '</div>' +
-            '<div><b>Spouse:</b> ' + (e.spouse_name||'') + '</div>' +
-            '<div><b>Correspondence:</b> ' + (e.correspondence||'') + '</div>' +
-            '<div><b>Permanent:</b> ' + (e.permanent||'') + '</div>' +
-            '<div><b>Home Town:</b> ' + (e.home_town||'') + '</div>' +
+            '<div><b>Father:</b> ' + esc(e.father_name) + '</div>' +
+            '<div><b>Mother:</b> ' + esc(e.mother_name) + '</div>' +
+            '<div><b>Spouse:</b> ' + esc(e.spouse_name) + '</div>' +
+            '<div><b>Correspondence:</b> ' + esc(e.correspondence) + '</div>' +
+            '<div><b>Permanent:</b> ' + esc(e.permanent) + '</div>' +
+            '<div><b>Home Town:</b> ' + esc(e.home_town) + '</div>' +
           '</div>' +
-        '</details>';
+        '</details>' +
+        '<details id="emp-history"><summary>🕑 Change History</summary><div class="small">Loading…</div></details>' +
+        '<div style="margin-top:6px"><a class="btn" href="'+(window.BASE||'')+'/api/emp/servicebook?id='+encodeURIComponent(e.id)+'">📄 Service Book (PDF)</a></div>';
+        loadEmpHistory(e.id);
+      });
+    }
+    function loadEmpHistory(id){
+      api('/api/emp/history', {id: id}).then(function(res){
+        var box = document.querySelector('#emp-history div'); if(!box) return;
+        var list = (res.data||[]).slice().reverse();
+        if(!list.length){ box.innerHTML = 'No changes recorded.'; return; }
+        box.outerHTML = '<table class="data-table"><thead><tr><th>When</th><th>Field</th><th>From</th><th>To</th></tr></thead><tbody>' +
+          list.map(function(h){
+            return '<tr><td>'+esc((h.at||'').slice(0,10))+(h.profile?' ('+esc(h.profile)+')':'')+'</td><td>'+esc(h.field)+'</td><td>'+esc(h.from||'—')+'</td><td>'+esc(h.to||'—')+'</td></tr>';
+          }).join('') + '</tbody></table>';
+      });
     }
 
     // School Lookup
     function findSchool(){
       var raw=(document.getElementById('schid').value||''); var sid=digitsOnlyKey(raw);
       var out=document.getElementById('sch-out');
-      if(!sid || !SCH[sid]){ out.innerHTML='<div class="small">No school found.</div>'; return; }
-      var s = SCH[sid];
-      var roster = Object.values(EMP).filter(function(e){ return e.school_id === sid; });
+      if(!sid){ out.innerHTML='<div class="small">No school found.</div>'; return; }
+      api('/api/school', {id: sid}).then(function(res){
+      if(!res.data){ out.innerHTML='<div class="small">No school found.</div>'; return; }
+      var s = res.data.school;
+      var roster = res.data.roster || [];
+      var staff = res.data.staff || {};
       var priority = ["principal", "special educator", "teacher (primary)"];
       roster.sort(function(a,b){
         var da=(a.designation||'').toLowerCase(); var db=(b.designation||'').toLowerCase();
@@ -1476,23 +1440,23 @@ var indexHTML = `<!doctype html>
       });
       var desigCount = {}; roster.forEach(function(e){ var d=(e.designation||'Unknown').trim(); desigCount[d]=(desigCount[d]||0)+1; });
       var desigRows = Object.keys(desigCount).sort().map(function(d){
-        return '<tr><td>'+d+'</td><td>'+desigCount[d]+'</td></tr>';
+        return '<tr><td>'+esc(d)+'</td><td>'+desigCount[d]+'</td></tr>';
       }).join('');
-      var teacherCount = roster.filter(function(e){ return (e.designation||'').toLowerCase().includes('teacher'); }).length;
-      var hasPrincipal = roster.some(function(e){ return (e.designation||'').toLowerCase().includes('principal'); });
-      var hasSE = roster.some(function(e){ return (e.designation||'').toLowerCase().includes('special educator'); });
-      var needed = Math.ceil((s.max_present||0)/40);
-      var surplus = teacherCount - needed;
+      var teacherCount = staff.actual_teachers||0;
+      var hasPrincipal = !!staff.has_principal;
+      var hasSE = !!staff.has_special_educator;
+      var needed = staff.needed_teachers||0;
+      var surplus = staff.surplus_vacancy||0;
 
       out.innerHTML =
         '<details open>' +
-          '<summary>🏫 School Info — ' + (s.name||'') + ' (' + (s.id||'') + ')</summary>' +
+          '<summary>🏫 School Info — ' + esc(s.name) + ' (' + esc(s.id) + ') <a href="' + BASE + '/school/' + encodeURIComponent(s.id||'') + '">Details ›</a></summary>' +
           '<div class="grid-2">' +
-            '<div><b>Zone:</b> ' + (s.zone||'') + '</div>' +
-            '<div><b>Inspector:</b> ' + (s.si_name||'') + '</div>' +
+            '<div><b>Zone:</b> ' + esc(s.zone) + '</div>' +
+            '<div><b>Inspector:</b> ' + esc(s.si_name) + '</div>' +
             '<div><b>Total Enrolment:</b> ' + fmt(s.total_enrolment||0) + '</div>' +
-            '<div><b>Max Enrolment:</b> ' + fmt(s.max_enrolment||0) + ' ' + (s.max_enrolment_date?('('+s.max_enrolment_date+')'):'') + '</div>' +
-            '<div><b>Max Present:</b> ' + fmt(s.max_present||0) + ' ' + (s.max_present_date?('('+s.max_present_date+')'):'') + '</div>' +
+            '<div><b>Max Enrolment:</b> ' + fmt(s.max_enrolment||0) + ' ' + (s.max_enrolment_date?('('+esc(s.max_enrolment_date)+')'):'') + '</div>' +
+            '<div><b>Max Present:</b> ' + fmt(s.max_present||0) + ' ' + (s.max_present_date?('('+esc(s.max_present_date)+')'):'') + '</div>' +
             '<div><b>With Account:</b> ' + fmt(s.with_account||0) + '</div>' +
             '<div><b>Without Account:</b> ' + fmt(s.without_account||0) + '</div>' +
             '<div><b>With Aadhaar:</b> ' + fmt(s.with_aadhaar||0) + '</div>' +
@@ -1503,6 +1467,9 @@ var indexHTML = `<!doctype html>
             '<div><b>DBT Received (Student):</b> ' + fmt(s.dbt_student||0) + '</div>' +
             '<div><b>DBT Received (Parent):</b> ' + fmt(s.dbt_parent||0) + '</div>' +
             '<div><b>Total Received (Student + Parent):</b> ' + fmt(s.dbt_total||0) + '</div>' +
+            Object.keys(s.dbt_components||{}).sort().map(function(k){ var c=s.dbt_components[k];
+              return '<div><b>DBT ' + esc(k) + ':</b> ' + fmt(c.total||0) + ' (' + fmt(c.student||0) + ' student, ' + fmt(c.parent||0) + ' parent, ' + (c.pct||0).toFixed(1) + '%)</div>'; }).join('') +
+            (s.has_mdm ? '<div><b>Mid-day Meals' + (s.mdm_month?' ('+esc(s.mdm_month)+')':'') + ':</b> ' + fmt(s.mdm_meals_per_day||0) + '/day over ' + fmt(s.mdm_days||0) + ' days, ' + (s.mdm_coverage_pct||0).toFixed(1) + '% of enrolment' + (s.mdm_anomaly?' ⚠️ exceeds enrolment':'') + '</div>' : '') +
           '</div>' +
         '</details>' +
         '<details>' +
@@ -1525,36 +1492,44 @@ var indexHTML = `<!doctype html>
             '<table class="data-table">' +
               '<thead><tr><th>Emp ID</th><th>Name</th><th>Designation</th><th>Gender</th><th>Category</th><th>DOJ</th></tr></thead>' +
               '<tbody>' +
-                roster.map(function(e){ return '<tr><td>'+e.id+'</td><td>'+e.name+'</td><td>'+e.designation+'</td><td>'+e.gender+'</td><td>'+(e.selection_category||'')+'</td><td>'+(e.doj||'')+'</td></tr>'; }).join('') +
+                roster.map(function(e){ return '<tr><td>'+esc(e.id)+'</td><td>'+esc(e.name)+'</td><td>'+esc(e.designation)+'</td><td>'+esc(e.gender)+'</td><td>'+esc(e.selection_category)+'</td><td>'+esc(e.doj)+'</td></tr>'; }).join('') +
               '</tbody>' +
             '</table>' +
           '</div>' +
         '</details>';
+      });
     }
 
     // Name search helpers
+    var NAME_SEQ = {sch:0, emp:0};
     function searchSchoolByName(){
       var q=(document.getElementById('schname')||{}).value||''; var wrap=document.getElementById('schname-results'); if(!wrap) return;
       wrap.innerHTML=''; var qq=q.trim().toLowerCase(); if(!qq) return;
-      var arr=[]; for(var sid in SCH){ var s = SCH[sid]; if(!s||!s.name) continue; if(s.name.toLowerCase().includes(qq)){ arr.push(s); } }
-      if(!arr.length){ wrap.innerHTML='<div class="small">No matching schools</div>'; return; }
-      arr.sort(function(a,b){ return a.name.localeCompare(b.name); });
-      wrap.innerHTML = arr.slice(0,50).map(function(s){
-        return '<div class="item" onclick="document.getElementById(\'schid\').value=\''+s.id+'\'; findSchool(); window.scrollTo({top:0,behavior:\'smooth\'})">' +
-          '<div><b>'+s.name+'</b></div><div class="small">'+s.id+' • '+(s.zone||'')+'</div></div>';
-      }).join('');
+      var seq = ++NAME_SEQ.sch;
+      api('/api/v1/schools', {q: qq, per_page: 50, sort: 'name'}).then(function(res){
+        if(seq !== NAME_SEQ.sch) return;
+        var arr = res.data || [];
+        if(!arr.length){ wrap.innerHTML='<div class="small">No matching schools</div>'; return; }
+        wrap.innerHTML = arr.map(function(s){
+          return '<div class="item" onclick="document.getElementById(\'schid\').value=\''+digitsOnlyKey(s.id)+'\'; findSchool(); window.scrollTo({top:0,behavior:\'smooth\'})">' +
+            '<div><b>'+esc(s.name)+'</b></div><div class="small">'+esc(s.id)+' • '+esc(s.zone)+'</div></div>';
+        }).join('');
+      });
     }
     function searchEmpByName(){
       var q=(document.getElementById('empname')||{}).value||''; var wrap=document.getElementById('empname-results'); if(!wrap) return;
       wrap.innerHTML=''; var qq=q.trim().toLowerCase(); if(!qq) return;
-      var arr=[]; for(var id in EMP){ var e = EMP[id]; if(!e||!e.name) continue; if(e.name.toLowerCase().includes(qq)){ arr.push(e); } }
-      if(!arr.length){ wrap.innerHTML='<div class="small">No matching employees</div>'; return; }
-      arr.sort(function(a,b){ return a.name.localeCompare(b.name); });
-      wrap.innerHTML = arr.slice(0,50).map(function(e){
-        return '<div class="item" onclick="document.getElementById(\'empid\').value=\''+e.id+'\'; findEmp(); window.scrollTo({top:0,behavior:\'smooth\'})">' +
-          '<div><b>'+e.name+'</b> <span class="badge">'+(e.designation||'')+'</span></div>' +
-          '<div class="small">'+e.id+' • '+(e.school_name||'')+'</div></div>';
-      }).join('');
+      var seq = ++NAME_SEQ.emp;
+      api('/api/v1/employees', {q: qq, per_page: 50, sort: 'name'}).then(function(res){
+        if(seq !== NAME_SEQ.emp) return;
+        var arr = res.data || [];
+        if(!arr.length){ wrap.innerHTML='<div class="small">No matching employees</div>'; return; }
+        wrap.innerHTML = arr.map(function(e){
+          return '<div class="item" onclick="document.getElementById(\'empid\').value=\''+digitsOnlyKey(e.id)+'\'; findEmp(); window.scrollTo({top:0,behavior:\'smooth\'})">' +
+            '<div><b>'+esc(e.name)+'</b> <span class="badge">'+esc(e.designation)+'</span></div>' +
+            '<div class="small">'+esc(e.id)+' • '+esc(e.school_name)+'</div></div>';
+        }).join('');
+      });
     }
 
     // ===== Demographic Table (with filters) =====
@@ -1585,7 +1560,7 @@ var indexHTML = `<!doctype html>
       function fill(id,set){
         var sel=document.getElementById(id); if(!sel) return;
         sel.innerHTML='';
-        Array.from(set).sort().forEach(function(v){ sel.insertAdjacentHTML('beforeend','<option>'+v+'</option>'); });
+        Array.from(set).sort().forEach(function(v){ sel.insertAdjacentHTML('beforeend','<option>'+esc(v)+'</option>'); });
       }
       fill('demo-zone', zset); fill('demo-desig', dset); fill('demo-cat', cset);
       document.getElementById('demo-zone').value='ALL ZONES';
@@ -1600,7 +1575,7 @@ var indexHTML = `<!doctype html>
       if(!head || !body) return;
 
       var hdr = '<tr><th>Zone</th><th>Designation</th>';
-      DEMO_CAT_HEADERS.forEach(function(c){ hdr += '<th>'+c+' ♂</th><th>'+c+' ♀</th>'; });
+      DEMO_CAT_HEADERS.forEach(function(c){ hdr += '<th>'+esc(c)+' ♂</th><th>'+esc(c)+' ♀</th>'; });
       hdr += '<th>Total Male</th><th>Total Female</th><th>Total</th></tr>';
       head.innerHTML = hdr;
 
@@ -1623,7 +1598,7 @@ var indexHTML = `<!doctype html>
           if(fd!=='ALL DESIGNATIONS' && String(d.designation||'').toUpperCase()!==fd) return;
           var s = d.stats || {}; var cs = s.cat_stats || {};
           if(fc!=='ALL CATEGORIES' && !cs[fc]){ return; }
-          var cells = '<td>'+z.zone+'</td><td>'+d.designation+'</td>';
+          var cells = '<td>'+esc(z.zone)+'</td><td>'+esc(d.designation)+'</td>';
           DEMO_CAT_HEADERS.forEach(function(c){
             var v = cs[c] || {male:0, female:0};
             var m = (v.male==null?0:v.male), f=(v.female==null?0:v.female);
@@ -1664,7 +1639,7 @@ var indexHTML = `<!doctype html>
       function fill(id,set){
         var sel=document.getElementById(id); if(!sel) return;
         sel.innerHTML='';
-        Array.from(set).sort().forEach(function(v){ sel.insertAdjacentHTML('beforeend','<option>'+v+'</option>'); });
+        Array.from(set).sort().forEach(function(v){ sel.insertAdjacentHTML('beforeend','<option>'+esc(v)+'</option>'); });
       }
       fill('rel-zone', zset); fill('rel-desig', dset); fill('rel-rel', rset);
       document.getElementById('rel-zone').value='ALL ZONES';
@@ -1679,7 +1654,7 @@ var indexHTML = `<!doctype html>
       if(!head || !body) return;
 
       var hdr = '<tr><th>Zone</th><th>Designation</th>';
-      REL_HEADERS.forEach(function(r){ hdr += '<th>'+r+' ♂</th><th>'+r+' ♀</th>'; });
+      REL_HEADERS.forEach(function(r){ hdr += '<th>'+esc(r)+' ♂</th><th>'+esc(r)+' ♀</th>'; });
       hdr += '<th>Total Male</th><th>Total Female</th><th>Total</th></tr>';
       head.innerHTML = hdr;
 
@@ -1702,7 +1677,7 @@ var indexHTML = `<!doctype html>
           if(fd!=='ALL DESIGNATIONS' && String(d.designation||'').toUpperCase()!==fd) return;
           var s = d.stats || {}; var rs = s.religion_stats || {};
           if(fr!=='ALL RELIGIONS' && !rs[fr]){ return; }
-          var cells = '<td>'+z.zone+'</td><td>'+d.designation+'</td>';
+          var cells = '<td>'+esc(z.zone)+'</td><td>'+esc(d.designation)+'</td>';
           REL_HEADERS.forEach(function(r){
             var v = rs[r] || {male:0, female:0};
             var m = (v.male==null?0:v.male), f=(v.female==null?0:v.female);
@@ -1730,12 +1705,51 @@ var indexHTML = `<!doctype html>
       a.click(); window.URL.revokeObjectURL(url);
     }
 
-    // Initialize tables
+    // ===== Zone Scorecard =====
+    function buildScoreTable(){
+      var body = document.querySelector("#scoreTable tbody"); if(!body) return;
+      function pct(v){ return (v==null?0:v).toFixed(1); }
+      body.innerHTML = SCORECARD.map(function(z){
+        return '<tr><td>'+esc(z.rank)+'</td><td>'+esc(z.zone)+'</td><td>'+fmt(z.schools)+'</td><td>'+fmt(z.employees)+'</td>' +
+          '<td>'+pct(z.staffing)+'</td><td>'+pct(z.dbt)+'</td><td>'+pct(z.aadhaar)+'</td><td>'+pct(z.data_quality)+'</td><td>'+pct(z.overall)+'</td>' +
+          '<td>'+(z.mdm_coverage_pct?pct(z.mdm_coverage_pct)+(z.mdm_anomalies?' ⚠️'+z.mdm_anomalies:''):'–')+'</td>' +
+          '<td title="'+(z.results_ptr_r!=null?'r vs PTR '+z.results_ptr_r:'')+(z.results_attendance_r!=null?', r vs attendance '+z.results_attendance_r:'')+'">'+(z.pass_pct?pct(z.pass_pct):'–')+'</td></tr>';
+      }).join('') || '<tr><td colspan="11" class="small">No data</td></tr>';
+    }
+
+    // ===== Month profiles =====
+    function loadProfiles(){
+      api('/api/profiles').then(function(j){
+        var list = j.data||[], sel = document.getElementById('profileSel');
+        if(!sel || !list.length) return;
+        sel.innerHTML = '<option value="">📅 Month…</option>' + list.map(function(p){
+          return '<option value="'+esc(p.name)+'"'+(p.active?' selected':'')+'>'+esc(p.name)+'</option>';
+        }).join('');
+        sel.style.display = '';
+      });
+    }
+    function switchProfile(name){
+      if(!name) return;
+      fetch((window.BASE||'') + '/api/profiles/switch?name='+encodeURIComponent(name), {method:'POST'})
+        .then(function(r){ return r.json(); })
+        .then(function(j){
+          if(j.errors){ alert(j.errors[0].detail); return; }
+          window.location.reload();
+        });
+    }
+
+    // Initialize charts and tables
     document.addEventListener('DOMContentLoaded', function(){
-      buildDemoTable();
-      buildReligionTable();
-      fillDemoFilters();
-      fillReligionFilters();
+      buildScoreTable();
+      loadProfiles();
+      loadDemoData().then(function(){
+        initCharts();
+        initTrend();
+        buildDemoTable();
+        buildReligionTable();
+        fillDemoFilters();
+        fillReligionFilters();
+      });
     });
   </script>
 </body>
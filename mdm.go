@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Mid-day meal (PM POSHAN) ----
+//
+// The monthly meals-served file (-mdm, or "mdm" in a tenant or profile):
+// one row per school with "School ID" or "School Name & ID", "Meals Served"
+// for the month and "Working Days" (-mdm-days when the column is missing).
+// Coverage is meals per working day against the school's enrolment; a school
+// serving more meals a day than it has children enrolled is an anomaly.
+//
+//	GET /api/mdm[?zone=][&anomalies=1][&format=csv]
+
+var (
+	mdmCSV  = flag.String("mdm", "", "Mid-day meal CSV with meals served per school for the month (optional)")
+	mdmDays = flag.Int("mdm-days", 22, "Working days assumed when the mid-day meal CSV has no Working Days column")
+)
+
+type mdmRow struct {
+	Month string
+	Meals int
+	Days  int
+}
+
+// readMDM returns the meals-served rows by school id.
+func readMDM(path string) (map[string]mdmRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	rows := map[string]mdmRow{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sid := ingest.DigitsOnly(ingest.Get(rec, m, "School ID", "School Code"))
+		if sid == "" {
+			sid = ingest.DigitsOnlyKey(ingest.Get(rec, m, "School Name & ID", "School Name"))
+		}
+		meals := ingest.Get(rec, m, "Meals Served", "Total Meals Served", "Meals")
+		if sid == "" || meals == "" {
+			continue
+		}
+		days := ingest.AtoiSafe(ingest.Get(rec, m, "Working Days", "Meal Days", "Days"))
+		if days <= 0 {
+			days = *mdmDays
+		}
+		rows[sid] = mdmRow{Month: ingest.Get(rec, m, "Month"), Meals: ingest.AtoiSafe(meals), Days: days}
+	}
+}
+
+// applyMDM sets the mid-day meal fields of every school; rows may be nil.
+func applyMDM(sch map[string]School, rows map[string]mdmRow) (matched int) {
+	for id, s := range sch {
+		if r, ok := rows[id]; ok && r.Days > 0 {
+			s.HasMDM, s.MDMMonth, s.MDMMeals, s.MDMDays = true, r.Month, r.Meals, r.Days
+			s.MDMDaily = int(math.Round(float64(r.Meals) / float64(r.Days)))
+			s.MDMCoverage = pct1(s.MDMDaily, s.TotalEnrolment)
+			s.MDMAnomaly = s.MDMDaily > s.TotalEnrolment
+			sch[id] = s
+			matched++
+		}
+	}
+	return matched
+}
+
+// loadMDM reads the mid-day meal CSV (if any) and fills in the school fields.
+func loadMDM(sch map[string]School, path string) {
+	var rows map[string]mdmRow
+	if path != "" {
+		var err error
+		if rows, err = readMDM(path); err != nil {
+			log.Printf("mdm %s: %v", path, err)
+		}
+	}
+	if n := applyMDM(sch, rows); path != "" {
+		log.Printf("🍲 Mid-day meal data for %d of %d schools (%d rows in %s)", n, len(sch), len(rows), path)
+	}
+}
+
+// GET /api/mdm
+func handleAPIMDM(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	anomalies := q.Get("anomalies") == "1"
+	list := []School{}
+	for _, s := range dataFor(r).SCH {
+		if s.HasMDM && (zone == "" || s.Zone == zone) && (!anomalies || s.MDMAnomaly) {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MDMCoverage != list[j].MDMCoverage {
+			return list[i].MDMCoverage > list[j].MDMCoverage
+		}
+		return list[i].ID < list[j].ID
+	})
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, s := range list {
+			rows = append(rows, []string{s.ID, s.Name, s.Zone, s.MDMMonth, strconv.Itoa(s.TotalEnrolment), strconv.Itoa(s.MDMMeals),
+				strconv.Itoa(s.MDMDays), strconv.Itoa(s.MDMDaily), strconv.FormatFloat(s.MDMCoverage, 'f', 1, 64), yesNo(s.MDMAnomaly)})
+		}
+		writeCSV(w, r, "mdm.csv", []string{"School ID", "School", "Zone", "Month", "Enrolment", "Meals Served", "Working Days",
+			"Meals per Day", "Coverage %", "Meals > Enrolment"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ---- Computed metrics ----
+//
+// Derived KPIs defined in a JSON file (-metrics, or "metrics" in a tenant)
+// instead of code:
+//
+//	[{"name": "account_coverage", "on": "school",
+//	  "expr": "with_account / (with_account + without_account) * 100"}]
+//
+// Expressions are + - * / and parentheses over numbers and the JSON names
+// of numeric School or Emp fields ("on": "school" or "emp"; default
+// school). They are evaluated at build time into each record's "metrics"
+// and added as columns to the schools and employees CSV exports. A metric
+// that divides by zero is left out for that record.
+//
+//	GET /api/metrics   (the definitions in use)
+
+var metricsFile = flag.String("metrics", "", "JSON file of computed metrics (name, on, expr)")
+
+var rxMetricName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+type MetricDef struct {
+	Name string `json:"name"`
+	On   string `json:"on,omitempty"` // "school" (default) or "emp"
+	Expr string `json:"expr"`
+	Doc  string `json:"doc,omitempty"`
+
+	eval metricExpr
+}
+
+// metricExpr returns the value for one record; ok is false when the
+// result is not a finite number.
+type metricExpr func(rec reflect.Value) (v float64, ok bool)
+
+// loadMetrics reads and compiles the definitions; a bad definition is
+// logged and dropped so one typo doesn't stop the build.
+func loadMetrics(path string) []MetricDef {
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("metrics %s: %v", path, err)
+		return nil
+	}
+	var defs []MetricDef
+	if err := json.Unmarshal(b, &defs); err != nil {
+		log.Printf("metrics %s: %v", path, err)
+		return nil
+	}
+	out := []MetricDef{}
+	seen := map[string]bool{}
+	for _, d := range defs {
+		if d.On == "" {
+			d.On = "school"
+		}
+		if err := d.compile(); err != nil {
+			log.Printf("metrics %s: %s: %v", path, d.Name, err)
+			continue
+		}
+		if seen[d.On+"."+d.Name] {
+			log.Printf("metrics %s: %s defined twice, keeping the first", path, d.Name)
+			continue
+		}
+		seen[d.On+"."+d.Name] = true
+		out = append(out, d)
+	}
+	log.Printf("🧮 %d computed metric(s) from %s", len(out), path)
+	return out
+}
+
+func (d *MetricDef) compile() error {
+	if !rxMetricName.MatchString(d.Name) {
+		return fmt.Errorf("name must be lower_snake_case")
+	}
+	var fields map[string]int
+	switch d.On {
+	case "school":
+		fields = numericFields(reflect.TypeOf(School{}))
+	case "emp":
+		fields = numericFields(reflect.TypeOf(Emp{}))
+	default:
+		return fmt.Errorf(`on must be "school" or "emp"`)
+	}
+	p := &exprParser{src: d.Expr, fields: fields}
+	e, err := p.parse()
+	if err != nil {
+		return err
+	}
+	d.eval = e
+	return nil
+}
+
+// numericFields maps the JSON names of t's int, float and bool fields to
+// their index.
+func numericFields(t reflect.Type) map[string]int {
+	out := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Float64, reflect.Bool:
+			out[name] = i
+		}
+	}
+	return out
+}
+
+// fieldFloat is an int, float or bool field (true is 1) as a float.
+func fieldFloat(f reflect.Value) float64 {
+	switch f.Kind() {
+	case reflect.Int:
+		return float64(f.Int())
+	case reflect.Bool:
+		if f.Bool() {
+			return 1
+		}
+		return 0
+	}
+	return f.Float()
+}
+
+// applyMetrics evaluates defs over every school and employee in ds.
+func applyMetrics(ds *Dataset, defs []MetricDef) {
+	eval := func(on string, rec reflect.Value) map[string]float64 {
+		var m map[string]float64
+		for _, d := range defs {
+			if d.On != on {
+				continue
+			}
+			if v, ok := d.eval(rec); ok {
+				if m == nil {
+					m = map[string]float64{}
+				}
+				m[d.Name] = math.Round(v*10000) / 10000
+			}
+		}
+		return m
+	}
+	for id, s := range ds.SCH {
+		s.Metrics = eval("school", reflect.ValueOf(s))
+		ds.SCH[id] = s
+	}
+	for id, e := range ds.EMP {
+		e.Metrics = eval("emp", reflect.ValueOf(e))
+		ds.EMP[id] = e
+	}
+}
+
+// metricNames lists the names of the metrics defined on "school" or "emp",
+// in definition order.
+func metricNames(defs []MetricDef, on string) []string {
+	var out []string
+	for _, d := range defs {
+		if d.On == on {
+			out = append(out, d.Name)
+		}
+	}
+	return out
+}
+
+// metricCells formats m's values in the order of names for a CSV row.
+func metricCells(m map[string]float64, names []string) []string {
+	out := make([]string, len(names))
+	for i, n := range names {
+		if v, ok := m[n]; ok {
+			out[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return out
+}
+
+// GET /api/metrics
+func handleAPIMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	defs := dataFor(r).METRICS
+	if defs == nil {
+		defs = []MetricDef{}
+	}
+	writeData(w, defs, &Meta{Count: len(defs)})
+}
+
+// exprParser is a recursive-descent parser for
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = number | field | "(" expr ")" | "-" factor
+type exprParser struct {
+	src    string
+	pos    int
+	fields map[string]int
+}
+
+func (p *exprParser) parse() (metricExpr, error) {
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skip(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.src[p.pos:], p.pos)
+	}
+	return e, nil
+}
+
+func (p *exprParser) skip() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	if p.skip(); p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) expr() (metricExpr, error) {
+	l, err := p.term()
+	for err == nil {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return l, nil
+		}
+		p.pos++
+		var r metricExpr
+		if r, err = p.term(); err == nil {
+			l = binary(op, l, r)
+		}
+	}
+	return nil, err
+}
+
+func (p *exprParser) term() (metricExpr, error) {
+	l, err := p.factor()
+	for err == nil {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return l, nil
+		}
+		p.pos++
+		var r metricExpr
+		if r, err = p.factor(); err == nil {
+			l = binary(op, l, r)
+		}
+	}
+	return nil, err
+}
+
+func (p *exprParser) factor() (metricExpr, error) {
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		p.pos++
+		return e, nil
+	case c == '-':
+		p.pos++
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(rec reflect.Value) (float64, bool) { v, ok := e(rec); return -v, ok }, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		n, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", p.src[start:p.pos])
+		}
+		return func(reflect.Value) (float64, bool) { return n, true }, nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		i, ok := p.fields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		return func(rec reflect.Value) (float64, bool) { return fieldFloat(rec.Field(i)), true }, nil
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+	}
+}
+
+func binary(op byte, l, r metricExpr) metricExpr {
+	return func(rec reflect.Value) (float64, bool) {
+		a, ok := l(rec)
+		if !ok {
+			return 0, false
+		}
+		b, ok := r(rec)
+		if !ok {
+			return 0, false
+		}
+		var v float64
+		switch op {
+		case '+':
+			v = a + b
+		case '-':
+			v = a - b
+		case '*':
+			v = a * b
+		case '/':
+			if b == 0 {
+				return 0, false
+			}
+			v = a / b
+		}
+		return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Mobile numbers ----
+//
+// Mobile No. is read as ten digits (ingest.CheckMobile drops a +91, 0091
+// or leading 0, spaces, dashes and the spreadsheet ".0"), so SMS and
+// WhatsApp can address employees as +91XXXXXXXXXX. A number that doesn't
+// read as a mobile is kept as written, for correction. The report lists
+// those, and the numbers given for more than one employee (a school
+// office's phone, a copy-paste slip):
+//
+//	GET /api/invalid-mobiles[?problem=invalid|duplicate][&zone=][&format=csv][&page=][&per_page=]
+//
+// problem=invalid includes blank numbers. A DDE sees their own zone only.
+
+const mobileDuplicate = "duplicate"
+
+type MobileIssue struct {
+	EmpID       string   `json:"emp_id"`
+	Name        string   `json:"name"`
+	Designation string   `json:"designation"`
+	Zone        string   `json:"zone"`
+	SchoolID    string   `json:"school_id"`
+	SchoolName  string   `json:"school_name"`
+	Mobile      string   `json:"mobile"`
+	E164        string   `json:"e164,omitempty"`
+	Problem     string   `json:"problem"`
+	SharedWith  []string `json:"shared_with,omitempty"` // the other employees with the number
+}
+
+// mobileIssues checks every employee's number.
+func mobileIssues(emp map[string]Emp) []MobileIssue {
+	byNumber := map[string][]string{}
+	var out []MobileIssue
+	for _, id := range sortedKeys(emp) {
+		e := emp[id]
+		d, problem := ingest.CheckMobile(e.Mobile)
+		if problem != "" {
+			out = append(out, mobileIssue(e, problem))
+			continue
+		}
+		byNumber[d] = append(byNumber[d], id)
+	}
+	for _, d := range sortedKeys(byNumber) {
+		ids := byNumber[d]
+		if len(ids) < 2 {
+			continue
+		}
+		for _, id := range ids {
+			is := mobileIssue(emp[id], mobileDuplicate)
+			is.E164 = ingest.MobileE164(d)
+			for _, other := range ids {
+				if other != id {
+					is.SharedWith = append(is.SharedWith, other)
+				}
+			}
+			out = append(out, is)
+		}
+	}
+	return out
+}
+
+func mobileIssue(e Emp, problem string) MobileIssue {
+	return MobileIssue{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Zone: e.Zone,
+		SchoolID: e.SchoolID, SchoolName: e.SchoolName, Mobile: e.Mobile, Problem: problem}
+}
+
+// GET /api/invalid-mobiles
+func handleInvalidMobiles(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	kind := q.Get("problem")
+	if kind != "" && kind != "invalid" && kind != mobileDuplicate {
+		writeError(w, 400, errBadRequest, "problem must be invalid or duplicate")
+		return
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	list := []MobileIssue{}
+	for _, is := range mobileIssues(dataFor(r).EMP) {
+		if zone != "" && is.Zone != zone {
+			continue
+		}
+		if dup := is.Problem == mobileDuplicate; (kind == "invalid" && dup) || (kind == mobileDuplicate && !dup) {
+			continue
+		}
+		list = append(list, is)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Zone != list[j].Zone {
+			return list[i].Zone < list[j].Zone
+		}
+		return list[i].SchoolID < list[j].SchoolID
+	})
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, is := range list {
+			rows = append(rows, []string{is.EmpID, is.Name, is.Designation, is.Zone, is.SchoolID, is.SchoolName,
+				is.Mobile, is.Problem, strings.Join(is.SharedWith, " ")})
+		}
+		writeCSV(w, r, "invalid_mobiles.csv", []string{"Employee ID", "Name", "Designation", "Zone", "School ID", "School",
+			"Mobile No.", "Problem", "Shared With"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
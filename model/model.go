@@ -0,0 +1,137 @@
+// Package model holds the records the dashboard is built from: employees
+// (Basic.csv joined with Services.csv), schools (the DBT summary) and the
+// demographic breakdowns derived from them.
+package model
+
+// Employee is one row of Basic.csv joined with the employee's Services.csv
+// record. Dates are kept as they appear in the files (DD/MM/YYYY or
+// DD/Mon/YYYY).
+type Employee struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Designation       string `json:"designation"`
+	DOB               string `json:"dob"`
+	Gender            string `json:"gender"`
+	Zone              string `json:"zone"`
+	SchoolID          string `json:"school_id"`
+	SchoolName        string `json:"school_name"`
+	Status            string `json:"status"`
+	SelectionCategory string `json:"selection_category"`
+	MaritalStatus     string `json:"marital_status"`
+	Age               int    `json:"age"`
+	Mobile            string `json:"mobile"`
+	Email             string `json:"email"`
+	DOJ               string `json:"doj"`
+	FatherName        string `json:"father_name"`
+	MotherName        string `json:"mother_name"`
+	SpouseName        string `json:"spouse_name"`
+	Correspondence    string `json:"correspondence"`
+	Permanent         string `json:"permanent"`
+	HomeTown          string `json:"home_town"`
+	Religion          string `json:"religion"`
+	AppointmentDate   string `json:"appointment_date"`
+	PromotionDate     string `json:"promotion_date"`
+	TransferDate      string `json:"transfer_date"`
+	PresentSchoolDate string `json:"present_school_date"`
+	PreviousSchool    string `json:"previous_school"`
+
+	Metrics map[string]float64 `json:"metrics,omitempty"` // computed metrics
+}
+
+// School is one row of the DBT summary. The classroom, mid-day meal,
+// metric, charge and location fields are filled in by the dashboard
+// from optional inputs.
+type School struct {
+	ID                  string  `json:"id"`
+	Name                string  `json:"name"`
+	Zone                string  `json:"zone"`
+	SIName              string  `json:"si_name"`
+	TotalEnrolment      int     `json:"total_enrolment"`
+	MaxEnrolment        int     `json:"max_enrolment"`
+	MaxEnrolmentDate    string  `json:"max_enrolment_date"`
+	MaxPresent          int     `json:"max_present"`
+	MaxPresentDate      string  `json:"max_present_date"`
+	WithAccount         int     `json:"with_account"`
+	WithoutAccount      int     `json:"without_account"`
+	WithAadhaar         int     `json:"with_aadhaar"`
+	WithoutAadhaar      int     `json:"without_aadhaar"`
+	AadhaarLinkedAcc    int     `json:"aadhaar_linked_acc"`
+	NewAdmissionMonth   int     `json:"new_admission_month"`
+	NewAdmissionSession int     `json:"new_admission_session"`
+	DBTStudent          int     `json:"dbt_student"`
+	DBTParent           int     `json:"dbt_parent"`
+	DBTTotal            int     `json:"dbt_total"`
+	HasInfra            bool    `json:"has_infra"`
+	NeededClassrooms    int     `json:"needed_classrooms"`
+	Classrooms          int     `json:"classrooms,omitempty"`
+	ClassroomShortage   int     `json:"classroom_shortage,omitempty"`
+	HasMDM              bool    `json:"has_mdm"`
+	MDMMonth            string  `json:"mdm_month,omitempty"`
+	MDMMeals            int     `json:"mdm_meals,omitempty"`
+	MDMDays             int     `json:"mdm_days,omitempty"`
+	MDMDaily            int     `json:"mdm_meals_per_day,omitempty"`
+	MDMCoverage         float64 `json:"mdm_coverage_pct,omitempty"`
+	MDMAnomaly          bool    `json:"mdm_anomaly,omitempty"`
+	HasResults          bool    `json:"has_results"`
+	ResultsExam         string  `json:"results_exam,omitempty"`
+	Appeared            int     `json:"appeared,omitempty"`
+	Passed              int     `json:"passed,omitempty"`
+	PassPct             float64 `json:"pass_pct,omitempty"`
+	DistinctionPct      float64 `json:"distinction_pct,omitempty"`
+	AvgScore            float64 `json:"avg_score_pct,omitempty"`
+	HoSChargeID         string  `json:"hos_charge_id,omitempty"` // the employee looking after the HoS post by order
+	HoSChargeName       string  `json:"hos_charge_name,omitempty"`
+	Lat                 float64 `json:"lat,omitempty"` // from the school locations file
+	Lng                 float64 `json:"lng,omitempty"`
+
+	ClassResults  []ClassResult           `json:"class_results,omitempty"`
+	DBTComponents map[string]DBTComponent `json:"dbt_components,omitempty"` // per DBT scheme, see ingest.DBTSchemes
+	Metrics       map[string]float64      `json:"metrics,omitempty"`        // computed metrics
+}
+
+// ClassResult is one class's exam result summary at a school.
+type ClassResult struct {
+	Class          string  `json:"class"`
+	Appeared       int     `json:"appeared"`
+	Passed         int     `json:"passed"`
+	Distinction    int     `json:"distinction,omitempty"`
+	PassPct        float64 `json:"pass_pct"`
+	DistinctionPct float64 `json:"distinction_pct,omitempty"`
+	AvgScore       float64 `json:"avg_score_pct,omitempty"`
+}
+
+// DBTComponent counts one DBT scheme's beneficiaries at a school or zone.
+type DBTComponent struct {
+	Student int     `json:"student"`
+	Parent  int     `json:"parent"`
+	Total   int     `json:"total"`
+	Pct     float64 `json:"pct"`
+}
+
+// Stat is a male/female head count.
+type Stat struct {
+	Male   int `json:"male"`
+	Female int `json:"female"`
+}
+
+// DemoStats breaks the staff of one zone and designation down by
+// selection category and religion.
+type DemoStats struct {
+	TotalMale     int              `json:"total_male"`
+	TotalFemale   int              `json:"total_female"`
+	Total         int              `json:"total"`
+	CatStats      map[string]*Stat `json:"cat_stats,omitempty"`
+	ReligionStats map[string]*Stat `json:"religion_stats,omitempty"`
+}
+
+// DesignationDemo and ZoneDemo arrange DemoStats per zone for the
+// dashboard tables.
+type DesignationDemo struct {
+	Designation string    `json:"designation"`
+	Stats       DemoStats `json:"stats"`
+}
+
+type ZoneDemo struct {
+	Zone         string            `json:"zone"`
+	Designations []DesignationDemo `json:"designations"`
+}
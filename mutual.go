@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Mutual transfer matching ----
+//
+// Employees ask to be moved to one or more zones (in order of preference).
+// Two requests make a mutual pair when each employee's zone is one the other
+// asked for and both hold the same designation and selection category.
+// Employees with a pending transfer order are left out. Every compatible
+// pair is listed, best first; a greedy pass marks one non-overlapping set as
+// suggested for the transfer committee.
+//
+//	POST   /api/transfers/requests   {"emp_id": "95064800", "zones": ["SOUTH", "WEST"], "reason": "..."}
+//	                                 (or CSV: Employee ID, Desired Zones separated by ";", Reason)
+//	DELETE /api/transfers/requests?emp=95064800
+//	GET    /api/transfers/requests[?zone=]
+//	GET    /api/transfers/mutual[?suggested=1][&format=csv|xlsx]
+
+var transferRequestsFile = flag.String("transfer-requests", "./out/transfer_requests.json", "Employee transfer requests used for mutual transfer matching")
+
+type TransferRequest struct {
+	EmpID  string    `json:"emp_id"`
+	Zones  []string  `json:"zones"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Filed  time.Time `json:"filed"`
+}
+
+type MutualPair struct {
+	EmpA        MutualSide `json:"a"`
+	EmpB        MutualSide `json:"b"`
+	Designation string     `json:"designation"`
+	Category    string     `json:"category"`
+	Score       int        `json:"score"` // sum of preference ranks, 2 = both first choice
+	Suggested   bool       `json:"suggested"`
+}
+
+type MutualSide struct {
+	EmpID      string `json:"emp_id"`
+	Name       string `json:"name"`
+	Zone       string `json:"zone"`
+	School     string `json:"school"`
+	Preference int    `json:"preference"` // rank of the other's zone in this request
+	Filed      string `json:"filed"`
+}
+
+type requestBook struct {
+	mu   sync.Mutex
+	path string
+	reqs map[string]TransferRequest // by emp id
+}
+
+var (
+	requestBooksMu sync.Mutex
+	requestBooks   = map[string]*requestBook{} // by tenant id
+)
+
+// transferRequests returns the tenant's requests, loading them on first use.
+func (t *Tenant) transferRequests() *requestBook {
+	requestBooksMu.Lock()
+	defer requestBooksMu.Unlock()
+	if b, ok := requestBooks[t.ID]; ok {
+		return b
+	}
+	b := &requestBook{path: t.TransferReqs, reqs: map[string]TransferRequest{}}
+	if data, err := os.ReadFile(t.TransferReqs); err == nil {
+		if err := json.Unmarshal(data, &b.reqs); err != nil {
+			log.Printf("transfer requests %s: %v", t.TransferReqs, err)
+		}
+	}
+	requestBooks[t.ID] = b
+	return b
+}
+
+func (b *requestBook) save() error {
+	if b.path == "" {
+		return fmt.Errorf("no transfer requests file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(b.reqs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(b.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(b.path+".tmp", b.path)
+}
+
+func (b *requestBook) List() []TransferRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]TransferRequest, 0, len(b.reqs))
+	for _, r := range b.reqs {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Filed.Equal(out[j].Filed) {
+			return out[i].Filed.Before(out[j].Filed)
+		}
+		return out[i].EmpID < out[j].EmpID
+	})
+	return out
+}
+
+// Put files or replaces requests; each is checked against ds first and the
+// first problem is returned with nothing saved.
+func (b *requestBook) Put(ds *Dataset, reqs []TransferRequest) error {
+	zones := map[string]bool{}
+	for z := range ds.ZONE_KPI {
+		zones[z] = true
+	}
+	for i := range reqs {
+		r := &reqs[i]
+		r.EmpID = ingest.NormalizeEmpID(r.EmpID)
+		e, ok := ds.EMP[r.EmpID]
+		if !ok {
+			return fmt.Errorf("employee %q not found", r.EmpID)
+		}
+		var want []string
+		seen := map[string]bool{}
+		for _, z := range r.Zones {
+			z = strings.ToUpper(strings.TrimSpace(z))
+			switch {
+			case z == "" || seen[z]:
+				continue
+			case !zones[z] || z == allZones:
+				return fmt.Errorf("employee %s: unknown zone %q", r.EmpID, z)
+			case z == e.Zone:
+				return fmt.Errorf("employee %s is already in zone %s", r.EmpID, z)
+			}
+			seen[z] = true
+			want = append(want, z)
+		}
+		if len(want) == 0 {
+			return fmt.Errorf("employee %s: at least one desired zone is required", r.EmpID)
+		}
+		r.Zones = want
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range reqs {
+		if old, ok := b.reqs[r.EmpID]; ok {
+			r.Filed = old.Filed // keep the place in the queue
+		}
+		b.reqs[r.EmpID] = r
+	}
+	return b.save()
+}
+
+func (b *requestBook) Delete(id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.reqs[id]; !ok {
+		return false, nil
+	}
+	delete(b.reqs, id)
+	return true, b.save()
+}
+
+// parseRequestCSV reads (Employee ID, Desired Zones, Reason) rows; a first
+// row whose ID has no digits is taken as a header.
+func parseRequestCSV(r io.Reader) ([]TransferRequest, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var out []TransferRequest
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for len(rec) < 3 {
+			rec = append(rec, "")
+		}
+		if line == 1 && ingest.NormalizeEmpID(rec[0]) == "" {
+			continue
+		}
+		out = append(out, TransferRequest{EmpID: rec[0], Zones: strings.Split(rec[1], ";"), Reason: ingest.Norm(rec[2])})
+	}
+}
+
+// mutualPairs lists every compatible swap, best score first, and marks a
+// greedy non-overlapping selection as suggested.
+func mutualPairs(t *Tenant, ds *Dataset) []MutualPair {
+	pending := map[string]bool{}
+	if t.Transfers != "" {
+		for _, o := range t.transfers().List(ds) {
+			if o.Status == transferPending {
+				pending[o.EmpID] = true
+			}
+		}
+	}
+	type cand struct {
+		e    Emp
+		r    TransferRequest
+		rank map[string]int
+	}
+	groups := map[string][]cand{} // designation|category
+	for _, r := range t.transferRequests().List() {
+		e, ok := ds.EMP[r.EmpID]
+		if !ok || pending[r.EmpID] {
+			continue
+		}
+		c := cand{e: e, r: r, rank: map[string]int{}}
+		for i, z := range r.Zones {
+			c.rank[z] = i + 1
+		}
+		k := strings.ToUpper(e.Designation) + "|" + e.SelectionCategory
+		groups[k] = append(groups[k], c)
+	}
+	side := func(c cand, other string) MutualSide {
+		return MutualSide{EmpID: c.e.ID, Name: c.e.Name, Zone: c.e.Zone, School: c.e.SchoolName,
+			Preference: c.rank[other], Filed: c.r.Filed.Format("2006-01-02")}
+	}
+	out := []MutualPair{}
+	for _, cs := range groups {
+		for i := 0; i < len(cs); i++ {
+			for j := i + 1; j < len(cs); j++ {
+				a, b := cs[i], cs[j]
+				ra, rb := a.rank[b.e.Zone], b.rank[a.e.Zone]
+				if ra == 0 || rb == 0 {
+					continue
+				}
+				out = append(out, MutualPair{
+					EmpA: side(a, b.e.Zone), EmpB: side(b, a.e.Zone),
+					Designation: a.e.Designation, Category: a.e.SelectionCategory, Score: ra + rb,
+				})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score < out[j].Score
+		}
+		fi, fj := min(out[i].EmpA.Filed, out[i].EmpB.Filed), min(out[j].EmpA.Filed, out[j].EmpB.Filed)
+		if fi != fj {
+			return fi < fj
+		}
+		return out[i].EmpA.EmpID+out[i].EmpB.EmpID < out[j].EmpA.EmpID+out[j].EmpB.EmpID
+	})
+	taken := map[string]bool{}
+	for i := range out {
+		p := &out[i]
+		if !taken[p.EmpA.EmpID] && !taken[p.EmpB.EmpID] {
+			p.Suggested = true
+			taken[p.EmpA.EmpID], taken[p.EmpB.EmpID] = true, true
+		}
+	}
+	return out
+}
+
+// GET/POST/DELETE /api/transfers/requests
+func handleTransferRequests(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	b := t.transferRequests()
+	switch r.Method {
+	case http.MethodGet:
+		zone := strings.ToUpper(r.URL.Query().Get("zone"))
+		out := []TransferRequest{}
+		for _, req := range b.List() {
+			if zone == "" || ds.EMP[req.EmpID].Zone == zone {
+				out = append(out, req)
+			}
+		}
+		page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+		items, meta := paginate(out, page, per)
+		writeData(w, items, meta)
+	case http.MethodPost:
+		body := http.MaxBytesReader(w, r.Body, 10<<20)
+		var reqs []TransferRequest
+		var err error
+		switch ct := r.Header.Get("Content-Type"); {
+		case strings.HasPrefix(ct, "multipart/"):
+			f, _, ferr := r.FormFile("file")
+			if ferr != nil {
+				writeError(w, 400, errBadRequest, "multipart upload needs a \"file\" part: "+ferr.Error())
+				return
+			}
+			defer f.Close()
+			reqs, err = parseRequestCSV(f)
+		case strings.HasPrefix(ct, "text/csv"):
+			reqs, err = parseRequestCSV(body)
+		default:
+			var raw json.RawMessage
+			if err = json.NewDecoder(body).Decode(&raw); err == nil {
+				if len(raw) > 0 && raw[0] == '[' {
+					err = json.Unmarshal(raw, &reqs)
+				} else {
+					reqs = make([]TransferRequest, 1)
+					err = json.Unmarshal(raw, &reqs[0])
+				}
+			}
+		}
+		if err == nil && len(reqs) == 0 {
+			err = fmt.Errorf("no requests")
+		}
+		if err != nil {
+			writeError(w, 400, errBadRequest, "body must be a request, a list of requests or CSV: "+err.Error())
+			return
+		}
+		now, by := time.Now(), userFor(r).Name
+		for i := range reqs {
+			reqs[i].By, reqs[i].Filed = by, now
+		}
+		if err := b.Put(ds, reqs); err != nil {
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		log.Printf("🔁 %d transfer requests filed by %s", len(reqs), by)
+		writeData(w, reqs, &Meta{Count: len(reqs)})
+	case http.MethodDelete:
+		id := ingest.NormalizeEmpID(r.URL.Query().Get("emp"))
+		ok, err := b.Delete(id)
+		switch {
+		case err != nil:
+			writeError(w, 500, errInternal, err.Error())
+		case !ok:
+			writeError(w, 404, errNotFound, "no request for employee "+id)
+		default:
+			log.Printf("🔁 Transfer request of %s withdrawn by %s", id, userFor(r).Name)
+			writeData(w, map[string]string{"withdrawn": id}, nil)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// GET /api/transfers/mutual
+func handleMutualTransfers(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	q := r.URL.Query()
+	pairs := mutualPairs(tenantFor(r), dataFor(r))
+	if q.Get("suggested") == "1" {
+		kept := pairs[:0]
+		for _, p := range pairs {
+			if p.Suggested {
+				kept = append(kept, p)
+			}
+		}
+		pairs = kept
+	}
+	header := []string{"Suggested", "Designation", "Category", "Score",
+		"Employee A", "Name A", "Zone A", "School A", "Preference A", "Filed A",
+		"Employee B", "Name B", "Zone B", "School B", "Preference B", "Filed B"}
+	row := func(p MutualPair) []any {
+		return []any{yesNo(p.Suggested), p.Designation, p.Category, p.Score,
+			p.EmpA.EmpID, p.EmpA.Name, p.EmpA.Zone, p.EmpA.School, p.EmpA.Preference, p.EmpA.Filed,
+			p.EmpB.EmpID, p.EmpB.Name, p.EmpB.Zone, p.EmpB.School, p.EmpB.Preference, p.EmpB.Filed}
+	}
+	switch q.Get("format") {
+	case "csv":
+		rows := make([][]string, 0, len(pairs))
+		for _, p := range pairs {
+			cells := row(p)
+			rec := make([]string, len(cells))
+			for i, c := range cells {
+				rec[i] = fmt.Sprint(c)
+			}
+			rows = append(rows, rec)
+		}
+		writeCSV(w, r, "mutual_transfers.csv", header, rows)
+		return
+	case "xlsx":
+		b := &xlsxBook{}
+		s := b.Sheet("Mutual Transfers", header...)
+		for _, p := range pairs {
+			s.Row(row(p)...)
+		}
+		writeXLSX(w, r, "mutual_transfers.xlsx", b)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(pairs, page, per)
+	writeData(w, items, meta)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Nearby schools ----
+//
+// Where a school's pupils could go: when it is full (admission overflow)
+// or if it had to close. Schools within the radius are ranked by distance
+// (as the crow flies, from -school-locations) and each offers its spare
+// seats, classrooms × -class-size less enrolment (from -infra); schools
+// without room data, or without spare seats, are left out. The seats
+// needed are ?need=, else with ?closure=1 the whole enrolment, else the
+// school's own overflow; they are placed nearest first until covered:
+//
+//	GET /api/schools/nearby?id=[&radius_km=5][&need=N|&closure=1][&limit=10][&format=csv]
+//
+// A DDE asks about their own zone's schools, though the suggestions may be
+// across the zone boundary.
+
+const (
+	nearbyRadiusDef = 5.0 // km
+	nearbyLimitDef  = 10
+	earthRadiusKm   = 6371.0
+)
+
+// distanceKm is the great-circle distance between two schools.
+func distanceKm(a, b School) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLng := rad(b.Lat-a.Lat), rad(b.Lng-a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// spareSeats is what s could take in: its classrooms' seats less its
+// enrolment, negative when it is over; ok is false without room data.
+func spareSeats(s School) (int, bool) {
+	if !s.HasInfra || *classSize <= 0 {
+		return 0, false
+	}
+	return s.Classrooms**classSize - s.TotalEnrolment, true
+}
+
+// NearbySchool is one suggestion.
+type NearbySchool struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Zone       string  `json:"zone"`
+	DistanceKm float64 `json:"distance_km"`
+	Enrolment  int     `json:"enrolment"`
+	Classrooms int     `json:"classrooms"`
+	Spare      int     `json:"spare_seats"`
+	Take       int     `json:"take"` // of the seats needed, nearest first
+}
+
+type NearbyPlan struct {
+	SchoolID  string         `json:"school_id"`
+	Name      string         `json:"name"`
+	Zone      string         `json:"zone"`
+	Enrolment int            `json:"enrolment"`
+	Spare     *int           `json:"spare_seats"` // nil without room data
+	Need      int            `json:"need"`
+	Placed    int            `json:"placed"`
+	Short     int            `json:"short"` // need left unplaced within the radius
+	RadiusKm  float64        `json:"radius_km"`
+	Schools   []NearbySchool `json:"schools"`
+}
+
+// nearbyPlan ranks the schools near from with spare seats and places need
+// seats among them, nearest first.
+func nearbyPlan(ds *Dataset, from School, radius float64, need, limit int) NearbyPlan {
+	p := NearbyPlan{SchoolID: from.ID, Name: from.Name, Zone: from.Zone, Enrolment: from.TotalEnrolment, Need: need, RadiusKm: radius, Schools: []NearbySchool{}}
+	if n, ok := spareSeats(from); ok {
+		p.Spare = &n
+	}
+	for id, s := range ds.SCH {
+		if id == from.ID || (s.Lat == 0 && s.Lng == 0) {
+			continue
+		}
+		spare, ok := spareSeats(s)
+		d := distanceKm(from, s)
+		if !ok || spare <= 0 || d > radius {
+			continue
+		}
+		p.Schools = append(p.Schools, NearbySchool{ID: id, Name: s.Name, Zone: s.Zone, DistanceKm: math.Round(d*100) / 100,
+			Enrolment: s.TotalEnrolment, Classrooms: s.Classrooms, Spare: spare})
+	}
+	sort.Slice(p.Schools, func(i, j int) bool {
+		if p.Schools[i].DistanceKm != p.Schools[j].DistanceKm {
+			return p.Schools[i].DistanceKm < p.Schools[j].DistanceKm
+		}
+		return p.Schools[i].ID < p.Schools[j].ID
+	})
+	left := need
+	for i := range p.Schools {
+		take := min(left, p.Schools[i].Spare)
+		p.Schools[i].Take = take
+		left -= take
+	}
+	p.Placed, p.Short = need-left, left
+	if limit > 0 && len(p.Schools) > limit {
+		// Keep every school given seats, however many.
+		keep := limit
+		for keep < len(p.Schools) && p.Schools[keep].Take > 0 {
+			keep++
+		}
+		p.Schools = p.Schools[:keep]
+	}
+	return p
+}
+
+// GET /api/schools/nearby
+func handleNearbySchools(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q, ds := r.URL.Query(), dataFor(r)
+	id := ingest.DigitsOnlyKey(q.Get("id"))
+	s, ok := ds.SCH[id]
+	if u := userFor(r); ok && u.Role == roleZoneHead && !strings.EqualFold(s.Zone, u.Zone) {
+		ok = false
+	}
+	if !ok {
+		writeError(w, 404, errNotFound, "no school "+q.Get("id"))
+		return
+	}
+	if s.Lat == 0 && s.Lng == 0 {
+		writeError(w, 404, errNotFound, "no coordinates for school "+id+" (see -school-locations)")
+		return
+	}
+	radius := nearbyRadiusDef
+	if v := q.Get("radius_km"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 50 {
+			writeError(w, 400, errBadRequest, "radius_km must be above 0 and at most 50")
+			return
+		}
+		radius = f
+	}
+	limit := nearbyLimitDef
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			writeError(w, 400, errBadRequest, "limit must be 1-200")
+			return
+		}
+		limit = n
+	}
+	need := 0
+	switch {
+	case q.Get("need") != "":
+		n, err := strconv.Atoi(q.Get("need"))
+		if err != nil || n < 0 {
+			writeError(w, 400, errBadRequest, "need must be a number of seats")
+			return
+		}
+		need = n
+	case q.Get("closure") == "1":
+		need = s.TotalEnrolment
+	default:
+		if n, ok := spareSeats(s); ok && n < 0 {
+			need = -n
+		}
+	}
+	p := nearbyPlan(ds, s, radius, need, limit)
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(p.Schools))
+		for _, n := range p.Schools {
+			rows = append(rows, []string{n.ID, n.Name, n.Zone, fmt.Sprintf("%.2f", n.DistanceKm), strconv.Itoa(n.Enrolment),
+				strconv.Itoa(n.Classrooms), strconv.Itoa(n.Spare), strconv.Itoa(n.Take)})
+		}
+		writeCSV(w, r, "nearby_"+id+".csv", []string{"School ID", "School", "Zone", "Distance (km)", "Enrolment", "Classrooms",
+			"Spare Seats", "Seats Taken"}, rows)
+		return
+	}
+	writeData(w, p, &Meta{Count: len(p.Schools)})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ---- Open Government Data export ----
+//
+// The public aggregates (opendata.go) are turned into the CSV + metadata
+// resources the OGD platform (data.gov.in) takes, one directory per quarter:
+//
+//	out/ogd/<tenant>/2026-Q4/zone_kpis.csv + zone_kpis.meta.json, ..., catalog.json
+//
+// With -ogd-url each resource is also POSTed there (multipart "file" and
+// "metadata", api-key header from -ogd-key). Runs every -ogd-every, on
+// "mcd-dashboard ogd-export [tenant-id]" or POST /api/ogd/export.
+
+var (
+	ogdDir   = flag.String("ogd-dir", "./out/ogd", "Directory for OGD CSV + metadata exports")
+	ogdEvery = flag.Duration("ogd-every", 0, "Export (and push) OGD resources this often, e.g. 2160h for quarterly (0 = off)")
+	ogdURL   = flag.String("ogd-url", "", "OGD contributor API endpoint to push resources to (empty = write files only)")
+	ogdKey   = flag.String("ogd-key", "", "API key for -ogd-url (better via MCD_OGD_KEY)")
+	ogdOrg   = flag.String("ogd-org", "Municipal Corporation of Delhi, Education Department", "Publishing organisation named in OGD metadata")
+)
+
+type OGDField struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "string", "integer" or "double"
+}
+
+type OGDMeta struct {
+	Title         string     `json:"title"`
+	Description   string     `json:"description"`
+	Sector        string     `json:"sector"`
+	Organisation  string     `json:"organisation"`
+	Jurisdiction  string     `json:"jurisdiction"`
+	Granularity   string     `json:"granularity"`
+	Frequency     string     `json:"frequency"`
+	ReferenceDate string     `json:"reference_date"`
+	Period        string     `json:"period"`
+	Keywords      []string   `json:"keywords"`
+	File          string     `json:"file"`
+	Fields        []OGDField `json:"fields"`
+}
+
+type ogdResource struct {
+	name string
+	meta OGDMeta
+	rows [][]string
+}
+
+type OGDExport struct {
+	Tenant    string    `json:"tenant"`
+	Period    string    `json:"period"`
+	Dir       string    `json:"dir"`
+	Resources []string  `json:"resources"`
+	Pushed    int       `json:"pushed"`
+	Errors    []string  `json:"errors,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func ogdPeriod(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
+
+func ogdResources(pa PublicAggregates, period string) []ogdResource {
+	itoa, ftoa := strconv.Itoa, func(f float64) string { return strconv.FormatFloat(f, 'f', 1, 64) }
+	meta := func(name, title, desc, gran string, fields ...OGDField) OGDMeta {
+		return OGDMeta{
+			Title: pa.Title + ": " + title, Description: desc + " " + pa.Description,
+			Sector: "Education", Organisation: *ogdOrg, Jurisdiction: pa.Title, Granularity: gran,
+			Frequency: "Quarterly", ReferenceDate: pa.DataAsOf.Format("2006-01-02"), Period: period,
+			Keywords: []string{"education", "schools", "teachers", "municipal"}, File: name + ".csv", Fields: fields,
+		}
+	}
+	str := func(n string) OGDField { return OGDField{n, "string"} }
+	num := func(n string) OGDField { return OGDField{n, "integer"} }
+	dbl := func(n string) OGDField { return OGDField{n, "double"} }
+
+	zones := append(append([]ZoneKPI{}, pa.Zones...), pa.Totals)
+	kpi := ogdResource{name: "zone_kpis", meta: meta("zone_kpis", "Zone-wise school and staffing indicators",
+		"Schools, staff, enrolment, pupil-teacher ratio and teacher vacancies per zone (zone ALL is the total).", "Zone",
+		str("zone"), num("schools"), num("employees"), num("teachers"), num("needed_teachers"), num("vacancies"),
+		num("surplus"), num("schools_without_principal"), num("enrolment"), dbl("ptr"))}
+	dbt := ogdResource{name: "dbt_coverage", meta: meta("dbt_coverage", "Zone-wise DBT coverage of students",
+		"Students with Aadhaar, bank accounts and Direct Benefit Transfer received, per zone.", "Zone",
+		str("zone"), num("enrolment"), num("with_aadhaar"), dbl("aadhaar_pct"), num("with_account"), dbl("account_pct"),
+		num("dbt_total"), dbl("dbt_pct"))}
+	for _, z := range zones {
+		kpi.rows = append(kpi.rows, []string{z.Zone, itoa(z.Schools), itoa(z.Employees), itoa(z.Teachers),
+			itoa(z.NeededTeachers), itoa(z.Vacancies), itoa(z.Surplus), itoa(z.WithoutPrincipal), itoa(z.Enrolment), ftoa(z.PTR)})
+		dbt.rows = append(dbt.rows, []string{z.Zone, itoa(z.Enrolment), itoa(z.WithAadhaar), ftoa(z.AadhaarPct),
+			itoa(z.WithAccount), ftoa(z.AccountPct), itoa(z.DBTTotal), ftoa(z.DBTPct)})
+	}
+	staff := ogdResource{name: "zone_staffing", meta: meta("zone_staffing", "Zone-wise staff by designation",
+		"Employees per zone and designation.", "Zone", str("zone"), str("designation"), num("employees"))}
+	for _, z := range pa.ZoneStaff {
+		for _, d := range z.Designations {
+			staff.rows = append(staff.rows, []string{z.Zone, d.Key, itoa(d.Count)})
+		}
+	}
+	counts := func(name, title, desc, key string, cs []PublicCount) ogdResource {
+		r := ogdResource{name: name, meta: meta(name, title, desc, "Department", str(key), num("employees"))}
+		for _, c := range cs {
+			r.rows = append(r.rows, []string{c.Key, itoa(c.Count)})
+		}
+		return r
+	}
+	return []ogdResource{kpi, dbt, staff,
+		counts("staff_by_designation", "Staff by designation", "Employees per designation.", "designation", pa.Staffing),
+		counts("staff_by_gender", "Staff by gender", "Employees per gender.", "gender", pa.Gender),
+		counts("staff_by_category", "Staff by selection category", "Employees per selection category.", "category", pa.Category),
+	}
+}
+
+func (r ogdResource) csv() []byte {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	header := make([]string, len(r.meta.Fields))
+	for i, f := range r.meta.Fields {
+		header[i] = f.Name
+	}
+	_ = cw.Write(header)
+	_ = cw.WriteAll(r.rows)
+	return buf.Bytes()
+}
+
+// exportOGD writes t's current aggregates as OGD resources and pushes them
+// when -ogd-url is set.
+func exportOGD(t *Tenant, ds *Dataset) (OGDExport, error) {
+	now := time.Now()
+	period := ogdPeriod(ds.BuiltAt)
+	dir := filepath.Join(*ogdDir, t.ID, period)
+	ex := OGDExport{Tenant: t.ID, Period: period, Dir: dir, Resources: []string{}, At: now}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ex, err
+	}
+	resources := ogdResources(publicAggregates(t, ds), period)
+	catalog := make([]OGDMeta, 0, len(resources))
+	for _, r := range resources {
+		data := r.csv()
+		meta, _ := json.MarshalIndent(r.meta, "", "  ")
+		if err := os.WriteFile(filepath.Join(dir, r.name+".csv"), data, 0644); err != nil {
+			return ex, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, r.name+".meta.json"), meta, 0644); err != nil {
+			return ex, err
+		}
+		ex.Resources = append(ex.Resources, r.name)
+		catalog = append(catalog, r.meta)
+		if *ogdURL != "" && !t.sandboxed() {
+			if err := pushOGD(r.meta.File, data, meta); err != nil {
+				ex.Errors = append(ex.Errors, r.name+": "+err.Error())
+			} else {
+				ex.Pushed++
+			}
+		}
+	}
+	b, _ := json.MarshalIndent(map[string]any{"period": period, "generated": now, "resources": catalog}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "catalog.json"), b, 0644); err != nil {
+		return ex, err
+	}
+	b, _ = json.MarshalIndent(ex, "", "  ")
+	_ = os.WriteFile(filepath.Join(*ogdDir, t.ID, "last_export.json"), b, 0644)
+	log.Printf("🏛️ OGD export %s/%s: %d resources, %d pushed, %d errors", t.ID, period, len(ex.Resources), ex.Pushed, len(ex.Errors))
+	return ex, nil
+}
+
+func pushOGD(file string, data, meta []byte) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("metadata", string(meta))
+	fw, err := mw.CreateFormFile("file", file)
+	if err != nil {
+		return err
+	}
+	_, _ = fw.Write(data)
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, *ogdURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if *ogdKey != "" {
+		req.Header.Set("api-key", *ogdKey)
+	}
+	client := &http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// startOGDSchedule exports every tenant each -ogd-every.
+func startOGDSchedule() {
+	if *ogdEvery <= 0 {
+		return
+	}
+	log.Printf("🏛️ OGD export every %s", *ogdEvery)
+	go func() {
+		for range time.Tick(*ogdEvery) {
+			if !isLeader() {
+				continue
+			}
+			for _, t := range TENANTS {
+				if _, err := exportOGD(t, t.Data()); err != nil {
+					log.Printf("ogd export %s: %v", t.ID, err)
+				}
+			}
+		}
+	}()
+}
+
+// POST /api/ogd/export
+func handleOGDExport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	ex, err := exportOGD(tenantFor(r), dataFor(r))
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	writeData(w, ex, nil)
+}
+
+// cmdOGDExport is the ogd-export subcommand: flag.Args() may name a tenant,
+// otherwise every tenant is exported.
+func cmdOGDExport([]string) error {
+	tenants, err := loadTenants()
+	if err != nil {
+		return err
+	}
+	only := flag.Arg(0)
+	done := 0
+	for _, t := range tenants {
+		if only != "" && t.ID != only {
+			continue
+		}
+		ex, err := exportOGD(t, buildAll(t.inputs()))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s: %d resources in %s, %d pushed\n", ex.Tenant, ex.Period, len(ex.Resources), ex.Dir, ex.Pushed)
+		for _, e := range ex.Errors {
+			fmt.Printf("  push failed: %s\n", e)
+		}
+		done++
+	}
+	if done == 0 {
+		return fmt.Errorf("no tenant %q", only)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Public aggregates ----
+//
+// Every build writes an aggregates-only JSON file for the open-data portal:
+// zone KPIs, DBT coverage and staffing counts, never an individual record.
+// Staffing and category cells under publicMinCell are left out (and
+// counted) so small groups cannot be singled out. The same document is
+// served at /widgets/aggregates.json.
+
+var publicSnapshot = flag.String("public-snapshot", "./out/public/aggregates.json", "Aggregates-only JSON written on every build for open-data portals (empty = off)")
+
+const publicMinCell = 5
+
+type PublicCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+type PublicZoneStaffing struct {
+	Zone         string        `json:"zone"`
+	Designations []PublicCount `json:"designations"`
+}
+
+type PublicAggregates struct {
+	Title       string               `json:"title"`
+	Profile     string               `json:"profile,omitempty"`
+	DataAsOf    time.Time            `json:"data_as_of"`
+	Totals      ZoneKPI              `json:"totals"`
+	Zones       []ZoneKPI            `json:"zones"`
+	Staffing    []PublicCount        `json:"staffing"`
+	ZoneStaff   []PublicZoneStaffing `json:"zone_staffing"`
+	Gender      []PublicCount        `json:"gender"`
+	Category    []PublicCount        `json:"category"`
+	MinCell     int                  `json:"min_cell"`
+	Suppressed  int                  `json:"suppressed_cells"`
+	Description string               `json:"description"`
+}
+
+// publicCounts sorts m by count and drops cells under publicMinCell.
+func publicCounts(m map[string]int, suppressed *int) []PublicCount {
+	out := []PublicCount{}
+	for k, n := range m {
+		if n < publicMinCell {
+			*suppressed++
+			continue
+		}
+		out = append(out, PublicCount{Key: k, Count: n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func publicAggregates(t *Tenant, ds *Dataset) PublicAggregates {
+	pa := PublicAggregates{
+		Title: t.PageTitle(), Profile: ds.Profile, DataAsOf: ds.BuiltAt,
+		Totals: ds.ZONE_KPI[allZones], Zones: []ZoneKPI{}, MinCell: publicMinCell,
+		Description: "Aggregate figures only; cells below min_cell are withheld.",
+	}
+	for z, k := range ds.ZONE_KPI {
+		if z != allZones {
+			pa.Zones = append(pa.Zones, k)
+		}
+	}
+	sort.Slice(pa.Zones, func(i, j int) bool { return pa.Zones[i].Zone < pa.Zones[j].Zone })
+
+	desig, gender := map[string]int{}, map[string]int{}
+	byZone := map[string]map[string]int{}
+	for _, e := range ds.EMP {
+		d := strings.TrimSpace(e.Designation)
+		if d == "" {
+			d = "UNKNOWN"
+		}
+		desig[d]++
+		if byZone[e.Zone] == nil {
+			byZone[e.Zone] = map[string]int{}
+		}
+		byZone[e.Zone][d]++
+		switch g := strings.ToUpper(e.Gender); {
+		case strings.HasPrefix(g, "F"):
+			gender["FEMALE"]++
+		case strings.HasPrefix(g, "M"):
+			gender["MALE"]++
+		default:
+			gender["OTHER/UNKNOWN"]++
+		}
+	}
+	pa.Staffing = publicCounts(desig, &pa.Suppressed)
+	pa.Gender = publicCounts(gender, &pa.Suppressed)
+	pa.Category = publicCounts(ds.CATEGORY_WISE, &pa.Suppressed)
+	zones := make([]string, 0, len(byZone))
+	for z := range byZone {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	for _, z := range zones {
+		pa.ZoneStaff = append(pa.ZoneStaff, PublicZoneStaffing{Zone: z, Designations: publicCounts(byZone[z], &pa.Suppressed)})
+	}
+	return pa
+}
+
+// writePublicSnapshot is called after every build of t.
+func writePublicSnapshot(t *Tenant, ds *Dataset) {
+	if t.PublicSnapshot == "" {
+		return
+	}
+	b, err := json.MarshalIndent(publicAggregates(t, ds), "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(t.PublicSnapshot), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(t.PublicSnapshot+".tmp", b, 0644)
+	}
+	if err == nil {
+		err = os.Rename(t.PublicSnapshot+".tmp", t.PublicSnapshot)
+	}
+	if err != nil {
+		log.Printf("public snapshot %s: %v", t.PublicSnapshot, err)
+		return
+	}
+	log.Printf("🌐 Public aggregates written to %s", t.PublicSnapshot)
+}
+
+// GET /widgets/aggregates.json
+func handlePublicAggregates(w http.ResponseWriter, r *http.Request) {
+	widgetHeaders(w, "application/json")
+	w.Header().Set("Content-Disposition", `inline; filename="aggregates.json"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(publicAggregates(tenantFor(r), dataFor(r)))
+}
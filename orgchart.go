@@ -0,0 +1,480 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"myproject/ingest"
+)
+
+// ---- Organogram ----
+//
+// The designation hierarchy, bottom up, is set by -hierarchy, a YAML list
+// of levels. The first levels are a school's (their designations are
+// matched as case-insensitive parts of the Designation column, the first
+// match from the top winning); then, in this order and each optional, the
+// school's inspector, the zone's DDE and HQ. The built-in one:
+//
+//	- title: Teacher
+//	  designations: [teacher, educator, counsellor]
+//	- title: HoS
+//	  designations: [principal]
+//	- title: SI
+//	  scope: inspector
+//	- title: DDE
+//	  scope: zone
+//	- title: DDE(HQ)
+//	  scope: hq
+//	  holders: [Dy. Director of Education (HQ)]
+//
+// The top school level is held by the school's head (escalation.go), so an
+// acting head takes it whatever their designation; everyone else at a
+// school reports to them, staff matching no level included. A head
+// reports to the inspector named for the school in the DBT summary, an
+// inspector to the zone's DDE (its zone head accounts, else the zone's
+// name), a DDE to HQ.
+//
+//	GET /api/org-chart                  HQ and the zones, with counts
+//	GET /api/org-chart?zone=NARELA[&staff=1]
+//	GET /api/emp/reporting-line?id=     an employee's managers, nearest first
+//	GET /org-chart[?zone=]              the same as a page
+
+var hierarchyFile = flag.String("hierarchy", "", "YAML file of the designation hierarchy, bottom up (see orgchart.go)")
+
+// Scopes of a level.
+const (
+	orgSchool    = "school"
+	orgInspector = "inspector"
+	orgZone      = "zone"
+	orgHQ        = "hq"
+)
+
+type OrgLevel struct {
+	Title        string   `yaml:"title" json:"title"`
+	Scope        string   `yaml:"scope,omitempty" json:"scope"`
+	Designations []string `yaml:"designations,omitempty" json:"designations,omitempty"`
+	Holders      []string `yaml:"holders,omitempty" json:"holders,omitempty"` // hq only
+}
+
+var defaultOrgLevels = []OrgLevel{
+	{Title: "Teacher", Scope: orgSchool, Designations: []string{"teacher", "educator", "counsellor"}},
+	{Title: "HoS", Scope: orgSchool, Designations: []string{"principal"}},
+	{Title: "SI", Scope: orgInspector},
+	{Title: "DDE", Scope: orgZone},
+	{Title: "DDE(HQ)", Scope: orgHQ, Holders: []string{"Dy. Director of Education (HQ)"}},
+}
+
+// orgLevels is the hierarchy in force, set by loadHierarchy.
+var orgLevels = defaultOrgLevels
+
+// loadHierarchy reads -hierarchy, if set, and checks its order.
+func loadHierarchy() error {
+	if *hierarchyFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(*hierarchyFile)
+	if err != nil {
+		return err
+	}
+	var levels []OrgLevel
+	if err := yaml.Unmarshal(b, &levels); err != nil {
+		return fmt.Errorf("%s: %v", *hierarchyFile, err)
+	}
+	rank := map[string]int{orgSchool: 0, orgInspector: 1, orgZone: 2, orgHQ: 3}
+	last, schools := -1, 0
+	for i := range levels {
+		l := &levels[i]
+		if l.Scope == "" {
+			l.Scope = orgSchool
+		}
+		r, ok := rank[l.Scope]
+		switch {
+		case strings.TrimSpace(l.Title) == "":
+			return fmt.Errorf("%s: level %d has no title", *hierarchyFile, i+1)
+		case !ok:
+			return fmt.Errorf("%s: %s: scope must be school, inspector, zone or hq", *hierarchyFile, l.Title)
+		case r < last || (r == last && r > 0):
+			return fmt.Errorf("%s: %s: school levels come first, then at most one each of inspector, zone and hq", *hierarchyFile, l.Title)
+		}
+		if r == 0 {
+			schools++
+		}
+		last = r
+	}
+	if schools == 0 {
+		return fmt.Errorf("%s: no school level", *hierarchyFile)
+	}
+	orgLevels = levels
+	log.Printf("🏛️  Hierarchy: %d level(s) from %s", len(levels), *hierarchyFile)
+	return nil
+}
+
+// orgLevel is the level of scope, or nil when the hierarchy skips it.
+func orgLevel(scope string) *OrgLevel {
+	for i := range orgLevels {
+		if orgLevels[i].Scope == scope {
+			return &orgLevels[i]
+		}
+	}
+	return nil
+}
+
+// headLevel is the top school level, the one a school's head holds.
+func headLevel() OrgLevel {
+	top := orgLevels[0]
+	for _, l := range orgLevels {
+		if l.Scope == orgSchool {
+			top = l
+		}
+	}
+	return top
+}
+
+// levelOf is the title of e's level: the head's for a school's head, else
+// the highest school level whose designations match, else "".
+func levelOf(ds *Dataset, e Emp) string {
+	if h, ok := ds.HEADS[e.SchoolID]; ok && h.EmpID == e.ID {
+		return headLevel().Title
+	}
+	d := strings.ToLower(e.Designation)
+	for i := len(orgLevels) - 1; i >= 0; i-- {
+		l := orgLevels[i]
+		if l.Scope != orgSchool {
+			continue
+		}
+		for _, p := range l.Designations {
+			if p != "" && strings.Contains(d, strings.ToLower(p)) {
+				return l.Title
+			}
+		}
+	}
+	return ""
+}
+
+// OrgLink is one manager in a reporting line.
+type OrgLink struct {
+	Level string   `json:"level"`
+	Names []string `json:"names,omitempty"` // empty when nobody holds it
+	EmpID string   `json:"emp_id,omitempty"`
+	Scope string   `json:"scope"` // school id, zone or "HQ"
+}
+
+// zoneDDEs names zone's DDEs: its zone head accounts, else the zone.
+func zoneDDEs(t *Tenant, zone string) []string {
+	var names []string
+	for _, u := range t.zoneHeads(zone) {
+		names = append(names, u.Name)
+	}
+	if len(names) == 0 && zone != "" {
+		names = []string{zone}
+	}
+	return names
+}
+
+// upperLine is the line above a school of zone with inspector si: SI, DDE
+// and HQ, as the hierarchy has them. Whoever holds the SI's charge
+// (charges.go) stands in for them.
+func upperLine(t *Tenant, ds *Dataset, zone, si string) []OrgLink {
+	var out []OrgLink
+	if l := orgLevel(orgInspector); l != nil && si != "" {
+		link := OrgLink{Level: l.Title, Names: []string{si}, Scope: zone}
+		if c, ok := ds.SI_CHARGES[strings.ToUpper(si)]; ok {
+			link.Names, link.EmpID = []string{ds.EMP[c.EmpID].Name}, c.EmpID
+		}
+		out = append(out, link)
+	}
+	if l := orgLevel(orgZone); l != nil {
+		out = append(out, OrgLink{Level: l.Title, Names: zoneDDEs(t, zone), Scope: zone})
+	}
+	if l := orgLevel(orgHQ); l != nil {
+		out = append(out, OrgLink{Level: l.Title, Names: l.Holders, Scope: "HQ"})
+	}
+	return out
+}
+
+// reportingLine is who e reports to, nearest first.
+func reportingLine(t *Tenant, ds *Dataset, e Emp) []OrgLink {
+	var out []OrgLink
+	s := ds.SCH[e.SchoolID]
+	if h, ok := ds.HEADS[e.SchoolID]; ok && h.EmpID != e.ID {
+		out = append(out, OrgLink{Level: headLevel().Title, Names: []string{h.Name}, EmpID: h.EmpID, Scope: e.SchoolID})
+	}
+	zone := e.Zone
+	if zone == "" {
+		zone = s.Zone
+	}
+	return append(out, upperLine(t, ds, zone, strings.TrimSpace(s.SIName))...)
+}
+
+// OrgMember is one employee of a school in the chart.
+type OrgMember struct {
+	EmpID       string `json:"emp_id"`
+	Name        string `json:"name"`
+	Designation string `json:"designation"`
+	Level       string `json:"level"` // "" for staff matching no level
+}
+
+type OrgSchool struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	Head    *SchoolHead    `json:"head"`
+	Staff   int            `json:"staff"`
+	ByLevel map[string]int `json:"by_level"` // "" counts the staff matching no level
+	Members []OrgMember    `json:"members,omitempty"`
+}
+
+type OrgInspector struct {
+	Level    string      `json:"level"`
+	Name     string      `json:"name"`                // "" for schools without one
+	InCharge string      `json:"in_charge,omitempty"` // holding the charge by order
+	Schools  []OrgSchool `json:"schools"`
+}
+
+type OrgZone struct {
+	Zone       string         `json:"zone"`
+	Level      string         `json:"level,omitempty"`
+	DDEs       []string       `json:"ddes,omitempty"`
+	Schools    int            `json:"schools"`
+	Staff      int            `json:"staff"`
+	Inspectors []OrgInspector `json:"inspectors,omitempty"`
+}
+
+// zoneOrg is zone's chart, its inspectors and schools by name.
+func zoneOrg(t *Tenant, ds *Dataset, zone string, members bool) OrgZone {
+	oz := OrgZone{Zone: zone, DDEs: zoneDDEs(t, zone)}
+	if l := orgLevel(orgZone); l != nil {
+		oz.Level = l.Title
+	}
+	siTitle := ""
+	if l := orgLevel(orgInspector); l != nil {
+		siTitle = l.Title
+	}
+	roster := rosterBySchool(ds.EMP)
+	bySI := map[string][]OrgSchool{}
+	for _, id := range sortedKeys(ds.SCH) {
+		s := ds.SCH[id]
+		if s.Zone != zone {
+			continue
+		}
+		sc := OrgSchool{ID: id, Name: s.Name, ByLevel: map[string]int{}}
+		if h, ok := ds.HEADS[id]; ok {
+			sc.Head = &h
+		}
+		staff := roster[id]
+		sort.Slice(staff, func(i, j int) bool { return staff[i].Name < staff[j].Name })
+		for _, e := range staff {
+			lv := levelOf(ds, e)
+			sc.ByLevel[lv]++
+			if members {
+				sc.Members = append(sc.Members, OrgMember{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Level: lv})
+			}
+		}
+		sc.Staff = len(staff)
+		oz.Schools++
+		oz.Staff += sc.Staff
+		si := ""
+		if siTitle != "" {
+			si = strings.TrimSpace(s.SIName)
+		}
+		bySI[si] = append(bySI[si], sc)
+	}
+	for _, si := range sortedKeys(bySI) {
+		oi := OrgInspector{Level: siTitle, Name: si, Schools: bySI[si]}
+		if c, ok := ds.SI_CHARGES[strings.ToUpper(si)]; ok && si != "" {
+			oi.InCharge = ds.EMP[c.EmpID].Name
+		}
+		oz.Inspectors = append(oz.Inspectors, oi)
+	}
+	return oz
+}
+
+// orgZones lists every zone with its counts, without the schools.
+func orgZones(t *Tenant, ds *Dataset) []OrgZone {
+	zones := map[string]*OrgZone{}
+	for _, s := range ds.SCH {
+		if zones[s.Zone] == nil {
+			zones[s.Zone] = &OrgZone{Zone: s.Zone, DDEs: zoneDDEs(t, s.Zone)}
+			if l := orgLevel(orgZone); l != nil {
+				zones[s.Zone].Level = l.Title
+			}
+		}
+		zones[s.Zone].Schools++
+	}
+	for _, e := range ds.EMP {
+		if z := zones[ds.SCH[e.SchoolID].Zone]; z != nil && e.SchoolID != "" {
+			z.Staff++
+		}
+	}
+	out := make([]OrgZone, 0, len(zones))
+	for _, z := range sortedKeys(zones) {
+		out = append(out, *zones[z])
+	}
+	return out
+}
+
+// orgZoneParam is the zone asked for; a DDE's own when they ask for none.
+func orgZoneParam(r *http.Request) string {
+	zone := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	if u := userFor(r); zone == "" && u != nil && u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	return zone
+}
+
+// GET /api/org-chart
+func handleOrgChart(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds, zone := tenantFor(r), dataFor(r), orgZoneParam(r)
+	if zone == "" {
+		zones := orgZones(t, ds)
+		writeData(w, map[string]any{"levels": orgLevels, "hq": orgLevel(orgHQ), "zones": zones}, &Meta{Count: len(zones)})
+		return
+	}
+	oz := zoneOrg(t, ds, zone, r.URL.Query().Get("staff") == "1")
+	if oz.Schools == 0 {
+		writeError(w, 404, errNotFound, "no schools in zone "+zone)
+		return
+	}
+	writeData(w, oz, nil)
+}
+
+// GET /api/emp/reporting-line?id=
+func handleReportingLine(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+	ds := dataFor(r)
+	e, ok := ds.EMP[id]
+	if !ok {
+		writeError(w, 404, errNotFound, "employee "+id+" not found")
+		return
+	}
+	line := reportingLine(tenantFor(r), ds, e)
+	writeData(w, map[string]any{"emp_id": e.ID, "name": e.Name, "designation": e.Designation,
+		"level": levelOf(ds, e), "reports_to": line}, &Meta{Count: len(line)})
+}
+
+// GET /org-chart[?zone=]
+func handleOrgChartPage(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds, zone, e := tenantFor(r), dataFor(r), orgZoneParam(r), html.EscapeString
+	names := func(list []string) string {
+		if len(list) == 0 {
+			return "<i>vacant</i>"
+		}
+		return e(strings.Join(list, ", "))
+	}
+	var b strings.Builder
+	if l := orgLevel(orgHQ); l != nil {
+		fmt.Fprintf(&b, `<ul class="tree"><li><span class="node hq"><b>%s</b><br>%s</span>`, e(l.Title), names(l.Holders))
+	} else {
+		b.WriteString(`<ul class="tree"><li><span class="node hq"><b>HQ</b></span>`)
+	}
+	b.WriteString("<ul>")
+	if zone == "" {
+		for _, z := range orgZones(t, ds) {
+			fmt.Fprintf(&b, `<li><span class="node"><b>%s</b> <a href="%s/org-chart?zone=%s">%s</a><br>%s<br><small>%d schools · %d staff</small></span></li>`,
+				e(z.Level), t.Prefix, e(url.QueryEscape(z.Zone)), e(z.Zone), names(z.DDEs), z.Schools, z.Staff)
+		}
+	} else {
+		z := zoneOrg(t, ds, zone, true)
+		fmt.Fprintf(&b, `<li><span class="node"><b>%s</b> %s<br>%s<br><small>%d schools · %d staff</small></span><ul>`,
+			e(z.Level), e(z.Zone), names(z.DDEs), z.Schools, z.Staff)
+		for _, si := range z.Inspectors {
+			if si.Level != "" {
+				name := "<i>none named</i>"
+				if si.Name != "" {
+					name = e(si.Name)
+				}
+				if si.InCharge != "" {
+					name += "<br>" + e(si.InCharge) + " (in charge)"
+				}
+				fmt.Fprintf(&b, `<li><span class="node"><b>%s</b><br>%s<br><small>%d schools</small></span><ul>`, e(si.Level), name, len(si.Schools))
+			}
+			for _, s := range si.Schools {
+				writeOrgSchool(&b, s)
+			}
+			if si.Level != "" {
+				b.WriteString("</ul></li>")
+			}
+		}
+		b.WriteString("</ul></li>")
+	}
+	b.WriteString("</ul></li></ul>")
+	orgPage(w, t, zone, b.String())
+}
+
+// writeOrgSchool writes a school as a node that opens on the rest of its
+// staff, level by level from the top.
+func writeOrgSchool(b *strings.Builder, s OrgSchool) {
+	e := html.EscapeString
+	head := "<i>no head</i>"
+	if s.Head != nil {
+		head = e(s.Head.Name)
+		switch {
+		case s.Head.Charge != nil:
+			head += " (in charge)"
+		case s.Head.Acting:
+			head += " (acting)"
+		}
+	}
+	fmt.Fprintf(b, `<li><details><summary><span class="node"><b>%s</b> %s<br>%s<br><small>%d staff</small></span></summary><ul>`,
+		e(headLevel().Title), head, e(s.Name), s.Staff)
+	var titles []string
+	for i := len(orgLevels) - 1; i >= 0; i-- {
+		if orgLevels[i].Scope == orgSchool {
+			titles = append(titles, orgLevels[i].Title)
+		}
+	}
+	for _, title := range append(titles, "") {
+		var names []string
+		for _, m := range s.Members {
+			if m.Level == title && (s.Head == nil || m.EmpID != s.Head.EmpID) {
+				names = append(names, e(m.Name)+` <small>`+e(m.Designation)+`</small>`)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		if title == "" {
+			title = "Other staff"
+		}
+		fmt.Fprintf(b, `<li><b>%s</b> (%d): %s</li>`, e(title), len(names), strings.Join(names, ", "))
+	}
+	b.WriteString("</ul></details></li>")
+}
+
+// orgPage writes the organogram page around body.
+func orgPage(w http.ResponseWriter, t *Tenant, zone, body string) {
+	title := "Organogram"
+	if zone != "" {
+		title += " – " + zone
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>%s – %s</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}a{color:#93c5fd}small{color:#94a3b8}
+.tree,.tree ul{list-style:none;padding-left:0}.tree ul{margin-left:18px;border-left:1px solid #334155;padding-left:14px}
+.node{display:inline-block;background:#1b263b;border:1px solid #334155;border-radius:6px;padding:6px 10px;margin:4px 0;font-size:13px}
+.hq{border-color:#93c5fd}summary{cursor:pointer}details ul li{font-size:13px;margin:3px 0}</style></head>
+<body><p><a href="%s/">Dashboard</a> · <a href="%s/org-chart">All zones</a></p><h1>%s</h1>
+%s
+</body></html>`, html.EscapeString(title), html.EscapeString(t.PageTitle()), t.Prefix, t.Prefix, html.EscapeString(title), body)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Overrides layer ----
+//
+// Corrections collected outside the HR exports (email drives, fixes from
+// zone offices, HRMS sync) live in a JSON file per tenant and are applied on
+// top of the CSV data at every build, so they survive the next month's
+// export:
+//
+//	{"emp": {"95064800": {"email": {"value": "x@y.in", "source": "import drive.csv", "at": "..."}}}}
+//
+// An employee missing from the CSVs is added when their overrides carry a
+// name (only a sync supplies one), so new joiners show up before the next
+// export does. Overrides are listed, and soft-deleted and restored (see
+// softdelete.go), by establishment staff; either rebuilds the tenant:
+//
+//	GET    /api/overrides[?emp=][&deleted=1]
+//	DELETE /api/overrides?emp=&field=
+//	POST   /api/overrides/restore?emp=&field=
+
+var overridesFile = flag.String("overrides", "./out/overrides.json", "Overrides layer applied on top of the CSVs (empty = off)")
+
+type Override struct {
+	Value   string    `json:"value"`
+	Source  string    `json:"source,omitempty"`
+	At      time.Time `json:"at"`
+	Deleted *Deletion `json:"deleted,omitempty"`
+}
+
+type Overrides struct {
+	Emp map[string]map[string]Override `json:"emp"` // emp id -> field -> override
+}
+
+// overridesMu serialises read-modify-write of override files.
+var overridesMu sync.Mutex
+
+// overridableFields maps an override field name (the Emp JSON name) to the
+// Emp field it sets.
+var overridableFields = map[string]func(*Emp, string){
+	"email":              func(e *Emp, v string) { e.Email = v },
+	"name":               func(e *Emp, v string) { e.Name = v },
+	"designation":        func(e *Emp, v string) { e.Designation = v },
+	"dob":                func(e *Emp, v string) { e.DOB, e.Age = v, ingest.AgeFromDOB(v) },
+	"gender":             func(e *Emp, v string) { e.Gender = strings.ToUpper(v) },
+	"zone":               func(e *Emp, v string) { e.Zone = strings.ToUpper(v) },
+	"school_id":          func(e *Emp, v string) { e.SchoolID = v },
+	"school_name":        func(e *Emp, v string) { e.SchoolName = v },
+	"status":             func(e *Emp, v string) { e.Status = v },
+	"selection_category": func(e *Emp, v string) { e.SelectionCategory = v },
+	"marital_status":     func(e *Emp, v string) { e.MaritalStatus = v },
+	"mobile":             func(e *Emp, v string) { e.Mobile = ingest.CanonicalMobile(v) },
+	"doj":                func(e *Emp, v string) { e.DOJ = v },
+	"religion":           func(e *Emp, v string) { e.Religion = ingest.CanonicalReligion(v) },
+}
+
+func loadOverrides(path string) Overrides {
+	ov := Overrides{Emp: map[string]map[string]Override{}}
+	if path == "" {
+		return ov
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("overrides %s: %v", path, err)
+		}
+		return ov
+	}
+	if err := json.Unmarshal(b, &ov); err != nil {
+		log.Printf("overrides %s: %v", path, err)
+	}
+	if ov.Emp == nil {
+		ov.Emp = map[string]map[string]Override{}
+	}
+	return ov
+}
+
+func saveOverrides(path string, ov Overrides) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(ov, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// applyOverrides patches emp in place and returns how many values it set.
+func applyOverrides(emp map[string]Emp, ov Overrides) int {
+	n := 0
+	for id, fields := range ov.Emp {
+		e, ok := emp[id]
+		if !ok {
+			if o, named := fields["name"]; !named || o.Deleted != nil {
+				continue
+			}
+			e = Emp{ID: id, Zone: "UNKNOWN"}
+		}
+		for field, o := range fields {
+			if o.Deleted != nil {
+				continue
+			}
+			if set, ok := overridableFields[field]; ok {
+				set(&e, o.Value)
+				n++
+			}
+		}
+		emp[id] = e
+	}
+	return n
+}
+
+// tenantFile derives a configured tenant's default state file from the
+// flag's: ./out/overrides.json becomes ./out/overrides.<id>.json, and
+// ./out/sent.jsonl ./out/sent.<id>.jsonl.
+func tenantFile(path, id string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	if ext == "" {
+		ext = ".json"
+	}
+	return strings.TrimSuffix(path, ext) + "." + id + ext
+}
+
+// OverrideEntry is one override as the API lists it.
+type OverrideEntry struct {
+	EmpID string `json:"emp_id"`
+	Field string `json:"field"`
+	Override
+}
+
+// GET/DELETE /api/overrides
+func handleOverrides(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, q := tenantFor(r), r.URL.Query()
+	emp, field := ingest.NormalizeEmpID(q.Get("emp")), strings.TrimSpace(q.Get("field"))
+	switch r.Method {
+	case http.MethodGet:
+		deleted := q.Get("deleted") == "1"
+		overridesMu.Lock()
+		ov := loadOverrides(t.Overrides)
+		overridesMu.Unlock()
+		out := []OverrideEntry{}
+		for _, id := range sortedKeys(ov.Emp) {
+			if emp != "" && id != emp {
+				continue
+			}
+			for _, f := range sortedKeys(ov.Emp[id]) {
+				if o := ov.Emp[id][f]; (o.Deleted != nil) == deleted {
+					out = append(out, OverrideEntry{EmpID: id, Field: f, Override: o})
+				}
+			}
+		}
+		page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+		items, meta := paginate(out, page, per)
+		writeData(w, items, meta)
+	case http.MethodDelete:
+		o, err := setOverrideDeleted(t, emp, field, &Deletion{At: time.Now(), By: userFor(r).Name})
+		if err != nil {
+			writeError(w, 404, errNotFound, err.Error())
+			return
+		}
+		log.Printf("✏️  Override %s/%s deleted by %s", emp, field, userFor(r).Name)
+		t.Build()
+		writeData(w, OverrideEntry{EmpID: emp, Field: field, Override: o}, nil)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or DELETE required")
+	}
+}
+
+// POST /api/overrides/restore?emp=&field=
+func handleOverrideRestore(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, q := tenantFor(r), r.URL.Query()
+	emp, field := ingest.NormalizeEmpID(q.Get("emp")), strings.TrimSpace(q.Get("field"))
+	o, err := setOverrideDeleted(t, emp, field, nil)
+	if err != nil {
+		writeError(w, 404, errNotFound, err.Error())
+		return
+	}
+	log.Printf("✏️  Override %s/%s restored by %s", emp, field, userFor(r).Name)
+	t.Build()
+	writeData(w, OverrideEntry{EmpID: emp, Field: field, Override: o}, nil)
+}
+
+// setOverrideDeleted deletes (del set) or restores (del nil) one override;
+// it fails when there is no such override in the other state.
+func setOverrideDeleted(t *Tenant, emp, field string, del *Deletion) (Override, error) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	ov := loadOverrides(t.Overrides)
+	o, ok := ov.Emp[emp][field]
+	if !ok || (o.Deleted == nil) == (del == nil) {
+		state := "override"
+		if del == nil {
+			state = "deleted override"
+		}
+		return Override{}, fmt.Errorf("no %s %s for employee %s", state, field, emp)
+	}
+	o.Deleted = del
+	ov.Emp[emp][field] = o
+	return o, saveOverrides(t.Overrides, ov)
+}
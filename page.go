@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// ---- Page template ----
+//
+// The dashboard page is an html/template, so names and titles are escaped
+// for wherever they land (HTML, attribute, URL or script) and the data
+// handed to the page's script is embedded as JSON that can't close the
+// <script> element. A tenant's "template" file is parsed on top of the
+// built-in page: a complete page replaces it, while a file of only
+// {{define}}s overrides its blocks, "header" (the title line) and
+// "actions" (the buttons under the tables) and "footer" (the input files
+// the build was made from, see provenance.go), keeping the rest:
+//
+//	{{define "header"}}<h1>{{.Title}}</h1><p>Built {{date .BuiltAt "02 Jan 2006"}}</p>{{end}}
+//
+// Older templates written with the {{TITLE}}-style placeholders still work;
+// they are rewritten into template actions when loaded.
+
+// pageData is what the page template executes against.
+type pageData struct {
+	Title        string
+	Base         string // the tenant's URL prefix
+	Profile      string
+	BuiltAt      time.Time
+	Scorecard    []ZoneScore
+	DataFiles    map[string]string
+	TotalEmp     int
+	TotalSchools int
+	TotalZones   int
+	TotalDesigs  int
+	Inputs       []InputFile
+	Results      ResultsSummary // exam results, all zones; Schools is 0 without -results
+	Anomalies    Anomalies      // the first few of each kind, see anomalies.go
+	AnomalyCount [3]int         // unknown zone, orphan and empty schools, in full
+	Trend        *Trend         // nil without -dbt-dir, see trend.go
+}
+
+var pageFuncs = template.FuncMap{
+	// json embeds v as a JSON literal outside <script>, e.g. in a data-
+	// attribute; inside a script {{.Scorecard}} already does.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"date":  func(t time.Time, layout string) string { return t.Format(layout) },
+	"upper": strings.ToUpper,
+	// short is the first 12 characters of a checksum.
+	"short": func(s string) string { return s[:min(12, len(s))] },
+	"bytes": func(n int64) string {
+		switch {
+		case n >= 1<<20:
+			return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+		case n >= 1<<10:
+			return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+		}
+		return fmt.Sprintf("%d B", n)
+	},
+}
+
+var legacyPlaceholders = strings.NewReplacer(
+	"{{TITLE}}", "{{.Title}}",
+	"{{BASE}}", "{{.Base}}",
+	"{{BASE_JSON}}", "{{.Base}}",
+	"{{SCORECARD_JSON}}", "{{.Scorecard}}",
+	"{{DATA_FILES_JSON}}", "{{.DataFiles}}",
+	"{{TREND_JSON}}", "{{.Trend}}",
+	"{{TOTAL_EMP}}", "{{.TotalEmp}}",
+	"{{TOTAL_SCHOOLS}}", "{{.TotalSchools}}",
+	"{{TOTAL_ZONES}}", "{{.TotalZones}}",
+	"{{TOTAL_DESIGS}}", "{{.TotalDesigs}}",
+	"{{PASS_PCT}}", "{{.Results.PassPct}}",
+)
+
+// parsePage parses the built-in page and, on top of it, custom.
+func parsePage(custom string) (*template.Template, error) {
+	t, err := template.New("page").Funcs(pageFuncs).Parse(indexHTML)
+	if err != nil || custom == "" {
+		return t, err
+	}
+	return t.Parse(legacyPlaceholders.Replace(custom))
+}
+
+var defaultPage = template.Must(parsePage(""))
+
+// renderPage executes t's page for ds.
+func renderPage(t *Tenant, ds *Dataset) ([]byte, error) {
+	return renderPageWith(t, ds, dataFileURLs(ds, t.Prefix))
+}
+
+// renderPageWith is renderPage with the data files at files (logical name
+// -> URL), as in an archive.
+func renderPageWith(t *Tenant, ds *Dataset, files map[string]string) ([]byte, error) {
+	zoneSet := map[string]bool{}
+	desigSet := map[string]bool{}
+	for _, e := range ds.EMP {
+		if e.Zone != "" {
+			zoneSet[e.Zone] = true
+		}
+		if e.Designation != "" {
+			desigSet[e.Designation] = true
+		}
+	}
+	results, _ := summarizeResults(ds.SCH, rosterBySchool(ds.EMP))
+	var buf bytes.Buffer
+	err := t.Page().Execute(&buf, pageData{
+		Title: t.PageTitle(), Base: t.Prefix, Profile: ds.Profile, BuiltAt: ds.BuiltAt,
+		Scorecard: ds.SCORECARD, DataFiles: files,
+		TotalEmp: len(ds.EMP), TotalSchools: len(ds.SCH), TotalZones: len(zoneSet), TotalDesigs: len(desigSet),
+		Inputs: ds.Provenance, Results: results, Anomalies: ds.ANOMALIES.pageRows(),
+		Trend: ds.TREND, AnomalyCount: [3]int{len(ds.ANOMALIES.UnknownZone), len(ds.ANOMALIES.OrphanSchools), len(ds.ANOMALIES.EmptySchools)},
+	})
+	return buf.Bytes(), err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ---- Payroll feed ----
+//
+// Each build's employee changes (history.go) that payroll cares about, new
+// joiners, exits, designation, school and status changes, are written as
+// one CSV in the payroll system's import layout and delivered to
+// -payroll-out, a folder or an sftp:// URL (sftp.go). This replaces the
+// monthly reconciliation spreadsheet. Feeds wait in the history directory's
+// payroll-outbox until delivered, so a target that is down gets them on a
+// later build. Needs -history; only the leader writes feeds.
+
+var payrollOut = flag.String("payroll-out", "", "Folder or sftp:// URL to deliver each build's payroll change feed to (empty = off)")
+
+var payrollHeader = []string{"EMP_CODE", "EMP_NAME", "CHANGE_TYPE", "OLD_VALUE", "NEW_VALUE", "DESIGNATION", "SCHOOL_ID", "ZONE", "EFFECTIVE_DATE", "REPORTED_ON"}
+
+// payrollChangeTypes maps history fields to the feed's CHANGE_TYPE; other
+// fields don't concern payroll.
+var payrollChangeTypes = map[string]string{
+	"designation": "DESIGNATION",
+	"school_id":   "POSTING",
+	"status":      "STATUS",
+}
+
+// payrollRows turns history entries into feed rows. Exits are described
+// from prev, the build they were last seen in.
+func payrollRows(prev, ds *Dataset, changes []HistoryEntry) [][]string {
+	var rows [][]string
+	for _, c := range changes {
+		typ, effective := payrollChangeTypes[c.Field], ""
+		e := ds.EMP[c.EmpID]
+		switch {
+		case c.Field == historyRecord && c.To == "added":
+			typ, effective = "JOIN", e.DOJ
+		case c.Field == historyRecord:
+			typ = "EXIT"
+			if prev != nil {
+				e = prev.EMP[c.EmpID] // blank after a restart
+			}
+		case c.Field == "designation":
+			effective = e.PromotionDate
+		case c.Field == "school_id":
+			effective = e.TransferDate
+		}
+		if typ == "" {
+			continue
+		}
+		from, to := c.From, c.To
+		if c.Field == historyRecord {
+			from, to = "", ""
+		}
+		rows = append(rows, []string{c.EmpID, e.Name, typ, from, to, e.Designation, e.SchoolID, e.Zone, effective, c.At.Format("02/01/2006")})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows
+}
+
+func payrollOutbox(t *Tenant) string { return filepath.Join(t.HistoryDir, "payroll-outbox") }
+
+// feedPayroll queues this build's feed, if it has any rows, and delivers
+// whatever is waiting in the background.
+func feedPayroll(t *Tenant, prev, ds *Dataset, changes []HistoryEntry) {
+	if !isLeader() {
+		return
+	}
+	if rows := payrollRows(prev, ds, changes); len(rows) > 0 {
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.Write(payrollHeader)
+		cw.WriteAll(rows)
+		name := fmt.Sprintf("payroll_%s_%s.csv", t.ID, ds.BuiltAt.Format("20060102_150405"))
+		if err := deliverFile(payrollOutbox(t), name, buf.Bytes()); err != nil {
+			log.Printf("payroll feed %s: %v", t.ID, err)
+			return
+		}
+		log.Printf("💰 Payroll feed %s queued with %d change(s)", name, len(rows))
+	}
+	go sendPayrollFeeds(t)
+}
+
+// sendPayrollFeeds delivers the outbox oldest first, stopping at the first
+// failure so the payroll system never sees feeds out of order.
+func sendPayrollFeeds(t *Tenant) {
+	if t.sandboxed() {
+		return
+	}
+	t.payrollMu.Lock()
+	defer t.payrollMu.Unlock()
+	names, _ := filepath.Glob(filepath.Join(payrollOutbox(t), "payroll_*.csv"))
+	sort.Strings(names)
+	for _, p := range names {
+		b, err := os.ReadFile(p)
+		if err == nil {
+			err = deliverFile(t.PayrollOut, filepath.Base(p), b)
+		}
+		if err != nil {
+			log.Printf("payroll feed %s to %s: %v (will retry next build)", filepath.Base(p), redactURL(t.PayrollOut), err)
+			return
+		}
+		os.Remove(p)
+		log.Printf("💰 Payroll feed %s delivered to %s", filepath.Base(p), redactURL(strings.TrimSuffix(t.PayrollOut, "/")))
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ---- Minimal PDF writer ----
+//
+// Just enough PDF for text reports: A4 pages, Helvetica regular/bold, lines
+// and simple column rows, with automatic page breaks. Text is WinAnsi; runes
+// outside Latin-1 print as "?".
+
+const (
+	pdfPageW  = 595.28
+	pdfPageH  = 841.89
+	pdfMargin = 48.0
+)
+
+type pdfDoc struct {
+	pages  []*bytes.Buffer
+	cur    *bytes.Buffer
+	y      float64
+	footer string
+}
+
+func newPDF(footer string) *pdfDoc {
+	d := &pdfDoc{footer: footer}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDoc) newPage() {
+	d.cur = &bytes.Buffer{}
+	d.pages = append(d.pages, d.cur)
+	d.y = pdfPageH - pdfMargin
+}
+
+// need starts a new page unless h points of space are left.
+func (d *pdfDoc) need(h float64) {
+	if d.y-h < pdfMargin+20 {
+		d.newPage()
+	}
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '–':
+			b.WriteString("\\226") // WinAnsi en dash
+		case r == '—':
+			b.WriteString("\\227")
+		case r == '…':
+			b.WriteString("\\205")
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// fit truncates s to roughly fit width points at size (Helvetica averages
+// about half an em per character).
+func fit(s string, width, size float64) string {
+	max := int(width / (size * 0.5))
+	if r := []rune(s); len(r) > max && max > 1 {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+func (d *pdfDoc) textAt(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.cur, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+func (d *pdfDoc) rule() {
+	fmt.Fprintf(d.cur, "0.6 G %.2f %.2f m %.2f %.2f l S 0 G\n", pdfMargin, d.y, pdfPageW-pdfMargin, d.y)
+	d.y -= 8
+}
+
+func (d *pdfDoc) Title(s string) {
+	d.need(30)
+	d.textAt(pdfMargin, d.y-18, 18, true, s)
+	d.y -= 28
+}
+
+func (d *pdfDoc) Heading(s string) {
+	d.need(40)
+	d.y -= 8
+	d.textAt(pdfMargin, d.y-12, 12, true, s)
+	d.y -= 18
+	d.rule()
+}
+
+func (d *pdfDoc) Text(s string) {
+	d.need(14)
+	d.textAt(pdfMargin, d.y-10, 9, false, fit(s, pdfPageW-2*pdfMargin, 9))
+	d.y -= 14
+}
+
+// Para prints s wrapped to the text width.
+func (d *pdfDoc) Para(s string) {
+	width := pdfPageW - 2*pdfMargin
+	max := int(width / (9 * 0.5))
+	var line string
+	for _, w := range strings.Fields(s) {
+		if line != "" && len([]rune(line))+1+len([]rune(w)) > max {
+			d.Text(line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += w
+	}
+	if line != "" {
+		d.Text(line)
+	}
+	d.y -= 4
+}
+
+// KV prints label/value pairs two to a line.
+func (d *pdfDoc) KV(pairs ...[2]string) {
+	colW := (pdfPageW - 2*pdfMargin) / 2
+	for i := 0; i < len(pairs); i += 2 {
+		d.need(15)
+		for j := 0; j < 2 && i+j < len(pairs); j++ {
+			x := pdfMargin + float64(j)*colW
+			d.textAt(x, d.y-10, 9, true, pairs[i+j][0]+":")
+			d.textAt(x+95, d.y-10, 9, false, fit(pairs[i+j][1], colW-100, 9))
+		}
+		d.y -= 15
+	}
+}
+
+// Row prints one table row; widths are fractions of the text width.
+func (d *pdfDoc) Row(bold bool, widths []float64, cols ...string) {
+	d.need(14)
+	x, total := pdfMargin, pdfPageW-2*pdfMargin
+	for i, c := range cols {
+		w := widths[i] * total
+		d.textAt(x, d.y-10, 9, bold, fit(c, w-4, 9))
+		x += w
+	}
+	d.y -= 14
+}
+
+// Bytes assembles the document: catalog, page tree, two fonts, then a page
+// and content stream per page.
+func (d *pdfDoc) Bytes() []byte {
+	var out bytes.Buffer
+	offsets := []int{}
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	n := len(d.pages)
+	kids := make([]string, n)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), n))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		foot := fmt.Sprintf("BT /F1 7 Tf %.2f %.2f Td (%s) Tj ET\nBT /F1 7 Tf %.2f %.2f Td (Page %d of %d) Tj ET\n",
+			pdfMargin, pdfMargin-20, pdfEscape(d.footer), pdfPageW-pdfMargin-50, pdfMargin-20, i+1, n)
+		content := p.String() + foot
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageW, pdfPageH, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ---- Pivot ----
+//
+// Ad-hoc cross-tabs for review meetings: a row dimension, an optional
+// column dimension and a measure.
+//
+//	GET /api/v1/pivot?rows=zone&cols=category&measure=employees
+//	GET /api/v1/pivot?rows=school_type&measure=enrolment&format=csv
+//
+// Employee measures (employees, avg_age) take the employee dimensions and
+// the /api/v1/employees filters; school measures (schools, enrolment,
+// max_present, dbt_total, with_aadhaar, with_account) take zone,
+// school_type and inspector. Averages are averaged per cell, not summed.
+
+type pivotDim struct {
+	emp func(Emp) string
+	sch func(School) string
+}
+
+var rxSchoolType = regexp.MustCompile(`(?i)\((CO-ED|BOYS|GIRLS)\)`)
+
+// schoolType is CO-ED, BOYS or GIRLS from the "(CO-ED)" in a school name.
+func schoolType(name string) string {
+	if m := rxSchoolType.FindStringSubmatch(name); m != nil {
+		return strings.ToUpper(m[1])
+	}
+	return "OTHER"
+}
+
+func blankUnknown(s string) string {
+	if s = strings.TrimSpace(s); s == "" {
+		return "UNKNOWN"
+	}
+	return s
+}
+
+// ageBand is the ten-year band of an age ("30-39"); UNKNOWN for 0.
+func ageBand(age int) string {
+	if age <= 0 {
+		return "UNKNOWN"
+	}
+	lo := age / 10 * 10
+	return fmt.Sprintf("%d-%d", lo, lo+9)
+}
+
+var pivotDims = map[string]pivotDim{
+	"zone":        {emp: func(e Emp) string { return blankUnknown(e.Zone) }, sch: func(s School) string { return blankUnknown(s.Zone) }},
+	"school_type": {emp: func(e Emp) string { return schoolType(e.SchoolName) }, sch: func(s School) string { return schoolType(s.Name) }},
+	"inspector":   {sch: func(s School) string { return blankUnknown(s.SIName) }},
+	"designation": {emp: func(e Emp) string { return blankUnknown(e.Designation) }},
+	"category":    {emp: func(e Emp) string { return blankUnknown(e.SelectionCategory) }},
+	"gender":      {emp: func(e Emp) string { return blankUnknown(e.Gender) }},
+	"religion":    {emp: func(e Emp) string { return blankUnknown(e.Religion) }},
+	"marital":     {emp: func(e Emp) string { return blankUnknown(canonMarital(e.MaritalStatus)) }},
+	"age_band":    {emp: func(e Emp) string { return ageBand(e.Age) }},
+	"school":      {emp: func(e Emp) string { return blankUnknown(e.SchoolName) }, sch: func(s School) string { return s.Name }},
+}
+
+type pivotMeasure struct {
+	emp func(Emp) (float64, bool)
+	sch func(School) float64
+	avg bool
+}
+
+var pivotMeasures = map[string]pivotMeasure{
+	"employees":    {emp: func(Emp) (float64, bool) { return 1, true }},
+	"avg_age":      {emp: func(e Emp) (float64, bool) { return float64(e.Age), e.Age > 0 }, avg: true},
+	"schools":      {sch: func(School) float64 { return 1 }},
+	"enrolment":    {sch: func(s School) float64 { return float64(s.TotalEnrolment) }},
+	"max_present":  {sch: func(s School) float64 { return float64(s.MaxPresent) }},
+	"dbt_total":    {sch: func(s School) float64 { return float64(s.DBTTotal) }},
+	"with_aadhaar": {sch: func(s School) float64 { return float64(s.WithAadhaar) }},
+	"with_account": {sch: func(s School) float64 { return float64(s.WithAccount) }},
+}
+
+type PivotTable struct {
+	Rows      []string    `json:"rows"`
+	Cols      []string    `json:"cols"`
+	Cells     [][]float64 `json:"cells"` // [row][col]
+	RowTotals []float64   `json:"row_totals"`
+	ColTotals []float64   `json:"col_totals"`
+	Total     float64     `json:"total"`
+	Measure   string      `json:"measure"`
+	RowDim    string      `json:"row_dim"`
+	ColDim    string      `json:"col_dim,omitempty"`
+}
+
+// pivotAcc sums (and counts, for averages) by row and column key.
+type pivotAcc struct {
+	sum, n map[[2]string]float64
+	rows   map[string]bool
+	cols   map[string]bool
+}
+
+func (a *pivotAcc) add(row, col string, v float64) {
+	for _, k := range [][2]string{{row, col}, {row, ""}, {"", col}, {"", ""}} {
+		a.sum[k] += v
+		a.n[k]++
+	}
+	a.rows[row], a.cols[col] = true, true
+}
+
+func pivot(ds *Dataset, rowDim, colDim, measure string, empQ empQuery) (*PivotTable, error) {
+	m, ok := pivotMeasures[measure]
+	if !ok {
+		return nil, fmt.Errorf("unknown measure %q", measure)
+	}
+	dim := func(name string) (pivotDim, error) {
+		d, ok := pivotDims[name]
+		switch {
+		case !ok:
+			return d, fmt.Errorf("unknown dimension %q", name)
+		case m.emp != nil && d.emp == nil, m.sch != nil && d.sch == nil:
+			return d, fmt.Errorf("dimension %q does not apply to %s", name, measure)
+		}
+		return d, nil
+	}
+	rd, err := dim(rowDim)
+	if err != nil {
+		return nil, err
+	}
+	cd := pivotDim{emp: func(Emp) string { return "Total" }, sch: func(School) string { return "Total" }}
+	if colDim != "" {
+		if cd, err = dim(colDim); err != nil {
+			return nil, err
+		}
+	}
+
+	acc := &pivotAcc{sum: map[[2]string]float64{}, n: map[[2]string]float64{}, rows: map[string]bool{}, cols: map[string]bool{}}
+	if m.emp != nil {
+		for _, e := range ds.EMP {
+			if !empQ.match(e) {
+				continue
+			}
+			if v, ok := m.emp(e); ok {
+				acc.add(rd.emp(e), cd.emp(e), v)
+			}
+		}
+	} else {
+		for _, s := range ds.SCH {
+			if empQ.Zone == "" || s.Zone == empQ.Zone {
+				acc.add(rd.sch(s), cd.sch(s), m.sch(s))
+			}
+		}
+	}
+
+	keys := func(set map[string]bool) []string {
+		out := make([]string, 0, len(set))
+		for k := range set {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+	value := func(k [2]string) float64 {
+		if !m.avg {
+			return acc.sum[k]
+		}
+		if acc.n[k] == 0 {
+			return 0
+		}
+		return math.Round(acc.sum[k]/acc.n[k]*10) / 10
+	}
+	pt := &PivotTable{Rows: keys(acc.rows), Cols: keys(acc.cols), Measure: measure, RowDim: rowDim, ColDim: colDim}
+	pt.Cells = make([][]float64, len(pt.Rows))
+	for i, r := range pt.Rows {
+		pt.Cells[i] = make([]float64, len(pt.Cols))
+		for j, c := range pt.Cols {
+			pt.Cells[i][j] = value([2]string{r, c})
+		}
+		pt.RowTotals = append(pt.RowTotals, value([2]string{r, ""}))
+	}
+	for _, c := range pt.Cols {
+		pt.ColTotals = append(pt.ColTotals, value([2]string{"", c}))
+	}
+	pt.Total = value([2]string{"", ""})
+	return pt, nil
+}
+
+// GET /api/v1/pivot
+func handleAPIPivot(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	q := r.URL.Query()
+	rows, cols, measure := q.Get("rows"), q.Get("cols"), q.Get("measure")
+	if rows == "" {
+		rows = "zone"
+	}
+	if measure == "" {
+		measure = "employees"
+	}
+	pt, err := pivot(dataFor(r), rows, cols, measure, parseEmpQuery(q))
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	if q.Get("format") == "csv" {
+		num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		header := []string{rows, measure}
+		if cols != "" {
+			header = append(append([]string{rows}, pt.Cols...), "Total")
+		}
+		out := make([][]string, 0, len(pt.Rows)+1)
+		for i, rk := range pt.Rows {
+			row := []string{rk}
+			if cols != "" {
+				for _, v := range pt.Cells[i] {
+					row = append(row, num(v))
+				}
+			}
+			out = append(out, append(row, num(pt.RowTotals[i])))
+		}
+		total := []string{"Total"}
+		if cols != "" {
+			for _, v := range pt.ColTotals {
+				total = append(total, num(v))
+			}
+		}
+		out = append(out, append(total, num(pt.Total)))
+		writeCSV(w, r, "pivot_"+rows+"_"+measure+".csv", header, out)
+		return
+	}
+	writeData(w, pt, &Meta{Count: len(pt.Rows)})
+}
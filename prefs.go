@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Notification preferences ----
+//
+// Each employee may turn email, SMS and WhatsApp messages off and pick a
+// language. No record means everything on, English. Employees edit their own
+// record through a signed self-service link (/prefs?e=<id>&sig=<hmac>, also
+// available to templates as {{PREFS_LINK}}); staff can edit any record via
+// /api/prefs. Every channel asks Allows before sending. Deleting a record
+// (softdelete.go) puts the employee back on the defaults until it is
+// restored:
+//
+//	GET    /api/prefs?id=
+//	POST   /api/prefs {"id": "...", "email": false, "sms": true, "whatsapp": true, "language": "hi"}
+//	DELETE /api/prefs?id=
+//	POST   /api/prefs/restore?id=
+//
+// The link key is -link-secret, else a random key kept next to the
+// preferences file (prefs.key) so links survive restarts.
+
+var (
+	prefsFile  = flag.String("prefs", "./out/prefs.json", "Per-employee notification preferences (empty = everyone opted in)")
+	linkSecret = flag.String("link-secret", "", "Key for signing self-service links (default: random, kept next to -prefs)")
+)
+
+const (
+	channelEmail    = "email"
+	channelSMS      = "sms"
+	channelWhatsApp = "whatsapp"
+)
+
+var rxLanguage = regexp.MustCompile(`^[a-z]{2}$`)
+
+// prefLanguages are offered on the self-service page.
+var prefLanguages = [][2]string{{"en", "English"}, {"hi", "हिन्दी"}}
+
+type NotificationPrefs struct {
+	Email    bool       `json:"email"`
+	SMS      bool       `json:"sms"`
+	WhatsApp bool       `json:"whatsapp"`
+	Language string     `json:"language"`
+	By       string     `json:"by,omitempty"` // "self" or the staff user
+	Updated  *time.Time `json:"updated,omitempty"`
+	Deleted  *Deletion  `json:"deleted,omitempty"`
+}
+
+func defaultPrefs() NotificationPrefs {
+	return NotificationPrefs{Email: true, SMS: true, WhatsApp: true, Language: "en"}
+}
+
+func (p NotificationPrefs) allows(channel string) bool {
+	switch channel {
+	case channelEmail:
+		return p.Email
+	case channelSMS:
+		return p.SMS
+	case channelWhatsApp:
+		return p.WhatsApp
+	}
+	return true
+}
+
+type prefStore struct {
+	mu     sync.Mutex
+	tenant string
+	path   string
+	key    []byte
+	emp    map[string]NotificationPrefs
+}
+
+var (
+	prefStoresMu sync.Mutex
+	prefStores   = map[string]*prefStore{} // by tenant id
+)
+
+// prefs returns the tenant's store, loading it on first use.
+func (t *Tenant) prefs() *prefStore {
+	prefStoresMu.Lock()
+	defer prefStoresMu.Unlock()
+	if s, ok := prefStores[t.ID]; ok {
+		return s
+	}
+	s := &prefStore{tenant: t.ID, path: t.Prefs, emp: map[string]NotificationPrefs{}}
+	if b, err := os.ReadFile(t.Prefs); err == nil {
+		if err := json.Unmarshal(b, &s.emp); err != nil {
+			log.Printf("prefs %s: %v", t.Prefs, err)
+		}
+	}
+	s.key = prefsKey(t.Prefs)
+	prefStores[t.ID] = s
+	return s
+}
+
+func prefsKey(path string) []byte {
+	if *linkSecret != "" {
+		return []byte(*linkSecret)
+	}
+	if path == "" {
+		return nil
+	}
+	keyPath := strings.TrimSuffix(path, ".json") + ".key"
+	if b, err := os.ReadFile(keyPath); err == nil && len(b) >= 32 {
+		return b
+	}
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	key = []byte(hex.EncodeToString(key))
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0755); err != nil {
+		log.Printf("prefs key: %v", err)
+	} else if err := os.WriteFile(keyPath, key, 0600); err != nil {
+		log.Printf("prefs key: %v", err)
+	}
+	return key
+}
+
+func (s *prefStore) save() error {
+	if s.path == "" {
+		return fmt.Errorf("no preferences file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.emp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *prefStore) Get(id string) NotificationPrefs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.emp[id]; ok && p.Deleted == nil {
+		return p
+	}
+	return defaultPrefs()
+}
+
+// Deleted is id's soft-deleted record, if any.
+func (s *prefStore) Deleted(id string) (NotificationPrefs, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.emp[id]
+	return p, ok && p.Deleted != nil
+}
+
+// SetDeleted soft-deletes id's record (del set) or restores it (del nil);
+// found is false when there is none in the other state.
+func (s *prefStore) SetDeleted(id string, del *Deletion) (p NotificationPrefs, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.emp[id]
+	if !ok || (p.Deleted == nil) == (del == nil) {
+		return NotificationPrefs{}, false, nil
+	}
+	prev := p
+	p.Deleted = del
+	s.emp[id] = p
+	if err := s.save(); err != nil {
+		s.emp[id] = prev
+		return prev, true, err
+	}
+	return p, true, nil
+}
+
+// All returns every record, deleted ones included, by employee id.
+func (s *prefStore) All() map[string]NotificationPrefs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]NotificationPrefs, len(s.emp))
+	for id, p := range s.emp {
+		out[id] = p
+	}
+	return out
+}
+
+func (s *prefStore) Put(id string, p NotificationPrefs) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emp[id] = p
+	return s.save()
+}
+
+// Allows reports whether employee id accepts messages on channel.
+func (s *prefStore) Allows(id, channel string) bool { return s.Get(id).allows(channel) }
+
+// signFor signs a self-service link for id; purpose keeps a link for one
+// page from opening another, and the tenant one tenant's link from opening
+// another's page when they share -link-secret.
+func (s *prefStore) signFor(purpose, id string) string {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(s.tenant + ":" + purpose + ":" + id))
+	return hex.EncodeToString(m.Sum(nil))[:32]
+}
+
+func (s *prefStore) verifyFor(purpose, id, sig string) bool {
+	return len(s.key) > 0 && id != "" && hmac.Equal([]byte(s.signFor(purpose, id)), []byte(sig))
+}
+
+func (s *prefStore) sign(id string) string { return s.signFor("prefs", id) }
+
+func (s *prefStore) verify(id, sig string) bool { return s.verifyFor("prefs", id, sig) }
+
+// prefsLink is the employee's self-service URL, absolute when -public-url
+// is set.
+func (t *Tenant) prefsLink(id string) string {
+	s := t.prefs()
+	if len(s.key) == 0 {
+		return ""
+	}
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/prefs?e=" + url.QueryEscape(id) + "&sig=" + s.sign(id)
+}
+
+// GET/POST /prefs?e=&sig= (public; the self-service page)
+func handlePrefsPage(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	s := t.prefs()
+	id, sig := ingest.NormalizeEmpID(r.FormValue("e")), r.FormValue("sig")
+	if !s.verify(id, sig) {
+		http.Error(w, "This link is not valid.", http.StatusForbidden)
+		return
+	}
+	e, ok := t.Data().EMP[id]
+	if !ok {
+		http.Error(w, "This link is not valid.", http.StatusForbidden)
+		return
+	}
+	p, msg := s.Get(id), ""
+	if r.Method == http.MethodPost {
+		p = NotificationPrefs{
+			Email:    r.FormValue("email") == "1",
+			SMS:      r.FormValue("sms") == "1",
+			WhatsApp: r.FormValue("whatsapp") == "1",
+			Language: r.FormValue("language"),
+			By:       "self",
+		}
+		now := time.Now()
+		p.Updated = &now
+		if !rxLanguage.MatchString(p.Language) {
+			p.Language = "en"
+		}
+		if err := s.Put(id, p); err != nil {
+			log.Printf("prefs %s: %v", id, err)
+			http.Error(w, "Could not save your preferences, please try again later.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("🔔 Preferences of %s updated by self: email=%v sms=%v whatsapp=%v lang=%s", id, p.Email, p.SMS, p.WhatsApp, p.Language)
+		msg = "Your preferences have been saved."
+	}
+	esc := html.EscapeString
+	check := func(name, label string, on bool) string {
+		c := ""
+		if on {
+			c = " checked"
+		}
+		return fmt.Sprintf(`<label><input type="checkbox" name="%s" value="1"%s> %s</label><br>`, name, c, label)
+	}
+	var langs strings.Builder
+	for _, l := range prefLanguages {
+		sel := ""
+		if l[0] == p.Language {
+			sel = " selected"
+		}
+		fmt.Fprintf(&langs, `<option value="%s"%s>%s</option>`, l[0], sel, esc(l[1]))
+	}
+	if msg != "" {
+		msg = `<p style="color:#4ade80">` + esc(msg) + `</p>`
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Notification preferences – %s</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>button,select{margin:8px 0;padding:8px;border-radius:6px;border:1px solid #334155}label{line-height:2}</style></head>
+<body style="font-family:system-ui;background:#0d1b2a;color:#f1f5f9;max-width:420px;margin:40px auto;padding:0 12px">
+<h1>Notification preferences</h1><p>%s (%s)</p>%s
+<form method="post"><input type="hidden" name="e" value="%s"><input type="hidden" name="sig" value="%s">
+%s%s%s<label>Language <select name="language">%s</select></label><br><button>Save</button></form>
+</body></html>`, esc(t.PageTitle()), esc(e.Name), esc(id), msg, esc(id), esc(sig),
+		check("email", "Email messages", p.Email), check("sms", "SMS messages", p.SMS),
+		check("whatsapp", "WhatsApp messages", p.WhatsApp), langs.String())
+}
+
+// GET/POST /api/prefs?id=
+func handleAPIPrefs(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	s := t.prefs()
+	switch r.Method {
+	case http.MethodGet:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+		if _, ok := t.Data().EMP[id]; !ok {
+			writeError(w, 404, errNotFound, "employee "+id+" not found")
+			return
+		}
+		out := map[string]any{"id": id, "prefs": s.Get(id), "link": t.prefsLink(id), "grievance_link": t.grievanceLink(id)}
+		if d, ok := s.Deleted(id); ok {
+			out["deleted"] = d
+		}
+		writeData(w, out, nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		var req struct {
+			ID string `json:"id"`
+			NotificationPrefs
+		}
+		req.NotificationPrefs = defaultPrefs()
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeError(w, 400, errBadRequest, "body must be preferences: "+err.Error())
+			return
+		}
+		id := ingest.NormalizeEmpID(req.ID)
+		if _, ok := t.Data().EMP[id]; !ok {
+			writeError(w, 404, errNotFound, "employee "+id+" not found")
+			return
+		}
+		p := req.NotificationPrefs
+		if !rxLanguage.MatchString(p.Language) {
+			writeError(w, 400, errBadRequest, "language must be a two-letter code")
+			return
+		}
+		now := time.Now()
+		p.By, p.Updated = userFor(r).Name, &now
+		if err := s.Put(id, p); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("🔔 Preferences of %s updated by %s: email=%v sms=%v whatsapp=%v lang=%s", id, p.By, p.Email, p.SMS, p.WhatsApp, p.Language)
+		writeData(w, p, nil)
+	case http.MethodDelete:
+		if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+		p, ok, err := s.SetDeleted(id, &Deletion{At: time.Now(), By: userFor(r).Name})
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		if !ok {
+			writeError(w, 404, errNotFound, "no preferences recorded for "+id)
+			return
+		}
+		log.Printf("🔔 Preferences of %s deleted by %s", id, userFor(r).Name)
+		writeData(w, p, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// POST /api/prefs/restore?id=
+func handlePrefsRestore(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+	p, ok, err := tenantFor(r).prefs().SetDeleted(id, nil)
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, 404, errNotFound, "no deleted preferences for "+id)
+		return
+	}
+	log.Printf("🔔 Preferences of %s restored by %s", id, userFor(r).Name)
+	writeData(w, p, nil)
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestPrefsLinkBoundToTenant(t *testing.T) {
+	key := []byte("shared -link-secret of both tenants")
+	north := &prefStore{tenant: "north", key: key}
+	south := &prefStore{tenant: "south", key: key}
+	sig := north.sign("95054834")
+	if !north.verify("95054834", sig) {
+		t.Fatal("link doesn't verify on its own tenant")
+	}
+	if south.verify("95054834", sig) {
+		t.Error("link signed for north verifies on south")
+	}
+	if north.verifyFor("grievance", "95054834", sig) {
+		t.Error("prefs link opens the grievance page")
+	}
+}
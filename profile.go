@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ---- Profiles ----
+//
+// A profile bundles one month's configuration under a name, so switching
+// months is "-profile 202509" rather than three file flags. Profiles live as
+// <name>.json in the profiles directory:
+//
+//	{"title": "MCD Dashboard – Sep 2025",
+//	 "basic": "data/202509/Basic.csv", "services": "data/202509/Services.csv",
+//	 "dbt": "data/202509/Dashboard_Summary_202509.csv",
+//	 "data_dir": "out/202509/data", "snapshot": "202509"}
+//
+// Empty fields fall back to the tenant's own settings. When "snapshot" is set
+// every build of the profile is also saved under that snapshot tag.
+
+var (
+	profilesDir = flag.String("profiles", "./profiles", "Directory of per-month <name>.json configuration profiles")
+	profileName = flag.String("profile", "", "Profile to serve at startup, e.g. 202509 (optional)")
+)
+
+var rxProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+type Profile struct {
+	Name     string `json:"name"`
+	Title    string `json:"title,omitempty"`
+	Basic    string `json:"basic,omitempty"`
+	Services string `json:"services,omitempty"`
+	DBT      string `json:"dbt,omitempty"`
+	Infra    string `json:"infra,omitempty"`
+	MDM      string `json:"mdm,omitempty"`
+	Results  string `json:"results,omitempty"`
+	Periods  string `json:"periods,omitempty"`
+	Leave    string `json:"leave,omitempty"`
+	DataDir  string `json:"data_dir,omitempty"`
+	Snapshot string `json:"snapshot,omitempty"`
+	Active   bool   `json:"active"`
+}
+
+// apply overlays the profile's non-empty fields on in.
+func (p *Profile) apply(in Inputs) Inputs {
+	for dst, src := range map[*string]string{&in.Basic: p.Basic, &in.Services: p.Services, &in.DBT: p.DBT, &in.DataDir: p.DataDir, &in.Infra: p.Infra, &in.MDM: p.MDM, &in.Results: p.Results, &in.Periods: p.Periods, &in.Leave: p.Leave} {
+		if src != "" {
+			*dst = src
+		}
+	}
+	return in
+}
+
+func loadProfile(dir, name string) (*Profile, error) {
+	if !rxProfileName.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("profile %s: %v", name, err)
+	}
+	p.Name, p.Active = name, false
+	if p.Snapshot != "" && !rxSnapshotTag.MatchString(p.Snapshot) {
+		return nil, fmt.Errorf("profile %s: invalid snapshot tag %q", name, p.Snapshot)
+	}
+	return p, nil
+}
+
+// listProfiles returns every loadable profile in dir, newest name first
+// (month names like 202509 sort naturally).
+func listProfiles(dir string) []*Profile {
+	out := []*Profile{}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, f := range files {
+		p, err := loadProfile(dir, strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			log.Printf("skip profile %s: %v", f, err)
+			continue
+		}
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out
+}
+
+// UseProfile builds the tenant from profile name, which becomes the
+// served profile if the build succeeds.
+func (t *Tenant) UseProfile(name string) error {
+	p, err := loadProfile(t.ProfilesDir, name)
+	if err != nil {
+		return err
+	}
+	return t.BuildWith(p)
+}
+
+// GET /api/profiles
+func handleAPIProfiles(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	list := listProfiles(t.ProfilesDir)
+	if cur := t.profile.Load(); cur != nil {
+		for _, p := range list {
+			p.Active = p.Name == cur.Name
+		}
+	}
+	writeData(w, list, nil)
+}
+
+// POST /api/profiles/switch?name=202509 rebuilds the tenant from that
+// profile; if the build fails the previous profile stays in service.
+func handleProfileSwitch(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	p, err := loadProfile(t.ProfilesDir, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, 404, errNotFound, "no such profile: "+name)
+			return
+		}
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	if err := t.BuildWith(p); err != nil {
+		writeError(w, 500, errInternal, "profile "+name+": "+err.Error())
+		return
+	}
+	out := *p
+	out.Active = t.profile.Load() == p // false while the build awaits approval (stage.go)
+	writeData(w, out, nil)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Input provenance ----
+//
+// Every build records the SHA-256, size and modification time of each file
+// it read, and where the file came from: the SFTP drop it was fetched in
+// (fetch.go) when the checksum matches one, otherwise the server's disk.
+// When a figure is disputed this pins down exactly which files produced it.
+// The list is shown at the foot of the dashboard, returned by
+//
+//	GET /api/v1/build/last
+//
+// and, with -db, stored with the build (table build_inputs).
+
+type InputFile struct {
+	Role    string    `json:"role"` // basic, services, dbt, infra, mdm, results, metrics or overrides
+	Path    string    `json:"path"`
+	Name    string    `json:"name"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime,omitempty"`
+	Source  string    `json:"source"`
+	Missing bool      `json:"missing,omitempty"`
+}
+
+const sourceDisk = "disk"
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// inputProvenance describes the files behind in. Optional inputs that
+// aren't configured, and an overrides or charges file nobody has written yet, are left
+// out; other absent files are listed as missing.
+func inputProvenance(t *Tenant, in Inputs) []InputFile {
+	var out []InputFile
+	for _, f := range []struct{ role, path string }{
+		{"basic", in.Basic}, {"services", in.Services}, {"dbt", in.DBT},
+		{"infra", in.Infra}, {"mdm", in.MDM}, {"results", in.Results}, {"periods", in.Periods}, {"leave", in.Leave}, {"locations", in.Locations}, {"zones_geojson", in.ZonesGeoJSON}, {"metrics", in.Metrics}, {"overrides", in.Overrides}, {"charges", in.Charges},
+	} {
+		if f.path == "" {
+			continue
+		}
+		fi := InputFile{Role: f.role, Path: f.path, Name: filepath.Base(f.path), Source: sourceDisk}
+		st, err := os.Stat(f.path)
+		if err == nil {
+			fi.SHA256, err = hashFile(f.path)
+		}
+		if err != nil && (f.role == "overrides" || f.role == "charges") {
+			continue // none made yet
+		}
+		if err != nil {
+			fi.Missing = true
+			out = append(out, fi)
+			continue
+		}
+		fi.Size, fi.ModTime = st.Size(), st.ModTime()
+		if src := fetchedFrom(t, fi.Name, fi.SHA256); src != "" {
+			fi.Source = src
+		}
+		out = append(out, fi)
+	}
+	return out
+}
+
+// fetchedFrom names the newest kept SFTP drop holding name with this
+// checksum, or "".
+func fetchedFrom(t *Tenant, name, sum string) string {
+	if t == nil || t.FetchFrom == "" {
+		return ""
+	}
+	drops, _ := filepath.Glob(filepath.Join(tenantFetchDir(t), "[0-9]*-[0-9]*"))
+	sort.Sort(sort.Reverse(sort.StringSlice(drops)))
+	for _, d := range drops {
+		b, err := os.ReadFile(filepath.Join(d, fetchSums))
+		if err != nil {
+			continue
+		}
+		if sums, err := parseSums(b); err == nil && sums[name] == sum {
+			return fmt.Sprintf("%s (drop %s)", strings.TrimSuffix(redactURL(t.FetchFrom), "/")+"/"+name, filepath.Base(d))
+		}
+	}
+	return ""
+}
+
+// GET /api/v1/build/last
+func handleAPIBuildLast(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	writeData(w, map[string]any{
+		"tenant":    t.ID,
+		"built_at":  ds.BuiltAt,
+		"profile":   ds.Profile,
+		"employees": len(ds.EMP),
+		"schools":   len(ds.SCH),
+		"inputs":    ds.Provenance,
+	}, nil)
+}
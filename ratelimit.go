@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Rate limits ----
+//
+// A client stuck in a loop (a Power BI refresh retrying every second, a
+// script paging the roster) must not starve everyone else. Every tenant
+// request under /api/ is charged to a token bucket per class and client:
+// the logged-in user, or the IP address where there is no login. The
+// classes, in the order they are matched:
+//
+//	export   ?format=csv|xlsx and /api/ogd/export
+//	search   ?q= table searches
+//	api      the rest of /api/
+//
+// -rate-limits sets each class's sustained rate and burst, e.g.
+// "api=600/m:120,search=120/m:30,export=20/m:5"; a class left out is not
+// limited, and "off" turns limiting off. A request over the limit gets 429
+// with Retry-After. Counts since start, and the clients limited most:
+//
+//	GET /api/rate-limits
+
+var rateLimits = flag.String("rate-limits", "api=600/m:120,search=120/m:30,export=20/m:5", `Request rate per client and class, as class=N/s|m|h[:burst] for api, search and export ("off" = none)`)
+
+const (
+	rateAPI    = "api"
+	rateSearch = "search"
+	rateExport = "export"
+
+	rateIdle      = 10 * time.Minute // buckets unused this long are dropped
+	rateTopLimits = 20
+)
+
+var rateClasses = []string{rateExport, rateSearch, rateAPI}
+
+// rateRule is a class's sustained rate, in tokens a second, and burst.
+type rateRule struct {
+	PerSec float64 `json:"per_second"`
+	Burst  float64 `json:"burst"`
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateClassStats counts a class's requests since start.
+type RateClassStats struct {
+	Class   string    `json:"class"`
+	Rule    *rateRule `json:"rule,omitempty"` // nil: not limited
+	Allowed int64     `json:"allowed"`
+	Limited int64     `json:"limited"`
+}
+
+// RateClient is a client that has been limited.
+type RateClient struct {
+	Key     string    `json:"key"` // tenant/class/user or IP
+	Limited int64     `json:"limited"`
+	Last    time.Time `json:"last"`
+}
+
+var ratelim = struct {
+	sync.Mutex
+	rules   map[string]rateRule
+	buckets map[string]*rateBucket
+	allowed map[string]int64
+	limited map[string]int64
+	clients map[string]*RateClient
+	swept   time.Time
+}{buckets: map[string]*rateBucket{}, allowed: map[string]int64{}, limited: map[string]int64{}, clients: map[string]*RateClient{}}
+
+// parseRateLimits reads -rate-limits.
+func parseRateLimits(s string) (map[string]rateRule, error) {
+	out := map[string]rateRule{}
+	if s = strings.TrimSpace(s); s == "" || s == "off" {
+		return out, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		class, spec, ok := strings.Cut(part, "=")
+		class = strings.TrimSpace(class)
+		if !ok || (class != rateAPI && class != rateSearch && class != rateExport) {
+			return nil, fmt.Errorf("%q: want class=N/unit[:burst] with a class from api, search, export", part)
+		}
+		spec, burst, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+		n, unit, ok := strings.Cut(spec, "/")
+		per := map[string]float64{"s": 1, "m": 60, "h": 3600}[strings.TrimSpace(unit)]
+		count, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if !ok || per == 0 || err != nil || count <= 0 {
+			return nil, fmt.Errorf("%q: the rate must read like 600/m (per s, m or h)", part)
+		}
+		rule := rateRule{PerSec: count / per, Burst: math.Max(1, math.Ceil(count/per))}
+		if hasBurst {
+			b, err := strconv.Atoi(strings.TrimSpace(burst))
+			if err != nil || b < 1 {
+				return nil, fmt.Errorf("%q: the burst must be a whole number of requests", part)
+			}
+			rule.Burst = float64(b)
+		}
+		out[class] = rule
+	}
+	return out, nil
+}
+
+// setupRateLimits checks -rate-limits and puts it in force.
+func setupRateLimits() error {
+	rules, err := parseRateLimits(*rateLimits)
+	if err != nil {
+		return fmt.Errorf("-rate-limits: %v", err)
+	}
+	ratelim.Lock()
+	ratelim.rules = rules
+	ratelim.Unlock()
+	return nil
+}
+
+// rateClass is the class r is charged to, or "" for none.
+func rateClass(r *http.Request) string {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return ""
+	}
+	q := r.URL.Query()
+	switch {
+	case q.Get("format") == "csv" || q.Get("format") == "xlsx" || r.URL.Path == "/api/ogd/export":
+		return rateExport
+	case strings.TrimSpace(q.Get("q")) != "":
+		return rateSearch
+	}
+	return rateAPI
+}
+
+// rateTake takes a token for key from class's bucket. When there is none,
+// it returns how long until there will be.
+func rateTake(class, key string, now time.Time) (bool, time.Duration) {
+	ratelim.Lock()
+	defer ratelim.Unlock()
+	rule, ok := ratelim.rules[class]
+	if !ok {
+		return true, 0
+	}
+	if now.Sub(ratelim.swept) > rateIdle {
+		for k, b := range ratelim.buckets {
+			if now.Sub(b.last) > rateIdle {
+				delete(ratelim.buckets, k)
+			}
+		}
+		ratelim.swept = now
+	}
+	b := ratelim.buckets[key]
+	if b == nil {
+		b = &rateBucket{tokens: rule.Burst, last: now}
+		ratelim.buckets[key] = b
+	}
+	b.tokens = math.Min(rule.Burst, b.tokens+now.Sub(b.last).Seconds()*rule.PerSec)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		ratelim.allowed[class]++
+		return true, 0
+	}
+	ratelim.limited[class]++
+	c := ratelim.clients[key]
+	if c == nil {
+		c = &RateClient{Key: key}
+		ratelim.clients[key] = c
+	}
+	if now.Sub(c.Last) > time.Minute {
+		log.Printf("🚦 Rate limit hit: %s (%.0f/min, burst %.0f)", key, rule.PerSec*60, rule.Burst)
+	}
+	c.Limited++
+	c.Last = now
+	return false, time.Duration((1 - b.tokens) / rule.PerSec * float64(time.Second))
+}
+
+// withRateLimit answers 429 to a client over its class's limit.
+func withRateLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rateClass(r)
+		if class == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		who := clientIP(r)
+		if u := userFor(r); u != nil && u != localOperator {
+			who = u.Name
+		}
+		ok, wait := rateTake(class, tenantFor(r).ID+"/"+class+"/"+who, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, errRateLimited, "too many "+class+" requests; retry in "+wait.Round(time.Second).String())
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// GET /api/rate-limits
+func handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	ratelim.Lock()
+	classes := make([]RateClassStats, 0, len(rateClasses))
+	for _, c := range rateClasses {
+		st := RateClassStats{Class: c, Allowed: ratelim.allowed[c], Limited: ratelim.limited[c]}
+		if rule, ok := ratelim.rules[c]; ok {
+			st.Rule = &rule
+		}
+		classes = append(classes, st)
+	}
+	clients := make([]RateClient, 0, len(ratelim.clients))
+	for _, c := range ratelim.clients {
+		clients = append(clients, *c)
+	}
+	ratelim.Unlock()
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Limited != clients[j].Limited {
+			return clients[i].Limited > clients[j].Limited
+		}
+		return clients[i].Key < clients[j].Key
+	})
+	writeData(w, map[string]any{"classes": classes, "limited_clients": clients[:min(len(clients), rateTopLimits)]}, nil)
+}
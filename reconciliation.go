@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Basic ↔ Services reconciliation ----
+//
+// Employees are built from Basic.csv rows, with the date of joining,
+// category and service dates joined in from Services.csv by employee ID.
+// The reconciliation lists the IDs the join misses on either side: in
+// Basic only (built without their service record) and in Services only
+// (not built at all), counted by zone and school:
+//
+//	GET /api/reconciliation[?zone=]                                     totals and the zone and school counts
+//	GET /api/reconciliation?side=basic|services[&zone=][&school=]      the employees
+//	GET /api/reconciliation?format=csv[&side=][&zone=][&school=]
+//
+// A DDE sees their own zone only.
+
+const (
+	reconBasic    = "basic"
+	reconServices = "services"
+)
+
+type ReconGroup struct {
+	Zone         string `json:"zone"`
+	SchoolID     string `json:"school_id,omitempty"`
+	SchoolName   string `json:"school_name,omitempty"`
+	BasicOnly    int    `json:"basic_only"`
+	ServicesOnly int    `json:"services_only"`
+}
+
+type ReconSummary struct {
+	Basic        int          `json:"basic_ids"`
+	Services     int          `json:"services_ids"`
+	Matched      int          `json:"matched"`
+	BasicOnly    int          `json:"basic_only"`
+	ServicesOnly int          `json:"services_only"`
+	Zones        []ReconGroup `json:"zones"`
+	Schools      []ReconGroup `json:"schools"`
+}
+
+// reconciliationOf is the build's reconciliation; a build restored from
+// -db has none, so the input files are read again.
+func reconciliationOf(ds *Dataset) (ingest.Reconciliation, error) {
+	if ds.RECONCILIATION != nil {
+		return *ds.RECONCILIATION, nil
+	}
+	basic, err := ingest.LoadBasic(ds.Inputs.Basic)
+	if err != nil {
+		return ingest.Reconciliation{}, err
+	}
+	services, err := ingest.LoadServices(ds.Inputs.Services)
+	if err != nil {
+		return ingest.Reconciliation{}, err
+	}
+	return ingest.Reconcile(basic, services), nil
+}
+
+// reconSide is one unmatched employee with the file it is in.
+type reconSide struct {
+	Side string `json:"side"`
+	ingest.Unmatched
+}
+
+// GET /api/reconciliation
+func handleReconciliation(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	side, school := q.Get("side"), ingest.DigitsOnlyKey(q.Get("school"))
+	if side != "" && side != reconBasic && side != reconServices {
+		writeError(w, 400, errBadRequest, "side must be basic or services")
+		return
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	rec, err := reconciliationOf(dataFor(r))
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+
+	list := []reconSide{}
+	for _, s := range []struct {
+		name string
+		rows []ingest.Unmatched
+	}{{reconBasic, rec.BasicOnly}, {reconServices, rec.ServicesOnly}} {
+		if side != "" && side != s.name {
+			continue
+		}
+		for _, u := range s.rows {
+			if (zone == "" || u.Zone == zone) && (school == "" || u.SchoolID == school) {
+				list = append(list, reconSide{Side: s.name, Unmatched: u})
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.SchoolID != b.SchoolID {
+			return a.SchoolID < b.SchoolID
+		}
+		return a.ID < b.ID
+	})
+
+	switch {
+	case q.Get("format") == "csv":
+		rows := make([][]string, 0, len(list))
+		for _, u := range list {
+			rows = append(rows, []string{u.Side, u.Zone, u.SchoolID, u.SchoolName, u.ID, u.Name, u.Designation, strconv.Itoa(u.Row)})
+		}
+		writeCSV(w, r, "reconciliation.csv", []string{"Only In", "Zone", "School ID", "School", "Employee ID", "Name", "Designation", "Row"}, rows)
+	case side != "" || school != "":
+		page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+		items, meta := paginate(list, page, per)
+		writeData(w, items, meta)
+	default:
+		writeData(w, reconSummary(rec, list), nil)
+	}
+}
+
+// reconSummary counts list (sorted by zone and school) by zone and school.
+func reconSummary(rec ingest.Reconciliation, list []reconSide) ReconSummary {
+	sum := ReconSummary{Basic: rec.Basic, Services: rec.Services, Matched: rec.Matched, Zones: []ReconGroup{}, Schools: []ReconGroup{}}
+	for _, u := range list {
+		if n := len(sum.Zones); n == 0 || sum.Zones[n-1].Zone != u.Zone {
+			sum.Zones = append(sum.Zones, ReconGroup{Zone: u.Zone})
+		}
+		if n := len(sum.Schools); n == 0 || sum.Schools[n-1].Zone != u.Zone || sum.Schools[n-1].SchoolID != u.SchoolID {
+			sum.Schools = append(sum.Schools, ReconGroup{Zone: u.Zone, SchoolID: u.SchoolID, SchoolName: u.SchoolName})
+		}
+		z, s := &sum.Zones[len(sum.Zones)-1], &sum.Schools[len(sum.Schools)-1]
+		if u.Side == reconBasic {
+			sum.BasicOnly++
+			z.BasicOnly++
+			s.BasicOnly++
+		} else {
+			sum.ServicesOnly++
+			z.ServicesOnly++
+			s.ServicesOnly++
+		}
+	}
+	return sum
+}
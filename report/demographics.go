@@ -0,0 +1,85 @@
+// Package report derives the dashboard's summaries from model records.
+package report
+
+import (
+	"sort"
+	"strings"
+
+	"myproject/model"
+)
+
+// Demographics is the staff breakdown behind the category and religion
+// tables.
+type Demographics struct {
+	Zones        []model.ZoneDemo // sorted by zone, designations by name
+	CategoryWise map[string]int   // employees per selection category
+	GenderWise   map[string]int   // "Male" and "Female"
+}
+
+// BuildDemographics counts employees per zone and designation by gender,
+// selection category and religion. Employees without a zone or
+// designation are left out; blank categories and religions count as
+// UNKNOWN.
+func BuildDemographics(emp map[string]model.Employee) Demographics {
+	zmap := map[string]map[string]*model.DemoStats{} // zone -> designation -> stats
+	d := Demographics{CategoryWise: map[string]int{}}
+	totalMale, totalFemale := 0, 0
+	for _, e := range emp {
+		if e.Zone == "" || e.Designation == "" {
+			continue
+		}
+		zone := strings.ToUpper(strings.TrimSpace(e.Zone))
+		desig := strings.TrimSpace(e.Designation)
+		cat := e.SelectionCategory
+		if cat == "" {
+			cat = "UNKNOWN"
+		}
+		rel := e.Religion
+		if rel == "" {
+			rel = "UNKNOWN"
+		}
+		g := strings.ToUpper(strings.TrimSpace(e.Gender))
+		isMale, isFemale := g == "MALE" || g == "M", g == "FEMALE" || g == "F"
+
+		if zmap[zone] == nil {
+			zmap[zone] = map[string]*model.DemoStats{}
+		}
+		if zmap[zone][desig] == nil {
+			zmap[zone][desig] = &model.DemoStats{CatStats: map[string]*model.Stat{}, ReligionStats: map[string]*model.Stat{}}
+		}
+		stats := zmap[zone][desig]
+		if stats.CatStats[cat] == nil {
+			stats.CatStats[cat] = &model.Stat{}
+		}
+		if stats.ReligionStats[rel] == nil {
+			stats.ReligionStats[rel] = &model.Stat{}
+		}
+		if isMale {
+			stats.CatStats[cat].Male++
+			stats.ReligionStats[rel].Male++
+			stats.TotalMale++
+			totalMale++
+		}
+		if isFemale {
+			stats.CatStats[cat].Female++
+			stats.ReligionStats[rel].Female++
+			stats.TotalFemale++
+			totalFemale++
+		}
+		stats.Total++
+		d.CategoryWise[cat]++
+	}
+	d.GenderWise = map[string]int{"Male": totalMale, "Female": totalFemale}
+
+	d.Zones = []model.ZoneDemo{}
+	for zone, dm := range zmap {
+		var designations []model.DesignationDemo
+		for dname, st := range dm {
+			designations = append(designations, model.DesignationDemo{Designation: dname, Stats: *st})
+		}
+		sort.Slice(designations, func(i, j int) bool { return designations[i].Designation < designations[j].Designation })
+		d.Zones = append(d.Zones, model.ZoneDemo{Zone: zone, Designations: designations})
+	}
+	sort.Slice(d.Zones, func(i, j int) bool { return d.Zones[i].Zone < d.Zones[j].Zone })
+	return d
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Exam results ----
+//
+// The exam results file (-results, or "results" in a tenant or profile) has
+// one row per school and class: "School ID" or "School Name & ID", "Class",
+// "Appeared" and "Passed", optionally "Distinction" (students with an A
+// grade or 75% and above), "Average %" (the class's mean score) and "Exam"
+// (e.g. "Annual 2025-26"). From them each school gets its pass percentage,
+// the share passing with distinction and the mean score, weighted by the
+// students appearing.
+//
+// The scorecard reports the zone's results next to the scores (not scored,
+// like mid-day meals), with how pass percentages go with the pupil-teacher
+// ratio and with attendance (peak attendance over enrolment) across the
+// zone's schools: Pearson's r, left out below three schools.
+//
+//	GET /api/results[?zone=][&school=][&below=<pass %>][&format=csv]   weakest first
+//	GET /api/results/summary                                         all zones and each zone
+//
+// The page template has {{.Results}} for the overall summary; {{PASS_PCT}}
+// in an older template is its pass percentage.
+
+var resultsCSV = flag.String("results", "", "Exam results CSV with students appeared and passed per school and class (optional)")
+
+// resultsAcc adds up a school's rows, class by class.
+type resultsAcc struct {
+	exam    string
+	classes map[string]*ClassResult
+	scored  map[string][2]float64 // class -> sum of mean × appeared, appeared
+}
+
+// readResults returns the result rows by school id.
+func readResults(path string) (map[string]*resultsAcc, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	out := map[string]*resultsAcc{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sid := ingest.DigitsOnly(ingest.Get(rec, m, "School ID", "School Code"))
+		if sid == "" {
+			sid = ingest.DigitsOnlyKey(ingest.Get(rec, m, "School Name & ID", "School Name"))
+		}
+		appeared := ingest.AtoiSafe(ingest.Get(rec, m, "Appeared", "Students Appeared", "Total Appeared"))
+		if sid == "" || appeared <= 0 {
+			continue
+		}
+		passed := min(ingest.AtoiSafe(ingest.Get(rec, m, "Passed", "Students Passed", "Total Passed")), appeared)
+		dist := min(ingest.AtoiSafe(ingest.Get(rec, m, "Distinction", "A Grade", "Grade A")), passed)
+		a := out[sid]
+		if a == nil {
+			a = &resultsAcc{classes: map[string]*ClassResult{}, scored: map[string][2]float64{}}
+			out[sid] = a
+		}
+		if exam := ingest.Get(rec, m, "Exam", "Term"); exam != "" {
+			a.exam = exam
+		}
+		class := ingest.Get(rec, m, "Class", "Grade")
+		c := a.classes[class]
+		if c == nil {
+			c = &ClassResult{Class: class}
+			a.classes[class] = c
+		}
+		c.Appeared += appeared
+		c.Passed += passed
+		c.Distinction += dist
+		avg := strings.TrimSuffix(ingest.Get(rec, m, "Average %", "Average Score", "Mean Score %", "Average Marks %"), "%")
+		if v, err := strconv.ParseFloat(strings.TrimSpace(avg), 64); err == nil && v >= 0 && v <= 100 {
+			sc := a.scored[class]
+			a.scored[class] = [2]float64{sc[0] + v*float64(appeared), sc[1] + float64(appeared)}
+		}
+	}
+}
+
+// applyResults sets the result fields of every school; rows may be nil.
+func applyResults(sch map[string]School, rows map[string]*resultsAcc) (matched int) {
+	for id, s := range sch {
+		a, ok := rows[id]
+		if !ok {
+			continue
+		}
+		s.HasResults, s.ResultsExam, s.Appeared, s.Passed, s.ClassResults = true, a.exam, 0, 0, nil
+		dist := 0
+		var scoreSum, scoreDen float64
+		for _, class := range sortedKeys(a.classes) {
+			c := *a.classes[class]
+			c.PassPct, c.DistinctionPct = pct1(c.Passed, c.Appeared), pct1(c.Distinction, c.Appeared)
+			if sc := a.scored[class]; sc[1] > 0 {
+				c.AvgScore = round1(sc[0] / sc[1])
+				scoreSum, scoreDen = scoreSum+sc[0], scoreDen+sc[1]
+			}
+			s.Appeared += c.Appeared
+			s.Passed += c.Passed
+			dist += c.Distinction
+			s.ClassResults = append(s.ClassResults, c)
+		}
+		s.PassPct, s.DistinctionPct, s.AvgScore = pct1(s.Passed, s.Appeared), pct1(dist, s.Appeared), 0
+		if scoreDen > 0 {
+			s.AvgScore = round1(scoreSum / scoreDen)
+		}
+		sch[id] = s
+		matched++
+	}
+	return matched
+}
+
+// loadResults reads the exam results CSV (if any) and fills in the school
+// fields.
+func loadResults(sch map[string]School, path string) {
+	var rows map[string]*resultsAcc
+	if path != "" {
+		var err error
+		if rows, err = readResults(path); err != nil {
+			log.Printf("results %s: %v", path, err)
+		}
+	}
+	if n := applyResults(sch, rows); path != "" {
+		log.Printf("📝 Exam results for %d of %d schools (%d in %s)", n, len(sch), len(rows), path)
+	}
+}
+
+// attendancePct is peak attendance as a share of enrolment.
+func attendancePct(s School) float64 {
+	return pct1(s.MaxPresent, s.TotalEnrolment)
+}
+
+// pearson is the correlation of xs and ys; false with fewer than three
+// points or nothing varying.
+func pearson(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	if len(xs) < 3 || len(xs) != len(ys) {
+		return 0, false
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx, my = mx/n, my/n
+	var sxy, sxx, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return math.Round(sxy/math.Sqrt(sxx*syy)*100) / 100, true
+}
+
+type ResultsSummary struct {
+	Zone             string   `json:"zone"`
+	Schools          int      `json:"schools"`
+	Appeared         int      `json:"appeared"`
+	Passed           int      `json:"passed"`
+	PassPct          float64  `json:"pass_pct"`
+	DistinctionPct   float64  `json:"distinction_pct"`
+	AvgScore         float64  `json:"avg_score_pct,omitempty"`
+	PassVsPTR        *float64 `json:"pass_vs_ptr_r,omitempty"`
+	PassVsAttendance *float64 `json:"pass_vs_attendance_r,omitempty"`
+}
+
+// summarizeResults adds up the schools with results, for all zones and by
+// zone.
+func summarizeResults(sch map[string]School, rosters map[string][]Emp) (all ResultsSummary, zones map[string]*ResultsSummary) {
+	type acc struct {
+		sum                *ResultsSummary
+		dist               int
+		scoreSum, scoreDen float64
+		passT, ptr         []float64 // pass % and PTR, of schools with teachers
+		passE, att         []float64 // pass % and attendance, of schools with enrolment
+	}
+	accs := map[string]*acc{}
+	get := func(z string) *acc {
+		if accs[z] == nil {
+			accs[z] = &acc{sum: &ResultsSummary{Zone: z}}
+		}
+		return accs[z]
+	}
+	for id, s := range sch {
+		if !s.HasResults {
+			continue
+		}
+		ptr, dist := schoolStaff(s, rosters[id]).Ratio, 0
+		for _, c := range s.ClassResults {
+			dist += c.Distinction
+		}
+		for _, a := range []*acc{get(allZones), get(s.Zone)} {
+			a.sum.Schools++
+			a.sum.Appeared += s.Appeared
+			a.sum.Passed += s.Passed
+			a.dist += dist
+			if s.AvgScore > 0 {
+				a.scoreSum += s.AvgScore * float64(s.Appeared)
+				a.scoreDen += float64(s.Appeared)
+			}
+			if ptr > 0 {
+				a.passT = append(a.passT, s.PassPct)
+				a.ptr = append(a.ptr, ptr)
+			}
+			if s.TotalEnrolment > 0 {
+				a.passE = append(a.passE, s.PassPct)
+				a.att = append(a.att, attendancePct(s))
+			}
+		}
+	}
+	zones = map[string]*ResultsSummary{}
+	for z, a := range accs {
+		a.sum.PassPct, a.sum.DistinctionPct = pct1(a.sum.Passed, a.sum.Appeared), pct1(a.dist, a.sum.Appeared)
+		if a.scoreDen > 0 {
+			a.sum.AvgScore = round1(a.scoreSum / a.scoreDen)
+		}
+		if r, ok := pearson(a.passT, a.ptr); ok {
+			a.sum.PassVsPTR = &r
+		}
+		if r, ok := pearson(a.passE, a.att); ok {
+			a.sum.PassVsAttendance = &r
+		}
+		if z == allZones {
+			all = *a.sum
+		} else {
+			zones[z] = a.sum
+		}
+	}
+	if all.Zone == "" {
+		all.Zone = allZones
+	}
+	return all, zones
+}
+
+type SchoolResults struct {
+	SchoolID       string        `json:"school_id"`
+	Name           string        `json:"name"`
+	Zone           string        `json:"zone"`
+	Exam           string        `json:"exam,omitempty"`
+	Appeared       int           `json:"appeared"`
+	Passed         int           `json:"passed"`
+	PassPct        float64       `json:"pass_pct"`
+	DistinctionPct float64       `json:"distinction_pct"`
+	AvgScore       float64       `json:"avg_score_pct,omitempty"`
+	PTR            float64       `json:"ptr"`
+	AttendancePct  float64       `json:"attendance_pct"`
+	Classes        []ClassResult `json:"classes"`
+}
+
+// GET /api/results
+func handleAPIResults(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	ds, q := dataFor(r), r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	school := strings.TrimSpace(q.Get("school"))
+	below := math.Inf(1)
+	if s := q.Get("below"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 100 {
+			writeError(w, 400, errBadRequest, "below must be a pass percentage 0-100")
+			return
+		}
+		below = v
+	}
+	rosters := rosterBySchool(ds.EMP)
+	list := []SchoolResults{}
+	for id, s := range ds.SCH {
+		if !s.HasResults || (zone != "" && s.Zone != zone) || (school != "" && id != school) || s.PassPct >= below {
+			continue
+		}
+		list = append(list, SchoolResults{SchoolID: id, Name: s.Name, Zone: s.Zone, Exam: s.ResultsExam,
+			Appeared: s.Appeared, Passed: s.Passed, PassPct: s.PassPct, DistinctionPct: s.DistinctionPct, AvgScore: s.AvgScore,
+			PTR: round1(schoolStaff(s, rosters[id]).Ratio), AttendancePct: attendancePct(s), Classes: s.ClassResults})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].PassPct != list[j].PassPct {
+			return list[i].PassPct < list[j].PassPct
+		}
+		return list[i].SchoolID < list[j].SchoolID
+	})
+	if q.Get("format") == "csv" {
+		f := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+		rows := make([][]string, 0, len(list))
+		for _, s := range list {
+			rows = append(rows, []string{s.SchoolID, s.Name, s.Zone, s.Exam, strconv.Itoa(s.Appeared), strconv.Itoa(s.Passed),
+				f(s.PassPct), f(s.DistinctionPct), f(s.AvgScore), f(s.PTR), f(s.AttendancePct)})
+		}
+		writeCSV(w, r, "results.csv", []string{"School ID", "School", "Zone", "Exam", "Appeared", "Passed", "Pass %",
+			"Distinction %", "Average Score %", "PTR", "Attendance %"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// GET /api/results/summary
+func handleAPIResultsSummary(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	ds := dataFor(r)
+	all, zones := summarizeResults(ds.SCH, rosterBySchool(ds.EMP))
+	if all.Schools == 0 {
+		writeError(w, 404, errNotFound, "no exam results are configured (-results)")
+		return
+	}
+	list := make([]ResultsSummary, 0, len(zones))
+	for _, z := range sortedKeys(zones) {
+		list = append(list, *zones[z])
+	}
+	writeData(w, map[string]any{"all": all, "zones": list}, nil)
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Retention and purge ----
+//
+// Records are kept for the departmental retention periods, in days (0 =
+// forever, the default):
+//
+//	-retain-email-log    the email log (emaillog.go)
+//	-retain-audit        the audit trail: employee change history, the
+//	                     campaign send/open/reply logs, the send ledger and
+//	                     the retirement alert log
+//	-retain-snapshots    tagged build snapshots, by when they were taken
+//	-retain-quarantine   mails given up on, left in -mail-spool for a retry
+//
+// The monthly archive (archive.go) is kept for good.
+//
+// The leader purges on -purge-schedule (a cron expression read in
+// -schedule-tz). Log lines are dropped by their "at" time; a line without
+// one is kept. Every run, scheduled or not, is appended to -purge-report:
+//
+//	GET  /api/purge/report[?page=]      past runs, newest first
+//	POST /api/purge[?dry_run=1]         purge now (dry_run counts only)
+//	mcd purge [-dry-run] [tenant]
+
+var (
+	retainEmailLog   = flag.Int("retain-email-log", 0, "Days to keep email log entries (0 = forever)")
+	retainAudit      = flag.Int("retain-audit", 0, "Days to keep the audit trail: change history, send/open/reply logs, send ledger, retirement log (0 = forever)")
+	retainSnapshots  = flag.Int("retain-snapshots", 0, "Days to keep tagged snapshots (0 = forever)")
+	retainQuarantine = flag.Int("retain-quarantine", 0, "Days to keep mails given up on in -mail-spool (0 = forever)")
+	purgeSchedule    = flag.String("purge-schedule", "30 2 * * *", "Cron expression for the retention purge (empty = only on request)")
+	purgeReportFile  = flag.String("purge-report", "./out/purge-report.jsonl", "Log of every retention purge and what it removed")
+)
+
+const (
+	purgeEmailLog   = "email_log"
+	purgeAudit      = "audit"
+	purgeSnapshots  = "snapshots"
+	purgeQuarantine = "quarantine"
+)
+
+// PurgeItem is what one run did to one file or directory.
+type PurgeItem struct {
+	Tenant  string    `json:"tenant,omitempty"`
+	Kind    string    `json:"kind"`
+	Path    string    `json:"path"`
+	Before  time.Time `json:"before"` // records older than this go
+	Removed int       `json:"removed"`
+	Kept    int       `json:"kept"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type PurgeRun struct {
+	At      time.Time   `json:"at"`
+	By      string      `json:"by"` // "schedule", a user or "command"
+	DryRun  bool        `json:"dry_run,omitempty"`
+	Removed int         `json:"removed"`
+	Items   []PurgeItem `json:"items"`
+}
+
+// retentionCutoff is the oldest time days of retention keep, or zero when
+// they keep everything.
+func retentionCutoff(now time.Time, days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// purgeJSONL drops the lines of path whose "at" is before cutoff, holding
+// the tracking lock so no append is lost.
+func purgeJSONL(path string, cutoff time.Time, dry bool) (removed, kept int, err error) {
+	trackMu.Lock()
+	defer trackMu.Unlock()
+	return purgeLines(path, cutoff, dry)
+}
+
+// purgeLines does the work of purgeJSONL; callers hold whatever lock
+// guards appends to path.
+func purgeLines(path string, cutoff time.Time, dry bool) (removed, kept int, err error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var out bytes.Buffer
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var rec struct {
+			At time.Time `json:"at"`
+		}
+		if json.Unmarshal(sc.Bytes(), &rec) == nil && !rec.At.IsZero() && rec.At.Before(cutoff) {
+			removed++
+			continue
+		}
+		kept++
+		out.Write(sc.Bytes())
+		out.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return 0, 0, err
+	}
+	if dry || removed == 0 {
+		return removed, kept, nil
+	}
+	if err := os.WriteFile(path+".tmp", out.Bytes(), 0644); err != nil {
+		return 0, 0, err
+	}
+	return removed, kept, os.Rename(path+".tmp", path)
+}
+
+// Purge drops history entries from before cutoff, on disk and in memory.
+func (h *empHistory) Purge(cutoff time.Time, dry bool) (removed, kept int, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	removed, kept, err = purgeLines(filepath.Join(h.dir, "history.jsonl"), cutoff, dry)
+	if err != nil || dry {
+		return
+	}
+	for id, es := range h.byEmp {
+		left := es[:0]
+		for _, e := range es {
+			if !e.At.Before(cutoff) {
+				left = append(left, e)
+			}
+		}
+		if len(left) == 0 {
+			delete(h.byEmp, id)
+		} else {
+			h.byEmp[id] = left
+		}
+	}
+	return
+}
+
+// purgeSnapshotDir removes the tagged snapshots in dir taken before cutoff;
+// the digest's baseline (digest.go) isn't a tag and stays.
+func purgeSnapshotDir(dir string, cutoff time.Time, dry bool) (removed, kept int, err error) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, p := range files {
+		if !rxSnapshotTag.MatchString(strings.TrimSuffix(filepath.Base(p), ".json")) {
+			continue
+		}
+		var s Snapshot
+		b, rerr := os.ReadFile(p)
+		if rerr != nil || json.Unmarshal(b, &s) != nil || s.CreatedAt.IsZero() || !s.CreatedAt.Before(cutoff) {
+			kept++
+			continue
+		}
+		if !dry {
+			if err = os.Remove(p); err != nil {
+				return
+			}
+		}
+		removed++
+	}
+	return
+}
+
+// purgeQuarantined removes the mails of tenant ("" = HQ mail) given up on
+// before cutoff, from the spool and the queue.
+func purgeQuarantined(tenant string, cutoff time.Time, dry bool) (removed, kept int, err error) {
+	mailq.Lock()
+	defer mailq.Unlock()
+	files, _ := filepath.Glob(filepath.Join(*mailSpool, "*.json"))
+	for _, p := range files {
+		var m QueuedMail
+		b, rerr := os.ReadFile(p)
+		if rerr != nil || json.Unmarshal(b, &m) != nil || m.Tenant != tenant || !m.Failed {
+			continue
+		}
+		if !m.Queued.Before(cutoff) {
+			kept++
+			continue
+		}
+		if !dry {
+			if err = os.Remove(p); err != nil {
+				return
+			}
+			delete(mailq.mails, m.ID)
+		}
+		removed++
+	}
+	return
+}
+
+// auditTrail lists t's audit trail logs appended through appendJSONL.
+func auditTrail(t *Tenant) []string {
+	var out []string
+	if t.TrackingDir != "" {
+		for _, name := range []string{"sends.jsonl", "opens.jsonl", "inbound.jsonl"} {
+			out = append(out, filepath.Join(t.TrackingDir, name))
+		}
+	}
+	for _, p := range []string{t.SendLedger, t.RetirementLog} {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// purgeTenant applies the retention periods to t's records.
+func purgeTenant(t *Tenant, now time.Time, dry bool) []PurgeItem {
+	var items []PurgeItem
+	add := func(kind, path string, cutoff time.Time, removed, kept int, err error) {
+		it := PurgeItem{Tenant: t.ID, Kind: kind, Path: path, Before: cutoff, Removed: removed, Kept: kept}
+		if err != nil {
+			it.Error = err.Error()
+			log.Printf("purge %s %s: %v", kind, path, err)
+		}
+		items = append(items, it)
+	}
+	if cut := retentionCutoff(now, *retainEmailLog); !cut.IsZero() && t.EmailLog != "" {
+		n, k, err := purgeJSONL(t.EmailLog, cut, dry)
+		add(purgeEmailLog, t.EmailLog, cut, n, k, err)
+	}
+	if cut := retentionCutoff(now, *retainAudit); !cut.IsZero() {
+		for _, p := range auditTrail(t) {
+			n, k, err := purgeJSONL(p, cut, dry)
+			add(purgeAudit, p, cut, n, k, err)
+		}
+		if t.HistoryDir != "" {
+			t.historyOnce.Do(func() { t.history = openHistory(t.HistoryDir) })
+			n, k, err := t.history.Purge(cut, dry)
+			add(purgeAudit, filepath.Join(t.HistoryDir, "history.jsonl"), cut, n, k, err)
+		}
+	}
+	if cut := retentionCutoff(now, *retainSnapshots); !cut.IsZero() && t.SnapshotDir != "" {
+		n, k, err := purgeSnapshotDir(t.SnapshotDir, cut, dry)
+		add(purgeSnapshots, t.SnapshotDir, cut, n, k, err)
+	}
+	if cut := retentionCutoff(now, *retainQuarantine); !cut.IsZero() && *mailSpool != "" {
+		n, k, err := purgeQuarantined(t.ID, cut, dry)
+		add(purgeQuarantine, *mailSpool, cut, n, k, err)
+	}
+	return items
+}
+
+// runPurge purges every tenant in tenants (and HQ mail with them), records
+// the run in -purge-report unless nothing has a retention period, and
+// returns it.
+func runPurge(tenants []*Tenant, by string, dry bool) PurgeRun {
+	now := time.Now()
+	run := PurgeRun{At: now, By: by, DryRun: dry, Items: []PurgeItem{}}
+	for _, t := range tenants {
+		run.Items = append(run.Items, purgeTenant(t, now, dry)...)
+	}
+	if cut := retentionCutoff(now, *retainQuarantine); !cut.IsZero() && *mailSpool != "" {
+		n, k, err := purgeQuarantined("", cut, dry)
+		it := PurgeItem{Kind: purgeQuarantine, Path: *mailSpool, Before: cut, Removed: n, Kept: k}
+		if err != nil {
+			it.Error = err.Error()
+		}
+		run.Items = append(run.Items, it)
+	}
+	for _, it := range run.Items {
+		run.Removed += it.Removed
+	}
+	if len(run.Items) == 0 {
+		return run
+	}
+	if *purgeReportFile != "" {
+		if err := appendJSONL(*purgeReportFile, run); err != nil {
+			log.Printf("purge report %s: %v", *purgeReportFile, err)
+		}
+	}
+	verb := "removed"
+	if dry {
+		verb = "would remove"
+	}
+	log.Printf("🧹 Retention purge by %s: %s %d record(s) across %d file(s)", by, verb, run.Removed, len(run.Items))
+	return run
+}
+
+// retentionNote describes the periods in force, for logs and the CLI.
+func retentionNote() string {
+	var parts []string
+	for _, p := range []struct {
+		kind string
+		days int
+	}{{purgeEmailLog, *retainEmailLog}, {purgeAudit, *retainAudit}, {purgeSnapshots, *retainSnapshots}, {purgeQuarantine, *retainQuarantine}} {
+		if p.days > 0 {
+			parts = append(parts, fmt.Sprintf("%s %dd", p.kind, p.days))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// startPurgeSchedule purges on -purge-schedule on the leader; it fails on a
+// bad expression.
+func startPurgeSchedule() error {
+	if strings.TrimSpace(*purgeSchedule) == "" || retentionNote() == "" {
+		return nil
+	}
+	spec, err := parseCron(*purgeSchedule)
+	if err != nil {
+		return fmt.Errorf("-purge-schedule: %v", err)
+	}
+	loc, err := scheduleLocation()
+	if err != nil {
+		return fmt.Errorf("-schedule-tz: %v", err)
+	}
+	log.Printf("🧹 Retention purge (%s) scheduled %q (%s)", retentionNote(), *purgeSchedule, loc)
+	runOnSchedule(spec, loc, func(time.Time) { runPurge(TENANTS, "schedule", false) })
+	return nil
+}
+
+// POST /api/purge[?dry_run=1]
+func handlePurge(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	if retentionNote() == "" {
+		writeError(w, 409, errConflict, "no retention period is set")
+		return
+	}
+	dry := r.URL.Query().Get("dry_run") == "1"
+	writeData(w, runPurge([]*Tenant{tenantFor(r)}, userFor(r).Name, dry), nil)
+}
+
+// GET /api/purge/report
+func handlePurgeReport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	id := tenantFor(r).ID
+	var runs []PurgeRun
+	readJSONL(*purgeReportFile, func(run PurgeRun) {
+		items := run.Items[:0]
+		run.Removed = 0
+		for _, it := range run.Items {
+			if it.Tenant == id || it.Tenant == "" {
+				items = append(items, it)
+				run.Removed += it.Removed
+			}
+		}
+		if len(items) > 0 {
+			run.Items = items
+			runs = append(runs, run)
+		}
+	})
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].At.After(runs[j].At) })
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	list, meta := paginate(runs, page, per)
+	writeData(w, list, meta)
+}
+
+// cmdPurge is the purge subcommand: one run over the tenant named in
+// flag.Args(), or all of them.
+func cmdPurge([]string) error {
+	if retentionNote() == "" {
+		return fmt.Errorf("no retention period is set (-retain-email-log, -retain-audit, -retain-snapshots, -retain-quarantine)")
+	}
+	applyChdir()
+	tenants, err := commandTenants(flag.Args())
+	if err != nil {
+		return err
+	}
+	run := runPurge(tenants, "command", *dryRun)
+	for _, it := range run.Items {
+		line := fmt.Sprintf("%-10s %-12s %s: %d removed, %d kept", it.Tenant, it.Kind, it.Path, it.Removed, it.Kept)
+		if it.Error != "" {
+			line += " (" + it.Error + ")"
+		}
+		fmt.Println(line)
+	}
+	mode := ""
+	if *dryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("%d record(s) older than the retention periods (%s)%s\n", run.Removed, retentionNote(), mode)
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Retirements ----
+//
+// An employee superannuates on the last day of the month they reach their
+// retirement age (the month before, for those born on the 1st). The age is
+// -retirement-age unless -retirement-ages gives one for their designation:
+// designation substrings, matched case-insensitively, the longest winning:
+//
+//	-retirement-ages "teacher=62,principal=62,special educator=62"
+//
+// With -retirement-notice N the server mails, once a day, everyone retiring
+// within N months who hasn't been told yet: the employee, their school's
+// head (escalation.go) and the zone office (its zone head accounts, else
+// its mailbox). Alerts sent are kept in -retirement-log, so each retirement
+// is announced once; in dry-run mode the mails are only logged and nothing
+// is recorded.
+//
+//	GET /api/retirements[?months=6][&zone=][&format=csv]
+//	mcd retirement-alerts [tenant]          the daily run, for cron
+
+var (
+	retirementAge     = flag.Int("retirement-age", 60, "Retirement (superannuation) age")
+	retirementAges    = flag.String("retirement-ages", "teacher=62,principal=62,special educator=62", "Retirement ages by designation: comma-separated designation-substring=age pairs overriding -retirement-age")
+	retirementNotice  = flag.Int("retirement-notice", 0, "Months ahead to alert employees, school heads and zone offices of retirements (0 = no alerts)")
+	retirementLogFile = flag.String("retirement-log", "./out/retirement-alerts.jsonl", "Record of the retirement alerts sent")
+)
+
+type retirementAgeRule struct {
+	match string // lower case
+	age   int
+}
+
+// parseRetirementAges parses -retirement-ages, longest match first.
+func parseRetirementAges(s string) ([]retirementAgeRule, error) {
+	var rules []retirementAgeRule
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(part, "=")
+		age, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || strings.TrimSpace(k) == "" || err != nil || age < 50 || age > 75 {
+			return nil, fmt.Errorf("%q: want designation=age (50-75)", part)
+		}
+		rules = append(rules, retirementAgeRule{strings.ToLower(strings.TrimSpace(k)), age})
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return len(rules[i].match) > len(rules[j].match) })
+	return rules, nil
+}
+
+func retirementAgeFor(designation string, rules []retirementAgeRule) int {
+	d := strings.ToLower(designation)
+	for _, r := range rules {
+		if strings.Contains(d, r.match) {
+			return r.age
+		}
+	}
+	return *retirementAge
+}
+
+// retirementAgesNote describes the ages in force, for reports.
+func retirementAgesNote() string {
+	note := "age " + strconv.Itoa(*retirementAge)
+	if strings.TrimSpace(*retirementAges) != "" {
+		note += "; " + *retirementAges
+	}
+	return note
+}
+
+// retirementDate is the superannuation date of someone born on dob.
+func retirementDate(dob time.Time, age int) time.Time {
+	t := dob.AddDate(age, 0, 0)
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if dob.Day() == 1 {
+		return first.AddDate(0, 0, -1)
+	}
+	return first.AddDate(0, 1, -1)
+}
+
+type Retirement struct {
+	EmpID       string    `json:"emp_id"`
+	Name        string    `json:"name"`
+	Designation string    `json:"designation"`
+	Zone        string    `json:"zone"`
+	SchoolID    string    `json:"school_id"`
+	School      string    `json:"school"`
+	DOB         string    `json:"dob"`
+	Age         int       `json:"retirement_age"`
+	RetiresOn   time.Time `json:"-"`
+	Date        string    `json:"retires_on"` // YYYY-MM-DD
+	DaysLeft    int       `json:"days_left"`
+	Alerted     string    `json:"alerted,omitempty"` // YYYY-MM-DD
+}
+
+// upcomingRetirements lists who retires from from's day until until,
+// soonest first.
+func upcomingRetirements(ds *Dataset, from, until time.Time) []Retirement {
+	rules, err := parseRetirementAges(*retirementAges)
+	if err != nil {
+		log.Printf("-retirement-ages: %v", err)
+	}
+	day := dayOf(from)
+	out := []Retirement{}
+	for _, e := range ds.EMP {
+		dob, err := ingest.ParseDMYFlexible(e.DOB)
+		if err != nil {
+			continue
+		}
+		age := retirementAgeFor(e.Designation, rules)
+		at := retirementDate(dob, age)
+		if at.Before(day) || !at.Before(until) {
+			continue
+		}
+		out = append(out, Retirement{EmpID: e.ID, Name: e.Name, Designation: e.Designation, Zone: e.Zone,
+			SchoolID: e.SchoolID, School: e.SchoolName, DOB: e.DOB, Age: age, RetiresOn: at,
+			Date: at.Format("2006-01-02"), DaysLeft: int(at.Sub(day).Hours() / 24)})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].RetiresOn.Equal(out[j].RetiresOn) {
+			return out[i].RetiresOn.Before(out[j].RetiresOn)
+		}
+		return out[i].EmpID < out[j].EmpID
+	})
+	return out
+}
+
+type RetirementAlert struct {
+	EmpID     string    `json:"emp_id"`
+	RetiresOn string    `json:"retires_on"`
+	To        []string  `json:"to"`
+	At        time.Time `json:"at"`
+}
+
+// retirementAlerted is who t has told about which retirement: emp id and
+// date to the day the alert went.
+func retirementAlerted(t *Tenant) map[string]string {
+	out := map[string]string{}
+	if t.RetirementLog != "" {
+		readJSONL(t.RetirementLog, func(a RetirementAlert) {
+			out[a.EmpID+"|"+a.RetiresOn] = a.At.Format("2006-01-02")
+		})
+	}
+	return out
+}
+
+// sendRetirementAlerts mails everyone due an alert and returns how many
+// retirements were announced.
+func sendRetirementAlerts(t *Tenant, ds *Dataset, now time.Time) int {
+	if *retirementNotice <= 0 {
+		return 0
+	}
+	told := retirementAlerted(t)
+	esc := html.EscapeString
+	n := 0
+	for _, r := range upcomingRetirements(ds, now, now.AddDate(0, *retirementNotice, 0)) {
+		if told[r.EmpID+"|"+r.Date] != "" {
+			continue
+		}
+		e := ds.EMP[r.EmpID]
+		from := t.senderFor(e.Zone)
+		when := r.RetiresOn.Format("02 January 2006")
+		var to []string
+		if e.Email != "" && t.prefs().Allows(e.ID, channelEmail) {
+			body := fmt.Sprintf(`<p>%s,</p><p>Our records show that you superannuate on <b>%s</b>, on reaching the age of %d. `+
+				`Please begin your pension and retirement formalities with your school and zone office in good time, and let them know if the date is wrong.</p><p>%s</p>`,
+				esc(salutation(e)), when, r.Age, esc(from.Name))
+			if err := queueMailFor(t, "", e.ID, from, "", e.Email, "Your retirement on "+when, body); err != nil {
+				log.Printf("retirement alert %s to %s: %v", e.ID, e.Email, err)
+			} else {
+				to = append(to, e.Email)
+			}
+		}
+		office := map[string]bool{}
+		if h, ok := ds.HEADS[e.SchoolID]; ok && h.Email != "" && h.EmpID != e.ID {
+			office[strings.ToLower(h.Email)] = true
+		}
+		heads := t.zoneHeads(e.Zone)
+		for _, u := range heads {
+			if u.Email != "" {
+				office[strings.ToLower(u.Email)] = true
+			}
+		}
+		if len(heads) == 0 {
+			if box := t.zoneMailbox(e.Zone); box != "" {
+				office[strings.ToLower(box)] = true
+			}
+		}
+		delete(office, strings.ToLower(e.Email))
+		subject := fmt.Sprintf("Retirement on %s: %s (%s)", when, e.Name, e.ID)
+		body := fmt.Sprintf(`<p>%s (%s), %s at %s, zone %s, superannuates on <b>%s</b> (born %s, retirement age %d).</p>`+
+			`<p>Please start the pension papers, the no-dues and service book updates, and plan for the post falling vacant.</p>`,
+			esc(e.Name), esc(e.ID), esc(e.Designation), esc(e.SchoolName), esc(e.Zone), when, esc(e.DOB), r.Age)
+		for _, a := range sortedKeys(office) {
+			if err := queueMailFor(t, "", e.ID, from, "", a, subject, body); err != nil {
+				log.Printf("retirement alert %s to %s: %v", e.ID, a, err)
+				continue
+			}
+			to = append(to, a)
+		}
+		n++
+		if !t.live() {
+			continue
+		}
+		if err := appendJSONL(t.RetirementLog, RetirementAlert{EmpID: e.ID, RetiresOn: r.Date, To: to, At: now}); err != nil {
+			log.Printf("retirement log %s: %v", t.RetirementLog, err)
+		}
+	}
+	if n > 0 {
+		log.Printf("🎓 Retirement alerts for %s: %d retirement(s) within %d month(s)", t.ID, n, *retirementNotice)
+	}
+	return n
+}
+
+// startRetirementAlerts sends each day's alerts on the leader; it fails on
+// a bad -retirement-ages.
+func startRetirementAlerts() error {
+	if _, err := parseRetirementAges(*retirementAges); err != nil {
+		return fmt.Errorf("-retirement-ages: %v", err)
+	}
+	if *retirementNotice <= 0 {
+		return nil
+	}
+	log.Printf("🎓 Retirement alerts %d month(s) ahead", *retirementNotice)
+	go func() {
+		last := ""
+		for ; ; time.Sleep(time.Hour) {
+			now := time.Now()
+			if now.Format("2006-01-02") == last || !isLeader() {
+				continue
+			}
+			last = now.Format("2006-01-02")
+			for _, t := range TENANTS {
+				if ds := t.Data(); ds != nil {
+					sendRetirementAlerts(t, ds, now)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// GET /api/retirements
+func handleRetirements(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	months := reviewMonthsDef
+	if s := q.Get("months"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 60 {
+			writeError(w, 400, errBadRequest, "months must be 1-60")
+			return
+		}
+		months = n
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	t, now := tenantFor(r), time.Now()
+	told := retirementAlerted(t)
+	list := []Retirement{}
+	for _, rt := range upcomingRetirements(dataFor(r), now, now.AddDate(0, months, 0)) {
+		if zone == "" || rt.Zone == zone {
+			rt.Alerted = told[rt.EmpID+"|"+rt.Date]
+			list = append(list, rt)
+		}
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, rt := range list {
+			rows = append(rows, []string{rt.EmpID, rt.Name, rt.Designation, rt.Zone, rt.SchoolID, rt.School, rt.DOB,
+				strconv.Itoa(rt.Age), rt.Date, strconv.Itoa(rt.DaysLeft), rt.Alerted})
+		}
+		writeCSV(w, r, "retirements.csv", []string{"Employee ID", "Name", "Designation", "Zone", "School ID", "School",
+			"Date of Birth", "Retirement Age", "Retires On", "Days Left", "Alerted On"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// cmdRetirementAlerts is the retirement-alerts subcommand: today's alerts
+// for one tenant or all.
+func cmdRetirementAlerts([]string) error {
+	if *retirementNotice <= 0 {
+		return fmt.Errorf("-retirement-notice is not set")
+	}
+	if _, err := parseRetirementAges(*retirementAges); err != nil {
+		return fmt.Errorf("-retirement-ages: %v", err)
+	}
+	if *dryRun {
+		LiveMode = false
+	}
+	applyChdir()
+	tenants, err := commandTenants(flag.Args())
+	if err != nil {
+		return err
+	}
+	if err := buildTenants(tenants); err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		mode := "dry run"
+		if t.live() {
+			mode = "live"
+		}
+		n := sendRetirementAlerts(t, t.Data(), time.Now())
+		fmt.Printf("%s: %d retirement(s) announced (%s)\n", t.ID, n, mode)
+	}
+	return nil
+}
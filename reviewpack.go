@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Monthly review pack ----
+//
+// One XLSX with the sheets assembled by hand before every Commissioner
+// review: zone summary, DBT laggards, staffing gaps, classroom shortage
+// (with -infra), joiners, exits, upcoming retirements and the insights
+// (insights.go).
+//
+//	GET /api/reviewpack[?since=YYYY-MM-DD][&months=6]
+//	mcd-dashboard review-pack <out.xlsx> [tenant-id]
+//
+// since (default: one month back) bounds joiners and exits; months is how
+// far ahead retirements are listed.
+
+const (
+	reviewLaggards  = 100
+	reviewMonthsDef = 6
+)
+
+func yesNo(b bool) string {
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+func reviewPack(t *Tenant, ds *Dataset, since time.Time, months int) *xlsxBook {
+	b := &xlsxBook{}
+
+	zs := b.Sheet("Zone Summary", "Zone", "Schools", "Employees", "Teachers", "Needed Teachers", "Vacancies", "Surplus",
+		"Schools w/o Principal", "Enrolment", "PTR", "Aadhaar %", "Account %", "DBT %", "Classrooms Needed", "Classrooms",
+		"Classroom Shortage", "Schools Short of Rooms", "Rank", "Score")
+	zones := []string{}
+	for z := range ds.ZONE_KPI {
+		if z != allZones {
+			zones = append(zones, z)
+		}
+	}
+	sort.Strings(zones)
+	for _, z := range append(zones, allZones) {
+		k := ds.ZONE_KPI[z]
+		zs.Row(k.Zone, k.Schools, k.Employees, k.Teachers, k.NeededTeachers, k.Vacancies, k.Surplus,
+			k.WithoutPrincipal, k.Enrolment, k.PTR, k.AadhaarPct, k.AccountPct, k.DBTPct, k.NeededRooms, k.Classrooms,
+			k.RoomShortage, k.SchoolsShortRoom, k.Rank, k.Score)
+	}
+
+	schools := make([]School, 0, len(ds.SCH))
+	for _, s := range ds.SCH {
+		if s.TotalEnrolment > 0 {
+			schools = append(schools, s)
+		}
+	}
+	sort.Slice(schools, func(i, j int) bool {
+		pi, pj := pct1(schools[i].DBTTotal, schools[i].TotalEnrolment), pct1(schools[j].DBTTotal, schools[j].TotalEnrolment)
+		if pi != pj {
+			return pi < pj
+		}
+		return schools[i].TotalEnrolment > schools[j].TotalEnrolment
+	})
+	dl := b.Sheet("DBT Laggards", "School ID", "School", "Zone", "Enrolment", "DBT Total", "DBT %", "Aadhaar %", "Account %")
+	for i, s := range schools {
+		if i == reviewLaggards {
+			break
+		}
+		dl.Row(s.ID, s.Name, s.Zone, s.TotalEnrolment, s.DBTTotal, pct1(s.DBTTotal, s.TotalEnrolment),
+			pct1(s.WithAadhaar, s.TotalEnrolment), pct1(s.WithAccount, s.TotalEnrolment))
+	}
+
+	rosters := rosterBySchool(ds.EMP)
+	var gaps []SchoolStaff
+	for id, s := range ds.SCH {
+		st := schoolStaff(s, rosters[id])
+		if st.SurplusVacancy < 0 || !st.HasPrincipal {
+			gaps = append(gaps, st)
+		}
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].SurplusVacancy != gaps[j].SurplusVacancy {
+			return gaps[i].SurplusVacancy < gaps[j].SurplusVacancy
+		}
+		return gaps[i].ID < gaps[j].ID
+	})
+	sg := b.Sheet("Staffing Gaps", "School ID", "School", "Zone", "Needed Teachers", "Actual Teachers", "Vacancy",
+		"Principal", "Special Educator", "Total Staff", "PTR")
+	for _, g := range gaps {
+		vac := 0
+		if g.SurplusVacancy < 0 {
+			vac = -g.SurplusVacancy
+		}
+		sg.Row(g.ID, g.Name, g.Zone, g.NeededTeachers, g.ActualTeachers, vac, yesNo(g.HasPrincipal),
+			yesNo(g.HasSpecialEdu), g.TotalStaff, float64(int(g.Ratio*10+0.5))/10)
+	}
+
+	if ds.ZONE_KPI[allZones].SchoolsWithRooms > 0 {
+		cs := b.Sheet("Classroom Shortage", "School ID", "School", "Zone", "Enrolment", "Classrooms Needed", "Classrooms", "Shortage")
+		for _, s := range shortSchools(ds.SCH, "") {
+			cs.Row(s.ID, s.Name, s.Zone, s.TotalEnrolment, s.NeededClassrooms, s.Classrooms, s.ClassroomShortage)
+		}
+	}
+
+	var hist []HistoryEntry
+	if t.history != nil {
+		hist = t.history.Since(since)
+	}
+	empRow := func(e Emp) []any {
+		return []any{e.ID, e.Name, e.Designation, e.Zone, e.SchoolID, e.SchoolName}
+	}
+	jn := b.Sheet("Joiners", "Employee ID", "Name", "Designation", "Zone", "School ID", "School", "Date of Joining", "Source")
+	joined := map[string]bool{}
+	var joiners []Emp
+	for _, e := range ds.EMP {
+		if d, err := ingest.ParseDMYFlexible(e.DOJ); err == nil && !d.Before(since) {
+			joiners = append(joiners, e)
+			joined[e.ID] = true
+		}
+	}
+	sort.Slice(joiners, func(i, j int) bool { return joiners[i].ID < joiners[j].ID })
+	for _, e := range joiners {
+		jn.Row(append(empRow(e), e.DOJ, "date of joining")...)
+	}
+	ex := b.Sheet("Exits", "Employee ID", "Removed On", "Last Designation", "Last Zone", "Last School ID")
+	for _, h := range hist {
+		if h.Field != historyRecord {
+			continue
+		}
+		switch h.To {
+		case "added":
+			if e, ok := ds.EMP[h.EmpID]; ok && !joined[h.EmpID] {
+				joined[h.EmpID] = true
+				jn.Row(append(empRow(e), e.DOJ, "new in HR export "+h.At.Format("02 Jan 2006"))...)
+			}
+		case "removed":
+			last := map[string]string{}
+			if t.history != nil {
+				for _, p := range t.history.For(h.EmpID) {
+					if p.Field != historyRecord {
+						last[p.Field] = p.To
+					}
+				}
+			}
+			ex.Row(h.EmpID, h.At.Format("02 Jan 2006"), last["designation"], last["zone"], last["school_id"])
+		}
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, months, 0)
+	rs := b.Sheet("Retirements", "Employee ID", "Name", "Designation", "Zone", "School ID", "School", "Date of Birth", "Retires On")
+	for _, r := range upcomingRetirements(ds, now, until) {
+		rs.Row(append(empRow(ds.EMP[r.EmpID]), r.DOB, r.RetiresOn.Format("02 Jan 2006"))...)
+	}
+
+	is := b.Sheet("Insights", "Insight", "Indicator", "Against", "r", "Schools", "Strength")
+	for _, in := range buildInsights(ds, "") {
+		is.Row(in.Text, schoolIndicators[in.X].Label, schoolIndicators[in.Y].Label, in.R, in.Schools, in.Strength)
+	}
+
+	about := b.Sheet("About", "Item", "Value")
+	about.Row("Report", t.PageTitle()+" monthly review pack")
+	about.Row("Data as of", ds.BuiltAt.Format("02 Jan 2006 15:04"))
+	if ds.Profile != "" {
+		about.Row("Profile", ds.Profile)
+	}
+	about.Row("Joiners/exits since", since.Format("02 Jan 2006"))
+	about.Row("Retirements until", until.Format("02 Jan 2006")+" ("+retirementAgesNote()+")")
+	about.Row("DBT laggards", fmt.Sprintf("lowest %d schools by DBT coverage", reviewLaggards))
+	about.Row("Classroom norm", fmt.Sprintf("%d students per classroom", *classSize))
+	about.Row("Generated", now.Format("02 Jan 2006 15:04"))
+	return b
+}
+
+func reviewParams(q map[string][]string) (since time.Time, months int, err error) {
+	get := func(k string) string {
+		if v := q[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	since = time.Now().AddDate(0, -1, 0).Truncate(24 * time.Hour)
+	if s := get("since"); s != "" {
+		if since, err = time.Parse("2006-01-02", s); err != nil {
+			return since, 0, fmt.Errorf("since must be YYYY-MM-DD")
+		}
+	}
+	months = reviewMonthsDef
+	if s := get("months"); s != "" {
+		if months, err = strconv.Atoi(s); err != nil || months < 1 || months > 60 {
+			return since, 0, fmt.Errorf("months must be 1-60")
+		}
+	}
+	return since, months, nil
+}
+
+// GET /api/reviewpack
+func handleReviewPack(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	since, months, err := reviewParams(r.URL.Query())
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	log.Printf("📊 Review pack downloaded by %s", userFor(r).Name)
+	writeXLSX(w, r, "review_pack_"+ds.BuiltAt.Format("2006-01")+".xlsx", reviewPack(t, ds, since, months))
+}
+
+// cmdReviewPack is the review-pack subcommand: flag.Args() holds the output
+// path and an optional tenant id.
+func cmdReviewPack([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: review-pack <out.xlsx> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	if t.HistoryDir != "" {
+		t.history = openHistory(t.HistoryDir)
+	}
+	since, months, err := reviewParams(nil)
+	if err != nil {
+		return err
+	}
+	data, err := reviewPack(t, buildAll(t.inputs()), since, months).Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(args[0], data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("review pack for %s written to %s (%d bytes)\n", t.ID, args[0], len(data))
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"log"
+)
+
+// ---- Sandbox ----
+//
+// A sandbox tenant ("sandbox": true in -tenants, or every tenant with
+// -sandbox) is for training and demos, typically on gen-sample data
+// (gensample.go): it works as usual but nothing leaves the server. Its
+// mails are dry runs whatever -live says, its OGD resources are written but
+// not pushed, and its payroll feeds stay in the outbox. The page title says
+// so. With -sandbox live mode can't be turned on at all.
+
+var sandboxMode = flag.Bool("sandbox", false, "Run every tenant as a sandbox: never send mail or push files, whatever -live says")
+
+// sandboxed reports whether t (nil for HQ mails) may not send anything.
+func (t *Tenant) sandboxed() bool {
+	return *sandboxMode || t != nil && t.Sandbox
+}
+
+// live reports whether t's mails really go out.
+func (t *Tenant) live() bool {
+	return LiveMode && !t.sandboxed()
+}
+
+// applySandbox holds live mode off under -sandbox.
+func applySandbox() {
+	if *sandboxMode {
+		if LiveMode {
+			log.Println("🧪 Sandbox: -live ignored, mails are dry runs")
+		}
+		LiveMode = false
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Campaign schedule ----
+//
+// With -schedule the server runs the greeting campaigns itself, so nobody
+// has to open /send-birthdays each morning. The schedule is a cron
+// expression (minute hour day-of-month month day-of-week, with *, lists,
+// ranges and /steps) read in -schedule-tz, India Standard Time by default:
+//
+//	-schedule "0 8 * * *"                                 08:00 IST every day
+//	-schedule "30 7 * * 1-6" -schedule-campaigns birthdays
+//
+// Each run is a mail job like a click on the button (mailqueue.go), on the
+// leader only, in whatever live/dry-run mode the dashboard is in. The send
+// ledger (sendledger.go) keeps a run that overlaps a manual one from
+// greeting anyone twice. A run missed while the server was down isn't
+// made up.
+
+var (
+	scheduleSpec      = flag.String("schedule", "", `Cron expression for automatic campaign runs, e.g. "0 8 * * *" (empty = off)`)
+	scheduleTZ        = flag.String("schedule-tz", "Asia/Kolkata", "Time zone -schedule, the digest schedules and subscription times are read in")
+	scheduleCampaigns = flag.String("schedule-campaigns", "birthdays,anniversaries", "Comma-separated campaigns -schedule runs")
+)
+
+// cronSpec is a parsed cron expression: the allowed values of each field.
+type cronSpec struct {
+	minute, hour, dom, month, dow [64]bool
+	domAny, dowAny                bool
+}
+
+// parseCron parses a five-field cron expression. Day-of-week 0 and 7 are
+// Sunday; when both day fields are restricted, either may match.
+func parseCron(s string) (*cronSpec, error) {
+	f := strings.Fields(s)
+	if len(f) != 5 {
+		return nil, errors.New("want five fields: minute hour day-of-month month day-of-week")
+	}
+	c := &cronSpec{domAny: f[2] == "*", dowAny: f[4] == "*"}
+	for i, field := range []struct {
+		set      *[64]bool
+		name     string
+		min, max int
+	}{{&c.minute, "minute", 0, 59}, {&c.hour, "hour", 0, 23}, {&c.dom, "day-of-month", 1, 31},
+		{&c.month, "month", 1, 12}, {&c.dow, "day-of-week", 0, 7}} {
+		if err := parseCronField(f[i], field.set, field.min, field.max); err != nil {
+			return nil, fmt.Errorf("%s %q: %v", field.name, f[i], err)
+		}
+	}
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	return c, nil
+}
+
+func parseCronField(s string, set *[64]bool, min, max int) error {
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n < 1 {
+				return errors.New("bad step")
+			}
+			rng, step = r, n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return errors.New("not a number")
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return errors.New("not a number")
+				}
+			} else if step > 1 {
+				hi = max // "5/15" is 5, 20, 35, 50
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return fmt.Errorf("out of range %d-%d", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the schedule fires in t's minute.
+func (c *cronSpec) Matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[t.Month()] {
+		return false
+	}
+	dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next is the first minute after t the schedule fires in, or the zero
+// time if none within a year (say, 31 February).
+func (c *cronSpec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(1, 0, 1); t.Before(end); t = t.Add(time.Minute) {
+		if c.Matches(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduleLocation is -schedule-tz; IST without the zone database (as on
+// some Windows hosts) when it names India.
+func scheduleLocation() (*time.Location, error) {
+	loc, err := time.LoadLocation(*scheduleTZ)
+	if err != nil && (*scheduleTZ == "Asia/Kolkata" || *scheduleTZ == "Asia/Calcutta" || *scheduleTZ == "IST") {
+		return time.FixedZone("IST", 5*3600+1800), nil
+	}
+	return loc, err
+}
+
+// runOnSchedule calls run, on the leader, in each minute of loc that spec
+// fires in, with that minute.
+func runOnSchedule(spec *cronSpec, loc *time.Location, run func(now time.Time)) {
+	go func() {
+		var last time.Time
+		for now := range time.Tick(time.Minute) {
+			now = now.In(loc).Truncate(time.Minute)
+			if now.Equal(last) || !spec.Matches(now) || !isLeader() {
+				continue
+			}
+			last = now
+			run(now)
+		}
+	}()
+}
+
+// startCampaignSchedule checks -schedule every minute; it fails on a bad
+// expression, zone or campaign.
+func startCampaignSchedule() error {
+	if strings.TrimSpace(*scheduleSpec) == "" {
+		return nil
+	}
+	spec, err := parseCron(*scheduleSpec)
+	if err != nil {
+		return fmt.Errorf("-schedule: %v", err)
+	}
+	loc, err := scheduleLocation()
+	if err != nil {
+		return fmt.Errorf("-schedule-tz: %v", err)
+	}
+	var names []string
+	for _, n := range strings.Split(*scheduleCampaigns, ",") {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		if campaignSends[n] == nil {
+			return fmt.Errorf("-schedule-campaigns: no campaign %q (have %s)", n, strings.Join(campaignNames(), ", "))
+		}
+		names = append(names, n)
+	}
+	if len(names) == 0 {
+		return errors.New("-schedule-campaigns: no campaigns")
+	}
+	next := spec.Next(time.Now().In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("-schedule %q never fires", *scheduleSpec)
+	}
+	log.Printf("⏰ Campaigns %s scheduled %q (%s); next run %s", strings.Join(names, ", "), *scheduleSpec, loc, next.Format("02 Jan 15:04 MST"))
+	runOnSchedule(spec, loc, func(now time.Time) {
+		for _, t := range TENANTS {
+			for _, n := range names {
+				send := campaignSends[n]
+				j := runMailJob(t, n, func(job string) map[string]int { return send(t, now, job) })
+				log.Printf("⏰ Scheduled %s run for %s started (job %s)", n, t.ID, j.ID)
+			}
+		}
+	})
+	return nil
+}
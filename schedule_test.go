@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	set := func(vs ...int) (s [64]bool) {
+		for _, v := range vs {
+			s[v] = true
+		}
+		return
+	}
+	for _, tc := range []struct {
+		expr         string
+		minute, hour [64]bool
+		dow          [64]bool
+	}{
+		{"0 8 * * *", set(0), set(8), set(0, 1, 2, 3, 4, 5, 6, 7)},
+		{"30 7 * * 1-6", set(30), set(7), set(1, 2, 3, 4, 5, 6)},
+		{"*/15 9-17/4 * * 1,3,5", set(0, 15, 30, 45), set(9, 13, 17), set(1, 3, 5)},
+		{"5/20 0,12 * * 7", set(5, 25, 45), set(0, 12), set(0, 7)},
+		{"0-4,58-59 23 * * 0", set(0, 1, 2, 3, 4, 58, 59), set(23), set(0)},
+	} {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tc.expr, err)
+			continue
+		}
+		if c.minute != tc.minute || c.hour != tc.hour || c.dow != tc.dow {
+			t.Errorf("parseCron(%q): minute/hour/day-of-week sets differ", tc.expr)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"0 8 * *",       // four fields
+		"0 8 * * * *",   // six fields
+		"60 8 * * *",    // minute out of range
+		"0 24 * * *",    // hour out of range
+		"0 8 0 * *",     // day-of-month starts at 1
+		"0 8 * 13 *",    // month out of range
+		"0 8 * * 8",     // day-of-week out of range
+		"0 8 * * 5-1",   // backwards range
+		"*/0 8 * * *",   // zero step
+		"x 8 * * *",     // not a number
+		"0 8 * * mon",   // names aren't supported
+		"0 8,,9 * * *",  // empty list item
+		"0 8-x * * *",   // bad range end
+		"0 8 * * 1-3/a", // bad step
+	} {
+		if _, err := parseCron(bad); err == nil {
+			t.Errorf("parseCron(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, ist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		expr, from, want string
+	}{
+		{"0 9 * * 1", "2026-10-16 10:00", "2026-10-19 09:00"},  // Friday to Monday
+		{"0 9 * * 1", "2026-10-19 09:00", "2026-10-26 09:00"},  // strictly after
+		{"0 8 31 * *", "2026-09-01 00:00", "2026-10-31 08:00"}, // September has no 31st
+		{"0 0 1 * *", "2026-12-31 23:59", "2027-01-01 00:00"},  // across the year end
+		{"0 6 29 2 *", "2026-03-01 00:00", ""},                 // 29 Feb 2028 is over a year away
+		{"0 8 1 * 0", "2026-10-16 00:00", "2026-10-18 08:00"},  // day-of-month or Sunday
+		{"30 23 28-31 * *", "2026-02-28 23:30", "2026-03-28 23:30"},
+	} {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := c.Next(at(tc.from))
+		if tc.want == "" {
+			if !got.IsZero() {
+				t.Errorf("Next(%q, %s) = %s, want none", tc.expr, tc.from, got)
+			}
+			continue
+		}
+		if want := at(tc.want); !got.Equal(want) {
+			t.Errorf("Next(%q, %s) = %s, want %s", tc.expr, tc.from, got.Format("2006-01-02 15:04 MST"), tc.want)
+		}
+	}
+
+	// 09:00 IST is 03:30 UTC: a UTC time is matched in the schedule's zone.
+	c, _ := parseCron("0 9 * * 1")
+	if got := c.Next(time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC).In(ist)); !got.Equal(time.Date(2026, 10, 19, 3, 30, 0, 0, time.UTC)) {
+		t.Errorf("Next from 03:00 UTC Monday = %s, want 03:30 UTC", got.UTC())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- School name matching ----
+//
+// Employees are joined to schools by the ID at the end of "School Name &
+// ID". A cell with the name alone would leave its employee out of every
+// school and staffing figure, so the name is compared with the DBT
+// summary's schools of the same zone instead (ingest.MatchSchoolNames:
+// words compared as sets, then by edit distance; numbers must agree) and
+// the employee placed at the best one scoring at least -school-match,
+// unless another school scores almost as well. What was matched, and what wasn't, for checking:
+//
+//	GET /api/school-matches[?status=matched|unmatched][&zone=][&format=csv]
+//
+// A DDE sees their own zone only. A build restored from -db has no list.
+
+var schoolMatchMin = flag.Float64("school-match", 0.85, "Lowest similarity (0-1) for placing an employee at a school by name when the ID is missing (0 = never)")
+
+// GET /api/school-matches
+func handleSchoolMatches(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin, roleZoneHead) {
+		return
+	}
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status != "" && status != "matched" && status != "unmatched" {
+		writeError(w, 400, errBadRequest, "status must be matched or unmatched")
+		return
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	list := []ingest.SchoolMatch{}
+	for _, m := range dataFor(r).SCHOOL_MATCHES {
+		if (zone != "" && m.Zone != zone) || (status == "matched" && m.SchoolID == "") || (status == "unmatched" && m.SchoolID != "") {
+			continue
+		}
+		list = append(list, m)
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, m := range list {
+			rows = append(rows, []string{m.EmpID, m.Zone, m.Given, m.SchoolID, m.SchoolName,
+				fmt.Sprintf("%.2f", m.Score), fmt.Sprintf("%.2f", m.Runner)})
+		}
+		writeCSV(w, r, "school_matches.csv", []string{"Employee ID", "Zone", "School Name & ID (given)", "School ID", "School (DBT)",
+			"Score", "Runner-up Score"}, rows)
+		return
+	}
+	writeData(w, list, nil)
+}
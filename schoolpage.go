@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- School pages ----
+//
+// One page per school, built from the served dataset when asked for: its
+// DBT figures (by scheme where the summary has them), head and staffing
+// against the 1:40 norm, the posts it is missing, its staff by designation
+// with their demographics, and its month-over-month figures when -dbt-dir
+// is set. The school lookup on the dashboard links to it:
+//
+//	GET /school/{id}
+//
+// A DDE sees their own zone's schools.
+
+// SchoolPage is what the school page template executes against.
+type SchoolPage struct {
+	Title    string
+	Base     string
+	School   School
+	Staff    SchoolStaff
+	Head     *SchoolHead
+	DBTPct   float64
+	AcctPct  float64
+	AadhPct  float64
+	Missing  []string
+	Roster   []Emp
+	ByDesig  []SchoolCount
+	ByGender []SchoolCount
+	ByCat    []SchoolCount
+	ByAge    []SchoolCount
+	Trend    []TrendPoint
+	BuiltAt  time.Time
+}
+
+// SchoolCount is one row of a breakdown of the school's staff.
+type SchoolCount struct {
+	Key   string
+	Count int
+}
+
+// schoolCounts breaks roster down by key, largest first.
+func schoolCounts(roster []Emp, key func(Emp) string) []SchoolCount {
+	m := map[string]int{}
+	for _, e := range roster {
+		m[key(e)]++
+	}
+	out := make([]SchoolCount, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		out = append(out, SchoolCount{k, m[k]})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	return out
+}
+
+// missingPosts lists what the school lacks: a principal, a special
+// educator, teachers against the norm and classrooms.
+func missingPosts(s School, st SchoolStaff) []string {
+	var out []string
+	if !st.HasPrincipal {
+		p := "Principal"
+		if st.InCharge != "" {
+			p += " (" + st.InCharge + " in charge)"
+		}
+		out = append(out, p)
+	}
+	if !st.HasSpecialEdu {
+		out = append(out, "Special Educator")
+	}
+	if st.SurplusVacancy < 0 {
+		out = append(out, fmt.Sprintf("%d teacher(s) against the 1:40 norm", -st.SurplusVacancy))
+	}
+	if s.ClassroomShortage > 0 {
+		out = append(out, fmt.Sprintf("%d classroom(s)", s.ClassroomShortage))
+	}
+	return out
+}
+
+// GET /school/{id}
+func handleSchoolPage(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	id := ingest.DigitsOnlyKey(r.PathValue("id"))
+	s, ok := ds.SCH[id]
+	if u := userFor(r); ok && u != nil && u.Role == roleZoneHead && !strings.EqualFold(s.Zone, u.Zone) {
+		ok = false
+	}
+	if !ok {
+		http.Error(w, "No school "+id, http.StatusNotFound)
+		return
+	}
+	roster := rosterBySchool(ds.EMP)[id]
+	priority := func(e Emp) int {
+		d := strings.ToLower(e.Designation)
+		for i, p := range []string{"principal", "special educator", "teacher"} {
+			if strings.Contains(d, p) {
+				return i
+			}
+		}
+		return 3
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		if pi, pj := priority(roster[i]), priority(roster[j]); pi != pj {
+			return pi < pj
+		}
+		if roster[i].Designation != roster[j].Designation {
+			return roster[i].Designation < roster[j].Designation
+		}
+		return roster[i].Name < roster[j].Name
+	})
+	st := schoolStaff(s, roster)
+	p := SchoolPage{
+		Title: s.Name, Base: t.Prefix, School: s, Staff: st, Roster: roster,
+		DBTPct: pct1(s.DBTTotal, s.TotalEnrolment), AcctPct: pct1(s.WithAccount, s.WithAccount+s.WithoutAccount),
+		BuiltAt: ds.BuiltAt, AadhPct: pct1(s.WithAadhaar, s.WithAadhaar+s.WithoutAadhaar), Missing: missingPosts(s, st),
+		ByDesig:  schoolCounts(roster, func(e Emp) string { return blankUnknown(e.Designation) }),
+		ByGender: schoolCounts(roster, func(e Emp) string { return blankUnknown(strings.ToUpper(e.Gender)) }),
+		ByCat:    schoolCounts(roster, func(e Emp) string { return ingest.CanonicalCategory(e.SelectionCategory) }),
+		ByAge:    schoolCounts(roster, func(e Emp) string { return ageBand(e.Age) }),
+	}
+	sort.SliceStable(p.ByAge, func(i, j int) bool { return p.ByAge[i].Key < p.ByAge[j].Key })
+	if h, ok := ds.HEADS[id]; ok {
+		p.Head = &h
+	}
+	if ds.TREND != nil {
+		p.Trend = ds.TREND.schools[id]
+	}
+	var buf bytes.Buffer
+	if err := schoolPageTmpl.Execute(&buf, p); err != nil {
+		log.Printf("school page %s: %v", id, err)
+		writeError(w, 500, errInternal, "school page: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+var schoolPageTmpl = template.Must(template.New("school").Funcs(pageFuncs).Parse(`<!doctype html>
+<html lang="en"><head><meta charset="utf-8"><title>{{.Title}}</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}a{color:#93c5fd}small,.small{color:#94a3b8}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(160px,1fr));gap:10px;margin:10px 0}
+.kpi{background:#1b263b;border:1px solid #334155;border-radius:8px;padding:10px}.kpi .v{font-size:22px;font-weight:600}.kpi .l{font-size:12px;color:#94a3b8}
+table{border-collapse:collapse;margin:8px 0;font-size:13px}th,td{border:1px solid #334155;padding:4px 8px;text-align:left}th{background:#1b263b}
+.cols{display:flex;gap:24px;flex-wrap:wrap}.bad{color:#fca5a5}</style></head>
+<body><p><a href="{{.Base}}/">Dashboard</a> · <a href="{{.Base}}/org-chart?zone={{.School.Zone}}">{{.School.Zone}} organogram</a> · <a href="{{.Base}}/api/school?id={{.School.ID}}">JSON</a></p>
+{{with .School}}<h1>🏫 {{.Name}}</h1>
+<p class="small">School ID {{.ID}} · {{.Zone}} zone{{if .SIName}} · Inspector {{.SIName}}{{end}}</p>{{end}}
+<p>{{if .Head}}<b>Head:</b> {{.Head.Name}} <small>{{.Head.Designation}}{{if .Head.Charge}}, in charge by order {{.Head.Charge.Order}} from {{.Head.Charge.From}}{{else if .Head.Acting}}, acting{{end}}</small>{{else}}<b>No head</b> identified.{{end}}</p>
+
+<h2>DBT</h2>
+{{with .School}}<div class="grid">
+<div class="kpi"><div class="v">{{.TotalEnrolment}}</div><div class="l">Enrolment (max {{.MaxEnrolment}})</div></div>
+<div class="kpi"><div class="v">{{.MaxPresent}}</div><div class="l">Max present</div></div>
+<div class="kpi"><div class="v">{{$.AadhPct}}%</div><div class="l">Aadhaar seeded ({{.WithAadhaar}})</div></div>
+<div class="kpi"><div class="v">{{$.AcctPct}}%</div><div class="l">With bank account ({{.WithAccount}})</div></div>
+<div class="kpi"><div class="v">{{.AadhaarLinkedAcc}}</div><div class="l">Aadhaar-linked accounts</div></div>
+<div class="kpi"><div class="v">{{$.DBTPct}}%</div><div class="l">DBT received ({{.DBTTotal}}: {{.DBTStudent}} student, {{.DBTParent}} parent)</div></div>
+</div>
+{{if .DBTComponents}}<table><tr><th>Scheme</th><th>Student</th><th>Parent</th><th>Total</th><th>%</th></tr>
+{{range $k, $c := .DBTComponents}}<tr><td>{{$k}}</td><td>{{$c.Student}}</td><td>{{$c.Parent}}</td><td>{{$c.Total}}</td><td>{{$c.Pct}}</td></tr>{{end}}</table>{{end}}{{end}}
+{{if .Trend}}<h3>Month over month</h3><table><tr><th>Month</th><th>Enrolment</th><th>With Aadhaar</th><th>Aadhaar %</th><th>DBT Total</th></tr>
+{{range .Trend}}<tr><td>{{.Month}}</td><td>{{.Enrolment}}</td><td>{{.WithAadhaar}}</td><td>{{.AadhaarPct}}</td><td>{{.DBTTotal}}</td></tr>{{end}}</table>{{end}}
+
+<h2>Staffing</h2>
+{{with .Staff}}<div class="grid">
+<div class="kpi"><div class="v">{{.TotalStaff}}</div><div class="l">Staff</div></div>
+<div class="kpi"><div class="v">{{.ActualTeachers}} / {{.NeededTeachers}}</div><div class="l">Teachers / needed at 1:40</div></div>
+<div class="kpi"><div class="v">{{printf "%.1f" .Ratio}}</div><div class="l">Pupils per teacher</div></div>
+<div class="kpi"><div class="v">{{.SurplusVacancy}}</div><div class="l">Surplus (+) / vacancy (−)</div></div>
+</div>{{end}}
+{{if .Missing}}<p class="bad"><b>Missing:</b> {{range $i, $m := .Missing}}{{if $i}}; {{end}}{{$m}}{{end}}</p>{{else}}<p>No posts missing.</p>{{end}}
+
+<h2>Demographics</h2>
+<div class="cols">
+<table><tr><th>Designation</th><th>Staff</th></tr>{{range .ByDesig}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+<table><tr><th>Gender</th><th>Staff</th></tr>{{range .ByGender}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+<table><tr><th>Category</th><th>Staff</th></tr>{{range .ByCat}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+<table><tr><th>Age</th><th>Staff</th></tr>{{range .ByAge}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+</div>
+
+<h2>Staff ({{len .Roster}})</h2>
+<table><tr><th>Employee ID</th><th>Name</th><th>Designation</th><th>Gender</th><th>Age</th><th>Joined</th><th>At this school since</th><th>Category</th></tr>
+{{range .Roster}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Designation}}</td><td>{{.Gender}}</td><td>{{if .Age}}{{.Age}}{{end}}</td><td>{{.DOJ}}</td><td>{{.PresentSchoolDate}}</td><td>{{.SelectionCategory}}</td></tr>{{end}}
+</table>
+<p class="small">Built {{date .BuiltAt "02 Jan 2006 15:04"}}</p>
+</body></html>`))
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Zone Scorecard ----
+//
+// Each zone is scored on four dimensions; raw values are ratios in [0,1]
+// and are min-max normalized across zones to 0..100 so the monthly review
+// slide compares zones against each other rather than against an absolute bar.
+// Mid-day meal coverage (with -mdm) and exam results (with -results, see
+// results.go) are reported alongside but not scored.
+
+type ZoneScore struct {
+	Zone        string  `json:"zone"`
+	Rank        int     `json:"rank"`
+	Overall     float64 `json:"overall"`
+	Staffing    float64 `json:"staffing"`
+	DBT         float64 `json:"dbt"`
+	Aadhaar     float64 `json:"aadhaar"`
+	DataQuality float64 `json:"data_quality"`
+
+	Schools        int     `json:"schools"`
+	Employees      int     `json:"employees"`
+	Teachers       int     `json:"teachers"`
+	NeededTeachers int     `json:"needed_teachers"`
+	Enrolment      int     `json:"enrolment"`
+	DBTTotal       int     `json:"dbt_total"`
+	WithAadhaar    int     `json:"with_aadhaar"`
+	StaffingRaw    float64 `json:"staffing_raw"`
+	DBTRaw         float64 `json:"dbt_raw"`
+	AadhaarRaw     float64 `json:"aadhaar_raw"`
+	DataQualityRaw float64 `json:"data_quality_raw"`
+	MDMCoverage    float64 `json:"mdm_coverage_pct,omitempty"`
+	MDMAnomalies   int     `json:"mdm_anomalies,omitempty"`
+	PassPct        float64 `json:"pass_pct,omitempty"`
+	AvgScore       float64 `json:"avg_score_pct,omitempty"`
+
+	ResultsPTR        *float64 `json:"results_ptr_r,omitempty"`        // pass % vs pupil-teacher ratio across schools
+	ResultsAttendance *float64 `json:"results_attendance_r,omitempty"` // pass % vs attendance
+}
+
+func rosterBySchool(emp map[string]Emp) map[string][]Emp {
+	out := map[string][]Emp{}
+	for _, e := range emp {
+		if e.SchoolID != "" {
+			out[e.SchoolID] = append(out[e.SchoolID], e)
+		}
+	}
+	return out
+}
+
+// schoolStaff applies the 1:40 teacher norm used by the school lookup.
+func schoolStaff(s School, roster []Emp) SchoolStaff {
+	actualT := 0
+	hasP := false
+	hasSE := false
+	for _, e := range roster {
+		d := strings.ToLower(e.Designation)
+		if strings.Contains(d, "teacher") {
+			actualT++
+		}
+		if strings.Contains(d, "principal") {
+			hasP = true
+		}
+		if strings.Contains(d, "special educator") {
+			hasSE = true
+		}
+	}
+	neededT := int(math.Ceil(float64(s.MaxPresent) / 40.0))
+	if neededT < 0 {
+		neededT = 0
+	}
+	ratio := 0.0
+	if actualT > 0 {
+		ratio = float64(s.MaxPresent) / float64(actualT)
+	}
+	return SchoolStaff{
+		ID: s.ID, Name: s.Name, Zone: s.Zone,
+		NeededTeachers: neededT, ActualTeachers: actualT, SurplusVacancy: actualT - neededT,
+		HasPrincipal: hasP, InCharge: s.HoSChargeName, HasSpecialEdu: hasSE, TotalStaff: len(roster), Ratio: ratio,
+	}
+}
+
+// empQuality returns how many of the data-quality checks an employee passes
+// and how many checks there are.
+func empQuality(e Emp, sch map[string]School) (pass, total int) {
+	checks := []bool{
+		e.DOB != "" && ingest.AgeFromDOB(e.DOB) > 0,
+		e.DOJ != "",
+		e.Email != "",
+		ingest.ValidMobile(e.Mobile),
+		e.SelectionCategory != "" && e.SelectionCategory != "UNKNOWN",
+		e.SchoolID != "" && sch[e.SchoolID].ID != "",
+	}
+	for _, ok := range checks {
+		if ok {
+			pass++
+		}
+	}
+	return pass, len(checks)
+}
+
+func buildScorecard(emp map[string]Emp, sch map[string]School) []ZoneScore {
+	zs := map[string]*ZoneScore{}
+	zone := func(z string) *ZoneScore {
+		if zs[z] == nil {
+			zs[z] = &ZoneScore{Zone: z}
+		}
+		return zs[z]
+	}
+
+	aadhaarDen := map[string]int{}
+	mdmMeals, mdmDen := map[string]int{}, map[string]int{}
+	rosters := rosterBySchool(emp)
+	for sid, s := range sch {
+		z := zone(s.Zone)
+		z.Schools++
+		z.Enrolment += s.TotalEnrolment
+		z.DBTTotal += s.DBTTotal
+		z.WithAadhaar += s.WithAadhaar
+		aadhaarDen[s.Zone] += s.WithAadhaar + s.WithoutAadhaar
+		if s.HasMDM {
+			mdmMeals[s.Zone] += s.MDMDaily
+			mdmDen[s.Zone] += s.TotalEnrolment
+			if s.MDMAnomaly {
+				z.MDMAnomalies++
+			}
+		}
+
+		st := schoolStaff(s, rosters[sid])
+		z.NeededTeachers += st.NeededTeachers
+		// surplus in one school does not fill a vacancy in another
+		if st.ActualTeachers < st.NeededTeachers {
+			z.Teachers += st.ActualTeachers
+		} else {
+			z.Teachers += st.NeededTeachers
+		}
+	}
+
+	qPass, qTotal := map[string]int{}, map[string]int{}
+	for _, e := range emp {
+		z := zone(e.Zone)
+		z.Employees++
+		p, t := empQuality(e, sch)
+		qPass[e.Zone] += p
+		qTotal[e.Zone] += t
+	}
+
+	_, results := summarizeResults(sch, rosters)
+	ratio := func(a, b int) float64 {
+		if b <= 0 {
+			return 0
+		}
+		return math.Min(float64(a)/float64(b), 1)
+	}
+	out := make([]ZoneScore, 0, len(zs))
+	for name, z := range zs {
+		z.StaffingRaw = ratio(z.Teachers, z.NeededTeachers)
+		z.DBTRaw = ratio(z.DBTTotal, z.Enrolment)
+		z.AadhaarRaw = ratio(z.WithAadhaar, aadhaarDen[name])
+		z.DataQualityRaw = ratio(qPass[name], qTotal[name])
+		z.MDMCoverage = pct1(mdmMeals[name], mdmDen[name])
+		if r := results[name]; r != nil {
+			z.PassPct, z.AvgScore, z.ResultsPTR, z.ResultsAttendance = r.PassPct, r.AvgScore, r.PassVsPTR, r.PassVsAttendance
+		}
+		out = append(out, *z)
+	}
+
+	normalize := func(get func(*ZoneScore) float64, set func(*ZoneScore, float64)) {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i := range out {
+			v := get(&out[i])
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		for i := range out {
+			v := get(&out[i])
+			n := 100.0
+			if hi > lo {
+				n = (v - lo) / (hi - lo) * 100
+			} else if v == 0 {
+				n = 0
+			}
+			set(&out[i], math.Round(n*10)/10)
+		}
+	}
+	normalize(func(z *ZoneScore) float64 { return z.StaffingRaw }, func(z *ZoneScore, v float64) { z.Staffing = v })
+	normalize(func(z *ZoneScore) float64 { return z.DBTRaw }, func(z *ZoneScore, v float64) { z.DBT = v })
+	normalize(func(z *ZoneScore) float64 { return z.AadhaarRaw }, func(z *ZoneScore, v float64) { z.Aadhaar = v })
+	normalize(func(z *ZoneScore) float64 { return z.DataQualityRaw }, func(z *ZoneScore, v float64) { z.DataQuality = v })
+
+	for i := range out {
+		z := &out[i]
+		z.Overall = math.Round((z.Staffing+z.DBT+z.Aadhaar+z.DataQuality)/4*10) / 10
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Overall == out[j].Overall {
+			return out[i].Zone < out[j].Zone
+		}
+		return out[i].Overall > out[j].Overall
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+func handleAPIScorecard(w http.ResponseWriter, r *http.Request) {
+	z := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	score := dataFor(r).SCORECARD
+	if z == "" {
+		writeData(w, score, nil)
+		return
+	}
+	for _, s := range score {
+		if s.Zone == z {
+			writeData(w, s, nil)
+			return
+		}
+	}
+	writeError(w, 404, errNotFound, "zone "+z+" not found")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Security headers ----
+//
+// Every response carries a Content Security Policy (-csp), and the
+// headers that keep pages out of other sites' frames, stop MIME sniffing
+// and trim the referrer. The default policy allows what the pages load:
+// their own inline scripts and styles, Chart.js from jsDelivr and the
+// Google fonts. Over HTTPS, Strict-Transport-Security is added
+// (-hsts-max-age).
+//
+// The widgets (widgets.go) exist to be framed by other portals, so their
+// responses swap frame-ancestors for -widget-frame-ancestors and carry no
+// X-Frame-Options.
+
+const defaultCSP = "default-src 'self'; script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src 'self' https://fonts.gstatic.com; " +
+	"img-src 'self' data: https:; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+var (
+	cspPolicy            = flag.String("csp", defaultCSP, "Content-Security-Policy sent with every response (empty = none)")
+	widgetFrameAncestors = flag.String("widget-frame-ancestors", "*", `Origins allowed to frame the /widgets/ pages, space-separated (e.g. "https://portal.example"); "'none'" forbids it`)
+	hstsMaxAge           = flag.Duration("hsts-max-age", 365*24*time.Hour, "Strict-Transport-Security max-age sent over HTTPS (0 = none)")
+)
+
+// withSecurityHeaders sets the security headers before h runs, so a
+// handler can still adjust them.
+func withSecurityHeaders(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hd := w.Header()
+		if *cspPolicy != "" {
+			hd.Set("Content-Security-Policy", *cspPolicy)
+		}
+		hd.Set("X-Frame-Options", "DENY")
+		hd.Set("X-Content-Type-Options", "nosniff")
+		hd.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		hd.Set("Permissions-Policy", "camera=(), microphone=(), payment=(), geolocation=(self)")
+		hd.Set("Cross-Origin-Opener-Policy", "same-origin")
+		if r.TLS != nil && *hstsMaxAge > 0 {
+			hd.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(int(hstsMaxAge.Seconds()))+"; includeSubDomains")
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allowFraming lets the response be framed by -widget-frame-ancestors.
+func allowFraming(w http.ResponseWriter) {
+	w.Header().Del("X-Frame-Options")
+	origins := strings.TrimSpace(*widgetFrameAncestors)
+	if origins == "" {
+		origins = "'none'"
+	}
+	var directives []string
+	for _, d := range strings.Split(w.Header().Get("Content-Security-Policy"), ";") {
+		if d = strings.TrimSpace(d); d != "" && !strings.HasPrefix(strings.ToLower(d), "frame-ancestors") {
+			directives = append(directives, d)
+		}
+	}
+	w.Header().Set("Content-Security-Policy", strings.Join(append(directives, "frame-ancestors "+origins), "; "))
+}
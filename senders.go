@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Per-zone sender identities ----
+//
+// Campaign mails can come from the employee's own zone office instead of
+// HQ. The senders file maps zones to a From address and display name and,
+// optionally, to an SMTP account of their own:
+//
+//	{"zones": {"NARELA": {"name": "Narela Zone Education Office", "from": "edu.narela@mcd.example", "smtp": "narela"}},
+//	 "smtp":  {"narela": {"host": "smtp.gmail.com", "port": 465, "user": "edu.narela@mcd.example", "pass_env": "MCD_SMTP_NARELA_PASS"}}}
+//
+// An account's "tls" and "auth" work like -smtp-tls and -smtp-auth (smtp.go);
+// "provider" sends through SendGrid or Amazon SES instead (mailer.go).
+//
+// A zone without an SMTP account is sent through the HQ account: the display
+// name is the zone's, the address stays HQ's (providers reject foreign From
+// addresses) and the zone address goes in Reply-To.
+
+var sendersFile = flag.String("senders", "", "JSON file mapping zones to sender identities/SMTP accounts (empty = everything from HQ)")
+
+type SMTPAccount struct {
+	Provider string `json:"provider,omitempty"` // smtp (default), sendgrid or ses
+	Host     string `json:"host"`               // for sendgrid and ses, optionally the API's base URL
+	Port     int    `json:"port,omitempty"`     // default 465
+	TLS      string `json:"tls,omitempty"`      // auto, implicit, starttls or none
+	Auth     string `json:"auth,omitempty"`     // plain, login, cram-md5 or none
+	Region   string `json:"region,omitempty"`   // ses
+	User     string `json:"user"`
+	Pass     string `json:"pass,omitempty"`
+	PassEnv  string `json:"pass_env,omitempty"` // read the password from this variable instead
+}
+
+type Sender struct {
+	Name    string `json:"name"`
+	From    string `json:"from,omitempty"`
+	SMTP    string `json:"smtp,omitempty"` // key into the file's "smtp" accounts
+	ReplyTo string `json:"-"`
+
+	account *SMTPAccount
+}
+
+type senderConfig struct {
+	Zones map[string]Sender       `json:"zones"`
+	SMTP  map[string]*SMTPAccount `json:"smtp"`
+}
+
+// hqSender is the mailer's own identity (-email-from/-email-name on the
+// -smtp-* or -mail-provider account).
+func hqSender() Sender {
+	return Sender{Name: EmailName, From: EmailFrom, account: hqAccount()}
+}
+
+func loadSenders(path string) (*senderConfig, error) {
+	if err := hqSender().account.check(); err != nil {
+		return nil, fmt.Errorf("-smtp-*/-mail-*: %v", err)
+	}
+	cfg := &senderConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	zones := make(map[string]Sender, len(cfg.Zones))
+	for zone, s := range cfg.Zones {
+		switch {
+		case s.Name == "" && s.From == "":
+			return nil, fmt.Errorf("%s: zone %s: name or from required", path, zone)
+		case s.From != "" && !ingest.ValidEmail(s.From):
+			return nil, fmt.Errorf("%s: zone %s: invalid from address %q", path, zone, s.From)
+		case s.SMTP != "" && cfg.SMTP[s.SMTP] == nil:
+			return nil, fmt.Errorf("%s: zone %s: no smtp account %q", path, zone, s.SMTP)
+		}
+		zones[strings.ToUpper(strings.TrimSpace(zone))] = s
+	}
+	cfg.Zones = zones
+	for name, a := range cfg.SMTP {
+		if err := a.check(); err != nil {
+			return nil, fmt.Errorf("%s: smtp %s: %v", path, name, err)
+		}
+		if a.Port == 0 {
+			a.Port = 465
+		}
+		if a.PassEnv != "" {
+			a.Pass = os.Getenv(a.PassEnv)
+		}
+		if a.Pass == "" && a.needsPass() {
+			log.Printf("senders: smtp account %s has no password (%s unset?)", name, a.PassEnv)
+		}
+	}
+	return cfg, nil
+}
+
+// senderFor returns the identity mails to someone in zone go out under.
+func (t *Tenant) senderFor(zone string) Sender {
+	hq := hqSender()
+	if t.senders == nil {
+		return hq
+	}
+	s, ok := t.senders.Zones[strings.ToUpper(strings.TrimSpace(zone))]
+	if !ok {
+		return hq
+	}
+	if s.Name == "" {
+		s.Name = hq.Name
+	}
+	if s.SMTP != "" {
+		s.account = t.senders.SMTP[s.SMTP]
+		if s.From == "" {
+			s.From = s.account.User
+		}
+		return s
+	}
+	if s.From != "" && !strings.EqualFold(s.From, hq.From) {
+		s.ReplyTo = s.From
+	}
+	s.From, s.account = hq.From, hq.account
+	return s
+}
+
+// sendEmailAs mails through s's account (see mailer.go). A non-empty
+// msgID becomes the Message-ID local part, so replies and bounces can be
+// matched back to the send (inbound.go).
+func sendEmailAs(s Sender, msgID, to, subject, body string) error {
+	return sendEmailFiles(s, msgID, to, subject, body)
+}
+
+// MailFile is an attachment.
+type MailFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"` // e.g. "text/csv"
+	Data        []byte `json:"data"`
+}
+
+// sendEmailFiles is sendEmailAs with attachments; without any the mail is
+// plain HTML as before, with some it is multipart/mixed.
+func sendEmailFiles(s Sender, msgID, to, subject, body string, files ...MailFile) error {
+	if !LiveMode {
+		logDrySend(s, to, subject, files...)
+		return nil
+	}
+	if s.account == nil || s.From == "" {
+		return fmt.Errorf("sender %q: no mail account", s.Name)
+	}
+	return s.account.mailer().Send(s, Mail{To: to, Subject: subject, Body: body, MsgID: msgID, Files: files})
+}
+
+// logDrySend logs the mail a dry run would have sent.
+func logDrySend(s Sender, to, subject string, files ...MailFile) {
+	names := ""
+	for _, f := range files {
+		names += fmt.Sprintf(" +%s (%d bytes)", f.Name, len(f.Data))
+	}
+	if s.Name != EmailName || s.From != EmailFrom {
+		log.Printf("DRY SEND → %s | %s (from %s <%s>)%s", to, subject, s.Name, s.From, names)
+	} else {
+		log.Printf("DRY SEND → %s | %s%s", to, subject, names)
+	}
+}
+
+// multipartBody is the Content-Type header and body of an HTML mail with
+// base64-encoded attachments.
+func multipartBody(body string, files []MailFile) string {
+	var b strings.Builder
+	mw := multipart.NewWriter(&b)
+	part := func(h textproto.MIMEHeader, data []byte) {
+		pw, _ := mw.CreatePart(h)
+		enc := base64.StdEncoding.EncodeToString(data)
+		for len(enc) > 76 {
+			pw.Write([]byte(enc[:76] + "\r\n"))
+			enc = enc[76:]
+		}
+		pw.Write([]byte(enc + "\r\n"))
+	}
+	part(textproto.MIMEHeader{
+		"Content-Type":              {`text/html; charset="UTF-8"`},
+		"Content-Transfer-Encoding": {"base64"},
+	}, []byte(body))
+	for _, f := range files {
+		ct := f.ContentType
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		part(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(ct, map[string]string{"name": f.Name})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": f.Name})},
+			"Content-Transfer-Encoding": {"base64"},
+		}, f.Data)
+	}
+	mw.Close()
+	return "Content-Type: multipart/mixed; boundary=\"" + mw.Boundary() + "\"\r\n\r\n" + b.String()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---- Send ledger ----
+//
+// Every greeting sent for real is written to the tenant's ledger (-send-ledger,
+// one JSON line per mail: date, campaign, employee), so running a campaign
+// twice on the same day - a second click on Send Birthdays, a cron job
+// next to the scheduler - doesn't greet anyone twice; the results count
+// them as already_sent. Dry runs read the ledger but don't add to it.
+// -force sends regardless, for testing. Entries older than 40 days are
+// dropped.
+
+var (
+	sendLedgerFile = flag.String("send-ledger", "./out/sent.jsonl", "Ledger of greetings sent, so a campaign reaches each employee once a day")
+	forceSend      = flag.Bool("force", false, "Send greetings even to employees the send ledger shows were greeted today")
+)
+
+const ledgerKeepDays = 40
+
+// errAlreadySent is campaignMailer.Send's answer for someone greeted today.
+var errAlreadySent = errors.New("already sent today")
+
+type LedgerEntry struct {
+	Date     string    `json:"date"` // YYYY-MM-DD, local time
+	Campaign string    `json:"campaign"`
+	EmpID    string    `json:"emp_id"`
+	At       time.Time `json:"at"`
+	Job      string    `json:"job,omitempty"`
+}
+
+type sendLedger struct {
+	mu   sync.Mutex
+	path string
+	day  string
+	mod  time.Time       // of the file when read
+	sent map[string]bool // campaign|emp id, on day
+}
+
+var (
+	sendLedgersMu sync.Mutex
+	sendLedgers   = map[string]*sendLedger{} // by tenant id
+)
+
+func (t *Tenant) sendLedger() *sendLedger {
+	sendLedgersMu.Lock()
+	defer sendLedgersMu.Unlock()
+	l, ok := sendLedgers[t.ID]
+	if !ok {
+		l = &sendLedger{path: t.SendLedger}
+		sendLedgers[t.ID] = l
+	}
+	return l
+}
+
+// refresh re-reads today's entries when the day or the file has changed,
+// so a "send" command run next to the server is seen. Called with mu held.
+func (l *sendLedger) refresh(now time.Time) {
+	day := now.Format("2006-01-02")
+	st, err := os.Stat(l.path)
+	var mod time.Time
+	if err == nil {
+		mod = st.ModTime()
+	}
+	if day == l.day && mod.Equal(l.mod) && l.sent != nil {
+		return
+	}
+	if day != l.day && err == nil {
+		l.prune(now)
+	}
+	// Claims not yet written survive a re-read.
+	sent := map[string]bool{}
+	if day == l.day {
+		sent = l.sent
+	}
+	readJSONL(l.path, func(e LedgerEntry) {
+		if e.Date == day {
+			sent[e.Campaign+"|"+e.EmpID] = true
+		}
+	})
+	l.day, l.mod, l.sent = day, mod, sent
+}
+
+// prune rewrites the ledger without entries older than ledgerKeepDays.
+func (l *sendLedger) prune(now time.Time) {
+	cutoff := now.AddDate(0, 0, -ledgerKeepDays).Format("2006-01-02")
+	var keep []LedgerEntry
+	dropped := 0
+	readJSONL(l.path, func(e LedgerEntry) {
+		if e.Date >= cutoff {
+			keep = append(keep, e)
+		} else {
+			dropped++
+		}
+	})
+	if dropped == 0 {
+		return
+	}
+	f, err := os.Create(l.path + ".tmp")
+	if err != nil {
+		log.Printf("send ledger %s: %v", l.path, err)
+		return
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range keep {
+		enc.Encode(e)
+	}
+	if err := f.Close(); err != nil {
+		log.Printf("send ledger %s: %v", l.path, err)
+		return
+	}
+	if err := os.Rename(l.path+".tmp", l.path); err != nil {
+		log.Printf("send ledger %s: %v", l.path, err)
+	}
+}
+
+// Sent reports whether campaign already went to id today.
+func (l *sendLedger) Sent(campaign, id string) bool {
+	if l.path == "" {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh(time.Now())
+	return l.sent[campaign+"|"+id]
+}
+
+// Claim marks campaign as going to id today, unless it already has; a
+// second run at the same time then can't send it too. Release undoes a
+// claim whose mail couldn't be queued.
+func (l *sendLedger) Claim(campaign, id string) bool {
+	if l.path == "" {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh(time.Now())
+	if l.sent[campaign+"|"+id] {
+		return false
+	}
+	l.sent[campaign+"|"+id] = true
+	return true
+}
+
+func (l *sendLedger) Release(campaign, id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.sent, campaign+"|"+id)
+}
+
+// Record writes a claimed send to the file.
+func (l *sendLedger) Record(campaign, id, job string) {
+	if l.path == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var before time.Time
+	if st, err := os.Stat(l.path); err == nil {
+		before = st.ModTime()
+	}
+	now := time.Now()
+	if err := appendJSONL(l.path, LedgerEntry{Date: now.Format("2006-01-02"), Campaign: campaign, EmpID: id, At: now, Job: job}); err != nil {
+		log.Printf("send ledger %s: %v", l.path, err)
+		return
+	}
+	// Our own line needn't be read back, unless someone else wrote too.
+	if st, err := os.Stat(l.path); err == nil && before.Equal(l.mod) {
+		l.mod = st.ModTime()
+	}
+}
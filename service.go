@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// ---- Service install ----
+//
+//	mcd-dashboard.exe install-service -basic D:\mcd\Basic.csv -title "Zone Dashboard"
+//	mcd-dashboard.exe uninstall-service
+//
+// install-service registers the binary as an auto-start Windows service that
+// runs with the given flags from the current directory and logs to the
+// Windows event log (unless -log-file is set).
+
+var (
+	serviceName = flag.String("service-name", "mcd-dashboard", "Windows service name for install-service/uninstall-service")
+	workDir     = flag.String("chdir", "", "Change to this directory before reading any files (optional)")
+)
+
+func cmdInstallService(args []string) error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	// -chdir first so an explicit one in args wins.
+	if err := installService(*serviceName, append([]string{"-chdir", cwd}, args...)); err != nil {
+		return err
+	}
+	fmt.Printf("%s: installed\n", *serviceName)
+	return nil
+}
+
+func cmdUninstallService(args []string) error {
+	if err := removeService(*serviceName); err != nil {
+		return err
+	}
+	fmt.Printf("%s: removed\n", *serviceName)
+	return nil
+}
+
+func applyChdir() {
+	if *workDir == "" {
+		return
+	}
+	if err := os.Chdir(*workDir); err != nil {
+		log.Fatalf("chdir: %v", err)
+	}
+}
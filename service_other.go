@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+var errNoService = errors.New("only available on Windows (use -daemon or systemd elsewhere)")
+
+func installService(name string, args []string) error { return errNoService }
+
+func removeService(name string) error { return errNoService }
+
+func setupServiceLog() {}
+
+func serve(srv *http.Server) error { return listenAndServe(srv) }
@@ -0,0 +1,131 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func installService(name string, args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", name)
+	}
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "MCD Dashboard (" + name + ")",
+		Description: "MCD education staff and school dashboard",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		_ = s.Delete()
+		return fmt.Errorf("event log source: %v", err)
+	}
+	return nil
+}
+
+func removeService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	if err := eventlog.Remove(name); err != nil {
+		return fmt.Errorf("event log source: %v", err)
+	}
+	return nil
+}
+
+func isService() bool {
+	ok, err := svc.IsWindowsService()
+	return err == nil && ok
+}
+
+// eventLogWriter turns each log line into an Information event.
+type eventLogWriter struct{ l *eventlog.Log }
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w.l.Info(1, strings.TrimSpace(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setupServiceLog sends the log to the event log when running under the
+// service manager and no -log-file was given.
+func setupServiceLog() {
+	if !isService() || *logFile != "" {
+		return
+	}
+	l, err := eventlog.Open(*serviceName)
+	if err != nil {
+		return
+	}
+	log.SetFlags(0) // the event log timestamps entries itself
+	log.SetOutput(eventLogWriter{l})
+}
+
+func serve(srv *http.Server) error {
+	if !isService() {
+		return listenAndServe(srv)
+	}
+	return svc.Run(*serviceName, &winService{srv: srv})
+}
+
+type winService struct{ srv *http.Server }
+
+func (ws *winService) Execute(args []string, req <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	errc := make(chan error, 1)
+	go func() { errc <- listenAndServe(ws.srv) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-errc:
+			log.Printf("server: %v", err)
+			return false, 1
+		case c := <-req:
+			switch c.Cmd {
+			case svc.Interrogate:
+				status <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				_ = ws.srv.Shutdown(ctx)
+				cancel()
+				log.Println("🛑 Service stopped")
+				return false, 0
+			}
+		}
+	}
+}
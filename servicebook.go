@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Service book PDF ----
+//
+// GET /api/emp/servicebook?id= renders an employee's consolidated record and
+// recorded change history as a PDF. Personal data, so only establishment
+// staff (and admins) may download it; each download is logged.
+
+const roleEstablishment = "establishment"
+
+func handleServiceBook(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	id := ingest.NormalizeEmpID(r.URL.Query().Get("id"))
+	t, ds := tenantFor(r), dataFor(r)
+	e, ok := ds.EMP[id]
+	if !ok {
+		writeError(w, 404, errNotFound, "employee "+id+" not found")
+		return
+	}
+	var hist []HistoryEntry
+	if t.history != nil {
+		hist = t.history.For(id)
+	}
+	pdf := serviceBookPDF(t, ds, e, hist)
+	log.Printf("📄 Service book %s downloaded by %s", id, userFor(r).Name)
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="service_book_`+id+`.pdf"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	_, _ = w.Write(pdf)
+}
+
+func serviceBookPDF(t *Tenant, ds *Dataset, e Emp, hist []HistoryEntry) []byte {
+	d := newPDF("System-generated summary from " + t.PageTitle() + " data as of " +
+		ds.BuiltAt.Format("02 Jan 2006") + ". Not a substitute for the official service book.")
+	d.Title("Service Summary")
+	d.Text(t.PageTitle() + " · generated " + time.Now().Format("02 Jan 2006 15:04"))
+
+	d.Heading(e.Name + " (" + e.ID + ")")
+	age := ""
+	if e.Age > 0 {
+		age = " (age " + strconv.Itoa(e.Age) + ")"
+	}
+	d.KV(
+		[2]string{"Gender", e.Gender},
+		[2]string{"Date of birth", e.DOB + age},
+		[2]string{"Category", e.SelectionCategory},
+		[2]string{"Religion", e.Religion},
+		[2]string{"Marital status", e.MaritalStatus},
+		[2]string{"Home town", e.HomeTown},
+		[2]string{"Father", e.FatherName},
+		[2]string{"Mother", e.MotherName},
+		[2]string{"Spouse", e.SpouseName},
+	)
+
+	d.Heading("Current service")
+	school := e.SchoolID
+	if e.SchoolName != "" {
+		school += " – " + e.SchoolName
+	}
+	d.KV(
+		[2]string{"Designation", e.Designation},
+		[2]string{"Status", e.Status},
+		[2]string{"Zone", e.Zone},
+		[2]string{"Date of joining", e.DOJ},
+		[2]string{"Appointment", e.AppointmentDate},
+		[2]string{"Last promotion", e.PromotionDate},
+		[2]string{"Last transfer", e.TransferDate},
+	)
+	d.KV([2]string{"School", school})
+
+	d.Heading("Recorded changes")
+	if len(hist) == 0 {
+		d.Text("No changes recorded since history tracking began.")
+	} else {
+		widths := []float64{0.16, 0.18, 0.33, 0.33}
+		d.Row(true, widths, "Date", "Field", "From", "To")
+		for _, h := range hist {
+			d.Row(false, widths, h.At.Format("02 Jan 2006"), h.Field, h.From, h.To)
+		}
+	}
+	return d.Bytes()
+}
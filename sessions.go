@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Session admin ----
+//
+// Users with role "superadmin" see every live login session across tenants
+// at /admin/sessions and can end one session, all of a user's sessions
+// (someone transferred out) or all sessions (a shared machine was
+// compromised).
+
+const roleSuperAdmin = "superadmin"
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requireRole answers 403 unless the request's user has one of roles.
+func requireRole(w http.ResponseWriter, r *http.Request, roles ...string) bool {
+	if u := userFor(r); u != nil {
+		for _, role := range roles {
+			if u.Role == role {
+				return true
+			}
+		}
+	}
+	writeError(w, http.StatusForbidden, errForbidden, strings.Join(roles, " or ")+" role required")
+	return false
+}
+
+// liveSessions drops expired sessions and returns the rest, most recently
+// active first.
+func liveSessions() []Session {
+	sessMu.Lock()
+	defer sessMu.Unlock()
+	now := time.Now()
+	out := []Session{}
+	for tok, s := range sessions {
+		if now.After(s.Expires) {
+			delete(sessions, tok)
+			continue
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// revokeSessions ends every session match accepts and returns how many.
+func revokeSessions(match func(*Session) bool) int {
+	sessMu.Lock()
+	defer sessMu.Unlock()
+	n := 0
+	for tok, s := range sessions {
+		if match(s) {
+			delete(sessions, tok)
+			n++
+		}
+	}
+	return n
+}
+
+// GET /api/sessions
+func handleAPISessions(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleSuperAdmin) {
+		return
+	}
+	writeData(w, liveSessions(), nil)
+}
+
+// POST /api/sessions/revoke?id=… | ?tenant=…&user=… | ?all=1
+func handleSessionsRevoke(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleSuperAdmin) {
+		return
+	}
+	q := r.URL.Query()
+	var match func(*Session) bool
+	switch {
+	case q.Get("id") != "":
+		id := q.Get("id")
+		match = func(s *Session) bool { return s.ID == id }
+	case q.Get("user") != "":
+		tenant, user := q.Get("tenant"), q.Get("user")
+		match = func(s *Session) bool { return s.User == user && (tenant == "" || s.Tenant == tenant) }
+	case q.Get("all") == "1":
+		match = func(*Session) bool { return true }
+	default:
+		writeError(w, 400, errBadRequest, "give id, user (and optional tenant) or all=1")
+		return
+	}
+	n := revokeSessions(match)
+	log.Printf("🚪 %s revoked %d session(s) (%s)", userFor(r).Name, n, r.URL.RawQuery)
+	writeData(w, map[string]int{"revoked": n}, nil)
+}
+
+// GET /admin/sessions
+func handleAdminSessions(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleSuperAdmin) {
+		return
+	}
+	base := tenantFor(r).Prefix
+	e := html.EscapeString
+	ago := func(t time.Time) string { return time.Since(t).Round(time.Second).String() + " ago" }
+	var rows strings.Builder
+	list := liveSessions()
+	for _, s := range list {
+		fmt.Fprintf(&rows, `<tr><td>%s</td><td>%s</td><td>%s</td><td title="%s">%s</td><td>%s</td><td>%s</td><td>%s</td>
+<td><button onclick="revoke('id=%s')">End</button> <button onclick="revoke('tenant=%s&user=%s')">End all for user</button></td></tr>`,
+			e(s.Tenant), e(s.User), e(s.IP), e(s.UserAgent), e(shorten(s.UserAgent, 40)), e(s.LastPath),
+			ago(s.LastSeen), s.Created.Format("02 Jan 15:04"), e(s.ID), e(s.Tenant), e(s.User))
+	}
+	if len(list) == 0 {
+		rows.WriteString(`<tr><td colspan="8">No active sessions</td></tr>`)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Sessions</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}table{border-collapse:collapse;width:100%%}
+td,th{border:1px solid #334155;padding:6px;text-align:left;font-size:13px}th{background:#1b263b}</style></head>
+<body><h1>Active sessions (%d)</h1>
+<p><button onclick="if(confirm('Log everyone out, including you?'))revoke('all=1')">Log out everyone</button></p>
+<table><thead><tr><th>Tenant</th><th>User</th><th>IP</th><th>Browser</th><th>Last page</th><th>Last active</th><th>Logged in</th><th></th></tr></thead>
+<tbody>%s</tbody></table>
+<script>
+function revoke(q){
+  fetch(%q+'/api/sessions/revoke?'+q,{method:'POST'}).then(function(r){return r.json();})
+    .then(function(j){ if(j.errors){alert(j.errors[0].detail);return;} location.reload(); });
+}
+</script></body></html>`, len(list), rows.String(), base)
+}
+
+func shorten(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
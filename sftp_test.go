@@ -0,0 +1,83 @@
+package main
+
+import (
+	binenc "encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSFTP answers the client's open, read and close requests over pipes.
+// read returns the reply to a read at off: the data, or "" for EOF.
+func fakeSFTP(t *testing.T, read func(off uint64) (typ byte, payload []byte)) *sftpClient {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	repR, repW := io.Pipe()
+	c := &sftpClient{in: reqW, out: repR}
+	srv := &sftpClient{in: repW, out: reqR}
+	go func() {
+		defer repW.Close()
+		for {
+			typ, body, err := srv.recv()
+			if err != nil {
+				return
+			}
+			id := binenc.BigEndian.Uint32(body)
+			reply := func(rtyp byte, payload []byte) {
+				srv.send(rtyp, append(sftpU32(nil, id), payload...))
+			}
+			switch typ {
+			case sftpOpen:
+				reply(sftpHandle, sftpString(nil, "h"))
+			case sftpRead:
+				_, rest := sftpReadString(body[4:])
+				rtyp, payload := read(binenc.BigEndian.Uint64(rest))
+				reply(rtyp, payload)
+			default:
+				reply(sftpStatus, sftpU32(nil, sftpStatusOK))
+			}
+		}
+	}()
+	t.Cleanup(func() { reqW.Close() })
+	return c
+}
+
+func sftpEOF() (byte, []byte) {
+	return sftpStatus, sftpString(sftpU32(nil, sftpStatusEOF), "EOF")
+}
+
+func TestSFTPGet(t *testing.T) {
+	file := strings.Repeat("x", sftpChunk+10)
+	c := fakeSFTP(t, func(off uint64) (byte, []byte) {
+		if off >= uint64(len(file)) {
+			return sftpEOF()
+		}
+		end := min(off+sftpChunk, uint64(len(file)))
+		return sftpData, sftpString(nil, file[off:end])
+	})
+	got, err := c.Get("/in/a.csv", 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != file {
+		t.Errorf("got %d bytes, want %d", len(got), len(file))
+	}
+}
+
+func TestSFTPGetEmptyChunk(t *testing.T) {
+	c := fakeSFTP(t, func(uint64) (byte, []byte) { return sftpData, sftpString(nil, "") })
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Get("/in/a.csv", 1<<20)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("Get of an endless run of empty chunks succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get loops on empty data packets")
+	}
+}
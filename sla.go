@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Queue SLAs ----
+//
+// Turnaround for the two ticket queues: correction requests (grievances in
+// the "data" category, i.e. "my record is wrong") and all other grievances.
+// Per queue and zone: received, disposed (resolved or rejected), disposal
+// rate, average and median days to dispose, share disposed within the SLA,
+// open tickets past the SLA and the ageing of what is still open. Shown on
+// /admin/queues and in the weekly digest.
+//
+//	GET /api/sla[?since=YYYY-MM-DD][&queue=corrections|grievances]
+
+var (
+	slaCorrectionDays = flag.Int("sla-correction-days", 7, "Days within which a correction request should be disposed")
+	slaGrievanceDays  = flag.Int("sla-grievance-days", 30, "Days within which a grievance should be disposed")
+)
+
+const (
+	queueCorrections = "corrections"
+	queueGrievances  = "grievances"
+)
+
+var queueLabels = map[string]string{queueCorrections: "Correction requests", queueGrievances: "Grievances"}
+
+func ticketQueue(tk Ticket) string {
+	if tk.Category == "data" {
+		return queueCorrections
+	}
+	return queueGrievances
+}
+
+func queueSLA(queue string) int {
+	if queue == queueCorrections {
+		return *slaCorrectionDays
+	}
+	return *slaGrievanceDays
+}
+
+type QueueStats struct {
+	Queue        string         `json:"queue"`
+	Zone         string         `json:"zone"`
+	SLADays      int            `json:"sla_days"`
+	Received     int            `json:"received"`
+	Disposed     int            `json:"disposed"`
+	Open         int            `json:"open"`
+	DisposalPct  float64        `json:"disposal_pct"`
+	AvgDays      float64        `json:"avg_days"`
+	MedianDays   int            `json:"median_days"`
+	WithinSLAPct float64        `json:"within_sla_pct"`
+	Breached     int            `json:"open_past_sla"`
+	Ageing       map[string]int `json:"ageing"`
+	days         []int
+	within       int
+}
+
+// queueStats summarises tickets filed since (zero = all) per queue and zone;
+// each queue ends with its ALL row.
+func queueStats(tickets []Ticket, since, now time.Time) []QueueStats {
+	rows := map[[2]string]*QueueStats{}
+	row := func(q, z string) *QueueStats {
+		k := [2]string{q, z}
+		if rows[k] == nil {
+			s := &QueueStats{Queue: q, Zone: z, SLADays: queueSLA(q), Ageing: map[string]int{}}
+			for _, b := range ageingBuckets {
+				s.Ageing[b.Label] = 0
+			}
+			rows[k] = s
+		}
+		return rows[k]
+	}
+	row(queueCorrections, allZones)
+	row(queueGrievances, allZones)
+	for _, tk := range tickets {
+		if tk.Created.Before(since) {
+			continue
+		}
+		q := ticketQueue(tk)
+		age := tk.ageDays(now)
+		for _, s := range []*QueueStats{row(q, tk.Zone), row(q, allZones)} {
+			s.Received++
+			if tk.isOpen() {
+				s.Open++
+				for _, b := range ageingBuckets {
+					if age <= b.Max {
+						s.Ageing[b.Label]++
+						break
+					}
+				}
+				if age > s.SLADays {
+					s.Breached++
+				}
+				continue
+			}
+			s.Disposed++
+			s.days = append(s.days, age)
+			if age <= s.SLADays {
+				s.within++
+			}
+		}
+	}
+	out := make([]QueueStats, 0, len(rows))
+	for _, s := range rows {
+		s.DisposalPct = pct1(s.Disposed, s.Received)
+		s.WithinSLAPct = pct1(s.within, s.Disposed)
+		if n := len(s.days); n > 0 {
+			sort.Ints(s.days)
+			sum := 0
+			for _, d := range s.days {
+				sum += d
+			}
+			s.AvgDays = float64(int(float64(sum)/float64(n)*10+0.5)) / 10
+			s.MedianDays = s.days[n/2]
+		}
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Queue != out[j].Queue {
+			return out[i].Queue < out[j].Queue
+		}
+		if (out[i].Zone == allZones) != (out[j].Zone == allZones) {
+			return out[j].Zone == allZones
+		}
+		return out[i].Zone < out[j].Zone
+	})
+	return out
+}
+
+func slaSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("since must be YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+// GET /api/sla
+func handleAPISLA(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	since, err := slaSince(r.URL.Query().Get("since"))
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	queue := r.URL.Query().Get("queue")
+	out := []QueueStats{}
+	for _, s := range queueStats(tenantFor(r).grievances().List(), since, time.Now()) {
+		if queue == "" || s.Queue == queue {
+			out = append(out, s)
+		}
+	}
+	writeData(w, out, &Meta{Count: len(out)})
+}
+
+// queueTable renders stats as an HTML table; inline styles so it survives
+// mail clients.
+func queueTable(stats []QueueStats, queue string) string {
+	td := `style="border:1px solid #cbd5e1;padding:4px 6px;text-align:right"`
+	var b strings.Builder
+	fmt.Fprintf(&b, `<table style="border-collapse:collapse;font-size:13px"><tr><th %s>Zone</th><th %s>Received</th><th %s>Disposed</th>`+
+		`<th %s>Disposal %%</th><th %s>Avg days</th><th %s>Within SLA %%</th><th %s>Open</th><th %s>Open past SLA</th>`, td, td, td, td, td, td, td, td)
+	for _, a := range ageingBuckets {
+		fmt.Fprintf(&b, `<th %s>Open %s d</th>`, td, html.EscapeString(a.Label))
+	}
+	b.WriteString("</tr>")
+	for _, s := range stats {
+		if s.Queue != queue {
+			continue
+		}
+		fmt.Fprintf(&b, `<tr><td %s>%s</td><td %s>%d</td><td %s>%d</td><td %s>%.1f</td><td %s>%.1f</td><td %s>%.1f</td><td %s>%d</td><td %s>%d</td>`,
+			td, html.EscapeString(s.Zone), td, s.Received, td, s.Disposed, td, s.DisposalPct, td, s.AvgDays, td, s.WithinSLAPct, td, s.Open, td, s.Breached)
+		for _, a := range ageingBuckets {
+			fmt.Fprintf(&b, `<td %s>%d</td>`, td, s.Ageing[a.Label])
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString("</table>")
+	return b.String()
+}
+
+// digestQueues is the weekly digest's queue section.
+func digestQueues(t *Tenant, ds *Dataset, now time.Time) string {
+	if t.Grievances == "" {
+		return ""
+	}
+	stats := queueStats(t.grievances().List(), time.Time{}, now)
+	var b strings.Builder
+	for _, s := range stats {
+		if s.Zone == allZones && s.Received > 0 {
+			fmt.Fprintf(&b, `<p><b>%s</b> (SLA %d days): %d received, %d disposed (%.1f%%, %.1f%% within SLA), %d open, %d past SLA.</p>`,
+				queueLabels[s.Queue], s.SLADays, s.Received, s.Disposed, s.DisposalPct, s.WithinSLAPct, s.Open, s.Breached)
+			b.WriteString(queueTable(stats, s.Queue))
+		}
+	}
+	return b.String()
+}
+
+// GET /admin/queues
+func handleAdminQueues(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	stats := queueStats(t.grievances().List(), time.Time{}, time.Now())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Queues – %s</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}table{margin-bottom:24px}th{background:#1b263b}</style></head>
+<body><h1>Correction and grievance queues</h1>
+<h2>Correction requests (SLA %d days)</h2>%s
+<h2>Grievances (SLA %d days)</h2>%s
+<p><a style="color:#93c5fd" href="%s/api/sla">JSON</a></p></body></html>`,
+		html.EscapeString(t.PageTitle()), *slaCorrectionDays, queueTable(stats, queueCorrections),
+		*slaGrievanceDays, queueTable(stats, queueGrievances), t.Prefix)
+}
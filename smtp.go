@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---- SMTP transport ----
+//
+// How mail reaches the SMTP server, for HQ's -smtp-* account and the
+// accounts in the senders file alike. -smtp-tls picks implicit TLS (the
+// connection is TLS from the start, usually port 465), STARTTLS (plain
+// connection upgraded before logging in, usually 587 or 25) or none (a
+// relay on the local network that needs neither); "auto" means implicit
+// TLS on port 465 and STARTTLS elsewhere. -smtp-auth picks PLAIN, LOGIN
+// (some Exchange and NIC servers only offer this), CRAM-MD5 or none.
+// Server certificates are verified against the system roots plus -smtp-ca;
+// -smtp-insecure-skip-verify turns that off for a relay with a self-signed
+// certificate nobody will fix. For example, the NIC relay:
+//
+//	-smtp-host smtp.mgovcloud.in -smtp-port 587 -smtp-tls starttls -smtp-auth login
+//
+// A senders file account may set "tls" and "auth" the same way.
+
+var (
+	smtpTLS      = flag.String("smtp-tls", smtpTLSAuto, "HQ SMTP transport security: auto, implicit, starttls or none")
+	smtpAuth     = flag.String("smtp-auth", smtpAuthPlain, "HQ SMTP login mechanism: plain, login, cram-md5 or none")
+	smtpCA       = flag.String("smtp-ca", "", "PEM file of extra CA certificates to trust for SMTP servers")
+	smtpInsecure = flag.Bool("smtp-insecure-skip-verify", false, "Don't verify SMTP server certificates (unsafe)")
+)
+
+const (
+	smtpTLSAuto     = "auto"
+	smtpTLSImplicit = "implicit"
+	smtpTLSStart    = "starttls"
+	smtpTLSNone     = "none"
+
+	smtpAuthPlain = "plain"
+	smtpAuthLogin = "login"
+	smtpAuthCRAM  = "cram-md5"
+	smtpAuthNone  = "none"
+)
+
+// check rejects an unknown provider, TLS or auth setting, or an account
+// missing what its provider needs.
+func (a *SMTPAccount) check() error {
+	switch a.Provider {
+	case "", providerSMTP:
+		if a.Host == "" || (a.User == "" && a.Auth != smtpAuthNone) {
+			return errors.New("host and user required")
+		}
+	case providerSendGrid:
+		return nil
+	case providerSES:
+		if a.Region == "" && a.Host == "" {
+			return errors.New("ses needs a region")
+		}
+		return nil
+	default:
+		return fmt.Errorf("provider %q: want smtp, sendgrid or ses", a.Provider)
+	}
+	switch a.TLS {
+	case "", smtpTLSAuto, smtpTLSImplicit, smtpTLSStart, smtpTLSNone:
+	default:
+		return fmt.Errorf("tls %q: want auto, implicit, starttls or none", a.TLS)
+	}
+	switch a.Auth {
+	case "", smtpAuthPlain, smtpAuthLogin, smtpAuthCRAM, smtpAuthNone:
+	default:
+		return fmt.Errorf("auth %q: want plain, login, cram-md5 or none", a.Auth)
+	}
+	return nil
+}
+
+func (a *SMTPAccount) tlsMode() string {
+	switch {
+	case a.TLS != "" && a.TLS != smtpTLSAuto:
+		return a.TLS
+	case a.Port == 465:
+		return smtpTLSImplicit
+	}
+	return smtpTLSStart
+}
+
+// needsPass reports whether the account logs in with a password (or, for
+// SendGrid, an API key).
+func (a *SMTPAccount) needsPass() bool {
+	return a.Auth != smtpAuthNone && (a.Provider != providerSES || a.User != "")
+}
+
+func (a *SMTPAccount) smtpAuth() smtp.Auth {
+	switch a.Auth {
+	case smtpAuthNone:
+		return nil
+	case smtpAuthLogin:
+		return &loginAuth{user: a.User, pass: a.Pass, host: a.Host}
+	case smtpAuthCRAM:
+		return smtp.CRAMMD5Auth(a.User, a.Pass)
+	}
+	return smtp.PlainAuth("", a.User, a.Pass, a.Host)
+}
+
+// loginAuth is the LOGIN mechanism, which net/smtp doesn't provide. Like
+// PLAIN it won't send the password over an unencrypted connection except
+// to localhost.
+type loginAuth struct{ user, pass, host string }
+
+func (l *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && l.host != "localhost" && l.host != "127.0.0.1" && l.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != l.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (l *loginAuth) Next(prompt []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(prompt) {
+	case "Username:", "User Name\x00":
+		return []byte(l.user), nil
+	case "Password:", "Password\x00":
+		return []byte(l.pass), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN prompt %q", prompt)
+}
+
+var smtpRoots = sync.OnceValues(func() (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if *smtpCA == "" {
+		return pool, nil
+	}
+	b, err := os.ReadFile(*smtpCA)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s: no PEM certificates", *smtpCA)
+	}
+	return pool, nil
+})
+
+func smtpTLSConfig(host string) (*tls.Config, error) {
+	roots, err := smtpRoots()
+	if err != nil {
+		return nil, fmt.Errorf("smtp-ca: %v", err)
+	}
+	return &tls.Config{ServerName: host, RootCAs: roots, MinVersion: tls.VersionTLS12, InsecureSkipVerify: *smtpInsecure}, nil
+}
+
+// smtpSend delivers a ready message through s's account.
+func smtpSend(s Sender, to string, msg []byte) error {
+	a := s.account
+	addr := net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	tlsConfig, err := smtpTLSConfig(a.Host)
+	if err != nil {
+		return err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	mode := a.tlsMode()
+	if mode == smtpTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	c, err := smtp.NewClient(conn, a.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if mode == smtpTLSStart {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s doesn't offer STARTTLS (set tls to implicit or none)", addr)
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if auth := a.smtpAuth(); auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(s.From); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	// Close reads the server's verdict on the message itself.
+	if err = w.Close(); err != nil {
+		return err
+	}
+	_ = c.Quit()
+	return nil
+}
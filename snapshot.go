@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Snapshots ----
+//
+// A snapshot freezes the headline metrics of one build under a tag such as
+// "Sept-2025-final". Metrics are flat "scope.name" keys so any two snapshots
+// can be diffed without knowing which zones existed in either. Admins tag
+// the current build; an existing tag is only replaced on request:
+//
+//	POST /snapshot/tag?name=Sept-2025-final[&replace=1]
+
+var (
+	snapshotDir = flag.String("snapshots", "./out/snapshots", "Directory for tagged build snapshots")
+	snapshotTag = flag.String("tag", "", "Tag the startup build with this snapshot name (optional)")
+
+	rxSnapshotTag = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+)
+
+const currentSnapshot = "current"
+
+var errSnapshotTag = errors.New("invalid snapshot tag")
+
+type Snapshot struct {
+	Tag       string             `json:"tag"`
+	CreatedAt time.Time          `json:"created_at"`
+	Inputs    map[string]string  `json:"inputs"`
+	Metrics   map[string]float64 `json:"metrics,omitempty"`
+}
+
+type MetricDelta struct {
+	Metric string   `json:"metric"`
+	From   *float64 `json:"from"`
+	To     *float64 `json:"to"`
+	Delta  float64  `json:"delta"`
+	Pct    *float64 `json:"pct,omitempty"`
+}
+
+func snapshotMetrics(emp map[string]Emp, sch map[string]School, score []ZoneScore) map[string]float64 {
+	m := map[string]float64{}
+	add := func(k string, v float64) { m[k] += v }
+	for _, e := range emp {
+		add("total.employees", 1)
+		add("zone."+e.Zone+".employees", 1)
+	}
+	for _, s := range sch {
+		add("total.schools", 1)
+		add("total.enrolment", float64(s.TotalEnrolment))
+		add("total.dbt_total", float64(s.DBTTotal))
+		add("total.with_aadhaar", float64(s.WithAadhaar))
+		add("total.with_account", float64(s.WithAccount))
+		add("zone."+s.Zone+".schools", 1)
+		add("zone."+s.Zone+".enrolment", float64(s.TotalEnrolment))
+		add("zone."+s.Zone+".dbt_total", float64(s.DBTTotal))
+		add("zone."+s.Zone+".with_aadhaar", float64(s.WithAadhaar))
+	}
+	for _, z := range score {
+		m["zone."+z.Zone+".teachers"] = float64(z.Teachers)
+		m["zone."+z.Zone+".needed_teachers"] = float64(z.NeededTeachers)
+		m["zone."+z.Zone+".score_overall"] = z.Overall
+		m["zone."+z.Zone+".rank"] = float64(z.Rank)
+	}
+	return m
+}
+
+func currentSnapshotData(t *Tenant) Snapshot {
+	ds := t.Data()
+	return Snapshot{
+		Tag:       currentSnapshot,
+		CreatedAt: ds.BuiltAt,
+		Inputs:    map[string]string{"basic": ds.Inputs.Basic, "services": ds.Inputs.Services, "dbt": ds.Inputs.DBT, "infra": ds.Inputs.Infra, "mdm": ds.Inputs.MDM, "profile": ds.Profile},
+		Metrics:   snapshotMetrics(ds.EMP, ds.SCH, ds.SCORECARD),
+	}
+}
+
+func snapshotPath(t *Tenant, tag string) string { return filepath.Join(t.SnapshotDir, tag+".json") }
+
+func saveSnapshot(t *Tenant, tag string) (Snapshot, error) {
+	if !rxSnapshotTag.MatchString(tag) || strings.EqualFold(tag, currentSnapshot) {
+		return Snapshot{}, fmt.Errorf("%w %q", errSnapshotTag, tag)
+	}
+	snap := currentSnapshotData(t)
+	snap.Tag = tag
+	return snap, writeSnapshot(snapshotPath(t, tag), snap)
+}
+
+func writeSnapshot(path string, snap Snapshot) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func readSnapshot(path string) (Snapshot, error) {
+	var snap Snapshot
+	b, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(b, &snap)
+	}
+	return snap, err
+}
+
+func loadSnapshot(t *Tenant, tag string) (Snapshot, error) {
+	if tag == currentSnapshot {
+		return currentSnapshotData(t), nil
+	}
+	if !rxSnapshotTag.MatchString(tag) {
+		return Snapshot{}, fmt.Errorf("invalid tag %q", tag)
+	}
+	return readSnapshot(snapshotPath(t, tag))
+}
+
+func listSnapshots(t *Tenant) []Snapshot {
+	out := []Snapshot{}
+	files, _ := filepath.Glob(filepath.Join(t.SnapshotDir, "*.json"))
+	for _, f := range files {
+		snap, err := loadSnapshot(t, strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			continue
+		}
+		snap.Metrics = nil
+		out = append(out, snap)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func compareSnapshots(from, to Snapshot) []MetricDelta {
+	keys := map[string]bool{}
+	for k := range from.Metrics {
+		keys[k] = true
+	}
+	for k := range to.Metrics {
+		keys[k] = true
+	}
+	out := make([]MetricDelta, 0, len(keys))
+	for k := range keys {
+		d := MetricDelta{Metric: k}
+		fv, fok := from.Metrics[k]
+		tv, tok := to.Metrics[k]
+		if fok {
+			d.From = &fv
+		}
+		if tok {
+			d.To = &tv
+		}
+		d.Delta = tv - fv
+		if fok && tok && fv != 0 {
+			p := math.Round(d.Delta/fv*1000) / 10
+			d.Pct = &p
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Metric < out[j].Metric })
+	return out
+}
+
+func handleAPISnapshots(w http.ResponseWriter, r *http.Request) {
+	writeData(w, listSnapshots(tenantFor(r)), nil)
+}
+
+func handleSnapshotTag(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, tag := tenantFor(r), strings.TrimSpace(r.URL.Query().Get("name"))
+	if !rxSnapshotTag.MatchString(tag) {
+		writeError(w, 400, errBadRequest, "invalid tag "+strconv.Quote(tag))
+		return
+	}
+	if _, err := os.Stat(snapshotPath(t, tag)); err == nil && r.URL.Query().Get("replace") != "1" {
+		writeError(w, 409, errConflict, "snapshot "+tag+" exists; add replace=1 to overwrite it")
+		return
+	}
+	snap, err := saveSnapshot(t, tag)
+	if errors.Is(err, errSnapshotTag) {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	snap.Metrics = nil
+	writeData(w, snap, nil)
+}
+
+func handleCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fromTag, toTag := strings.TrimSpace(q.Get("from")), strings.TrimSpace(q.Get("to"))
+	if fromTag == "" {
+		writeError(w, 400, errBadRequest, "missing from")
+		return
+	}
+	if toTag == "" {
+		toTag = currentSnapshot
+	}
+	t := tenantFor(r)
+	from, err := loadSnapshot(t, fromTag)
+	if err != nil {
+		writeError(w, 404, errNotFound, "snapshot "+fromTag+" not found")
+		return
+	}
+	to, err := loadSnapshot(t, toTag)
+	if err != nil {
+		writeError(w, 404, errNotFound, "snapshot "+toTag+" not found")
+		return
+	}
+	deltas := compareSnapshots(from, to)
+	if prefix := q.Get("prefix"); prefix != "" {
+		kept := deltas[:0]
+		for _, d := range deltas {
+			if strings.HasPrefix(d.Metric, prefix) {
+				kept = append(kept, d)
+			}
+		}
+		deltas = kept
+	}
+	writeData(w, map[string]any{
+		"from":   from.Tag,
+		"to":     to.Tag,
+		"deltas": deltas,
+	}, &Meta{Count: len(deltas)})
+}
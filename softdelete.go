@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// ---- Soft delete ----
+//
+// Removing an override (overrides.go), a notification preference record
+// (prefs.go) or a blackout (blackout.go) only marks it deleted, with who and
+// when, so a slip during cleanup can be undone. A deleted entry no longer
+// takes effect; it is listed with ?deleted=1 and comes back with restore:
+//
+//	DELETE /api/overrides?emp=&field=     POST /api/overrides/restore?emp=&field=
+//	DELETE /api/prefs?id=                 POST /api/prefs/restore?id=
+//	DELETE /api/blackout?kind=&id=        POST /api/blackout/restore?kind=&id=
+//
+// Writing the entry afresh (an import, a sync, a POST) replaces a deleted
+// one.
+
+// Deletion records who deleted an entry and when.
+type Deletion struct {
+	At time.Time `json:"at"`
+	By string    `json:"by"`
+}
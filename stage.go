@@ -0,0 +1,273 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- Staged builds ----
+//
+// With -stage a rebuild (new files on disk, a fetch, an HRMS sync, /refresh)
+// isn't served straight away. It is held next to the served build with a
+// summary of what it changes, zone by zone, and zone figures moving by
+// -stage-swing percent or more are flagged. The dashboard, its data files,
+// the exports, history and feeds all keep using the served build until an
+// admin approves the staged one:
+//
+//	GET  /admin/stage                        the summary with Approve/Reject
+//	GET  /api/v1/build/staged                the same as JSON
+//	POST /api/v1/build/staged/approve
+//	POST /api/v1/build/staged/reject
+//
+// An approved build is archived for its month (archive.go).
+// A newer rebuild replaces a staged one that hasn't been decided on. The
+// build made at startup is served as before, since there is nothing to
+// compare it with; a staged build is lost if the server restarts. A rebuild
+// with anomalous inputs (inputchecks.go) is staged even without -stage,
+// and its anomalies head the summary.
+
+var (
+	stageBuilds = flag.Bool("stage", false, "Hold each rebuild for an admin to approve before it is served")
+	stageSwing  = flag.Float64("stage-swing", 10, "Flag zone figures a staged build moves by at least this percent")
+)
+
+type stagedBuild struct {
+	ds      *Dataset
+	profile *Profile
+	summary StageSummary
+}
+
+// StageDelta is one metric's change, flagged when it is a big swing.
+type StageDelta struct {
+	MetricDelta
+	Swing bool `json:"swing,omitempty"`
+}
+
+type StageZone struct {
+	Zone    string       `json:"zone"`
+	Deltas  []StageDelta `json:"deltas"`
+	Swings  int          `json:"swings"`
+	New     bool         `json:"new,omitempty"`
+	Dropped bool         `json:"dropped,omitempty"`
+}
+
+type StageSummary struct {
+	Tenant    string         `json:"tenant"`
+	StagedAt  time.Time      `json:"staged_at"`
+	ServedAt  time.Time      `json:"served_built_at"`
+	Profile   string         `json:"profile,omitempty"`
+	Totals    []StageDelta   `json:"totals"`
+	Zones     []StageZone    `json:"zones"` // only zones with changes, most swings first
+	Swings    int            `json:"swings"`
+	Anomalies []InputAnomaly `json:"anomalies"`
+	Inputs    []InputFile    `json:"inputs"`
+}
+
+// stageSummary compares the served build with a staged one. Ranks are left
+// out: they follow from the scores.
+func stageSummary(t *Tenant, served, staged *Dataset, anomalies []InputAnomaly) StageSummary {
+	from := Snapshot{Metrics: snapshotMetrics(served.EMP, served.SCH, served.SCORECARD)}
+	to := Snapshot{Metrics: snapshotMetrics(staged.EMP, staged.SCH, staged.SCORECARD)}
+	sum := StageSummary{Tenant: t.ID, StagedAt: staged.BuiltAt, ServedAt: served.BuiltAt, Profile: staged.Profile,
+		Totals: []StageDelta{}, Zones: []StageZone{}, Anomalies: anomalies, Inputs: staged.Provenance}
+	zones := map[string]*StageZone{}
+	for _, d := range compareSnapshots(from, to) {
+		if d.Delta == 0 && d.From != nil && d.To != nil {
+			continue
+		}
+		sd := StageDelta{MetricDelta: d, Swing: d.From == nil || d.To == nil || (d.Pct != nil && math.Abs(*d.Pct) >= *stageSwing)}
+		if total, ok := strings.CutPrefix(d.Metric, "total."); ok {
+			sd.Metric = total
+			sum.Totals = append(sum.Totals, sd)
+			continue
+		}
+		rest, ok := strings.CutPrefix(d.Metric, "zone.")
+		i := strings.LastIndex(rest, ".")
+		if !ok || i < 0 || rest[i+1:] == "rank" {
+			continue
+		}
+		name := rest[:i]
+		z := zones[name]
+		if z == nil {
+			z = &StageZone{Zone: name}
+			zones[name] = z
+		}
+		sd.Metric = rest[i+1:]
+		z.Deltas = append(z.Deltas, sd)
+		if sd.Swing {
+			z.Swings++
+			sum.Swings++
+		}
+	}
+	for _, z := range zones {
+		z.New, z.Dropped = !hasMetric(from.Metrics, z.Zone), !hasMetric(to.Metrics, z.Zone)
+		sum.Zones = append(sum.Zones, *z)
+	}
+	sort.Slice(sum.Zones, func(i, j int) bool {
+		if sum.Zones[i].Swings != sum.Zones[j].Swings {
+			return sum.Zones[i].Swings > sum.Zones[j].Swings
+		}
+		return sum.Zones[i].Zone < sum.Zones[j].Zone
+	})
+	return sum
+}
+
+func hasMetric(m map[string]float64, zone string) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "zone."+zone+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// stage holds ds for approval in place of any earlier staged build.
+func (t *Tenant) stage(ds *Dataset, p *Profile, anomalies []InputAnomaly) {
+	sum := stageSummary(t, t.data.Load(), ds, anomalies)
+	t.staged.Store(&stagedBuild{ds: ds, profile: p, summary: sum})
+	t.failed.Store(nil)
+	log.Printf("🧪 Build of %s staged for approval: %d employees, %d schools, %d big swing(s), %d anomaly(s)", t.ID, len(ds.EMP), len(ds.SCH), sum.Swings, len(anomalies))
+}
+
+// GET /api/v1/build/staged
+func handleAPIStaged(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	st := tenantFor(r).staged.Load()
+	if st == nil {
+		writeError(w, 404, errNotFound, "no build is waiting for approval")
+		return
+	}
+	writeData(w, st.summary, &Meta{Count: len(st.summary.Zones)})
+}
+
+// POST /api/v1/build/staged/{approve,reject}
+func handleStagedDecision(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	decision := r.PathValue("decision")
+	if decision != "approve" && decision != "reject" {
+		writeError(w, 404, errNotFound, "use approve or reject")
+		return
+	}
+	t, u := tenantFor(r), userFor(r)
+	st := t.staged.Load()
+	// Swap rather than clear, so two admins deciding at once can't both
+	// act on it and a rebuild staged meanwhile isn't lost.
+	if st == nil || !t.staged.CompareAndSwap(st, nil) {
+		writeError(w, 409, errConflict, "no build is waiting for approval")
+		return
+	}
+	out := map[string]any{"tenant": t.ID, "decision": decision, "built_at": st.ds.BuiltAt}
+	if decision == "approve" {
+		t.publish(st.ds, st.profile)
+		log.Printf("🧪 Staged build of %s approved by %s and now served", t.ID, u.Name)
+		if t.ArchiveDir != "" {
+			if e, err := archiveBuild(t, st.ds, u.Name); err != nil {
+				log.Printf("archive %s: %v", t.ID, err)
+			} else {
+				out["archive"] = e.Permalink
+			}
+		}
+	} else {
+		sig := st.ds.inputsSig
+		t.skipSig.Store(&sig) // don't rebuild the same files again
+		log.Printf("🧪 Staged build of %s rejected by %s", t.ID, u.Name)
+	}
+	writeData(w, out, nil)
+}
+
+// GET /admin/stage
+func handleAdminStage(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t := tenantFor(r)
+	e := html.EscapeString
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	head := `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>Staged build</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}table{border-collapse:collapse;width:100%}
+td,th{border:1px solid #334155;padding:6px;text-align:left;font-size:13px}th{background:#1b263b}.swing{background:#7f1d1d}
+.anomalies{background:#7f1d1d;padding:10px 14px;border-radius:6px}</style></head><body>`
+	st := t.staged.Load()
+	if st == nil {
+		fmt.Fprintf(w, `%s<h1>No build waiting for approval</h1><p>Serving the build of %s.</p></body></html>`,
+			head, t.Data().BuiltAt.Format("02 Jan 2006 15:04"))
+		return
+	}
+	sum := st.summary
+	num := func(v float64) string { return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64) }
+	ptr := func(v *float64) string {
+		if v == nil {
+			return "–"
+		}
+		return num(*v)
+	}
+	row := func(b *strings.Builder, scope string, d StageDelta) {
+		cls, pct := "", ""
+		if d.Swing {
+			cls = ` class="swing"`
+		}
+		if d.Pct != nil {
+			pct = fmt.Sprintf("%+.1f%%", *d.Pct)
+		}
+		fmt.Fprintf(b, `<tr%s><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			cls, e(scope), e(d.Metric), ptr(d.From), ptr(d.To), num(d.Delta), pct)
+	}
+	var rows strings.Builder
+	for _, d := range sum.Totals {
+		row(&rows, "All zones", d)
+	}
+	for _, z := range sum.Zones {
+		scope := z.Zone
+		switch {
+		case z.New:
+			scope += " (new)"
+		case z.Dropped:
+			scope += " (gone)"
+		}
+		for _, d := range z.Deltas {
+			row(&rows, scope, d)
+		}
+	}
+	if rows.Len() == 0 {
+		rows.WriteString(`<tr><td colspan="6">No figure changes</td></tr>`)
+	}
+	var anomalies strings.Builder
+	if len(sum.Anomalies) > 0 {
+		anomalies.WriteString(`<div class="anomalies"><h2>⚠️ Anomalous inputs</h2><ul>`)
+		for _, a := range sum.Anomalies {
+			fmt.Fprintf(&anomalies, `<li>%s</li>`, e(a.Detail))
+		}
+		anomalies.WriteString(`</ul><p>Check the upstream export before approving.</p></div>`)
+	}
+	fmt.Fprintf(w, `%s<h1>Staged build of %s</h1>
+<p>Built %s from the files below; serving the build of %s. %d figure(s) moved by %g%% or more.</p>
+%s
+<p><button onclick="decide('approve')">Approve and serve</button> <button onclick="if(confirm('Discard this build?'))decide('reject')">Reject</button></p>
+<table><thead><tr><th>Zone</th><th>Figure</th><th>Served</th><th>Staged</th><th>Change</th><th>%%</th></tr></thead>
+<tbody>%s</tbody></table>
+<h2>Inputs</h2><ul>`, head, e(t.ID), sum.StagedAt.Format("02 Jan 2006 15:04"), sum.ServedAt.Format("02 Jan 2006 15:04"),
+		sum.Swings, *stageSwing, anomalies.String(), rows.String())
+	for _, f := range sum.Inputs {
+		fmt.Fprintf(w, `<li>%s: %s <code>%s</code></li>`, e(f.Role), e(f.Name), e(f.SHA256[:min(12, len(f.SHA256))]))
+	}
+	fmt.Fprintf(w, `</ul>
+<script>
+function decide(d){
+  fetch(%q+'/api/v1/build/staged/'+d,{method:'POST'}).then(function(r){return r.json();})
+    .then(function(j){ if(j.errors){alert(j.errors[0].detail);return;} location.href=%q+'/'; });
+}
+</script></body></html>`, t.Prefix, t.Prefix)
+}
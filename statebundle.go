@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- State bundles ----
+//
+// The state staff build up through the API (overrides, the blackout list,
+// notification preferences, saved views, email templates and campaign
+// variants, export subscriptions) and the files in the tenant's template
+// directory travel between instances as one JSON bundle, so a staging
+// configuration can be promoted to production as tested:
+//
+//	mcd export-state staging.json [tenant]
+//	mcd import-state -dry-run staging.json [tenant]   what would change
+//	mcd import-state staging.json [tenant]
+//
+// Each part in the bundle replaces the tenant's file wholesale; parts the
+// bundle lacks (the source had no such file) are left alone. Every part is
+// checked before any is written. A running server keeps these stores in
+// memory, so import while it is stopped or restart it afterwards.
+
+const stateBundleFormat = "mcd-state/1"
+
+type StateBundle struct {
+	Format        string                     `json:"format"`
+	Tenant        string                     `json:"tenant"`
+	Exported      time.Time                  `json:"exported"`
+	Parts         map[string]json.RawMessage `json:"parts"`                    // by stateParts name
+	TemplateFiles map[string]string          `json:"template_files,omitempty"` // <name>.html -> content
+}
+
+// statePart is one file of a bundle: where the tenant keeps it and how many
+// entries a copy of it holds (an error if it doesn't read as one).
+type statePart struct {
+	name  string
+	path  func(t *Tenant) string
+	count func(b []byte) (int, error)
+}
+
+var stateParts = []statePart{
+	{"overrides", func(t *Tenant) string { return t.Overrides }, func(b []byte) (int, error) {
+		var ov Overrides
+		err := json.Unmarshal(b, &ov)
+		n := 0
+		for _, fields := range ov.Emp {
+			n += len(fields)
+		}
+		return n, err
+	}},
+	{"blackout", func(t *Tenant) string { return t.Blackout }, func(b []byte) (int, error) {
+		var l []BlackoutEntry
+		err := json.Unmarshal(b, &l)
+		return len(l), err
+	}},
+	{"prefs", func(t *Tenant) string { return t.Prefs }, func(b []byte) (int, error) {
+		var m map[string]NotificationPrefs
+		err := json.Unmarshal(b, &m)
+		return len(m), err
+	}},
+	{"views", func(t *Tenant) string { return t.Views }, func(b []byte) (int, error) {
+		var m map[string]SavedView
+		err := json.Unmarshal(b, &m)
+		return len(m), err
+	}},
+	{"templates", func(t *Tenant) string { return t.EmailTemplates }, func(b []byte) (int, error) {
+		var s templateStore
+		err := json.Unmarshal(b, &s)
+		n := len(s.Campaigns)
+		for _, vs := range s.Templates {
+			n += len(vs)
+		}
+		return n, err
+	}},
+	{"subscriptions", func(t *Tenant) string { return t.Subscriptions }, func(b []byte) (int, error) {
+		var d subscriptionDesk
+		err := json.Unmarshal(b, &d)
+		return len(d.Subs), err
+	}},
+}
+
+// exportState reads t's state into a bundle.
+func exportState(t *Tenant) (StateBundle, error) {
+	sb := StateBundle{Format: stateBundleFormat, Tenant: t.ID, Exported: time.Now(), Parts: map[string]json.RawMessage{}}
+	for _, p := range stateParts {
+		path := p.path(t)
+		if path == "" {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return sb, err
+		}
+		if _, err := p.count(b); err != nil {
+			return sb, fmt.Errorf("%s %s: %v", p.name, path, err)
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b); err != nil {
+			return sb, fmt.Errorf("%s %s: %v", p.name, path, err)
+		}
+		sb.Parts[p.name] = buf.Bytes()
+	}
+	if t.EmailTplDir != "" {
+		files, err := filepath.Glob(filepath.Join(t.EmailTplDir, "*.html"))
+		if err != nil {
+			return sb, err
+		}
+		for _, f := range files {
+			b, err := os.ReadFile(f)
+			if err != nil {
+				return sb, err
+			}
+			if sb.TemplateFiles == nil {
+				sb.TemplateFiles = map[string]string{}
+			}
+			sb.TemplateFiles[filepath.Base(f)] = string(b)
+		}
+	}
+	return sb, nil
+}
+
+// StateChange is what importing a bundle does to one file.
+type StateChange struct {
+	Part    string `json:"part"`
+	Path    string `json:"path"`
+	Entries int    `json:"entries"`
+	Was     int    `json:"was"` // entries in the file replaced, -1 when there was none
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// importState checks sb against t and, unless dryRun, writes it over t's
+// files.
+func importState(t *Tenant, sb StateBundle, dryRun bool) ([]StateChange, error) {
+	if sb.Format != stateBundleFormat {
+		return nil, fmt.Errorf("not a state bundle (format %q, want %q)", sb.Format, stateBundleFormat)
+	}
+	known := map[string]bool{}
+	for _, p := range stateParts {
+		known[p.name] = true
+	}
+	for name := range sb.Parts {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown part %q in the bundle", name)
+		}
+	}
+
+	var changes []StateChange
+	writes := map[string][]byte{}
+	for _, p := range stateParts {
+		b, ok := sb.Parts[p.name]
+		if !ok {
+			continue
+		}
+		c := StateChange{Part: p.name, Path: p.path(t), Was: -1}
+		n, err := p.count(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.name, err)
+		}
+		c.Entries = n
+		if c.Path == "" {
+			c.Skipped = "no file configured"
+		} else {
+			if old, err := os.ReadFile(c.Path); err == nil {
+				if c.Was, err = p.count(old); err != nil {
+					c.Was = -1
+				}
+			}
+			var buf bytes.Buffer
+			if err := json.Indent(&buf, b, "", "  "); err != nil {
+				return nil, fmt.Errorf("%s: %v", p.name, err)
+			}
+			writes[c.Path] = buf.Bytes()
+		}
+		changes = append(changes, c)
+	}
+	if len(sb.TemplateFiles) > 0 {
+		c := StateChange{Part: "template_files", Path: t.EmailTplDir, Entries: len(sb.TemplateFiles), Was: -1}
+		if files, err := filepath.Glob(filepath.Join(t.EmailTplDir, "*.html")); err == nil && len(files) > 0 {
+			c.Was = len(files)
+		}
+		names := sortedKeys(sb.TemplateFiles)
+		for _, name := range names {
+			if name != filepath.Base(name) || !strings.HasSuffix(name, ".html") {
+				return nil, fmt.Errorf("template file %q: want a plain <name>.html", name)
+			}
+			if _, err := parseTemplateFile(strings.TrimSuffix(name, ".html"), []byte(sb.TemplateFiles[name])); err != nil {
+				return nil, fmt.Errorf("template file %s: %v", name, err)
+			}
+		}
+		if t.EmailTplDir == "" {
+			c.Skipped = "no template directory configured"
+		} else {
+			for _, name := range names {
+				writes[filepath.Join(t.EmailTplDir, name)] = []byte(sb.TemplateFiles[name])
+			}
+		}
+		changes = append(changes, c)
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	paths := make([]string, 0, len(writes))
+	for p := range writes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return changes, err
+		}
+		if err := os.WriteFile(p+".tmp", writes[p], 0644); err != nil {
+			return changes, err
+		}
+		if err := os.Rename(p+".tmp", p); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+func cmdExportState([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: export-state <bundle.json> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	sb, err := exportState(t)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(sb, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(args[0], b, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("state of %s written to %s: %s\n", t.ID, args[0], stateBundleNote(sb))
+	return nil
+}
+
+func cmdImportState([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: import-state [-dry-run] <bundle.json> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var sb StateBundle
+	if err := json.Unmarshal(b, &sb); err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	changes, err := importState(t, sb, *dryRun)
+	for _, c := range changes {
+		was := "new"
+		if c.Was >= 0 {
+			was = fmt.Sprintf("was %d", c.Was)
+		}
+		line := fmt.Sprintf("%-15s %s: %d entries (%s)", c.Part, c.Path, c.Entries, was)
+		if c.Skipped != "" {
+			line = fmt.Sprintf("%-15s skipped: %s", c.Part, c.Skipped)
+		}
+		fmt.Println(line)
+	}
+	if err != nil {
+		return err
+	}
+	mode := "imported into"
+	if *dryRun {
+		mode = "would be imported into (dry run)"
+	}
+	fmt.Printf("state of %s exported %s %s %s\n", sb.Tenant, sb.Exported.Format("2006-01-02 15:04"), mode, t.ID)
+	return nil
+}
+
+// stateBundleNote lists what sb carries.
+func stateBundleNote(sb StateBundle) string {
+	var parts []string
+	for _, p := range stateParts {
+		if _, ok := sb.Parts[p.name]; ok {
+			parts = append(parts, p.name)
+		}
+	}
+	if n := len(sb.TemplateFiles); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d template file(s)", n))
+	}
+	if len(parts) == 0 {
+		return "nothing (no state files yet)"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"myproject/ingest"
+)
+
+// ---- Build store ----
+//
+// With -db every build's employees, schools, per-school staff summaries and
+// demographics are written to one database (all tenants, keyed by build):
+// a SQLite file, or a postgres:// URL when several instances share it.
+// A build whose inputs hash the same as the tenant's last stored build is
+// not stored again, and on startup such a build is restored from the
+// database instead of reparsing the CSVs. Older builds stay, so figures can
+// be followed across months:
+//
+//	GET /api/v1/builds
+//	GET /api/v1/builds/history?zone=CENTRAL&monthly=1
+//	GET /api/v1/builds/history?school=1234567&format=csv
+//	GET /api/v1/builds/history?emp=95054834
+//
+// monthly=1 keeps the last build of each calendar month.
+
+var dbPath = flag.String("db", "", "SQLite file or postgres:// URL to persist each build to (e.g. ./mcd.db; empty = off)")
+
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS builds (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant        TEXT NOT NULL,
+	built_at      TEXT NOT NULL,
+	month         TEXT NOT NULL,
+	profile       TEXT NOT NULL DEFAULT '',
+	inputs_sha256 TEXT NOT NULL,
+	employees     INTEGER NOT NULL,
+	schools       INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS builds_tenant ON builds(tenant, id);
+CREATE TABLE IF NOT EXISTS employees (
+	build_id    INTEGER NOT NULL REFERENCES builds(id) ON DELETE CASCADE,
+	id          TEXT NOT NULL,
+	zone        TEXT NOT NULL,
+	designation TEXT NOT NULL,
+	school_id   TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (build_id, id)
+);
+CREATE INDEX IF NOT EXISTS employees_id ON employees(id);
+CREATE TABLE IF NOT EXISTS schools (
+	build_id    INTEGER NOT NULL REFERENCES builds(id) ON DELETE CASCADE,
+	id          TEXT NOT NULL,
+	zone        TEXT NOT NULL,
+	enrolment   INTEGER NOT NULL,
+	max_present INTEGER NOT NULL,
+	dbt_total   INTEGER NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (build_id, id)
+);
+CREATE INDEX IF NOT EXISTS schools_id ON schools(id);
+CREATE TABLE IF NOT EXISTS staff (
+	build_id             INTEGER NOT NULL REFERENCES builds(id) ON DELETE CASCADE,
+	school_id            TEXT NOT NULL,
+	zone                 TEXT NOT NULL,
+	needed_teachers      INTEGER NOT NULL,
+	actual_teachers      INTEGER NOT NULL,
+	surplus_vacancy      INTEGER NOT NULL,
+	has_principal        INTEGER NOT NULL,
+	has_special_educator INTEGER NOT NULL,
+	total_staff          INTEGER NOT NULL,
+	ratio                DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (build_id, school_id)
+);
+CREATE TABLE IF NOT EXISTS demographics (
+	build_id    INTEGER NOT NULL REFERENCES builds(id) ON DELETE CASCADE,
+	zone        TEXT NOT NULL,
+	designation TEXT NOT NULL,
+	total       INTEGER NOT NULL,
+	male        INTEGER NOT NULL,
+	female      INTEGER NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (build_id, zone, designation)
+);
+CREATE TABLE IF NOT EXISTS build_inputs (
+	build_id INTEGER NOT NULL REFERENCES builds(id) ON DELETE CASCADE,
+	role     TEXT NOT NULL,
+	path     TEXT NOT NULL,
+	sha256   TEXT NOT NULL,
+	size     BIGINT NOT NULL,
+	mtime    TEXT NOT NULL,
+	source   TEXT NOT NULL,
+	PRIMARY KEY (build_id, role)
+);
+CREATE TABLE IF NOT EXISTS leases (
+	name    TEXT PRIMARY KEY,
+	holder  TEXT NOT NULL,
+	expires BIGINT NOT NULL
+);
+`
+
+var (
+	storeOnce sync.Once
+	storeDB   *sql.DB
+	storePG   bool
+)
+
+// store opens -db on first use; nil when -db is off or won't open.
+func store() *sql.DB {
+	storeOnce.Do(func() {
+		if *dbPath == "" {
+			return
+		}
+		var db *sql.DB
+		var err error
+		if storePG = strings.HasPrefix(*dbPath, "postgres://") || strings.HasPrefix(*dbPath, "postgresql://"); storePG {
+			schema := strings.Replace(storeSchema, "INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY", 1)
+			if db, err = sql.Open("postgres", *dbPath); err == nil {
+				_, err = db.Exec(schema)
+			}
+		} else if db, err = sql.Open("sqlite3", *dbPath+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"); err == nil {
+			_, err = db.Exec(storeSchema)
+		}
+		if err != nil {
+			log.Printf("db %s: %v", dbName(), err)
+			return
+		}
+		storeDB = db
+	})
+	return storeDB
+}
+
+// dbName is -db for log lines, without a Postgres password.
+func dbName() string {
+	if u, err := url.Parse(*dbPath); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return *dbPath
+}
+
+// bind rewrites the ? and ?N placeholders used here to Postgres's $N.
+func bind(query string) string {
+	if !storePG {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		j := i + 1
+		for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+			j++
+		}
+		if j > i+1 {
+			b.WriteString("$" + query[i+1:j])
+			i = j - 1
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// inputsDigest hashes the contents of the files EMP and SCH are built from,
+// so an edited CSV (or override) is never answered from the database.
+func inputsDigest(in Inputs) string {
+	h := sha256.New()
+	for _, p := range []string{in.Basic, in.Services, in.DBT, in.Overrides, in.Infra, in.MDM, in.Results, in.Periods, in.Leave, in.Locations} {
+		fmt.Fprintf(h, "%s\x00", p)
+		if f, err := os.Open(p); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+		h.Write([]byte{0})
+	}
+	if *duplicatePolicy != ingest.DupLast {
+		fmt.Fprintf(h, "duplicates=%s\x00", *duplicatePolicy)
+	}
+	if *columnAliasFile != "" {
+		fmt.Fprintf(h, "columns=%s\x00", *columnAliasFile)
+		if f, err := os.Open(*columnAliasFile); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lastBuild is the tenant's newest stored build id and inputs hash.
+func lastBuild(db *sql.DB, tenant string) (id int64, digest string, err error) {
+	err = db.QueryRow(bind(`SELECT id, inputs_sha256 FROM builds WHERE tenant = ? ORDER BY id DESC LIMIT 1`), tenant).Scan(&id, &digest)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return id, digest, err
+}
+
+// restoreBuild rebuilds the dataset from the tenant's last stored build
+// when its inputs are unchanged; nil otherwise. Records round-trip through
+// JSON, so stray non-UTF-8 bytes in the CSVs come back as U+FFFD.
+func restoreBuild(t *Tenant, in Inputs) *Dataset {
+	db := store()
+	if db == nil {
+		return nil
+	}
+	id, digest, err := lastBuild(db, t.ID)
+	if err != nil {
+		log.Printf("db %s: %v", dbName(), err)
+		return nil
+	}
+	if id == 0 || digest != inputsDigest(in) {
+		return nil
+	}
+	ds := &Dataset{Inputs: in, EMP: map[string]Emp{}, SCH: map[string]School{}, inputsSig: inputsSig(in)}
+	err = scanJSON(db, `SELECT data FROM employees WHERE build_id = ?`, id, func(b []byte) error {
+		var e Emp
+		if err := json.Unmarshal(b, &e); err != nil {
+			return err
+		}
+		e.Age = ingest.AgeFromDOB(e.DOB)
+		ds.EMP[e.ID] = e
+		return nil
+	})
+	if err == nil {
+		err = scanJSON(db, `SELECT data FROM schools WHERE build_id = ?`, id, func(b []byte) error {
+			var s School
+			if err := json.Unmarshal(b, &s); err != nil {
+				return err
+			}
+			ds.SCH[s.ID] = s
+			return nil
+		})
+	}
+	if err != nil {
+		log.Printf("db %s: restore build %d: %v", dbName(), id, err)
+		return nil
+	}
+	log.Printf("🗄️  Restored %s from build %d in %s (%d employees, %d schools)", t.ID, id, dbName(), len(ds.EMP), len(ds.SCH))
+	loadPeriods(ds, in.Periods)
+	loadLeave(ds, in.Leave)
+	loadTrend(ds, in.DBTDir)
+	loadZoneShapes(ds, in.ZonesGeoJSON)
+	finishBuild(ds)
+	return ds
+}
+
+func scanJSON(db *sql.DB, query string, id int64, fn func([]byte) error) error {
+	rows, err := db.Query(bind(query), id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// storeBuild writes ds as a new build of the tenant in one transaction,
+// unless the last stored build has the same inputs.
+func storeBuild(t *Tenant, ds *Dataset) {
+	db := store()
+	if db == nil {
+		return
+	}
+	digest := inputsDigest(ds.Inputs)
+	if _, last, err := lastBuild(db, t.ID); err != nil || last == digest {
+		if err != nil {
+			log.Printf("db %s: %v", dbName(), err)
+		}
+		return
+	}
+	id, err := insertBuild(db, t.ID, digest, ds)
+	if err != nil {
+		log.Printf("db %s: store %s: %v", dbName(), t.ID, err)
+		return
+	}
+	log.Printf("🗄️  Stored %s as build %d in %s", t.ID, id, dbName())
+}
+
+func insertBuild(db *sql.DB, tenant, digest string, ds *Dataset) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRow(bind(`INSERT INTO builds (tenant, built_at, month, profile, inputs_sha256, employees, schools) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`),
+		tenant, ds.BuiltAt.Format(time.RFC3339), ds.BuiltAt.Format("2006-01"), ds.Profile, digest, len(ds.EMP), len(ds.SCH)).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	insert := func(query string, each func(stmt *sql.Stmt) error) error {
+		stmt, err := tx.Prepare(bind(query))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		return each(stmt)
+	}
+	err = insert(`INSERT INTO employees (build_id, id, zone, designation, school_id, status, data) VALUES (?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+		for _, e := range ds.EMP {
+			b, _ := json.Marshal(e)
+			if _, err := stmt.Exec(id, e.ID, e.Zone, e.Designation, e.SchoolID, e.Status, string(b)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = insert(`INSERT INTO schools (build_id, id, zone, enrolment, max_present, dbt_total, data) VALUES (?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+			for _, s := range ds.SCH {
+				b, _ := json.Marshal(s)
+				if _, err := stmt.Exec(id, s.ID, s.Zone, s.TotalEnrolment, s.MaxPresent, s.DBTTotal, string(b)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		rosters := rosterBySchool(ds.EMP)
+		err = insert(`INSERT INTO staff (build_id, school_id, zone, needed_teachers, actual_teachers, surplus_vacancy, has_principal, has_special_educator, total_staff, ratio) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+			for sid, s := range ds.SCH {
+				st := schoolStaff(s, rosters[sid])
+				if _, err := stmt.Exec(id, sid, s.Zone, st.NeededTeachers, st.ActualTeachers, st.SurplusVacancy, boolInt(st.HasPrincipal), boolInt(st.HasSpecialEdu), st.TotalStaff, st.Ratio); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = insert(`INSERT INTO demographics (build_id, zone, designation, total, male, female, data) VALUES (?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+			for _, z := range ds.DEMO_ZONES {
+				for _, d := range z.Designations {
+					b, _ := json.Marshal(d.Stats)
+					if _, err := stmt.Exec(id, z.Zone, d.Designation, d.Stats.Total, d.Stats.TotalMale, d.Stats.TotalFemale, string(b)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = insert(`INSERT INTO build_inputs (build_id, role, path, sha256, size, mtime, source) VALUES (?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+			for _, f := range ds.Provenance {
+				mtime := ""
+				if !f.Missing {
+					mtime = f.ModTime.UTC().Format(time.RFC3339)
+				}
+				if _, err := stmt.Exec(id, f.Role, f.Path, f.SHA256, f.Size, mtime, f.Source); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+type StoredBuild struct {
+	ID        int64  `json:"id"`
+	BuiltAt   string `json:"built_at"`
+	Month     string `json:"month"`
+	Profile   string `json:"profile,omitempty"`
+	Employees int    `json:"employees"`
+	Schools   int    `json:"schools"`
+}
+
+// BuildPoint is one build's figures for a zone, school or employee; only
+// the fields that apply are set.
+type BuildPoint struct {
+	BuildID int64  `json:"build_id"`
+	BuiltAt string `json:"built_at"`
+	Month   string `json:"month"`
+
+	Employees      int  `json:"employees,omitempty"`
+	Schools        int  `json:"schools,omitempty"`
+	Enrolment      int  `json:"enrolment,omitempty"`
+	MaxPresent     int  `json:"max_present,omitempty"`
+	DBTTotal       int  `json:"dbt_total,omitempty"`
+	NeededTeachers int  `json:"needed_teachers,omitempty"`
+	ActualTeachers int  `json:"actual_teachers,omitempty"`
+	SurplusVacancy int  `json:"surplus_vacancy,omitempty"`
+	HasPrincipal   bool `json:"has_principal,omitempty"`
+
+	Zone        string `json:"zone,omitempty"`
+	Designation string `json:"designation,omitempty"`
+	SchoolID    string `json:"school_id,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+func listStoredBuilds(db *sql.DB, tenant string) ([]StoredBuild, error) {
+	rows, err := db.Query(bind(`SELECT id, built_at, month, profile, employees, schools FROM builds WHERE tenant = ? ORDER BY id`), tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []StoredBuild{}
+	for rows.Next() {
+		var b StoredBuild
+		if err := rows.Scan(&b.ID, &b.BuiltAt, &b.Month, &b.Profile, &b.Employees, &b.Schools); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+// buildHistory returns a zone's, school's or employee's figures in every
+// stored build of the tenant that has it, oldest first.
+func buildHistory(db *sql.DB, tenant, kind, key string) ([]BuildPoint, error) {
+	var query string
+	switch kind {
+	case "zone":
+		query = `SELECT b.id, b.built_at, b.month,
+			(SELECT COUNT(*) FROM employees e WHERE e.build_id = b.id AND e.zone = ?1),
+			COUNT(s.id), COALESCE(SUM(s.enrolment), 0), COALESCE(SUM(s.max_present), 0), COALESCE(SUM(s.dbt_total), 0),
+			COALESCE(SUM(st.needed_teachers), 0), COALESCE(SUM(st.actual_teachers), 0), COALESCE(SUM(st.surplus_vacancy), 0)
+			FROM builds b
+			LEFT JOIN schools s ON s.build_id = b.id AND s.zone = ?1
+			LEFT JOIN staff st ON st.build_id = s.build_id AND st.school_id = s.id
+			WHERE b.tenant = ?2 GROUP BY b.id ORDER BY b.id`
+	case "school":
+		query = `SELECT b.id, b.built_at, b.month, s.enrolment, s.max_present, s.dbt_total,
+			st.needed_teachers, st.actual_teachers, st.surplus_vacancy, st.has_principal, s.zone
+			FROM builds b
+			JOIN schools s ON s.build_id = b.id AND s.id = ?1
+			JOIN staff st ON st.build_id = b.id AND st.school_id = s.id
+			WHERE b.tenant = ?2 ORDER BY b.id`
+	case "emp":
+		query = `SELECT b.id, b.built_at, b.month, e.zone, e.designation, e.school_id, e.status
+			FROM builds b JOIN employees e ON e.build_id = b.id AND e.id = ?1
+			WHERE b.tenant = ?2 ORDER BY b.id`
+	default:
+		return nil, fmt.Errorf("unknown history %q", kind)
+	}
+	rows, err := db.Query(bind(query), key, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []BuildPoint{}
+	for rows.Next() {
+		var p BuildPoint
+		dest := []any{&p.BuildID, &p.BuiltAt, &p.Month}
+		switch kind {
+		case "zone":
+			dest = append(dest, &p.Employees, &p.Schools, &p.Enrolment, &p.MaxPresent, &p.DBTTotal, &p.NeededTeachers, &p.ActualTeachers, &p.SurplusVacancy)
+		case "school":
+			dest = append(dest, &p.Enrolment, &p.MaxPresent, &p.DBTTotal, &p.NeededTeachers, &p.ActualTeachers, &p.SurplusVacancy, &p.HasPrincipal, &p.Zone)
+		case "emp":
+			dest = append(dest, &p.Zone, &p.Designation, &p.SchoolID, &p.Status)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// lastPerMonth keeps the newest point of each month; points are oldest
+// first.
+func lastPerMonth(points []BuildPoint) []BuildPoint {
+	out := []BuildPoint{}
+	for _, p := range points {
+		if n := len(out); n > 0 && out[n-1].Month == p.Month {
+			out[n-1] = p
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// GET /api/v1/builds
+func handleAPIBuilds(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	db := store()
+	if db == nil {
+		writeError(w, 404, errNotFound, "no -db configured")
+		return
+	}
+	builds, err := listStoredBuilds(db, tenantFor(r).ID)
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	writeData(w, builds, &Meta{Count: len(builds)})
+}
+
+// GET /api/v1/builds/history?zone=|school=|emp=
+func handleAPIBuildHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	db := store()
+	if db == nil {
+		writeError(w, 404, errNotFound, "no -db configured")
+		return
+	}
+	q := r.URL.Query()
+	var kind, key string
+	switch {
+	case q.Get("zone") != "":
+		kind, key = "zone", q.Get("zone")
+	case q.Get("school") != "":
+		kind, key = "school", ingest.DigitsOnly(q.Get("school"))
+	case q.Get("emp") != "":
+		kind, key = "emp", ingest.NormalizeEmpID(q.Get("emp"))
+	default:
+		writeError(w, 400, errBadRequest, "one of zone, school or emp is required")
+		return
+	}
+	points, err := buildHistory(db, tenantFor(r).ID, kind, key)
+	if err != nil {
+		writeError(w, 500, errInternal, err.Error())
+		return
+	}
+	if q.Get("monthly") == "1" {
+		points = lastPerMonth(points)
+	}
+	if q.Get("format") == "csv" {
+		itoa := strconv.Itoa
+		header := []string{"Build", "Built At", "Month"}
+		switch kind {
+		case "zone":
+			header = append(header, "Employees", "Schools", "Enrolment", "Max Present", "DBT Total", "Needed Teachers", "Actual Teachers", "Surplus/Vacancy")
+		case "school":
+			header = append(header, "Zone", "Enrolment", "Max Present", "DBT Total", "Needed Teachers", "Actual Teachers", "Surplus/Vacancy", "Has Principal")
+		case "emp":
+			header = append(header, "Zone", "Designation", "School ID", "Status")
+		}
+		rows := make([][]string, 0, len(points))
+		for _, p := range points {
+			row := []string{strconv.FormatInt(p.BuildID, 10), p.BuiltAt, p.Month}
+			switch kind {
+			case "zone":
+				row = append(row, itoa(p.Employees), itoa(p.Schools), itoa(p.Enrolment), itoa(p.MaxPresent), itoa(p.DBTTotal), itoa(p.NeededTeachers), itoa(p.ActualTeachers), itoa(p.SurplusVacancy))
+			case "school":
+				row = append(row, p.Zone, itoa(p.Enrolment), itoa(p.MaxPresent), itoa(p.DBTTotal), itoa(p.NeededTeachers), itoa(p.ActualTeachers), itoa(p.SurplusVacancy), yesNo(p.HasPrincipal))
+			case "emp":
+				row = append(row, p.Zone, p.Designation, p.SchoolID, p.Status)
+			}
+			rows = append(rows, row)
+		}
+		writeCSV(w, r, "history_"+kind+"_"+key+".csv", header, rows)
+		return
+	}
+	writeData(w, points, &Meta{Count: len(points)})
+}
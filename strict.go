@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Strict input schema ----
+//
+// By default a missing column reads as blank and a row the CSV reader
+// can't parse ends the file early, so a changed export quietly builds a
+// dashboard of empty fields. With -strict every build first checks Basic,
+// Services and the DBT summary against the portal's layout
+// (ingest.Schema): a required column that is missing, or a row with the
+// wrong number of fields or broken quoting, fails the build with the file
+// and line. Columns the layout doesn't know are reported but allowed.
+//
+// A failed first build exits non-zero; a failed rebuild keeps the previous
+// one. The validate subcommand always lists the problems, as errors under
+// -strict and as warnings otherwise.
+
+var strictSchema = flag.Bool("strict", false, "Fail builds on input files with missing required columns or malformed rows")
+
+// strictShown caps the problems listed per file in logs and validate output.
+const strictShown = 20
+
+// schemaReports checks the tenant's three main inputs.
+func schemaReports(in Inputs) ([]ingest.SchemaReport, error) {
+	var reps []ingest.SchemaReport
+	for _, f := range []struct {
+		path   string
+		schema ingest.Schema
+	}{{in.Basic, ingest.BasicSchema}, {in.Services, ingest.ServicesSchema}, {in.DBT, ingest.DBTSchema}} {
+		rep, err := ingest.CheckSchema(f.path, f.schema)
+		if err != nil {
+			return nil, err
+		}
+		reps = append(reps, rep)
+	}
+	return reps, nil
+}
+
+// schemaProblems lists what is wrong with rep, one line each: the errors
+// (missing columns, malformed rows) and the extra columns.
+func schemaProblems(rep ingest.SchemaReport) (errs, notes []string) {
+	for _, c := range rep.Missing {
+		errs = append(errs, fmt.Sprintf("%s: missing required column %q", rep.Path, c))
+	}
+	for i, m := range rep.Malformed {
+		if i == strictShown {
+			errs = append(errs, fmt.Sprintf("%s: … and %d more malformed row(s)", rep.Path, len(rep.Malformed)-i+rep.More))
+			break
+		}
+		errs = append(errs, fmt.Sprintf("%s:%d: %s", rep.Path, m.Line, m.Problem))
+	}
+	if len(rep.Extra) > 0 {
+		notes = append(notes, fmt.Sprintf("%s: %d column(s) not in the %s layout: %s", rep.Path, len(rep.Extra), rep.Kind, strings.Join(rep.Extra, ", ")))
+	}
+	return errs, notes
+}
+
+// checkStrict fails a build under -strict when an input doesn't match its
+// schema, logging each problem.
+func checkStrict(in Inputs) error {
+	if !*strictSchema {
+		return nil
+	}
+	reps, err := schemaReports(in)
+	if err != nil {
+		return err
+	}
+	var bad []string
+	for _, rep := range reps {
+		errs, notes := schemaProblems(rep)
+		for _, n := range notes {
+			log.Printf("📐 %s", n)
+		}
+		for _, e := range errs {
+			log.Printf("📐 %s", e)
+		}
+		if !rep.OK() {
+			bad = append(bad, fmt.Sprintf("%s (%d missing column(s), %d malformed row(s))", rep.Path, len(rep.Missing), len(rep.Malformed)+rep.More))
+		}
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("-strict: inputs don't match the expected layout: %s", strings.Join(bad, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Export subscriptions ----
+//
+// A logged-in user can have a CSV export mailed on a schedule ("my zone's
+// staffing every Monday at 09:00"). The export is produced by the same
+// handler as the download, as that user, so filters and roles behave
+// exactly as in the browser. Users mail themselves; admins may pick any
+// recipient. Times are in -schedule-tz (IST by default), whatever the
+// server's own zone, and mails go through the mail queue, so a failed send
+// is retried and shows up in the email log.
+//
+//	POST   /api/subscriptions        {"export": "staff", "query": {"zone": "SOUTH"}, "every": "weekly", "weekday": "mon", "at": "09:00"}
+//	GET    /api/subscriptions[?user=]
+//	DELETE /api/subscriptions?id=
+//	POST   /api/subscriptions/send?id=   (queue now; the schedule is unchanged)
+
+var subscriptionsFile = flag.String("subscriptions", "./out/subscriptions.json", "Scheduled export subscriptions (managed via /api/subscriptions)")
+
+// subscribableExports are the CSV exports a subscription may name.
+var subscribableExports = map[string]http.HandlerFunc{
+	"employees":      handleAPIEmployees,
+	"schools":        handleAPISchools,
+	"staff":          handleAPIStaff,
+	"classrooms":     handleAPIClassrooms,
+	"mdm":            handleAPIMDM,
+	"dbt_components": handleDBTComponents,
+	"pivot":          handleAPIPivot,
+}
+
+const (
+	everyDay   = "daily"
+	everyWeek  = "weekly"
+	everyMonth = "monthly"
+)
+
+type Subscription struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`
+	To        string            `json:"to"`
+	Export    string            `json:"export"`
+	Query     map[string]string `json:"query,omitempty"`
+	Every     string            `json:"every"`             // daily, weekly or monthly
+	Weekday   string            `json:"weekday,omitempty"` // weekly: mon..sun
+	Day       int               `json:"day,omitempty"`     // monthly: 1-28
+	At        string            `json:"at"`                // HH:MM
+	Next      time.Time         `json:"next"`
+	LastSent  *time.Time        `json:"last_sent,omitempty"`
+	LastError string            `json:"last_error,omitempty"`
+	Created   time.Time         `json:"created"`
+}
+
+// check validates the schedule fields and fills in defaults.
+func (s *Subscription) check() error {
+	if _, ok := subscribableExports[s.Export]; !ok {
+		names := make([]string, 0, len(subscribableExports))
+		for k := range subscribableExports {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("export must be one of %s", strings.Join(names, ", "))
+	}
+	if s.At == "" {
+		s.At = "09:00"
+	}
+	if _, err := time.Parse("15:04", s.At); err != nil {
+		return fmt.Errorf("at must be HH:MM")
+	}
+	s.Weekday = strings.ToLower(s.Weekday)
+	switch s.Every {
+	case everyDay:
+		s.Weekday, s.Day = "", 0
+	case everyWeek:
+		if s.Weekday == "" {
+			s.Weekday = "mon"
+		}
+		if _, ok := weekdayOf(s.Weekday); !ok {
+			return fmt.Errorf("weekday must be mon..sun")
+		}
+		s.Day = 0
+	case everyMonth:
+		if s.Day == 0 {
+			s.Day = 1
+		}
+		if s.Day < 1 || s.Day > 28 {
+			return fmt.Errorf("day must be 1-28")
+		}
+		s.Weekday = ""
+	default:
+		return fmt.Errorf("every must be %s, %s or %s", everyDay, everyWeek, everyMonth)
+	}
+	if !ingest.ValidEmail(s.To) {
+		return fmt.Errorf("invalid recipient %q", s.To)
+	}
+	for _, k := range []string{"format", "page", "per_page"} {
+		delete(s.Query, k)
+	}
+	return nil
+}
+
+func weekdayOf(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()[:3]) == s {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// next is the first scheduled time after t, read in -schedule-tz.
+func (s Subscription) next(t time.Time) time.Time {
+	if loc, err := scheduleLocation(); err == nil {
+		t = t.In(loc)
+	}
+	at, _ := time.Parse("15:04", s.At)
+	d := time.Date(t.Year(), t.Month(), t.Day(), at.Hour(), at.Minute(), 0, 0, t.Location())
+	switch s.Every {
+	case everyWeek:
+		wd, _ := weekdayOf(s.Weekday)
+		for d.Weekday() != wd || !d.After(t) {
+			d = d.AddDate(0, 0, 1)
+		}
+	case everyMonth:
+		d = time.Date(t.Year(), t.Month(), s.Day, at.Hour(), at.Minute(), 0, 0, t.Location())
+		if !d.After(t) {
+			d = d.AddDate(0, 1, 0)
+		}
+	default:
+		if !d.After(t) {
+			d = d.AddDate(0, 0, 1)
+		}
+	}
+	return d
+}
+
+type subscriptionDesk struct {
+	mu   sync.Mutex
+	path string
+	Seq  int            `json:"next"`
+	Subs []Subscription `json:"subscriptions"`
+}
+
+var (
+	subDesksMu sync.Mutex
+	subDesks   = map[string]*subscriptionDesk{} // by tenant id
+)
+
+// subscriptions returns the tenant's subscriptions, loading them on first
+// use.
+func (t *Tenant) subscriptions() *subscriptionDesk {
+	subDesksMu.Lock()
+	defer subDesksMu.Unlock()
+	if d, ok := subDesks[t.ID]; ok {
+		return d
+	}
+	d := &subscriptionDesk{path: t.Subscriptions, Seq: 1}
+	if b, err := os.ReadFile(t.Subscriptions); err == nil {
+		if err := json.Unmarshal(b, d); err != nil {
+			log.Printf("subscriptions %s: %v", t.Subscriptions, err)
+		}
+	}
+	subDesks[t.ID] = d
+	return d
+}
+
+func (d *subscriptionDesk) save() error {
+	if d.path == "" {
+		return fmt.Errorf("no subscriptions file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(d.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(d.path+".tmp", d.path)
+}
+
+func (d *subscriptionDesk) Add(s Subscription) (Subscription, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	s.ID = fmt.Sprintf("S%04d", d.Seq)
+	s.Created, s.Next = now, s.next(now)
+	d.Seq++
+	d.Subs = append(d.Subs, s)
+	return s, d.save()
+}
+
+func (d *subscriptionDesk) Get(id string) (Subscription, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.Subs {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Subscription{}, false
+}
+
+func (d *subscriptionDesk) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i, s := range d.Subs {
+		if s.ID == id {
+			d.Subs = append(d.Subs[:i:i], d.Subs[i+1:]...)
+			return d.save()
+		}
+	}
+	return nil
+}
+
+// For lists owner's subscriptions ("" for everyone's).
+func (d *subscriptionDesk) For(owner string) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []Subscription{}
+	for _, s := range d.Subs {
+		if owner == "" || s.Owner == owner {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Due returns the subscriptions whose time has come and moves each on to
+// its next run, so a slow or failing send is not retried every minute.
+func (d *subscriptionDesk) Due(now time.Time) []Subscription {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []Subscription
+	for i := range d.Subs {
+		if s := &d.Subs[i]; !s.Next.After(now) {
+			out = append(out, *s)
+			s.Next = s.next(now)
+		}
+	}
+	if len(out) > 0 {
+		if err := d.save(); err != nil {
+			log.Printf("subscriptions %s: %v", d.path, err)
+		}
+	}
+	return out
+}
+
+// record notes the outcome of a send.
+func (d *subscriptionDesk) record(id string, at time.Time, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.Subs {
+		if s := &d.Subs[i]; s.ID == id {
+			s.LastError = ""
+			if err != nil {
+				s.LastError = err.Error()
+			} else {
+				s.LastSent = &at
+			}
+		}
+	}
+	if err := d.save(); err != nil {
+		log.Printf("subscriptions %s: %v", d.path, err)
+	}
+}
+
+// renderExport runs the subscription's export as its owner and returns the
+// CSV file.
+func renderExport(t *Tenant, s Subscription) (MailFile, error) {
+	q := url.Values{}
+	for k, v := range s.Query {
+		q.Set(k, v)
+	}
+	q.Set("format", "csv")
+	req := httptest.NewRequest(http.MethodGet, "/export/"+s.Export+"?"+q.Encode(), nil)
+	ctx := context.WithValue(req.Context(), ctxTenant, t)
+	for i := range t.Users {
+		if t.Users[i].Name == s.Owner {
+			ctx = context.WithValue(ctx, ctxUser, &t.Users[i])
+		}
+	}
+	rec := httptest.NewRecorder()
+	subscribableExports[s.Export](rec, req.WithContext(ctx))
+	if rec.Code != http.StatusOK {
+		var env Envelope
+		if json.Unmarshal(rec.Body.Bytes(), &env) == nil && len(env.Errors) > 0 {
+			return MailFile{}, fmt.Errorf("%s export: %s", s.Export, env.Errors[0].Detail)
+		}
+		return MailFile{}, fmt.Errorf("%s export: status %d", s.Export, rec.Code)
+	}
+	name := s.Export + ".csv"
+	if _, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	return MailFile{Name: name, ContentType: "text/csv", Data: rec.Body.Bytes()}, nil
+}
+
+// sendSubscription queues one export for mailing now.
+func sendSubscription(t *Tenant, s Subscription) error {
+	f, err := renderExport(t, s)
+	if err == nil {
+		esc := html.EscapeString
+		filters := "none"
+		if len(s.Query) > 0 {
+			q := url.Values{}
+			for k, v := range s.Query {
+				q.Set(k, v)
+			}
+			filters = q.Encode()
+		}
+		subject := fmt.Sprintf("%s – %s export (%s)", t.PageTitle(), s.Export, time.Now().Format("02 Jan 2006"))
+		body := fmt.Sprintf(`<div style="font-family:Arial,sans-serif;font-size:14px"><p>Your %s export is attached (%s).</p>`+
+			`<p style="color:#64748b">Filters: %s. Subscription %s, %s at %s. Data as of %s.</p></div>`,
+			esc(s.Export), esc(f.Name), esc(filters), esc(s.ID), esc(s.Every), esc(s.At), t.Data().BuiltAt.Format("02 Jan 2006 15:04"))
+		err = queueMail(t, "", t.senderFor(s.Query["zone"]), "", s.To, subject, body, f)
+	}
+	t.subscriptions().record(s.ID, time.Now(), err)
+	if err != nil {
+		return err
+	}
+	log.Printf("📎 Subscription %s/%s: %s export queued for %s", t.ID, s.ID, s.Export, s.To)
+	return nil
+}
+
+// everyMinute is the cron expression "* * * * *".
+var everyMinute, _ = parseCron("* * * * *")
+
+// startSubscriptionSchedule checks every minute for subscriptions that are
+// due; it fails on a bad -schedule-tz.
+func startSubscriptionSchedule() error {
+	loc, err := scheduleLocation()
+	if err != nil {
+		return fmt.Errorf("-schedule-tz: %v", err)
+	}
+	runOnSchedule(everyMinute, loc, func(now time.Time) {
+		for _, t := range TENANTS {
+			for _, s := range t.subscriptions().Due(now) {
+				if err := sendSubscription(t, s); err != nil {
+					log.Printf("subscription %s/%s: %v", t.ID, s.ID, err)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+func canManageSubscription(u *TenantUser, s Subscription) bool {
+	return s.Owner == u.Name || isAdmin(u)
+}
+
+// GET/POST/DELETE /api/subscriptions
+func handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	u := userFor(r)
+	if u == nil {
+		writeError(w, http.StatusUnauthorized, errUnauthorized, "subscriptions need a login")
+		return
+	}
+	t := tenantFor(r)
+	switch r.Method {
+	case http.MethodGet:
+		owner := u.Name
+		if q := r.URL.Query().Get("user"); q != "" && q != u.Name {
+			if !isAdmin(u) {
+				writeError(w, http.StatusForbidden, errForbidden, "only admins may list other users' subscriptions")
+				return
+			}
+			owner = q
+		}
+		list := t.subscriptions().For(owner)
+		writeData(w, list, &Meta{Count: len(list)})
+	case http.MethodPost:
+		var s Subscription
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&s); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a subscription: "+err.Error())
+			return
+		}
+		if s.To == "" || !isAdmin(u) {
+			s.To = u.Email
+		}
+		if s.To == "" {
+			writeError(w, 400, errBadRequest, "no recipient: your user has no email address")
+			return
+		}
+		s.Owner, s.Next, s.LastSent, s.LastError = u.Name, time.Time{}, nil, ""
+		if err := s.check(); err != nil {
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		if _, err := renderExport(t, s); err != nil {
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		s, err := t.subscriptions().Add(s)
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("📎 %s subscribed %s to the %s export (%s)", u.Name, s.To, s.Export, s.Every)
+		writeData(w, s, nil)
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		s, ok := t.subscriptions().Get(id)
+		if !ok {
+			writeError(w, 404, errNotFound, "subscription "+id+" not found")
+			return
+		}
+		if !canManageSubscription(u, s) {
+			writeError(w, http.StatusForbidden, errForbidden, "not your subscription")
+			return
+		}
+		if err := t.subscriptions().Delete(id); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		writeData(w, s, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// POST /api/subscriptions/send?id=
+func handleSubscriptionSend(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	u := userFor(r)
+	if u == nil {
+		writeError(w, http.StatusUnauthorized, errUnauthorized, "subscriptions need a login")
+		return
+	}
+	t := tenantFor(r)
+	id := r.URL.Query().Get("id")
+	s, ok := t.subscriptions().Get(id)
+	if !ok {
+		writeError(w, 404, errNotFound, "subscription "+id+" not found")
+		return
+	}
+	if !canManageSubscription(u, s) {
+		writeError(w, http.StatusForbidden, errForbidden, "not your subscription")
+		return
+	}
+	if err := sendSubscription(t, s); err != nil {
+		writeError(w, 502, errInternal, err.Error())
+		return
+	}
+	s, _ = t.subscriptions().Get(id)
+	writeData(w, s, nil)
+}
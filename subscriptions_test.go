@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionNextInScheduleZone(t *testing.T) {
+	defer func(tz string) { *scheduleTZ = tz }(*scheduleTZ)
+	*scheduleTZ = "Asia/Kolkata"
+
+	// 03:00 UTC on Friday 16 Oct 2026 is 08:30 IST.
+	from := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		s    Subscription
+		want time.Time
+	}{
+		{Subscription{Every: everyDay, At: "09:00"}, time.Date(2026, 10, 16, 3, 30, 0, 0, time.UTC)},
+		{Subscription{Every: everyDay, At: "08:00"}, time.Date(2026, 10, 17, 2, 30, 0, 0, time.UTC)},
+		{Subscription{Every: everyWeek, Weekday: "mon", At: "09:00"}, time.Date(2026, 10, 19, 3, 30, 0, 0, time.UTC)},
+		{Subscription{Every: everyMonth, Day: 1, At: "00:15"}, time.Date(2026, 10, 31, 18, 45, 0, 0, time.UTC)},
+	} {
+		if got := tc.s.next(from); !got.Equal(tc.want) {
+			t.Errorf("%+v: next = %s, want %s", tc.s, got.UTC(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Substitute teachers ----
+//
+// The leave file (-leave, or "leave" in a tenant or profile) lists spells of
+// leave, one row each: "Employee ID", "From" and "To" (DD/MM/YYYY,
+// DD-Mon-YYYY or YYYY-MM-DD; inclusive, a blank To is a single day),
+// optionally "Type". From it and the timetable (workload.go) the dashboard
+// forecasts, for each school day ahead, how many substitute teachers each
+// school needs:
+//
+//   - teachers whose leave covers the day leave their periods untaught: a
+//     day's share of their weekly load, or of -max-periods without a
+//     timetable
+//   - a school usually has some unplanned absence too, so at least as many
+//     teachers as were away on an average school day over the last four
+//     weeks are counted absent, at the school's average load
+//   - one substitute takes a day's share of -max-periods
+//
+// School days are Monday to Saturday (-school-days 5: to Friday).
+//
+//	GET /api/substitutes[?zone=][&school=][&days=7][&from=YYYY-MM-DD][&by=zone][&format=csv]
+//
+// The weekly digest includes the coming week by zone.
+
+var (
+	leaveCSV   = flag.String("leave", "", "Leave CSV with spells of teacher leave (Employee ID, From, To) for the substitute forecast (optional)")
+	schoolDays = flag.Int("school-days", 6, "School days a week: 6 = Monday to Saturday, 5 = Monday to Friday")
+)
+
+const absenceWindowDays = 28
+
+type LeaveSpell struct {
+	EmpID string
+	From  time.Time
+	To    time.Time
+	Type  string
+}
+
+// readLeave returns the spells with an employee and a readable From.
+func readLeave(path string) ([]LeaveSpell, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	var out []LeaveSpell
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSpace(ingest.Get(rec, m, "Employee ID", "Emp ID"))
+		from, err := parseLeaveDate(ingest.Get(rec, m, "From", "From Date", "Start Date"))
+		if id == "" || err != nil {
+			continue
+		}
+		to, err := parseLeaveDate(ingest.Get(rec, m, "To", "To Date", "End Date"))
+		if err != nil || to.Before(from) {
+			to = from
+		}
+		out = append(out, LeaveSpell{EmpID: id, From: from, To: to, Type: strings.TrimSpace(ingest.Get(rec, m, "Type", "Leave Type"))})
+	}
+}
+
+// parseLeaveDate also takes the ISO dates HR systems export.
+func parseLeaveDate(s string) (time.Time, error) {
+	if d, err := time.Parse("2006-01-02", strings.TrimSpace(s)); err == nil {
+		return d, nil
+	}
+	return ingest.ParseDMYFlexible(s)
+}
+
+// loadLeave reads the leave file (if any) into ds.
+func loadLeave(ds *Dataset, path string) {
+	ds.leave = nil
+	if path == "" {
+		return
+	}
+	spells, err := readLeave(path)
+	if err != nil {
+		log.Printf("leave %s: %v", path, err)
+		return
+	}
+	ds.leave = spells
+	log.Printf("🧳 %d leave spell(s) in %s", len(spells), path)
+}
+
+func isSchoolDay(d time.Time) bool {
+	switch d.Weekday() {
+	case time.Sunday:
+		return false
+	case time.Saturday:
+		return *schoolDays >= 6
+	}
+	return true
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type SubstituteNeed struct {
+	Date        string  `json:"date"`
+	SchoolID    string  `json:"school_id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Zone        string  `json:"zone"`
+	OnLeave     int     `json:"on_leave"` // teachers with leave that day
+	Expected    float64 `json:"expected_absent"`
+	Periods     float64 `json:"periods"` // untaught that day
+	Substitutes int     `json:"substitutes"`
+}
+
+// substituteForecast is the need of every school that has one on each of
+// days school days from from.
+func substituteForecast(ds *Dataset, from time.Time, days int) []SubstituteNeed {
+	if len(ds.leave) == 0 {
+		return nil
+	}
+	perDay := float64(*maxPeriods) / float64(*schoolDays)
+	load := map[string]float64{} // emp id -> periods a day
+	if ds.WORKLOAD != nil {
+		for _, t := range ds.WORKLOAD.Teachers {
+			load[t.EmpID] = float64(t.Periods) / float64(*schoolDays)
+		}
+	}
+	dailyLoad := func(id string) float64 {
+		if l, ok := load[id]; ok {
+			return l
+		}
+		return perDay
+	}
+	type school struct {
+		teachers []string
+		avgLoad  float64
+	}
+	schools := map[string]*school{}
+	for sid, roster := range rosterBySchool(ds.EMP) {
+		s := &school{}
+		for _, e := range roster {
+			if strings.Contains(strings.ToLower(e.Designation), "teacher") {
+				s.teachers = append(s.teachers, e.ID)
+				s.avgLoad += dailyLoad(e.ID)
+			}
+		}
+		if len(s.teachers) > 0 {
+			s.avgLoad /= float64(len(s.teachers))
+			schools[sid] = s
+		}
+	}
+	spells := map[string][]LeaveSpell{}
+	for _, l := range ds.leave {
+		spells[l.EmpID] = append(spells[l.EmpID], l)
+	}
+	onLeave := func(id string, d time.Time) bool {
+		for _, l := range spells[id] {
+			if !d.Before(dayOf(l.From)) && !d.After(dayOf(l.To)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	from = dayOf(from)
+	var window []time.Time
+	for d := from.AddDate(0, 0, -absenceWindowDays); d.Before(from); d = d.AddDate(0, 0, 1) {
+		if isSchoolDay(d) {
+			window = append(window, d)
+		}
+	}
+	var ahead []time.Time
+	for d := from; len(ahead) < days; d = d.AddDate(0, 0, 1) {
+		if isSchoolDay(d) {
+			ahead = append(ahead, d)
+		}
+	}
+
+	var out []SubstituteNeed
+	for sid, s := range schools {
+		baseline := 0.0
+		for _, d := range window {
+			for _, id := range s.teachers {
+				if onLeave(id, d) {
+					baseline++
+				}
+			}
+		}
+		if len(window) > 0 {
+			baseline /= float64(len(window))
+		}
+		for _, d := range ahead {
+			n, periods := 0, 0.0
+			for _, id := range s.teachers {
+				if onLeave(id, d) {
+					n++
+					periods += dailyLoad(id)
+				}
+			}
+			expected := math.Max(float64(n), baseline)
+			periods += (expected - float64(n)) * s.avgLoad
+			// Stray fractions of average absence don't make a substitute;
+			// a teacher known to be away does.
+			subs := int(math.Round(periods / perDay))
+			if subs == 0 && n > 0 && periods > 0 {
+				subs = 1
+			}
+			if subs == 0 {
+				continue
+			}
+			sch := ds.SCH[sid]
+			out = append(out, SubstituteNeed{Date: d.Format("2006-01-02"), SchoolID: sid, Name: sch.Name, Zone: sch.Zone,
+				OnLeave: n, Expected: round1(expected), Periods: round1(periods), Substitutes: subs})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Substitutes != b.Substitutes {
+			return a.Substitutes > b.Substitutes
+		}
+		return a.SchoolID < b.SchoolID
+	})
+	return out
+}
+
+// substitutesByZone adds the school needs up per date and zone.
+func substitutesByZone(needs []SubstituteNeed) []SubstituteNeed {
+	idx := map[string]int{}
+	var out []SubstituteNeed
+	for _, n := range needs {
+		k := n.Date + "|" + n.Zone
+		i, ok := idx[k]
+		if !ok {
+			i = len(out)
+			idx[k] = i
+			out = append(out, SubstituteNeed{Date: n.Date, Zone: n.Zone})
+		}
+		z := &out[i]
+		z.OnLeave += n.OnLeave
+		z.Expected = round1(z.Expected + n.Expected)
+		z.Periods = round1(z.Periods + n.Periods)
+		z.Substitutes += n.Substitutes
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Date != out[j].Date {
+			return out[i].Date < out[j].Date
+		}
+		return out[i].Zone < out[j].Zone
+	})
+	return out
+}
+
+// GET /api/substitutes
+func handleAPISubstitutes(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	ds, q := dataFor(r), r.URL.Query()
+	if len(ds.leave) == 0 {
+		writeError(w, 404, errNotFound, "no leave file is configured (-leave)")
+		return
+	}
+	from := time.Now()
+	if s := q.Get("from"); s != "" {
+		var err error
+		if from, err = time.Parse("2006-01-02", s); err != nil {
+			writeError(w, 400, errBadRequest, "from must be YYYY-MM-DD")
+			return
+		}
+	}
+	days := 7
+	if s := q.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > 60 {
+			writeError(w, 400, errBadRequest, "days must be 1-60")
+			return
+		}
+		days = n
+	}
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	school := strings.TrimSpace(q.Get("school"))
+	list := []SubstituteNeed{}
+	for _, n := range substituteForecast(ds, from, days) {
+		if (zone == "" || n.Zone == zone) && (school == "" || n.SchoolID == school) {
+			list = append(list, n)
+		}
+	}
+	if q.Get("by") == "zone" {
+		list = substitutesByZone(list)
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, n := range list {
+			rows = append(rows, []string{n.Date, n.SchoolID, n.Name, n.Zone, strconv.Itoa(n.OnLeave),
+				strconv.FormatFloat(n.Expected, 'f', 1, 64), strconv.FormatFloat(n.Periods, 'f', 1, 64), strconv.Itoa(n.Substitutes)})
+		}
+		writeCSV(w, r, "substitutes.csv", []string{"Date", "School ID", "School", "Zone", "On Leave", "Expected Absent",
+			"Periods", "Substitutes"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// digestSubstitutes is the coming week's substitute need by zone and day.
+func digestSubstitutes(t *Tenant, ds *Dataset, now time.Time) string {
+	zones := substitutesByZone(substituteForecast(ds, now, *schoolDays))
+	if len(zones) == 0 {
+		return ""
+	}
+	var dates []string
+	need := map[string]map[string]int{} // zone -> date -> substitutes
+	for _, z := range zones {
+		if len(dates) == 0 || dates[len(dates)-1] != z.Date {
+			dates = append(dates, z.Date)
+		}
+		if need[z.Zone] == nil {
+			need[z.Zone] = map[string]int{}
+		}
+		need[z.Zone][z.Date] = z.Substitutes
+	}
+	var b strings.Builder
+	b.WriteString(`<table cellpadding="4" style="border-collapse:collapse"><tr><th align="left">Zone</th>`)
+	for _, d := range dates {
+		day, _ := time.Parse("2006-01-02", d)
+		fmt.Fprintf(&b, `<th>%s</th>`, day.Format("Mon 02"))
+	}
+	b.WriteString(`</tr>`)
+	for _, z := range sortedKeys(need) {
+		fmt.Fprintf(&b, `<tr><td>%s</td>`, html.EscapeString(z))
+		for _, d := range dates {
+			fmt.Fprintf(&b, `<td align="right">%d</td>`, need[z][d])
+		}
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</table><p>Substitute teachers needed a day, from leave on file and recent absence.</p>`)
+	return b.String()
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Table endpoints ----
+//
+// The dashboard tables page through these instead of carrying every record
+// in the HTML. Filters mirror the advanced-filter selects; "ALL" or empty
+// means no filter. ?sort=field or ?sort=-field, ?format=csv exports every
+// matching row (no paging).
+//
+// Schools and staff also filter on any numeric field by its JSON name,
+// ?min_<field>= and ?max_<field>=, and on boolean fields, ?<field>=true|false;
+// schools additionally on computed metrics (see metrics.go):
+//
+//	GET /api/schools?zone=SOUTH&min_total_enrolment=500&has_mdm=true
+//	GET /api/staff?min_ratio=40&has_principal=false
+
+const (
+	tableDefaultPer = 100
+	tableMaxPer     = 1000
+)
+
+func canonMarital(x string) string {
+	x = strings.ToUpper(strings.TrimSpace(x))
+	switch x {
+	case "WIDOW", "WIDOWER":
+		return "WIDOW/WIDOWER"
+	case "LIVE IN":
+		return "LIVE-IN"
+	}
+	return x
+}
+
+type empQuery struct {
+	Zone, Designation, Gender, Category, Religion, Marital string
+	SchoolID, Q                                            string
+	MinAge                                                 int
+}
+
+func parseEmpQuery(v url.Values) empQuery {
+	f := func(k string) string {
+		s := strings.ToUpper(strings.TrimSpace(v.Get(k)))
+		if s == "ALL" {
+			return ""
+		}
+		return s
+	}
+	q := empQuery{
+		Zone: f("zone"), Designation: f("designation"), Gender: f("gender"),
+		Category: f("category"), Religion: f("religion"), Marital: canonMarital(f("marital")),
+		SchoolID: ingest.DigitsOnly(v.Get("school_id")), Q: strings.ToLower(strings.TrimSpace(v.Get("q"))),
+	}
+	q.MinAge, _ = strconv.Atoi(v.Get("min_age"))
+	return q
+}
+
+func (q empQuery) match(e Emp) bool {
+	switch {
+	case q.Zone != "" && strings.ToUpper(e.Zone) != q.Zone,
+		q.Designation != "" && strings.ToUpper(e.Designation) != q.Designation,
+		q.Gender != "" && strings.ToUpper(e.Gender) != q.Gender,
+		q.Category != "" && strings.ToUpper(e.SelectionCategory) != q.Category,
+		q.Religion != "" && strings.ToUpper(e.Religion) != q.Religion,
+		q.Marital != "" && canonMarital(e.MaritalStatus) != q.Marital,
+		q.SchoolID != "" && e.SchoolID != q.SchoolID,
+		q.MinAge > 0 && e.Age < q.MinAge:
+		return false
+	}
+	if q.Q != "" && !strings.Contains(strings.ToLower(e.Name), q.Q) && !strings.Contains(e.ID, q.Q) {
+		return false
+	}
+	return true
+}
+
+var empSortKeys = map[string]func(a, b Emp) bool{
+	"id":          func(a, b Emp) bool { return a.ID < b.ID },
+	"name":        func(a, b Emp) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"designation": func(a, b Emp) bool { return a.Designation < b.Designation },
+	"zone":        func(a, b Emp) bool { return a.Zone < b.Zone },
+	"gender":      func(a, b Emp) bool { return a.Gender < b.Gender },
+	"category":    func(a, b Emp) bool { return a.SelectionCategory < b.SelectionCategory },
+	"religion":    func(a, b Emp) bool { return a.Religion < b.Religion },
+	"marital":     func(a, b Emp) bool { return a.MaritalStatus < b.MaritalStatus },
+	"age":         func(a, b Emp) bool { return a.Age < b.Age },
+	"school":      func(a, b Emp) bool { return a.SchoolName < b.SchoolName },
+}
+
+var schSortKeys = map[string]func(a, b School) bool{
+	"id":           func(a, b School) bool { return a.ID < b.ID },
+	"name":         func(a, b School) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"zone":         func(a, b School) bool { return a.Zone < b.Zone },
+	"si_name":      func(a, b School) bool { return a.SIName < b.SIName },
+	"enrolment":    func(a, b School) bool { return a.TotalEnrolment < b.TotalEnrolment },
+	"max_present":  func(a, b School) bool { return a.MaxPresent < b.MaxPresent },
+	"with_aadhaar": func(a, b School) bool { return a.WithAadhaar < b.WithAadhaar },
+	"with_account": func(a, b School) bool { return a.WithAccount < b.WithAccount },
+	"dbt_total":    func(a, b School) bool { return a.DBTTotal < b.DBTTotal },
+}
+
+// sortBy orders items by ?sort=[-]field, falling back to def; ties keep ID order.
+func sortBy[T any](items []T, spec, def string, keys map[string]func(a, b T) bool, id func(T) string) {
+	desc := strings.HasPrefix(spec, "-")
+	less, ok := keys[strings.TrimPrefix(spec, "-")]
+	if !ok {
+		less, desc = keys[def], false
+	}
+	sort.SliceStable(items, func(i, j int) bool { return id(items[i]) < id(items[j]) })
+	sort.SliceStable(items, func(i, j int) bool {
+		if desc {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
+}
+
+func queryEmployees(emp map[string]Emp, v url.Values) []Emp {
+	q := parseEmpQuery(v)
+	list := []Emp{}
+	for _, e := range emp {
+		if q.match(e) {
+			list = append(list, e)
+		}
+	}
+	sortBy(list, v.Get("sort"), "name", empSortKeys, func(e Emp) string { return e.ID })
+	return list
+}
+
+func querySchools(sch map[string]School, v url.Values, metrics []string) ([]School, error) {
+	zone := strings.ToUpper(strings.TrimSpace(v.Get("zone")))
+	if zone == "ALL" {
+		zone = ""
+	}
+	q := strings.ToLower(strings.TrimSpace(v.Get("q")))
+	match, err := parseFieldFilters(v, reflect.TypeOf(School{}), metrics)
+	if err != nil {
+		return nil, err
+	}
+	list := []School{}
+	for _, s := range sch {
+		if zone != "" && s.Zone != zone {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(s.Name), q) && !strings.Contains(s.ID, q) {
+			continue
+		}
+		if !match(reflect.ValueOf(s), s.Metrics) {
+			continue
+		}
+		list = append(list, s)
+	}
+	sortBy(list, v.Get("sort"), "name", schSortKeys, func(s School) string { return s.ID })
+	return list, nil
+}
+
+var staffSortKeys = map[string]func(a, b SchoolStaff) bool{
+	"id":              func(a, b SchoolStaff) bool { return a.ID < b.ID },
+	"name":            func(a, b SchoolStaff) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+	"zone":            func(a, b SchoolStaff) bool { return a.Zone < b.Zone },
+	"needed_teachers": func(a, b SchoolStaff) bool { return a.NeededTeachers < b.NeededTeachers },
+	"actual_teachers": func(a, b SchoolStaff) bool { return a.ActualTeachers < b.ActualTeachers },
+	"surplus_vacancy": func(a, b SchoolStaff) bool { return a.SurplusVacancy < b.SurplusVacancy },
+	"total_staff":     func(a, b SchoolStaff) bool { return a.TotalStaff < b.TotalStaff },
+	"ratio":           func(a, b SchoolStaff) bool { return a.Ratio < b.Ratio },
+}
+
+// queryStaff is the staffing summary of every school matching v.
+func queryStaff(ds *Dataset, v url.Values) ([]SchoolStaff, error) {
+	zone := strings.ToUpper(strings.TrimSpace(v.Get("zone")))
+	if zone == "ALL" {
+		zone = ""
+	}
+	q := strings.ToLower(strings.TrimSpace(v.Get("q")))
+	match, err := parseFieldFilters(v, reflect.TypeOf(SchoolStaff{}), nil)
+	if err != nil {
+		return nil, err
+	}
+	rosters := rosterBySchool(ds.EMP)
+	list := []SchoolStaff{}
+	for id, s := range ds.SCH {
+		if zone != "" && s.Zone != zone {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(s.Name), q) && !strings.Contains(s.ID, q) {
+			continue
+		}
+		st := schoolStaff(s, rosters[id])
+		if !match(reflect.ValueOf(st), nil) {
+			continue
+		}
+		list = append(list, st)
+	}
+	sortBy(list, v.Get("sort"), "name", staffSortKeys, func(s SchoolStaff) string { return s.ID })
+	return list, nil
+}
+
+// parseFieldFilters reads the ?min_<field>=, ?max_<field>= and
+// ?<bool field>= filters on records of type t and the named computed
+// metrics into one predicate. Other parameters are ignored.
+func parseFieldFilters(v url.Values, t reflect.Type, metrics []string) (func(rec reflect.Value, m map[string]float64) bool, error) {
+	fields := numericFields(t)
+	type cond struct {
+		field  int // -1 for a metric
+		metric string
+		min    bool // else max, or bool when isBool
+		isBool bool
+		val    float64
+	}
+	var conds []cond
+	for k := range v {
+		raw := strings.TrimSpace(v.Get(k))
+		if raw == "" {
+			continue
+		}
+		bound, name, ok := strings.Cut(k, "_")
+		if ok && (bound == "min" || bound == "max") {
+			val, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: not a number", k)
+			}
+			c := cond{field: -1, min: bound == "min", val: val}
+			if i, ok := fields[name]; ok && t.Field(i).Type.Kind() != reflect.Bool {
+				c.field = i
+			} else if slices.Contains(metrics, name) {
+				c.metric = name
+			} else {
+				return nil, fmt.Errorf("%s: unknown field %q", k, name)
+			}
+			conds = append(conds, c)
+			continue
+		}
+		if i, ok := fields[k]; ok && t.Field(i).Type.Kind() == reflect.Bool {
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: want true or false", k)
+			}
+			c := cond{field: i, isBool: true}
+			if b {
+				c.val = 1
+			}
+			conds = append(conds, c)
+		}
+	}
+	return func(rec reflect.Value, m map[string]float64) bool {
+		for _, c := range conds {
+			var x float64
+			if c.field >= 0 {
+				x = fieldFloat(rec.Field(c.field))
+			} else {
+				var ok bool
+				if x, ok = m[c.metric]; !ok {
+					return false
+				}
+			}
+			switch {
+			case c.isBool && x != c.val, !c.isBool && c.min && x < c.val, !c.isBool && !c.min && x > c.val:
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// GET /api/employees (and /api/v1/employees)
+//
+//	?zone=&designation=&category=&school_id=&gender=&religion=&marital=&min_age=&q=
+//	?page=&per_page=   (default 100, at most 1000)
+func handleAPIEmployees(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	ds := dataFor(r)
+	list := queryEmployees(ds.EMP, r.URL.Query())
+	if r.URL.Query().Get("format") == "csv" {
+		metrics := metricNames(ds.METRICS, "emp")
+		rows := make([][]string, 0, len(list))
+		for _, e := range list {
+			rows = append(rows, append([]string{e.ID, e.Name, e.Designation, e.Zone, e.Gender, e.SelectionCategory, e.Religion, e.MaritalStatus, strconv.Itoa(e.Age), e.SchoolName}, metricCells(e.Metrics, metrics)...))
+		}
+		writeCSV(w, r, "employees_filtered.csv", append([]string{"Employee ID", "Name", "Designation", "Zone", "Gender", "Category", "Religion", "Marital", "Age", "School"}, metrics...), rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	data, meta := paginate(list, page, per)
+	writeData(w, data, meta)
+}
+
+// GET /api/schools (and /api/v1/schools)
+func handleAPISchools(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	ds := dataFor(r)
+	list, err := querySchools(ds.SCH, r.URL.Query(), metricNames(ds.METRICS, "school"))
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		metrics := metricNames(ds.METRICS, "school")
+		rows := make([][]string, 0, len(list))
+		for _, s := range list {
+			rows = append(rows, append([]string{s.ID, s.Name, s.Zone, s.SIName, strconv.Itoa(s.TotalEnrolment), strconv.Itoa(s.MaxPresent), strconv.Itoa(s.WithAadhaar), strconv.Itoa(s.WithAccount), strconv.Itoa(s.DBTTotal)}, metricCells(s.Metrics, metrics)...))
+		}
+		writeCSV(w, r, "schools.csv", append([]string{"School ID", "Name", "Zone", "Inspector", "Enrolment", "Max Present", "With Aadhaar", "With Account", "DBT Total"}, metrics...), rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	data, meta := paginate(list, page, per)
+	writeData(w, data, meta)
+}
+
+// GET /api/staff (and /api/v1/staff): the 1:40 staffing summary per school.
+func handleAPIStaff(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	list, err := queryStaff(dataFor(r), r.URL.Query())
+	if err != nil {
+		writeError(w, 400, errBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, st := range list {
+			rows = append(rows, []string{st.ID, st.Name, st.Zone, strconv.Itoa(st.NeededTeachers), strconv.Itoa(st.ActualTeachers),
+				strconv.Itoa(st.SurplusVacancy), yesNo(st.HasPrincipal), st.InCharge, yesNo(st.HasSpecialEdu), strconv.Itoa(st.TotalStaff), fmt.Sprintf("%.1f", st.Ratio)})
+		}
+		writeCSV(w, r, "staff.csv", []string{"School ID", "Name", "Zone", "Needed Teachers", "Actual Teachers", "Surplus/Vacancy",
+			"Principal", "In Charge", "Special Educator", "Total Staff", "Pupils per Teacher"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	data, meta := paginate(list, page, per)
+	writeData(w, data, meta)
+}
+
+// handleAPIEmployeeFacets lists the distinct values that feed the filter selects.
+func handleAPIEmployeeFacets(w http.ResponseWriter, r *http.Request) {
+	sets := map[string]map[string]bool{"zones": {}, "designations": {}, "categories": {}, "religions": {}}
+	for _, e := range dataFor(r).EMP {
+		for k, v := range map[string]string{"zones": e.Zone, "designations": e.Designation, "categories": e.SelectionCategory, "religions": e.Religion} {
+			if v != "" {
+				sets[k][v] = true
+			}
+		}
+	}
+	out := map[string][]string{}
+	for k, set := range sets {
+		out[k] = []string{}
+		for v := range set {
+			out[k] = append(out[k], v)
+		}
+		sort.Strings(out[k])
+	}
+	writeData(w, out, nil)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// ---- Template files ----
+//
+// The built-in wording of each campaign (version 1 of its template) lives
+// in templates/<name>.html, compiled into the binary. A file of the same
+// name in -template-dir (a tenant's "email_template_dir") replaces it, so
+// HQ can reword a greeting without a rebuild; other files there add
+// templates, e.g. birthday-hi.html for employees who chose Hindi. Files
+// are read again when they change. Versions saved through /api/templates
+// still come after version 1.
+//
+// A file starts with its subject line, then a blank line and the HTML
+// body, both Go templates:
+//
+//	Subject: Happy birthday, {{.Name}}!
+//
+//	<p>{{.Salutation}},</p><p>... {{.Years}} years as {{.Designation}} ...</p>
+//
+// Fields: .Salutation .Name .Designation .Zone .School .Sender .Channel
+// .PrefsLink .GrievanceLink and, for anniversaries, .Years. Values are
+// HTML-escaped in the body.
+
+var templateDir = flag.String("template-dir", "./templates", "Directory of <name>.html email template files overriding the built-in wording")
+
+//go:embed templates/*.html
+var builtinTemplateFiles embed.FS
+
+// templateFormatGo marks a template written with Go template fields
+// ({{.Name}}) rather than {{NAME}} placeholders.
+const templateFormatGo = "go"
+
+// builtinTemplates is the compiled-in wording, by template name.
+var builtinTemplates = func() map[string]EmailTemplate {
+	out := map[string]EmailTemplate{}
+	files, _ := builtinTemplateFiles.ReadDir("templates")
+	for _, f := range files {
+		b, _ := builtinTemplateFiles.ReadFile("templates/" + f.Name())
+		name := strings.TrimSuffix(f.Name(), ".html")
+		tpl, err := parseTemplateFile(name, b)
+		if err != nil {
+			panic("built-in template " + f.Name() + ": " + err.Error())
+		}
+		out[name] = tpl
+	}
+	return out
+}()
+
+// parseTemplateFile reads a "Subject:" line, a blank line and the body.
+func parseTemplateFile(name string, b []byte) (EmailTemplate, error) {
+	head, body, _ := strings.Cut(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	subject, ok := strings.CutPrefix(head, "Subject:")
+	if !ok {
+		return EmailTemplate{}, errors.New(`first line must be "Subject: ..."`)
+	}
+	tpl := EmailTemplate{Name: name, Version: 1, Subject: strings.TrimSpace(subject),
+		Body: strings.TrimLeft(body, "\n"), Format: templateFormatGo}
+	if _, err := compileTemplate(tpl); err != nil {
+		return EmailTemplate{}, err
+	}
+	return tpl, nil
+}
+
+type compiledTemplate struct {
+	subject *texttemplate.Template
+	body    *htmltemplate.Template
+}
+
+// compiled caches compiledTemplate by subject and body.
+var compiled sync.Map
+
+func compileTemplate(tpl EmailTemplate) (*compiledTemplate, error) {
+	key := tpl.Subject + "\x00" + tpl.Body
+	if c, ok := compiled.Load(key); ok {
+		return c.(*compiledTemplate), nil
+	}
+	subject, err := texttemplate.New("subject").Option("missingkey=zero").Parse(tpl.Subject)
+	if err != nil {
+		return nil, err
+	}
+	body, err := htmltemplate.New("body").Option("missingkey=zero").Parse(tpl.Body)
+	if err != nil {
+		return nil, err
+	}
+	c := &compiledTemplate{subject: subject, body: body}
+	compiled.Store(key, c)
+	return c, nil
+}
+
+// render fills in tpl for vars, keyed by placeholder (NAME, PREFS_LINK);
+// a Go-format template sees them as fields (.Name, .PrefsLink).
+func (tpl EmailTemplate) render(vars map[string]string) (subject, body string, err error) {
+	if tpl.Format != templateFormatGo {
+		return renderTemplate(tpl.Subject, vars), renderTemplate(tpl.Body, vars), nil
+	}
+	c, err := compileTemplate(tpl)
+	if err != nil {
+		return "", "", err
+	}
+	fields := make(map[string]string, len(vars))
+	for k, v := range vars {
+		fields[fieldName(k)] = v
+	}
+	var s, b bytes.Buffer
+	if err := c.subject.Execute(&s, fields); err != nil {
+		return "", "", err
+	}
+	if err := c.body.Execute(&b, fields); err != nil {
+		return "", "", err
+	}
+	return s.String(), b.String(), nil
+}
+
+// fieldName turns PREFS_LINK into PrefsLink.
+func fieldName(placeholder string) string {
+	var b strings.Builder
+	for _, w := range strings.Split(strings.ToLower(placeholder), "_") {
+		if w != "" {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+type templateFile struct {
+	mod time.Time
+	tpl EmailTemplate
+	ok  bool
+}
+
+var (
+	templateFilesMu sync.Mutex
+	templateFiles   = map[string]templateFile{} // by path
+)
+
+// fileTemplate is name's file in dir, else its built-in wording.
+func fileTemplate(dir, name string) (EmailTemplate, bool) {
+	if dir != "" && rxTemplateName.MatchString(name) {
+		p := filepath.Join(dir, name+".html")
+		if st, err := os.Stat(p); err == nil {
+			templateFilesMu.Lock()
+			f, ok := templateFiles[p]
+			if !ok || !f.mod.Equal(st.ModTime()) {
+				f = templateFile{mod: st.ModTime()}
+				b, err := os.ReadFile(p)
+				if err == nil {
+					f.tpl, err = parseTemplateFile(name, b)
+				}
+				if err != nil {
+					log.Printf("template file %s: %v (ignored)", p, err)
+				} else {
+					f.tpl.By, f.tpl.Created, f.ok = p, st.ModTime(), true
+				}
+				templateFiles[p] = f
+			}
+			templateFilesMu.Unlock()
+			if f.ok {
+				return f.tpl, true
+			}
+		}
+	}
+	tpl, ok := builtinTemplates[name]
+	if ok {
+		tpl.By = "built-in"
+	}
+	return tpl, ok
+}
+
+// templateFileNames lists the built-in templates and those in dir.
+func templateFileNames(dir string) []string {
+	var names []string
+	for name := range builtinTemplates {
+		names = append(names, name)
+	}
+	if dir == "" {
+		return names
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.html"))
+	for _, f := range files {
+		if name := strings.TrimSuffix(filepath.Base(f), ".html"); rxTemplateName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
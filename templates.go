@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Email templates and A/B variants ----
+//
+// Campaign mails are rendered from named templates. Saving a template adds a
+// new version (the wording in its template file is version 1, see
+// templatefiles.go); older versions stay
+// addressable. A campaign sends template A to everyone, or template B to
+// split_b percent of recipients (picked by a hash of the employee id, so the
+// same person always gets the same variant). Every send is logged with its
+// variant and, when -public-url is set, carries an open-tracking pixel, so
+// /api/templates/report can compare open rates:
+//
+//	POST /api/templates {"name": "birthday-short", "subject": "...", "body": "<p>{{SALUTATION}}, ...</p>"}
+//	POST /api/campaigns {"campaign": "birthday", "a": {"name": "birthday"}, "b": {"name": "birthday-short"}, "split_b": 50}
+//	GET  /api/templates/report?campaign=birthday
+//
+// Placeholders: {{SALUTATION}} {{NAME}} {{DESIGNATION}} {{ZONE}} {{SCHOOL}}
+// {{SENDER}} {{CHANNEL}} {{PREFS_LINK}} {{GRIEVANCE_LINK}} and, for
+// anniversaries, {{YEARS}}; a template saved with "format": "go" uses the
+// template files' {{.Name}} fields instead. A template ref without a version means
+// latest. Employees who chose another language get "<name>-<lang>" (e.g.
+// birthday-hi) when it exists.
+
+var (
+	templatesFile = flag.String("templates", "./out/templates.json", "Versioned email templates and campaign A/B variants")
+	trackingDir   = flag.String("tracking", "./out/tracking", "Directory for campaign send/open logs (empty = off)")
+	publicURL     = flag.String("public-url", "", "External base URL of the dashboard for open-tracking pixels in mails (empty = no pixels)")
+)
+
+const (
+	campaignBirthday    = "birthday"
+	campaignAnniversary = "anniversary"
+	campaignWhatsApp    = "whatsapp"
+
+	whatsAppChannel = "https://whatsapp.com/channel/0029Vb6hLZd1CYoIFek51P0V"
+)
+
+var campaigns = []string{campaignBirthday, campaignAnniversary, campaignWhatsApp}
+
+var rxTemplateName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,47}$`)
+
+type EmailTemplate struct {
+	Name    string    `json:"name"`
+	Version int       `json:"version"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Format  string    `json:"format,omitempty"` // "go" for {{.Name}} fields
+	Note    string    `json:"note,omitempty"`
+	By      string    `json:"by,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type TemplateRef struct {
+	Name    string `json:"name"`
+	Version int    `json:"version,omitempty"` // 0 = latest
+}
+
+func (r TemplateRef) String() string {
+	if r.Version == 0 {
+		return r.Name
+	}
+	return fmt.Sprintf("%s v%d", r.Name, r.Version)
+}
+
+type CampaignVariants struct {
+	A       TemplateRef  `json:"a"`
+	B       *TemplateRef `json:"b,omitempty"`
+	SplitB  int          `json:"split_b,omitempty"` // percent of recipients getting B
+	By      string       `json:"by,omitempty"`
+	Updated *time.Time   `json:"updated,omitempty"`
+}
+
+type templateStore struct {
+	mu        sync.Mutex
+	path      string
+	dir       string                      // template files
+	Templates map[string][]EmailTemplate  `json:"templates"` // name -> versions, oldest first
+	Campaigns map[string]CampaignVariants `json:"campaigns"`
+}
+
+var (
+	templateStoresMu sync.Mutex
+	templateStores   = map[string]*templateStore{} // by tenant id
+)
+
+// templates returns the tenant's store, loading it on first use.
+func (t *Tenant) templates() *templateStore {
+	templateStoresMu.Lock()
+	defer templateStoresMu.Unlock()
+	if s, ok := templateStores[t.ID]; ok {
+		return s
+	}
+	s := &templateStore{path: t.EmailTemplates, dir: t.EmailTplDir}
+	if b, err := os.ReadFile(t.EmailTemplates); err == nil {
+		if err := json.Unmarshal(b, s); err != nil {
+			log.Printf("templates %s: %v", t.EmailTemplates, err)
+		}
+	}
+	if s.Templates == nil {
+		s.Templates = map[string][]EmailTemplate{}
+	}
+	if s.Campaigns == nil {
+		s.Campaigns = map[string]CampaignVariants{}
+	}
+	templateStores[t.ID] = s
+	return s
+}
+
+func (s *templateStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// versions is name's versions, oldest first. Unless version 1 was saved
+// through the API, it is read from the template file (or the built-in
+// wording) each time, so an edited file applies straight away.
+func (s *templateStore) versions(name string) []EmailTemplate {
+	vs := s.Templates[name]
+	if len(vs) > 0 && vs[0].Version == 1 {
+		if vs[0].By != "built-in" {
+			return vs
+		}
+		vs = vs[1:] // stored by older releases
+	}
+	if tpl, ok := fileTemplate(s.dir, name); ok {
+		return append([]EmailTemplate{tpl}, vs...)
+	}
+	return s.Templates[name]
+}
+
+func (s *templateStore) get(ref TemplateRef) (EmailTemplate, bool) {
+	vs := s.versions(ref.Name)
+	if len(vs) == 0 {
+		return EmailTemplate{}, false
+	}
+	if ref.Version == 0 {
+		return vs[len(vs)-1], true
+	}
+	for _, v := range vs {
+		if v.Version == ref.Version {
+			return v, true
+		}
+	}
+	return EmailTemplate{}, false
+}
+
+// Add stores tpl as the next version of its name.
+func (s *templateStore) Add(tpl EmailTemplate) (EmailTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tpl.Version = len(s.versions(tpl.Name)) + 1
+	s.Templates[tpl.Name] = append(s.Templates[tpl.Name], tpl)
+	return tpl, s.save()
+}
+
+func (s *templateStore) SetCampaign(name string, cv CampaignVariants) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Campaigns[name] = cv
+	return s.save()
+}
+
+// Variants returns what campaign sends; by default its same-named template.
+func (s *templateStore) Variants(campaign string) CampaignVariants {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cv, ok := s.Campaigns[campaign]; ok {
+		return cv
+	}
+	return CampaignVariants{A: TemplateRef{Name: campaign}}
+}
+
+func (s *templateStore) Get(ref TemplateRef) (EmailTemplate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(ref)
+}
+
+func (s *templateStore) List() map[string][]EmailTemplate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string][]EmailTemplate{}
+	for _, name := range templateFileNames(s.dir) {
+		out[name] = nil
+	}
+	for name := range s.Templates {
+		out[name] = nil
+	}
+	for name := range out {
+		out[name] = append([]EmailTemplate{}, s.versions(name)...)
+	}
+	return out
+}
+
+func salutation(e Emp) string {
+	switch g := strings.ToUpper(e.Gender); {
+	case strings.HasPrefix(g, "F"):
+		return "Dear Madam " + e.Name
+	case strings.HasPrefix(g, "M"):
+		return "Dear Sir " + e.Name
+	}
+	return "Dear Sir/Madam"
+}
+
+func renderTemplate(s string, vars map[string]string) string {
+	pairs := make([]string, 0, 2*len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+// ---- Campaign sends ----
+
+type SendRecord struct {
+	ID       string    `json:"id"`
+	Campaign string    `json:"campaign"`
+	Variant  string    `json:"variant"`
+	Template string    `json:"template"`
+	Version  int       `json:"version"`
+	EmpID    string    `json:"emp_id"`
+	To       string    `json:"to,omitempty"`
+	At       time.Time `json:"at"`
+	DryRun   bool      `json:"dry_run,omitempty"`
+}
+
+type OpenRecord struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+// trackMu serialises appends to the tracking logs of all tenants.
+var trackMu sync.Mutex
+
+func appendJSONL(path string, v any) error {
+	trackMu.Lock()
+	defer trackMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(v); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readJSONL calls fn with every line of path that decodes into a fresh T.
+func readJSONL[T any](path string, fn func(T)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var v T
+		if json.Unmarshal(sc.Bytes(), &v) == nil {
+			fn(v)
+		}
+	}
+}
+
+// campaignMailer renders and queues one campaign run, splitting recipients
+// between the configured variants and logging each send.
+type campaignMailer struct {
+	t        *Tenant
+	campaign string
+	job      string
+	tpl      [2]EmailTemplate // A, B
+	splitB   int
+	Sent     map[string]int // by variant
+	Already  int            // greeted earlier today (sendledger.go)
+}
+
+func newCampaignMailer(t *Tenant, campaign, job string) *campaignMailer {
+	s := t.templates()
+	cv := s.Variants(campaign)
+	m := &campaignMailer{t: t, campaign: campaign, job: job, Sent: map[string]int{}}
+	var ok bool
+	if m.tpl[0], ok = s.Get(cv.A); !ok {
+		log.Printf("campaign %s: template %s missing, using built-in", campaign, cv.A)
+		m.tpl[0], _ = s.Get(TemplateRef{Name: campaign, Version: 1})
+	}
+	if cv.B != nil && cv.SplitB > 0 {
+		if m.tpl[1], ok = s.Get(*cv.B); ok {
+			m.splitB = cv.SplitB
+		} else {
+			log.Printf("campaign %s: variant B template %s missing, sending A only", campaign, cv.B)
+		}
+	}
+	return m
+}
+
+func (m *campaignMailer) variant(e Emp) int {
+	if m.splitB == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(m.campaign + "/" + e.ID))
+	if int(h.Sum32()%100) < m.splitB {
+		return 1
+	}
+	return 0
+}
+
+// Send mails e the campaign's template for e's variant; vars add to (or
+// override) the standard placeholders. It returns errAlreadySent if the
+// send ledger shows e got this campaign today, unless -force.
+func (m *campaignMailer) Send(e Emp, vars map[string]string) error {
+	ledger := m.t.sendLedger()
+	switch {
+	case *forceSend:
+	case !m.t.live() && ledger.Sent(m.campaign, e.ID), m.t.live() && !ledger.Claim(m.campaign, e.ID):
+		m.Already++
+		return errAlreadySent
+	}
+	if err := m.send(e, vars); err != nil {
+		if m.t.live() && !*forceSend {
+			ledger.Release(m.campaign, e.ID)
+		}
+		return err
+	}
+	if m.t.live() {
+		ledger.Record(m.campaign, e.ID, m.job)
+	}
+	return nil
+}
+
+// campaignMail is a greeting as rendered for one employee.
+type campaignMail struct {
+	Variant  string // A or B
+	Template EmailTemplate
+	From     Sender
+	Subject  string
+	Body     string // without the tracking pixel
+}
+
+// compose renders e's mail the way send would, sending nothing.
+func (m *campaignMailer) compose(e Emp, vars map[string]string) (campaignMail, error) {
+	v := m.variant(e)
+	tpl, name := m.tpl[v], string(rune('A'+v))
+	if lang := m.t.prefs().Get(e.ID).Language; lang != "" && lang != "en" {
+		if lt, ok := m.t.templates().Get(TemplateRef{Name: tpl.Name + "-" + lang}); ok {
+			tpl = lt
+		}
+	}
+	from := m.t.senderFor(e.Zone)
+	all := map[string]string{
+		"SALUTATION":     salutation(e),
+		"NAME":           e.Name,
+		"DESIGNATION":    e.Designation,
+		"ZONE":           e.Zone,
+		"SCHOOL":         e.SchoolName,
+		"SENDER":         from.Name,
+		"CHANNEL":        whatsAppChannel,
+		"PREFS_LINK":     m.t.prefsLink(e.ID),
+		"GRIEVANCE_LINK": m.t.grievanceLink(e.ID),
+	}
+	for k, val := range vars {
+		all[k] = val
+	}
+	subject, body, err := tpl.render(all)
+	if err != nil {
+		return campaignMail{}, fmt.Errorf("template %s v%d: %v", tpl.Name, tpl.Version, err)
+	}
+	return campaignMail{Variant: name, Template: tpl, From: from, Subject: subject, Body: body}, nil
+}
+
+func (m *campaignMailer) send(e Emp, vars map[string]string) error {
+	c, err := m.compose(e, vars)
+	if err != nil {
+		return err
+	}
+	id, body := newToken()[:24], c.Body
+	if *publicURL != "" && m.t.TrackingDir != "" {
+		body += `<img src="` + strings.TrimRight(*publicURL, "/") + m.t.Prefix + "/t/open/" + id +
+			`" width="1" height="1" alt="" style="display:none">`
+	}
+	if err := queueMailFor(m.t, m.job, e.ID, c.From, id, e.Email, c.Subject, body); err != nil {
+		return err
+	}
+	m.Sent[c.Variant]++
+	if m.t.TrackingDir != "" {
+		rec := SendRecord{ID: id, Campaign: m.campaign, Variant: c.Variant, Template: c.Template.Name,
+			Version: c.Template.Version, EmpID: e.ID, To: e.Email, At: time.Now(), DryRun: !m.t.live()}
+		if err := appendJSONL(filepath.Join(m.t.TrackingDir, "sends.jsonl"), rec); err != nil {
+			log.Printf("tracking: %v", err)
+		}
+	}
+	return nil
+}
+
+// ---- Handlers ----
+
+// GET/POST /api/templates[?name=]
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	s := tenantFor(r).templates()
+	switch r.Method {
+	case http.MethodGet:
+		all := s.List()
+		if name := r.URL.Query().Get("name"); name != "" {
+			vs, ok := all[name]
+			if !ok {
+				writeError(w, 404, errNotFound, "no template "+name)
+				return
+			}
+			writeData(w, vs, nil)
+			return
+		}
+		writeData(w, all, nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		var tpl EmailTemplate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&tpl); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a template: "+err.Error())
+			return
+		}
+		switch {
+		case !rxTemplateName.MatchString(tpl.Name):
+			writeError(w, 400, errBadRequest, "name: use lowercase letters, digits, - or _")
+			return
+		case strings.TrimSpace(tpl.Subject) == "" || strings.TrimSpace(tpl.Body) == "":
+			writeError(w, 400, errBadRequest, "subject and body are required")
+			return
+		case tpl.Format != "" && tpl.Format != templateFormatGo:
+			writeError(w, 400, errBadRequest, `format must be "go" or empty`)
+			return
+		}
+		if tpl.Format == templateFormatGo {
+			if _, err := compileTemplate(tpl); err != nil {
+				writeError(w, 400, errBadRequest, err.Error())
+				return
+			}
+		}
+		tpl.By, tpl.Created = userFor(r).Name, time.Now()
+		tpl, err := s.Add(tpl)
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("✏️ Template %s v%d saved by %s", tpl.Name, tpl.Version, tpl.By)
+		writeData(w, tpl, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+// GET/POST /api/campaigns
+func handleCampaigns(w http.ResponseWriter, r *http.Request) {
+	s := tenantFor(r).templates()
+	switch r.Method {
+	case http.MethodGet:
+		out := map[string]CampaignVariants{}
+		for _, c := range campaigns {
+			out[c] = s.Variants(c)
+		}
+		writeData(w, out, nil)
+	case http.MethodPost:
+		if !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+			return
+		}
+		var req struct {
+			Campaign string `json:"campaign"`
+			CampaignVariants
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			writeError(w, 400, errBadRequest, "body must be campaign variants: "+err.Error())
+			return
+		}
+		cv := req.CampaignVariants
+		if !knownCampaign(req.Campaign) {
+			writeError(w, 400, errBadRequest, "campaign must be one of "+strings.Join(campaigns, ", "))
+			return
+		}
+		if _, ok := s.Get(cv.A); !ok {
+			writeError(w, 400, errBadRequest, "no template "+cv.A.String()+" for variant A")
+			return
+		}
+		if cv.B != nil {
+			if _, ok := s.Get(*cv.B); !ok {
+				writeError(w, 400, errBadRequest, "no template "+cv.B.String()+" for variant B")
+				return
+			}
+			if cv.SplitB < 1 || cv.SplitB > 99 {
+				writeError(w, 400, errBadRequest, "split_b must be 1-99 when variant B is set")
+				return
+			}
+		} else {
+			cv.SplitB = 0
+		}
+		now := time.Now()
+		cv.By, cv.Updated = userFor(r).Name, &now
+		if err := s.SetCampaign(req.Campaign, cv); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("🧪 Campaign %s set by %s: A=%s, B=%v at %d%%", req.Campaign, cv.By, cv.A, cv.B, cv.SplitB)
+		writeData(w, cv, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+func knownCampaign(name string) bool {
+	for _, c := range campaigns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+var rxMessageID = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// 1×1 transparent GIF.
+var pixelGIF = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// GET /t/open/{id} (public; the pixel in campaign mails)
+func handleOpenPixel(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	if id := r.PathValue("id"); rxMessageID.MatchString(id) && t.TrackingDir != "" {
+		if err := appendJSONL(filepath.Join(t.TrackingDir, "opens.jsonl"), OpenRecord{ID: id, At: time.Now()}); err != nil {
+			log.Printf("tracking: %v", err)
+		}
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(pixelGIF)
+}
+
+type VariantReport struct {
+	Campaign string  `json:"campaign"`
+	Variant  string  `json:"variant"`
+	Template string  `json:"template"`
+	Version  int     `json:"version"`
+	Sent     int     `json:"sent"`
+	Opened   int     `json:"opened"`
+	OpenRate float64 `json:"open_rate"` // percent
+	Replied  int     `json:"replied"`
+	Bounced  int     `json:"bounced"`
+}
+
+// GET /api/templates/report[?campaign=][&dry_run=1]
+//
+// Opens, replies and bounces are counted once per message. Dry-run sends are left out unless
+// dry_run=1. Open rates are a lower bound: many mail clients block images.
+func handleTemplateReport(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	q := r.URL.Query()
+	campaign, dry := q.Get("campaign"), q.Get("dry_run") == "1"
+	if t.TrackingDir == "" {
+		writeData(w, []VariantReport{}, nil)
+		return
+	}
+	opened := map[string]bool{}
+	readJSONL(filepath.Join(t.TrackingDir, "opens.jsonl"), func(o OpenRecord) { opened[o.ID] = true })
+	inbound := map[string]map[string]bool{inboundReply: {}, inboundBounce: {}}
+	readJSONL(filepath.Join(t.TrackingDir, "inbound.jsonl"), func(rec InboundRecord) {
+		if rec.MessageID != "" && inbound[rec.Kind] != nil {
+			inbound[rec.Kind][rec.MessageID] = true
+		}
+	})
+	rows := map[string]*VariantReport{}
+	readJSONL(filepath.Join(t.TrackingDir, "sends.jsonl"), func(s SendRecord) {
+		if (campaign != "" && s.Campaign != campaign) || (s.DryRun && !dry) {
+			return
+		}
+		key := fmt.Sprintf("%s/%s/%s/%d", s.Campaign, s.Variant, s.Template, s.Version)
+		v := rows[key]
+		if v == nil {
+			v = &VariantReport{Campaign: s.Campaign, Variant: s.Variant, Template: s.Template, Version: s.Version}
+			rows[key] = v
+		}
+		v.Sent++
+		if opened[s.ID] {
+			v.Opened++
+		}
+		if inbound[inboundReply][s.ID] {
+			v.Replied++
+		}
+		if inbound[inboundBounce][s.ID] {
+			v.Bounced++
+		}
+	})
+	out := make([]VariantReport, 0, len(rows))
+	for _, v := range rows {
+		if v.Sent > 0 {
+			v.OpenRate = float64(int(float64(v.Opened)/float64(v.Sent)*10000+0.5)) / 100
+		}
+		out = append(out, *v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Campaign != b.Campaign {
+			return a.Campaign < b.Campaign
+		}
+		if a.Variant != b.Variant {
+			return a.Variant < b.Variant
+		}
+		if a.Template != b.Template {
+			return a.Template < b.Template
+		}
+		return a.Version < b.Version
+	})
+	writeData(w, out, nil)
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ---- Tenants ----
+//
+// One process can serve several municipal bodies/departments. Each tenant has
+// its own input files, optional template, users and URL prefix; the mailer
+// (and LiveMode) is shared. Without -tenants there is a single "default"
+// tenant built from the command-line flags and mounted at "/".
+//
+// tenants.json:
+//
+//	{"tenants": [
+//	  {"id": "north", "title": "North MCD", "prefix": "/north",
+//	   "basic": "north/Basic.csv", "services": "north/Services.csv", "dbt": "north/DBT.csv",
+//	   "template": "north/index.html",
+//	   "users": [{"name": "admin", "email": "it@north.example", "role": "admin",
+//	              "password_hash": "<bcrypt hash>", "otp": "2fa"}]}
+//	]}
+//
+// "mcd hash-password" reads a password on stdin and prints its
+// password_hash. The unsalted password_sha256 of older files is refused.
+
+var tenantsFile = flag.String("tenants", "", "JSON file describing tenants (optional; default is one tenant from the flags)")
+
+var rxTenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+type TenantUser struct {
+	Name         string `json:"name"`
+	Email        string `json:"email,omitempty"`
+	Role         string `json:"role,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"` // bcrypt
+	OTP          string `json:"otp,omitempty"`           // "", "2fa" or "passwordless" (see auth.go)
+	Zone         string `json:"zone,omitempty"`          // for a zone head (role "dde"; see circulars.go)
+}
+
+type Tenant struct {
+	ID             string       `json:"id"`
+	Title          string       `json:"title"`
+	Prefix         string       `json:"prefix"`
+	Basic          string       `json:"basic"`
+	Services       string       `json:"services"`
+	DBT            string       `json:"dbt"`
+	Infra          string       `json:"infra,omitempty"`
+	MDM            string       `json:"mdm,omitempty"`
+	Results        string       `json:"results,omitempty"`
+	Periods        string       `json:"periods,omitempty"`
+	Leave          string       `json:"leave,omitempty"`
+	Metrics        string       `json:"metrics,omitempty"`
+	Template       string       `json:"template,omitempty"`
+	SnapshotDir    string       `json:"snapshot_dir,omitempty"`
+	ArchiveDir     string       `json:"archive_dir,omitempty"`
+	DataDir        string       `json:"data_dir,omitempty"`
+	DBTDir         string       `json:"dbt_dir,omitempty"`
+	ZonesGeoJSON   string       `json:"zones_geojson,omitempty"`
+	Locations      string       `json:"school_locations,omitempty"`
+	ProfilesDir    string       `json:"profiles_dir,omitempty"`
+	HistoryDir     string       `json:"history_dir,omitempty"`
+	Overrides      string       `json:"overrides,omitempty"`
+	Blackout       string       `json:"blackout,omitempty"`
+	BadEmails      string       `json:"bad_emails,omitempty"`
+	Charges        string       `json:"charges,omitempty"`
+	EmailTemplates string       `json:"email_templates,omitempty"`
+	EmailTplDir    string       `json:"email_template_dir,omitempty"`
+	TrackingDir    string       `json:"tracking_dir,omitempty"`
+	SendLedger     string       `json:"send_ledger,omitempty"`
+	EmailLog       string       `json:"email_log,omitempty"`
+	RetirementLog  string       `json:"retirement_log,omitempty"`
+	Senders        string       `json:"senders,omitempty"`
+	Prefs          string       `json:"prefs,omitempty"`
+	PublicSnapshot string       `json:"public_snapshot,omitempty"`
+	Transfers      string       `json:"transfers,omitempty"`
+	TransferReqs   string       `json:"transfer_requests,omitempty"`
+	Grievances     string       `json:"grievances,omitempty"`
+	Views          string       `json:"views,omitempty"`
+	Subscriptions  string       `json:"subscriptions,omitempty"`
+	Circulars      string       `json:"circulars,omitempty"`
+	SIContacts     string       `json:"si_contacts,omitempty"`
+	Alerts         string       `json:"alerts,omitempty"`
+	Audits         string       `json:"audits,omitempty"`
+	PayrollOut     string       `json:"payroll_out,omitempty"`
+	FetchFrom      string       `json:"fetch_from,omitempty"`
+	Sandbox        bool         `json:"sandbox,omitempty"` // see sandbox.go
+	Users          []TenantUser `json:"users,omitempty"`
+
+	page        *template.Template
+	data        atomic.Pointer[Dataset]
+	failed      atomic.Pointer[buildFailure]
+	staged      atomic.Pointer[stagedBuild]
+	profile     atomic.Pointer[Profile]
+	skipSig     atomic.Pointer[string] // inputs that failed or were rejected; see watch.go
+	senders     *senderConfig
+	history     *empHistory
+	historyOnce sync.Once
+	buildMu     sync.Mutex // one Build at a time
+	payrollMu   sync.Mutex
+}
+
+var TENANTS []*Tenant
+
+func defaultTenant() *Tenant {
+	return &Tenant{
+		ID: "default", Title: *title, Prefix: "",
+		Basic: *basicCSV, Services: *servCSV, DBT: *dbtCSV, Infra: *infraCSV, MDM: *mdmCSV, Results: *resultsCSV, Periods: *periodsCSV, Leave: *leaveCSV, Metrics: *metricsFile, DBTDir: *dbtDir,
+		ZonesGeoJSON: *zonesGeoJSON, Locations: *schoolLocations,
+		SnapshotDir: *snapshotDir, ArchiveDir: *archiveDir, DataDir: *dataDir, ProfilesDir: *profilesDir,
+		HistoryDir: *historyDir, Overrides: *overridesFile, Blackout: *blackoutFile, BadEmails: *badEmailsFile, Charges: *chargesFile,
+		EmailTemplates: *templatesFile, EmailTplDir: *templateDir, TrackingDir: *trackingDir, SendLedger: *sendLedgerFile, EmailLog: *emailLogFile, RetirementLog: *retirementLogFile, Senders: *sendersFile,
+		Prefs: *prefsFile, PublicSnapshot: *publicSnapshot, Transfers: *transfersFile,
+		TransferReqs: *transferRequestsFile, Grievances: *grievancesFile, Views: *viewsFile,
+		Subscriptions: *subscriptionsFile, Circulars: *circularsFile, PayrollOut: *payrollOut,
+		SIContacts: *siContactsFile, Alerts: *alertsFile, Audits: *auditsFile, FetchFrom: *fetchFrom,
+	}
+}
+
+func loadTenants() ([]*Tenant, error) {
+	if *tenantsFile == "" {
+		t := defaultTenant()
+		var err error
+		if t.senders, err = loadSenders(t.Senders); err != nil {
+			return nil, fmt.Errorf("senders: %v", err)
+		}
+		return []*Tenant{t}, nil
+	}
+	b, err := os.ReadFile(*tenantsFile)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Tenants []*Tenant `json:"tenants"`
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", *tenantsFile, err)
+	}
+	if len(cfg.Tenants) == 0 {
+		return nil, fmt.Errorf("%s: no tenants defined", *tenantsFile)
+	}
+	if err := refuseSHA256Passwords(b); err != nil {
+		return nil, fmt.Errorf("%s: %v", *tenantsFile, err)
+	}
+	seenID, seenPrefix := map[string]bool{}, map[string]bool{}
+	for _, t := range cfg.Tenants {
+		t.Prefix = strings.TrimRight(t.Prefix, "/")
+		if t.Prefix != "" && !strings.HasPrefix(t.Prefix, "/") {
+			t.Prefix = "/" + t.Prefix
+		}
+		switch {
+		case !rxTenantID.MatchString(t.ID):
+			return nil, fmt.Errorf("tenant id %q: use lowercase letters, digits, - or _", t.ID)
+		case seenID[t.ID]:
+			return nil, fmt.Errorf("duplicate tenant id %q", t.ID)
+		case seenPrefix[t.Prefix]:
+			return nil, fmt.Errorf("duplicate tenant prefix %q", t.Prefix)
+		case t.Basic == "" || t.Services == "" || t.DBT == "":
+			return nil, fmt.Errorf("tenant %s: basic, services and dbt are required", t.ID)
+		}
+		seenID[t.ID], seenPrefix[t.Prefix] = true, true
+		for _, u := range t.Users {
+			switch {
+			case u.OTP != "" && u.OTP != otpSecondFactor && u.OTP != otpPasswordless:
+				return nil, fmt.Errorf("tenant %s user %s: otp must be %q or %q", t.ID, u.Name, otpSecondFactor, otpPasswordless)
+			case u.OTP != "" && u.Email == "":
+				return nil, fmt.Errorf("tenant %s user %s: otp needs an email", t.ID, u.Name)
+			case u.Role == roleZoneHead && u.Zone == "":
+				return nil, fmt.Errorf("tenant %s user %s: a %s user needs a zone", t.ID, u.Name, roleZoneHead)
+			case u.PasswordHash != "":
+				if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+					return nil, fmt.Errorf("tenant %s user %s: password_hash: %v", t.ID, u.Name, err)
+				}
+			}
+		}
+		if t.Title == "" {
+			t.Title = *title
+		}
+		if t.SnapshotDir == "" {
+			t.SnapshotDir = filepath.Join(*snapshotDir, t.ID)
+		}
+		if t.ArchiveDir == "" && *archiveDir != "" {
+			t.ArchiveDir = filepath.Join(*archiveDir, t.ID)
+		}
+		if t.ProfilesDir == "" {
+			t.ProfilesDir = filepath.Join(*profilesDir, t.ID)
+		}
+		if t.Overrides == "" {
+			t.Overrides = tenantFile(*overridesFile, t.ID)
+		}
+		if t.Blackout == "" {
+			t.Blackout = tenantFile(*blackoutFile, t.ID)
+		}
+		if t.BadEmails == "" {
+			t.BadEmails = tenantFile(*badEmailsFile, t.ID)
+		}
+		if t.Charges == "" {
+			t.Charges = tenantFile(*chargesFile, t.ID)
+		}
+		if t.EmailTemplates == "" {
+			t.EmailTemplates = tenantFile(*templatesFile, t.ID)
+		}
+		if t.SendLedger == "" {
+			t.SendLedger = tenantFile(*sendLedgerFile, t.ID)
+		}
+		if t.EmailLog == "" {
+			t.EmailLog = tenantFile(*emailLogFile, t.ID)
+		}
+		if t.RetirementLog == "" {
+			t.RetirementLog = tenantFile(*retirementLogFile, t.ID)
+		}
+		if t.TrackingDir == "" && *trackingDir != "" {
+			t.TrackingDir = filepath.Join(*trackingDir, t.ID)
+		}
+		if t.PublicSnapshot == "" {
+			t.PublicSnapshot = tenantFile(*publicSnapshot, t.ID)
+		}
+		if t.Transfers == "" {
+			t.Transfers = tenantFile(*transfersFile, t.ID)
+		}
+		if t.TransferReqs == "" {
+			t.TransferReqs = tenantFile(*transferRequestsFile, t.ID)
+		}
+		if t.Grievances == "" {
+			t.Grievances = tenantFile(*grievancesFile, t.ID)
+		}
+		if t.Prefs == "" {
+			t.Prefs = tenantFile(*prefsFile, t.ID)
+		}
+		if t.Views == "" {
+			t.Views = tenantFile(*viewsFile, t.ID)
+		}
+		if t.Subscriptions == "" {
+			t.Subscriptions = tenantFile(*subscriptionsFile, t.ID)
+		}
+		if t.Circulars == "" {
+			t.Circulars = tenantFile(*circularsFile, t.ID)
+		}
+		if t.Alerts == "" {
+			t.Alerts = tenantFile(*alertsFile, t.ID)
+		}
+		if t.Audits == "" {
+			t.Audits = tenantFile(*auditsFile, t.ID)
+		}
+		if t.PayrollOut == "" {
+			t.PayrollOut = *payrollOut
+		}
+		if t.FetchFrom == "" {
+			t.FetchFrom = *fetchFrom
+		}
+		if t.Senders == "" {
+			t.Senders = *sendersFile
+		}
+		if t.SIContacts == "" {
+			t.SIContacts = *siContactsFile
+		}
+		if t.EmailTplDir == "" {
+			t.EmailTplDir = *templateDir
+		}
+		if t.senders, err = loadSenders(t.Senders); err != nil {
+			return nil, fmt.Errorf("tenant %s senders: %v", t.ID, err)
+		}
+		if t.HistoryDir == "" && *historyDir != "" {
+			t.HistoryDir = filepath.Join(*historyDir, t.ID)
+		}
+		if t.DataDir == "" && *dataDir != "" {
+			t.DataDir = filepath.Join(*dataDir, t.ID)
+		}
+		if t.Template != "" {
+			tpl, err := os.ReadFile(t.Template)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s template: %v", t.ID, err)
+			}
+			if t.page, err = parsePage(string(tpl)); err != nil {
+				return nil, fmt.Errorf("tenant %s template: %v", t.ID, err)
+			}
+		}
+	}
+	return cfg.Tenants, nil
+}
+
+// inputs are the tenant's files with the active profile applied.
+func (t *Tenant) inputs() Inputs { return t.inputsFor(t.profile.Load()) }
+
+// inputsFor are the tenant's files with p (nil = none) applied.
+func (t *Tenant) inputsFor(p *Profile) Inputs {
+	in := Inputs{Basic: t.Basic, Services: t.Services, DBT: t.DBT, DataDir: t.DataDir, Overrides: t.Overrides, Charges: t.Charges, Infra: t.Infra, MDM: t.MDM, Results: t.Results, Periods: t.Periods, Leave: t.Leave, Metrics: t.Metrics, DBTDir: t.DBTDir, ZonesGeoJSON: t.ZonesGeoJSON, Locations: t.Locations}
+	if p != nil {
+		in = p.apply(in)
+	}
+	return in
+}
+
+// Build re-reads the tenant's inputs (or its active profile's) and atomically
+// swaps in the new dataset. The first build after a restart comes from -db
+// when the inputs haven't changed since it was stored. If the inputs can't
+// be read the previous build stays in service and the error is returned;
+// with no previous build it is fatal. With -stage, or when its inputs look
+// anomalous (inputchecks.go), a rebuild waits for an admin's approval
+// instead of being served (stage.go). Builds of one tenant run one at a
+// time, so the watcher, a profile switch and /refresh can't interleave.
+func (t *Tenant) Build() error {
+	t.buildMu.Lock()
+	defer t.buildMu.Unlock()
+	return t.build(t.profile.Load())
+}
+
+// BuildWith is Build from profile p; p becomes the active profile once the
+// build is served, and a build that fails leaves the previous one active.
+func (t *Tenant) BuildWith(p *Profile) error {
+	t.buildMu.Lock()
+	defer t.buildMu.Unlock()
+	return t.build(p)
+}
+
+// build is Build with t.buildMu held.
+func (t *Tenant) build(p *Profile) error {
+	in := t.inputsFor(p)
+	if p != nil {
+		log.Printf("🏢 Building tenant %s (profile %s)", t.ID, p.Name)
+	} else {
+		log.Printf("🏢 Building tenant %s", t.ID)
+	}
+	prov := inputProvenance(t, in)
+	var ds *Dataset
+	if t.data.Load() == nil {
+		ds = restoreBuild(t, in)
+	}
+	if ds == nil {
+		var err error
+		if ds, err = loadDataset(in); err != nil {
+			if t.data.Load() == nil {
+				log.Fatalf("tenant %s: %v", t.ID, err)
+			}
+			log.Printf("tenant %s: %v (still serving the build of %s)", t.ID, err, t.data.Load().BuiltAt.Format("02 Jan 15:04"))
+			t.failed.Store(&buildFailure{At: time.Now(), Error: err.Error()})
+			sig := inputsSig(in)
+			t.skipSig.Store(&sig) // don't retry until the files change again
+			return err
+		}
+	}
+	ds.Provenance = prov
+	if p != nil {
+		ds.Profile = p.Name
+	}
+	if served := t.data.Load(); served != nil {
+		anomalies := inputAnomalies(served, ds)
+		if len(anomalies) > 0 {
+			logAnomalies(t, anomalies)
+		}
+		if *stageBuilds || (len(anomalies) > 0 && *anomalyHold) {
+			t.stage(ds, p, anomalies)
+			return nil
+		}
+	}
+	t.publish(ds, p)
+	return nil
+}
+
+// publish makes ds the served build and hands it to everything that
+// follows builds.
+func (t *Tenant) publish(ds *Dataset, p *Profile) {
+	prev := t.data.Load()
+	t.data.Store(ds)
+	t.profile.Store(p)
+	t.failed.Store(nil)
+	t.skipSig.Store(nil)
+	writeDataFiles(ds)
+	storeBuild(t, ds)
+	writePublicSnapshot(t, ds)
+	writeZonePages(t, ds)
+	if t.Transfers != "" {
+		t.transfers().reconcile(ds)
+	}
+	if t.HistoryDir != "" {
+		t.historyOnce.Do(func() { t.history = openHistory(t.HistoryDir) })
+		changes := t.history.record(ds)
+		if t.PayrollOut != "" {
+			feedPayroll(t, prev, ds, changes)
+		}
+	}
+	if p != nil && p.Snapshot != "" {
+		if _, err := saveSnapshot(t, p.Snapshot); err != nil {
+			log.Printf("snapshot %s/%s: %v", t.ID, p.Snapshot, err)
+		}
+	}
+}
+
+func (t *Tenant) Data() *Dataset { return t.data.Load() }
+
+// PageTitle is the active profile's title, else the tenant's.
+func (t *Tenant) PageTitle() string {
+	title := t.Title
+	if p := t.profile.Load(); p != nil && p.Title != "" {
+		title = p.Title
+	}
+	if t.sandboxed() {
+		title += " (sandbox)"
+	}
+	return title
+}
+
+func (t *Tenant) Page() *template.Template {
+	if t.page != nil {
+		return t.page
+	}
+	return defaultPage
+}
+
+type ctxKey int
+
+const (
+	ctxTenant ctxKey = iota
+	ctxUser
+)
+
+func tenantFor(r *http.Request) *Tenant {
+	if t, ok := r.Context().Value(ctxTenant).(*Tenant); ok {
+		return t
+	}
+	return TENANTS[0]
+}
+
+func dataFor(r *http.Request) *Dataset { return tenantFor(r).Data() }
+
+func userFor(r *http.Request) *TenantUser {
+	u, _ := r.Context().Value(ctxUser).(*TenantUser)
+	return u
+}
+
+// refuseSHA256Passwords fails on a user still carrying the old unsalted
+// password_sha256, who could otherwise no longer log in without a word.
+func refuseSHA256Passwords(b []byte) error {
+	var old struct {
+		Tenants []struct {
+			ID    string `json:"id"`
+			Users []struct {
+				Name   string `json:"name"`
+				SHA256 string `json:"password_sha256"`
+			} `json:"users"`
+		} `json:"tenants"`
+	}
+	json.Unmarshal(b, &old)
+	for _, t := range old.Tenants {
+		for _, u := range t.Users {
+			if u.SHA256 != "" {
+				return fmt.Errorf("tenant %s user %s: password_sha256 is no longer accepted; set password_hash from \"mcd hash-password\"", t.ID, u.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// noUserHash is compared against when no user has the name, so an unknown
+// name takes as long to refuse as a wrong password.
+var noUserHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("no such user"), bcrypt.DefaultCost)
+	return h
+})
+
+func (t *Tenant) authenticate(name, pass string) *TenantUser {
+	for i := range t.Users {
+		u := &t.Users[i]
+		if u.Name != name {
+			continue
+		}
+		if u.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(pass)) != nil {
+			return nil
+		}
+		return u
+	}
+	bcrypt.CompareHashAndPassword(noUserHash(), []byte(pass))
+	return nil
+}
+
+// publicPath is reachable without logging in. Widgets are aggregate-only
+// and meant to be embedded elsewhere; /t/ holds the mail open pixels,
+// /hooks/ checks its own shared secret and /prefs, /grievance and
+// /alert/ack a signed link.
+func publicPath(p string) bool {
+	return strings.HasPrefix(p, "/widgets/") || strings.HasPrefix(p, "/t/") || strings.HasPrefix(p, "/hooks/") ||
+		p == "/prefs" || p == "/grievance" || p == "/alert/ack" || p == "/login" || p == "/login/verify"
+}
+
+// localOperator is the user of every request to a tenant without users.
+// Such a tenant is open: whoever reaches it may do anything, as before
+// logins existed, so it acts as a superadmin.
+var localOperator = &TenantUser{Name: "local", Role: roleSuperAdmin}
+
+// withTenant attaches the tenant to the request and, when the tenant has
+// users, requires a login session or HTTP Basic auth; otherwise the
+// request runs as localOperator.
+func withTenant(t *Tenant, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxTenant, t)
+		if len(t.Users) == 0 {
+			ctx = context.WithValue(ctx, ctxUser, localOperator)
+		} else if !publicPath(r.URL.Path) {
+			u := t.requestUser(r)
+			if u == nil {
+				challenge(w, r, t)
+				return
+			}
+			ctx = context.WithValue(ctx, ctxUser, u)
+		}
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// mountTenants puts each tenant's routes under its prefix on root.
+func mountTenants(root *http.ServeMux, routes func() *http.ServeMux) {
+	hasRoot := false
+	for _, t := range TENANTS {
+		h := withTenant(t, withRateLimit(routes()))
+		if t.Prefix == "" {
+			hasRoot = true
+			root.Handle("/", h)
+			continue
+		}
+		root.Handle(t.Prefix+"/", http.StripPrefix(t.Prefix, h))
+		root.Handle(t.Prefix, http.RedirectHandler(t.Prefix+"/", http.StatusMovedPermanently))
+	}
+	if !hasRoot {
+		root.HandleFunc("/", handleTenantIndex)
+	}
+}
+
+func handleTenantIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var b strings.Builder
+	for _, t := range TENANTS {
+		fmt.Fprintf(&b, `<li><a href="%s/">%s</a></li>`, html.EscapeString(t.Prefix), html.EscapeString(t.Title))
+	}
+	fmt.Fprintf(w, `<!doctype html><html lang="en"><head><meta charset="utf-8"><title>%s</title></head>
+<body style="font-family:system-ui;background:#0d1b2a;color:#f1f5f9"><h1>%s</h1><ul>%s</ul></body></html>`,
+		html.EscapeString(*title), html.EscapeString(*title), b.String())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ---- TLS ----
+//
+// With -tls-cert/-tls-key the server speaks HTTPS. The key pair is re-read
+// when either file changes (checked every -tls-reload) or on SIGHUP, and
+// served to new handshakes only; open connections are untouched, so a
+// certificate renewal needs no restart. A pair that fails to load is logged
+// and the previous one stays in use.
+
+var (
+	tlsCert   = flag.String("tls-cert", "", "TLS certificate (PEM, full chain) — enables HTTPS")
+	tlsKey    = flag.String("tls-key", "", "TLS private key (PEM)")
+	tlsReload = flag.Duration("tls-reload", time.Minute, "How often to check the certificate files for changes (0 = only on SIGHUP)")
+)
+
+type certReloader struct {
+	certPath, keyPath string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modCert time.Time
+	modKey  time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	return r, r.load()
+}
+
+func modTime(path string) time.Time {
+	st, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return st.ModTime()
+}
+
+func (r *certReloader) load() error {
+	mc, mk := modTime(r.certPath), modTime(r.keyPath)
+	pair, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+	if leaf, err := x509.ParseCertificate(pair.Certificate[0]); err == nil {
+		pair.Leaf = leaf
+		log.Printf("🔐 TLS certificate %q loaded, valid until %s", leaf.Subject.CommonName, leaf.NotAfter.Format("2006-01-02"))
+	}
+	r.mu.Lock()
+	r.cert, r.modCert, r.modKey = &pair, mc, mk
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !modTime(r.certPath).Equal(r.modCert) || !modTime(r.keyPath).Equal(r.modKey)
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) reload(why string) {
+	if err := r.load(); err != nil {
+		log.Printf("TLS reload (%s) failed, keeping current certificate: %v", why, err)
+		// Don't retry the same broken files on every tick.
+		r.mu.Lock()
+		r.modCert, r.modKey = modTime(r.certPath), modTime(r.keyPath)
+		r.mu.Unlock()
+	}
+}
+
+func (r *certReloader) watch(every time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	if every > 0 {
+		tick = time.NewTicker(every).C
+	}
+	go func() {
+		for {
+			select {
+			case <-hup:
+				r.reload("SIGHUP")
+			case <-tick:
+				if r.changed() {
+					r.reload("file changed")
+				}
+			}
+		}
+	}()
+}
+
+// setupTLS configures srv for HTTPS when -tls-cert is given.
+func setupTLS(srv *http.Server) error {
+	if *tlsCert == "" && *tlsKey == "" {
+		return nil
+	}
+	r, err := newCertReloader(*tlsCert, *tlsKey)
+	if err != nil {
+		return err
+	}
+	r.watch(*tlsReload)
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: r.GetCertificate}
+	return nil
+}
+
+// listenAndServe serves HTTPS when setupTLS configured it, else HTTP.
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
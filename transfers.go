@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"myproject/ingest"
+)
+
+// ---- Transfer orders ----
+//
+// Issued transfer orders are imported from the establishment branch's CSV
+// and kept per tenant. After every build each open order is checked against
+// the Basic file: once the employee shows up at the destination school the
+// order is marked joined (with the build date). Orders still open after
+// transferGraceDays are overdue; a later order for the same employee
+// supersedes an earlier one.
+//
+//	POST /api/transfers[?dry_run=1]                  (CSV body or multipart "file")
+//	GET  /api/transfers[?status=pending][&zone=][&emp=]
+//	GET  /api/transfers/report                       (issued but not joined, per zone)
+//	mcd-dashboard import-transfers orders.csv [tenant-id]
+//
+// CSV columns (header required, names as in the branch register): Order No,
+// Order Date, Employee ID, Name, From School ID, To School ID, Effective Date.
+
+var transfersFile = flag.String("transfers", "./out/transfers.json", "Issued transfer orders tracked against the Basic file (managed via /api/transfers)")
+
+const transferGraceDays = 15
+
+const (
+	transferPending    = "pending"
+	transferJoined     = "joined"
+	transferSuperseded = "superseded"
+)
+
+type TransferOrder struct {
+	OrderNo    string     `json:"order_no"`
+	OrderDate  string     `json:"order_date"` // YYYY-MM-DD
+	EmpID      string     `json:"emp_id"`
+	Name       string     `json:"name,omitempty"`
+	FromSchool string     `json:"from_school,omitempty"`
+	ToSchool   string     `json:"to_school"`
+	ToZone     string     `json:"to_zone"`
+	Effective  string     `json:"effective,omitempty"` // YYYY-MM-DD
+	Source     string     `json:"source,omitempty"`
+	Imported   time.Time  `json:"imported"`
+	JoinedOn   *time.Time `json:"joined_on,omitempty"`
+
+	// Filled in on read.
+	Status      string `json:"status,omitempty"`
+	DaysPending int    `json:"days_pending,omitempty"`
+	Overdue     bool   `json:"overdue,omitempty"`
+	CurSchool   string `json:"current_school,omitempty"`
+}
+
+func (o TransferOrder) key() string { return o.OrderNo + "/" + o.EmpID }
+
+// due is the date the employee should have joined by: the effective date,
+// else the order date.
+func (o TransferOrder) due() time.Time {
+	for _, s := range []string{o.Effective, o.OrderDate} {
+		if d, err := time.Parse("2006-01-02", s); err == nil {
+			return d
+		}
+	}
+	return o.Imported
+}
+
+type transferBook struct {
+	mu     sync.Mutex
+	path   string
+	orders []TransferOrder
+}
+
+var (
+	transferBooksMu sync.Mutex
+	transferBooks   = map[string]*transferBook{} // by tenant id
+)
+
+// transfers returns the tenant's orders, loading them on first use.
+func (t *Tenant) transfers() *transferBook {
+	transferBooksMu.Lock()
+	defer transferBooksMu.Unlock()
+	if b, ok := transferBooks[t.ID]; ok {
+		return b
+	}
+	b := &transferBook{path: t.Transfers}
+	if data, err := os.ReadFile(t.Transfers); err == nil {
+		if err := json.Unmarshal(data, &b.orders); err != nil {
+			log.Printf("transfers %s: %v", t.Transfers, err)
+		}
+	}
+	transferBooks[t.ID] = b
+	return b
+}
+
+func (b *transferBook) save() error {
+	if b.path == "" {
+		return fmt.Errorf("no transfers file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(b.orders, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(b.path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(b.path+".tmp", b.path)
+}
+
+// reconcile marks open orders whose employee is now at the destination
+// school in ds as joined, and saves when anything changed.
+func (b *transferBook) reconcile(ds *Dataset) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for i, o := range b.orders {
+		if o.JoinedOn != nil {
+			continue
+		}
+		if e, ok := ds.EMP[o.EmpID]; ok && ingest.DigitsOnly(e.SchoolID) == o.ToSchool {
+			at := ds.BuiltAt
+			b.orders[i].JoinedOn = &at
+			n++
+		}
+	}
+	if n > 0 {
+		if err := b.save(); err != nil {
+			log.Printf("transfers %s: %v", b.path, err)
+		}
+		log.Printf("🔁 %d transfer orders now reflected in the Basic file", n)
+	}
+	return n
+}
+
+// List returns every order with its status as of now, newest order first.
+func (b *transferBook) List(ds *Dataset) []TransferOrder {
+	b.mu.Lock()
+	out := append([]TransferOrder(nil), b.orders...)
+	b.mu.Unlock()
+	latest := map[string]TransferOrder{}
+	for _, o := range out {
+		if l, ok := latest[o.EmpID]; !ok || o.OrderDate > l.OrderDate || (o.OrderDate == l.OrderDate && o.Imported.After(l.Imported)) {
+			latest[o.EmpID] = o
+		}
+	}
+	today := time.Now().Truncate(24 * time.Hour)
+	for i := range out {
+		o := &out[i]
+		o.CurSchool = ds.EMP[o.EmpID].SchoolID
+		switch {
+		case o.JoinedOn != nil:
+			o.Status = transferJoined
+		case latest[o.EmpID].key() != o.key():
+			o.Status = transferSuperseded
+		default:
+			o.Status = transferPending
+			if d := int(today.Sub(o.due()).Hours() / 24); d > 0 {
+				o.DaysPending = d
+				o.Overdue = d > transferGraceDays
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].OrderDate != out[j].OrderDate {
+			return out[i].OrderDate > out[j].OrderDate
+		}
+		return out[i].key() < out[j].key()
+	})
+	return out
+}
+
+type TransferImportIssue struct {
+	Line    int    `json:"line"`
+	OrderNo string `json:"order_no"`
+	EmpID   string `json:"emp_id"`
+	Reason  string `json:"reason"`
+}
+
+type TransferImportReport struct {
+	Rows     int                   `json:"rows"`
+	Added    int                   `json:"added"`
+	Updated  int                   `json:"updated"`
+	Joined   int                   `json:"already_joined"`
+	DryRun   bool                  `json:"dry_run,omitempty"`
+	Invalid  []TransferImportIssue `json:"invalid"`
+	Warnings []TransferImportIssue `json:"warnings"`
+}
+
+type transferRow struct {
+	Line int
+	Err  string // set when a date could not be read
+	TransferOrder
+}
+
+// parseOrderDate accepts the register's DD/MM/YYYY-style dates and ISO ones.
+func parseOrderDate(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if d, err := time.Parse("2006-01-02", s); err == nil {
+		return d.Format("2006-01-02"), nil
+	}
+	d, err := ingest.ParseDMYFlexible(s)
+	if err != nil {
+		return "", fmt.Errorf("unreadable date %q", s)
+	}
+	return d.Format("2006-01-02"), nil
+}
+
+// parseTransferCSV reads the order register; rows with unreadable dates carry
+// Err so the import can report them by line.
+func parseTransferCSV(r io.Reader) ([]transferRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	if _, ok := m["employee id"]; !ok {
+		if _, ok := m["emp id"]; !ok {
+			return nil, fmt.Errorf("header needs an Employee ID column")
+		}
+	}
+	var out []transferRow
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := transferRow{Line: line, TransferOrder: TransferOrder{
+			OrderNo:    ingest.Get(rec, m, "order no", "order number", "order_no"),
+			EmpID:      ingest.NormalizeEmpID(ingest.Get(rec, m, "employee id", "emp id", "empid")),
+			Name:       ingest.Get(rec, m, "name", "employee name"),
+			FromSchool: ingest.DigitsOnly(ingest.Get(rec, m, "from school id", "from school", "present school id")),
+			ToSchool:   ingest.DigitsOnly(ingest.Get(rec, m, "to school id", "to school", "posted to")),
+		}}
+		var derr error
+		if row.OrderDate, derr = parseOrderDate(ingest.Get(rec, m, "order date", "order_date")); derr == nil {
+			row.Effective, derr = parseOrderDate(ingest.Get(rec, m, "effective date", "relieving date", "effective"))
+		}
+		if derr != nil {
+			row.Err = derr.Error()
+		}
+		out = append(out, row)
+	}
+}
+
+// importTransfers validates rows against ds and, unless dryRun, adds them to
+// the tenant's book (an order already on file is updated in place).
+func importTransfers(t *Tenant, ds *Dataset, rows []transferRow, source string, dryRun bool) (TransferImportReport, error) {
+	rep := TransferImportReport{Rows: len(rows), DryRun: dryRun, Invalid: []TransferImportIssue{}, Warnings: []TransferImportIssue{}}
+	if t.Transfers == "" {
+		return rep, fmt.Errorf("no transfers file configured")
+	}
+	b := t.transfers()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	have := map[string]int{}
+	for i, o := range b.orders {
+		have[o.key()] = i
+	}
+	now := time.Now()
+	var accepted []TransferOrder
+	seen := map[string]bool{}
+	for _, r := range rows {
+		o := r.TransferOrder
+		issue := TransferImportIssue{Line: r.Line, OrderNo: o.OrderNo, EmpID: o.EmpID}
+		sch, schOK := ds.SCH[o.ToSchool]
+		e, empOK := ds.EMP[o.EmpID]
+		switch {
+		case r.Err != "":
+			issue.Reason = r.Err
+		case o.OrderNo == "":
+			issue.Reason = "missing order number"
+		case o.EmpID == "":
+			issue.Reason = "missing employee id"
+		case o.ToSchool == "":
+			issue.Reason = "missing destination school"
+		case !schOK:
+			issue.Reason = "unknown destination school " + o.ToSchool
+		case !empOK:
+			issue.Reason = "unknown employee"
+		case seen[o.key()]:
+			issue.Reason = "order listed twice for this employee"
+		}
+		if issue.Reason != "" {
+			rep.Invalid = append(rep.Invalid, issue)
+			continue
+		}
+		seen[o.key()] = true
+		if o.FromSchool != "" && ingest.DigitsOnly(e.SchoolID) != o.FromSchool && ingest.DigitsOnly(e.SchoolID) != o.ToSchool {
+			issue.Reason = "employee is at school " + e.SchoolID + ", not " + o.FromSchool
+			rep.Warnings = append(rep.Warnings, issue)
+		}
+		if o.Name == "" {
+			o.Name = e.Name
+		}
+		o.ToZone, o.Source, o.Imported = sch.Zone, source, now
+		if ingest.DigitsOnly(e.SchoolID) == o.ToSchool {
+			at := ds.BuiltAt
+			o.JoinedOn = &at
+			rep.Joined++
+		}
+		if i, ok := have[o.key()]; ok {
+			if old := b.orders[i].JoinedOn; old != nil {
+				o.JoinedOn = old
+			}
+			o.Imported = b.orders[i].Imported
+			rep.Updated++
+		} else {
+			rep.Added++
+		}
+		accepted = append(accepted, o)
+	}
+	if dryRun || len(accepted) == 0 {
+		return rep, nil
+	}
+	for _, o := range accepted {
+		if i, ok := have[o.key()]; ok {
+			b.orders[i] = o
+		} else {
+			have[o.key()] = len(b.orders)
+			b.orders = append(b.orders, o)
+		}
+	}
+	return rep, b.save()
+}
+
+type TransferZoneRow struct {
+	Zone            string `json:"zone"`
+	Issued          int    `json:"issued"`
+	Joined          int    `json:"joined"`
+	Pending         int    `json:"pending"`
+	Overdue         int    `json:"overdue"`
+	Superseded      int    `json:"superseded"`
+	OldestPending   int    `json:"oldest_pending_days"`
+	AvgDaysToJoin   int    `json:"avg_days_to_join"`
+	joinDays, nJoin int
+}
+
+// transferReport counts orders per destination zone; the last row is ALL.
+func transferReport(orders []TransferOrder) []TransferZoneRow {
+	byZone := map[string]*TransferZoneRow{}
+	all := &TransferZoneRow{Zone: allZones}
+	for _, o := range orders {
+		z := byZone[o.ToZone]
+		if z == nil {
+			z = &TransferZoneRow{Zone: o.ToZone}
+			byZone[o.ToZone] = z
+		}
+		for _, r := range []*TransferZoneRow{z, all} {
+			r.Issued++
+			switch o.Status {
+			case transferJoined:
+				r.Joined++
+				if d := int(o.JoinedOn.Sub(o.due()).Hours() / 24); d > 0 {
+					r.joinDays += d
+				}
+				r.nJoin++
+			case transferSuperseded:
+				r.Superseded++
+			default:
+				r.Pending++
+				if o.Overdue {
+					r.Overdue++
+				}
+				if o.DaysPending > r.OldestPending {
+					r.OldestPending = o.DaysPending
+				}
+			}
+		}
+	}
+	out := make([]TransferZoneRow, 0, len(byZone)+1)
+	for _, z := range byZone {
+		out = append(out, *z)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Pending != out[j].Pending {
+			return out[i].Pending > out[j].Pending
+		}
+		return out[i].Zone < out[j].Zone
+	})
+	out = append(out, *all)
+	for i := range out {
+		if out[i].nJoin > 0 {
+			out[i].AvgDaysToJoin = out[i].joinDays / out[i].nJoin
+		}
+	}
+	return out
+}
+
+// GET/POST /api/transfers
+func handleTransfers(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		status, zone, emp := q.Get("status"), strings.ToUpper(q.Get("zone")), ingest.NormalizeEmpID(q.Get("emp"))
+		out := []TransferOrder{}
+		for _, o := range t.transfers().List(ds) {
+			if (status == "" || o.Status == status || (status == "overdue" && o.Overdue)) &&
+				(zone == "" || o.ToZone == zone) && (emp == "" || o.EmpID == emp) {
+				out = append(out, o)
+			}
+		}
+		page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+		items, meta := paginate(out, page, per)
+		writeData(w, items, meta)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+		var body io.Reader = r.Body
+		source := "import via API"
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			f, hdr, err := r.FormFile("file")
+			if err != nil {
+				writeError(w, 400, errBadRequest, "multipart upload needs a \"file\" part: "+err.Error())
+				return
+			}
+			defer f.Close()
+			body, source = f, "import "+hdr.Filename
+		}
+		rows, err := parseTransferCSV(body)
+		if err != nil {
+			writeError(w, 400, errBadRequest, "csv: "+err.Error())
+			return
+		}
+		rep, err := importTransfers(t, ds, rows, source+" by "+userFor(r).Name, r.URL.Query().Get("dry_run") == "1")
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("🔁 Transfer import by %s: %d rows, %d added, %d updated, %d invalid",
+			userFor(r).Name, rep.Rows, rep.Added, rep.Updated, len(rep.Invalid))
+		writeData(w, rep, nil)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET or POST required")
+	}
+}
+
+// GET /api/transfers/report
+func handleTransferReport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleEstablishment, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	rows := transferReport(tenantFor(r).transfers().List(dataFor(r)))
+	writeData(w, rows, &Meta{Count: len(rows)})
+}
+
+// cmdImportTransfers is the import-transfers subcommand: flag.Args() holds
+// the CSV path and an optional tenant id.
+func cmdImportTransfers([]string) error {
+	args := flag.Args()
+	if len(args) < 1 {
+		return fmt.Errorf("usage: import-transfers <orders.csv> [tenant-id]")
+	}
+	t, err := subcommandTenant(args[1:])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rows, err := parseTransferCSV(f)
+	if err != nil {
+		return err
+	}
+	rep, err := importTransfers(t, buildAll(t.inputs()), rows, "import "+args[0], false)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d rows: %d added, %d updated, %d already joined, %d invalid\n",
+		rep.Rows, rep.Added, rep.Updated, rep.Joined, len(rep.Invalid))
+	for _, c := range rep.Invalid {
+		fmt.Printf("  invalid line %d: order %s emp %s: %s\n", c.Line, c.OrderNo, c.EmpID, c.Reason)
+	}
+	for _, c := range rep.Warnings {
+		fmt.Printf("  warning line %d: order %s emp %s: %s\n", c.Line, c.OrderNo, c.EmpID, c.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Month-over-month trend ----
+//
+// -dbt-dir (a tenant's "dbt_dir") is a directory of monthly DBT summaries,
+// Dashboard_Summary_YYYYMM.csv (or .xlsx), in the layout -dbt reads. Each
+// build reads them all into a time series per school, and adds them up by
+// zone and overall: enrolment, Aadhaar seeding and the DBT counts. Files
+// named otherwise are ignored; a month that fails to read is logged and
+// left out.
+//
+// The page gets the months with the overall and zone series as {{.Trend}}
+// ({{TREND_JSON}} in an older template) for its month-over-month charts;
+// each school's series is on the API:
+//
+//	GET /api/trend[?zone=][&school=][&format=csv]
+
+var dbtDir = flag.String("dbt-dir", "", "Directory of monthly DBT summaries named Dashboard_Summary_YYYYMM.csv for the trend charts (optional)")
+
+var rxTrendFile = regexp.MustCompile(`(?i)^Dashboard_Summary_(\d{4})(\d{2})\.(csv|xlsx)$`)
+
+// TrendPoint is one month's figures for a school, a zone or all of them.
+type TrendPoint struct {
+	Month         string  `json:"month"` // YYYY-MM
+	Schools       int     `json:"schools"`
+	Enrolment     int     `json:"enrolment"`
+	WithAadhaar   int     `json:"with_aadhaar"`
+	AadhaarPct    float64 `json:"aadhaar_pct"` // with Aadhaar over those with and without
+	AadhaarLinked int     `json:"aadhaar_linked_acc"`
+	DBTStudent    int     `json:"dbt_student"`
+	DBTParent     int     `json:"dbt_parent"`
+	DBTTotal      int     `json:"dbt_total"`
+
+	withoutAadhaar int
+}
+
+// add counts s's figures into p.
+func (p *TrendPoint) add(s School) {
+	p.Schools++
+	p.Enrolment += s.TotalEnrolment
+	p.WithAadhaar += s.WithAadhaar
+	p.withoutAadhaar += s.WithoutAadhaar
+	p.AadhaarLinked += s.AadhaarLinkedAcc
+	p.DBTStudent += s.DBTStudent
+	p.DBTParent += s.DBTParent
+	p.DBTTotal += s.DBTTotal
+	p.AadhaarPct = pct1(p.WithAadhaar, p.WithAadhaar+p.withoutAadhaar)
+}
+
+// Trend is the series the monthly summaries make, every month in each
+// series of Overall and Zones; a school's has the months it appears in.
+type Trend struct {
+	Months  []string                `json:"months"`
+	Overall []TrendPoint            `json:"overall"`
+	Zones   map[string][]TrendPoint `json:"zones"`
+	schools map[string][]TrendPoint
+	names   map[string]School // the latest month's, for the zone and name
+}
+
+// loadTrend reads the summaries in dir into ds.TREND, nil without any.
+func loadTrend(ds *Dataset, dir string) {
+	ds.TREND = nil
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("dbt-dir %s: %v", dir, err)
+		return
+	}
+	months := map[string]map[string]School{}
+	for _, en := range entries {
+		m := rxTrendFile.FindStringSubmatch(en.Name())
+		if en.IsDir() || m == nil {
+			continue
+		}
+		if mm, _ := strconv.Atoi(m[2]); mm < 1 || mm > 12 {
+			log.Printf("dbt-dir %s: no month %s", en.Name(), m[2])
+			continue
+		}
+		month := m[1] + "-" + m[2]
+		if months[month] != nil {
+			log.Printf("dbt-dir %s: a second summary for %s, skipped", en.Name(), month)
+			continue
+		}
+		t, err := ingest.LoadDBT(filepath.Join(dir, en.Name()))
+		if err != nil {
+			log.Printf("dbt-dir %v", err)
+			continue
+		}
+		months[month] = ingest.Schools(t)
+	}
+	if len(months) == 0 {
+		log.Printf("dbt-dir %s: no Dashboard_Summary_YYYYMM files", dir)
+		return
+	}
+	tr := &Trend{Months: sortedKeys(months), Zones: map[string][]TrendPoint{}, schools: map[string][]TrendPoint{}, names: map[string]School{}}
+	zones := map[string]bool{}
+	for _, sch := range months {
+		for _, s := range sch {
+			zones[s.Zone] = true
+		}
+	}
+	for _, month := range tr.Months {
+		all := TrendPoint{Month: month}
+		byZone := map[string]*TrendPoint{}
+		for z := range zones {
+			byZone[z] = &TrendPoint{Month: month}
+		}
+		for id, s := range months[month] {
+			all.add(s)
+			byZone[s.Zone].add(s)
+			p := TrendPoint{Month: month}
+			p.add(s)
+			tr.schools[id] = append(tr.schools[id], p)
+			tr.names[id] = s
+		}
+		tr.Overall = append(tr.Overall, all)
+		for z, p := range byZone {
+			tr.Zones[z] = append(tr.Zones[z], *p)
+		}
+	}
+	ds.TREND = tr
+	log.Printf("📈 Trend: %d month(s) from %s to %s, %d school(s)", len(tr.Months), tr.Months[0], tr.Months[len(tr.Months)-1], len(tr.schools))
+}
+
+// TrendSeries is the API's view: one school's, zone's or the overall series.
+type TrendSeries struct {
+	Scope    string       `json:"scope"` // school, zone or overall
+	SchoolID string       `json:"school_id,omitempty"`
+	Name     string       `json:"name,omitempty"`
+	Zone     string       `json:"zone,omitempty"`
+	Months   []string     `json:"months"`
+	Points   []TrendPoint `json:"points"`
+}
+
+// GET /api/trend
+func handleTrend(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	tr := dataFor(r).TREND
+	if tr == nil {
+		writeError(w, 404, errNotFound, "no trend: -dbt-dir is not set or has no Dashboard_Summary_YYYYMM files")
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if u := userFor(r); u != nil && u.Role == roleZoneHead {
+		zone = strings.ToUpper(u.Zone)
+	}
+	if zone == allZones {
+		zone = ""
+	}
+	out := TrendSeries{Scope: "overall", Months: tr.Months, Points: tr.Overall}
+	switch id := ingest.DigitsOnlyKey(q.Get("school")); {
+	case id != "":
+		s, ok := tr.names[id]
+		if !ok || (zone != "" && s.Zone != zone) {
+			writeError(w, 404, errNotFound, "school "+id+" is in no monthly summary")
+			return
+		}
+		out = TrendSeries{Scope: "school", SchoolID: id, Name: s.Name, Zone: s.Zone, Months: tr.Months, Points: tr.schools[id]}
+	case zone != "":
+		points, ok := tr.Zones[zone]
+		if !ok {
+			writeError(w, 404, errNotFound, "zone "+zone+" is in no monthly summary")
+			return
+		}
+		out = TrendSeries{Scope: "zone", Zone: zone, Months: tr.Months, Points: points}
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(out.Points))
+		for _, p := range out.Points {
+			rows = append(rows, []string{p.Month, strconv.Itoa(p.Schools), strconv.Itoa(p.Enrolment), strconv.Itoa(p.WithAadhaar),
+				fmt.Sprintf("%.1f", p.AadhaarPct), strconv.Itoa(p.AadhaarLinked), strconv.Itoa(p.DBTStudent), strconv.Itoa(p.DBTParent), strconv.Itoa(p.DBTTotal)})
+		}
+		writeCSV(w, r, "trend.csv", []string{"Month", "Schools", "Enrolment", "With Aadhaar", "Aadhaar %", "Aadhaar Linked Account",
+			"DBT Student", "DBT Parent", "DBT Total"}, rows)
+		return
+	}
+	writeData(w, out, &Meta{Count: len(out.Points)})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- Saved views ----
+//
+// A logged-in user can save the employee filter (zone, designation, age
+// threshold, ...) under a name and share it as a short link; opening
+// /v/{code} lands on the dashboard with the filter applied. Views belong to
+// the user who saved them; admins may list anyone's.
+//
+//	POST   /api/views          {"name": "South PRTs over 50", "filters": {"zone": "SOUTH", "min_age": "50"}}
+//	GET    /api/views[?user=]
+//	DELETE /api/views?code=
+//	GET    /v/{code}
+
+var viewsFile = flag.String("views", "./out/views.json", "Saved filter views and their short links")
+
+// viewFilters are the employee filter fields a view may carry; see
+// parseEmpQuery.
+var viewFilters = map[string]bool{
+	"zone": true, "designation": true, "gender": true, "category": true,
+	"religion": true, "marital": true, "min_age": true, "sort": true,
+}
+
+type SavedView struct {
+	Code    string            `json:"code"`
+	Name    string            `json:"name"`
+	Owner   string            `json:"owner"`
+	Filters map[string]string `json:"filters"`
+	Created time.Time         `json:"created"`
+	Link    string            `json:"link,omitempty"` // filled in when served
+}
+
+type viewStore struct {
+	mu    sync.Mutex
+	path  string
+	views map[string]SavedView // by code
+}
+
+var (
+	viewStoresMu sync.Mutex
+	viewStores   = map[string]*viewStore{} // by tenant id
+)
+
+// views returns the tenant's saved views, loading them on first use.
+func (t *Tenant) views() *viewStore {
+	viewStoresMu.Lock()
+	defer viewStoresMu.Unlock()
+	if s, ok := viewStores[t.ID]; ok {
+		return s
+	}
+	s := &viewStore{path: t.Views, views: map[string]SavedView{}}
+	if b, err := os.ReadFile(t.Views); err == nil {
+		if err := json.Unmarshal(b, &s.views); err != nil {
+			log.Printf("views %s: %v", t.Views, err)
+		}
+	}
+	viewStores[t.ID] = s
+	return s
+}
+
+func (s *viewStore) save() error {
+	if s.path == "" {
+		return fmt.Errorf("no views file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.views, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// Add stores v under a fresh code.
+func (s *viewStore) Add(v SavedView) (SavedView, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		if v.Code = hex.EncodeToString(b); s.views[v.Code].Code == "" {
+			break
+		}
+	}
+	v.Created = time.Now()
+	s.views[v.Code] = v
+	if err := s.save(); err != nil {
+		delete(s.views, v.Code)
+		return v, err
+	}
+	return v, nil
+}
+
+func (s *viewStore) Get(code string) (SavedView, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.views[code]
+	return v, ok
+}
+
+func (s *viewStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.views[code]
+	if !ok {
+		return nil
+	}
+	delete(s.views, code)
+	if err := s.save(); err != nil {
+		s.views[code] = v
+		return err
+	}
+	return nil
+}
+
+// For lists owner's views ("" for everyone's), newest first.
+func (s *viewStore) For(owner string) []SavedView {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []SavedView{}
+	for _, v := range s.views {
+		if owner == "" || v.Owner == owner {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+// viewLink is the short link of a view, absolute when -public-url is set.
+func (t *Tenant) viewLink(code string) string {
+	return strings.TrimRight(*publicURL, "/") + t.Prefix + "/v/" + code
+}
+
+// checkViewFilters drops blank and "ALL" values and rejects unknown fields.
+func checkViewFilters(in map[string]string) (map[string]string, error) {
+	out := map[string]string{}
+	for k, v := range in {
+		if !viewFilters[k] {
+			return nil, fmt.Errorf("unknown filter %q", k)
+		}
+		v = strings.TrimSpace(v)
+		if len(v) > 100 {
+			return nil, fmt.Errorf("filter %s too long", k)
+		}
+		if v != "" && !strings.EqualFold(v, allZones) && !(k == "min_age" && v == "0") {
+			out[k] = v
+		}
+	}
+	return out, nil
+}
+
+// roleAdmin runs one tenant; a superadmin (sessions.go) may do so too.
+const roleAdmin = "admin"
+
+func isAdmin(u *TenantUser) bool { return u.Role == roleAdmin || u.Role == roleSuperAdmin }
+
+// GET/POST/DELETE /api/views
+func handleAPIViews(w http.ResponseWriter, r *http.Request) {
+	u := userFor(r)
+	if u == nil {
+		writeError(w, http.StatusUnauthorized, errUnauthorized, "saved views need a login")
+		return
+	}
+	t := tenantFor(r)
+	withLink := func(v SavedView) SavedView { v.Link = t.viewLink(v.Code); return v }
+	switch r.Method {
+	case http.MethodGet:
+		owner := u.Name
+		if q := r.URL.Query().Get("user"); q != "" && q != u.Name {
+			if !isAdmin(u) {
+				writeError(w, http.StatusForbidden, errForbidden, "only admins may list other users' views")
+				return
+			}
+			owner = q
+		}
+		list := t.views().For(owner)
+		for i := range list {
+			list[i] = withLink(list[i])
+		}
+		writeData(w, list, &Meta{Count: len(list)})
+	case http.MethodPost:
+		var req struct {
+			Name    string            `json:"name"`
+			Filters map[string]string `json:"filters"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+			writeError(w, 400, errBadRequest, "body must be a view: "+err.Error())
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 80 {
+			writeError(w, 400, errBadRequest, "name is required (at most 80 characters)")
+			return
+		}
+		filters, err := checkViewFilters(req.Filters)
+		if err != nil {
+			writeError(w, 400, errBadRequest, err.Error())
+			return
+		}
+		v, err := t.views().Add(SavedView{Name: req.Name, Owner: u.Name, Filters: filters})
+		if err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		log.Printf("🔖 %s saved view %s (%s)", u.Name, v.Code, v.Name)
+		writeData(w, withLink(v), nil)
+	case http.MethodDelete:
+		code := r.URL.Query().Get("code")
+		v, ok := t.views().Get(code)
+		if !ok {
+			writeError(w, 404, errNotFound, "view "+code+" not found")
+			return
+		}
+		if v.Owner != u.Name && !isAdmin(u) {
+			writeError(w, http.StatusForbidden, errForbidden, "not your view")
+			return
+		}
+		if err := t.views().Delete(code); err != nil {
+			writeError(w, 500, errInternal, err.Error())
+			return
+		}
+		writeData(w, withLink(v), nil)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed, "GET, POST or DELETE required")
+	}
+}
+
+// GET /v/{code}: the dashboard with the view's filters in the query string.
+func handleViewLink(w http.ResponseWriter, r *http.Request) {
+	t := tenantFor(r)
+	v, ok := t.views().Get(r.PathValue("code"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	q := url.Values{"view": {v.Code}}
+	for k, val := range v.Filters {
+		q.Set(k, val)
+	}
+	http.Redirect(w, r, t.Prefix+"/?"+q.Encode(), http.StatusFound)
+}
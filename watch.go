@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ---- Input watching ----
+//
+// The server re-checks every tenant's input files each -watch and rebuilds
+// a tenant whose files changed, so dropping next month's CSVs in place is
+// enough; the new dataset is swapped in atomically and pages served during
+// the rebuild still see the old one. A change is only acted on once it has
+// held for a whole interval, so a file still being copied isn't read half
+// written, and inputs that fail to load leave the previous build in
+// service. Like the TLS files this polls rather than subscribing to change
+// events, which network shares don't deliver.
+
+var watchEvery = flag.Duration("watch", time.Minute, "How often to check the input files for changes and rebuild (0 = off)")
+
+// inputsSig is the size and modification time of each input file; a
+// rebuild is due when it differs from the served dataset's.
+func inputsSig(in Inputs) string {
+	sig := ""
+	paths := []string{in.Basic, in.Services, in.DBT, in.Infra, in.MDM, in.Results, in.Periods, in.Leave, in.DBTDir, in.ZonesGeoJSON, in.Locations}
+	if *columnAliasFile != "" {
+		paths = append(paths, *columnAliasFile)
+	}
+	for _, p := range paths {
+		if st, err := os.Stat(p); err == nil {
+			sig += fmt.Sprintf("%s:%d:%d;", p, st.Size(), st.ModTime().UnixNano())
+		} else {
+			sig += p + ":-;"
+		}
+	}
+	return sig
+}
+
+// startInputWatch polls the tenants' inputs each -watch.
+func startInputWatch() {
+	if *watchEvery <= 0 {
+		return
+	}
+	pending := map[string]string{} // tenant id -> changed sig seen last tick
+	go func() {
+		for range time.Tick(*watchEvery) {
+			for _, t := range TENANTS {
+				ds := t.Data()
+				if st := t.staged.Load(); st != nil {
+					ds = st.ds // already rebuilt, awaiting approval
+				}
+				if ds == nil {
+					continue
+				}
+				sig := inputsSig(t.inputs())
+				switch {
+				case sig == ds.inputsSig || t.skipped(sig):
+					delete(pending, t.ID)
+				case sig != pending[t.ID]:
+					pending[t.ID] = sig // still changing, or just changed
+				default:
+					delete(pending, t.ID)
+					log.Printf("👀 Inputs of %s changed; rebuilding", t.ID)
+					t.Build()
+				}
+			}
+		}
+	}()
+}
+
+// skipped reports whether sig is of inputs whose build failed or was
+// rejected; the watcher leaves them be until they change again.
+func (t *Tenant) skipped(sig string) bool {
+	p := t.skipSig.Load()
+	return p != nil && *p == sig
+}
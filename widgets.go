@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ---- Zone KPIs ----
+//
+// Aggregate-only figures per zone (plus "ALL"); nothing here identifies an
+// individual employee, so these are safe to hand to other portals.
+
+type ZoneKPI struct {
+	Zone             string  `json:"zone"`
+	Schools          int     `json:"schools"`
+	Employees        int     `json:"employees"`
+	Teachers         int     `json:"teachers"`
+	NeededTeachers   int     `json:"needed_teachers"`
+	Vacancies        int     `json:"vacancies"`
+	Surplus          int     `json:"surplus"`
+	WithoutPrincipal int     `json:"schools_without_principal"`
+	Enrolment        int     `json:"enrolment"`
+	MaxPresent       int     `json:"max_present"`
+	PTR              float64 `json:"ptr"`
+	WithAadhaar      int     `json:"with_aadhaar"`
+	AadhaarPct       float64 `json:"aadhaar_pct"`
+	WithAccount      int     `json:"with_account"`
+	AccountPct       float64 `json:"account_pct"`
+	DBTTotal         int     `json:"dbt_total"`
+	DBTPct           float64 `json:"dbt_pct"`
+	NeededRooms      int     `json:"needed_classrooms"`
+	Classrooms       int     `json:"classrooms,omitempty"`
+	RoomShortage     int     `json:"classroom_shortage,omitempty"`
+	SchoolsWithRooms int     `json:"schools_with_room_data,omitempty"`
+	SchoolsShortRoom int     `json:"schools_short_of_classrooms,omitempty"`
+	MDMSchools       int     `json:"schools_with_mdm_data,omitempty"`
+	MDMDaily         int     `json:"mdm_meals_per_day,omitempty"`
+	MDMCoverage      float64 `json:"mdm_coverage_pct,omitempty"`
+	MDMAnomalies     int     `json:"mdm_anomalies,omitempty"`
+	Rank             int     `json:"rank,omitempty"`
+	Score            float64 `json:"score,omitempty"`
+
+	DBTComponents map[string]DBTComponent `json:"dbt_components,omitempty"`
+}
+
+const allZones = "ALL"
+
+func pct1(a, b int) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return math.Round(float64(a)/float64(b)*1000) / 10
+}
+
+func buildZoneKPIs(emp map[string]Emp, sch map[string]School, score []ZoneScore) map[string]ZoneKPI {
+	acc := map[string]*ZoneKPI{}
+	aadhaarDen, accountDen, mdmDen := map[string]int{}, map[string]int{}, map[string]int{}
+	zone := func(z string) *ZoneKPI {
+		if acc[z] == nil {
+			acc[z] = &ZoneKPI{Zone: z}
+		}
+		return acc[z]
+	}
+	rosters := rosterBySchool(emp)
+	for sid, s := range sch {
+		st := schoolStaff(s, rosters[sid])
+		for _, z := range []*ZoneKPI{zone(s.Zone), zone(allZones)} {
+			z.Schools++
+			z.Enrolment += s.TotalEnrolment
+			z.MaxPresent += s.MaxPresent
+			z.WithAadhaar += s.WithAadhaar
+			z.WithAccount += s.WithAccount
+			z.DBTTotal += s.DBTTotal
+			z.Teachers += st.ActualTeachers
+			z.NeededTeachers += st.NeededTeachers
+			if st.SurplusVacancy < 0 {
+				z.Vacancies -= st.SurplusVacancy
+			} else {
+				z.Surplus += st.SurplusVacancy
+			}
+			if !st.HasPrincipal {
+				z.WithoutPrincipal++
+			}
+			z.NeededRooms += s.NeededClassrooms
+			if s.HasInfra {
+				z.SchoolsWithRooms++
+				z.Classrooms += s.Classrooms
+				z.RoomShortage += s.ClassroomShortage
+				if s.ClassroomShortage > 0 {
+					z.SchoolsShortRoom++
+				}
+			}
+			if s.DBTComponents != nil {
+				if z.DBTComponents == nil {
+					z.DBTComponents = map[string]DBTComponent{}
+				}
+				addDBTComponents(z.DBTComponents, s)
+			}
+			if s.HasMDM {
+				z.MDMSchools++
+				z.MDMDaily += s.MDMDaily
+				mdmDen[z.Zone] += s.TotalEnrolment
+				if s.MDMAnomaly {
+					z.MDMAnomalies++
+				}
+			}
+			aadhaarDen[z.Zone] += s.WithAadhaar + s.WithoutAadhaar
+			accountDen[z.Zone] += s.WithAccount + s.WithoutAccount
+		}
+	}
+	for _, e := range emp {
+		zone(e.Zone).Employees++
+		zone(allZones).Employees++
+	}
+	out := map[string]ZoneKPI{}
+	for name, z := range acc {
+		if z.Teachers > 0 {
+			z.PTR = math.Round(float64(z.MaxPresent)/float64(z.Teachers)*10) / 10
+		}
+		z.AadhaarPct = pct1(z.WithAadhaar, aadhaarDen[name])
+		z.AccountPct = pct1(z.WithAccount, accountDen[name])
+		z.DBTPct = pct1(z.DBTTotal, z.Enrolment)
+		z.MDMCoverage = pct1(z.MDMDaily, mdmDen[name])
+		for k, c := range z.DBTComponents {
+			c.Pct = pct1(c.Total, z.Enrolment)
+			z.DBTComponents[k] = c
+		}
+		out[name] = *z
+	}
+	for _, s := range score {
+		if k, ok := out[s.Zone]; ok {
+			k.Rank, k.Score = s.Rank, s.Overall
+			out[s.Zone] = k
+		}
+	}
+	return out
+}
+
+// ---- Widgets ----
+
+func widgetHeaders(w http.ResponseWriter, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	allowFraming(w)
+}
+
+func handleWidgetIndex(w http.ResponseWriter, r *http.Request) {
+	widgetHeaders(w, "application/json")
+	base := tenantFor(r).Prefix
+	zones := []string{}
+	for z := range dataFor(r).ZONE_KPI {
+		zones = append(zones, z)
+	}
+	sort.Strings(zones)
+	writeData(w, map[string]any{
+		"widgets": []string{base + "/widgets/zone/{zone}", base + "/widgets/dbt?zone={zone}", base + "/widgets/aggregates.json"},
+		"zones":   zones,
+		"formats": []string{"html", "json"},
+	}, nil)
+}
+
+func widgetKPI(w http.ResponseWriter, r *http.Request, zone string) (ZoneKPI, bool) {
+	z := strings.ToUpper(strings.TrimSpace(zone))
+	if z == "" {
+		z = allZones
+	}
+	k, ok := dataFor(r).ZONE_KPI[z]
+	if !ok {
+		widgetHeaders(w, "application/json")
+		writeError(w, 404, errNotFound, "zone "+z+" not found")
+	}
+	return k, ok
+}
+
+func handleWidgetZone(w http.ResponseWriter, r *http.Request) {
+	k, ok := widgetKPI(w, r, r.PathValue("zone"))
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		widgetHeaders(w, "application/json")
+		writeData(w, k, nil)
+		return
+	}
+	widgetHeaders(w, "text/html; charset=utf-8")
+	row := func(label, val string) string {
+		return `<div class="kpi"><div class="v">` + val + `</div><div class="l">` + label + `</div></div>`
+	}
+	cards := row("Schools", fmt.Sprint(k.Schools)) +
+		row("Employees", fmt.Sprint(k.Employees)) +
+		row("Enrolment", fmt.Sprint(k.Enrolment)) +
+		row("PTR", fmt.Sprintf("%.1f", k.PTR)) +
+		row("Teacher Vacancies", fmt.Sprint(k.Vacancies)) +
+		row("Aadhaar Seeded", fmt.Sprintf("%.1f%%", k.AadhaarPct)) +
+		row("Bank Accounts", fmt.Sprintf("%.1f%%", k.AccountPct)) +
+		row("DBT Received", fmt.Sprintf("%.1f%%", k.DBTPct))
+	rank := ""
+	if k.Rank > 0 {
+		rank = fmt.Sprintf(`<span class="rank">Rank #%d · Score %.1f</span>`, k.Rank, k.Score)
+	}
+	fmt.Fprintf(w, widgetShell, html.EscapeString(k.Zone), `<h3>`+html.EscapeString(k.Zone)+` `+rank+`</h3><div class="grid">`+cards+`</div>`)
+}
+
+func handleWidgetDBT(w http.ResponseWriter, r *http.Request) {
+	k, ok := widgetKPI(w, r, r.URL.Query().Get("zone"))
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		widgetHeaders(w, "application/json")
+		writeData(w, map[string]any{
+			"zone": k.Zone, "dbt_total": k.DBTTotal, "enrolment": k.Enrolment, "dbt_pct": k.DBTPct,
+		}, nil)
+		return
+	}
+	widgetHeaders(w, "text/html; charset=utf-8")
+	// semicircle gauge: arc length of a r=80 half circle is π·80
+	const arc = math.Pi * 80
+	fill := arc * math.Min(k.DBTPct, 100) / 100
+	color := "#ef4444"
+	if k.DBTPct >= 75 {
+		color = "#22c55e"
+	} else if k.DBTPct >= 40 {
+		color = "#facc15"
+	}
+	gauge := fmt.Sprintf(`<h3>DBT Coverage · %s</h3>
+<svg viewBox="0 0 200 120" width="100%%" height="160">
+  <path d="M20 100 A80 80 0 0 1 180 100" fill="none" stroke="#27304a" stroke-width="18"/>
+  <path d="M20 100 A80 80 0 0 1 180 100" fill="none" stroke="%s" stroke-width="18" stroke-dasharray="%.1f %.1f"/>
+  <text x="100" y="95" text-anchor="middle" font-size="26" fill="#f1f5f9">%.1f%%</text>
+</svg>
+<div class="l" style="text-align:center">%d of %d students received DBT</div>`,
+		html.EscapeString(k.Zone), color, fill, arc, k.DBTPct, k.DBTTotal, k.Enrolment)
+	fmt.Fprintf(w, widgetShell, "DBT "+html.EscapeString(k.Zone), gauge)
+}
+
+const widgetShell = `<!doctype html>
+<html lang="en"><head><meta charset="utf-8"><title>%s</title>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+  body{margin:0;padding:10px;background:#0d1b2a;color:#f1f5f9;font:14px/1.4 system-ui,Segoe UI,Roboto,Arial}
+  h3{margin:0 0 8px;color:#00c4b4}
+  .rank{font-size:12px;color:#facc15;margin-left:6px}
+  .grid{display:grid;grid-template-columns:repeat(auto-fit,minmax(110px,1fr));gap:8px}
+  .kpi{background:#11182a;border:1px solid #27304a;border-radius:10px;padding:8px;text-align:center}
+  .v{font-size:20px;font-weight:700}
+  .l{font-size:12px;color:#cbd5e1}
+</style></head><body>%s</body></html>`
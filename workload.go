@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"myproject/ingest"
+)
+
+// ---- Teacher workload ----
+//
+// The headcount norm (scorecard.go) says how many teachers a school should
+// have; the timetable says what they actually teach. The optional periods
+// file (-periods, or "periods" in a tenant or profile) has one row per
+// class, section and subject: "School ID" (or "School Name & ID"),
+// "Class", "Section", "Subject", "Periods" a week and the "Teacher ID"
+// (employee id) taking them, blank while nobody does.
+//
+// A teacher's weekly load is the periods assigned to them; above
+// -max-periods they are overloaded. A school's coverage gap is its periods
+// with no teacher (or one not on the Basic file), and its capacity gap the
+// periods its teachers couldn't take even at -max-periods each. Teachers
+// of schools in the file with nothing assigned show up with a load of 0.
+//
+//	GET /api/workload[?zone=][&gaps=1][&format=csv]              schools
+//	GET /api/workload/teachers[?zone=][&school=][&over=1][&format=csv]
+
+var (
+	periodsCSV = flag.String("periods", "", "Timetable CSV with periods a week per class, section and subject and who teaches them (optional)")
+	maxPeriods = flag.Int("max-periods", 36, "Weekly periods a teacher can take before counting as overloaded")
+)
+
+type PeriodRow struct {
+	SchoolID string
+	Class    string
+	Section  string
+	Subject  string
+	Periods  int
+	Teacher  string // employee id, "" = unassigned
+}
+
+// readPeriods returns the timetable rows with a school and periods.
+func readPeriods(path string) ([]PeriodRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	for i := range header {
+		header[i] = ingest.Norm(header[i])
+	}
+	m := ingest.IdxMap(header)
+	var rows []PeriodRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sid := ingest.DigitsOnly(ingest.Get(rec, m, "School ID", "School Code"))
+		if sid == "" {
+			sid = ingest.DigitsOnlyKey(ingest.Get(rec, m, "School Name & ID", "School Name"))
+		}
+		n := ingest.AtoiSafe(ingest.Get(rec, m, "Periods", "Periods per Week", "Weekly Periods"))
+		if sid == "" || n <= 0 {
+			continue
+		}
+		rows = append(rows, PeriodRow{SchoolID: sid,
+			Class:   strings.TrimSpace(ingest.Get(rec, m, "Class")),
+			Section: strings.ToUpper(strings.TrimSpace(ingest.Get(rec, m, "Section"))),
+			Subject: strings.TrimSpace(ingest.Get(rec, m, "Subject")),
+			Periods: n,
+			Teacher: strings.TrimSpace(ingest.Get(rec, m, "Teacher ID", "Employee ID", "Teacher"))})
+	}
+}
+
+// loadPeriods reads the periods file (if any) into ds.
+func loadPeriods(ds *Dataset, path string) {
+	ds.periods = nil
+	if path == "" {
+		return
+	}
+	rows, err := readPeriods(path)
+	if err != nil {
+		log.Printf("periods %s: %v", path, err)
+		return
+	}
+	ds.periods = rows
+	log.Printf("🗓️ %d timetable row(s) in %s", len(rows), path)
+}
+
+type TeacherLoad struct {
+	EmpID       string   `json:"emp_id"`
+	Name        string   `json:"name"`
+	Designation string   `json:"designation"`
+	SchoolID    string   `json:"school_id"`
+	Zone        string   `json:"zone"`
+	Periods     int      `json:"periods"`
+	Sections    int      `json:"sections"`
+	Subjects    []string `json:"subjects"`
+	Overloaded  bool     `json:"overloaded,omitempty"`
+}
+
+// PeriodGap is a class-section-subject nobody (known) teaches.
+type PeriodGap struct {
+	Class   string `json:"class"`
+	Section string `json:"section"`
+	Subject string `json:"subject"`
+	Periods int    `json:"periods"`
+	Teacher string `json:"teacher,omitempty"` // an id not on the Basic file
+}
+
+type SchoolWorkload struct {
+	SchoolID    string      `json:"school_id"`
+	Name        string      `json:"name"`
+	Zone        string      `json:"zone"`
+	Sections    int         `json:"sections"`
+	Periods     int         `json:"periods"` // a week, all classes
+	Covered     int         `json:"covered"`
+	Uncovered   int         `json:"uncovered"`
+	Teachers    int         `json:"teachers"`
+	Capacity    int         `json:"capacity"`     // teachers × -max-periods
+	CapacityGap int         `json:"capacity_gap"` // periods beyond capacity
+	Overloaded  int         `json:"overloaded"`
+	Gaps        []PeriodGap `json:"gaps"`
+}
+
+type Workload struct {
+	Teachers []TeacherLoad    // most loaded first
+	Schools  []SchoolWorkload // biggest gap first
+}
+
+// teacherWorkload works out loads and gaps from the timetable; nil without
+// one.
+func teacherWorkload(emp map[string]Emp, sch map[string]School, rows []PeriodRow) *Workload {
+	if len(rows) == 0 {
+		return nil
+	}
+	type acc struct {
+		load     TeacherLoad
+		sections map[string]bool
+		subjects map[string]bool
+	}
+	teachers := map[string]*acc{}
+	teacher := func(e Emp) *acc {
+		a := teachers[e.ID]
+		if a == nil {
+			a = &acc{load: TeacherLoad{EmpID: e.ID, Name: e.Name, Designation: e.Designation, SchoolID: e.SchoolID, Zone: e.Zone},
+				sections: map[string]bool{}, subjects: map[string]bool{}}
+			teachers[e.ID] = a
+		}
+		return a
+	}
+	schools := map[string]*SchoolWorkload{}
+	sections := map[string]map[string]bool{}
+	for _, r := range rows {
+		sw := schools[r.SchoolID]
+		if sw == nil {
+			s := sch[r.SchoolID]
+			sw = &SchoolWorkload{SchoolID: r.SchoolID, Name: s.Name, Zone: s.Zone, Gaps: []PeriodGap{}}
+			schools[r.SchoolID] = sw
+			sections[r.SchoolID] = map[string]bool{}
+		}
+		key := r.Class + "-" + r.Section
+		sections[r.SchoolID][key] = true
+		sw.Periods += r.Periods
+		e, ok := emp[r.Teacher]
+		if r.Teacher == "" || !ok {
+			sw.Uncovered += r.Periods
+			sw.Gaps = append(sw.Gaps, PeriodGap{Class: r.Class, Section: r.Section, Subject: r.Subject, Periods: r.Periods, Teacher: r.Teacher})
+			continue
+		}
+		sw.Covered += r.Periods
+		a := teacher(e)
+		a.load.Periods += r.Periods
+		a.sections[r.SchoolID+"/"+key] = true
+		if r.Subject != "" {
+			a.subjects[r.Subject] = true
+		}
+	}
+	roster := rosterBySchool(emp)
+	w := &Workload{}
+	for id, sw := range schools {
+		if sw.Zone == "" && len(roster[id]) > 0 {
+			sw.Zone = roster[id][0].Zone
+		}
+		sw.Sections = len(sections[id])
+		for _, e := range roster[id] {
+			if strings.Contains(strings.ToLower(e.Designation), "teacher") {
+				sw.Teachers++
+				teacher(e)
+			}
+		}
+		sw.Capacity = sw.Teachers * *maxPeriods
+		sw.CapacityGap = max(0, sw.Periods-sw.Capacity)
+	}
+	for _, a := range teachers {
+		a.load.Sections = len(a.sections)
+		a.load.Subjects = sortedKeys(a.subjects)
+		a.load.Overloaded = a.load.Periods > *maxPeriods
+		if a.load.Overloaded {
+			if sw := schools[a.load.SchoolID]; sw != nil {
+				sw.Overloaded++
+			}
+		}
+		w.Teachers = append(w.Teachers, a.load)
+	}
+	for _, sw := range schools {
+		w.Schools = append(w.Schools, *sw)
+	}
+	sort.Slice(w.Teachers, func(i, j int) bool {
+		if w.Teachers[i].Periods != w.Teachers[j].Periods {
+			return w.Teachers[i].Periods > w.Teachers[j].Periods
+		}
+		return w.Teachers[i].EmpID < w.Teachers[j].EmpID
+	})
+	sort.Slice(w.Schools, func(i, j int) bool {
+		a, b := w.Schools[i], w.Schools[j]
+		if a.Uncovered+a.CapacityGap != b.Uncovered+b.CapacityGap {
+			return a.Uncovered+a.CapacityGap > b.Uncovered+b.CapacityGap
+		}
+		return a.SchoolID < b.SchoolID
+	})
+	log.Printf("🗓️ Workload: %d teacher(s), %d school(s) with timetables", len(w.Teachers), len(w.Schools))
+	return w
+}
+
+// workloadFor answers 404 when the build has no timetable.
+func workloadFor(w http.ResponseWriter, r *http.Request) *Workload {
+	if !requireMethod(w, r, http.MethodGet) {
+		return nil
+	}
+	wl := dataFor(r).WORKLOAD
+	if wl == nil {
+		writeError(w, 404, errNotFound, "no periods file is configured (-periods)")
+	}
+	return wl
+}
+
+// GET /api/workload
+func handleAPIWorkload(w http.ResponseWriter, r *http.Request) {
+	wl := workloadFor(w, r)
+	if wl == nil {
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	gaps := q.Get("gaps") == "1"
+	list := []SchoolWorkload{}
+	for _, s := range wl.Schools {
+		if (zone == "" || s.Zone == zone) && (!gaps || s.Uncovered > 0 || s.CapacityGap > 0) {
+			list = append(list, s)
+		}
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, s := range list {
+			rows = append(rows, []string{s.SchoolID, s.Name, s.Zone, strconv.Itoa(s.Sections), strconv.Itoa(s.Periods),
+				strconv.Itoa(s.Covered), strconv.Itoa(s.Uncovered), strconv.Itoa(s.Teachers), strconv.Itoa(s.Capacity),
+				strconv.Itoa(s.CapacityGap), strconv.Itoa(s.Overloaded)})
+		}
+		writeCSV(w, r, "workload.csv", []string{"School ID", "School", "Zone", "Sections", "Periods", "Covered", "Uncovered",
+			"Teachers", "Capacity", "Capacity Gap", "Overloaded Teachers"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
+
+// GET /api/workload/teachers
+func handleAPIWorkloadTeachers(w http.ResponseWriter, r *http.Request) {
+	wl := workloadFor(w, r)
+	if wl == nil {
+		return
+	}
+	q := r.URL.Query()
+	zone := strings.ToUpper(strings.TrimSpace(q.Get("zone")))
+	if zone == allZones {
+		zone = ""
+	}
+	school, over := strings.TrimSpace(q.Get("school")), q.Get("over") == "1"
+	list := []TeacherLoad{}
+	for _, t := range wl.Teachers {
+		if (zone == "" || t.Zone == zone) && (school == "" || t.SchoolID == school) && (!over || t.Overloaded) {
+			list = append(list, t)
+		}
+	}
+	if q.Get("format") == "csv" {
+		rows := make([][]string, 0, len(list))
+		for _, t := range list {
+			rows = append(rows, []string{t.EmpID, t.Name, t.Designation, t.SchoolID, t.Zone, strconv.Itoa(t.Periods),
+				strconv.Itoa(t.Sections), strings.Join(t.Subjects, "; "), yesNo(t.Overloaded)})
+		}
+		writeCSV(w, r, "teacher_workload.csv", []string{"Employee ID", "Name", "Designation", "School ID", "Zone", "Periods",
+			"Sections", "Subjects", "Overloaded"}, rows)
+		return
+	}
+	page, per := pageParams(r, tableDefaultPer, tableMaxPer)
+	items, meta := paginate(list, page, per)
+	writeData(w, items, meta)
+}
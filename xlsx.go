@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---- Minimal XLSX writer ----
+//
+// Just enough SpreadsheetML for report packs: several sheets of strings and
+// numbers, a bold frozen header row, auto-filter and rough column widths.
+// Strings are written inline, so there is no shared-strings table.
+
+type xlsxSheet struct {
+	name   string
+	header []string
+	rows   [][]any
+}
+
+type xlsxBook struct {
+	sheets []*xlsxSheet
+}
+
+// Sheet adds a sheet; rows take string, int and float64 cells (anything else
+// is printed with %v).
+func (b *xlsxBook) Sheet(name string, header ...string) *xlsxSheet {
+	s := &xlsxSheet{name: xlsxSheetName(name), header: header}
+	b.sheets = append(b.sheets, s)
+	return s
+}
+
+func (s *xlsxSheet) Row(cells ...any) { s.rows = append(s.rows, cells) }
+
+// xlsxSheetName drops the characters Excel forbids and keeps 31 runes.
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	return name
+}
+
+func xlsxCol(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+func xlsxEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (s *xlsxSheet) xml() []byte {
+	widths := make([]int, len(s.header))
+	grow := func(i, n int) {
+		for len(widths) <= i {
+			widths = append(widths, 0)
+		}
+		if n > widths[i] {
+			widths[i] = n
+		}
+	}
+	var rows bytes.Buffer
+	cell := func(r, c int, v any, style int) {
+		ref := xlsxCol(c) + strconv.Itoa(r)
+		st := ""
+		if style > 0 {
+			st = fmt.Sprintf(` s="%d"`, style)
+		}
+		switch x := v.(type) {
+		case int:
+			fmt.Fprintf(&rows, `<c r="%s"%s><v>%d</v></c>`, ref, st, x)
+			grow(c, len(strconv.Itoa(x)))
+		case float64:
+			fmt.Fprintf(&rows, `<c r="%s"%s><v>%s</v></c>`, ref, st, strconv.FormatFloat(x, 'f', -1, 64))
+			grow(c, 8)
+		default:
+			str := fmt.Sprint(x)
+			fmt.Fprintf(&rows, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, st, xlsxEscape(str))
+			grow(c, utf8.RuneCountInString(str))
+		}
+	}
+	rows.WriteString(`<row r="1">`)
+	for c, h := range s.header {
+		cell(1, c, h, 1)
+	}
+	rows.WriteString(`</row>`)
+	for i, row := range s.rows {
+		fmt.Fprintf(&rows, `<row r="%d">`, i+2)
+		for c, v := range row {
+			cell(i+2, c, v, 0)
+		}
+		rows.WriteString(`</row>`)
+	}
+	var cols bytes.Buffer
+	for i, w := range widths {
+		if w < 6 {
+			w = 6
+		}
+		if w > 60 {
+			w = 60
+		}
+		fmt.Fprintf(&cols, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, w+2)
+	}
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	out.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	out.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if cols.Len() > 0 {
+		out.WriteString(`<cols>` + cols.String() + `</cols>`)
+	}
+	out.WriteString(`<sheetData>` + rows.String() + `</sheetData>`)
+	if len(s.header) > 0 {
+		fmt.Fprintf(&out, `<autoFilter ref="A1:%s%d"/>`, xlsxCol(len(s.header)-1), len(s.rows)+1)
+	}
+	out.WriteString(`</worksheet>`)
+	return out.Bytes()
+}
+
+func (b *xlsxBook) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name, content string) error {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write([]byte(content))
+		}
+		return err
+	}
+	var ctSheets, wbSheets, rels strings.Builder
+	for i := range b.sheets {
+		n := i + 1
+		fmt.Fprintf(&ctSheets, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&wbSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(b.sheets[i].name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(b.sheets)+1)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			ctSheets.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + wbSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+			`<fill><patternFill patternType="solid"><fgColor rgb="FFDDEBF7"/></patternFill></fill></fills>` +
+			`<borders count="1"><border/></borders><cellStyleXfs count="1"><xf/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf/><xf fontId="1" fillId="2" applyFont="1" applyFill="1"/></cellXfs></styleSheet>`},
+	}
+	for _, f := range files {
+		if err := add(f.name, f.content); err != nil {
+			return nil, err
+		}
+	}
+	for i, s := range b.sheets {
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(s.xml()); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ---- Zone digest for School Inspectors ----
+//
+// Each School Inspector (named per school in the DBT summary, with the
+// address from -si-contacts, see escalation.go) gets a monthly summary of
+// their zone: staff, teachers against the norm, vacancies, PTR and DBT
+// coverage, next to the figures for all zones, then their own schools,
+// most short of teachers first, and (with -leave) the substitutes those
+// schools need this week. Inspectors without an address are skipped.
+//
+// The digest goes out on -zone-digest-schedule (a cron expression read in
+// -schedule-tz, see schedule.go), or when an admin asks:
+//
+//	GET /send-zone-digest[?zone=X]               a mail job (mailqueue.go); all zones without zone
+//	GET /api/zone-digest/preview?zone=X[&si=]    one inspector's mail as HTML
+
+var zoneDigestSchedule = flag.String("zone-digest-schedule", "", `Cron expression for the monthly zone digest to School Inspectors, e.g. "0 9 1 * *" (empty = only on request)`)
+
+// inspectorSchools groups the schools of zone ("" = all) by zone and
+// inspector (upper-cased): zone -> SI -> school ids.
+func inspectorSchools(ds *Dataset, zone string) map[string]map[string][]string {
+	out := map[string]map[string][]string{}
+	for id, s := range ds.SCH {
+		si := strings.ToUpper(strings.TrimSpace(s.SIName))
+		if si == "" || (zone != "" && s.Zone != zone) {
+			continue
+		}
+		if out[s.Zone] == nil {
+			out[s.Zone] = map[string][]string{}
+		}
+		out[s.Zone][si] = append(out[s.Zone][si], id)
+	}
+	return out
+}
+
+// renderZoneDigest is the mail to inspector si about zone and their schools.
+func renderZoneDigest(t *Tenant, ds *Dataset, zone, si string, schools []string, now time.Time) (subject, body string) {
+	esc := html.EscapeString
+	z, all := ds.ZONE_KPI[zone], ds.ZONE_KPI[allZones]
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div style="font-family:Arial,sans-serif;font-size:14px"><h2>%s – zone %s, %s</h2><p>Dear %s,</p>`+
+		`<p>This is the monthly summary of your zone and the %d school(s) you inspect, from data as of %s.</p>`,
+		esc(t.PageTitle()), esc(zone), now.Format("January 2006"), esc(si), len(schools), ds.BuiltAt.Format("02 Jan 2006"))
+
+	b.WriteString(`<h3>Zone</h3><table cellpadding="4" style="border-collapse:collapse"><tr><th align="left"></th><th>` + esc(zone) + `</th><th>All zones</th></tr>`)
+	row := func(label string, zv, av any) {
+		fmt.Fprintf(&b, `<tr><td>%s</td><td align="right">%v</td><td align="right">%v</td></tr>`, esc(label), zv, av)
+	}
+	row("Schools", z.Schools, all.Schools)
+	row("Staff", z.Employees, all.Employees)
+	row("Teachers", z.Teachers, all.Teachers)
+	row("Teachers needed (1:40)", z.NeededTeachers, all.NeededTeachers)
+	row("Teacher vacancies", z.Vacancies, all.Vacancies)
+	row("Schools without a principal", z.WithoutPrincipal, all.WithoutPrincipal)
+	row("Pupil-teacher ratio", z.PTR, all.PTR)
+	row("DBT coverage %", z.DBTPct, all.DBTPct)
+	row("Aadhaar %", z.AadhaarPct, all.AadhaarPct)
+	if z.Rank > 0 {
+		row("Scorecard rank", z.Rank, "")
+	}
+	b.WriteString(`</table>`)
+
+	rosters := rosterBySchool(ds.EMP)
+	staff := make([]SchoolStaff, 0, len(schools))
+	for _, id := range schools {
+		staff = append(staff, schoolStaff(ds.SCH[id], rosters[id]))
+	}
+	sort.Slice(staff, func(i, j int) bool {
+		if staff[i].SurplusVacancy != staff[j].SurplusVacancy {
+			return staff[i].SurplusVacancy < staff[j].SurplusVacancy
+		}
+		return staff[i].ID < staff[j].ID
+	})
+	b.WriteString(`<h3>Your schools</h3><table cellpadding="4" style="border-collapse:collapse"><tr><th align="left">School</th>` +
+		`<th>Enrolment</th><th>Teachers</th><th>Needed</th><th>Vacancy</th><th>PTR</th><th>DBT %</th><th>Principal</th></tr>`)
+	for _, st := range staff {
+		s := ds.SCH[st.ID]
+		vac := ""
+		if st.SurplusVacancy < 0 {
+			vac = fmt.Sprint(-st.SurplusVacancy)
+		}
+		fmt.Fprintf(&b, `<tr><td>%s</td><td align="right">%d</td><td align="right">%d</td><td align="right">%d</td><td align="right">%s</td>`+
+			`<td align="right">%.1f</td><td align="right">%.1f</td><td>%s</td></tr>`,
+			esc(s.Name), s.TotalEnrolment, st.ActualTeachers, st.NeededTeachers, vac, st.Ratio,
+			pct1(s.DBTTotal, s.TotalEnrolment), yesNo(st.HasPrincipal))
+	}
+	b.WriteString(`</table>`)
+
+	mine := map[string]bool{}
+	for _, id := range schools {
+		mine[id] = true
+	}
+	var subs []SubstituteNeed
+	for _, n := range substituteForecast(ds, now, *schoolDays) {
+		if mine[n.SchoolID] {
+			subs = append(subs, n)
+		}
+	}
+	if len(subs) > 0 {
+		b.WriteString(`<h3>Substitute teachers this week</h3><table cellpadding="4" style="border-collapse:collapse"><tr><th align="left">Day</th><th align="left">School</th><th>On leave</th><th>Substitutes</th></tr>`)
+		for _, n := range subs {
+			day, _ := time.Parse("2006-01-02", n.Date)
+			fmt.Fprintf(&b, `<tr><td>%s</td><td>%s</td><td align="right">%d</td><td align="right">%d</td></tr>`,
+				day.Format("Mon 02 Jan"), esc(n.Name), n.OnLeave, n.Substitutes)
+		}
+		b.WriteString(`</table>`)
+	}
+	b.WriteString(`<p style="color:#64748b">Generated ` + now.Format("02 Jan 2006 15:04") + `.</p></div>`)
+	return fmt.Sprintf("%s – zone %s summary, %s", t.PageTitle(), zone, now.Format("January 2006")), b.String()
+}
+
+// sendZoneDigest mails every inspector of zone ("" = all) their digest.
+func sendZoneDigest(t *Tenant, zone, job string, now time.Time) map[string]int {
+	ds := t.Data()
+	contacts := t.siContacts()
+	res := map[string]int{"inspectors": 0, "sent": 0, "no_address": 0}
+	for z, sis := range inspectorSchools(ds, zone) {
+		from := t.senderFor(z)
+		for si, schools := range sis {
+			res["inspectors"]++
+			to := contacts[si]
+			if to == "" {
+				res["no_address"]++
+				continue
+			}
+			subject, body := renderZoneDigest(t, ds, z, si, schools, now)
+			if err := queueMailFor(t, job, "", from, "", to, subject, body); err != nil {
+				log.Printf("zone digest %s/%s to %s: %v", z, si, to, err)
+				continue
+			}
+			res["sent"]++
+		}
+	}
+	log.Printf("🗺️ Zone digest for %s: %d of %d inspector(s) mailed, %d without an address", t.ID, res["sent"], res["inspectors"], res["no_address"])
+	return res
+}
+
+// zoneParam is the zone query parameter, upper-cased; ok is false (and the
+// reply written) when it names no zone.
+func zoneParam(w http.ResponseWriter, r *http.Request, ds *Dataset) (zone string, ok bool) {
+	zone = strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("zone")))
+	if zone == "" || zone == allZones {
+		return "", true
+	}
+	if _, found := ds.ZONE_KPI[zone]; !found {
+		writeError(w, 404, errNotFound, "zone "+zone+" not found")
+		return "", false
+	}
+	return zone, true
+}
+
+// GET /send-zone-digest[?zone=]
+func handleSendZoneDigest(w http.ResponseWriter, r *http.Request) {
+	if !requireRole(w, r, roleAdmin, roleSuperAdmin) || !requireLeader(w) {
+		return
+	}
+	t := tenantFor(r)
+	zone, ok := zoneParam(w, r, t.Data())
+	if !ok {
+		return
+	}
+	startMailJob(w, t, "zone-digest", func(job string) map[string]int { return sendZoneDigest(t, zone, job, time.Now()) })
+}
+
+// GET /api/zone-digest/preview?zone=X[&si=]
+func handleZoneDigestPreview(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) || !requireRole(w, r, roleAdmin, roleSuperAdmin) {
+		return
+	}
+	t, ds := tenantFor(r), dataFor(r)
+	zone, ok := zoneParam(w, r, ds)
+	if !ok {
+		return
+	}
+	if zone == "" {
+		writeError(w, 400, errBadRequest, "zone is required")
+		return
+	}
+	sis := inspectorSchools(ds, zone)[zone]
+	si := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("si")))
+	if names := sortedKeys(sis); si == "" && len(names) > 0 {
+		si = names[0]
+	}
+	if sis[si] == nil {
+		writeError(w, 404, errNotFound, "no inspector "+si+" in zone "+zone)
+		return
+	}
+	subject, body := renderZoneDigest(t, ds, zone, si, sis[si], time.Now())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "<!doctype html><title>%s</title>%s", html.EscapeString(subject), body)
+}
+
+// startZoneDigestSchedule sends the zone digest on -zone-digest-schedule;
+// it fails on a bad expression.
+func startZoneDigestSchedule() error {
+	if strings.TrimSpace(*zoneDigestSchedule) == "" {
+		return nil
+	}
+	spec, err := parseCron(*zoneDigestSchedule)
+	if err != nil {
+		return fmt.Errorf("-zone-digest-schedule: %v", err)
+	}
+	loc, err := scheduleLocation()
+	if err != nil {
+		return fmt.Errorf("-schedule-tz: %v", err)
+	}
+	next := spec.Next(time.Now().In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("-zone-digest-schedule %q never fires", *zoneDigestSchedule)
+	}
+	log.Printf("🗺️ Zone digest scheduled %q (%s); next %s", *zoneDigestSchedule, loc, next.Format("02 Jan 15:04 MST"))
+	runOnSchedule(spec, loc, func(now time.Time) {
+		for _, t := range TENANTS {
+			runMailJob(t, "zone-digest", func(job string) map[string]int { return sendZoneDigest(t, "", job, now) })
+		}
+	})
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"myproject/ingest"
+	"myproject/model"
+)
+
+// ---- Per-zone pages ----
+//
+// With -split-by-zone every served build also writes a lighter dashboard
+// for each zone office, <-split-dir>/zone_<ZONE>.html (zone_SHAHDARA.html,
+// zone_SHAHDARA_NORTH.html): the zone's headline figures and scorecard
+// row, its staff demographics, its schools and its employees, and nothing
+// of any other zone. Each page is a single file that needs no server, to
+// mail or put on a share. Pages of zones gone from the data are removed;
+// with -tenants each tenant's pages go in a subdirectory named after it.
+
+var (
+	splitByZone = flag.Bool("split-by-zone", false, "Write a page per zone with only its employees, schools and demographics (zone_<ZONE>.html) after each build")
+	splitDir    = flag.String("split-dir", "./out", "Directory -split-by-zone writes the zone pages to")
+
+	rxZoneFile = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// zonePageFile is the file name of zone's page.
+func zonePageFile(zone string) string {
+	return "zone_" + strings.Trim(rxZoneFile.ReplaceAllString(strings.ToUpper(zone), "_"), "_") + ".html"
+}
+
+// ZonePage is what the zone page template executes against.
+type ZonePage struct {
+	Title     string
+	Zone      string
+	BuiltAt   time.Time
+	KPI       ZoneKPI
+	Score     *ZoneScore // nil when the scorecard lacks the zone
+	Zones     int        // on the scorecard, for the rank
+	Demo      []model.DesignationDemo
+	Gender    []SchoolCount
+	Category  []SchoolCount
+	Age       []SchoolCount
+	Schools   []ZonePageSchool
+	Employees []Emp
+}
+
+// ZonePageSchool is one school row of a zone page.
+type ZonePageSchool struct {
+	School
+	Staff SchoolStaff
+	Head  string
+}
+
+// zonePage gathers zone's part of ds.
+func zonePage(t *Tenant, ds *Dataset, zone string) ZonePage {
+	p := ZonePage{Title: t.PageTitle(), Zone: zone, BuiltAt: ds.BuiltAt, KPI: ds.ZONE_KPI[zone], Zones: len(ds.SCORECARD)}
+	for i := range ds.SCORECARD {
+		if ds.SCORECARD[i].Zone == zone {
+			p.Score = &ds.SCORECARD[i]
+		}
+	}
+	for _, d := range ds.DEMO_ZONES {
+		if d.Zone == zone {
+			p.Demo = d.Designations
+		}
+	}
+	var roster []Emp
+	for _, id := range sortedKeys(ds.EMP) {
+		if e := ds.EMP[id]; e.Zone == zone {
+			roster = append(roster, e)
+		}
+	}
+	sort.SliceStable(roster, func(i, j int) bool {
+		if roster[i].SchoolName != roster[j].SchoolName {
+			return roster[i].SchoolName < roster[j].SchoolName
+		}
+		return roster[i].Name < roster[j].Name
+	})
+	p.Employees = roster
+	p.Gender = schoolCounts(roster, func(e Emp) string { return blankUnknown(strings.ToUpper(e.Gender)) })
+	p.Category = schoolCounts(roster, func(e Emp) string { return ingest.CanonicalCategory(e.SelectionCategory) })
+	p.Age = schoolCounts(roster, func(e Emp) string { return ageBand(e.Age) })
+	sort.SliceStable(p.Age, func(i, j int) bool { return p.Age[i].Key < p.Age[j].Key })
+	rosters := rosterBySchool(ds.EMP)
+	for _, id := range sortedKeys(ds.SCH) {
+		s := ds.SCH[id]
+		if s.Zone != zone {
+			continue
+		}
+		row := ZonePageSchool{School: s, Staff: schoolStaff(s, rosters[id])}
+		if h, ok := ds.HEADS[id]; ok {
+			row.Head = h.Name
+		}
+		p.Schools = append(p.Schools, row)
+	}
+	sort.SliceStable(p.Schools, func(i, j int) bool { return p.Schools[i].Name < p.Schools[j].Name })
+	return p
+}
+
+// writeZonePages is called after every build of t.
+func writeZonePages(t *Tenant, ds *Dataset) {
+	if !*splitByZone || *splitDir == "" {
+		return
+	}
+	dir := *splitDir
+	if *tenantsFile != "" {
+		dir = filepath.Join(dir, t.ID)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("zone pages %s: %v", dir, err)
+		return
+	}
+	keep := map[string]bool{}
+	for _, zone := range sortedKeys(ds.ZONE_KPI) {
+		if zone == allZones || zone == "" || zone == "UNKNOWN" {
+			continue
+		}
+		name := zonePageFile(zone)
+		keep[name] = true
+		var buf bytes.Buffer
+		err := zonePageTmpl.Execute(&buf, zonePage(t, ds, zone))
+		if err == nil {
+			err = os.WriteFile(filepath.Join(dir, name+".tmp"), buf.Bytes(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(filepath.Join(dir, name+".tmp"), filepath.Join(dir, name))
+		}
+		if err != nil {
+			log.Printf("zone page %s: %v", name, err)
+		}
+	}
+	old, _ := filepath.Glob(filepath.Join(dir, "zone_*.html"))
+	for _, f := range old {
+		if !keep[filepath.Base(f)] {
+			_ = os.Remove(f)
+		}
+	}
+	log.Printf("🗺️ %d zone page(s) written to %s", len(keep), dir)
+}
+
+var zonePageTmpl = template.Must(template.New("zone").Funcs(pageFuncs).Parse(`<!doctype html>
+<html lang="en"><head><meta charset="utf-8"><title>{{.Zone}} – {{.Title}}</title>
+<style>body{font-family:system-ui;background:#0d1b2a;color:#f1f5f9;margin:20px}small,.small{color:#94a3b8}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(160px,1fr));gap:10px;margin:10px 0}
+.kpi{background:#1b263b;border:1px solid #334155;border-radius:8px;padding:10px}.kpi .v{font-size:22px;font-weight:600}.kpi .l{font-size:12px;color:#94a3b8}
+table{border-collapse:collapse;margin:8px 0;font-size:13px}th,td{border:1px solid #334155;padding:4px 8px;text-align:left}th{background:#1b263b}
+.cols{display:flex;gap:24px;flex-wrap:wrap}.bad{color:#fca5a5}</style></head>
+<body><h1>🧭 {{.Zone}} zone</h1>
+<p class="small">{{.Title}} · data as of {{date .BuiltAt "02 Jan 2006 15:04"}}</p>
+{{with .KPI}}<div class="grid">
+<div class="kpi"><div class="v">{{.Schools}}</div><div class="l">Schools</div></div>
+<div class="kpi"><div class="v">{{.Employees}}</div><div class="l">Employees</div></div>
+<div class="kpi"><div class="v">{{.Teachers}} / {{.NeededTeachers}}</div><div class="l">Teachers / needed at 1:40</div></div>
+<div class="kpi"><div class="v">{{.WithoutPrincipal}}</div><div class="l">Schools without a principal</div></div>
+<div class="kpi"><div class="v">{{.Enrolment}}</div><div class="l">Enrolment</div></div>
+<div class="kpi"><div class="v">{{printf "%.1f" .PTR}}</div><div class="l">Pupils per teacher</div></div>
+<div class="kpi"><div class="v">{{printf "%.1f" .AadhaarPct}}%</div><div class="l">Aadhaar seeded</div></div>
+<div class="kpi"><div class="v">{{printf "%.1f" .DBTPct}}%</div><div class="l">DBT received</div></div>
+</div>{{end}}
+{{with .Score}}<p><b>Scorecard:</b> rank {{.Rank}} of {{$.Zones}}, overall {{printf "%.1f" .Overall}} (staffing {{printf "%.1f" .Staffing}}, DBT {{printf "%.1f" .DBT}}, Aadhaar {{printf "%.1f" .Aadhaar}}, data quality {{printf "%.1f" .DataQuality}})</p>{{end}}
+
+<h2>Demographics</h2>
+{{if .Demo}}<table><tr><th>Designation</th><th>Male</th><th>Female</th><th>Total</th></tr>
+{{range .Demo}}<tr><td>{{.Designation}}</td><td>{{.Stats.TotalMale}}</td><td>{{.Stats.TotalFemale}}</td><td>{{.Stats.Total}}</td></tr>{{end}}</table>{{end}}
+<div class="cols">
+<table><tr><th>Gender</th><th>Staff</th></tr>{{range .Gender}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+<table><tr><th>Category</th><th>Staff</th></tr>{{range .Category}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+<table><tr><th>Age</th><th>Staff</th></tr>{{range .Age}}<tr><td>{{.Key}}</td><td>{{.Count}}</td></tr>{{end}}</table>
+</div>
+
+<h2>Schools ({{len .Schools}})</h2>
+<table><tr><th>School ID</th><th>School</th><th>Inspector</th><th>Head</th><th>Enrolment</th><th>Staff</th><th>Teachers / needed</th><th>PTR</th><th>Surplus (+) / vacancy (−)</th><th>DBT</th></tr>
+{{range .Schools}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.SIName}}</td><td{{if not .Head}} class="bad"{{end}}>{{or .Head "none"}}</td><td>{{.TotalEnrolment}}</td><td>{{.Staff.TotalStaff}}</td><td>{{.Staff.ActualTeachers}} / {{.Staff.NeededTeachers}}</td><td>{{printf "%.1f" .Staff.Ratio}}</td><td>{{.Staff.SurplusVacancy}}</td><td>{{.DBTTotal}}</td></tr>{{end}}
+</table>
+
+<h2>Employees ({{len .Employees}})</h2>
+<table><tr><th>Employee ID</th><th>Name</th><th>Designation</th><th>School ID</th><th>School</th><th>Gender</th><th>Age</th><th>Joined</th><th>Category</th></tr>
+{{range .Employees}}<tr><td>{{.ID}}</td><td>{{.Name}}</td><td>{{.Designation}}</td><td>{{.SchoolID}}</td><td>{{.SchoolName}}</td><td>{{.Gender}}</td><td>{{if .Age}}{{.Age}}{{end}}</td><td>{{.DOJ}}</td><td>{{.SelectionCategory}}</td></tr>{{end}}
+</table>
+</body></html>`))